@@ -0,0 +1,246 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/metrics-server/pkg/server"
+)
+
+// nonConfigFlags can't be set in the config file.
+var nonConfigFlags = map[string]bool{"config": true, "version": true, "help": true}
+
+// reloadableFlags copies values of flags applied without restart when the
+// config file changes from one Options to another.
+var reloadableFlags = map[string]func(to, from *Options){
+	"kubelet-request-timeout-margin": func(to, from *Options) {
+		to.KubeletClient.KubeletRequestTimeoutMargin = from.KubeletClient.KubeletRequestTimeoutMargin
+	},
+	"skip-not-ready-nodes":      func(to, from *Options) { to.KubeletClient.SkipNotReadyNodes = from.KubeletClient.SkipNotReadyNodes },
+	"skip-node-taints":          func(to, from *Options) { to.KubeletClient.SkipNodeTaints = from.KubeletClient.SkipNodeTaints },
+	"scrape-budget-bytes":       func(to, from *Options) { to.ScrapeBudgetBytes = from.ScrapeBudgetBytes },
+	"scrape-budget-duration":    func(to, from *Options) { to.ScrapeBudgetDuration = from.ScrapeBudgetDuration },
+	"scrape-spread-per-node":    func(to, from *Options) { to.ScrapeSpreadPerNode = from.ScrapeSpreadPerNode },
+	"scrape-failure-threshold":  func(to, from *Options) { to.ScrapeFailureThreshold = from.ScrapeFailureThreshold },
+	"scrape-max-backoff-cycles": func(to, from *Options) { to.ScrapeMaxBackoffCycles = from.ScrapeMaxBackoffCycles },
+	"metric-history-length":     func(to, from *Options) { to.MetricHistoryLength = from.MetricHistoryLength },
+	"metric-retained-points":    func(to, from *Options) { to.MetricRetainedPoints = from.MetricRetainedPoints },
+	"cpu-rate-window":           func(to, from *Options) { to.CPURateWindow = from.CPURateWindow },
+	"usage-smoothing-half-life": func(to, from *Options) { to.UsageSmoothingHalfLife = from.UsageSmoothingHalfLife },
+	"resource-names":            func(to, from *Options) { to.ResourceNames = from.ResourceNames },
+	"storage-eviction-ttl":      func(to, from *Options) { to.EvictionTTL = from.EvictionTTL },
+	"include-namespaces":        func(to, from *Options) { to.IncludeNamespaces = from.IncludeNamespaces },
+	"exclude-namespaces":        func(to, from *Options) { to.ExcludeNamespaces = from.ExcludeNamespaces },
+}
+
+// ApplyConfigFile sets flags of fs to their values in the config file, if
+// any. Flags set on the command line take precedence.
+func (o *Options) ApplyConfigFile(fs *pflag.FlagSet) error {
+	if o.ConfigFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(o.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %v", err)
+	}
+	o.configExplicit = map[string]bool{}
+	fs.Visit(func(f *pflag.Flag) {
+		o.configExplicit[f.Name] = true
+	})
+	o.configFlags = map[string]bool{}
+	fs.VisitAll(func(f *pflag.Flag) {
+		if !nonConfigFlags[f.Name] {
+			o.configFlags[f.Name] = true
+		}
+	})
+	values, err := o.parseConfigFile(content)
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(values) {
+		if o.configExplicit[name] {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("invalid value of %s in config file: %v", name, err)
+		}
+	}
+	o.configValues = values
+	return nil
+}
+
+// LoadSettings returns the settings applied without restart read from config,
+// a changed content of the config file, and the flags it changes that are
+// only applied on restart. Reloadable flags set neither in config nor on the
+// command line return to their defaults.
+func (o *Options) LoadSettings(config []byte) (server.Settings, []string, error) {
+	values, err := o.parseConfigFile(config)
+	if err != nil {
+		return server.Settings{}, nil, err
+	}
+	next := *o
+	kubeletClient := *o.KubeletClient
+	next.KubeletClient = &kubeletClient
+	defaults := NewOptions()
+	for name, reload := range reloadableFlags {
+		if !o.configExplicit[name] {
+			reload(&next, defaults)
+		}
+	}
+	// Values are parsed by flags bound to a scratch copy of the defaults, as
+	// registering flags resets some of the values they are bound to.
+	fs := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	defaults.addFlags(fs)
+	defaults.KubeletClient.AddFlags(fs)
+	var restart []string
+	for _, name := range sortedKeys(values) {
+		if o.configExplicit[name] {
+			continue
+		}
+		reload, found := reloadableFlags[name]
+		if !found {
+			if previous, found := o.configValues[name]; !found || previous != values[name] {
+				restart = append(restart, name)
+			}
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return server.Settings{}, nil, fmt.Errorf("invalid value of %s in config file: %v", name, err)
+		}
+		reload(&next, defaults)
+	}
+	for name := range o.configValues {
+		if _, found := values[name]; !found && reloadableFlags[name] == nil && !o.configExplicit[name] {
+			restart = append(restart, name)
+		}
+	}
+	sort.Strings(restart)
+	errors := next.KubeletClient.Validate()
+	errors = append(errors, next.validate()...)
+	if len(errors) != 0 {
+		return server.Settings{}, nil, utilerrors.NewAggregate(errors)
+	}
+	return next.settings(), restart, nil
+}
+
+func (o *Options) settings() server.Settings {
+	return server.Settings{
+		ScrapeTimeoutMargin:    o.KubeletClient.KubeletRequestTimeoutMargin,
+		SkipNotReadyNodes:      o.KubeletClient.SkipNotReadyNodes,
+		SkipNodeTaints:         o.KubeletClient.SkipNodeTaints,
+		ScrapeBudgetBytes:      o.ScrapeBudgetBytes,
+		ScrapeBudgetDuration:   o.ScrapeBudgetDuration,
+		ScrapeSpreadPerNode:    o.ScrapeSpreadPerNode,
+		ScrapeFailureThreshold: o.ScrapeFailureThreshold,
+		ScrapeMaxBackoffCycles: o.ScrapeMaxBackoffCycles,
+		MetricHistoryLength:    o.MetricHistoryLength,
+		MetricRetainedPoints:   o.MetricRetainedPoints,
+		CPURateWindow:          o.CPURateWindow,
+		UsageSmoothingHalfLife: o.UsageSmoothingHalfLife,
+		ResourceNames:          o.ResourceNames,
+		EvictionTTL:            o.EvictionTTL,
+		IncludeNamespaces:      o.IncludeNamespaces,
+		ExcludeNamespaces:      o.ExcludeNamespaces,
+	}
+}
+
+// parseConfigFile returns flag values of the config file content, in the
+// format of command line values.
+func (o *Options) parseConfigFile(content []byte) (map[string]string, error) {
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("unable to parse config file: %v", err)
+	}
+	values := make(map[string]string, len(config))
+	for name, value := range config {
+		if !o.configFlags[name] {
+			return nil, fmt.Errorf("unknown flag %s in config file", name)
+		}
+		if m, ok := value.(map[string]interface{}); ok && len(m) == 0 {
+			// Maps are empty by default, and flags don't parse empty maps.
+			continue
+		}
+		v, err := configValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s in config file: %v", name, err)
+		}
+		values[name] = v
+	}
+	return values, nil
+}
+
+// configValue formats value like on the command line: lists as comma
+// separated values and maps as comma separated key=value pairs.
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := configScalar(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		pairs := make([]string, 0, len(v))
+		for key, item := range v {
+			s, err := configScalar(item)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, key+"="+s)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), nil
+	default:
+		return configScalar(value)
+	}
+}
+
+func configScalar(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/spf13/pflag"
+
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
+
+	"sigs.k8s.io/metrics-server/pkg/features"
+)
+
+// configFileOptions returns options with flags parsed from args, like on the
+// command line, and the config file at path applied.
+func configFileOptions(t *testing.T, path string, args ...string) (*Options, error) {
+	t.Helper()
+	o := NewOptions()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	for _, f := range o.Flags().FlagSets {
+		fs.AddFlagSet(f)
+	}
+	if err := fs.Parse(append([]string{"--config", path}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return o, o.ApplyConfigFile(fs)
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+metric-resolution: 30s
+metric-history-length: 5
+exclude-namespaces: [kube-system, monitoring]
+resource-names:
+  example.com/gpu: gpu
+kubelet-insecure-tls: true
+scrape-budget-bytes: 10000000000
+secure-port: 4443
+`)
+	o, err := configFileOptions(t, path, "--metric-history-length=3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if o.MetricResolution != 30*time.Second {
+		t.Errorf("Unexpected metric resolution %v", o.MetricResolution)
+	}
+	if o.MetricHistoryLength != 3 {
+		t.Errorf("Expected the command line to take precedence, got metric history length %d", o.MetricHistoryLength)
+	}
+	if diff := cmp.Diff([]string{"kube-system", "monitoring"}, o.ExcludeNamespaces); diff != "" {
+		t.Errorf("Unexpected excluded namespaces, diff:\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"example.com/gpu": "gpu"}, o.ResourceNames); diff != "" {
+		t.Errorf("Unexpected resource names, diff:\n%s", diff)
+	}
+	if !o.KubeletClient.InsecureKubeletTLS || o.ScrapeBudgetBytes != 10000000000 || o.SecureServing.BindPort != 4443 {
+		t.Errorf("Unexpected options %+v", o)
+	}
+}
+
+func TestApplyConfigFile_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "unknown flag",
+			config: "metric-resolutions: 30s\n",
+		},
+		{
+			name:   "invalid value",
+			config: "metric-resolution: fast\n",
+		},
+		{
+			name:   "flag only allowed on the command line",
+			config: "version: true\n",
+		},
+		{
+			name:   "nested list",
+			config: "exclude-namespaces: [[kube-system]]\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := configFileOptions(t, writeConfigFile(t, tc.config)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, features.MetricsHistory, true)()
+	path := writeConfigFile(t, `
+metric-resolution: 30s
+scrape-budget-bytes: 1000
+exclude-namespaces: [kube-system]
+`)
+	o, err := configFileOptions(t, path, "--metric-history-length=3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	settings, restart, err := o.LoadSettings([]byte(`
+metric-resolution: 20s
+metric-history-length: 7
+cpu-rate-window: 1m
+exclude-namespaces: [monitoring]
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := NewOptions().settings()
+	want.MetricHistoryLength = 3
+	want.CPURateWindow = time.Minute
+	want.ExcludeNamespaces = []string{"monitoring"}
+	if diff := cmp.Diff(want, settings); diff != "" {
+		t.Errorf("Unexpected settings, diff:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"metric-resolution"}, restart); diff != "" {
+		t.Errorf("Unexpected flags requiring restart, diff:\n%s", diff)
+	}
+	if o.MetricResolution != 30*time.Second || o.ScrapeBudgetBytes != 1000 {
+		t.Errorf("Expected running options to be unchanged, got %+v", o)
+	}
+
+	for _, config := range []string{"metric-retained-points: 1\n", "cpu-rate-window: soon\n", "unknown: 1\n"} {
+		if _, _, err := o.LoadSettings([]byte(config)); err == nil {
+			t.Errorf("Expected error loading %q", config)
+		}
+	}
+}
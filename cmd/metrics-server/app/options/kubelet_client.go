@@ -15,14 +15,20 @@ package options
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/rest"
 
+	"sigs.k8s.io/metrics-server/pkg/features"
+	"sigs.k8s.io/metrics-server/pkg/scraper"
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/resource"
 	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
@@ -31,12 +37,39 @@ type KubeletClientOptions struct {
 	KubeletPort                         int
 	InsecureKubeletTLS                  bool
 	KubeletPreferredAddressTypes        []string
+	KubeletAddressResolver              string
+	KubeletAddressFamily                string
 	KubeletCAFile                       string
 	KubeletClientKeyFile                string
 	KubeletClientCertFile               string
+	KubeletNodePoolsConfig              string
+	KubeletClientCertRotation           bool
+	KubeletClientCertDir                string
 	DeprecatedCompletelyInsecureKubelet bool
 	KubeletRequestTimeout               time.Duration
+	KubeletRequestTimeoutMargin         time.Duration
 	NodeSelector                        string
+	TopologyLabel                       string
+	TopologyDomain                      string
+	SkipNotReadyNodes                   bool
+	SkipNodeTaints                      []string
+	KubeletVolumeStats                  bool
+	KubeletProcessStats                 bool
+	KubeletFilesystemStats              bool
+	KubeletMaxContainersPerNode         int
+	KubeletCPUThrottling                bool
+	KubeletCadvisorFallback             bool
+	KubeletTLSSessionCacheSize          int
+	KubeletMaxIdleConnsPerNode          int
+	KubeletIdleConnTimeout              time.Duration
+	KubeletDisableCompression           bool
+	KubeletClockSkewTolerance           time.Duration
+	KubeletLocalEndpoint                string
+	EgressSelectorConfigFile            string
+	MetricsSource                       string
+	CRIEndpoint                         string
+	PodResourcesEndpoint                string
+	NodeName                            string
 }
 
 func (o *KubeletClientOptions) Validate() []error {
@@ -63,9 +96,104 @@ func (o *KubeletClientOptions) Validate() []error {
 	if (o.KubeletCAFile != "") && o.DeprecatedCompletelyInsecureKubelet {
 		errors = append(errors, fmt.Errorf("cannot use both --kubelet-certificate-authority and --deprecated-kubelet-completely-insecure"))
 	}
+	if o.KubeletClientCertRotation {
+		if o.KubeletClientCertFile != "" || o.KubeletClientKeyFile != "" {
+			errors = append(errors, fmt.Errorf("cannot use --kubelet-client-certificate-rotation with --kubelet-client-certificate or --kubelet-client-key"))
+		}
+		if o.DeprecatedCompletelyInsecureKubelet || o.KubeletLocalEndpoint != "" || o.MetricsSource == client.MetricsSourceCRI {
+			errors = append(errors, fmt.Errorf("cannot use --kubelet-client-certificate-rotation with --deprecated-kubelet-completely-insecure, --kubelet-local-endpoint or --metrics-source=%s, which don't present client certificates", client.MetricsSourceCRI))
+		}
+	} else if o.KubeletClientCertDir != "" {
+		errors = append(errors, fmt.Errorf("kubelet-client-certificate-dir requires --kubelet-client-certificate-rotation"))
+	}
+	if o.KubeletNodePoolsConfig != "" && (o.DeprecatedCompletelyInsecureKubelet || o.KubeletLocalEndpoint != "") {
+		errors = append(errors, fmt.Errorf("cannot use --kubelet-node-pools-config with --deprecated-kubelet-completely-insecure or --kubelet-local-endpoint, which connect without TLS"))
+	}
+	if _, err := utils.ParseAddressFamily(o.KubeletAddressFamily); err != nil {
+		errors = append(errors, fmt.Errorf("kubelet-address-family should be one of %v, but value %q provided", utils.AddressFamilies, o.KubeletAddressFamily))
+	}
+	if o.KubeletAddressResolver != "" && !addressResolverRegistered(o.KubeletAddressResolver) {
+		errors = append(errors, fmt.Errorf("kubelet-address-resolver should be one of %v, but value %q provided", utils.NodeAddressResolvers(), o.KubeletAddressResolver))
+	}
 	if o.KubeletRequestTimeout <= 0 {
 		errors = append(errors, fmt.Errorf("kubelet-request-timeout should be positive"))
 	}
+	if o.KubeletRequestTimeoutMargin < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-request-timeout-margin should be a non-negative duration, but value %v provided", o.KubeletRequestTimeoutMargin))
+	}
+	if _, err := labels.Parse(o.NodeSelector); err != nil {
+		errors = append(errors, fmt.Errorf("node-selector should be a valid label selector: %v", err))
+	}
+	if o.TopologyDomain != "" {
+		if errs := validation.IsQualifiedName(o.TopologyLabel); len(errs) != 0 {
+			errors = append(errors, fmt.Errorf("topology-label should be a label key: %s", strings.Join(errs, ", ")))
+		}
+		if o.TopologyDomain == "local" {
+			if o.NodeName == "" {
+				errors = append(errors, fmt.Errorf("node-name is required with --topology-domain=local"))
+			}
+		} else if errs := validation.IsValidLabelValue(o.TopologyDomain); len(errs) != 0 {
+			errors = append(errors, fmt.Errorf("topology-domain should be a label value: %s", strings.Join(errs, ", ")))
+		}
+	}
+	if _, err := scraper.ParseTaints(o.SkipNodeTaints); err != nil {
+		errors = append(errors, fmt.Errorf("skip-node-taints should be a list of key[:effect] taints: %v", err))
+	}
+	if o.KubeletTLSSessionCacheSize < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-tls-session-cache-size should not be negative"))
+	}
+	if o.KubeletMaxIdleConnsPerNode < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-max-idle-conns-per-node should not be negative"))
+	}
+	if o.KubeletIdleConnTimeout < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-idle-conn-timeout should not be negative"))
+	}
+	if o.KubeletClockSkewTolerance < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-clock-skew-tolerance should not be negative"))
+	}
+	if o.KubeletMaxContainersPerNode < 0 {
+		errors = append(errors, fmt.Errorf("kubelet-max-containers-per-node should not be negative"))
+	}
+	if o.KubeletLocalEndpoint != "" {
+		if _, _, err := resource.ParseLocalEndpoint(o.KubeletLocalEndpoint); err != nil {
+			errors = append(errors, fmt.Errorf("kubelet-local-endpoint should be a unix socket or loopback http URL: %v", err))
+		}
+		if o.NodeName == "" {
+			errors = append(errors, fmt.Errorf("node-name is required with --kubelet-local-endpoint"))
+		}
+		if o.MetricsSource == client.MetricsSourceCRI {
+			errors = append(errors, fmt.Errorf("cannot use both --kubelet-local-endpoint and --metrics-source=%s", client.MetricsSourceCRI))
+		}
+		if o.EgressSelectorConfigFile != "" {
+			errors = append(errors, fmt.Errorf("cannot use both --kubelet-local-endpoint and --egress-selector-config-file"))
+		}
+	}
+	if o.PodResourcesEndpoint != "" {
+		if !strings.HasPrefix(o.PodResourcesEndpoint, "unix://") {
+			errors = append(errors, fmt.Errorf("pod-resources-endpoint should be a unix socket URL, but value %q provided", o.PodResourcesEndpoint))
+		}
+		if o.MetricsSource != client.MetricsSourceCRI && o.KubeletLocalEndpoint == "" {
+			errors = append(errors, fmt.Errorf("pod-resources-endpoint requires --metrics-source=%s or --kubelet-local-endpoint, as only the local node's pod resources can be read", client.MetricsSourceCRI))
+		}
+	}
+	switch o.MetricsSource {
+	case "", client.MetricsSourceKubelet:
+	case client.MetricsSourceCRI:
+		if !features.Enabled(features.CRIMetricsSource) {
+			errors = append(errors, fmt.Errorf("metrics-source=%s requires the %s feature gate", client.MetricsSourceCRI, features.CRIMetricsSource))
+		}
+		if !strings.HasPrefix(o.CRIEndpoint, "unix://") {
+			errors = append(errors, fmt.Errorf("cri-endpoint should be a unix socket URL, but value %q provided", o.CRIEndpoint))
+		}
+		if o.NodeName == "" {
+			errors = append(errors, fmt.Errorf("node-name is required with --metrics-source=%s", client.MetricsSourceCRI))
+		}
+		if o.KubeletVolumeStats || o.KubeletProcessStats || o.KubeletFilesystemStats || o.KubeletCPUThrottling || o.KubeletCadvisorFallback || o.KubeletMaxContainersPerNode != 0 {
+			errors = append(errors, fmt.Errorf("cannot use --kubelet-volume-stats, --kubelet-process-stats, --kubelet-filesystem-stats, --kubelet-cpu-throttling, --kubelet-cadvisor-fallback or --kubelet-max-containers-per-node with --metrics-source=%s", client.MetricsSourceCRI))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("metrics-source should be one of %q or %q, but value %q provided", client.MetricsSourceKubelet, client.MetricsSourceCRI, o.MetricsSource))
+	}
 	return errors
 }
 
@@ -74,11 +202,38 @@ func (o *KubeletClientOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&o.KubeletUseNodeStatusPort, "kubelet-use-node-status-port", o.KubeletUseNodeStatusPort, "Use the port in the node status. Takes precedence over --kubelet-port flag.")
 	fs.IntVar(&o.KubeletPort, "kubelet-port", o.KubeletPort, "The port to use to connect to Kubelets.")
 	fs.StringSliceVar(&o.KubeletPreferredAddressTypes, "kubelet-preferred-address-types", o.KubeletPreferredAddressTypes, "The priority of node address types to use when determining which address to use to connect to a particular node")
+	fs.StringVar(&o.KubeletAddressFamily, "kubelet-address-family", o.KubeletAddressFamily, "IP family of node addresses used to connect to Kubelets on dual-stack clusters. any picks addresses by kubelet-preferred-address-types regardless of their family, prefer-ipv4 and prefer-ipv6 pick IP addresses of the family by kubelet-preferred-address-types and fall back to any address on nodes without one, ipv4 and ipv6 only pick IP addresses of the family, never host names.")
+	fs.StringVar(&o.KubeletAddressResolver, "kubelet-address-resolver", o.KubeletAddressResolver, "Resolver picking the address used to connect to a node's Kubelet. priority picks the first node address by kubelet-preferred-address-types, annotation uses the address in the metrics.k8s.io/kubelet-address node annotation, e.g. a jump host mapping, and falls back to priority. Custom builds can register additional resolvers.")
 	fs.StringVar(&o.KubeletCAFile, "kubelet-certificate-authority", "", "Path to the CA to use to validate the Kubelet's serving certificates.")
 	fs.StringVar(&o.KubeletClientKeyFile, "kubelet-client-key", "", "Path to a client key file for TLS.")
 	fs.StringVar(&o.KubeletClientCertFile, "kubelet-client-certificate", "", "Path to a client cert file for TLS.")
+	fs.BoolVar(&o.KubeletClientCertRotation, "kubelet-client-certificate-rotation", o.KubeletClientCertRotation, "Request the client certificate presented to Kubelets from the certificates.k8s.io API with the kubernetes.io/kube-apiserver-client signer and rotate it before it expires, instead of mounting a long-lived --kubelet-client-certificate. Certificates are issued to the metrics-server user once their CertificateSigningRequest is approved. Requires create, get, list and watch permissions on certificatesigningrequests.")
+	fs.StringVar(&o.KubeletClientCertDir, "kubelet-client-certificate-dir", o.KubeletClientCertDir, "Directory the client certificate requested with --kubelet-client-certificate-rotation is stored in, so restarts reuse it instead of requesting a new one. Certificates are kept in memory if empty.")
+	fs.StringVar(&o.KubeletNodePoolsConfig, "kubelet-node-pools-config", o.KubeletNodePoolsConfig, "Path to a YAML file listing node pools, selected by node label selector, whose Kubelets are connected to with their own certificate authority and client certificate instead of --kubelet-certificate-authority and --kubelet-client-certificate, e.g. in clusters mixing on-premise and cloud node pools. Nodes matching several pools use the first one.")
 	fs.DurationVar(&o.KubeletRequestTimeout, "kubelet-request-timeout", o.KubeletRequestTimeout, "The length of time to wait before giving up on a single request to Kubelet. Non-zero values should contain a corresponding time unit (e.g. 1s, 2m, 3h).")
-	fs.StringVarP(&o.NodeSelector, "node-selector", "l", o.NodeSelector, "Selector (label query) to filter on, not including uninitialized ones, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2).")
+	fs.DurationVar(&o.KubeletRequestTimeoutMargin, "kubelet-request-timeout-margin", o.KubeletRequestTimeoutMargin, "Derive the request timeout of each node from its last 100 successful requests: their 99th percentile duration plus this margin, at most 90% of the scrape cycle interval. Slow but working Kubelets are not cut off by kubelet-request-timeout and unresponsive ones fail fast. Nodes without successful requests use kubelet-request-timeout, timeouts double after each timeout of a node until a request succeeds. Set to 0 to use kubelet-request-timeout for all nodes.")
+	fs.BoolVar(&o.KubeletVolumeStats, "kubelet-volume-stats", o.KubeletVolumeStats, "Fetch persistent volume claim usage from the Kubelet Summary API and expose it in the metrics.k8s.io/volumes annotation of PodMetrics. Requires get permission on nodes/stats.")
+	fs.BoolVar(&o.KubeletCPUThrottling, "kubelet-cpu-throttling", o.KubeletCPUThrottling, "Fetch CFS throttling counters from the Kubelet cAdvisor metrics and expose throttling rates of containers with CPU limit in the metrics.k8s.io/cpu-throttling annotation of PodMetrics.")
+	fs.IntVar(&o.KubeletTLSSessionCacheSize, "kubelet-tls-session-cache-size", o.KubeletTLSSessionCacheSize, "Number of Kubelets TLS sessions are cached for, so reconnecting resumes the session instead of a full handshake, saving CPU on metrics-server and Kubelets. Should be at least the number of nodes. Set to 0 to disable session resumption.")
+	fs.IntVar(&o.KubeletMaxIdleConnsPerNode, "kubelet-max-idle-conns-per-node", o.KubeletMaxIdleConnsPerNode, "Number of idle connections kept open per Kubelet for reuse by the next scrapes. Kubelets supporting HTTP/2 are scraped over a single connection.")
+	fs.DurationVar(&o.KubeletIdleConnTimeout, "kubelet-idle-conn-timeout", o.KubeletIdleConnTimeout, "Duration idle connections to Kubelets are kept open, so scrape cycles reuse them instead of reconnecting with a TLS handshake. Should exceed the interval between scrapes of a node. Set to 0 to keep them for twice metric-resolution, at least 90s.")
+	fs.BoolVar(&o.KubeletDisableCompression, "kubelet-disable-compression", o.KubeletDisableCompression, "Do not request gzip compressed responses from Kubelets. Compression reduces network traffic, e.g. across zones, for a little CPU on metrics-server and Kubelets.")
+	fs.DurationVar(&o.KubeletClockSkewTolerance, "kubelet-clock-skew-tolerance", o.KubeletClockSkewTolerance, "Skew of Kubelet clocks, estimated from the Date header of their responses, above which timestamps of their metrics are shifted to the metrics-server clock, so CPU rates and metric windows are right. Set to e.g. 2s to enable the correction, 0 disables it.")
+	fs.BoolVar(&o.KubeletCadvisorFallback, "kubelet-cadvisor-fallback", o.KubeletCadvisorFallback, "Fetch the Kubelet cAdvisor metrics when the resource metrics endpoint fails or misses node or container metrics, e.g. on runtimes not reporting all containers, and fill the missing metrics from them.")
+	fs.IntVar(&o.KubeletMaxContainersPerNode, "kubelet-max-containers-per-node", o.KubeletMaxContainersPerNode, "Number of containers above which only pod level metrics are collected from a node. Pods on such nodes are served with a single _pod container entry, container series past the limit aren't decoded. Requires Kubelet reporting pod level metrics, pods without them are dropped. 0 means no limit.")
+	fs.BoolVar(&o.KubeletProcessStats, "kubelet-process-stats", o.KubeletProcessStats, "Fetch process counts from the Kubelet Summary API and expose them as pid usage of NodeMetrics and in the metrics.k8s.io/process-count annotation of PodMetrics. Requires get permission on nodes/stats.")
+	fs.BoolVar(&o.KubeletFilesystemStats, "kubelet-filesystem-stats", o.KubeletFilesystemStats, "Fetch filesystem usage from the Kubelet Summary API and expose usage of the nodefs, imagefs and containerfs filesystems in the metrics.k8s.io/filesystems annotation of NodeMetrics, and ephemeral storage usage in the one of PodMetrics. Requires get permission on nodes/stats.")
+	fs.StringVar(&o.EgressSelectorConfigFile, "egress-selector-config-file", o.EgressSelectorConfigFile, "File with an apiserver EgressSelectorConfiguration, as used by kube-apiserver. Kubelets are dialed through its cluster egress selection, e.g. a Konnectivity server, for control planes without network access to nodes. Kubelets are dialed directly if empty.")
+	fs.StringVar(&o.MetricsSource, "metrics-source", o.MetricsSource, "Where to read metrics from, one of kubelet or cri. With cri, container metrics are read from the container runtime of the local node set by --node-name and node metrics from /proc, for running metrics-server as a DaemonSet where the Kubelet resource metrics endpoint is incomplete or disabled. cri requires the CRIMetricsSource feature gate and --push-aggregator-url, as agents only have metrics of their node and must not serve the metrics API.")
+	fs.StringVar(&o.CRIEndpoint, "cri-endpoint", o.CRIEndpoint, "Unix socket URL of the container runtime read with --metrics-source=cri.")
+	fs.StringVar(&o.PodResourcesEndpoint, "pod-resources-endpoint", o.PodResourcesEndpoint, "Unix socket URL of the Kubelet pod resources API of the local node, e.g. unix:///var/lib/kubelet/pod-resources/kubelet.sock, read with --metrics-source=cri or --kubelet-local-endpoint. Devices allocated to containers by device plugins and dynamic resource claims are exposed in the metrics.k8s.io/devices annotation of PodMetrics. Devices are not collected if empty.")
+	fs.StringVar(&o.KubeletLocalEndpoint, "kubelet-local-endpoint", o.KubeletLocalEndpoint, "URL of the Kubelet of the node set by --node-name, for running metrics-server as a DaemonSet scraping only its node. Either a unix socket, e.g. unix:///var/run/kubelet/metrics.sock, or a loopback HTTP address, e.g. http://localhost:10255. Requests are sent without TLS nor credentials and node addresses are not resolved. Kubelets are scraped by node address if empty.")
+	fs.StringVar(&o.NodeName, "node-name", o.NodeName, "Name of the node metrics-server runs on, the only node scraped with --metrics-source=cri or --kubelet-local-endpoint. Usually set from spec.nodeName with the downward API.")
+	fs.StringVarP(&o.NodeSelector, "node-selector", "l", o.NodeSelector, "Selector (label query) of nodes to scrape, supports '=', '==', '!=', 'in', 'notin' and existence (e.g. -l key1=value1,key2!=value2 or -l '!type.example.com/virtual-kubelet'). NodeMetrics of other nodes are reported as not found.")
+	fs.StringVar(&o.TopologyLabel, "topology-label", o.TopologyLabel, "Node label whose value is the topology domain of a node, e.g. topology.kubernetes.io/region, for --topology-domain.")
+	fs.StringVar(&o.TopologyDomain, "topology-domain", o.TopologyDomain, "Only scrape nodes whose topology-label is this value, so replicas deployed per zone scrape their local zone without cross-zone traffic. local uses the value of the node set by --node-name. Requires --push-aggregator-url, as zone replicas only have metrics of their zone and must not serve the metrics API. Leave empty to scrape nodes of all domains.")
+	fs.BoolVar(&o.SkipNotReadyNodes, "skip-not-ready-nodes", o.SkipNotReadyNodes, "Do not scrape nodes whose Ready condition is not True, including unreachable nodes, instead of waiting for their Kubelet requests to time out. Their metrics expire after a scrape cycle.")
+	fs.StringSliceVar(&o.SkipNodeTaints, "skip-node-taints", o.SkipNodeTaints, "Taints of nodes not to scrape, in the key[:effect] format, e.g. node.kubernetes.io/unreachable or node.kubernetes.io/unschedulable:NoSchedule to skip cordoned nodes. Taints without effect match any effect.")
 	// MarkDeprecated hides the flag from the help. We don't want that.
 	fs.BoolVar(&o.DeprecatedCompletelyInsecureKubelet, "deprecated-kubelet-completely-insecure", o.DeprecatedCompletelyInsecureKubelet, "DEPRECATED: Do not use any encryption, authorization, or authentication when communicating with the Kubelet. This is rarely the right option, since it leaves kubelet communication completely insecure.  If you encounter auth errors, make sure you've enabled token webhook auth on the Kubelet, and if you're in a test cluster with self-signed Kubelet certificates, consider using kubelet-insecure-tls instead.")
 }
@@ -88,7 +243,14 @@ func NewKubeletClientOptions() *KubeletClientOptions {
 	o := &KubeletClientOptions{
 		KubeletPort:                  10250,
 		KubeletPreferredAddressTypes: make([]string, len(utils.DefaultAddressTypePriority)),
+		KubeletAddressResolver:       utils.PriorityNodeAddressResolver,
+		KubeletAddressFamily:         string(utils.AddressFamilyAny),
 		KubeletRequestTimeout:        10 * time.Second,
+		KubeletTLSSessionCacheSize:   5000,
+		KubeletMaxIdleConnsPerNode:   resource.DefaultMaxIdleConnsPerNode,
+		TopologyLabel:                corev1.LabelTopologyZone,
+		MetricsSource:                client.MetricsSourceKubelet,
+		CRIEndpoint:                  "unix:///run/containerd/containerd.sock",
 	}
 
 	for i, addrType := range utils.DefaultAddressTypePriority {
@@ -100,13 +262,35 @@ func NewKubeletClientOptions() *KubeletClientOptions {
 
 func (o KubeletClientOptions) Config(restConfig *rest.Config) *client.KubeletClientConfig {
 	config := &client.KubeletClientConfig{
-		Scheme:              "https",
-		DefaultPort:         o.KubeletPort,
-		AddressTypePriority: o.addressResolverConfig(),
-		UseNodeStatusPort:   o.KubeletUseNodeStatusPort,
-		Client:              *rest.CopyConfig(restConfig),
+		Scheme:                    "https",
+		DefaultPort:               o.KubeletPort,
+		AddressTypePriority:       o.addressResolverConfig(),
+		AddressResolver:           o.KubeletAddressResolver,
+		AddressFamily:             o.KubeletAddressFamily,
+		UseNodeStatusPort:         o.KubeletUseNodeStatusPort,
+		VolumeStats:               o.KubeletVolumeStats,
+		ProcessStats:              o.KubeletProcessStats,
+		FilesystemStats:           o.KubeletFilesystemStats,
+		MaxContainersPerNode:      o.KubeletMaxContainersPerNode,
+		CPUThrottling:             o.KubeletCPUThrottling,
+		CadvisorFallback:          o.KubeletCadvisorFallback,
+		TLSSessionCacheSize:       o.KubeletTLSSessionCacheSize,
+		MaxIdleConnsPerNode:       o.KubeletMaxIdleConnsPerNode,
+		IdleConnTimeout:           o.KubeletIdleConnTimeout,
+		ClockSkewTolerance:        o.KubeletClockSkewTolerance,
+		EgressSelectorConfigFile:  o.EgressSelectorConfigFile,
+		NodePoolsConfigFile:       o.KubeletNodePoolsConfig,
+		ClientCertificateRotation: o.KubeletClientCertRotation,
+		ClientCertificateDir:      o.KubeletClientCertDir,
+		MetricsSource:             o.MetricsSource,
+		CRIEndpoint:               o.CRIEndpoint,
+		LocalEndpoint:             o.KubeletLocalEndpoint,
+		PodResourcesEndpoint:      o.PodResourcesEndpoint,
+		NodeName:                  o.NodeName,
+		Client:                    *rest.CopyConfig(restConfig),
 	}
-	if o.DeprecatedCompletelyInsecureKubelet {
+	config.Client.DisableCompression = o.KubeletDisableCompression
+	if o.DeprecatedCompletelyInsecureKubelet || o.KubeletLocalEndpoint != "" {
 		config.Scheme = "http"
 		config.Client = *rest.AnonymousClientConfig(&config.Client) // don't use auth to avoid leaking auth details to insecure endpoints
 		config.Client.TLSClientConfig = rest.TLSClientConfig{}      // empty TLS config --> no TLS
@@ -138,3 +322,12 @@ func (o KubeletClientOptions) addressResolverConfig() []corev1.NodeAddressType {
 	}
 	return addrPriority
 }
+
+func addressResolverRegistered(name string) bool {
+	for _, registered := range utils.NodeAddressResolvers() {
+		if registered == name {
+			return true
+		}
+	}
+	return false
+}
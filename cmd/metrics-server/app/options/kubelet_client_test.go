@@ -20,8 +20,11 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	v1 "k8s.io/api/core/v1"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/rest"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
 
+	"sigs.k8s.io/metrics-server/pkg/features"
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 )
 
@@ -47,8 +50,14 @@ func TestConfig(t *testing.T) {
 
 	expected := client.KubeletClientConfig{
 		AddressTypePriority: []v1.NodeAddressType{"Hostname", "InternalDNS", "InternalIP", "ExternalDNS", "ExternalIP"},
+		AddressResolver:     "priority",
+		AddressFamily:       "any",
 		Scheme:              "https",
 		DefaultPort:         10250,
+		TLSSessionCacheSize: 5000,
+		MaxIdleConnsPerNode: 25,
+		MetricsSource:       "kubelet",
+		CRIEndpoint:         "unix:///run/containerd/containerd.sock",
 		Client:              *kubeconfig,
 	}
 
@@ -112,6 +121,27 @@ func TestConfig(t *testing.T) {
 				return e
 			},
 		},
+		{
+			name: "KubeletLocalEndpoint resets TLSConfig and auth and sets http scheme",
+			optionsFunc: func() *KubeletClientOptions {
+				o := NewKubeletClientOptions()
+				o.KubeletLocalEndpoint = "unix:///var/run/kubelet/metrics.sock"
+				o.NodeName = "node1"
+				return o
+			},
+			expectFunc: func() client.KubeletClientConfig {
+				e := expected
+				e.Client.TLSClientConfig = rest.TLSClientConfig{}
+				e.Client.Username = ""
+				e.Client.Password = ""
+				e.Client.BearerToken = ""
+				e.Client.BearerTokenFile = ""
+				e.Scheme = "http"
+				e.LocalEndpoint = "unix:///var/run/kubelet/metrics.sock"
+				e.NodeName = "node1"
+				return e
+			},
+		},
 		{
 			name: "KubeletClientCertFile overrides TLS client cert file",
 			optionsFunc: func() *KubeletClientOptions {
@@ -151,6 +181,7 @@ func TestConfig(t *testing.T) {
 }
 
 func TestValidate(t *testing.T) {
+	defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, features.CRIMetricsSource, true)()
 	for _, tc := range []struct {
 		name               string
 		options            *KubeletClientOptions
@@ -252,6 +283,249 @@ func TestValidate(t *testing.T) {
 			},
 			expectedErrorCount: 1,
 		},
+		{
+			name: "cannot give negative --kubelet-max-idle-conns-per-node and --kubelet-idle-conn-timeout",
+			options: &KubeletClientOptions{
+				KubeletMaxIdleConnsPerNode: -1,
+				KubeletIdleConnTimeout:     -time.Second,
+				KubeletRequestTimeout:      10 * time.Second,
+			},
+			expectedErrorCount: 2,
+		},
+		{
+			name: "can scrape nodes of the local zone",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 10 * time.Second,
+				TopologyLabel:         "topology.kubernetes.io/zone",
+				TopologyDomain:        "local",
+				NodeName:              "node1",
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "cannot scrape nodes of the local zone without --node-name",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 10 * time.Second,
+				TopologyLabel:         "topology.kubernetes.io/zone",
+				TopologyDomain:        "local",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "cannot give invalid --topology-label and --topology-domain",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 10 * time.Second,
+				TopologyLabel:         "zone=",
+				TopologyDomain:        "us east",
+			},
+			expectedErrorCount: 2,
+		},
+		{
+			name: "cannot give negative --kubelet-clock-skew-tolerance",
+			options: &KubeletClientOptions{
+				KubeletClockSkewTolerance: -time.Second,
+				KubeletRequestTimeout:     10 * time.Second,
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can scrape the local Kubelet over a unix socket",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletLocalEndpoint:  "unix:///var/run/kubelet/metrics.sock",
+				NodeName:              "node1",
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "can scrape the local Kubelet over a loopback address",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletLocalEndpoint:  "http://127.0.0.1:10255",
+				NodeName:              "node1",
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "cannot scrape the local Kubelet at a remote address without node name",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletLocalEndpoint:  "http://10.0.0.1:10255",
+			},
+			expectedErrorCount: 2,
+		},
+		{
+			name: "cannot scrape the local Kubelet when reading metrics from CRI",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletLocalEndpoint:  "http://localhost:10255",
+				MetricsSource:         "cri",
+				CRIEndpoint:           "unix:///run/containerd/containerd.sock",
+				NodeName:              "node1",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can read pod resources of the local Kubelet",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletLocalEndpoint:  "unix:///var/run/kubelet/metrics.sock",
+				PodResourcesEndpoint:  "unix:///var/lib/kubelet/pod-resources/kubelet.sock",
+				NodeName:              "node1",
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "cannot read pod resources from a TCP address or when scraping all nodes",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				PodResourcesEndpoint:  "localhost:1234",
+			},
+			expectedErrorCount: 2,
+		},
+		{
+			name: "cannot rotate the client certificate with a static one or without TLS",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout:     1 * time.Second,
+				KubeletClientCertRotation: true,
+				KubeletClientCertFile:     "/etc/kubelet-client/tls.crt",
+				KubeletClientKeyFile:      "/etc/kubelet-client/tls.key",
+				KubeletLocalEndpoint:      "unix:///var/run/kubelet/metrics.sock",
+				NodeName:                  "node1",
+			},
+			expectedErrorCount: 2,
+		},
+		{
+			name: "cannot store the client certificate without rotation",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletClientCertDir:  "/var/lib/metrics-server",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "cannot use node pools config when connecting without TLS",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout:  1 * time.Second,
+				KubeletLocalEndpoint:   "unix:///var/run/kubelet/metrics.sock",
+				NodeName:               "node1",
+				KubeletNodePoolsConfig: "/etc/metrics-server/node-pools.yaml",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can read metrics from CRI of the local node",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				MetricsSource:         "cri",
+				CRIEndpoint:           "unix:///run/containerd/containerd.sock",
+				NodeName:              "node1",
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "cannot read metrics from CRI without node name and unix socket",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				MetricsSource:         "cri",
+				CRIEndpoint:           "localhost:1234",
+			},
+			expectedErrorCount: 2,
+		},
+		{
+			name: "cannot fetch Kubelet summary stats when reading metrics from CRI",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				MetricsSource:         "cri",
+				CRIEndpoint:           "unix:///run/containerd/containerd.sock",
+				NodeName:              "node1",
+				KubeletVolumeStats:    true,
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "cannot fall back to Kubelet cAdvisor metrics when reading metrics from CRI",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout:   1 * time.Second,
+				MetricsSource:           "cri",
+				CRIEndpoint:             "unix:///run/containerd/containerd.sock",
+				NodeName:                "node1",
+				KubeletCadvisorFallback: true,
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can give set based --node-selector",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				NodeSelector:          "type notin (virtual-kubelet),!example.com/edge",
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "cannot give invalid --node-selector",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				NodeSelector:          "type in virtual-kubelet",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can skip nodes by taint with and without effect",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				SkipNodeTaints:        []string{"node.kubernetes.io/unreachable", "node.kubernetes.io/unschedulable:NoSchedule"},
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "cannot skip nodes by taint with unknown effect",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				SkipNodeTaints:        []string{"node.kubernetes.io/unreachable:Evict"},
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "cannot give unregistered --kubelet-address-resolver",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout:  1 * time.Second,
+				KubeletAddressResolver: "cloud",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "cannot give negative --kubelet-request-timeout-margin",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout:       1 * time.Second,
+				KubeletRequestTimeoutMargin: -time.Second,
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can prefer IPv6 addresses",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletAddressFamily:  "prefer-ipv6",
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "cannot give unknown --kubelet-address-family",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				KubeletAddressFamily:  "dual",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "cannot give unknown --metrics-source",
+			options: &KubeletClientOptions{
+				KubeletRequestTimeout: 1 * time.Second,
+				MetricsSource:         "summary",
+			},
+			expectedErrorCount: 1,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			errors := tc.options.Validate()
@@ -15,15 +15,23 @@ package options
 
 import (
 	"fmt"
+	"math"
 	"net"
+	"net/url"
 	"strings"
 	"time"
 
+	"github.com/spf13/pflag"
+
+	"k8s.io/apimachinery/pkg/util/validation"
 	openapinamer "k8s.io/apiserver/pkg/endpoints/openapi"
+	genericfeatures "k8s.io/apiserver/pkg/features"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	genericoptions "k8s.io/apiserver/pkg/server/options"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/client-go/pkg/version"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/component-base/cli/flag"
 	"k8s.io/component-base/logs"
@@ -32,7 +40,15 @@ import (
 
 	"sigs.k8s.io/metrics-server/pkg/api"
 	generatedopenapi "sigs.k8s.io/metrics-server/pkg/api/generated/openapi"
+	"sigs.k8s.io/metrics-server/pkg/export"
+	"sigs.k8s.io/metrics-server/pkg/features"
+	"sigs.k8s.io/metrics-server/pkg/filter"
+	"sigs.k8s.io/metrics-server/pkg/replication"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/resource"
 	"sigs.k8s.io/metrics-server/pkg/server"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/storage/prometheus"
 )
 
 type Options struct {
@@ -40,14 +56,95 @@ type Options struct {
 	SecureServing  *genericoptions.SecureServingOptionsWithLoopback
 	Authentication *genericoptions.DelegatingAuthenticationOptions
 	Authorization  *genericoptions.DelegatingAuthorizationOptions
+	StandaloneAuth *StandaloneAuthOptions
 	Audit          *genericoptions.AuditOptions
 	Features       *genericoptions.FeatureOptions
 	KubeletClient  *KubeletClientOptions
 	Logging        *logs.Options
 
-	MetricResolution time.Duration
-	ShowVersion      bool
-	Kubeconfig       string
+	MetricResolution          time.Duration
+	MinNodeScrapeInterval     time.Duration
+	MetricHistoryLength       int
+	MetricRetainedPoints      int
+	CPURateWindow             time.Duration
+	UsageSmoothingHalfLife    time.Duration
+	ResourceNames             map[string]string
+	ScrapeBudgetBytes         int64
+	ScrapeBudgetDuration      time.Duration
+	ScrapeSpreadPerNode       time.Duration
+	ScrapeFailureThreshold    int
+	ScrapeMaxBackoffCycles    int
+	EventScrapeDelay          time.Duration
+	RemovedNodeGracePeriod    time.Duration
+	PushMaxAge                time.Duration
+	PushOnly                  bool
+	PushAggregatorURL         string
+	PushAggregatorCAFile      string
+	FederationKubeconfig      string
+	FederationClusterName     string
+	PodBurstThreshold         int
+	NodeMetricsLabelBuckets   int
+	NodeConditionThreshold    int
+	ShowVersion               bool
+	Kubeconfig                string
+	AnnotateContainerTypes    bool
+	AnnotateContainerStatuses bool
+	AnnotateMissingContainers bool
+
+	FilterConfigMap             string
+	IncludeNamespaces           []string
+	ExcludeNamespaces           []string
+	CanaryPod                   string
+	TransformConfigFile         string
+	SupplementalSourcesConfig   string
+	NodeAddressRefreshInterval  time.Duration
+	DuplicateDetectionNamespace string
+	LeaderElectionNamespace     string
+	LeaderElectionLeaseName     string
+	ReplicationPort             int
+	ReplicationAdvertiseAddress string
+	ReplicationCAFile           string
+	ReplicationCertFile         string
+	ReplicationKeyFile          string
+	ShardCount                  int
+	ShardOrdinal                int
+	ShardPeerURL                string
+	ShardPeerCAFile             string
+	ProfilingCaptureMaxDuration time.Duration
+	ShutdownGracePeriod         time.Duration
+	DebugListenAddress          string
+	MetricsListenAddress        string
+	TracingConfigFile           string
+	ReadinessNodeCoverage       float64
+	ReadinessMaxMetricAge       time.Duration
+	CheckpointPath              string
+	CheckpointInterval          time.Duration
+	CheckpointMaxAge            time.Duration
+	EvictionTTL                 time.Duration
+	RemoteWriteURL              string
+	RemoteWriteTimeout          time.Duration
+	RemoteWriteBearerTokenFile  string
+	RemoteWriteExternalLabels   map[string]string
+	OTLPEndpoint                string
+	OTLPInsecure                bool
+	OTLPTimeout                 time.Duration
+	OTLPHeaders                 map[string]string
+	OTLPResourceAttributes      map[string]string
+	OTLPSelfMetrics             bool
+	PrometheusURL               string
+	PrometheusTimeout           time.Duration
+	PrometheusBearerTokenFile   string
+	PrometheusCAFile            string
+	PrometheusWindow            time.Duration
+	PrometheusQueries           map[string]string
+	ConfigFile                  string
+
+	// configExplicit holds flags set on the command line, which take precedence over the config file.
+	configExplicit map[string]bool
+	// configFlags holds flags that can be set in the config file.
+	configFlags map[string]bool
+	// configValues holds flag values read from the config file on startup.
+	configValues map[string]string
 
 	// Only to be used to for testing
 	DisableAuthForTesting bool
@@ -55,8 +152,9 @@ type Options struct {
 
 func (o *Options) Validate() []error {
 	errors := o.KubeletClient.Validate()
+	errors = append(errors, o.StandaloneAuth.Validate()...)
 	errors = append(errors, o.validate()...)
-	err := logsapi.ValidateAndApply(o.Logging, nil)
+	err := logsapi.ValidateAndApply(o.Logging, utilfeature.DefaultFeatureGate)
 	if err != nil {
 		errors = append(errors, err)
 	}
@@ -68,41 +166,345 @@ func (o *Options) validate() []error {
 	if o.MetricResolution < 10*time.Second {
 		errors = append(errors, fmt.Errorf("metric-resolution should be a time duration at least 10s, but value %v provided", o.MetricResolution))
 	}
+	if o.MinNodeScrapeInterval != 0 && (o.MinNodeScrapeInterval < 10*time.Second || o.MinNodeScrapeInterval > o.MetricResolution) {
+		errors = append(errors, fmt.Errorf("min-node-scrape-interval should be 0 or a time duration between 10s and metric-resolution, but value %v provided", o.MinNodeScrapeInterval))
+	}
+	if _, err := storage.ParseResourceNames(o.ResourceNames); err != nil {
+		errors = append(errors, fmt.Errorf("resource-names should map valid resource names: %v", err))
+	}
+	if o.MetricHistoryLength < 0 {
+		errors = append(errors, fmt.Errorf("metric-history-length should be a non-negative integer, but value %d provided", o.MetricHistoryLength))
+	}
+	if o.MetricHistoryLength > 0 && !features.Enabled(features.MetricsHistory) {
+		errors = append(errors, fmt.Errorf("metric-history-length requires the %s feature gate", features.MetricsHistory))
+	}
+	if o.MetricRetainedPoints != 0 && o.MetricRetainedPoints < storage.DefaultRetainedPoints {
+		errors = append(errors, fmt.Errorf("metric-retained-points should be at least %d, but value %d provided", storage.DefaultRetainedPoints, o.MetricRetainedPoints))
+	}
+	if o.CPURateWindow < 0 {
+		errors = append(errors, fmt.Errorf("cpu-rate-window should be a non-negative duration, but value %v provided", o.CPURateWindow))
+	}
+	if o.UsageSmoothingHalfLife < 0 {
+		errors = append(errors, fmt.Errorf("usage-smoothing-half-life should be a non-negative duration, but value %v provided", o.UsageSmoothingHalfLife))
+	}
+	if o.CheckpointPath != "" && o.CheckpointInterval <= 0 {
+		errors = append(errors, fmt.Errorf("storage-checkpoint-interval should be a positive duration with storage-checkpoint-path, but value %v provided", o.CheckpointInterval))
+	}
+	if o.CheckpointPath != "" && o.CheckpointMaxAge <= 0 {
+		errors = append(errors, fmt.Errorf("storage-checkpoint-max-age should be a positive duration with storage-checkpoint-path, but value %v provided", o.CheckpointMaxAge))
+	}
+	if o.EvictionTTL != 0 && o.EvictionTTL <= o.MetricResolution {
+		errors = append(errors, fmt.Errorf("storage-eviction-ttl should be 0 or a duration above metric-resolution, but value %v provided", o.EvictionTTL))
+	}
+	if o.RemoteWriteURL != "" {
+		if err := o.remoteWriteConfig().Validate(); err != nil {
+			errors = append(errors, fmt.Errorf("remote-write flags are invalid: %v", err))
+		}
+	}
+	if o.OTLPEndpoint != "" {
+		if err := (export.OTLPConfig{Endpoint: o.OTLPEndpoint, Timeout: o.OTLPTimeout}).Validate(); err != nil {
+			errors = append(errors, fmt.Errorf("otlp flags are invalid: %v", err))
+		}
+	}
+	if o.LeaderElectionNamespace != "" {
+		if errs := validation.IsDNS1123Subdomain(o.LeaderElectionLeaseName); len(errs) != 0 {
+			errors = append(errors, fmt.Errorf("leader-election-lease-name %q is invalid: %s", o.LeaderElectionLeaseName, strings.Join(errs, ", ")))
+		}
+		if o.PrometheusURL != "" || o.KubeletClient.KubeletLocalEndpoint != "" || o.KubeletClient.MetricsSource == client.MetricsSourceCRI {
+			errors = append(errors, fmt.Errorf("leader-election-namespace can't be set with prometheus-url, kubelet-local-endpoint or metrics-source=%s, as instances don't scrape the same nodes", client.MetricsSourceCRI))
+		}
+	}
+	if o.ReplicationPort < 0 || o.ReplicationPort > 65535 {
+		errors = append(errors, fmt.Errorf("replication-port should be between 0 and 65535, but value %d provided", o.ReplicationPort))
+	}
+	if o.ReplicationPort > 0 {
+		if o.LeaderElectionNamespace == "" {
+			errors = append(errors, fmt.Errorf("replication-port requires leader-election-namespace"))
+		}
+		if validation.IsValidIP(o.ReplicationAdvertiseAddress) != nil && validation.IsDNS1123Subdomain(o.ReplicationAdvertiseAddress) != nil {
+			errors = append(errors, fmt.Errorf("replication-advertise-address should be an IP address or DNS name, but value %q provided", o.ReplicationAdvertiseAddress))
+		}
+		if o.ReplicationCAFile == "" || o.ReplicationCertFile == "" || o.ReplicationKeyFile == "" {
+			errors = append(errors, fmt.Errorf("replication-port requires replication-ca-file, replication-cert-file and replication-key-file"))
+		}
+	}
+	if o.ShardCount < 0 {
+		errors = append(errors, fmt.Errorf("shard-count should be a non-negative integer, but value %d provided", o.ShardCount))
+	}
+	if o.ShardCount > 1 {
+		if !features.Enabled(features.NodeSharding) {
+			errors = append(errors, fmt.Errorf("shard-count requires the %s feature gate", features.NodeSharding))
+		}
+		if o.ShardOrdinal >= o.ShardCount {
+			errors = append(errors, fmt.Errorf("shard-ordinal should be below shard-count, but value %d provided", o.ShardOrdinal))
+		}
+		if !strings.Contains(o.ShardPeerURL, "$ordinal") {
+			errors = append(errors, fmt.Errorf("shard-peer-url should contain $ordinal, but value %q provided", o.ShardPeerURL))
+		} else if u, err := url.Parse(strings.ReplaceAll(o.ShardPeerURL, "$ordinal", "0")); err != nil || u.Scheme != "https" || u.Host == "" {
+			errors = append(errors, fmt.Errorf("shard-peer-url should be an absolute https URL, but value %q provided", o.ShardPeerURL))
+		}
+		if o.ShardPeerCAFile == "" {
+			errors = append(errors, fmt.Errorf("shard-count requires --shard-peer-ca-file, as the service account token is sent to other shards"))
+		}
+		if o.LeaderElectionNamespace != "" || o.PrometheusURL != "" || o.KubeletClient.KubeletLocalEndpoint != "" || o.KubeletClient.MetricsSource == client.MetricsSourceCRI {
+			errors = append(errors, fmt.Errorf("shard-count can't be set with leader-election-namespace, prometheus-url, kubelet-local-endpoint or metrics-source=%s", client.MetricsSourceCRI))
+		}
+	}
+	if o.PrometheusURL != "" {
+		if !features.Enabled(features.PrometheusMetricsSource) {
+			errors = append(errors, fmt.Errorf("prometheus-url requires the %s feature gate", features.PrometheusMetricsSource))
+		}
+		if err := o.prometheusConfig().Validate(); err != nil {
+			errors = append(errors, fmt.Errorf("prometheus flags are invalid: %v", err))
+		}
+		if o.CheckpointPath != "" || o.RemoteWriteURL != "" || o.OTLPEndpoint != "" {
+			errors = append(errors, fmt.Errorf("prometheus-url can't be set with storage-checkpoint-path, remote-write-url or otlp-endpoint, as usage isn't kept"))
+		}
+		if o.PushMaxAge != 0 || o.CanaryPod != "" {
+			errors = append(errors, fmt.Errorf("prometheus-url can't be set with push-max-age or canary-pod, as Kubelets aren't scraped and stored metrics are never served"))
+		}
+	}
+	if o.ScrapeBudgetBytes < 0 {
+		errors = append(errors, fmt.Errorf("scrape-budget-bytes should be a non-negative integer, but value %d provided", o.ScrapeBudgetBytes))
+	}
+	if o.ScrapeBudgetDuration < 0 {
+		errors = append(errors, fmt.Errorf("scrape-budget-duration should be a non-negative duration, but value %v provided", o.ScrapeBudgetDuration))
+	}
+	if o.ScrapeSpreadPerNode < 0 {
+		errors = append(errors, fmt.Errorf("scrape-spread-per-node should be a non-negative duration, but value %v provided", o.ScrapeSpreadPerNode))
+	}
+	if o.ScrapeFailureThreshold < 0 {
+		errors = append(errors, fmt.Errorf("scrape-failure-threshold should be a non-negative integer, but value %d provided", o.ScrapeFailureThreshold))
+	}
+	if o.ScrapeFailureThreshold > 0 && o.ScrapeMaxBackoffCycles < 1 {
+		errors = append(errors, fmt.Errorf("scrape-max-backoff-cycles should be at least 1, but value %d provided", o.ScrapeMaxBackoffCycles))
+	}
+	if o.NodeAddressRefreshInterval < 0 {
+		errors = append(errors, fmt.Errorf("node-address-refresh-interval should be a non-negative duration, but value %v provided", o.NodeAddressRefreshInterval))
+	}
+	if o.EventScrapeDelay < 0 || (o.EventScrapeDelay != 0 && o.EventScrapeDelay >= o.MetricResolution) {
+		errors = append(errors, fmt.Errorf("event-scrape-delay should be 0 or a positive duration less than metric-resolution, but value %v provided", o.EventScrapeDelay))
+	}
+	if o.RemovedNodeGracePeriod < 0 {
+		errors = append(errors, fmt.Errorf("removed-node-grace-period should be a non-negative duration, but value %v provided", o.RemovedNodeGracePeriod))
+	}
+	if o.PushMaxAge < 0 {
+		errors = append(errors, fmt.Errorf("push-max-age should be a non-negative duration, but value %v provided", o.PushMaxAge))
+	}
+	if o.PushOnly && o.PushMaxAge == 0 {
+		errors = append(errors, fmt.Errorf("push-only requires --push-max-age"))
+	}
+	if o.PushAggregatorURL != "" {
+		if u, err := url.Parse(o.PushAggregatorURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			errors = append(errors, fmt.Errorf("push-aggregator-url should be an https URL, but value %q provided", o.PushAggregatorURL))
+		}
+		local := o.KubeletClient.NodeName != "" && (o.KubeletClient.KubeletLocalEndpoint != "" || o.KubeletClient.MetricsSource == client.MetricsSourceCRI)
+		if !local && o.KubeletClient.TopologyDomain == "" {
+			errors = append(errors, fmt.Errorf("push-aggregator-url requires --node-name with --kubelet-local-endpoint or --metrics-source=%s, or --topology-domain, so only the local node or zone is scraped", client.MetricsSourceCRI))
+		}
+		if o.PushAggregatorCAFile == "" {
+			errors = append(errors, fmt.Errorf("push-aggregator-url requires --push-aggregator-ca-file, as the service account token is sent to the aggregator"))
+		}
+	} else {
+		if o.PushAggregatorCAFile != "" {
+			errors = append(errors, fmt.Errorf("push-aggregator-ca-file requires --push-aggregator-url"))
+		}
+		// Replicas scraping some nodes would serve partial lists behind the APIService shared with full replicas.
+		if o.KubeletClient.TopologyDomain != "" {
+			errors = append(errors, fmt.Errorf("topology-domain requires --push-aggregator-url, as only metrics of the zone are scraped"))
+		}
+		if o.KubeletClient.MetricsSource == client.MetricsSourceCRI {
+			errors = append(errors, fmt.Errorf("metrics-source=%s requires --push-aggregator-url, as only metrics of the local node are read", client.MetricsSourceCRI))
+		}
+	}
+	if o.FederationKubeconfig != "" {
+		if o.PrometheusURL != "" {
+			errors = append(errors, fmt.Errorf("federation-kubeconfig can't be set with prometheus-url, as usage of the local cluster isn't kept"))
+		}
+		if errs := validation.IsValidLabelValue(o.FederationClusterName); o.FederationClusterName == "" || len(errs) != 0 {
+			errors = append(errors, fmt.Errorf("federation-cluster-name should be a non-empty label value, but value %q provided", o.FederationClusterName))
+		}
+	}
+	if o.FilterConfigMap != "" {
+		if namespace, name, err := cache.SplitMetaNamespaceKey(o.FilterConfigMap); err != nil || namespace == "" || name == "" {
+			errors = append(errors, fmt.Errorf("filter-config-map should be in the namespace/name format, but value %q provided", o.FilterConfigMap))
+		}
+	}
+	if _, err := filter.NewNamespaces(o.IncludeNamespaces, o.ExcludeNamespaces); err != nil {
+		errors = append(errors, fmt.Errorf("include-namespaces and exclude-namespaces should be lists of namespaces: %v", err))
+	}
+	if o.CanaryPod != "" {
+		if namespace, name, err := cache.SplitMetaNamespaceKey(o.CanaryPod); err != nil || namespace == "" || name == "" {
+			errors = append(errors, fmt.Errorf("canary-pod should be in the namespace/name format, but value %q provided", o.CanaryPod))
+		}
+	}
+	if o.PodBurstThreshold < 0 {
+		errors = append(errors, fmt.Errorf("pod-burst-threshold should be a non-negative integer, but value %d provided", o.PodBurstThreshold))
+	}
+	if o.NodeMetricsLabelBuckets < 0 || int64(o.NodeMetricsLabelBuckets) > math.MaxUint32 {
+		errors = append(errors, fmt.Errorf("node-metrics-label-buckets should be between 0 and %d, but value %d provided", uint32(math.MaxUint32), o.NodeMetricsLabelBuckets))
+	}
+	if o.NodeConditionThreshold < 0 {
+		errors = append(errors, fmt.Errorf("node-condition-failure-threshold should be a non-negative integer, but value %d provided", o.NodeConditionThreshold))
+	}
+	if o.NodeConditionThreshold > 0 && !features.Enabled(features.MetricsAvailableCondition) {
+		errors = append(errors, fmt.Errorf("node-condition-failure-threshold requires the %s feature gate", features.MetricsAvailableCondition))
+	}
+	if o.ReadinessNodeCoverage < 0 || o.ReadinessNodeCoverage > 100 {
+		errors = append(errors, fmt.Errorf("readiness-node-coverage should be a percentage between 0 and 100, but value %v provided", o.ReadinessNodeCoverage))
+	}
+	if o.ReadinessMaxMetricAge < 0 {
+		errors = append(errors, fmt.Errorf("readiness-max-metric-age should be a non-negative duration, but value %v provided", o.ReadinessMaxMetricAge))
+	}
+	if o.DebugListenAddress != "" && !loopbackAddress(o.DebugListenAddress) {
+		errors = append(errors, fmt.Errorf("debug-listen-address should be a loopback host:port, as debug endpoints aren't authenticated, but value %q provided", o.DebugListenAddress))
+	}
+	if o.MetricsListenAddress != "" {
+		if _, _, err := net.SplitHostPort(o.MetricsListenAddress); err != nil {
+			errors = append(errors, fmt.Errorf("metrics-listen-address should be a host:port, but value %q provided: %v", o.MetricsListenAddress, err))
+		}
+	}
+	if o.TracingConfigFile != "" && !utilfeature.DefaultFeatureGate.Enabled(genericfeatures.APIServerTracing) {
+		errors = append(errors, fmt.Errorf("tracing-config-file requires the %s feature gate", genericfeatures.APIServerTracing))
+	}
+	if o.ShutdownGracePeriod < 0 {
+		errors = append(errors, fmt.Errorf("shutdown-grace-period should be a non-negative duration, but value %v provided", o.ShutdownGracePeriod))
+	}
+	if o.ProfilingCaptureMaxDuration < 0 || o.ProfilingCaptureMaxDuration >= time.Minute {
+		errors = append(errors, fmt.Errorf("profiling-capture-max-duration should be between 0 and 1m as requests time out after 1m, but value %v provided", o.ProfilingCaptureMaxDuration))
+	}
 	if o.MetricResolution*9/10 < o.KubeletClient.KubeletRequestTimeout {
 		errors = append(errors, fmt.Errorf("metric-resolution should be larger than kubelet-request-timeout, but metric-resolution value %v kubelet-request-timeout value %v provided", o.MetricResolution, o.KubeletClient.KubeletRequestTimeout))
 	}
+	if o.MinNodeScrapeInterval != 0 && o.MinNodeScrapeInterval*9/10 < o.KubeletClient.KubeletRequestTimeout {
+		errors = append(errors, fmt.Errorf("min-node-scrape-interval should be larger than kubelet-request-timeout, but min-node-scrape-interval value %v kubelet-request-timeout value %v provided", o.MinNodeScrapeInterval, o.KubeletClient.KubeletRequestTimeout))
+	}
 	return errors
 }
 
 func (o *Options) Flags() (fs flag.NamedFlagSets) {
-	msfs := fs.FlagSet("metrics server")
-	msfs.DurationVar(&o.MetricResolution, "metric-resolution", o.MetricResolution, "The resolution at which metrics-server will retain metrics, must set value at least 10s.")
-	msfs.BoolVar(&o.ShowVersion, "version", false, "Show version")
-	msfs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "The path to the kubeconfig used to connect to the Kubernetes API server and the Kubelets (defaults to in-cluster config)")
-
+	o.addFlags(fs.FlagSet("metrics server"))
 	o.KubeletClient.AddFlags(fs.FlagSet("kubelet client"))
 	o.SecureServing.AddFlags(fs.FlagSet("apiserver secure serving"))
 	o.Authentication.AddFlags(fs.FlagSet("apiserver authentication"))
 	o.Authorization.AddFlags(fs.FlagSet("apiserver authorization"))
+	o.StandaloneAuth.AddFlags(fs.FlagSet("apiserver standalone auth"))
 	o.Audit.AddFlags(fs.FlagSet("apiserver audit log"))
 	o.Features.AddFlags(fs.FlagSet("features"))
+	utilfeature.DefaultMutableFeatureGate.AddFlag(fs.FlagSet("features"))
 	logsapi.AddFlags(o.Logging, fs.FlagSet("logging"))
 
 	return fs
 }
 
+func (o *Options) addFlags(msfs *pflag.FlagSet) {
+	msfs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "Path to a YAML file mapping names of flags, without leading dashes, to their values, e.g. metric-resolution: 30s or exclude-namespaces: [kube-system]. Flags set on the command line take precedence. The file is checked for changes every 10s, changes of cpu-rate-window, exclude-namespaces, include-namespaces, kubelet-request-timeout-margin, metric-history-length, metric-retained-points, resource-names, scrape-budget-bytes, scrape-budget-duration, scrape-failure-threshold, scrape-max-backoff-cycles, scrape-spread-per-node, skip-node-taints, skip-not-ready-nodes, storage-eviction-ttl and usage-smoothing-half-life are applied without restart, changes of other flags on restart. Invalid changes are ignored.")
+	msfs.DurationVar(&o.MetricResolution, "metric-resolution", o.MetricResolution, "The resolution at which metrics-server will retain metrics, must set value at least 10s.")
+	msfs.DurationVar(&o.MinNodeScrapeInterval, "min-node-scrape-interval", o.MinNodeScrapeInterval, "Shortest scrape interval nodes can set with the metrics.k8s.io/scrape-interval annotation, overriding metric-resolution for the node. Scrape cycles run at this interval, nodes are scraped when their interval elapsed and otherwise keep serving their last metrics. Set to 0 to only allow intervals of at least metric-resolution.")
+	msfs.StringToStringVar(&o.ResourceNames, "resource-names", o.ResourceNames, "Names resources read from metrics sources are served with, as source=served pairs, e.g. example.com/gpu-utilization=gpu to normalize vendor specific names. Renamed resources replace resources served under the same name. cpu and memory can't be renamed.")
+	msfs.IntVar(&o.MetricHistoryLength, "metric-history-length", o.MetricHistoryLength, "Number of recent scrapes per node and pod served by the history subresource of NodeMetrics and PodMetrics. Requires the MetricsHistory feature gate. Set to 0 to serve only the latest metrics.")
+	msfs.IntVar(&o.MetricRetainedPoints, "metric-retained-points", o.MetricRetainedPoints, "Number of recent metric points kept in memory per node and container, including the last two from which usage is calculated. Keeping more points costs memory proportionally.")
+	msfs.DurationVar(&o.CPURateWindow, "cpu-rate-window", o.CPURateWindow, "Trailing window CPU usage is calculated over, e.g. 60s to average several scrapes and reduce HPA flapping on single sample spikes. Usage is calculated from the oldest point in the window, metric-retained-points is raised to cover it at metric-resolution. Set to 0 to calculate usage between the last two scrapes.")
+	msfs.DurationVar(&o.UsageSmoothingHalfLife, "usage-smoothing-half-life", o.UsageSmoothingHalfLife, "Half-life of an exponentially weighted moving average applied to served CPU and memory usage, e.g. 2m to damp short spikes for all consumers at the cost of responsiveness. Set to 0 to serve usage of the last scrapes.")
+	msfs.Int64Var(&o.ScrapeBudgetBytes, "scrape-budget-bytes", o.ScrapeBudgetBytes, "Limit of Kubelet response bytes per scrape cycle, estimated from the previous scrape of each node. Nodes scraped most recently are deferred to the next cycle when exceeded and keep serving their last metrics. Set to 0 for no limit.")
+	msfs.DurationVar(&o.ScrapeBudgetDuration, "scrape-budget-duration", o.ScrapeBudgetDuration, "Limit of wall-clock time per scrape cycle, estimated from the time of the previous cycle shared among its nodes. Nodes scraped most recently are deferred to the next cycle when exceeded and keep serving their last metrics. Set to 0 for no limit.")
+	msfs.IntVar(&o.ScrapeFailureThreshold, "scrape-failure-threshold", o.ScrapeFailureThreshold, "Number of consecutive failed scrapes, e.g. timeouts, after which a Kubelet is skipped for 1, 2, 4 and up to scrape-max-backoff-cycles scrape cycles, and probed with a single scrape in between until it recovers. Set to 0 to scrape failing Kubelets every cycle.")
+	msfs.IntVar(&o.ScrapeMaxBackoffCycles, "scrape-max-backoff-cycles", o.ScrapeMaxBackoffCycles, "Maximum number of scrape cycles a failing Kubelet is skipped for between probes.")
+	msfs.DurationVar(&o.NodeAddressRefreshInterval, "node-address-refresh-interval", o.NodeAddressRefreshInterval, "Minimum interval between API server reads of a node whose Kubelet can't be reached, re-resolving its addresses, which may have changed before the informer cache was updated, and retrying the scrape once if they did. Set to 0 to not re-resolve addresses.")
+	msfs.DurationVar(&o.ScrapeSpreadPerNode, "scrape-spread-per-node", o.ScrapeSpreadPerNode, "Spacing between Kubelet scrapes within a scrape cycle. Scrapes are spread over this duration times the number of nodes, at most the scrape cycle interval minus kubelet-request-timeout, keeping the Kubelet request rate stable on large clusters. Set to 0 to start all scrapes within a few seconds.")
+	msfs.DurationVar(&o.EventScrapeDelay, "event-scrape-delay", o.EventScrapeDelay, "Delay of an out-of-band scrape cycle triggered when a node registers or pod-burst-threshold pods start on a node, scraping those nodes so metrics of fresh workloads are available within seconds. Events are batched, at most one out-of-band cycle runs per delay. Set to 0 to only scrape at regular intervals.")
+	msfs.IntVar(&o.PodBurstThreshold, "pod-burst-threshold", o.PodBurstThreshold, "Number of pods starting on a node between scrape cycles that triggers an out-of-band scrape of the node with event-scrape-delay. Requires watching full Pod objects. Set to 0 to only trigger scrapes of registered nodes.")
+	msfs.DurationVar(&o.RemovedNodeGracePeriod, "removed-node-grace-period", o.RemovedNodeGracePeriod, "Duration for which the last metrics of a node deleted from the API, and of its pods, keep being served annotated with metrics.k8s.io/node-removed, smoothing dashboards while pods are migrated during scale down. Set to 0 to stop serving them right away.")
+	msfs.DurationVar(&o.PushMaxAge, "push-max-age", o.PushMaxAge, "Duration for which node metrics pushed by node agents to /push/v1/nodes/<node> are served instead of scraping the node, for nodes metrics-server can't reach, e.g. in air-gapped network segments. Agents push the Kubelet /metrics/resource exposition in the Prometheus text or delimited protobuf format and need RBAC permission to post to the path. Served metrics are annotated with metrics.k8s.io/pushed, nodes are scraped again once their pushed metrics are older. Set to 0 to disable pushing.")
+	msfs.BoolVar(&o.PushOnly, "push-only", o.PushOnly, "Only serve node metrics pushed by node agents and never scrape Kubelets, for the central aggregator of metrics-server node agents deployed as a DaemonSet with --push-aggregator-url. Nodes without fresh pushed metrics are not served. Requires --push-max-age.")
+	msfs.StringVar(&o.PushAggregatorURL, "push-aggregator-url", o.PushAggregatorURL, "https URL of the central metrics-server aggregator, e.g. https://metrics-server.kube-system.svc, metrics of the local node, or of every node of --topology-domain, are pushed to after every scrape cycle, for running metrics-server as a node agent DaemonSet or per zone. Once a full batch was accepted, only pods whose metrics changed are pushed. Requires --node-name with --kubelet-local-endpoint or --metrics-source=cri, or --topology-domain, and RBAC permission to post to /push/v1/nodes/<node> on the aggregator. Leave empty to not push metrics.")
+	msfs.StringVar(&o.PushAggregatorCAFile, "push-aggregator-ca-file", o.PushAggregatorCAFile, "Path to the CA bundle verifying the serving certificate of the push aggregator. Required with push-aggregator-url, as the service account token is only sent to a verified aggregator.")
+	msfs.StringVar(&o.FederationKubeconfig, "federation-kubeconfig", o.FederationKubeconfig, "Path to a kubeconfig file with a context per member cluster, whose node and pod metrics are read from their Metrics API every metric-resolution and merged with the ones of the local cluster. Merged metrics are served on /federation/v1beta1/nodes and /federation/v1beta1/pods, labeled with metrics.k8s.io/cluster set to the context name, and can be restricted with the cluster and namespace query parameters. Leave empty to disable federation.")
+	msfs.StringVar(&o.FederationClusterName, "federation-cluster-name", o.FederationClusterName, "Name of the local cluster in metrics served on the federation endpoints.")
+	msfs.IntVar(&o.NodeMetricsLabelBuckets, "node-metrics-label-buckets", o.NodeMetricsLabelBuckets, "Number of stable hash buckets of node names used as node label of per-node metrics of metrics-server instead of node names, bounding their cardinality on large clusters. Node names map to bucket-N, with N the FNV-1a hash of the name modulo the number of buckets. Set to 0 to label them with node names.")
+	msfs.IntVar(&o.NodeConditionThreshold, "node-condition-failure-threshold", o.NodeConditionThreshold, "Number of consecutive failed scrapes of a node after which its MetricsAvailable condition is set to False, with a reason telling timeouts, TLS, connection, HTTP and decoding errors apart. The condition is set to True once the node is scraped, nodes are only patched when the condition changes. Requires the MetricsAvailableCondition feature gate and permission to patch nodes/status. Set to 0 to not set the condition.")
+	msfs.BoolVar(&o.ShowVersion, "version", false, "Show version")
+	msfs.StringVar(&o.Kubeconfig, "kubeconfig", o.Kubeconfig, "The path to the kubeconfig used to connect to the Kubernetes API server and the Kubelets (defaults to in-cluster config)")
+	msfs.DurationVar(&o.ProfilingCaptureMaxDuration, "profiling-capture-max-duration", o.ProfilingCaptureMaxDuration, "Maximum duration of CPU profile and execution trace captures served on /debug/capture/profile and /debug/capture/trace. The endpoints are disabled when 0, the default.")
+	msfs.Float64Var(&o.ReadinessNodeCoverage, "readiness-node-coverage", o.ReadinessNodeCoverage, "Percentage of nodes whose metrics must be fresh for the metric-storage-ready readiness check to pass, so a few unreachable nodes in large clusters don't make readiness flap. Set to 0 to pass once any metrics are stored.")
+	msfs.DurationVar(&o.ReadinessMaxMetricAge, "readiness-max-metric-age", o.ReadinessMaxMetricAge, "Age above which metrics of a node don't count towards readiness-node-coverage. Set to 0 to use twice the metric-resolution.")
+	msfs.StringVar(&o.DebugListenAddress, "debug-listen-address", o.DebugListenAddress, "Loopback host:port, e.g. 127.0.0.1:6060, on which pprof, expvar and storage statistics are served without authentication on /debug/pprof/, /debug/vars and /debug/storage-stats, e.g. through kubectl port-forward. Leave empty to disable the endpoints.")
+	msfs.StringVar(&o.MetricsListenAddress, "metrics-listen-address", o.MetricsListenAddress, "Host:port, e.g. 127.0.0.1:8080 or :8080, on which self-metrics are served on /metrics over plain HTTP without authentication, in addition to the secure port, so cluster monitoring can scrape them without TLS client certificates nor RBAC permissions. Leave empty to only serve them on the secure port.")
+	msfs.StringVar(&o.TracingConfigFile, "tracing-config-file", o.TracingConfigFile, "Path to an apiserver.config.k8s.io TracingConfiguration file, whose endpoint is the OTLP gRPC collector spans of scrape cycles, per-node scrapes and Metrics API requests are exported to, sampled at samplingRatePerMillion unless the request was sampled by its caller. Leave empty to disable tracing.")
+	msfs.DurationVar(&o.ShutdownGracePeriod, "shutdown-grace-period", o.ShutdownGracePeriod, "Duration for which stopping, e.g. on SIGTERM, waits for the in-flight scrape cycle to complete and be stored, after the server stopped accepting requests, before aborting it. The final storage checkpoint is written afterwards. Set to 0 to abort the in-flight cycle right away.")
+	msfs.StringVar(&o.FilterConfigMap, "filter-config-map", o.FilterConfigMap, "Namespace/name of a ConfigMap holding, under the filters.yaml key, rules excluding nodes and pods from scrapes and served metrics: nodeSelector, a label selector of nodes to keep, excludeNamespaces and excludePods, a list of namespace/name glob patterns. Changes are applied without restart, invalid changes are ignored. Requires permission to watch ConfigMaps in the namespace, granted in kube-system by the manifests. Leave empty to disable filtering.")
+	msfs.StringSliceVar(&o.IncludeNamespaces, "include-namespaces", o.IncludeNamespaces, "Namespaces whose pods are stored and served, e.g. tenant namespaces. Metrics of pods of other namespaces are dropped right after scraping, reducing memory and API payload. Leave empty to keep all namespaces.")
+	msfs.StringSliceVar(&o.ExcludeNamespaces, "exclude-namespaces", o.ExcludeNamespaces, "Namespaces whose pods are neither stored nor served, e.g. kube-system. Metrics of their pods are dropped right after scraping. Applied after include-namespaces.")
+	msfs.StringVar(&o.CanaryPod, "canary-pod", o.CanaryPod, "Namespace/name of a synthetic pod whose metrics are injected in every scrape and checked to be served once stored, so black-box monitoring can verify the scrape, store and serve path with the metrics_server_manager_canary_last_success_timestamp_seconds metric. The pod is never listed by the metrics API nor exported, and is not injected while a real pod has its name. Leave empty to disable the canary.")
+	msfs.StringVar(&o.TransformConfigFile, "transform-config", o.TransformConfigFile, "Path to a YAML file with CEL expressions applied to scraped metrics before they are stored. The drop expression selects node, pod and container points to drop, and expressions under resources return new cpu or memory values, e.g. to clamp or rescale them. Expressions can use variables node, podNamespace, pod, container, cpu (cumulative CPU time in nanoseconds) and memory (working set in bytes).")
+	msfs.StringVar(&o.SupplementalSourcesConfig, "supplemental-sources-config", o.SupplementalSourcesConfig, "Path to a YAML file listing Prometheus endpoints scraped on every node in addition to Kubelet, e.g. node-exporter. Selected series are summed and served as usage of additional resources in NodeMetrics.")
+	msfs.StringVar(&o.DuplicateDetectionNamespace, "duplicate-detection-namespace", o.DuplicateDetectionNamespace, "Namespace of Leases heartbeated by each metrics-server instance to detect other instances scraping the same nodes, reported by the metrics_server_manager_duplicate_instances metric. Requires permission to manage Leases in the namespace, granted in kube-system by the manifests. Leave empty to disable detection.")
+	msfs.StringVar(&o.LeaderElectionNamespace, "leader-election-namespace", o.LeaderElectionNamespace, "Namespace of the Lease elected replicas of a highly available deployment compete for, only the replica holding it scrapes Kubelets. Standby replicas serve no metrics and report not ready until elected, unless they replicate storage of the leader with --replication-port. Requires permission to manage the Lease, granted in kube-system by the manifests. Leave empty to scrape from every replica.")
+	msfs.StringVar(&o.LeaderElectionLeaseName, "leader-election-lease-name", o.LeaderElectionLeaseName, "Name of the leader election Lease.")
+	msfs.IntVar(&o.ReplicationPort, "replication-port", o.ReplicationPort, "Port the elected leader streams its storage on to standby replicas, which serve the replicated metrics and take over without waiting for new scrapes. Requires --leader-election-namespace. Replicas authenticate each other with mutual TLS, see replication-cert-file. Set to 0 to disable replication.")
+	msfs.StringVar(&o.ReplicationAdvertiseAddress, "replication-advertise-address", o.ReplicationAdvertiseAddress, "IP address or DNS name standby replicas reach this replica at for storage replication, e.g. the pod IP from the downward API.")
+	msfs.StringVar(&o.ReplicationCAFile, "replication-ca-file", o.ReplicationCAFile, "Path to the CA bundle verifying certificates of replicas for storage replication. Required with replication-port.")
+	msfs.StringVar(&o.ReplicationCertFile, "replication-cert-file", o.ReplicationCertFile, "Path to the certificate replicas serve and connect with for storage replication, issued by replication-ca-file for the "+replication.ServerName+" DNS name with server and client auth usages, e.g. by cert-manager. Read on every connection, so it can be rotated. Required with replication-port.")
+	msfs.StringVar(&o.ReplicationKeyFile, "replication-key-file", o.ReplicationKeyFile, "Path to the private key of replication-cert-file. Required with replication-port.")
+	msfs.IntVar(&o.ShardCount, "shard-count", o.ShardCount, "Number of replicas of a StatefulSet nodes are split between with consistent hashing, each scraping only its nodes. Every replica serves metrics of all nodes and pods, reading metrics of other shards from them. Requires the NodeSharding feature gate. Set to 0 or 1 to disable sharding.")
+	msfs.IntVar(&o.ShardOrdinal, "shard-ordinal", o.ShardOrdinal, "Shard of this replica, from 0 to shard-count - 1. Negative reads it from the ordinal suffix of the StatefulSet pod hostname.")
+	msfs.StringVar(&o.ShardPeerURL, "shard-peer-url", o.ShardPeerURL, "URL of the secure port of other shards, with $ordinal replaced by their ordinal, e.g. https://metrics-server-$ordinal.metrics-server-shards.kube-system.svc:10250. Requests authenticate with the service account token and require RBAC permission to post to /shard/v1/metrics.")
+	msfs.StringVar(&o.ShardPeerCAFile, "shard-peer-ca-file", o.ShardPeerCAFile, "Path to the CA bundle verifying serving certificates of other shards, e.g. issued by cert-manager for the names of shard-peer-url. Required with shard-count, as the service account token is only sent to verified shards.")
+	msfs.StringVar(&o.CheckpointPath, "storage-checkpoint-path", o.CheckpointPath, "Path of a file, e.g. on an emptyDir volume, stored metrics are periodically written to and restored from on startup, so metrics are served right after a restart instead of after the first two scrapes. Leave empty to disable checkpoints.")
+	msfs.DurationVar(&o.CheckpointInterval, "storage-checkpoint-interval", o.CheckpointInterval, "Interval between storage checkpoints.")
+	msfs.DurationVar(&o.CheckpointMaxAge, "storage-checkpoint-max-age", o.CheckpointMaxAge, "Age of a storage checkpoint above which it is not restored on startup, as its metrics are stale.")
+	msfs.DurationVar(&o.EvictionTTL, "storage-eviction-ttl", o.EvictionTTL, "Age of stored metrics points dropped from storage, e.g. points of deleted pods or nodes still reported by a cache. Points of pods and nodes deleted from the API are dropped from the next scrape cycle. Set to 0 to keep points of any age.")
+	msfs.StringVar(&o.RemoteWriteURL, "remote-write-url", o.RemoteWriteURL, "URL of a Prometheus remote write endpoint CPU and memory usage of nodes and containers is sent to after every scrape cycle, as the metrics_server_node_cpu_usage_cores, metrics_server_node_memory_working_set_bytes, metrics_server_container_cpu_usage_cores and metrics_server_container_memory_working_set_bytes series. Failed requests are not retried. Leave empty to disable the export.")
+	msfs.DurationVar(&o.RemoteWriteTimeout, "remote-write-timeout", o.RemoteWriteTimeout, "Timeout of remote write requests.")
+	msfs.StringVar(&o.RemoteWriteBearerTokenFile, "remote-write-bearer-token-file", o.RemoteWriteBearerTokenFile, "Path of a file holding a bearer token sent with remote write requests, read on every request so it can be rotated.")
+	msfs.StringToStringVar(&o.RemoteWriteExternalLabels, "remote-write-external-labels", o.RemoteWriteExternalLabels, "Labels added to all series sent to the remote write endpoint, e.g. cluster=prod-eu-1.")
+	msfs.StringVar(&o.OTLPEndpoint, "otlp-endpoint", o.OTLPEndpoint, "host:port of an OTLP/gRPC receiver CPU and memory usage of nodes and containers is sent to after every scrape cycle, as the k8s.node.cpu.usage, k8s.node.memory.working_set, k8s.container.cpu.usage and k8s.container.memory.working_set gauges. Failed requests are not retried. Leave empty to disable the export.")
+	msfs.BoolVar(&o.OTLPInsecure, "otlp-insecure", o.OTLPInsecure, "Connect to the OTLP receiver without TLS.")
+	msfs.DurationVar(&o.OTLPTimeout, "otlp-timeout", o.OTLPTimeout, "Timeout of OTLP export requests.")
+	msfs.StringToStringVar(&o.OTLPHeaders, "otlp-headers", o.OTLPHeaders, "Headers sent as gRPC metadata with OTLP export requests, e.g. for authentication.")
+	msfs.StringToStringVar(&o.OTLPResourceAttributes, "otlp-resource-attributes", o.OTLPResourceAttributes, "Attributes added to the resource of metrics sent over OTLP, e.g. k8s.cluster.name=prod-eu-1.")
+	msfs.BoolVar(&o.OTLPSelfMetrics, "otlp-self-metrics", o.OTLPSelfMetrics, "Send metrics-server's own metrics, as served on /metrics, with every OTLP export.")
+	msfs.StringVar(&o.PrometheusURL, "prometheus-url", o.PrometheusURL, "URL of a Prometheus compatible HTTP API, e.g. Prometheus or Thanos Query, usage is queried from when serving the Metrics API instead of scraping Kubelets. Results are cached for metric-resolution. Prometheus needs to scrape the Kubelet /metrics/resource endpoint. Requires the PrometheusMetricsSource feature gate, /resource-metrics isn't served. Leave empty to scrape Kubelets.")
+	msfs.DurationVar(&o.PrometheusTimeout, "prometheus-timeout", o.PrometheusTimeout, "Timeout of Prometheus queries.")
+	msfs.StringVar(&o.PrometheusBearerTokenFile, "prometheus-bearer-token-file", o.PrometheusBearerTokenFile, "Path of a file holding a bearer token sent with Prometheus queries, read on every query so it can be rotated.")
+	msfs.StringVar(&o.PrometheusCAFile, "prometheus-ca-file", o.PrometheusCAFile, "Path of a CA bundle verifying the serving certificate of an https prometheus-url. Leave empty to use the system roots.")
+	msfs.DurationVar(&o.PrometheusWindow, "prometheus-window", o.PrometheusWindow, "Range of CPU rate queries, replacing $window in queries, and window of served metrics.")
+	msfs.StringToStringVar(&o.PrometheusQueries, "prometheus-queries", o.PrometheusQueries, "PromQL queries replacing the defaults by name, one of node-cpu, node-memory, container-cpu and container-memory, e.g. to match relabeled series. Node queries should return samples labeled node, container queries samples labeled namespace, pod and container.")
+	msfs.BoolVar(&o.AnnotateContainerStatuses, "annotate-container-statuses", o.AnnotateContainerStatuses, "Annotate PodMetrics with start time and restart count of containers. Requires watching full Pod objects.")
+	msfs.BoolVar(&o.AnnotateMissingContainers, "annotate-missing-containers", o.AnnotateMissingContainers, "Annotate PodMetrics with containers of the pod spec without metrics. Requires watching full Pod objects.")
+	msfs.BoolVar(&o.AnnotateContainerTypes, "annotate-container-types", o.AnnotateContainerTypes, "Annotate PodMetrics with names of init and ephemeral containers. Requires watching full Pod objects.")
+}
+
 // NewOptions constructs a new set of default options for metrics-server.
 func NewOptions() *Options {
+	authorization := genericoptions.NewDelegatingAuthorizationOptions()
+	// Per-stage checks are probed like /livez and /readyz, without credentials.
+	authorization.AlwaysAllowPaths = append(authorization.AlwaysAllowPaths, "/livez/stages", "/livez/stages/*", "/readyz/stages", "/readyz/stages/*")
 	return &Options{
 		SecureServing:  genericoptions.NewSecureServingOptions().WithLoopback(),
 		Authentication: genericoptions.NewDelegatingAuthenticationOptions(),
-		Authorization:  genericoptions.NewDelegatingAuthorizationOptions(),
+		Authorization:  authorization,
+		StandaloneAuth: NewStandaloneAuthOptions(),
 		Features:       genericoptions.NewFeatureOptions(),
 		Audit:          genericoptions.NewAuditOptions(),
 		KubeletClient:  NewKubeletClientOptions(),
 		Logging:        logs.NewOptions(),
 
-		MetricResolution: 60 * time.Second,
+		MetricResolution:        60 * time.Second,
+		ScrapeMaxBackoffCycles:  8,
+		PodBurstThreshold:       10,
+		MetricRetainedPoints:    storage.DefaultRetainedPoints,
+		ShutdownGracePeriod:     20 * time.Second,
+		CheckpointInterval:      time.Minute,
+		CheckpointMaxAge:        5 * time.Minute,
+		EvictionTTL:             10 * time.Minute,
+		RemoteWriteTimeout:      10 * time.Second,
+		OTLPTimeout:             10 * time.Second,
+		PrometheusTimeout:       10 * time.Second,
+		PrometheusWindow:        5 * time.Minute,
+		LeaderElectionLeaseName: "metrics-server",
+		ShardOrdinal:            -1,
+		FederationClusterName:   "local",
 	}
 }
 
@@ -115,16 +517,137 @@ func (o Options) ServerConfig() (*server.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	kubelet := o.KubeletClient.Config(restConfig)
+	if kubelet.IdleConnTimeout == 0 {
+		// Keep idle connections across scrape cycles.
+		kubelet.IdleConnTimeout = resource.DefaultIdleConnTimeout
+		if 2*o.MetricResolution > kubelet.IdleConnTimeout {
+			kubelet.IdleConnTimeout = 2 * o.MetricResolution
+		}
+	}
 	return &server.Config{
-		Apiserver:        apiserver,
-		Rest:             restConfig,
-		Kubelet:          o.KubeletClient.Config(restConfig),
-		MetricResolution: o.MetricResolution,
-		ScrapeTimeout:    o.KubeletClient.KubeletRequestTimeout,
-		NodeSelector:     o.KubeletClient.NodeSelector,
+		Apiserver:                 apiserver,
+		Rest:                      restConfig,
+		Kubelet:                   kubelet,
+		MetricResolution:          o.MetricResolution,
+		MinNodeScrapeInterval:     o.MinNodeScrapeInterval,
+		MetricHistoryLength:       o.MetricHistoryLength,
+		MetricRetainedPoints:      o.MetricRetainedPoints,
+		CPURateWindow:             o.CPURateWindow,
+		UsageSmoothingHalfLife:    o.UsageSmoothingHalfLife,
+		ResourceNames:             o.ResourceNames,
+		ScrapeBudgetBytes:         o.ScrapeBudgetBytes,
+		ScrapeBudgetDuration:      o.ScrapeBudgetDuration,
+		ScrapeSpreadPerNode:       o.ScrapeSpreadPerNode,
+		ScrapeFailureThreshold:    o.ScrapeFailureThreshold,
+		ScrapeMaxBackoffCycles:    o.ScrapeMaxBackoffCycles,
+		EventScrapeDelay:          o.EventScrapeDelay,
+		PodBurstThreshold:         o.PodBurstThreshold,
+		RemovedNodeGracePeriod:    o.RemovedNodeGracePeriod,
+		PushMaxAge:                o.PushMaxAge,
+		PushOnly:                  o.PushOnly,
+		PushAggregatorURL:         o.PushAggregatorURL,
+		PushAggregatorCAFile:      o.PushAggregatorCAFile,
+		FederationKubeconfig:      o.FederationKubeconfig,
+		FederationClusterName:     o.FederationClusterName,
+		NodeMetricsLabelBuckets:   o.NodeMetricsLabelBuckets,
+		NodeConditionThreshold:    o.NodeConditionThreshold,
+		ScrapeTimeout:             o.KubeletClient.KubeletRequestTimeout,
+		ScrapeTimeoutMargin:       o.KubeletClient.KubeletRequestTimeoutMargin,
+		NodeSelector:              o.KubeletClient.NodeSelector,
+		TopologyLabel:             o.KubeletClient.TopologyLabel,
+		TopologyDomain:            o.KubeletClient.TopologyDomain,
+		SkipNotReadyNodes:         o.KubeletClient.SkipNotReadyNodes,
+		SkipNodeTaints:            o.KubeletClient.SkipNodeTaints,
+		AnnotateContainerTypes:    o.AnnotateContainerTypes,
+		AnnotateContainerStatuses: o.AnnotateContainerStatuses,
+		AnnotateMissingContainers: o.AnnotateMissingContainers,
+
+		FilterConfigMap:             o.FilterConfigMap,
+		IncludeNamespaces:           o.IncludeNamespaces,
+		ExcludeNamespaces:           o.ExcludeNamespaces,
+		CanaryPod:                   o.CanaryPod,
+		TransformConfigFile:         o.TransformConfigFile,
+		SupplementalSourcesConfig:   o.SupplementalSourcesConfig,
+		NodeAddressRefreshInterval:  o.NodeAddressRefreshInterval,
+		DuplicateDetectionNamespace: o.DuplicateDetectionNamespace,
+		LeaderElectionNamespace:     o.LeaderElectionNamespace,
+		LeaderElectionLeaseName:     o.LeaderElectionLeaseName,
+		ReplicationPort:             o.ReplicationPort,
+		ReplicationAdvertiseAddress: o.ReplicationAdvertiseAddress,
+		ReplicationTLS: replication.TLSFiles{
+			CAFile:   o.ReplicationCAFile,
+			CertFile: o.ReplicationCertFile,
+			KeyFile:  o.ReplicationKeyFile,
+		},
+		ShardCount:                  o.ShardCount,
+		ShardOrdinal:                o.ShardOrdinal,
+		ShardPeerURL:                o.ShardPeerURL,
+		ShardPeerCAFile:             o.ShardPeerCAFile,
+		ProfilingCaptureMaxDuration: o.ProfilingCaptureMaxDuration,
+		ShutdownGracePeriod:         o.ShutdownGracePeriod,
+		DebugListenAddress:          o.DebugListenAddress,
+		MetricsListenAddress:        o.MetricsListenAddress,
+		ReadinessNodeCoverage:       o.ReadinessNodeCoverage,
+		ReadinessMaxMetricAge:       o.ReadinessMaxMetricAge,
+		CheckpointPath:              o.CheckpointPath,
+		CheckpointInterval:          o.CheckpointInterval,
+		CheckpointMaxAge:            o.CheckpointMaxAge,
+		EvictionTTL:                 o.EvictionTTL,
+		RemoteWriteURL:              o.RemoteWriteURL,
+		RemoteWriteTimeout:          o.RemoteWriteTimeout,
+		RemoteWriteBearerTokenFile:  o.RemoteWriteBearerTokenFile,
+		RemoteWriteExternalLabels:   o.RemoteWriteExternalLabels,
+		OTLPEndpoint:                o.OTLPEndpoint,
+		OTLPInsecure:                o.OTLPInsecure,
+		OTLPTimeout:                 o.OTLPTimeout,
+		OTLPHeaders:                 o.OTLPHeaders,
+		OTLPResourceAttributes:      o.OTLPResourceAttributes,
+		OTLPSelfMetrics:             o.OTLPSelfMetrics,
+		PrometheusURL:               o.PrometheusURL,
+		PrometheusTimeout:           o.PrometheusTimeout,
+		PrometheusBearerTokenFile:   o.PrometheusBearerTokenFile,
+		PrometheusCAFile:            o.PrometheusCAFile,
+		PrometheusWindow:            o.PrometheusWindow,
+		PrometheusQueries:           o.PrometheusQueries,
+		ConfigFile:                  o.ConfigFile,
+		LoadSettings:                o.LoadSettings,
 	}, nil
 }
 
+// loopbackAddress returns true if address is a host:port with a loopback IP or localhost as host.
+func loopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (o Options) remoteWriteConfig() export.RemoteWriteConfig {
+	return export.RemoteWriteConfig{
+		URL:             o.RemoteWriteURL,
+		Timeout:         o.RemoteWriteTimeout,
+		BearerTokenFile: o.RemoteWriteBearerTokenFile,
+		ExternalLabels:  o.RemoteWriteExternalLabels,
+	}
+}
+
+func (o Options) prometheusConfig() prometheus.Config {
+	return prometheus.Config{
+		URL:             o.PrometheusURL,
+		Timeout:         o.PrometheusTimeout,
+		BearerTokenFile: o.PrometheusBearerTokenFile,
+		CAFile:          o.PrometheusCAFile,
+		Window:          o.PrometheusWindow,
+		Queries:         o.PrometheusQueries,
+	}
+}
+
 func (o Options) ApiserverConfig() (*genericapiserver.Config, error) {
 	if err := o.SecureServing.MaybeDefaultWithSelfSignedCerts("localhost", nil, []net.IP{net.ParseIP("127.0.0.1")}); err != nil {
 		return nil, fmt.Errorf("error creating self-signed certificates: %v", err)
@@ -135,7 +658,11 @@ func (o Options) ApiserverConfig() (*genericapiserver.Config, error) {
 		return nil, err
 	}
 
-	if !o.DisableAuthForTesting {
+	if o.StandaloneAuth.Enabled() {
+		if err := o.StandaloneAuth.ApplyTo(serverConfig, o.Authorization.AlwaysAllowPaths); err != nil {
+			return nil, err
+		}
+	} else if !o.DisableAuthForTesting {
 		if err := o.Authentication.ApplyTo(&serverConfig.Authentication, serverConfig.SecureServing, nil); err != nil {
 			return nil, err
 		}
@@ -147,6 +674,13 @@ func (o Options) ApiserverConfig() (*genericapiserver.Config, error) {
 	if err := o.Audit.ApplyTo(serverConfig); err != nil {
 		return nil, err
 	}
+	if o.TracingConfigFile != "" {
+		tp, err := o.tracerProvider()
+		if err != nil {
+			return nil, err
+		}
+		serverConfig.TracerProvider = tp
+	}
 
 	versionGet := version.Get()
 	serverConfig.Version = &versionGet
@@ -14,13 +14,25 @@
 package options
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/spf13/pflag"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	genericfeatures "k8s.io/apiserver/pkg/features"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/component-base/featuregate"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
 	"k8s.io/component-base/logs"
+
+	"sigs.k8s.io/metrics-server/pkg/features"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 )
 
 func TestOptions_validate(t *testing.T) {
+	defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, features.NodeSharding, true)()
+	defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, features.PrometheusMetricsSource, true)()
 	for _, tc := range []struct {
 		name               string
 		options            *Options
@@ -44,6 +56,453 @@ func TestOptions_validate(t *testing.T) {
 			},
 			expectedErrorCount: 1,
 		},
+		{
+			name: "can not give negative --node-metrics-label-buckets",
+			options: &Options{
+				MetricResolution:        10 * time.Second,
+				NodeMetricsLabelBuckets: -1,
+				KubeletClient:           &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:                 logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --min-node-scrape-interval larger than --metric-resolution",
+			options: &Options{
+				MetricResolution:      10 * time.Second,
+				MinNodeScrapeInterval: 20 * time.Second,
+				KubeletClient:         &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:               logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --min-node-scrape-interval * 9/10 less than --kubelet-request-timeout",
+			options: &Options{
+				MetricResolution:      60 * time.Second,
+				MinNodeScrapeInterval: 10 * time.Second,
+				KubeletClient:         &KubeletClientOptions{KubeletRequestTimeout: 10 * time.Second},
+				Logging:               logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --scrape-max-backoff-cycles less than 1 with --scrape-failure-threshold",
+			options: &Options{
+				MetricResolution:       10 * time.Second,
+				ScrapeFailureThreshold: 2,
+				KubeletClient:          &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:                logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give negative --node-address-refresh-interval",
+			options: &Options{
+				MetricResolution:           10 * time.Second,
+				NodeAddressRefreshInterval: -time.Second,
+				KubeletClient:              &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:                    logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --event-scrape-delay of at least --metric-resolution",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				EventScrapeDelay: 10 * time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --readiness-node-coverage above 100",
+			options: &Options{
+				MetricResolution:      10 * time.Second,
+				ReadinessNodeCoverage: 101,
+				KubeletClient:         &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:               logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give non-loopback --debug-listen-address",
+			options: &Options{
+				MetricResolution:   10 * time.Second,
+				DebugListenAddress: ":6060",
+				KubeletClient:      &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:            logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can give loopback --debug-listen-address",
+			options: &Options{
+				MetricResolution:   10 * time.Second,
+				DebugListenAddress: "127.0.0.1:6060",
+				KubeletClient:      &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:            logs.NewOptions(),
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "can not give --metrics-listen-address without port",
+			options: &Options{
+				MetricResolution:     10 * time.Second,
+				MetricsListenAddress: "127.0.0.1",
+				KubeletClient:        &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:              logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give negative --shutdown-grace-period",
+			options: &Options{
+				MetricResolution:    10 * time.Second,
+				ShutdownGracePeriod: -time.Second,
+				KubeletClient:       &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:             logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give negative --removed-node-grace-period",
+			options: &Options{
+				MetricResolution:       10 * time.Second,
+				RemovedNodeGracePeriod: -time.Second,
+				KubeletClient:          &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:                logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not push to the aggregator when scraping all nodes",
+			options: &Options{
+				MetricResolution:     10 * time.Second,
+				KubeletClient:        &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:              logs.NewOptions(),
+				PushAggregatorURL:    "https://metrics-server.kube-system.svc",
+				PushAggregatorCAFile: "/etc/aggregator/ca.crt",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can push metrics of the zone to the aggregator",
+			options: &Options{
+				MetricResolution:     10 * time.Second,
+				KubeletClient:        &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second, TopologyLabel: "topology.kubernetes.io/zone", TopologyDomain: "us-east-1a"},
+				Logging:              logs.NewOptions(),
+				PushAggregatorURL:    "https://metrics-server.kube-system.svc",
+				PushAggregatorCAFile: "/etc/aggregator/ca.crt",
+			},
+			expectedErrorCount: 0,
+		},
+		{
+			name: "can not serve metrics of the zone without pushing them to the aggregator",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second, TopologyLabel: "topology.kubernetes.io/zone", TopologyDomain: "us-east-1a"},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not read metrics from the container runtime without pushing them to the aggregator",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second, MetricsSource: client.MetricsSourceCRI, NodeName: "node1"},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not push to the aggregator without --push-aggregator-ca-file",
+			options: &Options{
+				MetricResolution:  10 * time.Second,
+				KubeletClient:     &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second, NodeName: "node1", KubeletLocalEndpoint: "https://127.0.0.1:10250"},
+				Logging:           logs.NewOptions(),
+				PushAggregatorURL: "https://metrics-server.kube-system.svc",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not federate with an invalid --federation-cluster-name",
+			options: &Options{
+				MetricResolution:      10 * time.Second,
+				KubeletClient:         &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:               logs.NewOptions(),
+				FederationKubeconfig:  "/etc/metrics-server/members.kubeconfig",
+				FederationClusterName: "eu west",
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not federate when reading usage from Prometheus",
+			options: &Options{
+				MetricResolution:      10 * time.Second,
+				KubeletClient:         &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:               logs.NewOptions(),
+				FederationKubeconfig:  "/etc/metrics-server/members.kubeconfig",
+				FederationClusterName: "local",
+				PrometheusURL:         "http://prometheus.monitoring:9090",
+				PrometheusTimeout:     10 * time.Second,
+				PrometheusWindow:      5 * time.Minute,
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --push-only without --push-max-age",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+				PushOnly:         true,
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give negative --push-max-age",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				PushMaxAge:       -time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give negative --cpu-rate-window",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				CPURateWindow:    -time.Minute,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give negative --usage-smoothing-half-life",
+			options: &Options{
+				MetricResolution:       10 * time.Second,
+				UsageSmoothingHalfLife: -time.Minute,
+				KubeletClient:          &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:                logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --storage-checkpoint-path without positive interval and max age",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				CheckpointPath:   "/var/lib/metrics-server/checkpoint",
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 2,
+		},
+		{
+			name: "can not give --storage-eviction-ttl not above --metric-resolution",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				EvictionTTL:      10 * time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give invalid --remote-write-url",
+			options: &Options{
+				MetricResolution:   10 * time.Second,
+				RemoteWriteURL:     "ftp://prometheus.example.com",
+				RemoteWriteTimeout: 10 * time.Second,
+				KubeletClient:      &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:            logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --otlp-endpoint without port",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				OTLPEndpoint:     "otel-collector.monitoring",
+				OTLPTimeout:      10 * time.Second,
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --prometheus-url with --storage-checkpoint-path",
+			options: &Options{
+				MetricResolution:   10 * time.Second,
+				PrometheusURL:      "http://prometheus.monitoring:9090",
+				PrometheusTimeout:  10 * time.Second,
+				PrometheusWindow:   5 * time.Minute,
+				CheckpointPath:     "/var/lib/metrics-server/checkpoint",
+				CheckpointInterval: time.Minute,
+				CheckpointMaxAge:   5 * time.Minute,
+				KubeletClient:      &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:            logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --prometheus-url with --push-max-age",
+			options: &Options{
+				MetricResolution:  10 * time.Second,
+				PrometheusURL:     "http://prometheus.monitoring:9090",
+				PrometheusTimeout: 10 * time.Second,
+				PrometheusWindow:  5 * time.Minute,
+				PushMaxAge:        time.Minute,
+				KubeletClient:     &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:           logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --prometheus-url with --canary-pod",
+			options: &Options{
+				MetricResolution:  10 * time.Second,
+				PrometheusURL:     "http://prometheus.monitoring:9090",
+				PrometheusTimeout: 10 * time.Second,
+				PrometheusWindow:  5 * time.Minute,
+				CanaryPod:         "kube-system/metrics-server-canary",
+				KubeletClient:     &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:           logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --prometheus-ca-file with an http --prometheus-url",
+			options: &Options{
+				MetricResolution:  10 * time.Second,
+				PrometheusURL:     "http://prometheus.monitoring:9090",
+				PrometheusCAFile:  "/etc/prometheus/ca.crt",
+				PrometheusTimeout: 10 * time.Second,
+				PrometheusWindow:  5 * time.Minute,
+				KubeletClient:     &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:           logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --leader-election-namespace with --kubelet-local-endpoint",
+			options: &Options{
+				MetricResolution:        10 * time.Second,
+				LeaderElectionNamespace: "kube-system",
+				LeaderElectionLeaseName: "metrics-server",
+				KubeletClient:           &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second, KubeletLocalEndpoint: "https://127.0.0.1:10250"},
+				Logging:                 logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --shard-count without --shard-peer-url",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				ShardCount:       2,
+				ShardOrdinal:     -1,
+				ShardPeerCAFile:  "/etc/shard/ca.crt",
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --shard-count without --shard-peer-ca-file",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				ShardCount:       2,
+				ShardOrdinal:     -1,
+				ShardPeerURL:     "https://metrics-server-$ordinal.metrics-server:10250",
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --shard-ordinal outside of --shard-count",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				ShardCount:       2,
+				ShardOrdinal:     2,
+				ShardPeerURL:     "https://metrics-server-$ordinal.metrics-server:10250",
+				ShardPeerCAFile:  "/etc/shard/ca.crt",
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --replication-port without --leader-election-namespace",
+			options: &Options{
+				MetricResolution:            10 * time.Second,
+				ReplicationPort:             10251,
+				ReplicationAdvertiseAddress: "10.0.0.1",
+				ReplicationCAFile:           "/etc/replication/ca.crt",
+				ReplicationCertFile:         "/etc/replication/tls.crt",
+				ReplicationKeyFile:          "/etc/replication/tls.key",
+				KubeletClient:               &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:                     logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --replication-port without certificates",
+			options: &Options{
+				MetricResolution:            10 * time.Second,
+				LeaderElectionNamespace:     "kube-system",
+				LeaderElectionLeaseName:     "metrics-server",
+				ReplicationPort:             10251,
+				ReplicationAdvertiseAddress: "10.0.0.1",
+				KubeletClient:               &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:                     logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --filter-config-map without namespace",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				FilterConfigMap:  "metrics-server-filters",
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give invalid --include-namespaces and --exclude-namespaces",
+			options: &Options{
+				MetricResolution:  10 * time.Second,
+				IncludeNamespaces: []string{"tenant-a"},
+				ExcludeNamespaces: []string{"tenant-a"},
+				KubeletClient:     &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:           logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give --canary-pod without namespace",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				CanaryPod:        "metrics-server-canary",
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:          logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
+		{
+			name: "can not give negative --scrape-spread-per-node",
+			options: &Options{
+				MetricResolution:    10 * time.Second,
+				ScrapeSpreadPerNode: -time.Millisecond,
+				KubeletClient:       &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+				Logging:             logs.NewOptions(),
+			},
+			expectedErrorCount: 1,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			errors := tc.options.validate()
@@ -53,3 +512,145 @@ func TestOptions_validate(t *testing.T) {
 		})
 	}
 }
+
+func TestOptions_validateFeatureGates(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		options *Options
+		feature featuregate.Feature
+	}{
+		{
+			name: "--metric-history-length",
+			options: &Options{
+				MetricResolution:    10 * time.Second,
+				MetricHistoryLength: 3,
+				KubeletClient:       &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+			},
+			feature: features.MetricsHistory,
+		},
+		{
+			name: "--shard-count",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				ShardCount:       2,
+				ShardPeerURL:     "https://metrics-server-$ordinal.metrics-server:10250",
+				ShardPeerCAFile:  "/etc/shard/ca.crt",
+				KubeletClient:    &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+			},
+			feature: features.NodeSharding,
+		},
+		{
+			name: "--prometheus-url",
+			options: &Options{
+				MetricResolution:  10 * time.Second,
+				PrometheusURL:     "http://prometheus.monitoring:9090",
+				PrometheusTimeout: 5 * time.Second,
+				PrometheusWindow:  time.Minute,
+				KubeletClient:     &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+			},
+			feature: features.PrometheusMetricsSource,
+		},
+		{
+			name: "--metrics-source=cri",
+			options: &Options{
+				MetricResolution: 10 * time.Second,
+				KubeletClient: &KubeletClientOptions{
+					KubeletRequestTimeout: 9 * time.Second,
+					KubeletAddressFamily:  "any",
+					MetricsSource:         client.MetricsSourceCRI,
+					CRIEndpoint:           "unix:///run/containerd/containerd.sock",
+					NodeName:              "node1",
+				},
+				PushAggregatorURL:    "https://metrics-server.kube-system.svc",
+				PushAggregatorCAFile: "/etc/aggregator/ca.crt",
+			},
+			feature: features.CRIMetricsSource,
+		},
+		{
+			name: "--node-condition-failure-threshold",
+			options: &Options{
+				MetricResolution:       10 * time.Second,
+				NodeConditionThreshold: 3,
+				KubeletClient:          &KubeletClientOptions{KubeletRequestTimeout: 9 * time.Second},
+			},
+			feature: features.MetricsAvailableCondition,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, enabled := range []bool{false, true} {
+				func() {
+					defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, tc.feature, enabled)()
+					errors := append(tc.options.KubeletClient.Validate(), tc.options.validate()...)
+					if enabled && len(errors) != 0 {
+						t.Errorf("Unexpected errors with %s enabled: %q", tc.feature, errors)
+					}
+					if !enabled && len(errors) != 1 {
+						t.Errorf("Expected an error with %s disabled, got %q", tc.feature, errors)
+					}
+				}()
+			}
+		})
+	}
+}
+
+func TestOptions_watchListFeatureGate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		expect bool
+	}{
+		{
+			name:   "Disabled by default",
+			expect: false,
+		},
+		{
+			name:   "Enabled with --feature-gates",
+			args:   []string{"--feature-gates=WatchList=true"},
+			expect: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Restores the gate set by parsing flags.
+			defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, genericfeatures.WatchList, false)()
+			o := NewOptions()
+			o.SecureServing.BindPort = 0
+			o.SecureServing.ServerCert.CertDirectory = t.TempDir()
+			o.Authentication.RemoteKubeConfigFileOptional = true
+			o.Authorization.RemoteKubeConfigFileOptional = true
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			for _, f := range o.Flags().FlagSets {
+				fs.AddFlagSet(f)
+			}
+			if err := fs.Parse(tc.args); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := o.ApiserverConfig(); err != nil {
+				t.Fatal(err)
+			}
+			if enabled := utilfeature.DefaultFeatureGate.Enabled(genericfeatures.WatchList); enabled != tc.expect {
+				t.Errorf("Expected WatchList enabled %v, got %v", tc.expect, enabled)
+			}
+		})
+	}
+}
+
+func TestOptions_alwaysAllowPaths(t *testing.T) {
+	o := NewOptions()
+	o.SecureServing.BindPort = 0
+	o.SecureServing.ServerCert.CertDirectory = t.TempDir()
+	o.Authentication.RemoteKubeConfigFileOptional = true
+	o.Authorization.RemoteKubeConfigFileOptional = true
+	config, err := o.ApiserverConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/livez", "/livez/stages", "/livez/stages/scrape-loop-alive", "/readyz/stages", "/readyz/stages/storage-fresh"} {
+		decision, _, err := config.Authorization.Authorizer.Authorize(context.Background(), authorizer.AttributesRecord{Verb: "get", Path: path})
+		if err != nil {
+			t.Errorf("Unexpected error authorizing %s: %v", path, err)
+		}
+		if decision != authorizer.DecisionAllow {
+			t.Errorf("Expected %s to be allowed without credentials, got %v", path, decision)
+		}
+	}
+}
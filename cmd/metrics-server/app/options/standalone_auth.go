@@ -0,0 +1,181 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package options
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/group"
+	"k8s.io/apiserver/pkg/authentication/request/bearertoken"
+	"k8s.io/apiserver/pkg/authentication/request/union"
+	"k8s.io/apiserver/pkg/authentication/request/x509"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
+	"k8s.io/apiserver/pkg/authorization/path"
+	unionauthz "k8s.io/apiserver/pkg/authorization/union"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/apiserver/pkg/server/dynamiccertificates"
+	genericoptions "k8s.io/apiserver/pkg/server/options"
+	"k8s.io/apiserver/plugin/pkg/authorizer/webhook"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// StandaloneAuthOptions configures authentication and authorization of
+// metrics-server served without the Kubernetes front proxy, replacing
+// delegation to kube-apiserver.
+type StandaloneAuthOptions struct {
+	TokenFile                   string
+	ClientCAFile                string
+	WebhookConfigFile           string
+	WebhookCacheAuthorizedTTL   time.Duration
+	WebhookCacheUnauthorizedTTL time.Duration
+}
+
+func NewStandaloneAuthOptions() *StandaloneAuthOptions {
+	return &StandaloneAuthOptions{
+		WebhookCacheAuthorizedTTL:   10 * time.Second,
+		WebhookCacheUnauthorizedTTL: 10 * time.Second,
+	}
+}
+
+// Enabled returns true if metrics-server should authenticate requests itself.
+func (o *StandaloneAuthOptions) Enabled() bool {
+	return o.TokenFile != "" || o.ClientCAFile != ""
+}
+
+func (o *StandaloneAuthOptions) Validate() []error {
+	errors := []error{}
+	if o.WebhookConfigFile != "" && !o.Enabled() {
+		errors = append(errors, fmt.Errorf("--standalone-authorization-webhook-config-file requires --standalone-token-file or --standalone-client-ca-file"))
+	}
+	return errors
+}
+
+func (o *StandaloneAuthOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.TokenFile, "standalone-token-file", o.TokenFile, "If set, serve without delegating to kube-apiserver and authenticate bearer tokens listed in this CSV file. Each line has format: token,user,uid,\"group1,group2\".")
+	fs.StringVar(&o.ClientCAFile, "standalone-client-ca-file", o.ClientCAFile, "If set, serve without delegating to kube-apiserver and authenticate client certificates signed by one of the authorities in this file, using the CommonName as user.")
+	fs.StringVar(&o.WebhookConfigFile, "standalone-authorization-webhook-config-file", o.WebhookConfigFile, "File with webhook configuration in kubeconfig format used to authorize standalone requests with SubjectAccessReview. If not set, all authenticated users are authorized.")
+	fs.DurationVar(&o.WebhookCacheAuthorizedTTL, "standalone-authorization-webhook-cache-authorized-ttl", o.WebhookCacheAuthorizedTTL, "The duration to cache 'authorized' responses from the standalone webhook authorizer.")
+	fs.DurationVar(&o.WebhookCacheUnauthorizedTTL, "standalone-authorization-webhook-cache-unauthorized-ttl", o.WebhookCacheUnauthorizedTTL, "The duration to cache 'unauthorized' responses from the standalone webhook authorizer.")
+}
+
+// ApplyTo configures standalone authentication and authorization on the given server config.
+// Requests to alwaysAllowPaths are authorized without authentication.
+func (o *StandaloneAuthOptions) ApplyTo(c *genericapiserver.Config, alwaysAllowPaths []string) error {
+	var authenticators []authenticator.Request
+	if o.TokenFile != "" {
+		tokens, err := newTokenFileAuthenticator(o.TokenFile)
+		if err != nil {
+			return err
+		}
+		authenticators = append(authenticators, bearertoken.New(tokens))
+	}
+	if o.ClientCAFile != "" {
+		clientCA, err := dynamiccertificates.NewDynamicCAContentFromFile("standalone-client-ca", o.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("unable to load client CA file %q: %v", o.ClientCAFile, err)
+		}
+		if err := c.Authentication.ApplyClientCert(clientCA, c.SecureServing); err != nil {
+			return fmt.Errorf("unable to assign client CA file: %v", err)
+		}
+		authenticators = append(authenticators, x509.NewDynamic(clientCA.VerifyOptions, x509.CommonNameUserConversion))
+	}
+	c.Authentication.Authenticator = group.NewAuthenticatedGroupAdder(union.New(authenticators...))
+
+	pathAuthorizer, err := path.NewAuthorizer(alwaysAllowPaths)
+	if err != nil {
+		return err
+	}
+	var requestAuthorizer authorizer.Authorizer = authorizerfactory.NewPrivilegedGroups(user.AllAuthenticated)
+	if o.WebhookConfigFile != "" {
+		webhookConfig, err := clientcmd.BuildConfigFromFlags("", o.WebhookConfigFile)
+		if err != nil {
+			return fmt.Errorf("unable to load webhook config file %q: %v", o.WebhookConfigFile, err)
+		}
+		requestAuthorizer, err = webhook.New(webhookConfig, "v1", o.WebhookCacheAuthorizedTTL, o.WebhookCacheUnauthorizedTTL, *genericoptions.DefaultAuthWebhookRetryBackoff())
+		if err != nil {
+			return fmt.Errorf("unable to create webhook authorizer: %v", err)
+		}
+	}
+	c.Authorization.Authorizer = unionauthz.New(pathAuthorizer, requestAuthorizer)
+	return nil
+}
+
+type staticToken struct {
+	token string
+	user  *user.DefaultInfo
+}
+
+// newTokenFileAuthenticator reads static tokens in the kube-apiserver
+// --token-auth-file format.
+func newTokenFileAuthenticator(path string) (authenticator.Token, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tokens, err := readTokens(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading token file %q: %v", path, err)
+	}
+	return authenticator.TokenFunc(func(ctx context.Context, value string) (*authenticator.Response, bool, error) {
+		for _, t := range tokens {
+			if subtle.ConstantTimeCompare([]byte(t.token), []byte(value)) == 1 {
+				return &authenticator.Response{User: t.user}, true, nil
+			}
+		}
+		return nil, false, nil
+	}), nil
+}
+
+func readTokens(r io.Reader) ([]staticToken, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	var tokens []staticToken
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d has %d columns, expected at least 3", len(tokens)+1, len(record))
+		}
+		if record[0] == "" {
+			return nil, fmt.Errorf("line %d has empty token", len(tokens)+1)
+		}
+		t := staticToken{
+			token: record[0],
+			user:  &user.DefaultInfo{Name: record[1], UID: record[2]},
+		}
+		if len(record) > 3 && record[3] != "" {
+			t.user.Groups = strings.Split(record[3], ",")
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
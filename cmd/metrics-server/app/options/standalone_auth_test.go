@@ -0,0 +1,80 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package options
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func TestReadTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		input      string
+		wantTokens []staticToken
+		wantError  bool
+	}{
+		{
+			name:  "token without groups",
+			input: "secret,alice,1\n",
+			wantTokens: []staticToken{
+				{token: "secret", user: &user.DefaultInfo{Name: "alice", UID: "1"}},
+			},
+		},
+		{
+			name:  "token with groups",
+			input: "secret,alice,1,\"monitoring,ops\"\nother,bob,2\n",
+			wantTokens: []staticToken{
+				{token: "secret", user: &user.DefaultInfo{Name: "alice", UID: "1", Groups: []string{"monitoring", "ops"}}},
+				{token: "other", user: &user.DefaultInfo{Name: "bob", UID: "2"}},
+			},
+		},
+		{
+			name:      "missing uid",
+			input:     "secret,alice\n",
+			wantError: true,
+		},
+		{
+			name:      "empty token",
+			input:     ",alice,1\n",
+			wantError: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, err := readTokens(strings.NewReader(tc.input))
+			if (err != nil) != tc.wantError {
+				t.Fatalf("readTokens() error = %v, wantError %v", err, tc.wantError)
+			}
+			if diff := cmp.Diff(tc.wantTokens, tokens, cmp.AllowUnexported(staticToken{})); diff != "" {
+				t.Errorf("readTokens() diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestStandaloneAuthOptions_Validate(t *testing.T) {
+	o := NewStandaloneAuthOptions()
+	o.WebhookConfigFile = "webhook.kubeconfig"
+	if errors := o.Validate(); len(errors) != 1 {
+		t.Errorf("Validate() = %q, expected 1 error for webhook without standalone authentication", errors)
+	}
+	o.TokenFile = "tokens.csv"
+	if errors := o.Validate(); len(errors) != 0 {
+		t.Errorf("Validate() = %q, expected no errors", errors)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	genericoptions "k8s.io/apiserver/pkg/server/options"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/component-base/tracing"
+	tracingapi "k8s.io/component-base/tracing/api/v1"
+)
+
+// tracingServiceName is the OpenTelemetry service name of exported spans.
+const tracingServiceName = "metrics-server"
+
+// tracerProvider returns a TracerProvider exporting spans to the OTLP gRPC
+// collector configured in TracingConfigFile, sampled at its rate unless the
+// parent span of API requests was sampled.
+func (o Options) tracerProvider() (tracing.TracerProvider, error) {
+	config, err := genericoptions.ReadTracingConfiguration(o.TracingConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if errs := tracingapi.ValidateTracingConfiguration(config, utilfeature.DefaultFeatureGate, nil); len(errs) != 0 {
+		return nil, fmt.Errorf("invalid tracing configuration: %v", errs.ToAggregate())
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get hostname: %v", err)
+	}
+	return tracing.NewProvider(context.Background(), config, nil, []resource.Option{
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(tracingServiceName),
+			semconv.ServiceInstanceIDKey.String(hostname),
+		),
+	})
+}
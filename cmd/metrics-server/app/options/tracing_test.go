@@ -0,0 +1,71 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTracerProvider(t *testing.T) {
+	tcs := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{
+			name: "Valid configuration",
+			config: `
+apiVersion: apiserver.config.k8s.io/v1alpha1
+kind: TracingConfiguration
+endpoint: otel-collector.monitoring:4317
+samplingRatePerMillion: 10000
+`,
+		},
+		{
+			name: "Invalid sampling rate",
+			config: `
+apiVersion: apiserver.config.k8s.io/v1alpha1
+kind: TracingConfiguration
+samplingRatePerMillion: 2000000
+`,
+			wantErr: true,
+		},
+		{
+			name:    "Unknown kind",
+			config:  "apiVersion: apiserver.config.k8s.io/v1alpha1\nkind: TracingConfig\n",
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tracing.yaml")
+			if err := os.WriteFile(path, []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			tp, err := Options{TracingConfigFile: path}.tracerProvider()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tp != nil {
+				if err := tp.Shutdown(context.Background()); err != nil {
+					t.Errorf("Unexpected error shutting down: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -36,6 +36,9 @@ func NewMetricsServerCommand(stopCh <-chan struct{}) *cobra.Command {
 		Short: "Launch metrics-server",
 		Long:  "Launch metrics-server",
 		RunE: func(c *cobra.Command, args []string) error {
+			if err := opts.ApplyConfigFile(c.Flags()); err != nil {
+				return err
+			}
 			if err := runCommand(opts, stopCh); err != nil {
 				return err
 			}
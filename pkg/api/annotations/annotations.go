@@ -0,0 +1,117 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package annotations defines the annotations metrics-server sets on served
+// metrics and the JSON encoded values of some of them.
+package annotations
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Annotations set by metrics-server on served metrics to expose information
+// that has no field in the metrics.k8s.io API.
+const (
+	// InitContainers lists, comma separated, containers of a PodMetrics that are init containers.
+	InitContainers = "metrics.k8s.io/init-containers"
+	// EphemeralContainers lists, comma separated, containers of a PodMetrics that are ephemeral (debug) containers.
+	EphemeralContainers = "metrics.k8s.io/ephemeral-containers"
+	// OverheadCPU is the CPU used by a pod outside of its containers (sandbox, runtime overhead).
+	OverheadCPU = "metrics.k8s.io/overhead-cpu"
+	// OverheadMemory is the memory used by a pod outside of its containers (sandbox, runtime overhead).
+	OverheadMemory = "metrics.k8s.io/overhead-memory"
+	// Volumes is the JSON encoded list of VolumeUsage of persistent volume claims mounted by a pod.
+	Volumes = "metrics.k8s.io/volumes"
+	// ProcessCount is the number of processes running in a pod. Kubelet doesn't report it per container.
+	ProcessCount = "metrics.k8s.io/process-count"
+	// CPUThrottling is the JSON encoded list of ContainerThrottling of containers with CPU limit.
+	CPUThrottling = "metrics.k8s.io/cpu-throttling"
+	// MissingContainers lists, comma separated, containers of the pod spec without metrics in the
+	// served PodMetrics, e.g. not started yet, absent from the latest scrape or without usable metrics.
+	MissingContainers = "metrics.k8s.io/missing-containers"
+	// ContainerStatuses is the JSON encoded list of ContainerStatus of containers of a PodMetrics.
+	ContainerStatuses = "metrics.k8s.io/container-statuses"
+	// NodeDraining is set to "true" on PodMetrics of pods running on a cordoned node. Metrics of
+	// such pods are not served anymore once they are terminating.
+	NodeDraining = "metrics.k8s.io/node-draining"
+	// NodeRemoved is set to "true" on NodeMetrics of nodes deleted from the API and PodMetrics of their
+	// pods, served with the last metrics of the node during a grace period.
+	NodeRemoved = "metrics.k8s.io/node-removed"
+	// Pushed is set to "true" on NodeMetrics of nodes and PodMetrics of their pods whose metrics were
+	// pushed by a node agent instead of scraped from Kubelet.
+	Pushed = "metrics.k8s.io/pushed"
+	// Windows is set to "true" on NodeMetrics of Windows nodes and PodMetrics of their pods, whose
+	// metrics were decoded tolerating the container metrics Windows Kubelets don't report.
+	Windows = "metrics.k8s.io/windows"
+	// Devices is the JSON encoded list of ContainerDevices allocated to containers of a pod, read
+	// from the Kubelet pod resources API.
+	Devices = "metrics.k8s.io/devices"
+	// Filesystems is the JSON encoded list of FilesystemUsage of the nodefs, imagefs and containerfs
+	// filesystems of a NodeMetrics, or of the ephemeral storage of a PodMetrics, read from the Kubelet Summary API.
+	Filesystems = "metrics.k8s.io/filesystems"
+)
+
+// VolumeUsage is the usage of a volume backed by a persistent volume claim.
+type VolumeUsage struct {
+	ClaimName     string `json:"claimName"`
+	CapacityBytes uint64 `json:"capacityBytes"`
+	UsedBytes     uint64 `json:"usedBytes"`
+}
+
+// FilesystemUsage is the usage of a filesystem of a node, or of the ephemeral storage of a pod.
+type FilesystemUsage struct {
+	// Name is nodefs, imagefs or containerfs for nodes, ephemeral-storage for pods.
+	Name           string `json:"name"`
+	CapacityBytes  uint64 `json:"capacityBytes"`
+	AvailableBytes uint64 `json:"availableBytes"`
+	UsedBytes      uint64 `json:"usedBytes"`
+}
+
+// ContainerStatus is the start time and restart count of a container as reported in its pod status.
+type ContainerStatus struct {
+	Name string `json:"name"`
+	// StartTime is when the container last started, unset if it isn't running.
+	StartTime    *metav1.Time `json:"startTime,omitempty"`
+	RestartCount int32        `json:"restartCount"`
+}
+
+// ContainerThrottling is the CFS throttling of a container over the metrics window.
+type ContainerThrottling struct {
+	Name string `json:"name"`
+	// ThrottledPeriodsRatio is the fraction of CFS periods in which the container was throttled.
+	ThrottledPeriodsRatio float64 `json:"throttledPeriodsRatio"`
+	// ThrottledTime is the rate at which the container was throttled, in CPU cores.
+	ThrottledTime resource.Quantity `json:"throttledTime"`
+}
+
+// ContainerDevices are devices of a resource allocated to a container, either by a device plugin or
+// through a dynamic resource claim.
+type ContainerDevices struct {
+	Name string `json:"name"`
+	// Resource is the extended resource name of device plugin devices, e.g. nvidia.com/gpu.
+	Resource string `json:"resource,omitempty"`
+	// Claim is the namespace/name of the resource claim of dynamically allocated devices.
+	Claim string `json:"claim,omitempty"`
+	// IDs are the device IDs, or the CDI device names of claims.
+	IDs []string `json:"ids"`
+}
+
+// Set sets an annotation, allocating the annotations map if needed.
+func Set(annotations *map[string]string, key, value string) {
+	if *annotations == nil {
+		*annotations = map[string]string{}
+	}
+	(*annotations)[key] = value
+}
@@ -0,0 +1,378 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	jsonserializer "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+)
+
+const cborMediaType = "application/cbor"
+
+// cborSerializer encodes objects as CBOR (RFC 8949) with the same structure as
+// their JSON representation, so fields are named after their JSON tags and
+// quantities and timestamps keep their string form. Objects are encoded
+// directly, only values with a custom JSON form, like quantities, are
+// marshalled to JSON. Decoding goes through JSON, as requests of the metrics
+// API have no body.
+type cborSerializer struct {
+	json    runtime.Serializer
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+}
+
+var _ runtime.Serializer = (*cborSerializer)(nil)
+
+func newCBORSerializer(scheme *runtime.Scheme) (*cborSerializer, error) {
+	encMode, err := cbor.CanonicalEncOptions().EncMode()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CBOR encoding options: %w", err)
+	}
+	decMode, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CBOR decoding options: %w", err)
+	}
+	return &cborSerializer{
+		json:    jsonserializer.NewSerializerWithOptions(jsonserializer.DefaultMetaFactory, scheme, scheme, jsonserializer.SerializerOptions{}),
+		encMode: encMode,
+		decMode: decMode,
+	}, nil
+}
+
+// Encode implements runtime.Encoder interface
+func (s *cborSerializer) Encode(obj runtime.Object, w io.Writer) error {
+	value, err := cborValue(reflect.ValueOf(obj))
+	if err != nil {
+		return err
+	}
+	b, err := s.encMode.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Identifier implements runtime.Encoder interface
+func (s *cborSerializer) Identifier() runtime.Identifier {
+	return "cbor"
+}
+
+// Decode implements runtime.Decoder interface
+func (s *cborSerializer) Decode(data []byte, gvk *schema.GroupVersionKind, into runtime.Object) (runtime.Object, *schema.GroupVersionKind, error) {
+	var value interface{}
+	if err := s.decMode.Unmarshal(data, &value); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode CBOR: %w", err)
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.json.Decode(b, gvk, into)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	rawExtensionType  = reflect.TypeOf(runtime.RawExtension{})
+)
+
+// cborValue returns v as a value encoding to CBOR like encoding/json encodes
+// it to JSON: structs become maps keyed by JSON field names, following the
+// omitempty and inline options, and values implementing json.Marshaler are
+// encoded from their JSON form.
+func cborValue(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	// Embedded objects of watch events are already encoded.
+	if v.Type() == rawExtensionType {
+		ext := v.Interface().(runtime.RawExtension)
+		if ext.Raw != nil {
+			return cbor.RawMessage(ext.Raw), nil
+		}
+		return cborValue(reflect.ValueOf(ext.Object))
+	}
+	if m, ok := jsonMarshaler(v); ok {
+		return fromJSON(m)
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return cborValue(v.Elem())
+	case reflect.Struct:
+		res := map[string]interface{}{}
+		if err := addFields(res, v); err != nil {
+			return nil, err
+		}
+		return res, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		res := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := mapKey(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+			item, err := cborValue(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			res[key] = item
+		}
+		return res, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Bytes(), nil
+		}
+		res := make([]interface{}, v.Len())
+		for i := range res {
+			item, err := cborValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			res[i] = item
+		}
+		return res, nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// jsonMarshaler returns v as a json.Marshaler, if it or a pointer to it implements it.
+func jsonMarshaler(v reflect.Value) (json.Marshaler, bool) {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return nil, false
+	}
+	if v.Type().Implements(jsonMarshalerType) {
+		return v.Interface().(json.Marshaler), true
+	}
+	if reflect.PointerTo(v.Type()).Implements(jsonMarshalerType) {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		return p.Interface().(json.Marshaler), true
+	}
+	return nil, false
+}
+
+// fromJSON returns the value m marshals to in JSON, keeping integers as integers.
+func fromJSON(m json.Marshaler) (interface{}, error) {
+	b, err := m.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return nil, err
+	}
+	return fromJSONNumbers(value), nil
+}
+
+// mapKey returns the JSON object key of a map key.
+func mapKey(key reflect.Value) (string, error) {
+	if key.Kind() == reflect.String {
+		return key.String(), nil
+	}
+	if key.Type().Implements(textMarshalerType) {
+		b, err := key.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	switch key.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("unsupported map key type %s", key.Type())
+}
+
+// cborField is a struct field encoded by cborValue.
+type cborField struct {
+	index     int
+	name      string
+	omitEmpty bool
+	// inline is true for embedded structs whose fields are encoded as fields of the embedding struct.
+	inline bool
+}
+
+// cborFields caches fields of struct types.
+var cborFields sync.Map
+
+// fieldsOf returns the encoded fields of struct type t, following their JSON tags.
+func fieldsOf(t reflect.Type) []cborField {
+	if fields, found := cborFields.Load(t); found {
+		return fields.([]cborField)
+	}
+	var fields []cborField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		embedded := f.Type
+		if embedded.Kind() == reflect.Pointer {
+			embedded = embedded.Elem()
+		}
+		if f.Anonymous && name == "" && embedded.Kind() == reflect.Struct {
+			fields = append(fields, cborField{index: i, inline: true})
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, cborField{index: i, name: name, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")})
+	}
+	cborFields.Store(t, fields)
+	return fields
+}
+
+// addFields adds encoded fields of struct v to res.
+func addFields(res map[string]interface{}, v reflect.Value) error {
+	for _, f := range fieldsOf(v.Type()) {
+		fv := v.Field(f.index)
+		if f.inline {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if err := addFields(res, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.omitEmpty && isEmpty(fv) {
+			continue
+		}
+		value, err := cborValue(fv)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.name, err)
+		}
+		res[f.name] = value
+	}
+	return nil
+}
+
+// isEmpty reports whether v is omitted by the omitempty option of encoding/json.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// fromJSONNumbers replaces json.Number with integers when possible, so they
+// are encoded using CBOR integer types instead of floats.
+func fromJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = fromJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fromJSONNumbers(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
+
+// cborNegotiatedSerializer adds CBOR to media types supported by a negotiated serializer.
+type cborNegotiatedSerializer struct {
+	runtime.NegotiatedSerializer
+	cbor runtime.SerializerInfo
+}
+
+// withCBOR returns ns supporting CBOR. Watch events are streamed as CBOR
+// items prefixed with their length, like protobuf ones.
+func withCBOR(ns runtime.NegotiatedSerializer, scheme *runtime.Scheme) (runtime.NegotiatedSerializer, error) {
+	serializer, err := newCBORSerializer(scheme)
+	if err != nil {
+		return nil, err
+	}
+	return cborNegotiatedSerializer{
+		NegotiatedSerializer: ns,
+		cbor: runtime.SerializerInfo{
+			MediaType:        cborMediaType,
+			MediaTypeType:    "application",
+			MediaTypeSubType: "cbor",
+			Serializer:       serializer,
+			StreamSerializer: &runtime.StreamSerializerInfo{
+				Serializer: serializer,
+				Framer:     protobuf.LengthDelimitedFramer,
+			},
+		},
+	}, nil
+}
+
+// SupportedMediaTypes implements runtime.NegotiatedSerializer interface
+func (s cborNegotiatedSerializer) SupportedMediaTypes() []runtime.SerializerInfo {
+	return append(s.NegotiatedSerializer.SupportedMediaTypes(), s.cbor)
+}
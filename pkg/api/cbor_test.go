@@ -0,0 +1,172 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/streaming"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+func TestCBORRoundTrip(t *testing.T) {
+	ns, err := withCBOR(Codecs, Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := runtime.SerializerInfoForMediaType(ns.SupportedMediaTypes(), cborMediaType)
+	if !ok {
+		t.Fatalf("Media type %q is not supported", cborMediaType)
+	}
+	want := &v1beta1.NodeMetricsList{
+		Items: []v1beta1.NodeMetrics{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"zone": "a"}},
+				Timestamp:  metav1.NewTime(time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)),
+				Window:     metav1.Duration{Duration: 15 * time.Second},
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("250m"),
+					corev1.ResourceMemory: resource.MustParse("128Mi"),
+				},
+			},
+		},
+	}
+	b, err := runtime.Encode(ns.EncoderForVersion(info.Serializer, v1beta1.SchemeGroupVersion), want)
+	if err != nil {
+		t.Fatalf("Unexpected encode error: %v", err)
+	}
+	got := &v1beta1.NodeMetricsList{}
+	if _, _, err := info.Serializer.Decode(b, nil, got); err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	if got.Kind != "NodeMetricsList" || got.APIVersion != v1beta1.SchemeGroupVersion.String() {
+		t.Errorf("Unexpected type meta: %+v", got.TypeMeta)
+	}
+	got.TypeMeta = metav1.TypeMeta{}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected object after round trip, diff:\n%s", diff)
+	}
+}
+
+func TestCBOREncode_MatchesJSON(t *testing.T) {
+	s, err := newCBORSerializer(Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podMetrics := &v1beta1.PodMetricsList{
+		TypeMeta: metav1.TypeMeta{Kind: "PodMetricsList", APIVersion: v1beta1.SchemeGroupVersion.String()},
+		ListMeta: metav1.ListMeta{Continue: "next"},
+		Items: []v1beta1.PodMetrics{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1", Annotations: map[string]string{"a": "b"}},
+				Timestamp:  metav1.NewTime(time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC)),
+				Window:     metav1.Duration{Duration: 15500 * time.Millisecond},
+				Containers: []v1beta1.ContainerMetrics{
+					{Name: "app", Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1.5"), corev1.ResourceMemory: resource.MustParse("128Mi")}},
+					{Name: "empty"},
+				},
+			},
+		},
+	}
+	table := &metav1.Table{
+		ColumnDefinitions: []metav1.TableColumnDefinition{{Name: "Name", Type: "string"}, {Name: "CPU", Type: "integer"}},
+		Rows:              []metav1.TableRow{{Cells: []interface{}{"pod1", int64(1500)}}},
+	}
+	status := &metav1.Status{Status: metav1.StatusFailure, Code: 404, Reason: metav1.StatusReasonNotFound, Details: &metav1.StatusDetails{Name: "pod1"}}
+	for _, obj := range []runtime.Object{podMetrics, table, status} {
+		var buf bytes.Buffer
+		if err := s.Encode(obj, &buf); err != nil {
+			t.Fatal(err)
+		}
+		var value interface{}
+		if err := s.decMode.Unmarshal(buf.Bytes(), &value); err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gotValue, wantValue interface{}
+		if err := json.Unmarshal(got, &gotValue); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(want, &wantValue); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(wantValue, gotValue); diff != "" {
+			t.Errorf("CBOR structure of %T differs from JSON, diff:\n%s", obj, diff)
+		}
+	}
+}
+
+func TestCBORStream(t *testing.T) {
+	ns, err := withCBOR(Codecs, Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, ok := runtime.SerializerInfoForMediaType(ns.SupportedMediaTypes(), cborMediaType)
+	if !ok || info.StreamSerializer == nil {
+		t.Fatalf("Media type %q is not supported for streaming", cborMediaType)
+	}
+	var buf bytes.Buffer
+	encoder := streaming.NewEncoder(info.StreamSerializer.Framer.NewFrameWriter(&buf), info.StreamSerializer.Serializer)
+	for _, name := range []string{"node1", "node2"} {
+		var obj bytes.Buffer
+		if err := info.Serializer.Encode(&v1beta1.NodeMetrics{ObjectMeta: metav1.ObjectMeta{Name: name}}, &obj); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Encode(&metav1.WatchEvent{Type: string(watch.Added), Object: runtime.RawExtension{Raw: obj.Bytes()}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader := info.StreamSerializer.Framer.NewFrameReader(io.NopCloser(&buf))
+	frame := make([]byte, 1024)
+	for _, want := range []string{"node1", "node2"} {
+		n, err := reader.Read(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var event struct {
+			Type   string          `cbor:"type"`
+			Object cbor.RawMessage `cbor:"object"`
+		}
+		if err := cbor.Unmarshal(frame[:n], &event); err != nil {
+			t.Fatal(err)
+		}
+		got := &v1beta1.NodeMetrics{}
+		if _, _, err := info.Serializer.Decode(event.Object, nil, got); err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != string(watch.Added) || got.Name != want {
+			t.Errorf("Unexpected %s event of %q, want ADDED of %q", event.Type, got.Name, want)
+		}
+	}
+}
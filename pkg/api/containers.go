@@ -0,0 +1,107 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
+)
+
+// annotateContainerTypes marks init and ephemeral containers of pod metrics
+// based on the pod spec, so consumers can exclude them from usage totals.
+func annotateContainerTypes(pm *metrics.PodMetrics, pod *corev1.Pod) {
+	initContainers := sets.New[string]()
+	for _, c := range pod.Spec.InitContainers {
+		initContainers.Insert(c.Name)
+	}
+	ephemeralContainers := sets.New[string]()
+	for _, c := range pod.Spec.EphemeralContainers {
+		ephemeralContainers.Insert(c.Name)
+	}
+	var inits, ephemerals []string
+	for _, c := range pm.Containers {
+		switch {
+		case initContainers.Has(c.Name):
+			inits = append(inits, c.Name)
+		case ephemeralContainers.Has(c.Name):
+			ephemerals = append(ephemerals, c.Name)
+		}
+	}
+	if len(inits) != 0 {
+		annotations.Set(&pm.ObjectMeta.Annotations, annotations.InitContainers, strings.Join(inits, ","))
+	}
+	if len(ephemerals) != 0 {
+		annotations.Set(&pm.ObjectMeta.Annotations, annotations.EphemeralContainers, strings.Join(ephemerals, ","))
+	}
+}
+
+// annotateMissingContainers lists containers of the pod spec absent from pod
+// metrics, so consumers can tell a partial pod total apart. Init and
+// ephemeral containers are not expected to run and never listed.
+func annotateMissingContainers(pm *metrics.PodMetrics, pod *corev1.Pod) {
+	present := sets.New[string]()
+	for _, c := range pm.Containers {
+		present.Insert(c.Name)
+	}
+	var missing []string
+	for _, c := range pod.Spec.Containers {
+		if !present.Has(c.Name) {
+			missing = append(missing, c.Name)
+		}
+	}
+	if len(missing) != 0 {
+		annotations.Set(&pm.ObjectMeta.Annotations, annotations.MissingContainers, strings.Join(missing, ","))
+	}
+}
+
+// annotateContainerStatuses adds start time and restart count of containers
+// of pod metrics based on the pod status, so consumers can tell usage of
+// recently restarted containers apart.
+func annotateContainerStatuses(pm *metrics.PodMetrics, pod *corev1.Pod) {
+	statuses := map[string]corev1.ContainerStatus{}
+	for _, list := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses, pod.Status.EphemeralContainerStatuses} {
+		for _, s := range list {
+			statuses[s.Name] = s
+		}
+	}
+	var result []annotations.ContainerStatus
+	for _, c := range pm.Containers {
+		s, found := statuses[c.Name]
+		if !found {
+			continue
+		}
+		status := annotations.ContainerStatus{Name: c.Name, RestartCount: s.RestartCount}
+		if s.State.Running != nil {
+			status.StartTime = s.State.Running.StartedAt.DeepCopy()
+		}
+		result = append(result, status)
+	}
+	if len(result) == 0 {
+		return
+	}
+	value, err := json.Marshal(result)
+	if err != nil {
+		klog.ErrorS(err, "Skipping container statuses", "pod", klog.KRef(pm.Namespace, pm.Name))
+		return
+	}
+	annotations.Set(&pm.ObjectMeta.Annotations, annotations.ContainerStatuses, string(value))
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
+)
+
+func TestAnnotateContainerTypes(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init"}, {Name: "sidecar"}},
+			Containers:     []corev1.Container{{Name: "app"}},
+			EphemeralContainers: []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger"}},
+			},
+		},
+	}
+	tcs := []struct {
+		name            string
+		containers      []string
+		wantAnnotations map[string]string
+	}{
+		{
+			name:       "Only regular containers",
+			containers: []string{"app"},
+		},
+		{
+			name:       "Running init container",
+			containers: []string{"sidecar", "app"},
+			wantAnnotations: map[string]string{
+				annotations.InitContainers: "sidecar",
+			},
+		},
+		{
+			name:       "All container types",
+			containers: []string{"init", "sidecar", "app", "debugger"},
+			wantAnnotations: map[string]string{
+				annotations.InitContainers:      "init,sidecar",
+				annotations.EphemeralContainers: "debugger",
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			pm := &metrics.PodMetrics{}
+			for _, c := range tc.containers {
+				pm.Containers = append(pm.Containers, metrics.ContainerMetrics{Name: c})
+			}
+			annotateContainerTypes(pm, pod)
+			if diff := cmp.Diff(tc.wantAnnotations, pm.Annotations); diff != "" {
+				t.Errorf("Unexpected annotations, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestAnnotateContainerStatuses(t *testing.T) {
+	started := metav1.NewTime(time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC))
+	pod := &corev1.Pod{
+		Status: corev1.PodStatus{
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{Name: "sidecar", RestartCount: 1, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: started}}},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "app", RestartCount: 3, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: started}}},
+				{Name: "crashing", RestartCount: 7, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}},
+			},
+		},
+	}
+	tcs := []struct {
+		name            string
+		containers      []string
+		wantAnnotations map[string]string
+	}{
+		{
+			name:       "Container without status",
+			containers: []string{"unknown"},
+		},
+		{
+			name:       "Running containers",
+			containers: []string{"sidecar", "app"},
+			wantAnnotations: map[string]string{
+				annotations.ContainerStatuses: `[{"name":"sidecar","startTime":"2023-01-01T10:00:00Z","restartCount":1},{"name":"app","startTime":"2023-01-01T10:00:00Z","restartCount":3}]`,
+			},
+		},
+		{
+			name:       "Container not running",
+			containers: []string{"crashing"},
+			wantAnnotations: map[string]string{
+				annotations.ContainerStatuses: `[{"name":"crashing","restartCount":7}]`,
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			pm := &metrics.PodMetrics{}
+			for _, c := range tc.containers {
+				pm.Containers = append(pm.Containers, metrics.ContainerMetrics{Name: c})
+			}
+			annotateContainerStatuses(pm, pod)
+			if diff := cmp.Diff(tc.wantAnnotations, pm.Annotations); diff != "" {
+				t.Errorf("Unexpected annotations, diff: %s", diff)
+			}
+		})
+	}
+}
+
+func TestAnnotateMissingContainers(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "init"}},
+			Containers:     []corev1.Container{{Name: "app"}, {Name: "proxy"}, {Name: "logger"}},
+		},
+	}
+	tcs := []struct {
+		name            string
+		containers      []string
+		wantAnnotations map[string]string
+	}{
+		{
+			name:       "All containers",
+			containers: []string{"app", "proxy", "logger"},
+		},
+		{
+			name:       "Missing containers in spec order",
+			containers: []string{"proxy"},
+			wantAnnotations: map[string]string{
+				annotations.MissingContainers: "app,logger",
+			},
+		},
+		{
+			name:       "Init container not expected",
+			containers: []string{"init", "app", "proxy"},
+			wantAnnotations: map[string]string{
+				annotations.MissingContainers: "logger",
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			pm := &metrics.PodMetrics{}
+			for _, c := range tc.containers {
+				pm.Containers = append(pm.Containers, metrics.ContainerMetrics{Name: c})
+			}
+			annotateMissingContainers(pm, pod)
+			if diff := cmp.Diff(tc.wantAnnotations, pm.Annotations); diff != "" {
+				t.Errorf("Unexpected annotations, diff: %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
+	"k8s.io/apimachinery/pkg/runtime"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/klog/v2"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// nodeMetricsHistory serves the history subresource of NodeMetrics as a list
+// of metrics of recent scrapes, oldest first.
+type nodeMetricsHistory struct {
+	node    *nodeMetrics
+	history HistoryGetter
+}
+
+var _ rest.Storage = &nodeMetricsHistory{}
+var _ rest.Getter = &nodeMetricsHistory{}
+var _ rest.TableConvertor = &nodeMetricsHistory{}
+
+func newNodeMetricsHistory(node *nodeMetrics, history HistoryGetter) *nodeMetricsHistory {
+	return &nodeMetricsHistory{node: node, history: history}
+}
+
+// New implements rest.Storage interface
+func (m *nodeMetricsHistory) New() runtime.Object {
+	return &metrics.NodeMetricsList{}
+}
+
+// Destroy implements rest.Storage interface
+func (m *nodeMetricsHistory) Destroy() {
+}
+
+// Get implements rest.Getter interface
+func (m *nodeMetricsHistory) Get(ctx context.Context, name string, opts *metav1.GetOptions) (runtime.Object, error) {
+	node, err := m.node.node(name)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := m.history.GetNodeMetricsHistory(node)
+	if err != nil {
+		klog.ErrorS(err, "Failed reading node metrics history", "node", klog.KRef("", name))
+		return nil, fmt.Errorf("failed reading node metrics history: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, errors.NewNotFound(m.node.groupResource, name)
+	}
+	filterNodeMetricsUsage(ctx, ms)
+	return &metrics.NodeMetricsList{Items: ms}, nil
+}
+
+// ConvertToTable implements rest.TableConvertor interface
+func (m *nodeMetricsHistory) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1beta1.Table, error) {
+	return m.node.ConvertToTable(ctx, object, tableOptions)
+}
+
+// podMetricsHistory serves the history subresource of PodMetrics as a list
+// of metrics of recent scrapes, oldest first.
+type podMetricsHistory struct {
+	pod     *podMetrics
+	history HistoryGetter
+}
+
+var _ rest.Storage = &podMetricsHistory{}
+var _ rest.Getter = &podMetricsHistory{}
+var _ rest.TableConvertor = &podMetricsHistory{}
+
+func newPodMetricsHistory(pod *podMetrics, history HistoryGetter) *podMetricsHistory {
+	return &podMetricsHistory{pod: pod, history: history}
+}
+
+// New implements rest.Storage interface
+func (m *podMetricsHistory) New() runtime.Object {
+	return &metrics.PodMetricsList{}
+}
+
+// Destroy implements rest.Storage interface
+func (m *podMetricsHistory) Destroy() {
+}
+
+// Get implements rest.Getter interface
+func (m *podMetricsHistory) Get(ctx context.Context, name string, opts *metav1.GetOptions) (runtime.Object, error) {
+	namespace := genericapirequest.NamespaceValue(ctx)
+	if err := m.pod.checkSynced(); err != nil {
+		return nil, err
+	}
+
+	obj, err := m.pod.podLister.ByNamespace(namespace).Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// return not-found errors directly
+			return nil, err
+		}
+		klog.ErrorS(err, "Failed getting pod", "pod", klog.KRef(namespace, name))
+		return nil, fmt.Errorf("failed getting pod: %w", err)
+	}
+	pod, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok || pod == nil {
+		return nil, errors.NewNotFound(corev1.Resource("pods"), fmt.Sprintf("%s/%s", namespace, name))
+	}
+
+	ms, err := m.history.GetPodMetricsHistory(pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed reading pod metrics history", "pod", klog.KRef(namespace, name))
+		return nil, fmt.Errorf("failed reading pod metrics history: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, errors.NewNotFound(m.pod.groupResource, fmt.Sprintf("%s/%s", namespace, name))
+	}
+	m.pod.annotate(ms)
+	filterPodMetricsUsage(ctx, ms)
+	return &metrics.PodMetricsList{Items: ms}, nil
+}
+
+// ConvertToTable implements rest.TableConvertor interface
+func (m *podMetricsHistory) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1beta1.Table, error) {
+	return m.pod.ConvertToTable(ctx, object, tableOptions)
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+func TestNodeHistoryGet(t *testing.T) {
+	tcs := []struct {
+		name           string
+		get            string
+		listerError    error
+		wantTimestamps []time.Time
+		wantError      bool
+	}{
+		{
+			name:           "Normal",
+			get:            "node1",
+			wantTimestamps: []time.Time{time.Unix(10, 0), time.Unix(20, 0)},
+		},
+		{
+			name:      "Node without metrics",
+			get:       "node4",
+			wantError: true,
+		},
+		{
+			name:        "Lister error",
+			get:         "node1",
+			listerError: fmt.Errorf("lister error"),
+			wantError:   true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newNodeMetricsHistory(NewTestNodeStorage(tc.listerError), fakeHistoryGetter{})
+
+			got, err := r.Get(genericapirequest.NewContext(), tc.get, nil)
+
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantError {
+				return
+			}
+			items := got.(*metrics.NodeMetricsList).Items
+			if len(items) != len(tc.wantTimestamps) {
+				t.Fatalf("Unexpected number of samples, got %d, want %d", len(items), len(tc.wantTimestamps))
+			}
+			for i, item := range items {
+				testNode(t, item, tc.get)
+				if !item.Timestamp.Time.Equal(tc.wantTimestamps[i]) {
+					t.Errorf("Unexpected timestamp of sample %d, got %v, want %v", i, item.Timestamp, tc.wantTimestamps[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPodHistoryGet(t *testing.T) {
+	tcs := []struct {
+		name        string
+		namespace   string
+		get         string
+		wantSamples int
+		wantError   bool
+	}{
+		{
+			name:        "Normal",
+			namespace:   "other",
+			get:         "pod1",
+			wantSamples: 2,
+		},
+		{
+			name:      "Pod without metrics",
+			namespace: "other",
+			get:       "pod2",
+			wantError: true,
+		},
+		{
+			name:      "Pod doesn't exist",
+			namespace: "other",
+			get:       "pod5",
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newPodMetricsHistory(NewPodTestStorage(nil), fakeHistoryGetter{})
+
+			got, err := r.Get(genericapirequest.WithNamespace(genericapirequest.NewContext(), tc.namespace), tc.get, nil)
+
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantError {
+				return
+			}
+			items := got.(*metrics.PodMetricsList).Items
+			if len(items) != tc.wantSamples {
+				t.Fatalf("Unexpected number of samples, got %d, want %d", len(items), tc.wantSamples)
+			}
+		})
+	}
+}
+
+type fakeHistoryGetter struct{}
+
+var _ HistoryGetter = (*fakeHistoryGetter)(nil)
+
+func (fakeHistoryGetter) GetNodeMetricsHistory(node *corev1.Node) ([]metrics.NodeMetrics, error) {
+	if node.Name != "node1" {
+		return nil, nil
+	}
+	var ms []metrics.NodeMetrics
+	for _, ts := range []int64{10, 20} {
+		ms = append(ms, metrics.NodeMetrics{
+			ObjectMeta: metav1.ObjectMeta{Name: node.Name, Labels: node.Labels},
+			Timestamp:  metav1.NewTime(time.Unix(ts, 0)),
+		})
+	}
+	return ms, nil
+}
+
+func (fakeHistoryGetter) GetPodMetricsHistory(pod *metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+	if pod.Name != "pod1" {
+		return nil, nil
+	}
+	var ms []metrics.PodMetrics
+	for _, ts := range []int64{10, 20} {
+		ms = append(ms, metrics.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+			Timestamp:  metav1.NewTime(time.Unix(ts, 0)),
+		})
+	}
+	return ms, nil
+}
@@ -42,21 +42,49 @@ func init() {
 }
 
 // Build constructs APIGroupInfo the metrics.k8s.io API group using the given getters.
-func Build(pod, node rest.Storage) genericapiserver.APIGroupInfo {
+func Build(pod, node rest.Storage) (genericapiserver.APIGroupInfo, error) {
 	apiGroupInfo := genericapiserver.NewDefaultAPIGroupInfo(metrics.GroupName, Scheme, metav1.ParameterCodec, Codecs)
+	ns, err := withCBOR(Codecs, Scheme)
+	if err != nil {
+		return genericapiserver.APIGroupInfo{}, err
+	}
+	apiGroupInfo.NegotiatedSerializer = ns
 	metricsServerResources := map[string]rest.Storage{
 		"nodes": node,
 		"pods":  pod,
 	}
 	apiGroupInfo.VersionedResourcesStorageMap[v1beta1.SchemeGroupVersion.Version] = metricsServerResources
 
-	return apiGroupInfo
+	return apiGroupInfo, nil
+}
+
+// PodAnnotations selects annotations of served PodMetrics computed from full Pod objects.
+type PodAnnotations struct {
+	// ContainerTypes marks init and ephemeral containers.
+	ContainerTypes bool
+	// ContainerStatuses adds start time and restart count of containers.
+	ContainerStatuses bool
+	// MissingContainers lists containers of the pod spec without metrics.
+	MissingContainers bool
 }
 
 // Install builds the metrics for the metrics.k8s.io API, and then installs it into the given API metrics-server.
-func Install(m MetricsGetter, podMetadataLister cache.GenericLister, nodeLister corev1.NodeLister, server *genericapiserver.GenericAPIServer, nodeSelector []labels.Requirement) error {
-	node := newNodeMetrics(metrics.Resource("nodemetrics"), m, nodeLister, nodeSelector)
-	pod := newPodMetrics(metrics.Resource("podmetrics"), m, podMetadataLister)
-	info := Build(pod, node)
-	return server.InstallAPIGroup(&info)
+// podLister is optional, when set served PodMetrics are annotated as selected by podAnnotations.
+// podsSynced is optional, when set PodMetrics are unavailable until it returns true, while NodeMetrics are served regardless.
+// The returned Served reads metrics as the installed API lists them.
+func Install(m MetricsGetter, podMetadataLister cache.GenericLister, nodeLister corev1.NodeLister, podLister corev1.PodLister, podAnnotations PodAnnotations, podsSynced func() bool, server *genericapiserver.GenericAPIServer, nodeSelector []labels.Requirement) (*Served, error) {
+	served := NewServed(m, podMetadataLister, nodeLister, podLister, podAnnotations, podsSynced, nodeSelector)
+	info, err := Build(served.pod, served.node)
+	if err != nil {
+		return nil, err
+	}
+	if h, ok := m.(HistoryGetter); ok {
+		resources := info.VersionedResourcesStorageMap[v1beta1.SchemeGroupVersion.Version]
+		resources["nodes/history"] = newNodeMetricsHistory(served.node, h)
+		resources["pods/history"] = newPodMetricsHistory(served.pod, h)
+	}
+	if err := server.InstallAPIGroup(&info); err != nil {
+		return nil, err
+	}
+	return served, nil
 }
@@ -15,8 +15,6 @@
 package api
 
 import (
-	"time"
-
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/metrics/pkg/apis/metrics"
@@ -28,24 +26,6 @@ type MetricsGetter interface {
 	NodeMetricsGetter
 }
 
-// TimeInfo represents the timing information for a metric, which was
-// potentially calculated over some window of time (e.g. for CPU usage rate).
-type TimeInfo struct {
-	// NB: we consider the earliest timestamp amongst multiple containers
-	// for the purposes of determining if a metric is tained by a time
-	// period, like pod startup (used by things like the HPA).
-
-	// Timestamp is the time at which the metrics were initially collected.
-	// In the case of a rate metric, it should be the timestamp of the last
-	// data point used in the calculation.  If it represents multiple metric
-	// points, it should be the earliest such timestamp from all of the points.
-	Timestamp time.Time
-
-	// Window represents the window used to calculate rate metrics associated
-	// with this timestamp.
-	Window time.Duration
-}
-
 // PodMetricsGetter knows how to fetch metrics for the containers in a pod.
 type PodMetricsGetter interface {
 	// GetPodMetrics gets the latest metrics for all containers in each listed pod,
@@ -53,9 +33,32 @@ type PodMetricsGetter interface {
 	GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error)
 }
 
+// PodResourceMetricsGetter is optionally implemented by a PodMetricsGetter
+// able to compute usage of some resources only, used when the resource query
+// parameter is set so usage that isn't returned isn't computed either.
+type PodResourceMetricsGetter interface {
+	// GetPodResourceMetrics gets metrics like GetPodMetrics, with usage of resources only.
+	GetPodResourceMetrics(resources []corev1.ResourceName, pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error)
+}
+
+// HistoryGetter knows how to fetch metrics of recent scrapes of a single pod or node.
+type HistoryGetter interface {
+	// GetPodMetricsHistory gets metrics of the pod for each kept scrape, oldest first.
+	GetPodMetricsHistory(pod *metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error)
+	// GetNodeMetricsHistory gets metrics of the node for each kept scrape, oldest first.
+	GetNodeMetricsHistory(node *corev1.Node) ([]metrics.NodeMetrics, error)
+}
+
 // NodeMetricsGetter knows how to fetch metrics for a node.
 type NodeMetricsGetter interface {
 	// GetNodeMetrics gets the latest metrics for the given nodes,
 	// returning both the metrics and the associated collection timestamp.
 	GetNodeMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error)
 }
+
+// NodeResourceMetricsGetter is optionally implemented by a NodeMetricsGetter
+// able to compute usage of some resources only, like PodResourceMetricsGetter.
+type NodeResourceMetricsGetter interface {
+	// GetNodeResourceMetrics gets metrics like GetNodeMetrics, with usage of resources only.
+	GetNodeResourceMetrics(resources []corev1.ResourceName, nodes ...*corev1.Node) ([]metrics.NodeMetrics, error)
+}
@@ -15,9 +15,17 @@
 package api
 
 import (
+	"context"
+	"time"
+
 	"k8s.io/component-base/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
+// traceLogThreshold is the duration of List and Get requests above which their trace is logged.
+const traceLogThreshold = 500 * time.Millisecond
+
 var (
 	metricFreshness = metrics.NewHistogramVec(
 		&metrics.HistogramOpts{
@@ -29,10 +37,34 @@ var (
 		},
 		[]string{},
 	)
+	// initialized below to an actual value by a call to RegisterAPIMetrics
+	// (acts as a no-op by default), as buckets depend on the metric resolution.
+	servedLatency = metrics.NewHistogramVec(&metrics.HistogramOpts{}, []string{"resource"})
 )
 
-// RegisterAPIMetrics registers a histogram metric for the freshness of
-// exported metrics.
-func RegisterAPIMetrics(registrationFunc func(metrics.Registerable) error) error {
-	return registrationFunc(metricFreshness)
+// RegisterAPIMetrics registers histogram metrics for the freshness of
+// exported metrics and the end-to-end latency of served metrics.
+func RegisterAPIMetrics(registrationFunc func(metrics.Registerable) error, resolution time.Duration) error {
+	servedLatency = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace: "metrics_server",
+			Subsystem: "api",
+			Name:      "end_to_end_latency_seconds",
+			Help:      "Time from the Kubelet sample timestamp to serving the metrics through the Metrics API, observed for every item returned by get, list and watch requests, per resource.",
+			Buckets:   utils.BucketsForLatency(resolution),
+		},
+		[]string{"resource"},
+	)
+	for _, m := range []metrics.Registerable{metricFreshness, servedLatency} {
+		if err := registrationFunc(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeServed records the end-to-end latency of a metric sampled at
+// timestamp and returned to a client, resource is "nodes" or "pods".
+func observeServed(ctx context.Context, resource string, timestamp time.Time) {
+	utils.ObserveWithTrace(ctx, servedLatency.WithLabelValues(resource), myClock.Since(timestamp).Seconds())
 }
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"sort"
 
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
@@ -27,11 +28,16 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/apiserver/pkg/registry/rest"
 	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/tracing"
 	"k8s.io/klog/v2"
 	"k8s.io/metrics/pkg/apis/metrics"
 	_ "k8s.io/metrics/pkg/apis/metrics/install"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 type nodeMetrics struct {
@@ -45,6 +51,7 @@ var _ rest.KindProvider = &nodeMetrics{}
 var _ rest.Storage = &nodeMetrics{}
 var _ rest.Getter = &nodeMetrics{}
 var _ rest.Lister = &nodeMetrics{}
+var _ rest.Watcher = &nodeMetrics{}
 var _ rest.Scoper = &nodeMetrics{}
 var _ rest.TableConvertor = &nodeMetrics{}
 var _ rest.SingularNameProvider = &nodeMetrics{}
@@ -79,17 +86,63 @@ func (m *nodeMetrics) NewList() runtime.Object {
 
 // List implements rest.Lister interface
 func (m *nodeMetrics) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	ctx, span := tracing.Start(ctx, "List node metrics")
+	defer span.End(traceLogThreshold)
 	nodes, err := m.nodes(ctx, options)
 	if err != nil {
 		return &metrics.NodeMetricsList{}, err
 	}
+	span.AddEvent("Listed nodes", attribute.Int("count", len(nodes)))
 
-	ms, err := m.getMetrics(nodes...)
+	ms, err := m.getMetrics(ctx, nodes...)
 	if err != nil {
 		klog.ErrorS(err, "Failed reading nodes metrics")
 		return &metrics.NodeMetricsList{}, fmt.Errorf("failed reading nodes metrics: %w", err)
 	}
-	return &metrics.NodeMetricsList{Items: ms}, nil
+	span.AddEvent("Read metrics", attribute.Int("count", len(ms)))
+	if err := sortNodeMetrics(ctx, ms); err != nil {
+		return &metrics.NodeMetricsList{}, err
+	}
+	start, end, next, err := page(len(ms), options)
+	if err != nil {
+		return &metrics.NodeMetricsList{}, err
+	}
+	ms = ms[start:end]
+	filterNodeMetricsUsage(ctx, ms)
+	for i := range ms {
+		observeServed(ctx, "nodes", ms[i].Timestamp.Time)
+	}
+	return &metrics.NodeMetricsList{ListMeta: metav1.ListMeta{Continue: next}, Items: ms}, nil
+}
+
+// Watch implements rest.Watcher interface, only watch lists are supported.
+func (m *nodeMetrics) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	if err := validateWatchList(m.groupResource, options); err != nil {
+		return nil, err
+	}
+	nodes, err := m.nodes(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	// Metrics are read in chunks as they are sent, like pages of a list.
+	return newWatchList(ctx, options, func(send func(runtime.Object) bool) error {
+		return chunks(len(nodes), func(start, end int) error {
+			ms, err := m.getMetrics(ctx, nodes[start:end]...)
+			if err != nil {
+				klog.ErrorS(err, "Failed reading nodes metrics")
+				return fmt.Errorf("failed reading nodes metrics: %w", err)
+			}
+			filterNodeMetricsUsage(ctx, ms)
+			for i := range ms {
+				observeServed(ctx, "nodes", ms[i].Timestamp.Time)
+				if !send(&ms[i]) {
+					return errWatchStopped
+				}
+			}
+			return nil
+		})
+	}, &metrics.NodeMetrics{})
 }
 
 func (m *nodeMetrics) nodes(ctx context.Context, options *metainternalversion.ListOptions) ([]*corev1.Node, error) {
@@ -113,6 +166,29 @@ func (m *nodeMetrics) nodes(ctx context.Context, options *metainternalversion.Li
 
 // Get implements rest.Getter interface
 func (m *nodeMetrics) Get(ctx context.Context, name string, opts *metav1.GetOptions) (runtime.Object, error) {
+	ctx, span := tracing.Start(ctx, "Get node metrics", attribute.String("node", name))
+	defer span.End(traceLogThreshold)
+	node, err := m.node(name)
+	if err != nil {
+		return nil, err
+	}
+	if !m.selected(node) {
+		return nil, m.notSelectedError(name)
+	}
+	ms, err := m.getMetrics(ctx, node)
+	if err != nil {
+		klog.ErrorS(err, "Failed reading node metrics", "node", klog.KRef("", name))
+		return nil, fmt.Errorf("failed reading node metrics: %w", err)
+	}
+	if len(ms) == 0 {
+		return nil, errors.NewNotFound(m.groupResource, name)
+	}
+	filterNodeMetricsUsage(ctx, ms)
+	observeServed(ctx, "nodes", ms[0].Timestamp.Time)
+	return &ms[0], nil
+}
+
+func (m *nodeMetrics) node(name string) (*corev1.Node, error) {
 	node, err := m.nodeLister.Get(name)
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -125,45 +201,55 @@ func (m *nodeMetrics) Get(ctx context.Context, name string, opts *metav1.GetOpti
 	if node == nil {
 		return nil, errors.NewNotFound(m.groupResource, name)
 	}
-	ms, err := m.getMetrics(node)
-	if err != nil {
-		klog.ErrorS(err, "Failed reading node metrics", "node", klog.KRef("", name))
-		return nil, fmt.Errorf("failed reading node metrics: %w", err)
-	}
-	if len(ms) == 0 {
-		return nil, errors.NewNotFound(m.groupResource, name)
+	return node, nil
+}
+
+// selected returns true if node matches the node selector of scraped nodes.
+func (m *nodeMetrics) selected(node *corev1.Node) bool {
+	if m.nodeSelector == nil {
+		return true
 	}
-	return &ms[0], nil
+	return labels.NewSelector().Add(m.nodeSelector...).Matches(labels.Set(node.Labels))
+}
+
+// notSelectedError returns a NotFound error explaining that node is not scraped.
+func (m *nodeMetrics) notSelectedError(name string) error {
+	err := errors.NewNotFound(m.groupResource, name)
+	err.ErrStatus.Message = fmt.Sprintf("%s: node is not scraped as it doesn't match node selector %q", err.ErrStatus.Message, labels.NewSelector().Add(m.nodeSelector...).String())
+	return err
 }
 
 // ConvertToTable implements rest.TableConvertor interface
 func (m *nodeMetrics) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1beta1.Table, error) {
 	var table metav1beta1.Table
+	includeHeaders := tableIncludesHeaders(tableOptions)
 
 	switch t := object.(type) {
 	case *metrics.NodeMetrics:
 		table.ResourceVersion = t.ResourceVersion
 		table.SelfLink = t.SelfLink //nolint:staticcheck // keep deprecated field to be backward compatible
-		addNodeMetricsToTable(&table, *t)
+		addNodeMetricsToTable(&table, includeHeaders, *t)
 	case *metrics.NodeMetricsList:
 		table.ResourceVersion = t.ResourceVersion
 		table.SelfLink = t.SelfLink //nolint:staticcheck // keep deprecated field to be backward compatible
 		table.Continue = t.Continue
-		addNodeMetricsToTable(&table, t.Items...)
+		addNodeMetricsToTable(&table, includeHeaders, t.Items...)
 	default:
+		return nil, fmt.Errorf("unsupported object %T, expected NodeMetrics or NodeMetricsList", object)
 	}
 
 	return &table, nil
 }
 
-func (m *nodeMetrics) getMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
-	ms, err := m.metrics.GetNodeMetrics(nodes...)
+func (m *nodeMetrics) getMetrics(ctx context.Context, nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
+	ms, err := getNodeMetrics(m.metrics, computedResources(ctx), nodes...)
 	if err != nil {
 		return nil, err
 	}
 	for _, m := range ms {
-		metricFreshness.WithLabelValues().Observe(myClock.Since(m.Timestamp.Time).Seconds())
+		utils.ObserveWithTrace(ctx, metricFreshness.WithLabelValues(), myClock.Since(m.Timestamp.Time).Seconds())
 	}
+	markRemoved(ms, nodes)
 	// maintain the same ordering invariant as the Kube API would over nodes
 	sort.Slice(ms, func(i, j int) bool {
 		return ms[i].Name < ms[j].Name
@@ -180,3 +266,21 @@ func (m *nodeMetrics) NamespaceScoped() bool {
 func (m *nodeMetrics) GetSingularName() string {
 	return "node"
 }
+
+// markRemoved annotates metrics of nodes deleted from the API, served during a grace period.
+func markRemoved(ms []metrics.NodeMetrics, nodes []*corev1.Node) {
+	removed := map[string]bool{}
+	for _, node := range nodes {
+		if node.Annotations[annotations.NodeRemoved] == "true" {
+			removed[node.Name] = true
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	for i := range ms {
+		if removed[ms[i].Name] {
+			annotations.Set(&ms[i].Annotations, annotations.NodeRemoved, "true")
+		}
+	}
+}
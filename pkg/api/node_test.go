@@ -25,14 +25,18 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	basemetrics "k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
 )
 
 func TestNodeList(t *testing.T) {
@@ -171,6 +175,19 @@ func TestNodeGet(t *testing.T) {
 	}
 }
 
+func TestNodeGet_NotSelected(t *testing.T) {
+	r := NewTestNodeStorage(nil)
+
+	// node4 is labeled skipKey=skipValue
+	_, err := r.Get(genericapirequest.NewContext(), "node4", nil)
+	if !errors.IsNotFound(err) {
+		t.Fatalf("Expected NotFound error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `doesn't match node selector "skipKey!=skipValue"`) {
+		t.Errorf("Expected error to mention the node selector, got %q", err.Error())
+	}
+}
+
 func TestNodeList_Monitoring(t *testing.T) {
 	c := &fakeClock{}
 	myClock = c
@@ -345,3 +362,52 @@ func nodeLabels(name string) map[string]string {
 	}
 	return labels
 }
+
+func TestMarkRemoved(t *testing.T) {
+	removed := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{annotations.NodeRemoved: "true"}}}
+	listed := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}}
+	ms := []metrics.NodeMetrics{{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, {ObjectMeta: metav1.ObjectMeta{Name: "node2"}}}
+
+	markRemoved(ms, []*corev1.Node{removed, listed})
+
+	if got := ms[0].Annotations[annotations.NodeRemoved]; got != "true" {
+		t.Errorf("Expected removed node to be annotated, got %q", got)
+	}
+	if len(ms[1].Annotations) != 0 {
+		t.Errorf("Expected listed node not to be annotated, got %v", ms[1].Annotations)
+	}
+}
+
+func TestNodeList_EndToEndLatency(t *testing.T) {
+	c := &fakeClock{}
+	myClock = c
+	registry := basemetrics.NewKubeRegistry()
+	if err := RegisterAPIMetrics(registry.Register, 10*time.Second); err != nil {
+		t.Fatalf("Failed registering metrics: %v", err)
+	}
+
+	r := NewTestNodeStorage(nil)
+	c.now = c.now.Add(10 * time.Second)
+	if _, err := r.List(genericapirequest.NewContext(), &metainternalversion.ListOptions{Limit: 2}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := r.Get(genericapirequest.NewContext(), "node1", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Only items returned to the client are observed.
+	count, err := testutil.GetHistogramMetricCount(servedLatency.WithLabelValues("nodes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("Got %d observations, expected 3", count)
+	}
+	sum, err := testutil.GetHistogramMetricValue(servedLatency.WithLabelValues("nodes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum < 30 {
+		t.Errorf("Got latency sum %v, expected at least 30s", sum)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"sort"
 
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
@@ -27,33 +28,52 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
+	v1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/tracing"
 	"k8s.io/klog/v2"
 	"k8s.io/metrics/pkg/apis/metrics"
 	_ "k8s.io/metrics/pkg/apis/metrics/install"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 type podMetrics struct {
 	groupResource schema.GroupResource
 	metrics       PodMetricsGetter
 	podLister     cache.GenericLister
+	// podSpecLister is optional and used to annotate containers as selected by podAnnotations.
+	podSpecLister  v1listers.PodLister
+	podAnnotations PodAnnotations
+	// podsSynced is optional and reports whether podLister and podSpecLister are synced.
+	podsSynced func() bool
 }
 
+// PodAggregateContainerName is the container name of the single entry served
+// for pods on nodes where collection is limited to pod level metrics. It can't
+// collide with a real container name, as those must be DNS labels.
+const PodAggregateContainerName = "_pod"
+
 var _ rest.KindProvider = &podMetrics{}
 var _ rest.Storage = &podMetrics{}
 var _ rest.Getter = &podMetrics{}
 var _ rest.Lister = &podMetrics{}
+var _ rest.Watcher = &podMetrics{}
 var _ rest.TableConvertor = &podMetrics{}
 var _ rest.Scoper = &podMetrics{}
 var _ rest.SingularNameProvider = &podMetrics{}
 
-func newPodMetrics(groupResource schema.GroupResource, metrics PodMetricsGetter, podLister cache.GenericLister) *podMetrics {
+func newPodMetrics(groupResource schema.GroupResource, metrics PodMetricsGetter, podLister cache.GenericLister, podSpecLister v1listers.PodLister) *podMetrics {
 	return &podMetrics{
 		groupResource: groupResource,
 		metrics:       metrics,
 		podLister:     podLister,
+		podSpecLister: podSpecLister,
 	}
 }
 
@@ -78,17 +98,70 @@ func (m *podMetrics) NewList() runtime.Object {
 
 // List implements rest.Lister interface
 func (m *podMetrics) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	ctx, span := tracing.Start(ctx, "List pod metrics", attribute.String("namespace", genericapirequest.NamespaceValue(ctx)))
+	defer span.End(traceLogThreshold)
 	pods, err := m.pods(ctx, options)
 	if err != nil {
 		return &metrics.PodMetricsList{}, err
 	}
-	ms, err := m.getMetrics(pods...)
+	span.AddEvent("Listed pods", attribute.Int("count", len(pods)))
+	ms, err := m.getMetrics(ctx, pods...)
 	if err != nil {
 		namespace := genericapirequest.NamespaceValue(ctx)
 		klog.ErrorS(err, "Failed reading pods metrics", "namespace", klog.KRef("", namespace))
 		return &metrics.PodMetricsList{}, fmt.Errorf("failed reading pods metrics: %w", err)
 	}
-	return &metrics.PodMetricsList{Items: ms}, nil
+	span.AddEvent("Read metrics", attribute.Int("count", len(ms)))
+	if err := sortPodMetrics(ctx, ms); err != nil {
+		return &metrics.PodMetricsList{}, err
+	}
+	start, end, next, err := page(len(ms), options)
+	if err != nil {
+		return &metrics.PodMetricsList{}, err
+	}
+	ms = ms[start:end]
+	filterPodMetricsUsage(ctx, ms)
+	for i := range ms {
+		observeServed(ctx, "pods", ms[i].Timestamp.Time)
+	}
+	return &metrics.PodMetricsList{ListMeta: metav1.ListMeta{Continue: next}, Items: ms}, nil
+}
+
+// Watch implements rest.Watcher interface, only watch lists are supported.
+func (m *podMetrics) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	if err := validateWatchList(m.groupResource, options); err != nil {
+		return nil, err
+	}
+	pods, err := m.pods(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		a, b := pods[i].(*metav1.PartialObjectMetadata), pods[j].(*metav1.PartialObjectMetadata)
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	// Metrics are read in chunks as they are sent, like pages of a list.
+	return newWatchList(ctx, options, func(send func(runtime.Object) bool) error {
+		return chunks(len(pods), func(start, end int) error {
+			ms, err := m.getMetrics(ctx, pods[start:end]...)
+			if err != nil {
+				namespace := genericapirequest.NamespaceValue(ctx)
+				klog.ErrorS(err, "Failed reading pods metrics", "namespace", klog.KRef("", namespace))
+				return fmt.Errorf("failed reading pods metrics: %w", err)
+			}
+			filterPodMetricsUsage(ctx, ms)
+			for i := range ms {
+				observeServed(ctx, "pods", ms[i].Timestamp.Time)
+				if !send(&ms[i]) {
+					return errWatchStopped
+				}
+			}
+			return nil
+		})
+	}, &metrics.PodMetrics{})
 }
 
 func (m *podMetrics) pods(ctx context.Context, options *metainternalversion.ListOptions) ([]runtime.Object, error) {
@@ -98,6 +171,9 @@ func (m *podMetrics) pods(ctx context.Context, options *metainternalversion.List
 	}
 
 	namespace := genericapirequest.NamespaceValue(ctx)
+	if err := m.checkSynced(); err != nil {
+		return nil, err
+	}
 	pods, err := m.podLister.ByNamespace(namespace).List(labelSelector)
 	if err != nil {
 		klog.ErrorS(err, "Failed listing pods", "labelSelector", labelSelector, "namespace", klog.KRef("", namespace))
@@ -112,6 +188,11 @@ func (m *podMetrics) pods(ctx context.Context, options *metainternalversion.List
 // Get implements rest.Getter interface
 func (m *podMetrics) Get(ctx context.Context, name string, opts *metav1.GetOptions) (runtime.Object, error) {
 	namespace := genericapirequest.NamespaceValue(ctx)
+	ctx, span := tracing.Start(ctx, "Get pod metrics", attribute.String("namespace", namespace), attribute.String("pod", name))
+	defer span.End(traceLogThreshold)
+	if err := m.checkSynced(); err != nil {
+		return &metrics.PodMetrics{}, err
+	}
 
 	pod, err := m.podLister.ByNamespace(namespace).Get(name)
 	if err != nil {
@@ -126,7 +207,7 @@ func (m *podMetrics) Get(ctx context.Context, name string, opts *metav1.GetOptio
 		return &metrics.PodMetrics{}, errors.NewNotFound(corev1.Resource("pods"), fmt.Sprintf("%s/%s", namespace, name))
 	}
 
-	ms, err := m.getMetrics(pod)
+	ms, err := m.getMetrics(ctx, pod)
 	if err != nil {
 		klog.ErrorS(err, "Failed reading pod metrics", "pod", klog.KRef(namespace, name))
 		return nil, fmt.Errorf("failed pod metrics: %w", err)
@@ -134,41 +215,47 @@ func (m *podMetrics) Get(ctx context.Context, name string, opts *metav1.GetOptio
 	if len(ms) == 0 {
 		return nil, errors.NewNotFound(m.groupResource, fmt.Sprintf("%s/%s", namespace, name))
 	}
+	filterPodMetricsUsage(ctx, ms)
+	observeServed(ctx, "pods", ms[0].Timestamp.Time)
 	return &ms[0], nil
 }
 
 // ConvertToTable implements rest.TableConvertor interface
 func (m *podMetrics) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1beta1.Table, error) {
 	var table metav1beta1.Table
+	includeHeaders := tableIncludesHeaders(tableOptions)
 
 	switch t := object.(type) {
 	case *metrics.PodMetrics:
 		table.ResourceVersion = t.ResourceVersion
 		table.SelfLink = t.SelfLink //nolint:staticcheck // keep deprecated field to be backward compatible
-		addPodMetricsToTable(&table, *t)
+		addPodMetricsToTable(&table, includeHeaders, *t)
 	case *metrics.PodMetricsList:
 		table.ResourceVersion = t.ResourceVersion
 		table.SelfLink = t.SelfLink //nolint:staticcheck // keep deprecated field to be backward compatible
 		table.Continue = t.Continue
-		addPodMetricsToTable(&table, t.Items...)
+		addPodMetricsToTable(&table, includeHeaders, t.Items...)
 	default:
+		return nil, fmt.Errorf("unsupported object %T, expected PodMetrics or PodMetricsList", object)
 	}
 
 	return &table, nil
 }
 
-func (m *podMetrics) getMetrics(pods ...runtime.Object) ([]metrics.PodMetrics, error) {
+func (m *podMetrics) getMetrics(ctx context.Context, pods ...runtime.Object) ([]metrics.PodMetrics, error) {
 	objs := make([]*metav1.PartialObjectMetadata, len(pods))
 	for i, pod := range pods {
 		objs[i] = pod.(*metav1.PartialObjectMetadata)
 	}
-	ms, err := m.metrics.GetPodMetrics(objs...)
+	ms, err := getPodMetrics(m.metrics, computedResources(ctx), objs...)
 	if err != nil {
 		return nil, err
 	}
+	ms = dropEvicted(ms, objs)
 	for _, m := range ms {
-		metricFreshness.WithLabelValues().Observe(myClock.Since(m.Timestamp.Time).Seconds())
+		utils.ObserveWithTrace(ctx, metricFreshness.WithLabelValues(), myClock.Since(m.Timestamp.Time).Seconds())
 	}
+	m.annotate(ms)
 	sort.Slice(ms, func(i, j int) bool {
 		if ms[i].Namespace != ms[j].Namespace {
 			return ms[i].Namespace < ms[j].Namespace
@@ -178,6 +265,51 @@ func (m *podMetrics) getMetrics(pods ...runtime.Object) ([]metrics.PodMetrics, e
 	return ms, nil
 }
 
+// dropEvicted removes metrics of terminating pods on draining nodes, so
+// autoscalers don't average in pods that are about to be evicted until their
+// metrics go stale.
+func dropEvicted(ms []metrics.PodMetrics, pods []*metav1.PartialObjectMetadata) []metrics.PodMetrics {
+	terminating := map[apitypes.NamespacedName]struct{}{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			terminating[apitypes.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}] = struct{}{}
+		}
+	}
+	if len(terminating) == 0 {
+		return ms
+	}
+	res := ms[:0]
+	for _, m := range ms {
+		if _, found := terminating[apitypes.NamespacedName{Namespace: m.Namespace, Name: m.Name}]; found && m.Annotations[annotations.NodeDraining] == "true" {
+			continue
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+// annotate adds annotations computed from full Pod objects, if enabled.
+func (m *podMetrics) annotate(ms []metrics.PodMetrics) {
+	if m.podSpecLister == nil {
+		return
+	}
+	for i := range ms {
+		pod, err := m.podSpecLister.Pods(ms[i].Namespace).Get(ms[i].Name)
+		if err != nil {
+			continue
+		}
+		if m.podAnnotations.ContainerTypes {
+			annotateContainerTypes(&ms[i], pod)
+		}
+		if m.podAnnotations.ContainerStatuses {
+			annotateContainerStatuses(&ms[i], pod)
+		}
+		if m.podAnnotations.MissingContainers {
+			annotateMissingContainers(&ms[i], pod)
+		}
+	}
+}
+
 // NamespaceScoped implements rest.Scoper interface
 func (m *podMetrics) NamespaceScoped() bool {
 	return true
@@ -187,3 +319,12 @@ func (m *podMetrics) NamespaceScoped() bool {
 func (m *podMetrics) GetSingularName() string {
 	return "pod"
 }
+
+// checkSynced returns a ServiceUnavailable error until pods are listed, so
+// clients don't mistake an unsynced cache for a namespace without pods.
+func (m *podMetrics) checkSynced() error {
+	if m.podsSynced != nil && !m.podsSynced() {
+		return errors.NewServiceUnavailable("pod metrics are unavailable until pods are listed")
+	}
+	return nil
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -36,6 +37,8 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
 )
 
 func TestPodList(t *testing.T) {
@@ -172,6 +175,61 @@ func TestPodGet(t *testing.T) {
 	}
 }
 
+func TestPod_NotSynced(t *testing.T) {
+	r := NewPodTestStorage(nil)
+	r.podsSynced = func() bool { return false }
+	ctx := genericapirequest.WithNamespace(genericapirequest.NewContext(), "other")
+
+	if _, err := r.List(ctx, nil); !errors.IsServiceUnavailable(err) {
+		t.Errorf("Expected ServiceUnavailable listing pods, got %v", err)
+	}
+	if _, err := r.Get(ctx, "pod1", nil); !errors.IsServiceUnavailable(err) {
+		t.Errorf("Expected ServiceUnavailable getting pod, got %v", err)
+	}
+
+	r.podsSynced = func() bool { return true }
+	if _, err := r.Get(ctx, "pod1", nil); err != nil {
+		t.Errorf("Unexpected error getting pod once synced: %v", err)
+	}
+}
+
+func TestDropEvicted(t *testing.T) {
+	deleted := metav1.Now()
+	draining := map[string]string{annotations.NodeDraining: "true"}
+	tcs := []struct {
+		name      string
+		pod       metav1.ObjectMeta
+		annotated map[string]string
+		wantKept  bool
+	}{
+		{
+			name:      "Running pod on draining node",
+			pod:       metav1.ObjectMeta{Name: "pod1", Namespace: "other"},
+			annotated: draining,
+			wantKept:  true,
+		},
+		{
+			name:      "Terminating pod on draining node",
+			pod:       metav1.ObjectMeta{Name: "pod1", Namespace: "other", DeletionTimestamp: &deleted},
+			annotated: draining,
+		},
+		{
+			name:     "Terminating pod on schedulable node",
+			pod:      metav1.ObjectMeta{Name: "pod1", Namespace: "other", DeletionTimestamp: &deleted},
+			wantKept: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ms := []metrics.PodMetrics{{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "other", Annotations: tc.annotated}}}
+			got := dropEvicted(ms, []*metav1.PartialObjectMetadata{{ObjectMeta: tc.pod}})
+			if kept := len(got) == 1; kept != tc.wantKept {
+				t.Errorf("Got kept %v, expected %v", kept, tc.wantKept)
+			}
+		})
+	}
+}
+
 func TestPodList_Monitoring(t *testing.T) {
 	c := &fakeClock{}
 	myClock = c
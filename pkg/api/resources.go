@@ -0,0 +1,128 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// resourceQueryParameter restricts usage returned by the API to comma separated resource names, e.g. ?resource=memory.
+const resourceQueryParameter = "resource"
+
+type resourceFilterKey struct{}
+
+// WithResourceFilter stores resources requested with the resource query
+// parameter in the request context, so they can be read by the metrics
+// storage which has no access to the query string.
+func WithResourceFilter(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		value := req.URL.Query().Get(resourceQueryParameter)
+		if value == "" {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		var names []corev1.ResourceName
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, corev1.ResourceName(name))
+			}
+		}
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), resourceFilterKey{}, names)))
+	})
+}
+
+func resourceFilterFrom(ctx context.Context) []corev1.ResourceName {
+	names, _ := ctx.Value(resourceFilterKey{}).([]corev1.ResourceName)
+	return names
+}
+
+// computedResources returns resources whose usage is computed for the request
+// in ctx: the requested ones and the one lists are sorted by. Usage of the
+// latter is dropped once sorted. Usage of all resources is computed if empty.
+func computedResources(ctx context.Context) []corev1.ResourceName {
+	names := resourceFilterFrom(ctx)
+	if len(names) == 0 {
+		return nil
+	}
+	by := corev1.ResourceName(sortByFrom(ctx))
+	if by == sortByName {
+		return names
+	}
+	for _, name := range names {
+		if name == by {
+			return names
+		}
+	}
+	return append(names[:len(names):len(names)], by)
+}
+
+// getNodeMetrics gets metrics of nodes from getter, with usage of resources
+// only if getter supports it. Usage of all resources is computed otherwise.
+func getNodeMetrics(getter NodeMetricsGetter, resources []corev1.ResourceName, nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
+	if g, ok := getter.(NodeResourceMetricsGetter); ok && len(resources) != 0 {
+		return g.GetNodeResourceMetrics(resources, nodes...)
+	}
+	return getter.GetNodeMetrics(nodes...)
+}
+
+// getPodMetrics gets metrics of pods from getter like getNodeMetrics.
+func getPodMetrics(getter PodMetricsGetter, resources []corev1.ResourceName, pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+	if g, ok := getter.(PodResourceMetricsGetter); ok && len(resources) != 0 {
+		return g.GetPodResourceMetrics(resources, pods...)
+	}
+	return getter.GetPodMetrics(pods...)
+}
+
+// filterUsage drops from usage resources not in names. Usage is returned as is if names is empty.
+func filterUsage(usage corev1.ResourceList, names []corev1.ResourceName) corev1.ResourceList {
+	if len(names) == 0 {
+		return usage
+	}
+	filtered := make(corev1.ResourceList, len(names))
+	for _, name := range names {
+		if quantity, found := usage[name]; found {
+			filtered[name] = quantity
+		}
+	}
+	return filtered
+}
+
+func filterNodeMetricsUsage(ctx context.Context, ms []metrics.NodeMetrics) {
+	names := resourceFilterFrom(ctx)
+	if len(names) == 0 {
+		return
+	}
+	for i := range ms {
+		ms[i].Usage = filterUsage(ms[i].Usage, names)
+	}
+}
+
+func filterPodMetricsUsage(ctx context.Context, ms []metrics.PodMetrics) {
+	names := resourceFilterFrom(ctx)
+	if len(names) == 0 {
+		return
+	}
+	for i := range ms {
+		for j := range ms[i].Containers {
+			ms[i].Containers[j].Usage = filterUsage(ms[i].Containers[j].Usage, names)
+		}
+	}
+}
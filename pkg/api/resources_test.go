@@ -0,0 +1,161 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+func TestWithResourceFilter(t *testing.T) {
+	tcs := []struct {
+		name      string
+		url       string
+		wantNames []corev1.ResourceName
+	}{
+		{
+			name: "No parameter",
+			url:  "/apis/metrics.k8s.io/v1beta1/nodes",
+		},
+		{
+			name:      "Single resource",
+			url:       "/apis/metrics.k8s.io/v1beta1/nodes?resource=memory",
+			wantNames: []corev1.ResourceName{corev1.ResourceMemory},
+		},
+		{
+			name:      "Multiple resources",
+			url:       "/apis/metrics.k8s.io/v1beta1/nodes?resource=cpu,%20memory",
+			wantNames: []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []corev1.ResourceName
+			handler := WithResourceFilter(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				got = resourceFilterFrom(req.Context())
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tc.url, nil))
+			if diff := cmp.Diff(tc.wantNames, got); diff != "" {
+				t.Errorf("Unexpected resource names, diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNodeGet_ResourceFilter(t *testing.T) {
+	r := NewTestNodeStorage(nil)
+	ctx := genericapirequest.WithValue(genericapirequest.NewContext(), resourceFilterKey{}, []corev1.ResourceName{corev1.ResourceMemory})
+
+	got, err := r.Get(ctx, "node1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if usage := got.(*metrics.NodeMetrics).Usage; len(usage) != 0 {
+		t.Errorf("Expected usage without res1, got: %v", usage)
+	}
+}
+
+func TestComputedResources(t *testing.T) {
+	tcs := []struct {
+		name      string
+		resources []corev1.ResourceName
+		sortBy    string
+		want      []corev1.ResourceName
+	}{
+		{
+			name:   "No filter",
+			sortBy: "cpu",
+		},
+		{
+			name:      "Sorted by name",
+			resources: []corev1.ResourceName{corev1.ResourceMemory},
+			want:      []corev1.ResourceName{corev1.ResourceMemory},
+		},
+		{
+			name:      "Sorted by requested resource",
+			resources: []corev1.ResourceName{corev1.ResourceMemory},
+			sortBy:    "memory",
+			want:      []corev1.ResourceName{corev1.ResourceMemory},
+		},
+		{
+			name:      "Sorted by other resource",
+			resources: []corev1.ResourceName{corev1.ResourceMemory},
+			sortBy:    "cpu",
+			want:      []corev1.ResourceName{corev1.ResourceMemory, corev1.ResourceCPU},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := genericapirequest.NewContext()
+			if tc.resources != nil {
+				ctx = genericapirequest.WithValue(ctx, resourceFilterKey{}, tc.resources)
+			}
+			if tc.sortBy != "" {
+				ctx = genericapirequest.WithValue(ctx, sortByKey{}, tc.sortBy)
+			}
+			if diff := cmp.Diff(tc.want, computedResources(ctx)); diff != "" {
+				t.Errorf("Unexpected resources, diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+// resourceNodeMetricsGetter records resources requested with GetNodeResourceMetrics.
+type resourceNodeMetricsGetter struct {
+	fakeNodeMetricsGetter
+	resources []corev1.ResourceName
+}
+
+func (g *resourceNodeMetricsGetter) GetNodeResourceMetrics(resources []corev1.ResourceName, nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
+	g.resources = resources
+	return g.GetNodeMetrics(nodes...)
+}
+
+func TestNodeGet_ResourceMetricsGetter(t *testing.T) {
+	r := NewTestNodeStorage(nil)
+	getter := &resourceNodeMetricsGetter{fakeNodeMetricsGetter: fakeNodeMetricsGetter{now: myClock.Now()}}
+	r.metrics = getter
+	ctx := genericapirequest.WithValue(genericapirequest.NewContext(), resourceFilterKey{}, []corev1.ResourceName{"res1"})
+
+	got, err := r.Get(ctx, "node1", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]corev1.ResourceName{"res1"}, getter.resources); diff != "" {
+		t.Errorf("Unexpected resources requested from getter, diff:\n%s", diff)
+	}
+	if usage := got.(*metrics.NodeMetrics).Usage; len(usage) != 1 {
+		t.Errorf("Expected usage of res1, got: %v", usage)
+	}
+}
+
+func TestFilterUsage(t *testing.T) {
+	usage := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("10m"),
+		corev1.ResourceMemory: resource.MustParse("5Mi"),
+	}
+	got := filterUsage(usage, []corev1.ResourceName{corev1.ResourceMemory, "unknown"})
+	want := corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("5Mi")}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected usage, diff:\n%s", diff)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	corev1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// Served reads metrics as the metrics API lists them, from the same
+// listers, node selector and getter, for consumers serving them outside of
+// the API, e.g. federation.
+type Served struct {
+	node *nodeMetrics
+	pod  *podMetrics
+}
+
+// NewServed returns metrics as listed by the API Install builds from the same arguments.
+func NewServed(m MetricsGetter, podMetadataLister cache.GenericLister, nodeLister corev1.NodeLister, podLister corev1.PodLister, podAnnotations PodAnnotations, podsSynced func() bool, nodeSelector []labels.Requirement) *Served {
+	node := newNodeMetrics(metrics.Resource("nodemetrics"), m, nodeLister, nodeSelector)
+	pod := newPodMetrics(metrics.Resource("podmetrics"), m, podMetadataLister, podLister)
+	pod.podAnnotations = podAnnotations
+	pod.podsSynced = podsSynced
+	return &Served{node: node, pod: pod}
+}
+
+// Nodes returns the metrics of all served nodes.
+func (s *Served) Nodes(ctx context.Context) ([]metrics.NodeMetrics, error) {
+	list, err := s.node.List(ctx, &metainternalversion.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.(*metrics.NodeMetricsList).Items, nil
+}
+
+// Pods returns the metrics of served pods of all namespaces.
+func (s *Served) Pods(ctx context.Context) ([]metrics.PodMetrics, error) {
+	list, err := s.pod.List(genericapirequest.WithNamespace(ctx, metav1.NamespaceAll), &metainternalversion.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return list.(*metrics.PodMetricsList).Items, nil
+}
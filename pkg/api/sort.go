@@ -0,0 +1,165 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// sortQueryParameter orders listed metrics by name or by usage of a resource, e.g. ?sortBy=cpu.
+// Usage is sorted from highest, like kubectl top --sort-by. kubectl top sorts
+// on the client and never sends it, it serves clients paging through large
+// lists, e.g. kubectl get --raw or client-go.
+const sortQueryParameter = "sortBy"
+
+// sortByName is the default order of listed metrics.
+const sortByName = "name"
+
+type sortByKey struct{}
+
+// WithSortBy stores the order requested with the sortBy query parameter in
+// the request context, so lists can be sorted before applying limit.
+func WithSortBy(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		value := req.URL.Query().Get(sortQueryParameter)
+		if value == "" {
+			handler.ServeHTTP(w, req)
+			return
+		}
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), sortByKey{}, value)))
+	})
+}
+
+func sortByFrom(ctx context.Context) string {
+	by, _ := ctx.Value(sortByKey{}).(string)
+	if by == "" {
+		return sortByName
+	}
+	return by
+}
+
+// sortNodeMetrics orders node metrics as requested in ctx. Metrics are expected to be sorted by name.
+func sortNodeMetrics(ctx context.Context, ms []metrics.NodeMetrics) error {
+	by := sortByFrom(ctx)
+	if by == sortByName {
+		return nil
+	}
+	usages := make([]corev1.ResourceList, len(ms))
+	for i := range ms {
+		usages[i] = ms[i].Usage
+	}
+	if err := validateSortBy(by, usages); err != nil {
+		return err
+	}
+	sort.SliceStable(ms, func(i, j int) bool {
+		qi, qj := ms[i].Usage[corev1.ResourceName(by)], ms[j].Usage[corev1.ResourceName(by)]
+		return qi.Cmp(qj) > 0
+	})
+	return nil
+}
+
+// sortPodMetrics orders pod metrics as requested in ctx, by usage summed over containers.
+// Metrics are expected to be sorted by namespace and name.
+func sortPodMetrics(ctx context.Context, ms []metrics.PodMetrics) error {
+	by := sortByFrom(ctx)
+	if by == sortByName {
+		return nil
+	}
+	var usages []corev1.ResourceList
+	for i := range ms {
+		for _, c := range ms[i].Containers {
+			usages = append(usages, c.Usage)
+		}
+	}
+	if err := validateSortBy(by, usages); err != nil {
+		return err
+	}
+	totals := make([]resource.Quantity, len(ms))
+	for i := range ms {
+		for _, c := range ms[i].Containers {
+			totals[i].Add(c.Usage[corev1.ResourceName(by)])
+		}
+	}
+	sort.Stable(podMetricsByUsage{items: ms, totals: totals})
+	return nil
+}
+
+// validateSortBy returns a bad request error unless metrics can be sorted by
+// usage of resource by: cpu and memory are always served, other resources
+// only if one of usages has them.
+func validateSortBy(by string, usages []corev1.ResourceList) error {
+	name := corev1.ResourceName(by)
+	if name == corev1.ResourceCPU || name == corev1.ResourceMemory {
+		return nil
+	}
+	for _, usage := range usages {
+		if _, found := usage[name]; found {
+			return nil
+		}
+	}
+	return errors.NewBadRequest(fmt.Sprintf("unknown %s %q, expected %s or a served resource, e.g. cpu or memory", sortQueryParameter, by, sortByName))
+}
+
+// podMetricsByUsage sorts pod metrics together with their total usage.
+type podMetricsByUsage struct {
+	items  []metrics.PodMetrics
+	totals []resource.Quantity
+}
+
+func (p podMetricsByUsage) Len() int           { return len(p.items) }
+func (p podMetricsByUsage) Less(i, j int) bool { return p.totals[i].Cmp(p.totals[j]) > 0 }
+func (p podMetricsByUsage) Swap(i, j int) {
+	p.items[i], p.items[j] = p.items[j], p.items[i]
+	p.totals[i], p.totals[j] = p.totals[j], p.totals[i]
+}
+
+// page returns bounds of the page of a list with n items requested by
+// options limit and continue, and the continue token of the next page.
+// Tokens are offsets, so pages of lists changing between requests may skip or repeat items.
+func page(n int, options *metainternalversion.ListOptions) (start, end int, next string, err error) {
+	start, end = 0, n
+	if options == nil {
+		return start, end, "", nil
+	}
+	if options.Continue != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(options.Continue)
+		if err != nil {
+			return 0, 0, "", errors.NewBadRequest(fmt.Sprintf("invalid continue token %q", options.Continue))
+		}
+		start, err = strconv.Atoi(string(decoded))
+		if err != nil || start < 0 {
+			return 0, 0, "", errors.NewBadRequest(fmt.Sprintf("invalid continue token %q", options.Continue))
+		}
+		if start > n {
+			start = n
+		}
+	}
+	if options.Limit > 0 && int64(n-start) > options.Limit {
+		end = start + int(options.Limit)
+		next = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	return start, end, next, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+func TestNodeList_Sorting(t *testing.T) {
+	tcs := []struct {
+		name         string
+		sortBy       string
+		limit        int64
+		continueFrom string
+		wantNodes    []string
+		wantContinue bool
+		wantError    bool
+	}{
+		{
+			name:      "Default order",
+			wantNodes: []string{"node1", "node2", "node3"},
+		},
+		{
+			name:      "By name",
+			sortBy:    "name",
+			wantNodes: []string{"node1", "node2", "node3"},
+		},
+		{
+			name:      "By usage",
+			sortBy:    "res1",
+			wantNodes: []string{"node2", "node3", "node1"},
+		},
+		{
+			name:         "By usage with limit",
+			sortBy:       "res1",
+			limit:        2,
+			wantNodes:    []string{"node2", "node3"},
+			wantContinue: true,
+		},
+		{
+			name:         "Next page",
+			sortBy:       "res1",
+			limit:        2,
+			continueFrom: "Mg",
+			wantNodes:    []string{"node1"},
+		},
+		{
+			name:         "Invalid continue",
+			continueFrom: "not-an-offset",
+			wantError:    true,
+		},
+		{
+			name:      "Unknown resource",
+			sortBy:    "res3",
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewTestNodeStorage(nil)
+			ctx := genericapirequest.NewContext()
+			if tc.sortBy != "" {
+				ctx = genericapirequest.WithValue(ctx, sortByKey{}, tc.sortBy)
+			}
+
+			got, err := r.List(ctx, &metainternalversion.ListOptions{Limit: tc.limit, Continue: tc.continueFrom})
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantError {
+				if !apierrors.IsBadRequest(err) {
+					t.Errorf("Expected bad request, got %v", err)
+				}
+				return
+			}
+			list := got.(*metrics.NodeMetricsList)
+			names := make([]string, 0, len(list.Items))
+			for _, item := range list.Items {
+				names = append(names, item.Name)
+			}
+			if diff := cmp.Diff(tc.wantNodes, names); diff != "" {
+				t.Errorf("Unexpected nodes, diff:\n%s", diff)
+			}
+			if (list.Continue != "") != tc.wantContinue {
+				t.Errorf("Unexpected continue token %q", list.Continue)
+			}
+		})
+	}
+}
+
+func TestPodList_Sorting(t *testing.T) {
+	tcs := []struct {
+		name      string
+		sortBy    string
+		wantPods  []string
+		wantError bool
+	}{
+		{
+			name:     "Default order",
+			wantPods: []string{"other/pod1", "other/pod2", "testValue/pod3"},
+		},
+		{
+			name:     "By cpu summed over containers",
+			sortBy:   "cpu",
+			wantPods: []string{"other/pod2", "testValue/pod3", "other/pod1"},
+		},
+		{
+			name:     "By memory summed over containers",
+			sortBy:   "memory",
+			wantPods: []string{"testValue/pod3", "other/pod2", "other/pod1"},
+		},
+		{
+			name:      "Unknown resource",
+			sortBy:    "cpus",
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewPodTestStorage(nil)
+			ctx := genericapirequest.NewContext()
+			if tc.sortBy != "" {
+				ctx = genericapirequest.WithValue(ctx, sortByKey{}, tc.sortBy)
+			}
+
+			got, err := r.List(ctx, nil)
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantError {
+				if !apierrors.IsBadRequest(err) {
+					t.Errorf("Expected bad request, got %v", err)
+				}
+				return
+			}
+			list := got.(*metrics.PodMetricsList)
+			names := make([]string, 0, len(list.Items))
+			for _, item := range list.Items {
+				names = append(names, item.Namespace+"/"+item.Name)
+			}
+			if diff := cmp.Diff(tc.wantPods, names); diff != "" {
+				t.Errorf("Unexpected pods, diff:\n%s", diff)
+			}
+		})
+	}
+}
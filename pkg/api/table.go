@@ -15,21 +15,66 @@
 package api
 
 import (
+	"fmt"
 	"sort"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
-	metav1beta1 "k8s.io/apimachinery/pkg/apis/meta/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/metrics/pkg/apis/metrics"
 )
 
-func addPodMetricsToTable(table *metav1beta1.Table, pods ...metrics.PodMetrics) {
-	usage := make(v1.ResourceList, 3)
+// tableIncludesHeaders returns whether column definitions should be
+// returned, as internal callers may request rows only with NoHeaders.
+// Options are the same type for both meta.k8s.io/v1 and v1beta1 tables.
+func tableIncludesHeaders(tableOptions runtime.Object) bool {
+	opts, ok := tableOptions.(*metav1.TableOptions)
+	return !ok || opts == nil || !opts.NoHeaders
+}
+
+func tableColumnDefinitions(names []string) []metav1.TableColumnDefinition {
+	columns := make([]metav1.TableColumnDefinition, 0, len(names)+2)
+	columns = append(columns, metav1.TableColumnDefinition{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"})
+	for _, name := range names {
+		columns = append(columns, metav1.TableColumnDefinition{
+			Name:        name,
+			Type:        "string",
+			Format:      "quantity",
+			Description: fmt.Sprintf("Usage of %s", name),
+		})
+	}
+	columns = append(columns, metav1.TableColumnDefinition{
+		Name:        "Window",
+		Type:        "string",
+		Format:      "duration",
+		Description: "Time window over which usage was calculated",
+	})
+	return columns
+}
+
+// sortedResourceNames returns names of all resources present in the usages,
+// so that rows have the same columns even if some metrics miss a resource.
+func sortedResourceNames(usages ...v1.ResourceList) []string {
+	seen := map[v1.ResourceName]struct{}{}
 	var names []string
-	for i, pod := range pods {
+	for _, usage := range usages {
 		for k := range usage {
-			delete(usage, k)
+			if _, found := seen[k]; found {
+				continue
+			}
+			seen[k] = struct{}{}
+			names = append(names, string(k))
 		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func addPodMetricsToTable(table *metav1.Table, includeHeaders bool, pods ...metrics.PodMetrics) {
+	usages := make([]v1.ResourceList, len(pods))
+	for i, pod := range pods {
+		usage := make(v1.ResourceList, 3)
 		for _, container := range pod.Containers {
 			for k, v := range container.Usage {
 				u := usage[k]
@@ -37,77 +82,43 @@ func addPodMetricsToTable(table *metav1beta1.Table, pods ...metrics.PodMetrics)
 				usage[k] = u
 			}
 		}
-		if names == nil {
-			for k := range usage {
-				names = append(names, string(k))
-			}
-			sort.Strings(names)
-
-			table.ColumnDefinitions = []metav1beta1.TableColumnDefinition{
-				{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
-			}
-			for _, name := range names {
-				table.ColumnDefinitions = append(table.ColumnDefinitions, metav1beta1.TableColumnDefinition{
-					Name:   name,
-					Type:   "string",
-					Format: "quantity",
-				})
-			}
-			table.ColumnDefinitions = append(table.ColumnDefinitions, metav1beta1.TableColumnDefinition{
-				Name:   "Window",
-				Type:   "string",
-				Format: "duration",
-			})
-		}
-		row := make([]interface{}, 0, len(names)+1)
-		row = append(row, pod.Name)
-		for _, name := range names {
-			v := usage[v1.ResourceName(name)]
-			row = append(row, v.String())
-		}
-		row = append(row, pod.Window.Duration.String())
-		table.Rows = append(table.Rows, metav1beta1.TableRow{
-			Cells:  row,
+		usages[i] = usage
+	}
+	names := sortedResourceNames(usages...)
+	if includeHeaders {
+		table.ColumnDefinitions = tableColumnDefinitions(names)
+	}
+	for i, pod := range pods {
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells:  tableCells(pod.Name, names, usages[i], pod.Window.Duration),
 			Object: runtime.RawExtension{Object: &pods[i]},
 		})
 	}
 }
 
-func addNodeMetricsToTable(table *metav1beta1.Table, nodes ...metrics.NodeMetrics) {
-	var names []string
+func addNodeMetricsToTable(table *metav1.Table, includeHeaders bool, nodes ...metrics.NodeMetrics) {
+	usages := make([]v1.ResourceList, len(nodes))
 	for i, node := range nodes {
-		if names == nil {
-			for k := range node.Usage {
-				names = append(names, string(k))
-			}
-			sort.Strings(names)
-
-			table.ColumnDefinitions = []metav1beta1.TableColumnDefinition{
-				{Name: "Name", Type: "string", Format: "name", Description: "Name of the resource"},
-			}
-			for _, name := range names {
-				table.ColumnDefinitions = append(table.ColumnDefinitions, metav1beta1.TableColumnDefinition{
-					Name:   name,
-					Type:   "string",
-					Format: "quantity",
-				})
-			}
-			table.ColumnDefinitions = append(table.ColumnDefinitions, metav1beta1.TableColumnDefinition{
-				Name:   "Window",
-				Type:   "string",
-				Format: "duration",
-			})
-		}
-		row := make([]interface{}, 0, len(names)+1)
-		row = append(row, node.Name)
-		for _, name := range names {
-			v := node.Usage[v1.ResourceName(name)]
-			row = append(row, v.String())
-		}
-		row = append(row, node.Window.Duration.String())
-		table.Rows = append(table.Rows, metav1beta1.TableRow{
-			Cells:  row,
+		usages[i] = node.Usage
+	}
+	names := sortedResourceNames(usages...)
+	if includeHeaders {
+		table.ColumnDefinitions = tableColumnDefinitions(names)
+	}
+	for i, node := range nodes {
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells:  tableCells(node.Name, names, node.Usage, node.Window.Duration),
 			Object: runtime.RawExtension{Object: &nodes[i]},
 		})
 	}
 }
+
+func tableCells(name string, names []string, usage v1.ResourceList, window time.Duration) []interface{} {
+	cells := make([]interface{}, 0, len(names)+2)
+	cells = append(cells, name)
+	for _, name := range names {
+		v := usage[v1.ResourceName(name)]
+		cells = append(cells, v.String())
+	}
+	return append(cells, window.String())
+}
@@ -19,7 +19,14 @@ package api
 import (
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/metrics/pkg/apis/metrics"
 )
 
 func TestNodeList_ConvertToTable(t *testing.T) {
@@ -88,3 +95,80 @@ func TestPodList_ConvertToTable(t *testing.T) {
 		t.Errorf("Got unexpected object: %+v", res)
 	}
 }
+
+func TestConvertToTable_Options(t *testing.T) {
+	tcs := []struct {
+		name         string
+		object       runtime.Object
+		options      runtime.Object
+		wantColumns  []string
+		wantRowCells [][]interface{}
+		wantError    bool
+	}{
+		{
+			name: "Columns of all resources",
+			object: &metrics.NodeMetricsList{Items: []metrics.NodeMetrics{
+				{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Usage: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("5Mi")}},
+			}},
+			wantColumns: []string{"Name", "cpu", "memory", "Window"},
+			wantRowCells: [][]interface{}{
+				{"node1", "10m", "0", "0s"},
+				{"node2", "0", "5Mi", "0s"},
+			},
+		},
+		{
+			name:        "Empty list has headers",
+			object:      &metrics.PodMetricsList{},
+			wantColumns: []string{"Name", "Window"},
+		},
+		{
+			name: "No headers",
+			object: &metrics.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod1"},
+				Containers: []metrics.ContainerMetrics{{Name: "c1", Usage: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m")}}},
+			},
+			options:      &metav1.TableOptions{NoHeaders: true},
+			wantRowCells: [][]interface{}{{"pod1", "10m", "0s"}},
+		},
+		{
+			name:      "Unsupported object",
+			object:    &metav1.Status{},
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				res *metav1.Table
+				err error
+			)
+			switch tc.object.(type) {
+			case *metrics.PodMetrics, *metrics.PodMetricsList:
+				res, err = NewPodTestStorage(nil).ConvertToTable(genericapirequest.NewContext(), tc.object, tc.options)
+			default:
+				res, err = NewTestNodeStorage(nil).ConvertToTable(genericapirequest.NewContext(), tc.object, tc.options)
+			}
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantError {
+				return
+			}
+			var columns []string
+			for _, c := range res.ColumnDefinitions {
+				columns = append(columns, c.Name)
+			}
+			if diff := cmp.Diff(tc.wantColumns, columns); diff != "" {
+				t.Errorf("Unexpected columns, diff:\n%s", diff)
+			}
+			var cells [][]interface{}
+			for _, r := range res.Rows {
+				cells = append(cells, r.Cells)
+			}
+			if diff := cmp.Diff(tc.wantRowCells, cells); diff != "" {
+				t.Errorf("Unexpected rows, diff:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	goerrors "errors"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	genericfeatures "k8s.io/apiserver/pkg/features"
+
+	"sigs.k8s.io/metrics-server/pkg/features"
+)
+
+// initialEventsEndAnnotation marks the bookmark sent after initial events of a watch list.
+const initialEventsEndAnnotation = "k8s.io/initial-events-end"
+
+// watchListChunkSize is the number of objects whose metrics are read at once
+// when streaming a watch list, bounding the memory a watch holds.
+const watchListChunkSize = 100
+
+// validateWatchList rejects watches other than watch lists, as metrics have
+// no resource version to watch changes from, and all watches of resource if
+// the WatchList feature gate is disabled, as it is by default.
+func validateWatchList(resource schema.GroupResource, options *metainternalversion.ListOptions) error {
+	if !features.Enabled(genericfeatures.WatchList) {
+		return errors.NewMethodNotSupported(resource, "watch")
+	}
+	if options == nil || options.SendInitialEvents == nil || !*options.SendInitialEvents {
+		return errors.NewBadRequest("watch is only supported with sendInitialEvents=true")
+	}
+	return nil
+}
+
+// produceFunc sends the items of a watch list, returning errWatchStopped once send returns false.
+type produceFunc func(send func(runtime.Object) bool) error
+
+// errWatchStopped is returned by a produceFunc when the watch was stopped.
+var errWatchStopped = goerrors.New("watch stopped")
+
+// chunks calls fn with consecutive ranges of up to watchListChunkSize of n
+// items, until it returns an error.
+func chunks(n int, fn func(start, end int) error) error {
+	for start := 0; start < n; start += watchListChunkSize {
+		end := start + watchListChunkSize
+		if end > n {
+			end = n
+		}
+		if err := fn(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newWatchList streams items sent by produce as ADDED events, as they are
+// read, followed by a bookmark marking the end of initial events if
+// requested. If produce fails, an ERROR event ends the watch. The watch is
+// otherwise kept open without further events until stopped, so clients don't
+// immediately re-list.
+func newWatchList(ctx context.Context, options *metainternalversion.ListOptions, produce produceFunc, bookmark runtime.Object) (watch.Interface, error) {
+	if options.AllowWatchBookmarks {
+		accessor, err := meta.Accessor(bookmark)
+		if err != nil {
+			return nil, err
+		}
+		accessor.SetAnnotations(map[string]string{initialEventsEndAnnotation: "true"})
+	}
+	ch := make(chan watch.Event)
+	w := watch.NewProxyWatcher(ch)
+	go func() {
+		defer close(ch)
+		send := func(event watch.Event) bool {
+			select {
+			case ch <- event:
+				return true
+			case <-w.StopChan():
+			case <-ctx.Done():
+			}
+			return false
+		}
+		err := produce(func(obj runtime.Object) bool {
+			return send(watch.Event{Type: watch.Added, Object: obj})
+		})
+		if err == errWatchStopped {
+			return
+		}
+		if err != nil {
+			send(watch.Event{Type: watch.Error, Object: &errors.NewInternalError(err).ErrStatus})
+			return
+		}
+		if options.AllowWatchBookmarks && !send(watch.Event{Type: watch.Bookmark, Object: bookmark}) {
+			return
+		}
+		select {
+		case <-w.StopChan():
+		case <-ctx.Done():
+		}
+	}()
+	return w, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	genericfeatures "k8s.io/apiserver/pkg/features"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	featuregatetesting "k8s.io/component-base/featuregate/testing"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+func TestNodeWatch(t *testing.T) {
+	sendInitialEvents := true
+	tcs := []struct {
+		name       string
+		options    *metainternalversion.ListOptions
+		disabled   bool
+		wantEvents []watch.EventType
+		wantError  bool
+	}{
+		{
+			name:      "Plain watch",
+			options:   &metainternalversion.ListOptions{},
+			wantError: true,
+		},
+		{
+			name:       "Watch list",
+			options:    &metainternalversion.ListOptions{SendInitialEvents: &sendInitialEvents, AllowWatchBookmarks: true},
+			wantEvents: []watch.EventType{watch.Added, watch.Added, watch.Added, watch.Bookmark},
+		},
+		{
+			name:      "Watch list with the WatchList feature gate disabled",
+			options:   &metainternalversion.ListOptions{SendInitialEvents: &sendInitialEvents},
+			disabled:  true,
+			wantError: true,
+		},
+		{
+			name:       "Watch list without bookmarks",
+			options:    &metainternalversion.ListOptions{SendInitialEvents: &sendInitialEvents},
+			wantEvents: []watch.EventType{watch.Added, watch.Added, watch.Added},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			defer featuregatetesting.SetFeatureGateDuringTest(t, utilfeature.DefaultFeatureGate, genericfeatures.WatchList, !tc.disabled)()
+			r := NewTestNodeStorage(nil)
+
+			w, err := r.Watch(genericapirequest.NewContext(), tc.options)
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantError {
+				return
+			}
+			defer w.Stop()
+			for i, want := range tc.wantEvents {
+				event := <-w.ResultChan()
+				if event.Type != want {
+					t.Fatalf("Event %d type != %s, got: %s", i, want, event.Type)
+				}
+				if event.Type == watch.Bookmark && event.Object.(*metrics.NodeMetrics).Annotations[initialEventsEndAnnotation] != "true" {
+					t.Errorf("Bookmark is missing %s annotation", initialEventsEndAnnotation)
+				}
+			}
+		})
+	}
+}
+
+func TestWatchList_StreamsChunks(t *testing.T) {
+	sendInitialEvents := true
+	options := &metainternalversion.ListOptions{SendInitialEvents: &sendInitialEvents, AllowWatchBookmarks: true}
+	read := 0
+	w, err := newWatchList(context.Background(), options, func(send func(runtime.Object) bool) error {
+		return chunks(3*watchListChunkSize, func(start, end int) error {
+			read++
+			for i := start; i < end; i++ {
+				if !send(&metrics.NodeMetrics{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("node%d", i)}}) {
+					return errWatchStopped
+				}
+			}
+			return nil
+		})
+	}, &metrics.NodeMetrics{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-w.ResultChan(); event.Type != watch.Added || event.Object.(*metrics.NodeMetrics).Name != "node0" {
+		t.Fatalf("Unexpected first event %s of %v", event.Type, event.Object)
+	}
+	w.Stop()
+	for range w.ResultChan() {
+	}
+	if read != 1 {
+		t.Errorf("Expected only the first chunk to be read before stopping, got %d chunks", read)
+	}
+}
+
+func TestWatchList_Error(t *testing.T) {
+	sendInitialEvents := true
+	options := &metainternalversion.ListOptions{SendInitialEvents: &sendInitialEvents, AllowWatchBookmarks: true}
+	w, err := newWatchList(context.Background(), options, func(send func(runtime.Object) bool) error {
+		if !send(&metrics.NodeMetrics{}) {
+			return errWatchStopped
+		}
+		return fmt.Errorf("failed reading nodes metrics")
+	}, &metrics.NodeMetrics{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	for i, want := range []watch.EventType{watch.Added, watch.Error} {
+		if event := <-w.ResultChan(); event.Type != want {
+			t.Fatalf("Event %d type != %s, got: %s", i, want, event.Type)
+		}
+	}
+	if _, open := <-w.ResultChan(); open {
+		t.Errorf("Expected the watch to end after an error")
+	}
+}
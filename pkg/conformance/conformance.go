@@ -0,0 +1,440 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conformance verifies that a server implements the contract of the
+// metrics.k8s.io API, so metrics-server and its replacements can prove
+// compatibility with consumers like the Horizontal Pod Autoscaler and kubectl top.
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// DefaultMaxMetricAge is the default limit of metrics age accepted by the freshness check.
+const DefaultMaxMetricAge = 5 * time.Minute
+
+// nonexistentName is used to request objects that must not exist.
+const nonexistentName = "metrics-conformance-nonexistent"
+
+// Config configures a conformance run.
+type Config struct {
+	// Rest is used to reach the API server serving metrics.k8s.io.
+	Rest *rest.Config
+	// MaxMetricAge is the longest accepted time since metrics were collected. Defaults to DefaultMaxMetricAge.
+	MaxMetricAge time.Duration
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	// Check is the name of the verified part of the contract.
+	Check string
+	// Err describes why the check failed, nil if it passed.
+	Err error
+}
+
+// Passed returns true if the check passed.
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// check verifies a single part of the contract.
+type check struct {
+	name string
+	run  func(ctx context.Context, s *suite) error
+}
+
+var checks = []check{
+	{"discovery", checkDiscovery},
+	{"list nodes", checkListNodes},
+	{"get node", checkGetNode},
+	{"get missing node", checkGetMissingNode},
+	{"list pods", checkListPods},
+	{"get pod", checkGetPod},
+	{"get missing pod", checkGetMissingPod},
+	{"field selector", checkFieldSelector},
+	{"label selector", checkLabelSelector},
+	{"table", checkTable},
+	{"freshness", checkFreshness},
+	{"read only", checkReadOnly},
+}
+
+type suite struct {
+	config    Config
+	client    metricsclientset.Interface
+	discovery discovery.DiscoveryInterface
+}
+
+// Run verifies the metrics.k8s.io API served at config.Rest and returns results of all checks.
+// An error is only returned if the checks could not be run.
+func Run(ctx context.Context, config Config) ([]Result, error) {
+	if config.Rest == nil {
+		return nil, fmt.Errorf("rest config is required")
+	}
+	if config.MaxMetricAge == 0 {
+		config.MaxMetricAge = DefaultMaxMetricAge
+	}
+	client, err := metricsclientset.NewForConfig(config.Rest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct metrics client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config.Rest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct discovery client: %w", err)
+	}
+	s := &suite{config: config, client: client, discovery: discoveryClient}
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		results = append(results, Result{Check: c.name, Err: c.run(ctx, s)})
+	}
+	return results, nil
+}
+
+func checkDiscovery(ctx context.Context, s *suite) error {
+	resources, err := s.discovery.ServerResourcesForGroupVersion(v1beta1.SchemeGroupVersion.String())
+	if err != nil {
+		return fmt.Errorf("failed to discover %s: %w", v1beta1.SchemeGroupVersion, err)
+	}
+	want := map[string]struct {
+		kind       string
+		namespaced bool
+	}{
+		"nodes": {kind: "NodeMetrics", namespaced: false},
+		"pods":  {kind: "PodMetrics", namespaced: true},
+	}
+	for _, r := range resources.APIResources {
+		w, found := want[r.Name]
+		if !found {
+			continue
+		}
+		delete(want, r.Name)
+		if r.Kind != w.kind {
+			return fmt.Errorf("resource %q has kind %q, expected %q", r.Name, r.Kind, w.kind)
+		}
+		if r.Namespaced != w.namespaced {
+			return fmt.Errorf("resource %q has namespaced %v, expected %v", r.Name, r.Namespaced, w.namespaced)
+		}
+		for _, verb := range []string{"get", "list"} {
+			if !containsString(r.Verbs, verb) {
+				return fmt.Errorf("resource %q doesn't support verb %q", r.Name, verb)
+			}
+		}
+	}
+	missing := make([]string, 0, len(want))
+	for name := range want {
+		missing = append(missing, name)
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("resources %v are not served", missing)
+	}
+	return nil
+}
+
+func checkListNodes(ctx context.Context, s *suite) error {
+	nodes, err := s.listNodes(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if node.Name == "" {
+			return fmt.Errorf("node metrics without name")
+		}
+		if err := validateUsage(fmt.Sprintf("node %q", node.Name), node.Usage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkGetNode(ctx context.Context, s *suite) error {
+	nodes, err := s.listNodes(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	node, err := s.client.MetricsV1beta1().NodeMetricses().Get(ctx, nodes[0].Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get node %q: %w", nodes[0].Name, err)
+	}
+	if node.Name != nodes[0].Name {
+		return fmt.Errorf("got node %q, expected %q", node.Name, nodes[0].Name)
+	}
+	return validateUsage(fmt.Sprintf("node %q", node.Name), node.Usage)
+}
+
+func checkGetMissingNode(ctx context.Context, s *suite) error {
+	_, err := s.client.MetricsV1beta1().NodeMetricses().Get(ctx, nonexistentName, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("expected NotFound error getting missing node, got: %v", err)
+	}
+	return nil
+}
+
+func checkListPods(ctx context.Context, s *suite) error {
+	pods, err := s.listPods(ctx, metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if pod.Name == "" || pod.Namespace == "" {
+			return fmt.Errorf("pod metrics without name or namespace")
+		}
+		if err := validatePod(pod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkGetPod(ctx context.Context, s *suite) error {
+	pods, err := s.listPods(ctx, metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	pod, err := s.client.MetricsV1beta1().PodMetricses(pods[0].Namespace).Get(ctx, pods[0].Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod %s/%s: %w", pods[0].Namespace, pods[0].Name, err)
+	}
+	if pod.Name != pods[0].Name || pod.Namespace != pods[0].Namespace {
+		return fmt.Errorf("got pod %s/%s, expected %s/%s", pod.Namespace, pod.Name, pods[0].Namespace, pods[0].Name)
+	}
+	return validatePod(*pod)
+}
+
+func checkGetMissingPod(ctx context.Context, s *suite) error {
+	_, err := s.client.MetricsV1beta1().PodMetricses(metav1.NamespaceDefault).Get(ctx, nonexistentName, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("expected NotFound error getting missing pod, got: %v", err)
+	}
+	return nil
+}
+
+func checkFieldSelector(ctx context.Context, s *suite) error {
+	nodes, err := s.listNodes(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	selected, err := s.client.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", nodes[0].Name).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes by field selector: %w", err)
+	}
+	if len(selected.Items) != 1 || selected.Items[0].Name != nodes[0].Name {
+		return fmt.Errorf("listing nodes by name %q returned %d items", nodes[0].Name, len(selected.Items))
+	}
+
+	pods, err := s.listPods(ctx, metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	selectedPods, err := s.client.MetricsV1beta1().PodMetricses(pods[0].Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", pods[0].Name).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods by field selector: %w", err)
+	}
+	if len(selectedPods.Items) != 1 || selectedPods.Items[0].Name != pods[0].Name {
+		return fmt.Errorf("listing pods by name %s/%s returned %d items", pods[0].Namespace, pods[0].Name, len(selectedPods.Items))
+	}
+	return nil
+}
+
+// checkLabelSelector verifies selecting nodes by a label of the first node
+// having any, it passes if no node metrics have labels.
+func checkLabelSelector(ctx context.Context, s *suite) error {
+	nodes, err := s.listNodes(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		for key, value := range node.Labels {
+			selector := labels.SelectorFromSet(labels.Set{key: value})
+			selected, err := s.listNodes(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+			if err != nil {
+				return fmt.Errorf("failed to list nodes by label selector %q: %w", selector, err)
+			}
+			found := false
+			for _, item := range selected {
+				if !selector.Matches(labels.Set(item.Labels)) {
+					return fmt.Errorf("node %q doesn't match label selector %q", item.Name, selector)
+				}
+				found = found || item.Name == node.Name
+			}
+			if !found {
+				return fmt.Errorf("node %q missing from list by label selector %q", node.Name, selector)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// checkTable verifies nodes are served as both meta.k8s.io/v1 and v1beta1
+// tables, which are requested by newer and older kubectl respectively.
+func checkTable(ctx context.Context, s *suite) error {
+	nodes, err := s.listNodes(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, version := range []string{"v1", "v1beta1"} {
+		table, err := s.getNodesTable(ctx, version)
+		if err != nil {
+			return err
+		}
+		if table.APIVersion != "meta.k8s.io/"+version || table.Kind != "Table" {
+			return fmt.Errorf("got %s %s, expected meta.k8s.io/%s Table", table.APIVersion, table.Kind, version)
+		}
+		if len(table.ColumnDefinitions) == 0 || table.ColumnDefinitions[0].Name != "Name" {
+			return fmt.Errorf("%s table doesn't start with Name column", version)
+		}
+		if len(table.Rows) != len(nodes) {
+			return fmt.Errorf("%s table has %d rows, expected %d", version, len(table.Rows), len(nodes))
+		}
+		for _, row := range table.Rows {
+			if len(row.Cells) != len(table.ColumnDefinitions) {
+				return fmt.Errorf("%s table row has %d cells, expected %d", version, len(row.Cells), len(table.ColumnDefinitions))
+			}
+		}
+	}
+	return nil
+}
+
+func (s *suite) getNodesTable(ctx context.Context, version string) (*metav1.Table, error) {
+	raw, err := s.client.MetricsV1beta1().RESTClient().Get().
+		Resource("nodes").
+		SetHeader("Accept", fmt.Sprintf("application/json;as=Table;v=%s;g=meta.k8s.io", version)).
+		Do(ctx).Raw()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes as %s table: %w", version, err)
+	}
+	table := &metav1.Table{}
+	if err := json.Unmarshal(raw, table); err != nil {
+		return nil, fmt.Errorf("failed to decode %s table: %w", version, err)
+	}
+	return table, nil
+}
+
+func checkFreshness(ctx context.Context, s *suite) error {
+	nodes, err := s.listNodes(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, node := range nodes {
+		if err := validateTime(fmt.Sprintf("node %q", node.Name), now, node.Timestamp, node.Window, s.config.MaxMetricAge); err != nil {
+			return err
+		}
+	}
+	pods, err := s.listPods(ctx, metav1.NamespaceAll, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if err := validateTime(fmt.Sprintf("pod %s/%s", pod.Namespace, pod.Name), now, pod.Timestamp, pod.Window, s.config.MaxMetricAge); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkReadOnly(ctx context.Context, s *suite) error {
+	err := s.client.MetricsV1beta1().RESTClient().Post().
+		Resource("nodes").
+		Body(&v1beta1.NodeMetrics{ObjectMeta: metav1.ObjectMeta{Name: nonexistentName}}).
+		Do(ctx).Error()
+	if !apierrors.IsMethodNotSupported(err) {
+		return fmt.Errorf("expected MethodNotAllowed error creating node metrics, got: %v", err)
+	}
+	return nil
+}
+
+func (s *suite) listNodes(ctx context.Context, options metav1.ListOptions) ([]v1beta1.NodeMetrics, error) {
+	list, err := s.client.MetricsV1beta1().NodeMetricses().List(ctx, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	if len(list.Items) == 0 && options.LabelSelector == "" {
+		return nil, fmt.Errorf("no node metrics served, at least one node is required")
+	}
+	return list.Items, nil
+}
+
+func (s *suite) listPods(ctx context.Context, namespace string, options metav1.ListOptions) ([]v1beta1.PodMetrics, error) {
+	list, err := s.client.MetricsV1beta1().PodMetricses(namespace).List(ctx, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, fmt.Errorf("no pod metrics served, at least one pod is required")
+	}
+	return list.Items, nil
+}
+
+func validatePod(pod v1beta1.PodMetrics) error {
+	if len(pod.Containers) == 0 {
+		return fmt.Errorf("pod %s/%s has no containers", pod.Namespace, pod.Name)
+	}
+	for _, c := range pod.Containers {
+		if err := validateUsage(fmt.Sprintf("container %q of pod %s/%s", c.Name, pod.Namespace, pod.Name), c.Usage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateUsage(what string, usage corev1.ResourceList) error {
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		q, found := usage[name]
+		if !found {
+			return fmt.Errorf("%s has no %s usage", what, name)
+		}
+		if q.Sign() < 0 {
+			return fmt.Errorf("%s has negative %s usage %s", what, name, q.String())
+		}
+	}
+	return nil
+}
+
+func validateTime(what string, now time.Time, timestamp metav1.Time, window metav1.Duration, maxAge time.Duration) error {
+	if window.Duration <= 0 {
+		return fmt.Errorf("%s has non-positive window %v", what, window.Duration)
+	}
+	if age := now.Sub(timestamp.Time); age > maxAge || age < -maxAge {
+		return fmt.Errorf("%s has timestamp %v, more than %v away from now", what, timestamp.Time, maxAge)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
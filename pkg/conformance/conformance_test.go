@@ -0,0 +1,117 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conformance
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/endpoints/openapi"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
+	generatedopenapi "sigs.k8s.io/metrics-server/pkg/api/generated/openapi"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+func TestMetricsServerConformance(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	results, err := Run(context.Background(), Config{Rest: &rest.Config{Host: server.URL}})
+	if err != nil {
+		t.Fatalf("Failed to run conformance checks: %v", err)
+	}
+	if len(results) != len(checks) {
+		t.Errorf("Got %d results, expected %d", len(results), len(checks))
+	}
+	for _, r := range results {
+		if !r.Passed() {
+			t.Errorf("Check %q failed: %v", r.Check, r.Err)
+		}
+	}
+}
+
+func TestStaleMetrics(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	results, err := Run(context.Background(), Config{Rest: &rest.Config{Host: server.URL}, MaxMetricAge: time.Nanosecond})
+	if err != nil {
+		t.Fatalf("Failed to run conformance checks: %v", err)
+	}
+	for _, r := range results {
+		if r.Check == "freshness" && r.Passed() {
+			t.Errorf("Expected freshness check to fail with metric age limit of 1ns")
+		}
+	}
+}
+
+// newTestServer serves the metrics API of metrics-server backed by storage with metrics of a single node and pod.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	config := genericapiserver.NewRecommendedConfig(api.Codecs)
+	config.ExternalAddress = "localhost:443"
+	config.LoopbackClientConfig = &rest.Config{}
+	config.OpenAPIConfig = genericapiserver.DefaultOpenAPIConfig(generatedopenapi.GetOpenAPIDefinitions, openapi.NewDefinitionNamer(api.Scheme))
+	config.OpenAPIV3Config = genericapiserver.DefaultOpenAPIV3Config(generatedopenapi.GetOpenAPIDefinitions, openapi.NewDefinitionNamer(api.Scheme))
+	server, err := config.Complete().New("metrics-server", genericapiserver.NewEmptyDelegate())
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+
+	nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	mustAdd(t, nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{corev1.LabelHostname: "node1"}}})
+	mustAdd(t, pods, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "pod1", Namespace: "ns1"}})
+
+	store := storage.NewStorage(time.Minute)
+	start := time.Now().Add(-time.Hour)
+	for i, cpu := range []uint64{1e9, 2e9} {
+		point := storage.MetricsPoint{
+			StartTime:         start,
+			Timestamp:         time.Now().Add(time.Duration(i-2) * 10 * time.Second),
+			CumulativeCpuUsed: cpu,
+			MemoryUsage:       1 << 20,
+		}
+		store.Store(&storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{"node1": point},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				{Namespace: "ns1", Name: "pod1"}: {Containers: map[string]storage.MetricsPoint{"container1": point}},
+			},
+		})
+	}
+
+	_, err = api.Install(store, cache.NewGenericLister(pods, corev1.Resource("pods")), v1listers.NewNodeLister(nodes), nil, api.PodAnnotations{}, nil, server, nil)
+	if err != nil {
+		t.Fatalf("Failed to install metrics API: %v", err)
+	}
+	return httptest.NewServer(server.Handler)
+}
+
+func mustAdd(t *testing.T, indexer cache.Indexer, obj interface{}) {
+	t.Helper()
+	if err := indexer.Add(obj); err != nil {
+		t.Fatalf("Failed to add object: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export pushes the usage served by metrics-server to external
+// systems after each scrape cycle, e.g. for long-term storage, so a single
+// collector feeds both autoscaling and monitoring.
+package export
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var (
+	requestTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "export",
+			Name:      "requests_total",
+			Help:      "Number of export requests sent, partitioned by exporter and result",
+		},
+		[]string{"exporter", "result"},
+	)
+	requestDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace: "metrics_server",
+			Subsystem: "export",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of export requests, partitioned by exporter",
+			Buckets:   metrics.ExponentialBuckets(0.01, 2, 12),
+		},
+		[]string{"exporter"},
+	)
+	skippedCycles = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "export",
+			Name:      "skipped_cycles_total",
+			Help:      "Number of scrape cycles not exported because the exporter was still sending a previous cycle, partitioned by exporter",
+		},
+		[]string{"exporter"},
+	)
+)
+
+// RegisterExportMetrics registers metrics of exporters.
+func RegisterExportMetrics(registrationFunc func(metrics.Registerable) error) error {
+	for _, metric := range []metrics.Registerable{requestTotal, requestDuration, skippedCycles} {
+		if err := registrationFunc(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sink sends usage of a snapshot to an external system.
+type sink interface {
+	send(ctx context.Context, snapshot storage.Snapshot) error
+}
+
+// Exporter sends snapshots of storage to a sink in the background, so slow
+// or unavailable external systems never delay scrape cycles. Only the latest
+// snapshot is kept while a previous one is being sent, failed sends are not
+// retried as the next cycle sends fresher usage.
+type Exporter struct {
+	name    string
+	sink    sink
+	timeout time.Duration
+	pending chan storage.Snapshot
+}
+
+func newExporter(name string, sink sink, timeout time.Duration) *Exporter {
+	return &Exporter{name: name, sink: sink, timeout: timeout, pending: make(chan storage.Snapshot, 1)}
+}
+
+// Export queues snapshot to be sent, replacing a snapshot not sent yet.
+func (e *Exporter) Export(snapshot storage.Snapshot) {
+	select {
+	case e.pending <- snapshot:
+		return
+	default:
+	}
+	select {
+	case <-e.pending:
+		skippedCycles.WithLabelValues(e.name).Inc()
+	default:
+	}
+	select {
+	case e.pending <- snapshot:
+	default:
+	}
+}
+
+// Run sends queued snapshots until ctx is done.
+func (e *Exporter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case snapshot := <-e.pending:
+			e.send(ctx, snapshot)
+		}
+	}
+}
+
+func (e *Exporter) send(ctx context.Context, snapshot storage.Snapshot) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	start := time.Now()
+	err := e.sink.send(ctx, snapshot)
+	requestDuration.WithLabelValues(e.name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		requestTotal.WithLabelValues(e.name, "error").Inc()
+		klog.ErrorS(err, "Failed to export metrics", "exporter", e.name)
+		return
+	}
+	requestTotal.WithLabelValues(e.name, "success").Inc()
+}
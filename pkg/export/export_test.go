@@ -0,0 +1,60 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+type blockingSink struct {
+	started chan struct{}
+	release chan struct{}
+	sent    int
+}
+
+func (s *blockingSink) send(ctx context.Context, snapshot storage.Snapshot) error {
+	s.started <- struct{}{}
+	<-s.release
+	s.sent++
+	return nil
+}
+
+func TestExporter_KeepsLatestSnapshot(t *testing.T) {
+	sink := &blockingSink{started: make(chan struct{}), release: make(chan struct{})}
+	e := newExporter("test", sink, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	e.Export(storage.Snapshot{})
+	<-sink.started
+	// Exports while sending replace each other, only one is queued.
+	for i := 0; i < 3; i++ {
+		e.Export(storage.Snapshot{})
+	}
+	if len(e.pending) != 1 {
+		t.Errorf("Unexpected queued snapshots %d, want 1", len(e.pending))
+	}
+	sink.release <- struct{}{}
+	<-sink.started
+	sink.release <- struct{}{}
+	if len(e.pending) != 0 {
+		t.Errorf("Unexpected queued snapshots %d, want 0", len(e.pending))
+	}
+}
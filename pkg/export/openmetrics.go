@@ -0,0 +1,76 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"io"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// OpenMetricsContentType is the content type of WriteOpenMetrics output.
+const OpenMetricsContentType = string(expfmt.FmtOpenMetrics)
+
+var seriesHelp = map[string]string{
+	nodeCPUSeries:         "CPU usage of the node in cores, as served by the Metrics API",
+	nodeMemorySeries:      "Memory working set of the node in bytes, as served by the Metrics API",
+	containerCPUSeries:    "CPU usage of the container in cores, as served by the Metrics API",
+	containerMemorySeries: "Memory working set of the container in bytes, as served by the Metrics API",
+}
+
+// WriteOpenMetrics writes CPU and memory usage of nodes and containers of
+// snapshot in the OpenMetrics text format, with the series names used by the
+// remote write exporter and the timestamps of the usage.
+func WriteOpenMetrics(w io.Writer, snapshot storage.Snapshot) error {
+	families := map[string]*dto.MetricFamily{}
+	for _, name := range []string{nodeCPUSeries, nodeMemorySeries, containerCPUSeries, containerMemorySeries} {
+		families[name] = &dto.MetricFamily{Name: pointer.String(name), Help: pointer.String(seriesHelp[name]), Type: dto.MetricType_GAUGE.Enum()}
+	}
+	add := func(name string, usage corev1.ResourceList, resource corev1.ResourceName, timestampMs int64, labels ...string) {
+		quantity, found := usage[resource]
+		if !found {
+			return
+		}
+		m := &dto.Metric{Gauge: &dto.Gauge{Value: pointer.Float64(quantity.AsApproximateFloat64())}, TimestampMs: pointer.Int64(timestampMs)}
+		for i := 0; i < len(labels); i += 2 {
+			m.Label = append(m.Label, &dto.LabelPair{Name: pointer.String(labels[i]), Value: pointer.String(labels[i+1])})
+		}
+		families[name].Metric = append(families[name].Metric, m)
+	}
+	for _, node := range snapshot.NodeMetrics() {
+		timestamp := node.Timestamp.UnixMilli()
+		add(nodeCPUSeries, node.Usage, corev1.ResourceCPU, timestamp, "node", node.Name)
+		add(nodeMemorySeries, node.Usage, corev1.ResourceMemory, timestamp, "node", node.Name)
+	}
+	for _, pod := range snapshot.PodMetrics() {
+		timestamp := pod.Timestamp.UnixMilli()
+		for _, c := range pod.Containers {
+			add(containerCPUSeries, c.Usage, corev1.ResourceCPU, timestamp, "namespace", pod.Namespace, "pod", pod.Name, "container", c.Name)
+			add(containerMemorySeries, c.Usage, corev1.ResourceMemory, timestamp, "namespace", pod.Namespace, "pod", pod.Name, "container", c.Name)
+		}
+	}
+	for _, name := range []string{nodeCPUSeries, nodeMemorySeries, containerCPUSeries, containerMemorySeries} {
+		if _, err := expfmt.MetricFamilyToOpenMetrics(w, families[name]); err != nil {
+			return err
+		}
+	}
+	_, err := expfmt.FinalizeOpenMetrics(w)
+	return err
+}
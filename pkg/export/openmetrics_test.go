@@ -0,0 +1,47 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteOpenMetrics(&buf, testSnapshot(time.Unix(1600000000, 0))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := `# HELP metrics_server_node_cpu_usage_cores CPU usage of the node in cores, as served by the Metrics API
+# TYPE metrics_server_node_cpu_usage_cores gauge
+metrics_server_node_cpu_usage_cores{node="node1"} 2.0 1.60000002e+09
+# HELP metrics_server_node_memory_working_set_bytes Memory working set of the node in bytes, as served by the Metrics API
+# TYPE metrics_server_node_memory_working_set_bytes gauge
+metrics_server_node_memory_working_set_bytes{node="node1"} 2048.0 1.60000002e+09
+# HELP metrics_server_container_cpu_usage_cores CPU usage of the container in cores, as served by the Metrics API
+# TYPE metrics_server_container_cpu_usage_cores gauge
+metrics_server_container_cpu_usage_cores{namespace="ns1",pod="pod1",container="app"} 0.5 1.60000002e+09
+# HELP metrics_server_container_memory_working_set_bytes Memory working set of the container in bytes, as served by the Metrics API
+# TYPE metrics_server_container_memory_working_set_bytes gauge
+metrics_server_container_memory_working_set_bytes{namespace="ns1",pod="pod1",container="app"} 1024.0 1.60000002e+09
+# EOF
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Unexpected output, diff:\n%s", diff)
+	}
+}
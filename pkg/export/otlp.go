@@ -0,0 +1,304 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Names of metrics sent by the OTLP exporter, following the OpenTelemetry
+// naming conventions for Kubernetes.
+const (
+	otlpNodeCPU         = "k8s.node.cpu.usage"
+	otlpNodeMemory      = "k8s.node.memory.working_set"
+	otlpContainerCPU    = "k8s.container.cpu.usage"
+	otlpContainerMemory = "k8s.container.memory.working_set"
+	otlpScope           = "sigs.k8s.io/metrics-server"
+)
+
+// OTLPConfig configures sending usage to an OpenTelemetry collector over OTLP/gRPC.
+type OTLPConfig struct {
+	// Endpoint is the host:port of the OTLP/gRPC receiver.
+	Endpoint string
+	// Insecure disables TLS of the connection.
+	Insecure bool
+	// Timeout of export requests.
+	Timeout time.Duration
+	// Headers are sent as gRPC metadata with every request, e.g. for authentication.
+	Headers map[string]string
+	// ResourceAttributes are added to the resource of all metrics, e.g. to identify the cluster.
+	ResourceAttributes map[string]string
+	// Gatherers provide metrics-server's own metrics sent along usage, nil sends usage only.
+	Gatherers []metrics.Gatherer
+}
+
+// Validate returns an error if the endpoint or timeout are invalid.
+func (c OTLPConfig) Validate() error {
+	host, port, err := net.SplitHostPort(c.Endpoint)
+	if err != nil {
+		return fmt.Errorf("endpoint %q should be host:port: %v", c.Endpoint, err)
+	}
+	if host == "" || port == "" {
+		return fmt.Errorf("endpoint %q should be host:port", c.Endpoint)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout should be positive, but value %v provided", c.Timeout)
+	}
+	return nil
+}
+
+type otlp struct {
+	config   OTLPConfig
+	client   collectorpb.MetricsServiceClient
+	resource *resourcepb.Resource
+	// start is the start time of cumulative self metrics.
+	start time.Time
+}
+
+// NewOTLP returns an exporter sending node and container CPU and memory
+// usage, and optionally metrics-server's own metrics, to an OTLP/gRPC
+// receiver. The connection is established lazily and reestablished on failures.
+func NewOTLP(config OTLPConfig) (*Exporter, error) {
+	creds := credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if config.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.Dial(config.Endpoint, grpc.WithTransportCredentials(creds), grpc.WithUserAgent("metrics-server"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP connection: %w", err)
+	}
+	return newExporter("otlp", newOTLP(config, collectorpb.NewMetricsServiceClient(conn)), config.Timeout), nil
+}
+
+func newOTLP(config OTLPConfig, client collectorpb.MetricsServiceClient) *otlp {
+	attributes := map[string]string{"service.name": "metrics-server"}
+	for key, value := range config.ResourceAttributes {
+		attributes[key] = value
+	}
+	res := &resourcepb.Resource{}
+	for _, key := range sortedKeys(attributes) {
+		res.Attributes = append(res.Attributes, stringAttribute(key, attributes[key]))
+	}
+	return &otlp{config: config, client: client, resource: res, start: time.Now()}
+}
+
+func (o *otlp) send(ctx context.Context, snapshot storage.Snapshot) error {
+	req := &collectorpb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource:     o.resource,
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: &commonpb.InstrumentationScope{Name: otlpScope}, Metrics: o.usage(snapshot)}},
+	}}}
+	if len(o.config.Gatherers) != 0 {
+		req.ResourceMetrics[0].ScopeMetrics[0].Metrics = append(req.ResourceMetrics[0].ScopeMetrics[0].Metrics, o.selfMetrics(time.Now())...)
+	}
+	if len(req.ResourceMetrics[0].ScopeMetrics[0].Metrics) == 0 {
+		return nil
+	}
+	for key, value := range o.config.Headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, key, value)
+	}
+	resp, err := o.client.Export(ctx, req)
+	if err != nil {
+		return err
+	}
+	if rejected := resp.GetPartialSuccess().GetRejectedDataPoints(); rejected != 0 {
+		klog.V(1).InfoS("OTLP receiver rejected data points", "count", rejected, "reason", resp.GetPartialSuccess().GetErrorMessage())
+	}
+	return nil
+}
+
+// usage returns CPU and memory usage of nodes and containers of snapshot as gauges.
+func (o *otlp) usage(snapshot storage.Snapshot) []*metricspb.Metric {
+	gauges := map[string]*metricspb.Gauge{}
+	add := func(name string, quantity resource.Quantity, found bool, timestamp time.Time, attributes ...string) {
+		if !found {
+			return
+		}
+		gauge, ok := gauges[name]
+		if !ok {
+			gauge = &metricspb.Gauge{}
+			gauges[name] = gauge
+		}
+		point := &metricspb.NumberDataPoint{
+			TimeUnixNano: uint64(timestamp.UnixNano()),
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: quantity.AsApproximateFloat64()},
+		}
+		for i := 0; i < len(attributes); i += 2 {
+			point.Attributes = append(point.Attributes, stringAttribute(attributes[i], attributes[i+1]))
+		}
+		gauge.DataPoints = append(gauge.DataPoints, point)
+	}
+	for _, node := range snapshot.NodeMetrics() {
+		cpu, found := node.Usage[corev1.ResourceCPU]
+		add(otlpNodeCPU, cpu, found, node.Timestamp.Time, "k8s.node.name", node.Name)
+		memory, found := node.Usage[corev1.ResourceMemory]
+		add(otlpNodeMemory, memory, found, node.Timestamp.Time, "k8s.node.name", node.Name)
+	}
+	for _, pod := range snapshot.PodMetrics() {
+		for _, c := range pod.Containers {
+			cpu, found := c.Usage[corev1.ResourceCPU]
+			add(otlpContainerCPU, cpu, found, pod.Timestamp.Time, "k8s.namespace.name", pod.Namespace, "k8s.pod.name", pod.Name, "k8s.container.name", c.Name)
+			memory, found := c.Usage[corev1.ResourceMemory]
+			add(otlpContainerMemory, memory, found, pod.Timestamp.Time, "k8s.namespace.name", pod.Namespace, "k8s.pod.name", pod.Name, "k8s.container.name", c.Name)
+		}
+	}
+	units := map[string]string{otlpNodeCPU: "{cpu}", otlpNodeMemory: "By", otlpContainerCPU: "{cpu}", otlpContainerMemory: "By"}
+	res := make([]*metricspb.Metric, 0, len(gauges))
+	for _, name := range []string{otlpNodeCPU, otlpNodeMemory, otlpContainerCPU, otlpContainerMemory} {
+		if gauge, found := gauges[name]; found {
+			res = append(res, &metricspb.Metric{Name: name, Unit: units[name], Data: &metricspb.Metric_Gauge{Gauge: gauge}})
+		}
+	}
+	return res
+}
+
+// selfMetrics returns metrics of the gatherers converted to OTLP. Counters
+// and histograms are cumulative since the exporter was created.
+func (o *otlp) selfMetrics(now time.Time) []*metricspb.Metric {
+	var res []*metricspb.Metric
+	for _, gatherer := range o.config.Gatherers {
+		families, err := gatherer.Gather()
+		if err != nil {
+			klog.V(1).InfoS("Failed to gather some metrics for OTLP export", "err", err)
+		}
+		for _, family := range families {
+			if metric := o.convertFamily(family, now); metric != nil {
+				res = append(res, metric)
+			}
+		}
+	}
+	return res
+}
+
+func (o *otlp) convertFamily(family *dto.MetricFamily, now time.Time) *metricspb.Metric {
+	start, timestamp := uint64(o.start.UnixNano()), uint64(now.UnixNano())
+	metric := &metricspb.Metric{Name: family.GetName(), Description: family.GetHelp()}
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		sum := &metricspb.Sum{AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, IsMonotonic: true}
+		for _, m := range family.Metric {
+			sum.DataPoints = append(sum.DataPoints, &metricspb.NumberDataPoint{
+				Attributes:        labelAttributes(m.Label),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      timestamp,
+				Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: m.GetCounter().GetValue()},
+			})
+		}
+		metric.Data = &metricspb.Metric_Sum{Sum: sum}
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		gauge := &metricspb.Gauge{}
+		for _, m := range family.Metric {
+			value := m.GetGauge().GetValue()
+			if family.GetType() == dto.MetricType_UNTYPED {
+				value = m.GetUntyped().GetValue()
+			}
+			gauge.DataPoints = append(gauge.DataPoints, &metricspb.NumberDataPoint{
+				Attributes:   labelAttributes(m.Label),
+				TimeUnixNano: timestamp,
+				Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+			})
+		}
+		metric.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+	case dto.MetricType_HISTOGRAM:
+		histogram := &metricspb.Histogram{AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE}
+		for _, m := range family.Metric {
+			h := m.GetHistogram()
+			sum := h.GetSampleSum()
+			point := &metricspb.HistogramDataPoint{
+				Attributes:        labelAttributes(m.Label),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      timestamp,
+				Count:             h.GetSampleCount(),
+				Sum:               &sum,
+			}
+			// Prometheus buckets are cumulative, OTLP bucket counts aren't
+			// and the +Inf bucket is implicit.
+			var previous uint64
+			for _, bucket := range h.Bucket {
+				if math.IsInf(bucket.GetUpperBound(), 1) {
+					continue
+				}
+				point.ExplicitBounds = append(point.ExplicitBounds, bucket.GetUpperBound())
+				point.BucketCounts = append(point.BucketCounts, bucket.GetCumulativeCount()-previous)
+				previous = bucket.GetCumulativeCount()
+			}
+			point.BucketCounts = append(point.BucketCounts, h.GetSampleCount()-previous)
+			histogram.DataPoints = append(histogram.DataPoints, point)
+		}
+		metric.Data = &metricspb.Metric_Histogram{Histogram: histogram}
+	case dto.MetricType_SUMMARY:
+		summary := &metricspb.Summary{}
+		for _, m := range family.Metric {
+			s := m.GetSummary()
+			point := &metricspb.SummaryDataPoint{
+				Attributes:        labelAttributes(m.Label),
+				StartTimeUnixNano: start,
+				TimeUnixNano:      timestamp,
+				Count:             s.GetSampleCount(),
+				Sum:               s.GetSampleSum(),
+			}
+			for _, q := range s.Quantile {
+				point.QuantileValues = append(point.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+			}
+			summary.DataPoints = append(summary.DataPoints, point)
+		}
+		metric.Data = &metricspb.Metric_Summary{Summary: summary}
+	default:
+		return nil
+	}
+	return metric
+}
+
+func labelAttributes(labels []*dto.LabelPair) []*commonpb.KeyValue {
+	attributes := make([]*commonpb.KeyValue, 0, len(labels))
+	for _, l := range labels {
+		attributes = append(attributes, stringAttribute(l.GetName(), l.GetValue()))
+	}
+	return attributes
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,177 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/testing/protocmp"
+	"k8s.io/component-base/metrics"
+)
+
+type fakeMetricsService struct {
+	req      *collectorpb.ExportMetricsServiceRequest
+	metadata metadata.MD
+	err      error
+}
+
+func (f *fakeMetricsService) Export(ctx context.Context, req *collectorpb.ExportMetricsServiceRequest, opts ...grpc.CallOption) (*collectorpb.ExportMetricsServiceResponse, error) {
+	f.req = req
+	f.metadata, _ = metadata.FromOutgoingContext(ctx)
+	return &collectorpb.ExportMetricsServiceResponse{}, f.err
+}
+
+func gauge(name, unit string, value float64, timestamp time.Time, attributes ...string) *metricspb.Metric {
+	point := &metricspb.NumberDataPoint{TimeUnixNano: uint64(timestamp.UnixNano()), Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: value}}
+	for i := 0; i < len(attributes); i += 2 {
+		point.Attributes = append(point.Attributes, stringAttribute(attributes[i], attributes[i+1]))
+	}
+	return &metricspb.Metric{Name: name, Unit: unit, Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{point}}}}
+}
+
+func TestOTLP(t *testing.T) {
+	service := &fakeMetricsService{}
+	o := newOTLP(OTLPConfig{
+		Headers:            map[string]string{"authorization": "Bearer secret"},
+		ResourceAttributes: map[string]string{"k8s.cluster.name": "prod"},
+	}, service)
+	start := time.Unix(1600000000, 0)
+	if err := o.send(context.Background(), testSnapshot(start)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := service.metadata.Get("authorization"); len(got) != 1 || got[0] != "Bearer secret" {
+		t.Errorf("Unexpected authorization metadata %q", got)
+	}
+	if len(service.req.ResourceMetrics) != 1 {
+		t.Fatalf("Unexpected resource metrics count %d, want 1", len(service.req.ResourceMetrics))
+	}
+	rm := service.req.ResourceMetrics[0]
+	wantAttributes := []*commonpb.KeyValue{stringAttribute("k8s.cluster.name", "prod"), stringAttribute("service.name", "metrics-server")}
+	if diff := cmp.Diff(wantAttributes, rm.Resource.Attributes, protocmp.Transform()); diff != "" {
+		t.Errorf("Unexpected resource attributes, diff:\n%s", diff)
+	}
+	timestamp := start.Add(20 * time.Second)
+	want := []*metricspb.Metric{
+		gauge(otlpNodeCPU, "{cpu}", 2, timestamp, "k8s.node.name", "node1"),
+		gauge(otlpNodeMemory, "By", 2048, timestamp, "k8s.node.name", "node1"),
+		gauge(otlpContainerCPU, "{cpu}", 0.5, timestamp, "k8s.namespace.name", "ns1", "k8s.pod.name", "pod1", "k8s.container.name", "app"),
+		gauge(otlpContainerMemory, "By", 1024, timestamp, "k8s.namespace.name", "ns1", "k8s.pod.name", "pod1", "k8s.container.name", "app"),
+	}
+	if diff := cmp.Diff(want, rm.ScopeMetrics[0].Metrics, protocmp.Transform()); diff != "" {
+		t.Errorf("Unexpected metrics, diff:\n%s", diff)
+	}
+
+	service.err = errors.New("unavailable")
+	if err := o.send(context.Background(), testSnapshot(start)); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestOTLP_SelfMetrics(t *testing.T) {
+	registry := metrics.NewKubeRegistry()
+	counter := metrics.NewCounterVec(&metrics.CounterOpts{Name: "test_requests_total", Help: "Test counter"}, []string{"result"})
+	histogram := metrics.NewHistogram(&metrics.HistogramOpts{Name: "test_duration_seconds", Help: "Test histogram", Buckets: []float64{1, 2}})
+	registry.MustRegister(counter, histogram)
+	counter.WithLabelValues("success").Add(3)
+	for _, v := range []float64{0.5, 1.5, 1.5, 5} {
+		histogram.Observe(v)
+	}
+
+	start := time.Unix(1600000000, 0)
+	now := start.Add(time.Minute)
+	o := newOTLP(OTLPConfig{Gatherers: []metrics.Gatherer{registry}}, &fakeMetricsService{})
+	o.start = start
+	sum := 8.5
+	want := []*metricspb.Metric{
+		{
+			Name:        "test_duration_seconds",
+			Description: "[ALPHA] Test histogram",
+			Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				DataPoints: []*metricspb.HistogramDataPoint{{
+					Attributes:        []*commonpb.KeyValue{},
+					StartTimeUnixNano: uint64(start.UnixNano()),
+					TimeUnixNano:      uint64(now.UnixNano()),
+					Count:             4,
+					Sum:               &sum,
+					ExplicitBounds:    []float64{1, 2},
+					BucketCounts:      []uint64{1, 2, 1},
+				}},
+			}},
+		},
+		{
+			Name:        "test_requests_total",
+			Description: "[ALPHA] Test counter",
+			Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+				DataPoints: []*metricspb.NumberDataPoint{{
+					Attributes:        []*commonpb.KeyValue{stringAttribute("result", "success")},
+					StartTimeUnixNano: uint64(start.UnixNano()),
+					TimeUnixNano:      uint64(now.UnixNano()),
+					Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: 3},
+				}},
+			}},
+		},
+	}
+	if diff := cmp.Diff(want, o.selfMetrics(now), protocmp.Transform()); diff != "" {
+		t.Errorf("Unexpected metrics, diff:\n%s", diff)
+	}
+}
+
+func TestOTLPConfig_Validate(t *testing.T) {
+	tcs := []struct {
+		name    string
+		config  OTLPConfig
+		wantErr bool
+	}{
+		{
+			name:   "Valid",
+			config: OTLPConfig{Endpoint: "otel-collector.monitoring:4317", Timeout: time.Second},
+		},
+		{
+			name:    "URL",
+			config:  OTLPConfig{Endpoint: "http://otel-collector.monitoring:4317/v1/metrics", Timeout: time.Second},
+			wantErr: true,
+		},
+		{
+			name:    "No port",
+			config:  OTLPConfig{Endpoint: "otel-collector.monitoring", Timeout: time.Second},
+			wantErr: true,
+		},
+		{
+			name:    "No timeout",
+			config:  OTLPConfig{Endpoint: "otel-collector.monitoring:4317"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
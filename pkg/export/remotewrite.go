@@ -0,0 +1,183 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Names of series sent by the remote write exporter. They are prefixed, so
+// they don't collide with series scraped from the Kubelet resource metrics
+// endpoint, which are cumulative.
+const (
+	nodeCPUSeries         = "metrics_server_node_cpu_usage_cores"
+	nodeMemorySeries      = "metrics_server_node_memory_working_set_bytes"
+	containerCPUSeries    = "metrics_server_container_cpu_usage_cores"
+	containerMemorySeries = "metrics_server_container_memory_working_set_bytes"
+)
+
+// RemoteWriteConfig configures sending usage to a Prometheus remote write endpoint.
+type RemoteWriteConfig struct {
+	// URL of the remote write endpoint.
+	URL string
+	// Timeout of remote write requests.
+	Timeout time.Duration
+	// BearerTokenFile is the path of a file holding a token sent in the Authorization header, read on every request. Empty sends none.
+	BearerTokenFile string
+	// ExternalLabels are added to all series, e.g. to identify the cluster.
+	ExternalLabels map[string]string
+}
+
+// Validate returns an error if the endpoint URL, timeout or external labels are invalid.
+func (c RemoteWriteConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL %q should be an absolute http or https URL", c.URL)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout should be positive, but value %v provided", c.Timeout)
+	}
+	for name := range c.ExternalLabels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return fmt.Errorf("invalid external label name %q", name)
+		}
+	}
+	return nil
+}
+
+type remoteWrite struct {
+	config RemoteWriteConfig
+	client *http.Client
+}
+
+// NewRemoteWrite returns an exporter sending node and container CPU and
+// memory usage to a Prometheus remote write endpoint.
+func NewRemoteWrite(config RemoteWriteConfig) *Exporter {
+	return newExporter("remote_write", &remoteWrite{config: config, client: &http.Client{}}, config.Timeout)
+}
+
+func (w *remoteWrite) send(ctx context.Context, snapshot storage.Snapshot) error {
+	req := w.writeRequest(snapshot)
+	if len(req.Timeseries) == 0 {
+		return nil
+	}
+	data, err := req.Marshal()
+	if err != nil {
+		return fmt.Errorf("failed to encode write request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(snappy.Encode(nil, data)))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Encoding", "snappy")
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "metrics-server")
+	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.config.BearerTokenFile != "" {
+		token, err := os.ReadFile(w.config.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read bearer token: %w", err)
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("remote write failed, status: %q, body: %q", resp.Status, body)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// writeRequest returns CPU and memory usage of nodes and containers of snapshot as series.
+func (w *remoteWrite) writeRequest(snapshot storage.Snapshot) *prompb.WriteRequest {
+	nodes := snapshot.NodeMetrics()
+	pods := snapshot.PodMetrics()
+	req := &prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, 2*len(nodes)+4*len(pods))}
+	add := func(name string, quantity resource.Quantity, found bool, timestamp time.Time, labels ...string) {
+		if !found {
+			return
+		}
+		req.Timeseries = append(req.Timeseries, prompb.TimeSeries{
+			Labels:  w.labels(name, labels...),
+			Samples: []prompb.Sample{{Value: quantity.AsApproximateFloat64(), Timestamp: timestamp.UnixMilli()}},
+		})
+	}
+	for _, node := range nodes {
+		cpu, found := node.Usage[corev1.ResourceCPU]
+		add(nodeCPUSeries, cpu, found, node.Timestamp.Time, "node", node.Name)
+		memory, found := node.Usage[corev1.ResourceMemory]
+		add(nodeMemorySeries, memory, found, node.Timestamp.Time, "node", node.Name)
+	}
+	for _, pod := range pods {
+		for _, c := range pod.Containers {
+			cpu, found := c.Usage[corev1.ResourceCPU]
+			add(containerCPUSeries, cpu, found, pod.Timestamp.Time, "namespace", pod.Namespace, "pod", pod.Name, "container", c.Name)
+			memory, found := c.Usage[corev1.ResourceMemory]
+			add(containerMemorySeries, memory, found, pod.Timestamp.Time, "namespace", pod.Namespace, "pod", pod.Name, "container", c.Name)
+		}
+	}
+	return req
+}
+
+// labels returns the labels of a series sorted by name, as remote write
+// requires. Series labels take precedence over external labels.
+func (w *remoteWrite) labels(name string, pairs ...string) []prompb.Label {
+	labels := make([]prompb.Label, 0, 1+len(pairs)/2+len(w.config.ExternalLabels))
+	labels = append(labels, prompb.Label{Name: "__name__", Value: name})
+	for i := 0; i < len(pairs); i += 2 {
+		labels = append(labels, prompb.Label{Name: pairs[i], Value: pairs[i+1]})
+	}
+	for key, value := range w.config.ExternalLabels {
+		if !hasLabel(labels, key) {
+			labels = append(labels, prompb.Label{Name: key, Value: value})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+	return labels
+}
+
+func hasLabel(labels []prompb.Label, name string) bool {
+	for _, l := range labels {
+		if l.Name == name {
+			return true
+		}
+	}
+	return false
+}
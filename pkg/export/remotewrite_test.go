@@ -0,0 +1,170 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/prompb"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+func testSnapshot(start time.Time) storage.Snapshot {
+	s := storage.NewStorage(60 * time.Second)
+	pod := apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+	for i := 1; i <= 2; i++ {
+		ts := start.Add(time.Duration(i) * 10 * time.Second)
+		s.Store(&storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{
+				"node1": {StartTime: start, Timestamp: ts, CumulativeCpuUsed: uint64(i) * 20e9, MemoryUsage: 2048},
+			},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				pod: {Containers: map[string]storage.MetricsPoint{
+					"app": {StartTime: start, Timestamp: ts, CumulativeCpuUsed: uint64(i) * 5e9, MemoryUsage: 1024},
+				}},
+			},
+		})
+	}
+	return s.Snapshot()
+}
+
+func TestRemoteWrite(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		got     prompb.WriteRequest
+		headers http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := got.Unmarshal(data); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Unix(1600000000, 0)
+	w := &remoteWrite{config: RemoteWriteConfig{URL: srv.URL, BearerTokenFile: tokenFile, ExternalLabels: map[string]string{"cluster": "prod"}}, client: srv.Client()}
+	if err := w.send(context.Background(), testSnapshot(start)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for header, want := range map[string]string{
+		"Authorization":                     "Bearer secret",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	} {
+		if got := headers.Get(header); got != want {
+			t.Errorf("Unexpected %s header %q, want %q", header, got, want)
+		}
+	}
+	timestamp := start.Add(20 * time.Second).UnixMilli()
+	want := []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: nodeCPUSeries}, {Name: "cluster", Value: "prod"}, {Name: "node", Value: "node1"}},
+			Samples: []prompb.Sample{{Value: 2, Timestamp: timestamp}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: nodeMemorySeries}, {Name: "cluster", Value: "prod"}, {Name: "node", Value: "node1"}},
+			Samples: []prompb.Sample{{Value: 2048, Timestamp: timestamp}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: containerCPUSeries}, {Name: "cluster", Value: "prod"}, {Name: "container", Value: "app"}, {Name: "namespace", Value: "ns1"}, {Name: "pod", Value: "pod1"}},
+			Samples: []prompb.Sample{{Value: 0.5, Timestamp: timestamp}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: containerMemorySeries}, {Name: "cluster", Value: "prod"}, {Name: "container", Value: "app"}, {Name: "namespace", Value: "ns1"}, {Name: "pod", Value: "pod1"}},
+			Samples: []prompb.Sample{{Value: 1024, Timestamp: timestamp}},
+		},
+	}
+	if diff := cmp.Diff(want, got.Timeseries); diff != "" {
+		t.Errorf("Unexpected series, diff:\n%s", diff)
+	}
+}
+
+func TestRemoteWrite_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	w := &remoteWrite{config: RemoteWriteConfig{URL: srv.URL}, client: srv.Client()}
+	if err := w.send(context.Background(), testSnapshot(time.Unix(1600000000, 0))); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestRemoteWriteConfig_Validate(t *testing.T) {
+	tcs := []struct {
+		name    string
+		config  RemoteWriteConfig
+		wantErr bool
+	}{
+		{
+			name:   "Valid",
+			config: RemoteWriteConfig{URL: "https://prometheus.example.com/api/v1/write", Timeout: time.Second, ExternalLabels: map[string]string{"cluster": "prod"}},
+		},
+		{
+			name:    "Relative URL",
+			config:  RemoteWriteConfig{URL: "/api/v1/write", Timeout: time.Second},
+			wantErr: true,
+		},
+		{
+			name:    "No timeout",
+			config:  RemoteWriteConfig{URL: "https://prometheus.example.com/api/v1/write"},
+			wantErr: true,
+		},
+		{
+			name:    "Reserved label",
+			config:  RemoteWriteConfig{URL: "https://prometheus.example.com/api/v1/write", Timeout: time.Second, ExternalLabels: map[string]string{"__name__": "usage"}},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid label",
+			config:  RemoteWriteConfig{URL: "https://prometheus.example.com/api/v1/write", Timeout: time.Second, ExternalLabels: map[string]string{"cluster-name": "prod"}},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package features defines feature gates of metrics-server. Experimental
+// subsystems ship disabled behind an Alpha gate and are enabled per cluster
+// with --feature-gates, e.g. --feature-gates=NodeSharding=true.
+package features
+
+import (
+	"k8s.io/apimachinery/pkg/util/runtime"
+	utilfeature "k8s.io/apiserver/pkg/util/feature"
+	"k8s.io/component-base/featuregate"
+	logsapi "k8s.io/component-base/logs/api/v1"
+)
+
+const (
+	// MetricsHistory serves recent scrapes with the history subresource of
+	// NodeMetrics and PodMetrics, kept with --metric-history-length.
+	MetricsHistory featuregate.Feature = "MetricsHistory"
+
+	// NodeSharding splits nodes between replicas of a StatefulSet with --shard-count.
+	NodeSharding featuregate.Feature = "NodeSharding"
+
+	// CRIMetricsSource reads metrics of the local node from the container
+	// runtime with --metrics-source=cri.
+	CRIMetricsSource featuregate.Feature = "CRIMetricsSource"
+
+	// PrometheusMetricsSource serves usage queried from Prometheus with --prometheus-url.
+	PrometheusMetricsSource featuregate.Feature = "PrometheusMetricsSource"
+
+	// MetricsAvailableCondition sets the MetricsAvailable condition of scraped
+	// nodes with --node-condition-failure-threshold.
+	MetricsAvailableCondition featuregate.Feature = "MetricsAvailableCondition"
+)
+
+// defaultFeatureGates lists metrics-server feature gates. To add a gate, add
+// it here with its default and pre-release stage, and check it with Enabled.
+var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
+	MetricsHistory:            {Default: false, PreRelease: featuregate.Alpha},
+	NodeSharding:              {Default: false, PreRelease: featuregate.Alpha},
+	CRIMetricsSource:          {Default: false, PreRelease: featuregate.Alpha},
+	PrometheusMetricsSource:   {Default: false, PreRelease: featuregate.Alpha},
+	MetricsAvailableCondition: {Default: false, PreRelease: featuregate.Alpha},
+}
+
+func init() {
+	// Gates are registered with those of the generic apiserver and of
+	// logging, so all are set with a single --feature-gates flag.
+	runtime.Must(utilfeature.DefaultMutableFeatureGate.Add(defaultFeatureGates))
+	runtime.Must(logsapi.AddFeatureGates(utilfeature.DefaultMutableFeatureGate))
+}
+
+// Enabled returns true if feature is enabled.
+func Enabled(feature featuregate.Feature) bool {
+	return utilfeature.DefaultFeatureGate.Enabled(feature)
+}
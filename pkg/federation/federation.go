@@ -0,0 +1,288 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package federation merges node and pod metrics of member clusters, read
+// from their metrics.k8s.io API, with the metrics of the local cluster, so
+// fleet dashboards and multi-cluster schedulers query a single endpoint.
+// Member clusters are polled every sync interval, so queries never fan out
+// to members. Merged objects are labeled with the name of their cluster.
+package federation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+	metricsv1beta1 "k8s.io/metrics/pkg/client/clientset/versioned/typed/metrics/v1beta1"
+)
+
+// ClusterLabel is set on merged NodeMetrics and PodMetrics to the name of their cluster.
+const ClusterLabel = "metrics.k8s.io/cluster"
+
+// staleSyncs is the number of sync intervals after which metrics of a member failing to sync are dropped.
+const staleSyncs = 3
+
+var (
+	memberUp = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "federation",
+			Name:      "member_up",
+			Help:      "Whether the last sync of metrics of a member cluster succeeded, per cluster",
+		},
+		[]string{"cluster"},
+	)
+	memberLastSync = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "federation",
+			Name:      "member_last_sync_timestamp_seconds",
+			Help:      "Unix time in seconds of the last successful sync of metrics of a member cluster, per cluster",
+		},
+		[]string{"cluster"},
+	)
+)
+
+// RegisterFederationMetrics registers metrics of member cluster syncs.
+func RegisterFederationMetrics(registrationFunc func(metrics.Registerable) error) error {
+	for _, metric := range []metrics.Registerable{memberUp, memberLastSync} {
+		if err := registrationFunc(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Member is a cluster whose metrics are merged.
+type Member struct {
+	Name   string
+	Client metricsv1beta1.MetricsV1beta1Interface
+}
+
+// LoadMembers returns a Member for every context of the kubeconfig file at
+// path, named after the context, sorted by name.
+func LoadMembers(path string) ([]Member, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load federation kubeconfig: %v", err)
+	}
+	members := make([]Member, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		if errs := validation.IsValidLabelValue(name); len(errs) != 0 {
+			return nil, fmt.Errorf("context %q of federation kubeconfig isn't a valid cluster name: %s", name, strings.Join(errs, ", "))
+		}
+		rest, err := clientcmd.NewNonInteractiveClientConfig(*config, name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("invalid context %q of federation kubeconfig: %v", name, err)
+		}
+		client, err := metricsclientset.NewForConfig(rest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct metrics client of cluster %q: %v", name, err)
+		}
+		members = append(members, Member{Name: name, Client: client.MetricsV1beta1()})
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("federation kubeconfig %q has no context", path)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members, nil
+}
+
+// LocalSource returns the metrics of the local cluster.
+type LocalSource func() ([]v1beta1.NodeMetrics, []v1beta1.PodMetrics)
+
+// Federator polls metrics of member clusters and merges them with the ones of the local cluster.
+type Federator struct {
+	local    string
+	source   LocalSource
+	members  []Member
+	interval time.Duration
+
+	mu     sync.RWMutex
+	synced map[string]memberMetrics
+}
+
+// memberMetrics are the metrics of a member cluster read in its last successful sync.
+type memberMetrics struct {
+	nodes []v1beta1.NodeMetrics
+	pods  []v1beta1.PodMetrics
+	time  time.Time
+}
+
+// New returns a Federator serving metrics of source as the ones of the local
+// cluster, and polling members every interval. Members can't be named like
+// the local cluster.
+func New(local string, source LocalSource, members []Member, interval time.Duration) (*Federator, error) {
+	for _, m := range members {
+		if m.Name == local {
+			return nil, fmt.Errorf("member cluster %q is named like the local cluster", m.Name)
+		}
+	}
+	return &Federator{
+		local:    local,
+		source:   source,
+		members:  members,
+		interval: interval,
+		synced:   map[string]memberMetrics{},
+	}, nil
+}
+
+// Run syncs metrics of members every interval until ctx is done.
+func (f *Federator) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		f.sync(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync reads metrics of all members concurrently.
+func (f *Federator) sync(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, f.interval)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, m := range f.members {
+		wg.Add(1)
+		go func(m Member) {
+			defer wg.Done()
+			synced, err := read(ctx, m.Client)
+			if err != nil {
+				memberUp.WithLabelValues(m.Name).Set(0)
+				klog.ErrorS(err, "Failed to sync metrics of member cluster", "cluster", m.Name)
+				return
+			}
+			memberUp.WithLabelValues(m.Name).Set(1)
+			memberLastSync.WithLabelValues(m.Name).Set(float64(synced.time.Unix()))
+			klog.V(2).InfoS("Synced metrics of member cluster", "cluster", m.Name, "nodeCount", len(synced.nodes), "podCount", len(synced.pods))
+			f.mu.Lock()
+			f.synced[m.Name] = synced
+			f.mu.Unlock()
+		}(m)
+	}
+	wg.Wait()
+}
+
+func read(ctx context.Context, client metricsv1beta1.MetricsV1beta1Interface) (memberMetrics, error) {
+	nodes, err := client.NodeMetricses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return memberMetrics{}, fmt.Errorf("unable to list node metrics: %w", err)
+	}
+	pods, err := client.PodMetricses(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return memberMetrics{}, fmt.Errorf("unable to list pod metrics: %w", err)
+	}
+	return memberMetrics{nodes: nodes.Items, pods: pods.Items, time: time.Now()}, nil
+}
+
+// fresh returns metrics of members synced within staleSyncs intervals, by cluster.
+func (f *Federator) fresh() map[string]memberMetrics {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	res := make(map[string]memberMetrics, len(f.synced))
+	for name, synced := range f.synced {
+		if time.Since(synced.time) <= staleSyncs*f.interval {
+			res[name] = synced
+		}
+	}
+	return res
+}
+
+// Nodes returns NodeMetrics of cluster, or of all clusters if empty, sorted by cluster and name.
+func (f *Federator) Nodes(cluster string) []v1beta1.NodeMetrics {
+	var res []v1beta1.NodeMetrics
+	if cluster == "" || cluster == f.local {
+		nodes, _ := f.source()
+		res = appendNodes(res, f.local, nodes)
+	}
+	members := f.fresh()
+	for _, m := range f.members {
+		if cluster == "" || cluster == m.Name {
+			res = appendNodes(res, m.Name, members[m.Name].nodes)
+		}
+	}
+	return res
+}
+
+// Pods returns PodMetrics of cluster, or of all clusters if empty, in
+// namespace, or all namespaces if empty, sorted by cluster, namespace and name.
+func (f *Federator) Pods(cluster, namespace string) []v1beta1.PodMetrics {
+	var res []v1beta1.PodMetrics
+	if cluster == "" || cluster == f.local {
+		_, pods := f.source()
+		res = appendPods(res, f.local, namespace, pods)
+	}
+	members := f.fresh()
+	for _, m := range f.members {
+		if cluster == "" || cluster == m.Name {
+			res = appendPods(res, m.Name, namespace, members[m.Name].pods)
+		}
+	}
+	return res
+}
+
+func appendNodes(res []v1beta1.NodeMetrics, cluster string, nodes []v1beta1.NodeMetrics) []v1beta1.NodeMetrics {
+	start := len(res)
+	for _, node := range nodes {
+		node.ObjectMeta = labeled(node.ObjectMeta, cluster)
+		res = append(res, node)
+	}
+	added := res[start:]
+	sort.Slice(added, func(i, j int) bool { return added[i].Name < added[j].Name })
+	return res
+}
+
+func appendPods(res []v1beta1.PodMetrics, cluster, namespace string, pods []v1beta1.PodMetrics) []v1beta1.PodMetrics {
+	start := len(res)
+	for _, pod := range pods {
+		if namespace != "" && pod.Namespace != namespace {
+			continue
+		}
+		pod.ObjectMeta = labeled(pod.ObjectMeta, cluster)
+		res = append(res, pod)
+	}
+	added := res[start:]
+	sort.Slice(added, func(i, j int) bool {
+		if added[i].Namespace != added[j].Namespace {
+			return added[i].Namespace < added[j].Namespace
+		}
+		return added[i].Name < added[j].Name
+	})
+	return res
+}
+
+// labeled returns a copy of meta with ClusterLabel set to cluster, without modifying labels of meta.
+func labeled(meta metav1.ObjectMeta, cluster string) metav1.ObjectMeta {
+	labels := make(map[string]string, len(meta.Labels)+1)
+	for k, v := range meta.Labels {
+		labels[k] = v
+	}
+	labels[ClusterLabel] = cluster
+	meta.Labels = labels
+	return meta
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package federation
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	"k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+func node(name string, labels map[string]string) v1beta1.NodeMetrics {
+	return v1beta1.NodeMetrics{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func pod(namespace, name string, labels map[string]string) v1beta1.PodMetrics {
+	return v1beta1.PodMetrics{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+}
+
+func cluster(name string) map[string]string {
+	return map[string]string{ClusterLabel: name}
+}
+
+func names(nodes []v1beta1.NodeMetrics, pods []v1beta1.PodMetrics) []string {
+	var res []string
+	for _, n := range nodes {
+		res = append(res, n.Labels[ClusterLabel]+"/"+n.Name)
+	}
+	for _, p := range pods {
+		res = append(res, p.Labels[ClusterLabel]+"/"+p.Namespace+"/"+p.Name)
+	}
+	return res
+}
+
+func testFederator(t *testing.T) *Federator {
+	t.Helper()
+	west := fake.NewSimpleClientset()
+	for _, n := range []v1beta1.NodeMetrics{node("node2", nil), node("node1", map[string]string{"zone": "a"})} {
+		n := n
+		if err := west.Tracker().Create(v1beta1.SchemeGroupVersion.WithResource("nodes"), &n, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []v1beta1.PodMetrics{pod("ns2", "pod1", nil), pod("ns1", "pod2", nil)} {
+		p := p
+		if err := west.Tracker().Create(v1beta1.SchemeGroupVersion.WithResource("pods"), &p, p.Namespace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	east := fake.NewSimpleClientset()
+	east.PrependReactor("list", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	local := func() ([]v1beta1.NodeMetrics, []v1beta1.PodMetrics) {
+		return []v1beta1.NodeMetrics{node("node1", nil)}, []v1beta1.PodMetrics{pod("ns1", "pod1", nil)}
+	}
+	f, err := New("local", local, []Member{{Name: "east", Client: east.MetricsV1beta1()}, {Name: "west", Client: west.MetricsV1beta1()}}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.sync(context.Background())
+	return f
+}
+
+func TestFederator(t *testing.T) {
+	f := testFederator(t)
+	tcs := []struct {
+		name      string
+		cluster   string
+		namespace string
+		want      []string
+	}{
+		{
+			name: "All clusters",
+			want: []string{"local/node1", "west/node1", "west/node2", "local/ns1/pod1", "west/ns1/pod2", "west/ns2/pod1"},
+		},
+		{
+			name:    "Local cluster",
+			cluster: "local",
+			want:    []string{"local/node1", "local/ns1/pod1"},
+		},
+		{
+			name:    "Member cluster",
+			cluster: "west",
+			want:    []string{"west/node1", "west/node2", "west/ns1/pod2", "west/ns2/pod1"},
+		},
+		{
+			name:      "Namespace",
+			namespace: "ns1",
+			want:      []string{"local/node1", "west/node1", "west/node2", "local/ns1/pod1", "west/ns1/pod2"},
+		},
+		{
+			name:    "Failing member",
+			cluster: "east",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := names(f.Nodes(tc.cluster), f.Pods(tc.cluster, tc.namespace))
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected metrics, diff:\n%s", diff)
+			}
+		})
+	}
+	nodes := f.Nodes("west")
+	if diff := cmp.Diff(map[string]string{"zone": "a", ClusterLabel: "west"}, nodes[0].Labels); diff != "" {
+		t.Errorf("Unexpected labels, diff:\n%s", diff)
+	}
+}
+
+func TestFederator_StaleMember(t *testing.T) {
+	f := testFederator(t)
+	f.mu.Lock()
+	synced := f.synced["west"]
+	synced.time = synced.time.Add(-staleSyncs*f.interval - time.Second)
+	f.synced["west"] = synced
+	f.mu.Unlock()
+	if got := names(f.Nodes("west"), f.Pods("west", "")); len(got) != 0 {
+		t.Errorf("Expected no metrics of stale member, got %v", got)
+	}
+}
+
+func TestNew_LocalName(t *testing.T) {
+	local := func() ([]v1beta1.NodeMetrics, []v1beta1.PodMetrics) { return nil, nil }
+	if _, err := New("local", local, []Member{{Name: "local"}}, time.Minute); err == nil {
+		t.Error("Expected error for member named like the local cluster")
+	}
+}
+
+func TestLoadMembers(t *testing.T) {
+	tcs := []struct {
+		name       string
+		kubeconfig string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name: "Context per member",
+			kubeconfig: `
+apiVersion: v1
+kind: Config
+clusters:
+- name: west
+  cluster: {server: "https://west.example.com"}
+- name: east
+  cluster: {server: "https://east.example.com"}
+users:
+- name: metrics-reader
+  user: {token: secret}
+contexts:
+- name: west
+  context: {cluster: west, user: metrics-reader}
+- name: east
+  context: {cluster: east, user: metrics-reader}
+`,
+			want: []string{"east", "west"},
+		},
+		{
+			name: "Invalid context name",
+			kubeconfig: `
+apiVersion: v1
+kind: Config
+clusters:
+- name: west
+  cluster: {server: "https://west.example.com"}
+contexts:
+- name: eu west
+  context: {cluster: west}
+`,
+			wantErr: true,
+		},
+		{
+			name:       "No context",
+			kubeconfig: "apiVersion: v1\nkind: Config\n",
+			wantErr:    true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "members.kubeconfig")
+			if err := os.WriteFile(path, []byte(tc.kubeconfig), 0600); err != nil {
+				t.Fatal(err)
+			}
+			members, err := LoadMembers(path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var got []string
+			for _, m := range members {
+				got = append(got, m.Name)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected members, diff:\n%s", diff)
+			}
+		})
+	}
+}
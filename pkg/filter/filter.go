@@ -0,0 +1,125 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filter excludes nodes and pods from scrapes and served metrics
+// according to rules that can be replaced at runtime, e.g. to stop scraping
+// a misbehaving namespace during an incident without a rollout.
+package filter
+
+import (
+	"fmt"
+	"path"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+)
+
+// Config holds filter rules. Nodes and pods not excluded by any rule are kept.
+type Config struct {
+	// NodeSelector is a label selector nodes must match to be scraped and served.
+	NodeSelector string `json:"nodeSelector,omitempty"`
+	// ExcludeNamespaces lists namespaces whose pods are neither stored nor served.
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+	// ExcludePods lists namespace/name patterns, in the path.Match syntax, of
+	// pods neither stored nor served, e.g. "batch/report-*".
+	ExcludePods []string `json:"excludePods,omitempty"`
+}
+
+// Rules applies a validated Config. A nil Rules keeps everything.
+type Rules struct {
+	nodeSelector      labels.Selector
+	excludeNamespaces map[string]struct{}
+	excludePods       []string
+}
+
+// Parse decodes a Config in YAML or JSON from data and validates it.
+func Parse(data []byte) (*Rules, error) {
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to decode filter config: %w", err)
+	}
+	return New(config)
+}
+
+// New validates config and returns its Rules.
+func New(config Config) (*Rules, error) {
+	r := &Rules{nodeSelector: labels.Everything()}
+	if config.NodeSelector != "" {
+		selector, err := labels.Parse(config.NodeSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node selector %q: %w", config.NodeSelector, err)
+		}
+		r.nodeSelector = selector
+	}
+	if len(config.ExcludeNamespaces) != 0 {
+		r.excludeNamespaces = make(map[string]struct{}, len(config.ExcludeNamespaces))
+		for _, ns := range config.ExcludeNamespaces {
+			r.excludeNamespaces[ns] = struct{}{}
+		}
+	}
+	for _, pattern := range config.ExcludePods {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pod pattern %q: %w", pattern, err)
+		}
+	}
+	r.excludePods = config.ExcludePods
+	return r, nil
+}
+
+// KeepNode returns true if node should be scraped and its metrics served.
+func (r *Rules) KeepNode(node *corev1.Node) bool {
+	if r == nil {
+		return true
+	}
+	return r.nodeSelector.Matches(labels.Set(node.Labels))
+}
+
+// KeepPod returns true if metrics of the pod should be stored and served.
+func (r *Rules) KeepPod(namespace, name string) bool {
+	if r == nil {
+		return true
+	}
+	if _, found := r.excludeNamespaces[namespace]; found {
+		return false
+	}
+	ref := namespace + "/" + name
+	for _, pattern := range r.excludePods {
+		if matched, _ := path.Match(pattern, ref); matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Dynamic applies the latest Rules set, it is safe for concurrent use.
+type Dynamic struct {
+	rules atomic.Pointer[Rules]
+}
+
+// Set replaces the applied rules, nil keeps everything.
+func (d *Dynamic) Set(rules *Rules) {
+	d.rules.Store(rules)
+}
+
+// KeepNode returns true if node should be scraped and its metrics served.
+func (d *Dynamic) KeepNode(node *corev1.Node) bool {
+	return d.rules.Load().KeepNode(node)
+}
+
+// KeepPod returns true if metrics of the pod should be stored and served.
+func (d *Dynamic) KeepPod(namespace, name string) bool {
+	return d.rules.Load().KeepPod(namespace, name)
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRules(t *testing.T) {
+	config := `
+nodeSelector: pool!=noisy
+excludeNamespaces: [batch]
+excludePods: ["web/canary-*"]
+`
+	rules, err := Parse([]byte(config))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	nodes := []struct {
+		labels map[string]string
+		want   bool
+	}{
+		{labels: nil, want: true},
+		{labels: map[string]string{"pool": "default"}, want: true},
+		{labels: map[string]string{"pool": "noisy"}, want: false},
+	}
+	for _, tc := range nodes {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: tc.labels}}
+		if got := rules.KeepNode(node); got != tc.want {
+			t.Errorf("KeepNode(%v) = %v, want %v", tc.labels, got, tc.want)
+		}
+	}
+	pods := []struct {
+		namespace, name string
+		want            bool
+	}{
+		{namespace: "web", name: "frontend", want: true},
+		{namespace: "web", name: "canary-1", want: false},
+		{namespace: "api", name: "canary-1", want: true},
+		{namespace: "batch", name: "report", want: false},
+	}
+	for _, tc := range pods {
+		if got := rules.KeepPod(tc.namespace, tc.name); got != tc.want {
+			t.Errorf("KeepPod(%s/%s) = %v, want %v", tc.namespace, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tcs := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "Unknown field",
+			config: "excludeNamespace: [batch]",
+		},
+		{
+			name:   "Invalid node selector",
+			config: "nodeSelector: 'pool in (a'",
+		},
+		{
+			name:   "Invalid pod pattern",
+			config: "excludePods: ['web/[']",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tc.config)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestDynamic(t *testing.T) {
+	d := &Dynamic{}
+	if !d.KeepPod("batch", "report") {
+		t.Error("Expected pods to be kept without rules")
+	}
+	rules, err := New(Config{ExcludeNamespaces: []string{"batch"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	d.Set(rules)
+	if d.KeepPod("batch", "report") {
+		t.Error("Expected pod of excluded namespace to be dropped")
+	}
+	d.Set(nil)
+	if !d.KeepPod("batch", "report") {
+		t.Error("Expected pods to be kept once rules are cleared")
+	}
+}
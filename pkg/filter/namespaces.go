@@ -0,0 +1,139 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Namespaces keeps pods of allowed namespaces. Nodes are always kept.
+type Namespaces struct {
+	// include lists the only namespaces kept, all namespaces if empty.
+	include map[string]struct{}
+	exclude map[string]struct{}
+}
+
+var _ storage.Filter = (*Namespaces)(nil)
+
+// NewNamespaces returns a filter keeping pods of namespaces in include, or of
+// all namespaces if it's empty, except those in exclude. It returns nil if both
+// lists are empty.
+func NewNamespaces(include, exclude []string) (*Namespaces, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	n := &Namespaces{}
+	var err error
+	if n.include, err = namespaceSet(include); err != nil {
+		return nil, err
+	}
+	if n.exclude, err = namespaceSet(exclude); err != nil {
+		return nil, err
+	}
+	for ns := range n.exclude {
+		if _, found := n.include[ns]; found {
+			return nil, fmt.Errorf("namespace %q is both included and excluded", ns)
+		}
+	}
+	return n, nil
+}
+
+func namespaceSet(namespaces []string) (map[string]struct{}, error) {
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+	set := make(map[string]struct{}, len(namespaces))
+	for _, ns := range namespaces {
+		if errs := validation.IsDNS1123Label(ns); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+		set[ns] = struct{}{}
+	}
+	return set, nil
+}
+
+// KeepNode implements storage.Filter, all nodes are kept.
+func (n *Namespaces) KeepNode(*corev1.Node) bool {
+	return true
+}
+
+// KeepPod implements storage.Filter.
+func (n *Namespaces) KeepPod(namespace, _ string) bool {
+	if n == nil {
+		return true
+	}
+	if _, found := n.exclude[namespace]; found {
+		return false
+	}
+	if n.include == nil {
+		return true
+	}
+	_, found := n.include[namespace]
+	return found
+}
+
+// DynamicNamespaces applies the latest Namespaces set, it is safe for concurrent use.
+type DynamicNamespaces struct {
+	namespaces atomic.Pointer[Namespaces]
+}
+
+var _ storage.Filter = (*DynamicNamespaces)(nil)
+
+// Set replaces the applied namespaces, nil keeps all namespaces.
+func (d *DynamicNamespaces) Set(namespaces *Namespaces) {
+	d.namespaces.Store(namespaces)
+}
+
+// KeepNode implements storage.Filter, all nodes are kept.
+func (d *DynamicNamespaces) KeepNode(*corev1.Node) bool {
+	return true
+}
+
+// KeepPod implements storage.Filter.
+func (d *DynamicNamespaces) KeepPod(namespace, name string) bool {
+	return d.namespaces.Load().KeepPod(namespace, name)
+}
+
+// All keeps nodes and pods kept by all its filters.
+type All []storage.Filter
+
+var _ storage.Filter = All(nil)
+
+// KeepNode implements storage.Filter.
+func (a All) KeepNode(node *corev1.Node) bool {
+	for _, f := range a {
+		if !f.KeepNode(node) {
+			return false
+		}
+	}
+	return true
+}
+
+// KeepPod implements storage.Filter.
+func (a All) KeepPod(namespace, name string) bool {
+	for _, f := range a {
+		if !f.KeepPod(namespace, name) {
+			return false
+		}
+	}
+	return true
+}
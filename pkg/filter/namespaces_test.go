@@ -0,0 +1,137 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNamespaces(t *testing.T) {
+	tcs := []struct {
+		name             string
+		include, exclude []string
+		wantNil          bool
+		wantErr          bool
+		kept, dropped    []string
+	}{
+		{
+			name:    "No lists",
+			wantNil: true,
+		},
+		{
+			name:    "Excluded namespaces",
+			exclude: []string{"kube-system"},
+			kept:    []string{"default", "tenant-a"},
+			dropped: []string{"kube-system"},
+		},
+		{
+			name:    "Included namespaces",
+			include: []string{"tenant-a", "tenant-b"},
+			kept:    []string{"tenant-a", "tenant-b"},
+			dropped: []string{"default", "kube-system"},
+		},
+		{
+			name:    "Included and excluded namespaces",
+			include: []string{"tenant-a"},
+			exclude: []string{"kube-system"},
+			kept:    []string{"tenant-a"},
+			dropped: []string{"default", "kube-system"},
+		},
+		{
+			name:    "Invalid namespace",
+			exclude: []string{"Kube_System"},
+			wantErr: true,
+		},
+		{
+			name:    "Namespace both included and excluded",
+			include: []string{"tenant-a"},
+			exclude: []string{"tenant-a"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := NewNamespaces(tc.include, tc.exclude)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if (n == nil) != tc.wantNil {
+				t.Fatalf("Unexpected filter %v", n)
+			}
+			if !n.KeepNode(&corev1.Node{}) {
+				t.Error("Expected nodes to be kept")
+			}
+			for _, ns := range tc.kept {
+				if !n.KeepPod(ns, "pod") {
+					t.Errorf("Expected pods of namespace %q to be kept", ns)
+				}
+			}
+			for _, ns := range tc.dropped {
+				if n.KeepPod(ns, "pod") {
+					t.Errorf("Expected pods of namespace %q to be dropped", ns)
+				}
+			}
+		})
+	}
+}
+
+func TestDynamicNamespaces(t *testing.T) {
+	d := &DynamicNamespaces{}
+	if !d.KeepPod("kube-system", "pod") {
+		t.Error("Expected pods to be kept before namespaces are set")
+	}
+	n, err := NewNamespaces(nil, []string{"kube-system"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Set(n)
+	if d.KeepPod("kube-system", "pod") || !d.KeepPod("default", "pod") {
+		t.Error("Expected pods of excluded namespaces to be dropped")
+	}
+	d.Set(nil)
+	if !d.KeepPod("kube-system", "pod") {
+		t.Error("Expected pods to be kept after namespaces are cleared")
+	}
+}
+
+func TestAll(t *testing.T) {
+	namespaces, err := NewNamespaces(nil, []string{"kube-system"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rules, err := New(Config{NodeSelector: "pool!=noisy", ExcludePods: []string{"web/canary-*"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	all := All{namespaces, rules}
+	if all.KeepNode(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"pool": "noisy"}}}) {
+		t.Error("Expected node dropped by rules to be dropped")
+	}
+	if !all.KeepNode(&corev1.Node{}) {
+		t.Error("Expected node kept by all filters to be kept")
+	}
+	if all.KeepPod("kube-system", "coredns") || all.KeepPod("web", "canary-1") {
+		t.Error("Expected pods dropped by any filter to be dropped")
+	}
+	if !all.KeepPod("web", "frontend") {
+		t.Error("Expected pod kept by all filters to be kept")
+	}
+}
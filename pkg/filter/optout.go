@@ -0,0 +1,60 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// ScrapeAnnotation set to "false" on a pod opts it out of metrics collection,
+// its metrics are neither stored nor served.
+const ScrapeAnnotation = "metrics.k8s.io/scrape"
+
+// OptOut drops pods opted out of metrics collection with ScrapeAnnotation.
+// Nodes are always kept.
+type OptOut struct {
+	// pods lists metadata of pods.
+	pods cache.GenericLister
+}
+
+var _ storage.Filter = (*OptOut)(nil)
+
+// NewOptOut returns a filter reading pod annotations from pods.
+func NewOptOut(pods cache.GenericLister) *OptOut {
+	return &OptOut{pods: pods}
+}
+
+// KeepNode implements storage.Filter, all nodes are kept.
+func (o *OptOut) KeepNode(*corev1.Node) bool {
+	return true
+}
+
+// KeepPod implements storage.Filter. Pods missing from the lister, e.g.
+// before it synced, are kept.
+func (o *OptOut) KeepPod(namespace, name string) bool {
+	obj, err := o.pods.ByNamespace(namespace).Get(name)
+	if err != nil {
+		return true
+	}
+	pod, err := meta.Accessor(obj)
+	if err != nil {
+		return true
+	}
+	return pod.GetAnnotations()[ScrapeAnnotation] != "false"
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestOptOut(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, pod := range []*metav1.PartialObjectMetadata{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "opted-out", Annotations: map[string]string{ScrapeAnnotation: "false"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "opted-in", Annotations: map[string]string{ScrapeAnnotation: "true"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "unannotated"}},
+	} {
+		if err := indexer.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	o := NewOptOut(cache.NewGenericLister(indexer, corev1.Resource("pods")))
+
+	if !o.KeepNode(&corev1.Node{}) {
+		t.Error("Expected nodes to be kept")
+	}
+	pods := []struct {
+		name string
+		want bool
+	}{
+		{name: "opted-out", want: false},
+		{name: "opted-in", want: true},
+		{name: "unannotated", want: true},
+		{name: "unknown", want: true},
+	}
+	for _, tc := range pods {
+		if got := o.KeepPod("ns1", tc.name); got != tc.want {
+			t.Errorf("KeepPod(ns1/%s) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Follower replicates storage of the leader into a standby's storage.
+type Follower struct {
+	storage storage.Storage
+	// tls authenticates the leader and the follower to each other.
+	tls TLSFiles
+
+	mu sync.Mutex
+	// leader is the address of the leader to follow, empty if none.
+	leader string
+	// cancel stops following the current leader.
+	cancel context.CancelFunc
+	// changed is notified when leader changes.
+	changed chan struct{}
+	// synced is true once a checkpoint of the current leader was restored.
+	synced atomic.Bool
+}
+
+// NewFollower returns a Follower storing replicated metrics into store,
+// connecting to leaders with the certificate of files.
+func NewFollower(store storage.Storage, files TLSFiles) *Follower {
+	return &Follower{
+		storage: store,
+		tls:     files,
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Follow switches replication to the leader at address, empty stops replication.
+func (f *Follower) Follow(address string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if address == f.leader {
+		return
+	}
+	f.leader = address
+	f.synced.Store(false)
+	if f.cancel != nil {
+		f.cancel()
+		f.cancel = nil
+	}
+	select {
+	case f.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Synced returns true if storage is replicated from a leader.
+func (f *Follower) Synced() bool {
+	return f.synced.Load()
+}
+
+// Run replicates storage of the followed leader until ctx is done,
+// reconnecting with exponential backoff when streams fail.
+func (f *Follower) Run(ctx context.Context) {
+	backoff := newBackoff()
+	for {
+		leader, watchCtx := f.current(ctx)
+		var retry <-chan time.Time
+		if leader != "" {
+			err := f.watch(watchCtx, leader)
+			// Backoff restarts after streams that restored a checkpoint before failing.
+			if f.synced.Swap(false) {
+				backoff = newBackoff()
+			}
+			if watchCtx.Err() == nil {
+				klog.ErrorS(err, "Failed to replicate storage from the leader", "leader", leader)
+				retry = time.After(backoff.Step())
+			}
+		}
+		select {
+		case <-retry:
+		case <-f.changed:
+			backoff = newBackoff()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func newBackoff() wait.Backoff {
+	return wait.Backoff{Duration: time.Second, Factor: 2, Steps: 6, Cap: 30 * time.Second}
+}
+
+// current returns the leader to follow and a context canceled when it changes.
+func (f *Follower) current(ctx context.Context) (string, context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cancel != nil {
+		f.cancel()
+	}
+	ctx, f.cancel = context.WithCancel(ctx)
+	return f.leader, ctx
+}
+
+// watch restores a checkpoint of leader and stores its batches until the stream ends.
+func (f *Follower) watch(ctx context.Context, leader string) error {
+	tlsConfig, err := f.tls.clientConfig()
+	if err != nil {
+		return err
+	}
+	conn, err := grpc.DialContext(ctx, leader,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize)),
+		grpc.WithUserAgent("metrics-server"),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], WatchMethod)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for first := true; ; first = false {
+		msg := &wrapperspb.BytesValue{}
+		if err := stream.RecvMsg(msg); err != nil {
+			return err
+		}
+		if first {
+			snapshot, err := storage.ReadCheckpoint(bytes.NewReader(msg.Value))
+			if err != nil {
+				return err
+			}
+			f.storage.Restore(snapshot)
+			f.synced.Store(true)
+			receivedMessages.WithLabelValues("checkpoint").Inc()
+			klog.InfoS("Restored storage replicated from the leader", "leader", leader)
+			continue
+		}
+		batch, err := storage.ReadBatch(bytes.NewReader(msg.Value))
+		if err != nil {
+			return err
+		}
+		f.storage.Store(batch)
+		receivedMessages.WithLabelValues("batch").Inc()
+	}
+}
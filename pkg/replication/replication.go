@@ -0,0 +1,220 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package replication streams storage of the scraping leader of a highly
+// available deployment to standby replicas, so a standby taking over serves
+// metrics right away instead of waiting for two scrapes.
+//
+// Standbys call the server streaming Watch method of the leader. The first
+// message of a stream is a checkpoint of the leader's storage, every
+// following message is a batch stored by the leader, both in the storage
+// checkpoint format wrapped in a BytesValue. Standbys restore the checkpoint
+// and store the batches, so they calculate the same usage as the leader.
+package replication
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+const (
+	// WatchMethod is the full gRPC method name standbys watch storage with.
+	WatchMethod = "/metricsserver.replication.v1.Replication/Watch"
+
+	// followerBuffer is the number of batches buffered per standby. Standbys
+	// falling further behind are disconnected and resync from a checkpoint.
+	followerBuffer = 4
+	// maxMessageSize bounds checkpoints received from the leader.
+	maxMessageSize = 256 << 20
+)
+
+var (
+	followers = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "replication",
+			Name:      "followers",
+			Help:      "Number of standby instances replicating storage of this instance",
+		},
+	)
+	sentMessages = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "replication",
+			Name:      "sent_messages_total",
+			Help:      "Number of checkpoints and batches sent to standby instances",
+		},
+		[]string{"type"},
+	)
+	receivedMessages = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "replication",
+			Name:      "received_messages_total",
+			Help:      "Number of checkpoints and batches received from the leader",
+		},
+		[]string{"type"},
+	)
+)
+
+// RegisterReplicationMetrics registers metrics of storage replication.
+func RegisterReplicationMetrics(registrationFunc func(metrics.Registerable) error) error {
+	for _, metric := range []metrics.Registerable{followers, sentMessages, receivedMessages} {
+		if err := registrationFunc(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replicationServer is implemented by Publisher, serviceDesc requires an interface.
+type replicationServer interface {
+	watch(stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "metricsserver.replication.v1.Replication",
+	HandlerType: (*replicationServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Watch",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+				return err
+			}
+			return srv.(replicationServer).watch(stream)
+		},
+	}},
+	Metadata: "replication",
+}
+
+// Publisher serves storage of the leader to standbys, authenticated by the
+// client certificate verification of the TLS configuration it serves with.
+type Publisher struct {
+	storage storage.Storage
+
+	mu sync.Mutex
+	// followers receive encoded batches, their channel is closed when they fall behind.
+	followers map[chan []byte]struct{}
+}
+
+// NewPublisher returns a Publisher of store.
+func NewPublisher(store storage.Storage) *Publisher {
+	return &Publisher{
+		storage:   store,
+		followers: map[chan []byte]struct{}{},
+	}
+}
+
+// Serve serves standbys on listener until ctx is done. tlsConfig should
+// require and verify client certificates, e.g. TLSFiles.ServerConfig.
+func (p *Publisher) Serve(ctx context.Context, listener net.Listener, tlsConfig *tls.Config) error {
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	server.RegisterService(&serviceDesc, p)
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+	err := server.Serve(listener)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// Publish sends batch, after it was stored, to standbys.
+func (p *Publisher) Publish(batch *storage.MetricsBatch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.followers) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	if err := storage.WriteBatch(&buf, batch); err != nil {
+		klog.ErrorS(err, "Failed to encode batch for standby instances")
+		return
+	}
+	for follower := range p.followers {
+		select {
+		case follower <- buf.Bytes():
+		default:
+			klog.InfoS("Disconnecting standby instance falling behind")
+			p.removeLocked(follower)
+		}
+	}
+}
+
+// watch streams a checkpoint followed by published batches. The follower is
+// registered before the checkpoint is taken, so batches stored meanwhile may
+// be sent twice, which storing them again tolerates, but are never missed.
+func (p *Publisher) watch(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	follower := make(chan []byte, followerBuffer)
+	p.mu.Lock()
+	p.followers[follower] = struct{}{}
+	followers.Set(float64(len(p.followers)))
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.removeLocked(follower)
+		p.mu.Unlock()
+	}()
+
+	var buf bytes.Buffer
+	if err := storage.WriteCheckpoint(&buf, p.storage.Snapshot()); err != nil {
+		return status.Errorf(codes.Internal, "failed to encode checkpoint: %v", err)
+	}
+	if err := stream.SendMsg(wrapperspb.Bytes(buf.Bytes())); err != nil {
+		return err
+	}
+	sentMessages.WithLabelValues("checkpoint").Inc()
+	for {
+		select {
+		case batch, ok := <-follower:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "standby fell behind, resync from a checkpoint")
+			}
+			if err := stream.SendMsg(wrapperspb.Bytes(batch)); err != nil {
+				return err
+			}
+			sentMessages.WithLabelValues("batch").Inc()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// removeLocked unregisters follower if it is registered, must be called with lock held.
+func (p *Publisher) removeLocked(follower chan []byte) {
+	if _, found := p.followers[follower]; !found {
+		return
+	}
+	delete(p.followers, follower)
+	close(follower)
+	followers.Set(float64(len(p.followers)))
+}
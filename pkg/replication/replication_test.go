@@ -0,0 +1,216 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+func testBatch(timestamp time.Time) *storage.MetricsBatch {
+	return &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{
+			"node1": {StartTime: timestamp.Add(-time.Hour), Timestamp: timestamp, CumulativeCpuUsed: uint64(timestamp.Unix()) * 1e9, MemoryUsage: 1 << 20},
+		},
+		WindowsNodes: map[string]bool{"node1": true},
+	}
+}
+
+// writeTLSFiles writes a new CA and a certificate it issued for ServerName to a temporary directory.
+func writeTLSFiles(t *testing.T) TLSFiles {
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "replication-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: ServerName},
+		DNSNames:     []string{ServerName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := TLSFiles{CAFile: filepath.Join(dir, "ca.crt"), CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")}
+	for path, block := range map[string]*pem.Block{
+		files.CAFile:   {Type: "CERTIFICATE", Bytes: caDER},
+		files.CertFile: {Type: "CERTIFICATE", Bytes: der},
+		files.KeyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+// serve starts a Publisher of store on a local port with the certificate of files and returns its address.
+func serve(t *testing.T, ctx context.Context, store storage.Storage, files TLSFiles) (*Publisher, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPublisher(store)
+	go p.Serve(ctx, listener, files.ServerConfig())
+	return p, listener.Addr().String()
+}
+
+func nodeTimestamp(t *testing.T, store storage.Storage) time.Time {
+	ms, err := store.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) == 0 {
+		return time.Time{}
+	}
+	return ms[0].Timestamp.Time
+}
+
+func TestReplication(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Unix(1600000000, 0)
+	leader := storage.NewStorage(time.Minute)
+	leader.Store(testBatch(start))
+	leader.Store(testBatch(start.Add(10 * time.Second)))
+	files := writeTLSFiles(t)
+	publisher, address := serve(t, ctx, leader, files)
+
+	standby := storage.NewStorage(time.Minute)
+	f := NewFollower(standby, files)
+	go f.Run(ctx)
+	f.Follow(address)
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) { return f.Synced(), nil }); err != nil {
+		t.Fatalf("Follower didn't restore a checkpoint: %v", err)
+	}
+	if got, want := nodeTimestamp(t, standby), start.Add(10*time.Second); !got.Equal(want) {
+		t.Errorf("Unexpected replicated timestamp %v, want %v", got, want)
+	}
+
+	batch := testBatch(start.Add(20 * time.Second))
+	leader.Store(batch)
+	publisher.Publish(batch)
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return nodeTimestamp(t, standby).Equal(start.Add(20 * time.Second)), nil
+	})
+	if err != nil {
+		t.Errorf("Follower didn't store the published batch: %v", err)
+	}
+	ms, err := standby.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	if err != nil || len(ms) != 1 || ms[0].Annotations[annotations.Windows] != "true" {
+		t.Errorf("Unexpected replicated node metrics %+v, err %v", ms, err)
+	}
+
+	f.Follow("")
+	if f.Synced() {
+		t.Error("Follower should not be synced after it stopped following")
+	}
+}
+
+func TestFollower_UntrustedCertificates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trusted, untrusted := writeTLSFiles(t), writeTLSFiles(t)
+	tcs := []struct {
+		name     string
+		leader   TLSFiles
+		follower TLSFiles
+	}{
+		{
+			name:     "Follower certificate issued by another CA",
+			leader:   trusted,
+			follower: TLSFiles{CAFile: trusted.CAFile, CertFile: untrusted.CertFile, KeyFile: untrusted.KeyFile},
+		},
+		{
+			name:     "Leader certificate issued by another CA",
+			leader:   TLSFiles{CAFile: trusted.CAFile, CertFile: untrusted.CertFile, KeyFile: untrusted.KeyFile},
+			follower: trusted,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, address := serve(t, ctx, storage.NewStorage(time.Minute), tc.leader)
+			f := NewFollower(storage.NewStorage(time.Minute), tc.follower)
+			if err := f.watch(ctx, address); err == nil {
+				t.Error("Expected error")
+			}
+			if f.Synced() {
+				t.Error("Follower should not be synced")
+			}
+		})
+	}
+}
+
+func TestPublisher_DisconnectsFollowerFallingBehind(t *testing.T) {
+	p := NewPublisher(storage.NewStorage(time.Minute))
+	follower := make(chan []byte, followerBuffer)
+	p.followers[follower] = struct{}{}
+	for i := 0; i <= followerBuffer; i++ {
+		p.Publish(testBatch(time.Unix(1600000000+int64(i), 0)))
+	}
+	if len(p.followers) != 0 {
+		t.Error("Follower falling behind should be removed")
+	}
+	received := 0
+	for range follower {
+		received++
+	}
+	if received != followerBuffer {
+		t.Errorf("Unexpected number of buffered batches %d, want %d", received, followerBuffer)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package replication
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// ServerName is the DNS name replication certificates are verified for. The
+// leader is reached at the address it advertises in the leader election
+// Lease, which anyone allowed to update the Lease can set, so it is only
+// trusted once it proves holding a certificate issued by the replication CA.
+const ServerName = "metrics-server-replication"
+
+// TLSFiles are the PEM files replicas authenticate each other with over
+// mutual TLS. Every replica serves and connects with a certificate issued
+// by the CA for ServerName, with both server and client auth usages. Files
+// are read on every connection, so they can be rotated.
+type TLSFiles struct {
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// Validate checks the files can be read.
+func (f TLSFiles) Validate() error {
+	_, _, err := f.load()
+	return err
+}
+
+func (f TLSFiles) load() (*x509.CertPool, tls.Certificate, error) {
+	ca, err := os.ReadFile(f.CAFile)
+	if err != nil {
+		return nil, tls.Certificate{}, fmt.Errorf("failed to read replication CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, tls.Certificate{}, fmt.Errorf("replication CA file %q has no certificates", f.CAFile)
+	}
+	cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+	if err != nil {
+		return nil, tls.Certificate{}, fmt.Errorf("failed to read replication certificate: %w", err)
+	}
+	return pool, cert, nil
+}
+
+// ServerConfig returns the TLS configuration of the leader, requiring
+// standbys to present a certificate issued by the CA.
+func (f TLSFiles) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			pool, cert, err := f.load()
+			if err != nil {
+				return nil, err
+			}
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}, nil
+		},
+	}
+}
+
+// clientConfig returns the TLS configuration of standbys, verifying the
+// leader holds a certificate issued by the CA for ServerName.
+func (f TLSFiles) clientConfig() (*tls.Config, error) {
+	pool, cert, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   ServerName,
+	}, nil
+}
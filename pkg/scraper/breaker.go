@@ -0,0 +1,171 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+// Circuit breaker states of a node.
+const (
+	// breakerClosed nodes are scraped every cycle.
+	breakerClosed = "closed"
+	// breakerOpen nodes failed consecutive scrapes and are skipped until their backoff expires.
+	breakerOpen = "open"
+	// breakerHalfOpen nodes are probed with a single scrape after their backoff expired.
+	breakerHalfOpen = "half_open"
+)
+
+var (
+	backedOffNode = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "scrape_backoff",
+			Help:      "Number of nodes skipped in the last scrape because their previous scrapes consistently failed, per node or node hash bucket",
+		},
+		[]string{"node"},
+	)
+	breakerNodes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "circuit_breaker_nodes",
+			Help:      "Number of nodes per circuit breaker state in the last scrape",
+		},
+		[]string{"state"},
+	)
+)
+
+// circuitBreaker stops scraping Kubelets failing consecutive scrapes, e.g.
+// timing out, and probes them at an exponentially decreasing rate until they
+// recover. After threshold consecutive failures a node is skipped for 1, 2, 4
+// and up to maxBackoff cycles, then scraped once to probe it.
+type circuitBreaker struct {
+	// threshold is the number of consecutive failures opening the breaker, 0 disables it.
+	threshold  int
+	maxBackoff int
+	// nodeLabels maps nodes to the node label of per-node metrics.
+	nodeLabels utils.NodeLabels
+
+	mu    sync.Mutex
+	cycle uint64
+	// failures counts consecutive failed scrapes of nodes.
+	failures map[string]int
+	// resumeCycle is the first cycle backed off nodes are probed again.
+	resumeCycle map[string]uint64
+}
+
+func (b *circuitBreaker) enabled() bool {
+	return b.threshold > 0
+}
+
+// plan returns the nodes to scrape in this cycle, skipping nodes with an open breaker.
+func (b *circuitBreaker) plan(logger klog.Logger, nodes []*corev1.Node) []*corev1.Node {
+	if !b.enabled() {
+		return nodes
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cycle++
+	b.forgetRemoved(nodes)
+	backedOffNode.Reset()
+
+	due := make([]*corev1.Node, 0, len(nodes))
+	var backedOff []*corev1.Node
+	states := map[string]int{breakerClosed: 0, breakerOpen: 0, breakerHalfOpen: 0}
+	for _, node := range nodes {
+		state := b.state(node.Name)
+		states[state]++
+		if state == breakerOpen {
+			backedOff = append(backedOff, node)
+			backedOffNode.WithLabelValues(b.nodeLabels.Label(node.Name)).Inc()
+			continue
+		}
+		due = append(due, node)
+	}
+	for state, count := range states {
+		breakerNodes.WithLabelValues(state).Set(float64(count))
+	}
+	if len(backedOff) != 0 {
+		logger.V(1).Info("Backing off scrapes of consistently failing nodes", "nodes", klog.KObjSlice(backedOff), "nodeCount", len(backedOff))
+	}
+	return due
+}
+
+// state returns the breaker state of node, must be called with lock held.
+func (b *circuitBreaker) state(node string) string {
+	switch {
+	case b.failures[node] < b.threshold:
+		return breakerClosed
+	case b.resumeCycle[node] > b.cycle:
+		return breakerOpen
+	default:
+		return breakerHalfOpen
+	}
+}
+
+// forgetRemoved drops state of nodes no longer scraped, must be called with lock held.
+func (b *circuitBreaker) forgetRemoved(nodes []*corev1.Node) {
+	present := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		present[node.Name] = struct{}{}
+	}
+	for name := range b.failures {
+		if _, found := present[name]; !found {
+			delete(b.failures, name)
+			delete(b.resumeCycle, name)
+		}
+	}
+}
+
+// observe records the result of scraping a node. A success closes its
+// breaker, a failure of a half open node doubles its backoff. logger is
+// expected to carry the node.
+func (b *circuitBreaker) observe(logger klog.Logger, node string, err error) {
+	if !b.enabled() {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		if b.failures[node] >= b.threshold {
+			logger.V(1).Info("Node recovered, resuming scrapes")
+		}
+		delete(b.failures, node)
+		delete(b.resumeCycle, node)
+		return
+	}
+	if b.failures == nil {
+		b.failures = map[string]int{}
+		b.resumeCycle = map[string]uint64{}
+	}
+	b.failures[node]++
+	failures := b.failures[node]
+	if failures < b.threshold {
+		return
+	}
+	skip := uint64(b.maxBackoff)
+	if exponent := failures - b.threshold; exponent < 63 && uint64(1)<<exponent < skip {
+		skip = uint64(1) << exponent
+	}
+	b.resumeCycle[node] = b.cycle + skip + 1
+}
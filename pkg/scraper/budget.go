@@ -0,0 +1,198 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+var deferredNode = metrics.NewGaugeVec(
+	&metrics.GaugeOpts{
+		Namespace: "metrics_server",
+		Subsystem: "kubelet",
+		Name:      "scrape_deferred",
+		Help:      "Number of nodes deferred to the next cycle in the last scrape because the scrape budget was exceeded, per node or node hash bucket",
+	},
+	[]string{"node"},
+)
+
+// scrapeBudget limits the estimated cost of a scrape cycle. Nodes are
+// admitted starting from the ones scraped longest ago, until the estimated
+// total response size or wall-clock time of the cycle would exceed the budget.
+// The remaining nodes are deferred to the next cycle and keep serving metrics
+// from their last scrape. Nodes are scraped in parallel, so each admitted node
+// is estimated to take its share of the wall-clock time of the last cycle.
+type scrapeBudget struct {
+	maxBytes    int64
+	maxDuration time.Duration
+	// nodeLabels maps nodes to the node label of per-node metrics.
+	nodeLabels utils.NodeLabels
+
+	mu          sync.Mutex
+	bytes       map[string]int64
+	lastScraped map[string]time.Time
+	// cycleDuration is the wall-clock time of the last cycle, which scraped cycleNodes nodes.
+	cycleDuration time.Duration
+	cycleNodes    int
+	// lastBatch holds batches of the last successful scrape of nodes, only
+	// kept between cycles for nodes expected to be deferred.
+	lastBatch map[string]*storage.MetricsBatch
+}
+
+func (b *scrapeBudget) enabled() bool {
+	return b.maxBytes > 0 || b.maxDuration > 0
+}
+
+// plan splits nodes into the ones to scrape in this cycle and the deferred
+// ones. Nodes without last points to serve are never deferred.
+func (b *scrapeBudget) plan(logger klog.Logger, nodes []*corev1.Node) (scrape, deferred []*corev1.Node) {
+	if !b.enabled() {
+		return nodes, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.forgetRemoved(nodes)
+	deferredNode.Reset()
+
+	names := make([]string, len(nodes))
+	byName := make(map[string]*corev1.Node, len(nodes))
+	for i, node := range nodes {
+		names[i] = node.Name
+		byName[node.Name] = node
+	}
+	admitted := b.admit(names)
+	for i, name := range names {
+		if _, found := b.lastBatch[name]; i >= admitted && found {
+			deferred = append(deferred, byName[name])
+			continue
+		}
+		scrape = append(scrape, byName[name])
+	}
+	if deferred == nil {
+		return scrape, nil
+	}
+	for _, node := range deferred {
+		deferredNode.WithLabelValues(b.nodeLabels.Label(node.Name)).Inc()
+	}
+	logger.V(1).Info("Scrape budget exceeded, deferring nodes to the next cycle", "deferredNodes", klog.KObjSlice(deferred), "deferredCount", len(deferred), "maxBytes", b.maxBytes, "maxDuration", b.maxDuration)
+	return scrape, deferred
+}
+
+// admit orders names by the time they were last scraped, oldest first, and
+// returns how many of them fit in the budget, must be called with lock held.
+func (b *scrapeBudget) admit(names []string) int {
+	sort.SliceStable(names, func(i, j int) bool {
+		ti, tj := b.lastScraped[names[i]], b.lastScraped[names[j]]
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return names[i] < names[j]
+	})
+	var share time.Duration
+	if b.cycleNodes > 0 {
+		share = b.cycleDuration / time.Duration(b.cycleNodes)
+	}
+	var (
+		bytes    int64
+		duration time.Duration
+	)
+	for i, name := range names {
+		bytes += b.bytes[name]
+		duration += share
+		// Always scrape at least one node so cycles make progress.
+		if i > 0 && ((b.maxBytes > 0 && bytes > b.maxBytes) || (b.maxDuration > 0 && duration > b.maxDuration)) {
+			return i
+		}
+	}
+	return len(names)
+}
+
+// forgetRemoved drops state of nodes no longer scraped, must be called with lock held.
+func (b *scrapeBudget) forgetRemoved(nodes []*corev1.Node) {
+	present := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		present[node.Name] = struct{}{}
+	}
+	for name := range b.lastScraped {
+		if _, found := present[name]; !found {
+			delete(b.bytes, name)
+			delete(b.lastScraped, name)
+			delete(b.lastBatch, name)
+		}
+	}
+}
+
+// observe records the response size of scraping a node and its batch if the scrape succeeded.
+func (b *scrapeBudget) observe(node string, at time.Time, bytes int64, batch *storage.MetricsBatch) {
+	if !b.enabled() {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.bytes == nil {
+		b.bytes = map[string]int64{}
+		b.lastScraped = map[string]time.Time{}
+		b.lastBatch = map[string]*storage.MetricsBatch{}
+	}
+	b.bytes[node] = bytes
+	b.lastScraped[node] = at
+	if batch != nil {
+		b.lastBatch[node] = batch
+	}
+}
+
+// deferredBatches returns batches of the last successful scrape of deferred nodes.
+func (b *scrapeBudget) deferredBatches(deferred []*corev1.Node) []*storage.MetricsBatch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batches := make([]*storage.MetricsBatch, 0, len(deferred))
+	for _, node := range deferred {
+		if batch, found := b.lastBatch[node.Name]; found {
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
+
+// finish records the wall-clock duration of a cycle scraping the given number
+// of nodes and drops batches of nodes the next cycle is expected to admit, so
+// only last points of nodes expected to be deferred are kept.
+func (b *scrapeBudget) finish(duration time.Duration, scraped int) {
+	if !b.enabled() {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if scraped > 0 {
+		b.cycleDuration = duration
+		b.cycleNodes = scraped
+	}
+	names := make([]string, 0, len(b.lastScraped))
+	for name := range b.lastScraped {
+		names = append(names, name)
+	}
+	for _, name := range names[:b.admit(names)] {
+		delete(b.lastBatch, name)
+	}
+}
@@ -15,6 +15,9 @@
 package client
 
 import (
+	"crypto/tls"
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/rest"
 )
@@ -23,7 +26,66 @@ import (
 type KubeletClientConfig struct {
 	Client              rest.Config
 	AddressTypePriority []corev1.NodeAddressType
-	Scheme              string
-	DefaultPort         int
-	UseNodeStatusPort   bool
+	// AddressResolver is the name of the registered node address resolver, utils.PriorityNodeAddressResolver if empty.
+	AddressResolver string
+	// AddressFamily is the utils.AddressFamily of node addresses used to connect to Kubelets, any family if empty.
+	AddressFamily     string
+	Scheme            string
+	DefaultPort       int
+	UseNodeStatusPort bool
+	// VolumeStats enables fetching persistent volume claim usage from the Kubelet Summary API.
+	VolumeStats bool
+	// ProcessStats enables fetching node and pod process counts from the Kubelet Summary API.
+	ProcessStats bool
+	// FilesystemStats enables fetching node filesystem and pod ephemeral storage usage from the Kubelet Summary API.
+	FilesystemStats bool
+	// MaxContainersPerNode is the number of containers above which only pod level metrics are collected from a node. 0 means no limit.
+	MaxContainersPerNode int
+	// CPUThrottling enables fetching container CPU throttling from the Kubelet cAdvisor metrics.
+	CPUThrottling bool
+	// CadvisorFallback enables filling node and container metrics missing from the Kubelet resource metrics from its cAdvisor metrics.
+	CadvisorFallback bool
+	// EgressSelectorConfigFile is the path of an EgressSelectorConfiguration whose cluster egress selection
+	// is used to dial Kubelets, e.g. through a Konnectivity server. Kubelets are dialed directly if empty.
+	EgressSelectorConfigFile string
+	// NodePoolsConfigFile is the path of a resource.NodePoolsConfig listing node pools whose Kubelets are
+	// connected to with their own CA bundle and client certificate. All Kubelets use Client if empty.
+	NodePoolsConfigFile string
+	// ClientCertificateRotation requests the client certificate presented to Kubelets from the certificates API
+	// and rotates it before it expires, instead of the static one of Client.
+	ClientCertificateRotation bool
+	// ClientCertificateDir is the directory rotated client certificates are stored in, they are kept in memory if empty.
+	ClientCertificateDir string
+	// GetClientCertificate returns the rotated client certificate presented to Kubelets, nil if none was issued yet.
+	// It is set from ClientCertificateRotation when the server is constructed.
+	GetClientCertificate func() *tls.Certificate
+	// TLSSessionCacheSize is the number of Kubelets TLS sessions are cached for to resume them when reconnecting, 0 disables resumption.
+	TLSSessionCacheSize int
+	// MaxIdleConnsPerNode is the number of idle connections kept per Kubelet, resource.DefaultMaxIdleConnsPerNode if 0.
+	MaxIdleConnsPerNode int
+	// IdleConnTimeout is how long idle connections to Kubelets are kept for reuse by the next scrapes, resource.DefaultIdleConnTimeout if 0.
+	IdleConnTimeout time.Duration
+	// ClockSkewTolerance is the Kubelet clock skew above which timestamps of its metrics are shifted to the local clock, 0 disables the correction.
+	ClockSkewTolerance time.Duration
+	// NodeLabelBuckets is the number of hash buckets node labels of per-node metrics are mapped to, 0 labels them with node names.
+	NodeLabelBuckets uint32
+	// MetricsSource selects where metrics are read from, MetricsSourceKubelet if empty.
+	MetricsSource string
+	// CRIEndpoint is the unix socket URL of the container runtime read with MetricsSourceCRI.
+	CRIEndpoint string
+	// PodResourcesEndpoint is the unix socket URL of the Kubelet pod resources API of the local node, from which
+	// devices allocated to pods are read. Devices are not collected if empty.
+	PodResourcesEndpoint string
+	// LocalEndpoint is the unix socket or loopback HTTP URL of the local Kubelet, to which all requests
+	// are sent without TLS nor node address resolution. Kubelets are reached by node address if empty.
+	LocalEndpoint string
+	// NodeName is the name of the local node, the only one scraped with MetricsSourceCRI or LocalEndpoint.
+	NodeName string
 }
+
+const (
+	// MetricsSourceKubelet reads metrics from the Kubelet resource metrics endpoint of each node.
+	MetricsSourceKubelet = "kubelet"
+	// MetricsSourceCRI reads metrics from the container runtime of the local node.
+	MetricsSourceCRI = "cri"
+)
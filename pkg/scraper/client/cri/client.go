@@ -0,0 +1,142 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cri implements a metrics source reading container stats from the
+// container runtime of the local node through the CRI API, for metrics-server
+// running as a DaemonSet where the Kubelet resource metrics endpoint is
+// incomplete or disabled.
+package cri
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Labels set by Kubelet on containers it creates.
+const (
+	podNameLabel       = "io.kubernetes.pod.name"
+	podNamespaceLabel  = "io.kubernetes.pod.namespace"
+	containerNameLabel = "io.kubernetes.container.name"
+	// sandboxContainerName is the container name of pod sandboxes of runtimes listing them as containers.
+	sandboxContainerName = "POD"
+)
+
+type criClient struct {
+	conn     *grpc.ClientConn
+	nodeName string
+	// procPath is the procfs mount node metrics are read from.
+	procPath string
+}
+
+var _ client.KubeletMetricsGetter = (*criClient)(nil)
+
+// NewForConfig returns a client reading metrics of node config.NodeName from the CRI endpoint config.CRIEndpoint.
+func NewForConfig(config *client.KubeletClientConfig) (*criClient, error) {
+	if !strings.HasPrefix(config.CRIEndpoint, "unix://") {
+		return nil, fmt.Errorf("CRI endpoint %q should be a unix socket URL", config.CRIEndpoint)
+	}
+	if config.NodeName == "" {
+		return nil, fmt.Errorf("node name is required to read metrics from CRI")
+	}
+	conn, err := grpc.Dial(config.CRIEndpoint,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to CRI endpoint %q: %w", config.CRIEndpoint, err)
+	}
+	return newClient(conn, config.NodeName, "/proc"), nil
+}
+
+func newClient(conn *grpc.ClientConn, nodeName, procPath string) *criClient {
+	return &criClient{
+		conn:     conn,
+		nodeName: nodeName,
+		procPath: procPath,
+	}
+}
+
+// GetMetrics implements client.KubeletMetricsGetter. Only the local node can be scraped.
+func (c *criClient) GetMetrics(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
+	if node.Name != c.nodeName {
+		return nil, fmt.Errorf("CRI metrics source only reads metrics of local node %q", c.nodeName)
+	}
+	containers := &listContainersResponse{}
+	if err := c.conn.Invoke(ctx, listContainersMethod, &listContainersRequest{runningOnly: true}, containers); err != nil {
+		return nil, fmt.Errorf("failed listing containers: %w", err)
+	}
+	stats := &listContainerStatsResponse{}
+	if err := c.conn.Invoke(ctx, listContainerStatsMethod, &listContainerStatsRequest{}, stats); err != nil {
+		return nil, fmt.Errorf("failed listing container stats: %w", err)
+	}
+	res := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{},
+		Pods:  decodePods(containers.containers, stats.stats),
+	}
+	nodePoint, err := readNodeMetrics(c.procPath)
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "Failed reading node metrics", "node", klog.KObj(node))
+	} else {
+		res.Nodes[node.Name] = nodePoint
+	}
+	return res, nil
+}
+
+// decodePods groups stats of running containers created by Kubelet by pod.
+// Containers missing CPU or memory usage are skipped.
+func decodePods(containers []container, stats []containerStats) map[apitypes.NamespacedName]storage.PodMetricsPoint {
+	running := make(map[string]container, len(containers))
+	for _, c := range containers {
+		running[c.id] = c
+	}
+	pods := map[apitypes.NamespacedName]storage.PodMetricsPoint{}
+	for _, s := range stats {
+		c, found := running[s.id]
+		if !found || s.cpuUsageCoreNanoSeconds == nil || s.workingSetBytes == nil || s.cpuTimestamp == 0 {
+			continue
+		}
+		labels := c.labels
+		if labels == nil {
+			labels = s.labels
+		}
+		pod := apitypes.NamespacedName{Namespace: labels[podNamespaceLabel], Name: labels[podNameLabel]}
+		name := labels[containerNameLabel]
+		if pod.Name == "" || pod.Namespace == "" || name == "" || name == sandboxContainerName {
+			continue
+		}
+		point, found := pods[pod]
+		if !found {
+			point.Containers = map[string]storage.MetricsPoint{}
+		}
+		point.Containers[name] = storage.MetricsPoint{
+			StartTime:         time.Unix(0, c.createdAt),
+			Timestamp:         time.Unix(0, s.cpuTimestamp),
+			CumulativeCpuUsed: *s.cpuUsageCoreNanoSeconds,
+			MemoryUsage:       *s.workingSetBytes,
+		}
+		pods[pod] = point
+	}
+	return pods
+}
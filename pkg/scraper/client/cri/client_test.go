@@ -0,0 +1,221 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cri
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// fakeRuntime serves CRI responses on a unix socket.
+type fakeRuntime struct {
+	containers []container
+	stats      []containerStats
+	// runningOnly records whether the last ListContainers request filtered running containers.
+	runningOnly bool
+}
+
+func (f *fakeRuntime) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	switch method {
+	case listContainersMethod:
+		req := &listContainersRequest{}
+		if err := stream.RecvMsg(req); err != nil {
+			return err
+		}
+		f.runningOnly = req.runningOnly
+		return stream.SendMsg(&listContainersResponse{containers: f.containers})
+	case listContainerStatsMethod:
+		if err := stream.RecvMsg(&listContainerStatsRequest{}); err != nil {
+			return err
+		}
+		return stream.SendMsg(&listContainerStatsResponse{stats: f.stats})
+	}
+	return fmt.Errorf("unexpected method %q", method)
+}
+
+func startFakeRuntime(t *testing.T, runtime *fakeRuntime) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "cri.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.ForceServerCodec(codec{}), grpc.UnknownServiceHandler(runtime.handle))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return "unix://" + socket
+}
+
+func writeProc(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	stat := "cpu  100 20 30 1000 50 6 4 10 5 0\ncpu0 100 20 30 1000 50 6 4 10 5 0\nbtime 1685620800\n"
+	meminfo := "MemTotal:       4000 kB\nMemFree:        1000 kB\nMemAvailable:   3000 kB\n"
+	if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "meminfo"), []byte(meminfo), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func uint64Ptr(v uint64) *uint64 {
+	return &v
+}
+
+func TestGetMetrics(t *testing.T) {
+	created := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	scraped := created.Add(time.Minute)
+	podLabels := func(namespace, pod, container string) map[string]string {
+		return map[string]string{podNamespaceLabel: namespace, podNameLabel: pod, containerNameLabel: container}
+	}
+	runtime := &fakeRuntime{
+		containers: []container{
+			{id: "c1", name: "app", labels: podLabels("ns1", "pod1", "app"), createdAt: created.UnixNano()},
+			{id: "c2", name: "sidecar", labels: podLabels("ns1", "pod1", "sidecar"), createdAt: created.UnixNano()},
+			{id: "c3", name: "app", labels: podLabels("ns2", "pod2", "app"), createdAt: created.UnixNano()},
+			{id: "sandbox", name: "POD", labels: podLabels("ns2", "pod2", "POD"), createdAt: created.UnixNano()},
+			{id: "unmanaged", name: "unmanaged", createdAt: created.UnixNano()},
+			{id: "no-stats", name: "app", labels: podLabels("ns3", "pod3", "app"), createdAt: created.UnixNano()},
+		},
+		stats: []containerStats{
+			{id: "c1", cpuTimestamp: scraped.UnixNano(), cpuUsageCoreNanoSeconds: uint64Ptr(1000), memoryTimestamp: scraped.UnixNano(), workingSetBytes: uint64Ptr(2000)},
+			{id: "c2", cpuTimestamp: scraped.UnixNano(), cpuUsageCoreNanoSeconds: uint64Ptr(3000), memoryTimestamp: scraped.UnixNano(), workingSetBytes: uint64Ptr(4000)},
+			{id: "c3", cpuTimestamp: scraped.UnixNano(), cpuUsageCoreNanoSeconds: uint64Ptr(5000), memoryTimestamp: scraped.UnixNano(), workingSetBytes: uint64Ptr(6000)},
+			{id: "sandbox", cpuTimestamp: scraped.UnixNano(), cpuUsageCoreNanoSeconds: uint64Ptr(1), memoryTimestamp: scraped.UnixNano(), workingSetBytes: uint64Ptr(1)},
+			{id: "unmanaged", cpuTimestamp: scraped.UnixNano(), cpuUsageCoreNanoSeconds: uint64Ptr(1), memoryTimestamp: scraped.UnixNano(), workingSetBytes: uint64Ptr(1)},
+			{id: "no-stats", cpuTimestamp: scraped.UnixNano(), cpuUsageCoreNanoSeconds: uint64Ptr(1)},
+			{id: "exited", cpuTimestamp: scraped.UnixNano(), cpuUsageCoreNanoSeconds: uint64Ptr(1), memoryTimestamp: scraped.UnixNano(), workingSetBytes: uint64Ptr(1)},
+		},
+	}
+	endpoint := startFakeRuntime(t, runtime)
+	c, err := NewForConfig(&client.KubeletClientConfig{CRIEndpoint: endpoint, NodeName: "node1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.procPath = writeProc(t)
+
+	tcs := []struct {
+		name      string
+		node      string
+		wantPods  map[apitypes.NamespacedName]storage.PodMetricsPoint
+		wantError bool
+	}{
+		{
+			name: "Local node",
+			node: "node1",
+			wantPods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				{Namespace: "ns1", Name: "pod1"}: {Containers: map[string]storage.MetricsPoint{
+					"app":     {StartTime: created, Timestamp: scraped, CumulativeCpuUsed: 1000, MemoryUsage: 2000},
+					"sidecar": {StartTime: created, Timestamp: scraped, CumulativeCpuUsed: 3000, MemoryUsage: 4000},
+				}},
+				{Namespace: "ns2", Name: "pod2"}: {Containers: map[string]storage.MetricsPoint{
+					"app": {StartTime: created, Timestamp: scraped, CumulativeCpuUsed: 5000, MemoryUsage: 6000},
+				}},
+			},
+		},
+		{
+			name:      "Other node",
+			node:      "node2",
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			got, err := c.GetMetrics(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: tc.node}})
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantError {
+				return
+			}
+			if !runtime.runningOnly {
+				t.Error("Expected listing only running containers")
+			}
+			if diff := cmp.Diff(tc.wantPods, got.Pods); diff != "" {
+				t.Errorf("Unexpected pods, diff:\n%s", diff)
+			}
+			node, found := got.Nodes[tc.node]
+			if !found {
+				t.Fatalf("Missing node metrics")
+			}
+			// (100 + 20 + 30 + 6 + 4 + 10) ticks of 10ms
+			if node.CumulativeCpuUsed != 1700*uint64(time.Millisecond) || node.MemoryUsage != 1000*1024 || !node.StartTime.Equal(time.Unix(1685620800, 0)) {
+				t.Errorf("Unexpected node metrics %+v", node)
+			}
+		})
+	}
+}
+
+func TestParseStat(t *testing.T) {
+	tcs := []struct {
+		name      string
+		stat      string
+		wantCPU   uint64
+		wantError bool
+	}{
+		{
+			name:    "Valid",
+			stat:    "cpu  1 2 3 4 5 6 7 8 9 10\nintr 1\nbtime 10\n",
+			wantCPU: (1 + 2 + 3 + 6 + 7 + 8) * uint64(10*time.Millisecond),
+		},
+		{
+			name:      "Missing btime",
+			stat:      "cpu  1 2 3 4 5 6 7 8 9 10\n",
+			wantError: true,
+		},
+		{
+			name:      "Short cpu line",
+			stat:      "cpu  1 2 3\nbtime 10\n",
+			wantError: true,
+		},
+		{
+			name:      "Invalid value",
+			stat:      "cpu  1 x 3 4 5 6 7 8 9 10\nbtime 10\n",
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cpu, _, err := parseStat([]byte(tc.stat))
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cpu != tc.wantCPU {
+				t.Errorf("Got cpu %d, expected %d", cpu, tc.wantCPU)
+			}
+		})
+	}
+}
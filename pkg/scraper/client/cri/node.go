@@ -0,0 +1,137 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cri
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// userHZ is the unit of CPU times in /proc/stat, fixed to 100 on Linux.
+const userHZ = 100
+
+// readNodeMetrics reads node metrics from procfs, as CRI doesn't report
+// them. CPU and memory in /proc/stat and /proc/meminfo are not namespaced,
+// so they describe the node also when read from a container.
+// Memory usage is approximated by MemTotal - MemAvailable.
+func readNodeMetrics(procPath string) (storage.MetricsPoint, error) {
+	now := time.Now()
+	stat, err := os.ReadFile(filepath.Join(procPath, "stat"))
+	if err != nil {
+		return storage.MetricsPoint{}, err
+	}
+	cpu, boot, err := parseStat(stat)
+	if err != nil {
+		return storage.MetricsPoint{}, err
+	}
+	meminfo, err := os.ReadFile(filepath.Join(procPath, "meminfo"))
+	if err != nil {
+		return storage.MetricsPoint{}, err
+	}
+	memory, err := parseMeminfo(meminfo)
+	if err != nil {
+		return storage.MetricsPoint{}, err
+	}
+	return storage.MetricsPoint{
+		StartTime:         boot,
+		Timestamp:         now,
+		CumulativeCpuUsed: cpu,
+		MemoryUsage:       memory,
+	}, nil
+}
+
+// parseStat returns the cumulative non idle CPU time of all cores in nanoseconds and the boot time.
+func parseStat(stat []byte) (cpu uint64, boot time.Time, err error) {
+	var foundCPU, foundBoot bool
+	s := bufio.NewScanner(bytes.NewReader(stat))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "cpu":
+			// user nice system idle iowait irq softirq steal, guest time is included in user.
+			if len(fields) < 9 {
+				return 0, time.Time{}, fmt.Errorf("unexpected cpu line in stat %q", s.Text())
+			}
+			var ticks uint64
+			for i, f := range fields[1:9] {
+				if i == 3 || i == 4 {
+					continue
+				}
+				v, err := strconv.ParseUint(f, 10, 64)
+				if err != nil {
+					return 0, time.Time{}, fmt.Errorf("unexpected cpu line in stat %q: %w", s.Text(), err)
+				}
+				ticks += v
+			}
+			cpu = ticks * uint64(time.Second/userHZ)
+			foundCPU = true
+		case "btime":
+			if len(fields) != 2 {
+				return 0, time.Time{}, fmt.Errorf("unexpected btime line in stat %q", s.Text())
+			}
+			v, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, time.Time{}, fmt.Errorf("unexpected btime line in stat %q: %w", s.Text(), err)
+			}
+			boot = time.Unix(v, 0)
+			foundBoot = true
+		}
+	}
+	if !foundCPU || !foundBoot {
+		return 0, time.Time{}, fmt.Errorf("stat misses cpu or btime line")
+	}
+	return cpu, boot, nil
+}
+
+// parseMeminfo returns used memory in bytes.
+func parseMeminfo(meminfo []byte) (uint64, error) {
+	values := map[string]uint64{}
+	s := bufio.NewScanner(bytes.NewReader(meminfo))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		key := strings.TrimSuffix(fields[0], ":")
+		if key != "MemTotal" && key != "MemAvailable" {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected %s line in meminfo %q: %w", key, s.Text(), err)
+		}
+		values[key] = v * 1024
+	}
+	total, foundTotal := values["MemTotal"]
+	available, foundAvailable := values["MemAvailable"]
+	if !foundTotal || !foundAvailable {
+		return 0, fmt.Errorf("meminfo misses MemTotal or MemAvailable")
+	}
+	if available > total {
+		return 0, nil
+	}
+	return total - available, nil
+}
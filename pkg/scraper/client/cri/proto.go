@@ -0,0 +1,370 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cri
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+// Messages of the CRI runtime.v1 RuntimeService used by metrics-server.
+// Only fields read by metrics-server are decoded, the same way the resource
+// client decodes only the Kubelet metrics it needs instead of depending on
+// generated types of the whole API.
+
+const (
+	listContainersMethod     = "/runtime.v1.RuntimeService/ListContainers"
+	listContainerStatsMethod = "/runtime.v1.RuntimeService/ListContainerStats"
+
+	// containerRunning is the CONTAINER_RUNNING value of ContainerState.
+	containerRunning = 1
+)
+
+// message is implemented by CRI requests and responses encoded by codec.
+type message interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+// codec encodes messages in protobuf wire format for gRPC.
+type codec struct{}
+
+func (codec) Name() string {
+	return "proto"
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("unsupported message type %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("unsupported message type %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+// listContainersRequest lists containers, only running ones if runningOnly is set.
+type listContainersRequest struct {
+	runningOnly bool
+}
+
+func (r *listContainersRequest) marshal() []byte {
+	if !r.runningOnly {
+		return nil
+	}
+	var state []byte
+	state = protowire.AppendTag(state, 1, protowire.VarintType)
+	state = protowire.AppendVarint(state, containerRunning)
+	var filter []byte
+	filter = protowire.AppendTag(filter, 2, protowire.BytesType)
+	filter = protowire.AppendBytes(filter, state)
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, filter)
+}
+
+func (r *listContainersRequest) unmarshal(b []byte) error {
+	r.runningOnly = false
+	return forEachField(b, func(num protowire.Number, filter []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		return forEachField(filter, func(num protowire.Number, state []byte, _ uint64) error {
+			if num != 2 {
+				return nil
+			}
+			return forEachField(state, func(num protowire.Number, _ []byte, v uint64) error {
+				r.runningOnly = num == 1 && v == containerRunning
+				return nil
+			})
+		})
+	})
+}
+
+type listContainersResponse struct {
+	containers []container
+}
+
+// container is a Container of the CRI API.
+type container struct {
+	id     string
+	name   string
+	labels map[string]string
+	// createdAt is the creation time in nanoseconds since epoch.
+	createdAt int64
+}
+
+func (r *listContainersResponse) marshal() []byte {
+	var b []byte
+	for _, c := range r.containers {
+		var metadata []byte
+		metadata = appendString(metadata, 1, c.name)
+		var cb []byte
+		cb = appendString(cb, 1, c.id)
+		cb = protowire.AppendTag(cb, 3, protowire.BytesType)
+		cb = protowire.AppendBytes(cb, metadata)
+		cb = protowire.AppendTag(cb, 7, protowire.VarintType)
+		cb = protowire.AppendVarint(cb, uint64(c.createdAt))
+		cb = appendMap(cb, 8, c.labels)
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, cb)
+	}
+	return b
+}
+
+func (r *listContainersResponse) unmarshal(b []byte) error {
+	r.containers = nil
+	return forEachField(b, func(num protowire.Number, value []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		var c container
+		err := forEachField(value, func(num protowire.Number, value []byte, v uint64) error {
+			switch num {
+			case 1:
+				c.id = string(value)
+			case 3:
+				return forEachField(value, func(num protowire.Number, value []byte, _ uint64) error {
+					if num == 1 {
+						c.name = names.Intern(value)
+					}
+					return nil
+				})
+			case 7:
+				c.createdAt = int64(v)
+			case 8:
+				return unmarshalMapEntry(value, &c.labels)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to decode container: %w", err)
+		}
+		r.containers = append(r.containers, c)
+		return nil
+	})
+}
+
+// listContainerStatsRequest lists stats of all containers.
+type listContainerStatsRequest struct{}
+
+func (r *listContainerStatsRequest) marshal() []byte {
+	return nil
+}
+
+func (r *listContainerStatsRequest) unmarshal(b []byte) error {
+	return nil
+}
+
+type listContainerStatsResponse struct {
+	stats []containerStats
+}
+
+// containerStats is a ContainerStats of the CRI API. Usage is nil if not reported.
+type containerStats struct {
+	id     string
+	labels map[string]string
+
+	cpuTimestamp int64
+	// cpuUsageCoreNanoSeconds is the cumulative CPU usage since container start.
+	cpuUsageCoreNanoSeconds *uint64
+
+	memoryTimestamp int64
+	workingSetBytes *uint64
+}
+
+func (r *listContainerStatsResponse) marshal() []byte {
+	var b []byte
+	for _, s := range r.stats {
+		var attributes []byte
+		attributes = appendString(attributes, 1, s.id)
+		attributes = appendMap(attributes, 3, s.labels)
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.BytesType)
+		sb = protowire.AppendBytes(sb, attributes)
+		if s.cpuUsageCoreNanoSeconds != nil {
+			sb = protowire.AppendTag(sb, 2, protowire.BytesType)
+			sb = protowire.AppendBytes(sb, marshalUsage(s.cpuTimestamp, *s.cpuUsageCoreNanoSeconds))
+		}
+		if s.workingSetBytes != nil {
+			sb = protowire.AppendTag(sb, 3, protowire.BytesType)
+			sb = protowire.AppendBytes(sb, marshalUsage(s.memoryTimestamp, *s.workingSetBytes))
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+	return b
+}
+
+func (r *listContainerStatsResponse) unmarshal(b []byte) error {
+	r.stats = nil
+	return forEachField(b, func(num protowire.Number, value []byte, _ uint64) error {
+		if num != 1 {
+			return nil
+		}
+		var s containerStats
+		err := forEachField(value, func(num protowire.Number, value []byte, _ uint64) error {
+			switch num {
+			case 1:
+				return forEachField(value, func(num protowire.Number, value []byte, _ uint64) error {
+					switch num {
+					case 1:
+						s.id = string(value)
+					case 3:
+						return unmarshalMapEntry(value, &s.labels)
+					}
+					return nil
+				})
+			case 2:
+				var err error
+				s.cpuTimestamp, s.cpuUsageCoreNanoSeconds, err = unmarshalUsage(value)
+				return err
+			case 3:
+				var err error
+				s.memoryTimestamp, s.workingSetBytes, err = unmarshalUsage(value)
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to decode container stats: %w", err)
+		}
+		r.stats = append(r.stats, s)
+		return nil
+	})
+}
+
+// marshalUsage encodes the timestamp and first UInt64Value of CpuUsage and
+// MemoryUsage, which are usage_core_nano_seconds and working_set_bytes.
+func marshalUsage(timestamp int64, value uint64) []byte {
+	var v []byte
+	v = protowire.AppendTag(v, 1, protowire.VarintType)
+	v = protowire.AppendVarint(v, value)
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(timestamp))
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func unmarshalUsage(b []byte) (timestamp int64, value *uint64, err error) {
+	err = forEachField(b, func(num protowire.Number, raw []byte, v uint64) error {
+		switch num {
+		case 1:
+			timestamp = int64(v)
+		case 2:
+			var u uint64
+			if err := forEachField(raw, func(num protowire.Number, _ []byte, v uint64) error {
+				if num == 1 {
+					u = v
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			value = &u
+		}
+		return nil
+	})
+	return timestamp, value, err
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	for k, v := range m {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendString(entry, 2, v)
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+// names interns container names, label keys and values, listed again on every scrape.
+var names = utils.NewInterner()
+
+func unmarshalMapEntry(b []byte, m *map[string]string) error {
+	var key, value string
+	err := forEachField(b, func(num protowire.Number, raw []byte, _ uint64) error {
+		switch num {
+		case 1:
+			key = names.Intern(raw)
+		case 2:
+			value = names.Intern(raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = map[string]string{}
+	}
+	(*m)[key] = value
+	return nil
+}
+
+// forEachField calls fn for each field of an encoded message with the
+// payload of length-delimited fields or the value of varint fields. Fields
+// of other types are skipped, as none are used by metrics-server.
+func forEachField(b []byte, fn func(num protowire.Number, value []byte, v uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var (
+			value []byte
+			v     uint64
+		)
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType && typ != protowire.VarintType {
+			continue
+		}
+		if err := fn(num, value, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 
 	v1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
 
 	"sigs.k8s.io/metrics-server/pkg/storage"
 )
@@ -27,3 +28,21 @@ type KubeletMetricsGetter interface {
 	// GetMetrics fetches Resource metrics from the given Kubelet
 	GetMetrics(ctx context.Context, node *v1.Node) (*storage.MetricsBatch, error)
 }
+
+// KubeletEndpointResolver knows which Kubelet endpoint would be dialed for a node.
+type KubeletEndpointResolver interface {
+	// Endpoint returns the host:port used to reach the Kubelet of the given node.
+	Endpoint(node *v1.Node) (string, error)
+}
+
+// NodeMetricsSupplier knows how to fetch metrics of a node from sources other than the Kubelet.
+type NodeMetricsSupplier interface {
+	// GetNodeMetrics returns usage of additional resources of the given node.
+	GetNodeMetrics(ctx context.Context, node *v1.Node) (v1.ResourceList, error)
+}
+
+// PodDevicesSupplier knows how to fetch devices allocated to pods of a node.
+type PodDevicesSupplier interface {
+	// GetPodDevices returns devices allocated to containers of pods running on the given node.
+	GetPodDevices(ctx context.Context, node *v1.Node) (map[apitypes.NamespacedName][]storage.DeviceAllocation, error)
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package podresources reads devices allocated to pods of the local node from
+// the Kubelet pod resources API, both by device plugins and through dynamic
+// resource claims, to attribute accelerators to pods without depending on
+// vendor exporters.
+package podresources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/component-base/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var requestTotal = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "pod_resources",
+		Name:      "request_total",
+		Help:      "Number of requests sent to the Kubelet pod resources API",
+	},
+	[]string{"success"},
+)
+
+// RegisterPodResourcesMetrics registers metrics of pod resources requests.
+func RegisterPodResourcesMetrics(registrationFunc func(metrics.Registerable) error) error {
+	return registrationFunc(requestTotal)
+}
+
+type podResourcesClient struct {
+	conn     *grpc.ClientConn
+	nodeName string
+}
+
+var _ client.PodDevicesSupplier = (*podResourcesClient)(nil)
+
+// NewForConfig returns a client reading devices of pods of node config.NodeName from the pod resources
+// endpoint config.PodResourcesEndpoint.
+func NewForConfig(config *client.KubeletClientConfig) (*podResourcesClient, error) {
+	if !strings.HasPrefix(config.PodResourcesEndpoint, "unix://") {
+		return nil, fmt.Errorf("pod resources endpoint %q should be a unix socket URL", config.PodResourcesEndpoint)
+	}
+	if config.NodeName == "" {
+		return nil, fmt.Errorf("node name is required to read pod resources")
+	}
+	conn, err := grpc.Dial(config.PodResourcesEndpoint,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to pod resources endpoint %q: %w", config.PodResourcesEndpoint, err)
+	}
+	return &podResourcesClient{conn: conn, nodeName: config.NodeName}, nil
+}
+
+// GetPodDevices implements client.PodDevicesSupplier. Only pods of the local node can be read.
+func (c *podResourcesClient) GetPodDevices(ctx context.Context, node *corev1.Node) (map[apitypes.NamespacedName][]storage.DeviceAllocation, error) {
+	if node.Name != c.nodeName {
+		return nil, fmt.Errorf("pod resources are only read for local node %q", c.nodeName)
+	}
+	resp := &listResponse{}
+	err := c.conn.Invoke(ctx, listMethod, &listRequest{}, resp)
+	requestTotal.WithLabelValues(strconv.FormatBool(err == nil)).Inc()
+	if err != nil {
+		return nil, fmt.Errorf("failed listing pod resources: %w", err)
+	}
+	return decodeDevices(resp.pods), nil
+}
+
+// decodeDevices returns devices allocated to containers of pods, leaving out pods without devices.
+func decodeDevices(pods []podResources) map[apitypes.NamespacedName][]storage.DeviceAllocation {
+	res := map[apitypes.NamespacedName][]storage.DeviceAllocation{}
+	for _, p := range pods {
+		var allocations []storage.DeviceAllocation
+		for _, c := range p.containers {
+			for _, d := range c.devices {
+				if len(d.deviceIDs) == 0 {
+					continue
+				}
+				allocations = append(allocations, storage.DeviceAllocation{Container: c.name, Resource: d.resourceName, IDs: d.deviceIDs})
+			}
+			for _, claim := range c.claims {
+				if len(claim.cdiDevices) == 0 {
+					continue
+				}
+				allocations = append(allocations, storage.DeviceAllocation{Container: c.name, Claim: claim.claimNamespace + "/" + claim.claimName, IDs: claim.cdiDevices})
+			}
+		}
+		if len(allocations) != 0 {
+			res[apitypes.NamespacedName{Namespace: p.namespace, Name: p.name}] = allocations
+		}
+	}
+	return res
+}
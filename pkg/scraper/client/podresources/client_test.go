@@ -0,0 +1,137 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podresources
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// fakeKubelet serves pod resources responses on a unix socket.
+type fakeKubelet struct {
+	pods []podResources
+}
+
+func (f *fakeKubelet) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	if method != listMethod {
+		return fmt.Errorf("unexpected method %q", method)
+	}
+	if err := stream.RecvMsg(&listRequest{}); err != nil {
+		return err
+	}
+	return stream.SendMsg(&listResponse{pods: f.pods})
+}
+
+func startFakeKubelet(t *testing.T, kubelet *fakeKubelet) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "kubelet.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.ForceServerCodec(codec{}), grpc.UnknownServiceHandler(kubelet.handle))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return "unix://" + socket
+}
+
+func TestGetPodDevices(t *testing.T) {
+	kubelet := &fakeKubelet{
+		pods: []podResources{
+			{name: "pod1", namespace: "ns1", containers: []containerResources{
+				{name: "trainer", devices: []containerDevices{
+					{resourceName: "nvidia.com/gpu", deviceIDs: []string{"GPU-1", "GPU-2"}},
+				}},
+				{name: "sidecar"},
+			}},
+			{name: "pod2", namespace: "ns2", containers: []containerResources{
+				{name: "inference", claims: []dynamicResource{
+					{className: "gpu.example.com", claimName: "gpu-claim", claimNamespace: "ns2", cdiDevices: []string{"example.com/gpu=gpu0"}},
+					{className: "gpu.example.com", claimName: "unprepared", claimNamespace: "ns2"},
+				}},
+			}},
+			{name: "pod3", namespace: "ns3", containers: []containerResources{
+				{name: "app", devices: []containerDevices{{resourceName: "example.com/foo"}}},
+			}},
+		},
+	}
+	endpoint := startFakeKubelet(t, kubelet)
+	c, err := NewForConfig(&client.KubeletClientConfig{PodResourcesEndpoint: endpoint, NodeName: "node1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name      string
+		node      string
+		want      map[apitypes.NamespacedName][]storage.DeviceAllocation
+		wantError bool
+	}{
+		{
+			name: "Local node",
+			node: "node1",
+			want: map[apitypes.NamespacedName][]storage.DeviceAllocation{
+				{Namespace: "ns1", Name: "pod1"}: {
+					{Container: "trainer", Resource: "nvidia.com/gpu", IDs: []string{"GPU-1", "GPU-2"}},
+				},
+				{Namespace: "ns2", Name: "pod2"}: {
+					{Container: "inference", Claim: "ns2/gpu-claim", IDs: []string{"example.com/gpu=gpu0"}},
+				},
+			},
+		},
+		{
+			name:      "Other node",
+			node:      "node2",
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := c.GetPodDevices(context.Background(), &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: tc.node}})
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected devices, diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewForConfig_InvalidConfig(t *testing.T) {
+	for _, config := range []client.KubeletClientConfig{
+		{PodResourcesEndpoint: "localhost:1234", NodeName: "node1"},
+		{PodResourcesEndpoint: "unix:///var/lib/kubelet/pod-resources/kubelet.sock"},
+	} {
+		if _, err := NewForConfig(&config); err == nil {
+			t.Errorf("Expected error for config %+v", config)
+		}
+	}
+}
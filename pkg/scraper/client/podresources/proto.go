@@ -0,0 +1,265 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package podresources
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Messages of the Kubelet pod resources v1.PodResourcesLister service used by
+// metrics-server. Only fields read by metrics-server are decoded, like the CRI
+// client does, instead of depending on generated types of the whole API.
+
+const listMethod = "/v1.PodResourcesLister/List"
+
+// message is implemented by pod resources requests and responses encoded by codec.
+type message interface {
+	marshal() []byte
+	unmarshal(b []byte) error
+}
+
+// codec encodes messages in protobuf wire format for gRPC.
+type codec struct{}
+
+func (codec) Name() string {
+	return "proto"
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("unsupported message type %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("unsupported message type %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+// listRequest lists resources of all pods.
+type listRequest struct{}
+
+func (r *listRequest) marshal() []byte {
+	return nil
+}
+
+func (r *listRequest) unmarshal(b []byte) error {
+	return nil
+}
+
+type listResponse struct {
+	pods []podResources
+}
+
+// podResources is a PodResources of the pod resources API.
+type podResources struct {
+	name       string
+	namespace  string
+	containers []containerResources
+}
+
+// containerResources is a ContainerResources of the pod resources API.
+type containerResources struct {
+	name    string
+	devices []containerDevices
+	claims  []dynamicResource
+}
+
+// containerDevices is a ContainerDevices of the pod resources API, devices allocated by a device plugin.
+type containerDevices struct {
+	resourceName string
+	deviceIDs    []string
+}
+
+// dynamicResource is a DynamicResource of the pod resources API, with the
+// CDI device names of all its ClaimResources.
+type dynamicResource struct {
+	className      string
+	claimName      string
+	claimNamespace string
+	cdiDevices     []string
+}
+
+func (r *listResponse) marshal() []byte {
+	var b []byte
+	for _, p := range r.pods {
+		var pb []byte
+		pb = appendString(pb, 1, p.name)
+		pb = appendString(pb, 2, p.namespace)
+		for _, c := range p.containers {
+			pb = appendMessage(pb, 3, c.marshal())
+		}
+		b = appendMessage(b, 1, pb)
+	}
+	return b
+}
+
+func (c *containerResources) marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, c.name)
+	for _, d := range c.devices {
+		var db []byte
+		db = appendString(db, 1, d.resourceName)
+		for _, id := range d.deviceIDs {
+			db = appendString(db, 2, id)
+		}
+		b = appendMessage(b, 2, db)
+	}
+	for _, claim := range c.claims {
+		var cb []byte
+		cb = appendString(cb, 1, claim.className)
+		cb = appendString(cb, 2, claim.claimName)
+		cb = appendString(cb, 3, claim.claimNamespace)
+		var rb []byte
+		for _, name := range claim.cdiDevices {
+			rb = appendMessage(rb, 1, appendString(nil, 1, name))
+		}
+		cb = appendMessage(cb, 4, rb)
+		b = appendMessage(b, 5, cb)
+	}
+	return b
+}
+
+func (r *listResponse) unmarshal(b []byte) error {
+	r.pods = nil
+	return forEachField(b, func(num protowire.Number, value []byte) error {
+		if num != 1 {
+			return nil
+		}
+		var p podResources
+		err := forEachField(value, func(num protowire.Number, value []byte) error {
+			switch num {
+			case 1:
+				p.name = string(value)
+			case 2:
+				p.namespace = string(value)
+			case 3:
+				var c containerResources
+				if err := c.unmarshal(value); err != nil {
+					return err
+				}
+				p.containers = append(p.containers, c)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to decode pod resources: %w", err)
+		}
+		r.pods = append(r.pods, p)
+		return nil
+	})
+}
+
+func (c *containerResources) unmarshal(b []byte) error {
+	return forEachField(b, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 1:
+			c.name = string(value)
+		case 2:
+			var d containerDevices
+			err := forEachField(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					d.resourceName = string(value)
+				case 2:
+					d.deviceIDs = append(d.deviceIDs, string(value))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			c.devices = append(c.devices, d)
+		case 5:
+			var claim dynamicResource
+			err := forEachField(value, func(num protowire.Number, value []byte) error {
+				switch num {
+				case 1:
+					claim.className = string(value)
+				case 2:
+					claim.claimName = string(value)
+				case 3:
+					claim.claimNamespace = string(value)
+				case 4:
+					return forEachField(value, func(num protowire.Number, value []byte) error {
+						if num != 1 {
+							return nil
+						}
+						return forEachField(value, func(num protowire.Number, value []byte) error {
+							if num == 1 {
+								claim.cdiDevices = append(claim.cdiDevices, string(value))
+							}
+							return nil
+						})
+					})
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			c.claims = append(c.claims, claim)
+		}
+		return nil
+	})
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// forEachField calls fn with each length delimited field of b, other fields are skipped.
+func forEachField(b []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var value []byte
+		if typ == protowire.BytesType {
+			value, n = protowire.ConsumeBytes(b)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			continue
+		}
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
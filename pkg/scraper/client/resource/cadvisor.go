@@ -0,0 +1,304 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/model/timestamp"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var (
+	containerCfsPeriodsMetricName          = []byte("container_cpu_cfs_periods_total")
+	containerCfsThrottledPeriodsMetricName = []byte("container_cpu_cfs_throttled_periods_total")
+	containerCfsThrottledTimeMetricName    = []byte("container_cpu_cfs_throttled_seconds_total")
+)
+
+var (
+	idTag  = []byte(`id="`)
+	cpuTag = []byte(`cpu="`)
+)
+
+// sandboxContainerName is the container label of pod sandbox cgroups reported by some runtimes.
+const sandboxContainerName = "POD"
+
+type containerRef struct {
+	pod       apitypes.NamespacedName
+	container string
+}
+
+// throttling holds cumulative CFS counters of a container.
+type throttling struct {
+	periods          uint64
+	throttledPeriods uint64
+	throttledTime    uint64
+}
+
+// getThrottling decodes CFS counters from cadvisor, fetching cAdvisor metrics from url if it is nil.
+func (kc *kubeletClient) getThrottling(ctx context.Context, url string, cadvisor []byte) (map[containerRef]throttling, error) {
+	if cadvisor == nil {
+		var err error
+		cadvisor, err = kc.getCadvisor(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decodeThrottling(klog.FromContext(ctx), cadvisor)
+}
+
+func (kc *kubeletClient) getCadvisor(ctx context.Context, url string) ([]byte, error) {
+	body, err := kc.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body - %v", err)
+	}
+	client.AddResponseSize(ctx, len(b))
+	return b, nil
+}
+
+// fallback fills points missing in ms, nil if fetching resource metrics failed
+// with resourceErr, from cAdvisor metrics fetched from url. It returns the
+// fetched cAdvisor metrics to be reused. Resource metrics are kept as is if
+// the fallback fails, resourceErr is only returned if there are none.
+func (kc *kubeletClient) fallback(ctx context.Context, url, nodeName string, ms *storage.MetricsBatch, resourceErr error) ([]byte, *storage.MetricsBatch, error) {
+	logger := klog.FromContext(ctx)
+	requestTime := time.Now()
+	b, err := kc.getCadvisor(ctx, url)
+	var fallback *storage.MetricsBatch
+	if err == nil {
+		fallback, err = decodeCadvisorBatch(logger, b, requestTime, nodeName)
+		if err != nil {
+			err = &client.DecodeError{Err: err}
+		}
+	}
+	if err != nil {
+		if ms == nil {
+			return nil, nil, fmt.Errorf("%w, cAdvisor fallback failed: %w", resourceErr, err)
+		}
+		logger.Error(err, "Failed to get cAdvisor metrics for incomplete resource metrics", "node", nodeName)
+		return nil, ms, nil
+	}
+	if ms == nil {
+		logger.V(1).Info("Failed getting resource metrics, using cAdvisor metrics", "node", nodeName, "err", resourceErr)
+		return b, fallback, nil
+	}
+	if filled := mergeBatch(ms, fallback); filled != 0 {
+		logger.V(1).Info("Filled incomplete resource metrics from cAdvisor metrics", "node", nodeName, "pointCount", filled)
+	}
+	return b, ms, nil
+}
+
+// decodeCadvisorBatch decodes container and node usage from cAdvisor metrics.
+// Node usage is read from series of the root cgroup, containers from series
+// with a container label, skipping pod and sandbox cgroups.
+func decodeCadvisorBatch(logger klog.Logger, b []byte, defaultTime time.Time, nodeName string) (*storage.MetricsBatch, error) {
+	res := &storage.MetricsBatch{
+		Nodes: make(map[string]storage.MetricsPoint),
+		Pods:  make(map[apitypes.NamespacedName]storage.PodMetricsPoint),
+	}
+	node := &storage.MetricsPoint{}
+	d := decodeStates.Get().(*decodeState)
+	defer d.release()
+	defaultTimestamp := timestamp.FromTime(defaultTime)
+	parser := textparse.New(b, "")
+	for {
+		et, err := parser.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed parsing metrics: %w", err)
+		}
+		if et != textparse.EntrySeries {
+			continue
+		}
+		timeseries, maybeTimestamp, value := parser.Series()
+		if maybeTimestamp == nil {
+			maybeTimestamp = &defaultTimestamp
+		}
+		var name []byte
+		switch {
+		case timeseriesMatchesName(timeseries, containerCpuUsageMetricName):
+			name = containerCpuUsageMetricName
+		case timeseriesMatchesName(timeseries, containerMemUsageMetricName):
+			name = containerMemUsageMetricName
+		case timeseriesMatchesName(timeseries, containerStartTimeMetricName):
+			name = containerStartTimeMetricName
+		default:
+			continue
+		}
+		if !validValue(value) {
+			logger.V(1).Info("Rejected invalid metrics sample", "node", nodeName, "series", string(timeseries), "value", value)
+			rejectedSamples.WithLabelValues(rejectInvalidValue).Inc()
+			continue
+		}
+		labels := timeseries[len(name):]
+		// Skip per core usage reported with cAdvisor percpu metrics enabled.
+		if cpu, ok := labelBytes(labels, cpuTag); ok && string(cpu) != "total" {
+			continue
+		}
+		if id, _ := labelBytes(labels, idTag); string(id) == "/" {
+			switch {
+			case bytes.Equal(name, containerCpuUsageMetricName):
+				parseNodeCpuUsageMetrics(*maybeTimestamp, value, node)
+			case bytes.Equal(name, containerMemUsageMetricName):
+				parseNodeMemUsageMetrics(*maybeTimestamp, value, node)
+			}
+			continue
+		}
+		container, ok := internedLabelValue(labels, containerNameTag)
+		if !ok || container == "" || container == sandboxContainerName {
+			continue
+		}
+		pod, ok := parsePodLabels(labels)
+		if !ok || pod.Name == "" || pod.Namespace == "" {
+			continue
+		}
+		switch {
+		case bytes.Equal(name, containerCpuUsageMetricName):
+			parseContainerCpuMetrics(pod, container, *maybeTimestamp, value, d)
+		case bytes.Equal(name, containerMemUsageMetricName):
+			parseContainerMemMetrics(pod, container, *maybeTimestamp, value, d)
+		default:
+			parseContainerStartTimeMetrics(pod, container, value, d)
+		}
+	}
+	if !node.Timestamp.IsZero() && node.CumulativeCpuUsed != 0 && node.MemoryUsage != 0 {
+		res.Nodes[nodeName] = *node
+	}
+	for podRef := range d.pods {
+		if containers := d.keep(logger, podRef, false); len(containers) != 0 {
+			res.Pods[podRef] = storage.PodMetricsPoint{Containers: containers}
+		}
+	}
+	return res, nil
+}
+
+// mergeBatch adds node, pod and container points of fallback missing in ms,
+// returning the number of added points. Points present in ms are kept.
+func mergeBatch(ms, fallback *storage.MetricsBatch) int {
+	filled := 0
+	for node, point := range fallback.Nodes {
+		if _, found := ms.Nodes[node]; !found {
+			ms.Nodes[node] = point
+			filled++
+		}
+	}
+	for podRef, fallbackPod := range fallback.Pods {
+		pod, found := ms.Pods[podRef]
+		if !found {
+			ms.Pods[podRef] = fallbackPod
+			filled += len(fallbackPod.Containers)
+			continue
+		}
+		for container, point := range fallbackPod.Containers {
+			if _, found := pod.Containers[container]; !found {
+				pod.Containers[container] = point
+				filled++
+			}
+		}
+	}
+	return filled
+}
+
+// decodeThrottling extracts CFS counters of containers from cAdvisor metrics.
+// Series of pod and node cgroups, which have no container label, are skipped.
+func decodeThrottling(logger klog.Logger, b []byte) (map[containerRef]throttling, error) {
+	res := map[containerRef]throttling{}
+	parser := textparse.New(b, "")
+	for {
+		et, err := parser.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed parsing metrics: %w", err)
+		}
+		if et != textparse.EntrySeries {
+			continue
+		}
+		timeseries, _, value := parser.Series()
+		var (
+			name  []byte
+			field func(*throttling)
+		)
+		switch {
+		case timeseriesMatchesName(timeseries, containerCfsPeriodsMetricName):
+			name = containerCfsPeriodsMetricName
+			field = func(t *throttling) { t.periods = uint64(value) }
+		case timeseriesMatchesName(timeseries, containerCfsThrottledPeriodsMetricName):
+			name = containerCfsThrottledPeriodsMetricName
+			field = func(t *throttling) { t.throttledPeriods = uint64(value) }
+		case timeseriesMatchesName(timeseries, containerCfsThrottledTimeMetricName):
+			name = containerCfsThrottledTimeMetricName
+			// unit of container_cpu_cfs_throttled_seconds_total is second, need to convert to nanosecond
+			field = func(t *throttling) { t.throttledTime = uint64(value * 1e9) }
+		default:
+			continue
+		}
+		if !validValue(value) {
+			logger.V(1).Info("Rejected invalid metrics sample", "series", string(timeseries), "value", value)
+			rejectedSamples.WithLabelValues(rejectInvalidValue).Inc()
+			continue
+		}
+		labels := timeseries[len(name):]
+		container, ok := internedLabelValue(labels, containerNameTag)
+		if !ok || container == "" {
+			continue
+		}
+		pod, ok := parsePodLabels(labels)
+		if !ok {
+			continue
+		}
+		ref := containerRef{pod: pod, container: container}
+		t := res[ref]
+		field(&t)
+		res[ref] = t
+	}
+	return res, nil
+}
+
+// applyThrottling sets CFS counters on container points present in the batch.
+func applyThrottling(ms *storage.MetricsBatch, counters map[containerRef]throttling) {
+	for ref, t := range counters {
+		pod, found := ms.Pods[ref.pod]
+		if !found {
+			continue
+		}
+		point, found := pod.Containers[ref.container]
+		if !found {
+			continue
+		}
+		point.CumulativeCfsPeriods = t.periods
+		point.CumulativeCfsThrottledPeriods = t.throttledPeriods
+		point.CumulativeCfsThrottledTime = t.throttledTime
+		pod.Containers[ref.container] = point
+	}
+}
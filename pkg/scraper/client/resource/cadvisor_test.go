@@ -0,0 +1,281 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+func TestDecodeThrottling(t *testing.T) {
+	got, err := decodeThrottling(klog.Background(), []byte(cadvisorResponse))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[containerRef]throttling{
+		{pod: apitypes.NamespacedName{Namespace: "default", Name: "web-1"}, container: "nginx"}: {
+			periods:          1200,
+			throttledPeriods: 300,
+			throttledTime:    4500000000,
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(containerRef{}, throttling{})); diff != "" {
+		t.Errorf("Unexpected result, diff:\n%s", diff)
+	}
+}
+
+const cadvisorResponse = `
+# HELP container_cpu_cfs_periods_total Number of elapsed enforcement period intervals.
+# TYPE container_cpu_cfs_periods_total counter
+container_cpu_cfs_periods_total{container="",id="/kubepods/burstable/pod17ab",image="",name="",namespace="default",pod="web-1"} 1300 1633253812125
+container_cpu_cfs_periods_total{container="nginx",id="/kubepods/burstable/pod17ab/4f2c",image="nginx:1.25",name="4f2c",namespace="default",pod="web-1"} 1200 1633253812125
+# HELP container_cpu_cfs_throttled_periods_total Number of throttled period intervals.
+# TYPE container_cpu_cfs_throttled_periods_total counter
+container_cpu_cfs_throttled_periods_total{container="nginx",id="/kubepods/burstable/pod17ab/4f2c",image="nginx:1.25",name="4f2c",namespace="default",pod="web-1"} 300 1633253812125
+# HELP container_cpu_cfs_throttled_seconds_total Total time duration the container has been throttled.
+# TYPE container_cpu_cfs_throttled_seconds_total counter
+container_cpu_cfs_throttled_seconds_total{container="nginx",id="/kubepods/burstable/pod17ab/4f2c",image="nginx:1.25",name="4f2c",namespace="default",pod="web-1"} 4.5 1633253812125
+# HELP container_cpu_usage_seconds_total Cumulative cpu time consumed in seconds.
+# TYPE container_cpu_usage_seconds_total counter
+container_cpu_usage_seconds_total{container="nginx",cpu="total",id="/kubepods/burstable/pod17ab/4f2c",image="nginx:1.25",name="4f2c",namespace="default",pod="web-1"} 12.5 1633253812125
+container_cpu_usage_seconds_total{container="",cpu="total",id="/",image="",name="",namespace="",pod=""} 3021.8 1633253812125
+`
+
+var (
+	cadvisorTime  = time.Unix(0, 1633253812125*1e6)
+	cadvisorStart = time.Unix(1633200000, 0)
+	web1          = apitypes.NamespacedName{Namespace: "default", Name: "web-1"}
+	api1          = apitypes.NamespacedName{Namespace: "default", Name: "api-1"}
+)
+
+func TestDecodeCadvisorBatch(t *testing.T) {
+	got, err := decodeCadvisorBatch(klog.Background(), []byte(cadvisorUsageResponse), time.Now(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{
+			"node1": {Timestamp: cadvisorTime, CumulativeCpuUsed: 3021500000000, MemoryUsage: 2500000000},
+		},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			web1: {Containers: map[string]storage.MetricsPoint{
+				"nginx":   {StartTime: cadvisorStart, Timestamp: cadvisorTime, CumulativeCpuUsed: 12500000000, MemoryUsage: 15000000},
+				"sidecar": {StartTime: cadvisorStart, Timestamp: cadvisorTime, CumulativeCpuUsed: 500000000, MemoryUsage: 2000000},
+			}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected result, diff:\n%s", diff)
+	}
+}
+
+func TestGetMetrics_CadvisorFallback(t *testing.T) {
+	completeResource := `
+node_cpu_usage_seconds_total 3000 1633253812125
+node_memory_working_set_bytes 2e+09 1633253812125
+container_cpu_usage_seconds_total{container="app",namespace="default",pod="api-1"} 2 1633253812125
+container_memory_working_set_bytes{container="app",namespace="default",pod="api-1"} 1e+06 1633253812125
+`
+	// Runtime reporting pod level metrics of web-1 without its containers.
+	incompleteResource := completeResource + `
+pod_cpu_usage_seconds_total{namespace="default",pod="web-1"} 13 1633253812125
+pod_memory_working_set_bytes{namespace="default",pod="web-1"} 1.7e+07 1633253812125
+`
+	resourceNode := storage.MetricsPoint{Timestamp: cadvisorTime, CumulativeCpuUsed: 3000000000000, MemoryUsage: 2000000000}
+	api1Point := storage.PodMetricsPoint{Containers: map[string]storage.MetricsPoint{
+		"app": {Timestamp: cadvisorTime, CumulativeCpuUsed: 2000000000, MemoryUsage: 1000000},
+	}}
+	web1Point := storage.PodMetricsPoint{Containers: map[string]storage.MetricsPoint{
+		"nginx":   {StartTime: cadvisorStart, Timestamp: cadvisorTime, CumulativeCpuUsed: 12500000000, MemoryUsage: 15000000},
+		"sidecar": {StartTime: cadvisorStart, Timestamp: cadvisorTime, CumulativeCpuUsed: 500000000, MemoryUsage: 2000000},
+	}}
+
+	tcs := []struct {
+		name             string
+		resource         string
+		cadvisor         string
+		fallback         bool
+		windows          bool
+		want             *storage.MetricsBatch
+		wantError        bool
+		wantStatus       int
+		wantCadvisorHits int
+	}{
+		{
+			name:     "Complete resource metrics",
+			resource: completeResource,
+			cadvisor: cadvisorUsageResponse,
+			fallback: true,
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{"node1": resourceNode},
+				Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{api1: api1Point},
+			},
+		},
+		{
+			name:     "Missing containers filled from cAdvisor",
+			resource: incompleteResource,
+			cadvisor: cadvisorUsageResponse,
+			fallback: true,
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{"node1": resourceNode},
+				Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{api1: api1Point, web1: web1Point},
+			},
+			wantCadvisorHits: 1,
+		},
+		{
+			name:     "Missing containers without fallback",
+			resource: incompleteResource,
+			cadvisor: cadvisorUsageResponse,
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{"node1": resourceNode},
+				Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{api1: api1Point},
+			},
+		},
+		{
+			name:     "Failed cAdvisor keeps resource metrics",
+			resource: incompleteResource,
+			fallback: true,
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{"node1": resourceNode},
+				Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{api1: api1Point},
+			},
+			wantCadvisorHits: 1,
+		},
+		{
+			name:     "Failed resource metrics replaced by cAdvisor",
+			cadvisor: cadvisorUsageResponse,
+			fallback: true,
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {Timestamp: cadvisorTime, CumulativeCpuUsed: 3021500000000, MemoryUsage: 2500000000},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{web1: web1Point},
+			},
+			wantCadvisorHits: 1,
+		},
+		{
+			name:     "Windows node without cAdvisor metrics",
+			resource: incompleteResource,
+			fallback: true,
+			windows:  true,
+			want: &storage.MetricsBatch{
+				Nodes:        map[string]storage.MetricsPoint{"node1": resourceNode},
+				Pods:         map[apitypes.NamespacedName]storage.PodMetricsPoint{api1: {Containers: api1Point.Containers, Windows: true}},
+				WindowsNodes: map[string]bool{"node1": true},
+			},
+		},
+		{
+			name:             "Failed resource and cAdvisor metrics",
+			fallback:         true,
+			wantError:        true,
+			wantStatus:       http.StatusNotFound,
+			wantCadvisorHits: 1,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cadvisorHits := 0
+			mux := http.NewServeMux()
+			mux.HandleFunc("/metrics/resource", func(w http.ResponseWriter, _ *http.Request) {
+				if tc.resource == "" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				_, _ = w.Write([]byte(tc.resource))
+			})
+			mux.HandleFunc("/metrics/cadvisor", func(w http.ResponseWriter, _ *http.Request) {
+				cadvisorHits++
+				if tc.cadvisor == "" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				_, _ = w.Write([]byte(tc.cadvisor))
+			})
+			s := httptest.NewServer(mux)
+			defer s.Close()
+			host, portString, err := net.SplitHostPort(s.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			port, err := strconv.Atoi(portString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := newClient(s.Client(), utils.NewPriorityNodeAddressResolver(utils.DefaultAddressTypePriority), port, "http", false)
+			c.cadvisorFallback = tc.fallback
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+				Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: host}}},
+			}
+			if tc.windows {
+				node.Status.NodeInfo.OperatingSystem = "windows"
+			}
+
+			got, err := c.GetMetrics(context.Background(), node)
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var statusErr *client.StatusError
+			if tc.wantStatus != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tc.wantStatus) {
+				t.Errorf("Expected error with status %d, got %v", tc.wantStatus, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected metrics, diff:\n%s", diff)
+			}
+			if cadvisorHits != tc.wantCadvisorHits {
+				t.Errorf("Got %d cAdvisor requests, expected %d", cadvisorHits, tc.wantCadvisorHits)
+			}
+		})
+	}
+}
+
+const cadvisorUsageResponse = `
+# HELP container_cpu_usage_seconds_total Cumulative cpu time consumed in seconds.
+# TYPE container_cpu_usage_seconds_total counter
+container_cpu_usage_seconds_total{container="",cpu="total",id="/",image="",name="",namespace="",pod=""} 3021.5 1633253812125
+container_cpu_usage_seconds_total{container="",cpu="total",id="/kubepods/burstable/pod17ab",image="",name="",namespace="default",pod="web-1"} 13 1633253812125
+container_cpu_usage_seconds_total{container="POD",cpu="total",id="/kubepods/burstable/pod17ab/9a1b",image="pause:3.9",name="9a1b",namespace="default",pod="web-1"} 0.25 1633253812125
+container_cpu_usage_seconds_total{container="nginx",cpu="total",id="/kubepods/burstable/pod17ab/4f2c",image="nginx:1.25",name="4f2c",namespace="default",pod="web-1"} 12.5 1633253812125
+container_cpu_usage_seconds_total{container="nginx",cpu="cpu00",id="/kubepods/burstable/pod17ab/4f2c",image="nginx:1.25",name="4f2c",namespace="default",pod="web-1"} 6 1633253812125
+container_cpu_usage_seconds_total{container="sidecar",cpu="total",id="/kubepods/burstable/pod17ab/5d3e",image="envoy:1.27",name="5d3e",namespace="default",pod="web-1"} 0.5 1633253812125
+# HELP container_memory_working_set_bytes Current working set in bytes.
+# TYPE container_memory_working_set_bytes gauge
+container_memory_working_set_bytes{container="",id="/",image="",name="",namespace="",pod=""} 2.5e+09 1633253812125
+container_memory_working_set_bytes{container="",id="/kubepods/burstable/pod17ab",image="",name="",namespace="default",pod="web-1"} 1.7e+07 1633253812125
+container_memory_working_set_bytes{container="POD",id="/kubepods/burstable/pod17ab/9a1b",image="pause:3.9",name="9a1b",namespace="default",pod="web-1"} 4096 1633253812125
+container_memory_working_set_bytes{container="nginx",id="/kubepods/burstable/pod17ab/4f2c",image="nginx:1.25",name="4f2c",namespace="default",pod="web-1"} 1.5e+07 1633253812125
+container_memory_working_set_bytes{container="sidecar",id="/kubepods/burstable/pod17ab/5d3e",image="envoy:1.27",name="5d3e",namespace="default",pod="web-1"} 2e+06 1633253812125
+# HELP container_start_time_seconds Start time of the container since unix epoch in seconds.
+# TYPE container_start_time_seconds gauge
+container_start_time_seconds{container="nginx",id="/kubepods/burstable/pod17ab/4f2c",image="nginx:1.25",name="4f2c",namespace="default",pod="web-1"} 1.6332e+09 1633253812125
+container_start_time_seconds{container="sidecar",id="/kubepods/burstable/pod17ab/5d3e",image="envoy:1.27",name="5d3e",namespace="default",pod="web-1"} 1.6332e+09 1633253812125
+`
@@ -27,7 +27,8 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/client-go/rest"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
 
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/storage"
@@ -41,21 +42,109 @@ type kubeletClient struct {
 	scheme            string
 	addrResolver      utils.NodeAddressResolver
 	buffers           sync.Pool
+	// volumeStats enables fetching persistent volume claim usage from the Summary API.
+	volumeStats bool
+	// processStats enables fetching process counts from the Summary API.
+	processStats bool
+	// filesystemStats enables fetching node and pod filesystem usage from the Summary API.
+	filesystemStats bool
+	// cpuThrottling enables fetching container CFS throttling counters from cAdvisor metrics.
+	cpuThrottling bool
+	// maxContainers limits containers per node above which only pod level metrics are kept, 0 means no limit.
+	maxContainers int
+	// cadvisorFallback enables filling incomplete resource metrics from cAdvisor metrics.
+	cadvisorFallback bool
+	// compression enables requesting gzip compressed responses.
+	compression bool
+	// skew corrects timestamps of Kubelets with skewed clocks.
+	skew skewCorrection
+	// localHost is the host of the node-local Kubelet all requests are sent to, node addresses are resolved if empty.
+	localHost string
+	// nodePools are the clients of node pools with their own TLS configuration, nodes of no pool use client.
+	nodePools []nodePoolClient
 }
 
 var _ client.KubeletMetricsGetter = (*kubeletClient)(nil)
 
-func NewForConfig(config *client.KubeletClientConfig) (*kubeletClient, error) {
-	transport, err := rest.TransportFor(&config.Client)
+func NewForConfig(logger klog.Logger, config *client.KubeletClientConfig) (*kubeletClient, error) {
+	restConfig := config.Client
+	var localHost string
+	if config.LocalEndpoint != "" {
+		host, socket, err := ParseLocalEndpoint(config.LocalEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local Kubelet endpoint: %v", err)
+		}
+		logger.Info("Scraping the local Kubelet", "endpoint", config.LocalEndpoint)
+		localHost = host
+		if socket != "" {
+			restConfig.Dial = socketDialer(socket)
+		}
+	} else if config.EgressSelectorConfigFile != "" {
+		dial, err := clusterDialer(config.EgressSelectorConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to configure egress selector: %v", err)
+		}
+		if dial != nil {
+			logger.Info("Dialing Kubelets through the cluster egress selection", "config", config.EgressSelectorConfigFile)
+			restConfig.Dial = dial
+		}
+	}
+	pool := connPool{
+		sessionCacheSize:    config.TLSSessionCacheSize,
+		maxIdleConnsPerNode: config.MaxIdleConnsPerNode,
+		idleConnTimeout:     config.IdleConnTimeout,
+	}
+	transport, err := newTransport(logger, &restConfig, pool, config.GetClientCertificate)
 	if err != nil {
 		return nil, fmt.Errorf("unable to construct transport: %v", err)
 	}
+	var nodePools []nodePoolClient
+	if config.NodePoolsConfigFile != "" {
+		pools, err := LoadNodePoolsFile(config.NodePoolsConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pools.NodePools {
+			clientCert := config.GetClientCertificate
+			if p.ClientCertificate != "" {
+				clientCert = nil
+			}
+			poolTransport, err := newTransport(logger, p.restConfig(&restConfig), pool, clientCert)
+			if err != nil {
+				return nil, fmt.Errorf("unable to construct transport of node pool %q: %v", p.Name, err)
+			}
+			selector, _ := labels.Parse(p.NodeSelector)
+			nodePools = append(nodePools, nodePoolClient{
+				name:     p.Name,
+				selector: selector,
+				client:   &http.Client{Transport: poolTransport, Timeout: config.Client.Timeout},
+			})
+			logger.Info("Connecting to Kubelets of node pool with its own TLS configuration", "pool", p.Name, "nodeSelector", p.NodeSelector)
+		}
+	}
 
 	c := &http.Client{
 		Transport: transport,
 		Timeout:   config.Client.Timeout,
 	}
-	return newClient(c, utils.NewPriorityNodeAddressResolver(config.AddressTypePriority), config.DefaultPort, config.Scheme, config.UseNodeStatusPort), nil
+	resolver, err := utils.NewNodeAddressResolver(config.AddressResolver, config.AddressTypePriority)
+	if err != nil {
+		return nil, err
+	}
+	resolver = utils.WithAddressFamily(resolver, utils.AddressFamily(config.AddressFamily))
+	kc := newClient(c, resolver, config.DefaultPort, config.Scheme, config.UseNodeStatusPort)
+	kc.volumeStats = config.VolumeStats
+	kc.processStats = config.ProcessStats
+	kc.filesystemStats = config.FilesystemStats
+	kc.maxContainers = config.MaxContainersPerNode
+	kc.cpuThrottling = config.CPUThrottling
+	kc.cadvisorFallback = config.CadvisorFallback
+	kc.compression = !config.Client.DisableCompression
+	kc.skew.tolerance = config.ClockSkewTolerance
+	kc.skew.nodeLabels = utils.NodeLabels(config.NodeLabelBuckets)
+	kc.localHost = localHost
+	kc.nodePools = nodePools
+	return kc, nil
 }
 
 func newClient(c *http.Client, resolver utils.NodeAddressResolver, defaultPort int, scheme string, useNodeStatusPort bool) *kubeletClient {
@@ -74,38 +163,108 @@ func newClient(c *http.Client, resolver utils.NodeAddressResolver, defaultPort i
 	}
 }
 
+var _ client.KubeletEndpointResolver = (*kubeletClient)(nil)
+
 // GetMetrics implements client.KubeletMetricsGetter
 func (kc *kubeletClient) GetMetrics(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
-	port := kc.defaultPort
-	nodeStatusPort := int(node.Status.DaemonEndpoints.KubeletEndpoint.Port)
-	if kc.useNodeStatusPort && nodeStatusPort != 0 {
-		port = nodeStatusPort
-	}
-	addr, err := kc.addrResolver.NodeAddress(node)
+	logger := klog.FromContext(ctx)
+	host, err := kc.Endpoint(node)
 	if err != nil {
 		return nil, err
 	}
 	url := url.URL{
 		Scheme: kc.scheme,
-		Host:   net.JoinHostPort(addr, strconv.Itoa(port)),
+		Host:   host,
 		Path:   "/metrics/resource",
 	}
-	return kc.getMetrics(ctx, url.String(), node.Name)
+	ctx = kc.withNodeClient(ctx, node)
+	requestTime := time.Now()
+	windows := isWindows(node)
+	ms, complete, err := kc.getMetrics(ctx, url.String(), node.Name, windows)
+	// cAdvisor metrics are fetched at most once, for both the fallback and CPU throttling.
+	// Windows Kubelets don't serve them.
+	var cadvisor []byte
+	if kc.cadvisorFallback && !complete && !windows {
+		url.Path = "/metrics/cadvisor"
+		cadvisor, ms, err = kc.fallback(ctx, url.String(), node.Name, ms, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	kc.skew.correct(node.Name, ms)
+	rejectFuturePoints(logger, node.Name, ms, requestTime)
+	if kc.maxContainers > 0 && cadvisor != nil {
+		aggregatePods(logger, ms, kc.maxContainers, node.Name)
+	}
+	// Additional stats are best effort, don't drop resource metrics.
+	if kc.volumeStats || kc.processStats || kc.filesystemStats {
+		url.Path = "/stats/summary"
+		s, err := kc.getSummary(ctx, url.String())
+		if err != nil {
+			logger.Error(err, "Failed to get summary stats", "node", klog.KObj(node))
+		} else {
+			kc.applySummary(ms, s, node.Name)
+		}
+	}
+	if kc.cpuThrottling && !windows {
+		url.Path = "/metrics/cadvisor"
+		counters, err := kc.getThrottling(ctx, url.String(), cadvisor)
+		if err != nil {
+			logger.Error(err, "Failed to get CPU throttling", "node", klog.KObj(node))
+		} else {
+			applyThrottling(ms, counters)
+		}
+	}
+	if windows {
+		markWindows(ms, node.Name)
+	}
+	return ms, nil
+}
+
+// isWindows returns true if node runs Windows, by its node info or, before it is reported, its OS label.
+func isWindows(node *corev1.Node) bool {
+	if os := node.Status.NodeInfo.OperatingSystem; os != "" {
+		return os == "windows"
+	}
+	return node.Labels[corev1.LabelOSStable] == "windows"
 }
 
-func (kc *kubeletClient) getMetrics(ctx context.Context, url, nodeName string) (*storage.MetricsBatch, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// markWindows flags batch and its pods as read from the Windows Kubelet of node.
+func markWindows(batch *storage.MetricsBatch, node string) {
+	batch.WindowsNodes = map[string]bool{node: true}
+	for pod, point := range batch.Pods {
+		point.Windows = true
+		batch.Pods[pod] = point
+	}
+}
+
+// Endpoint implements client.KubeletEndpointResolver
+func (kc *kubeletClient) Endpoint(node *corev1.Node) (string, error) {
+	if kc.localHost != "" {
+		return kc.localHost, nil
+	}
+	port := kc.defaultPort
+	nodeStatusPort := int(node.Status.DaemonEndpoints.KubeletEndpoint.Port)
+	if kc.useNodeStatusPort && nodeStatusPort != 0 {
+		port = nodeStatusPort
+	}
+	addr, err := kc.addrResolver.NodeAddress(node)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return net.JoinHostPort(addr, strconv.Itoa(port)), nil
+}
+
+// getMetrics fetches and decodes resource metrics, also returning whether they are complete.
+func (kc *kubeletClient) getMetrics(ctx context.Context, url, nodeName string, windows bool) (*storage.MetricsBatch, bool, error) {
 	requestTime := time.Now()
-	response, err := kc.client.Do(req.WithContext(ctx))
+	body, err := kc.get(ctx, url)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	defer response.Body.Close()
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("request failed, status: %q", response.Status)
+	defer body.Close()
+	if skew, ok := estimateSkew(body.header, requestTime, time.Now()); ok {
+		kc.skew.observe(klog.FromContext(ctx), nodeName, skew, requestTime)
 	}
 	bp := kc.buffers.Get().(*[]byte)
 	b := *bp
@@ -115,14 +274,15 @@ func (kc *kubeletClient) getMetrics(ctx context.Context, url, nodeName string) (
 	}()
 	buf := bytes.NewBuffer(b)
 	buf.Reset()
-	_, err = io.Copy(buf, response.Body)
+	_, err = io.Copy(buf, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body - %v", err)
+		return nil, false, fmt.Errorf("failed to read response body - %v", err)
 	}
 	b = buf.Bytes()
-	ms, err := decodeBatch(b, requestTime, nodeName)
+	client.AddResponseSize(ctx, len(b))
+	ms, complete, err := decodeBatch(klog.FromContext(ctx), b, requestTime, nodeName, windows, kc.maxContainers)
 	if err != nil {
-		return nil, err
+		return nil, false, &client.DecodeError{Err: err}
 	}
-	return ms, nil
+	return ms, complete, nil
 }
@@ -15,10 +15,14 @@
 package resource
 
 import (
+	"compress/gzip"
 	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
 )
 
 func BenchmarkKubeletClient_GetMetrics(b *testing.B) {
@@ -34,7 +38,7 @@ func BenchmarkKubeletClient_GetMetrics(b *testing.B) {
 	ctx := context.Background()
 
 	for i := 0; i < b.N; i++ {
-		_, err := c.getMetrics(ctx, s.URL, "node1")
+		_, _, err := c.getMetrics(ctx, s.URL, "node1", false)
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -51,7 +55,7 @@ func TestGetMetrics(t *testing.T) {
 
 	ctx := context.Background()
 
-	ms, err := c.getMetrics(ctx, s.URL, "node1")
+	ms, _, err := c.getMetrics(ctx, s.URL, "node1", false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -63,6 +67,61 @@ func TestGetMetrics(t *testing.T) {
 	}
 }
 
+func TestGetMetrics_Compression(t *testing.T) {
+	if err := RegisterClientMetrics(metrics.NewKubeRegistry().Register); err != nil {
+		t.Fatal(err)
+	}
+	tcs := []struct {
+		name         string
+		compression  bool
+		wantEncoding string
+	}{
+		{
+			name:         "Compressed",
+			compression:  true,
+			wantEncoding: "gzip",
+		},
+		{
+			name:         "Uncompressed",
+			compression:  false,
+			wantEncoding: "identity",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				if request.Header.Get("Accept-Encoding") != "gzip" {
+					_, _ = writer.Write([]byte(resourceResponse))
+					return
+				}
+				writer.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(writer)
+				_, _ = gz.Write([]byte(resourceResponse))
+				_ = gz.Close()
+			}))
+			defer s.Close()
+			c := newClient(s.Client(), nil, 0, "http", false)
+			c.compression = tc.compression
+			receivedBytes.Reset()
+
+			ms, _, err := c.getMetrics(context.Background(), s.URL, "node1", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ms.Pods) != 70 {
+				t.Errorf("Unexpected number of pods, want: %d, got %d", 70, len(ms.Pods))
+			}
+			received, err := testutil.GetCounterMetricValue(receivedBytes.WithLabelValues(tc.wantEncoding))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if received == 0 || (tc.compression && received >= float64(len(resourceResponse))) {
+				t.Errorf("Unexpected number of received bytes %v for a %d bytes response", received, len(resourceResponse))
+			}
+		})
+	}
+}
+
 const resourceResponse = `
 # HELP container_cpu_usage_seconds_total [ALPHA] Cumulative cpu time consumed by the container in core-seconds
 # TYPE container_cpu_usage_seconds_total counter
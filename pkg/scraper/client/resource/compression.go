@@ -0,0 +1,86 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"k8s.io/component-base/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+)
+
+var receivedBytes = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "kubelet",
+		Name:      "received_bytes_total",
+		Help:      "Number of response body bytes received from Kubelets over the network, by content encoding",
+	},
+	[]string{"encoding"},
+)
+
+// get sends a GET request to url, asking for a gzip compressed response
+// unless compression is disabled. The returned body is decompressed while it
+// is read, so compressed responses are never buffered, and must be closed.
+func (kc *kubeletClient) get(ctx context.Context, url string) (*responseBody, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Setting the header disables the transparent decompression of the
+	// transport, which hides the size of compressed responses.
+	if kc.compression {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	response, err := kc.clientFor(ctx).Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, &client.StatusError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+	received := &countingReader{r: response.Body}
+	body := &responseBody{Reader: received, body: response.Body, received: received, encoding: "identity", header: response.Header}
+	if response.Header.Get("Content-Encoding") == "gzip" {
+		body.encoding = "gzip"
+		body.Reader, err = gzip.NewReader(body.received)
+		if err != nil {
+			body.Close()
+			return nil, &client.DecodeError{Err: fmt.Errorf("failed to decompress response body - %v", err)}
+		}
+	}
+	return body, nil
+}
+
+// responseBody reads a Kubelet response body, decompressed if needed, and
+// counts bytes received over the network when closed.
+type responseBody struct {
+	io.Reader
+	body     io.Closer
+	received *countingReader
+	encoding string
+	header   http.Header
+}
+
+func (b *responseBody) Close() error {
+	receivedBytes.WithLabelValues(b.encoding).Add(float64(b.received.n))
+	return b.body.Close()
+}
@@ -18,15 +18,21 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/http"
+	"sync"
 	"time"
 
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/prometheus/model/textparse"
 	"github.com/prometheus/prometheus/model/timestamp"
 
 	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 
+	"sigs.k8s.io/metrics-server/pkg/api"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 var (
@@ -35,36 +41,131 @@ var (
 	containerCpuUsageMetricName  = []byte("container_cpu_usage_seconds_total")
 	containerMemUsageMetricName  = []byte("container_memory_working_set_bytes")
 	containerStartTimeMetricName = []byte("container_start_time_seconds")
+	podCpuUsageMetricName        = []byte("pod_cpu_usage_seconds_total")
+	podMemUsageMetricName        = []byte("pod_memory_working_set_bytes")
 )
 
-func decodeBatch(b []byte, defaultTime time.Time, nodeName string) (*storage.MetricsBatch, error) {
-	res := &storage.MetricsBatch{
+// names interns namespaces, pod and container names, read again on every scrape.
+var names = utils.NewInterner()
+
+// decodeState holds maps of points being decoded. They are pooled between
+// decodes, as their size is about the same on every scrape of a node. Decoded
+// batches aren't pooled, as storage and the scraper keep them past the scrape:
+// container maps of kept pods are handed over to the batch by keep instead.
+type decodeState struct {
+	pods     map[apitypes.NamespacedName]storage.PodMetricsPoint
+	podLevel map[apitypes.NamespacedName]storage.MetricsPoint
+	// free holds emptied container maps of pods of previous decodes.
+	free []map[string]storage.MetricsPoint
+	// containerCount is the number of distinct containers decoded.
+	containerCount int
+}
+
+var decodeStates = sync.Pool{
+	New: func() interface{} {
+		return &decodeState{
+			pods:     map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+			podLevel: map[apitypes.NamespacedName]storage.MetricsPoint{},
+		}
+	},
+}
+
+// containers returns the map of container points of pod, adding it if missing.
+func (d *decodeState) containers(pod apitypes.NamespacedName) map[string]storage.MetricsPoint {
+	if point, found := d.pods[pod]; found {
+		return point.Containers
+	}
+	var containers map[string]storage.MetricsPoint
+	if n := len(d.free); n != 0 {
+		containers, d.free = d.free[n-1], d.free[:n-1]
+	} else {
+		containers = map[string]storage.MetricsPoint{}
+	}
+	d.pods[pod] = storage.PodMetricsPoint{Containers: containers}
+	return containers
+}
+
+// container returns the point of container name in containers, counting it if missing.
+func (d *decodeState) container(containers map[string]storage.MetricsPoint, name string) storage.MetricsPoint {
+	point, found := containers[name]
+	if !found {
+		d.containerCount++
+	}
+	return point
+}
+
+// keep returns the checked container points of pod for the batch, nil if
+// incomplete. Returned maps are removed from d, so they aren't recycled.
+func (d *decodeState) keep(logger klog.Logger, pod apitypes.NamespacedName, windows bool) map[string]storage.MetricsPoint {
+	containers := checkContainerMetrics(logger, d.pods[pod], windows)
+	if containers != nil {
+		delete(d.pods, pod)
+	}
+	return containers
+}
+
+// release empties maps and returns d to the pool. Container maps handed over
+// to the batch by keep were already removed from d.
+func (d *decodeState) release() {
+	for pod, point := range d.pods {
+		for name := range point.Containers {
+			delete(point.Containers, name)
+		}
+		d.free = append(d.free, point.Containers)
+		delete(d.pods, pod)
+	}
+	for pod := range d.podLevel {
+		delete(d.podLevel, pod)
+	}
+	d.containerCount = 0
+	decodeStates.Put(d)
+}
+
+// decodeBatch decodes Kubelet resource metrics. It also returns whether the
+// batch is complete, false if node metrics or metrics of containers of a pod
+// were missing or dropped. Metrics of Windows Kubelets, which don't report
+// the working set of some containers, e.g. HostProcess containers, are
+// decoded with windows set: a missing working set is filled with zero and
+// containers without CPU usage are dropped alone instead of their pod.
+// Once more than maxContainers containers were decoded, if not 0, container
+// series are skipped and pods are decoded from their pod level metrics alone.
+func decodeBatch(logger klog.Logger, b []byte, defaultTime time.Time, nodeName string, windows bool, maxContainers int) (res *storage.MetricsBatch, complete bool, err error) {
+	res = &storage.MetricsBatch{
 		Nodes: make(map[string]storage.MetricsPoint),
 		Pods:  make(map[apitypes.NamespacedName]storage.PodMetricsPoint),
 	}
 	node := &storage.MetricsPoint{}
-	pods := make(map[apitypes.NamespacedName]storage.PodMetricsPoint)
+	d := decodeStates.Get().(*decodeState)
+	defer d.release()
 	parser := textparse.New(b, "")
 	var (
-		err              error
 		defaultTimestamp = timestamp.FromTime(defaultTime)
 		et               textparse.Entry
+		podLevelOnly     bool
 	)
 	for {
 		if et, err = parser.Next(); err != nil {
 			if err == io.EOF {
 				break
 			} else {
-				return nil, fmt.Errorf("failed parsing metrics: %w", err)
+				return nil, false, fmt.Errorf("failed parsing metrics: %w", err)
 			}
 		}
 		if et != textparse.EntrySeries {
 			continue
 		}
 		timeseries, maybeTimestamp, value := parser.Series()
+		if podLevelOnly && isContainerSeries(timeseries) {
+			continue
+		}
 		if maybeTimestamp == nil {
 			maybeTimestamp = &defaultTimestamp
 		}
+		if !validValue(value) {
+			logger.V(1).Info("Rejected invalid metrics sample", "node", nodeName, "series", string(timeseries), "value", value)
+			rejectedSamples.WithLabelValues(rejectInvalidValue).Inc()
+			continue
+		}
 		switch {
 		case timeseriesMatchesName(timeseries, nodeCpuUsageMetricName):
 			parseNodeCpuUsageMetrics(*maybeTimestamp, value, node)
@@ -72,40 +173,148 @@ func decodeBatch(b []byte, defaultTime time.Time, nodeName string) (*storage.Met
 			parseNodeMemUsageMetrics(*maybeTimestamp, value, node)
 		case timeseriesMatchesName(timeseries, containerCpuUsageMetricName):
 			namespaceName, containerName := parseContainerLabels(timeseries[len(containerCpuUsageMetricName):])
-			parseContainerCpuMetrics(namespaceName, containerName, *maybeTimestamp, value, pods)
+			parseContainerCpuMetrics(namespaceName, containerName, *maybeTimestamp, value, d)
 		case timeseriesMatchesName(timeseries, containerMemUsageMetricName):
 			namespaceName, containerName := parseContainerLabels(timeseries[len(containerMemUsageMetricName):])
-			parseContainerMemMetrics(namespaceName, containerName, *maybeTimestamp, value, pods)
+			parseContainerMemMetrics(namespaceName, containerName, *maybeTimestamp, value, d)
 		case timeseriesMatchesName(timeseries, containerStartTimeMetricName):
 			namespaceName, containerName := parseContainerLabels(timeseries[len(containerStartTimeMetricName):])
-			parseContainerStartTimeMetrics(namespaceName, containerName, *maybeTimestamp, value, pods)
+			parseContainerStartTimeMetrics(namespaceName, containerName, value, d)
+		case timeseriesMatchesName(timeseries, podCpuUsageMetricName):
+			namespaceName, ok := parsePodLabels(timeseries[len(podCpuUsageMetricName):])
+			if ok {
+				parsePodCpuMetrics(namespaceName, *maybeTimestamp, value, d.podLevel)
+			}
+		case timeseriesMatchesName(timeseries, podMemUsageMetricName):
+			namespaceName, ok := parsePodLabels(timeseries[len(podMemUsageMetricName):])
+			if ok {
+				parsePodMemMetrics(namespaceName, *maybeTimestamp, value, d.podLevel)
+			}
 		default:
 			continue
 		}
+		if maxContainers > 0 && !podLevelOnly && d.containerCount > maxContainers {
+			logger.V(1).Info("Too many containers on node, collecting pod level metrics only", "node", nodeName, "maxContainers", maxContainers)
+			podLevelOnly = true
+		}
 	}
 
+	complete = true
 	if node.Timestamp.IsZero() || node.CumulativeCpuUsed == 0 || node.MemoryUsage == 0 {
-		klog.V(1).InfoS("Failed getting complete node metric", "node", nodeName, "metric", node)
+		logger.V(1).Info("Failed getting complete node metric", "node", nodeName, "metric", node)
 		node = nil
+		complete = false
 	} else {
 		res.Nodes[nodeName] = *node
 	}
 
-	for podRef, podMetric := range pods {
+	if podLevelOnly {
+		// Containers were only partially decoded, pods without complete pod level metrics are dropped.
+		for podRef, podPoint := range d.podLevel {
+			if podPoint.CumulativeCpuUsed != 0 && podPoint.MemoryUsage != 0 {
+				res.Pods[podRef] = storage.PodMetricsPoint{
+					Containers: map[string]storage.MetricsPoint{api.PodAggregateContainerName: podPoint},
+				}
+			}
+		}
+		return res, complete, nil
+	}
+	for podRef, podMetric := range d.pods {
 		if len(podMetric.Containers) != 0 {
 			// drop container metrics when Timestamp is zero
 
 			pm := storage.PodMetricsPoint{
-				Containers: checkContainerMetrics(podMetric),
+				Containers: d.keep(logger, podRef, windows),
 			}
 			if pm.Containers == nil {
-				klog.V(1).InfoS("Failed getting complete Pod metric", "pod", klog.KRef(podRef.Namespace, podRef.Name))
+				logger.V(1).Info("Failed getting complete Pod metric", "pod", klog.KRef(podRef.Namespace, podRef.Name))
+				complete = false
 			} else {
+				// pod level metrics are optional, only keep complete ones
+				if podPoint, found := d.podLevel[podRef]; found && podPoint.CumulativeCpuUsed != 0 && podPoint.MemoryUsage != 0 {
+					pm.Pod = podPoint
+				}
 				res.Pods[podRef] = pm
 			}
 		}
 	}
-	return res, nil
+	// Some runtimes report pod level metrics without metrics of the pod containers.
+	for podRef := range d.podLevel {
+		if _, found := res.Pods[podRef]; !found {
+			complete = false
+		}
+	}
+	return res, complete, nil
+}
+
+// DecodePushedBatch decodes Kubelet resource metrics of nodeName pushed by a
+// node agent, in the Prometheus text format or, if contentType says so, in the
+// length-delimited protobuf format. Incomplete points are dropped like for
+// scraped metrics.
+func DecodePushedBatch(logger klog.Logger, r io.Reader, contentType string, defaultTime time.Time, nodeName string) (*storage.MetricsBatch, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	var (
+		b   []byte
+		err error
+	)
+	if format := expfmt.ResponseFormat(header); format == expfmt.FmtProtoDelim {
+		b, err = protoToText(expfmt.NewDecoder(r, format))
+	} else {
+		b, err = io.ReadAll(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	batch, _, err := decodeBatch(logger, b, defaultTime, nodeName, false, 0)
+	return batch, err
+}
+
+// protoToText re-encodes metric families read from dec in the text format understood by decodeBatch.
+func protoToText(dec expfmt.Decoder) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for {
+		family := &dto.MetricFamily{}
+		if err := dec.Decode(family); err != nil {
+			if err == io.EOF {
+				return buf.Bytes(), nil
+			}
+			return nil, fmt.Errorf("failed decoding metric families: %w", err)
+		}
+		if _, err := expfmt.MetricFamilyToText(buf, family); err != nil {
+			return nil, fmt.Errorf("failed encoding metric family %q: %w", family.GetName(), err)
+		}
+	}
+}
+
+// aggregatePods replaces container points of every pod with a single pod level
+// point when the batch has more than maxContainers containers. Pods without
+// pod level metrics are kept as is. It bounds batches completed from cAdvisor
+// metrics, decodeBatch already stops decoding containers past the limit.
+func aggregatePods(logger klog.Logger, batch *storage.MetricsBatch, maxContainers int, nodeName string) {
+	var containers int
+	for _, pod := range batch.Pods {
+		containers += len(pod.Containers)
+	}
+	if containers <= maxContainers {
+		return
+	}
+	logger.V(1).Info("Too many containers on node, collecting pod level metrics only", "node", nodeName, "containerCount", containers, "maxContainers", maxContainers)
+	for podRef, pod := range batch.Pods {
+		if pod.Pod.Timestamp.IsZero() {
+			continue
+		}
+		batch.Pods[podRef] = storage.PodMetricsPoint{
+			Containers: map[string]storage.MetricsPoint{api.PodAggregateContainerName: pod.Pod},
+		}
+	}
+}
+
+// isContainerSeries returns true if ts is a series of container metrics.
+func isContainerSeries(ts []byte) bool {
+	return timeseriesMatchesName(ts, containerCpuUsageMetricName) ||
+		timeseriesMatchesName(ts, containerMemUsageMetricName) ||
+		timeseriesMatchesName(ts, containerStartTimeMetricName)
 }
 
 func timeseriesMatchesName(ts, name []byte) bool {
@@ -125,45 +334,47 @@ func parseNodeMemUsageMetrics(timestamp int64, value float64, node *storage.Metr
 	node.Timestamp = time.Unix(0, timestamp*1e6)
 }
 
-func parseContainerCpuMetrics(namespaceName apitypes.NamespacedName, containerName string, timestamp int64, value float64, pods map[apitypes.NamespacedName]storage.PodMetricsPoint) {
-	if _, findPod := pods[namespaceName]; !findPod {
-		pods[namespaceName] = storage.PodMetricsPoint{Containers: make(map[string]storage.MetricsPoint)}
-	}
-	if _, findContainer := pods[namespaceName].Containers[containerName]; !findContainer {
-		pods[namespaceName].Containers[containerName] = storage.MetricsPoint{}
-	}
+func parseContainerCpuMetrics(namespaceName apitypes.NamespacedName, containerName string, timestamp int64, value float64, d *decodeState) {
+	containers := d.containers(namespaceName)
 	// unit of node_cpu_usage_seconds_total is second, need to convert to nanosecond
-	containerMetrics := pods[namespaceName].Containers[containerName]
+	containerMetrics := d.container(containers, containerName)
 	containerMetrics.CumulativeCpuUsed = uint64(value * 1e9)
 	// unit of timestamp is millisecond, need to convert to nanosecond
 	containerMetrics.Timestamp = time.Unix(0, timestamp*1e6)
-	pods[namespaceName].Containers[containerName] = containerMetrics
+	containers[containerName] = containerMetrics
 }
 
-func parseContainerMemMetrics(namespaceName apitypes.NamespacedName, containerName string, timestamp int64, value float64, pods map[apitypes.NamespacedName]storage.PodMetricsPoint) {
-	if _, findPod := pods[namespaceName]; !findPod {
-		pods[namespaceName] = storage.PodMetricsPoint{Containers: make(map[string]storage.MetricsPoint)}
-	}
-	if _, findContainer := pods[namespaceName].Containers[containerName]; !findContainer {
-		pods[namespaceName].Containers[containerName] = storage.MetricsPoint{}
-	}
-	containerMetrics := pods[namespaceName].Containers[containerName]
+func parseContainerMemMetrics(namespaceName apitypes.NamespacedName, containerName string, timestamp int64, value float64, d *decodeState) {
+	containers := d.containers(namespaceName)
+	containerMetrics := d.container(containers, containerName)
 	containerMetrics.MemoryUsage = uint64(value)
 	// unit of timestamp is millisecond, need to convert to nanosecond
 	containerMetrics.Timestamp = time.Unix(0, timestamp*1e6)
-	pods[namespaceName].Containers[containerName] = containerMetrics
+	containers[containerName] = containerMetrics
 }
 
-func parseContainerStartTimeMetrics(namespaceName apitypes.NamespacedName, containerName string, timestamp int64, value float64, pods map[apitypes.NamespacedName]storage.PodMetricsPoint) {
-	if _, findPod := pods[namespaceName]; !findPod {
-		pods[namespaceName] = storage.PodMetricsPoint{Containers: make(map[string]storage.MetricsPoint)}
-	}
-	if _, findContainer := pods[namespaceName].Containers[containerName]; !findContainer {
-		pods[namespaceName].Containers[containerName] = storage.MetricsPoint{}
-	}
-	containerMetrics := pods[namespaceName].Containers[containerName]
+func parseContainerStartTimeMetrics(namespaceName apitypes.NamespacedName, containerName string, value float64, d *decodeState) {
+	containers := d.containers(namespaceName)
+	containerMetrics := d.container(containers, containerName)
 	containerMetrics.StartTime = time.Unix(0, int64(value*1e9))
-	pods[namespaceName].Containers[containerName] = containerMetrics
+	containers[containerName] = containerMetrics
+}
+
+func parsePodCpuMetrics(namespaceName apitypes.NamespacedName, timestamp int64, value float64, pods map[apitypes.NamespacedName]storage.MetricsPoint) {
+	podMetrics := pods[namespaceName]
+	// unit of pod_cpu_usage_seconds_total is second, need to convert to nanosecond
+	podMetrics.CumulativeCpuUsed = uint64(value * 1e9)
+	// unit of timestamp is millisecond, need to convert to nanosecond
+	podMetrics.Timestamp = time.Unix(0, timestamp*1e6)
+	pods[namespaceName] = podMetrics
+}
+
+func parsePodMemMetrics(namespaceName apitypes.NamespacedName, timestamp int64, value float64, pods map[apitypes.NamespacedName]storage.MetricsPoint) {
+	podMetrics := pods[namespaceName]
+	podMetrics.MemoryUsage = uint64(value)
+	// unit of timestamp is millisecond, need to convert to nanosecond
+	podMetrics.Timestamp = time.Unix(0, timestamp*1e6)
+	pods[namespaceName] = podMetrics
 }
 
 var (
@@ -175,28 +386,68 @@ var (
 func parseContainerLabels(labels []byte) (namespaceName apitypes.NamespacedName, containerName string) {
 	i := bytes.Index(labels, containerNameTag) + len(containerNameTag)
 	j := bytes.IndexByte(labels[i:], '"')
-	containerName = string(labels[i : i+j])
+	containerName = names.Intern(labels[i : i+j])
 	i = bytes.Index(labels, podNameTag) + len(podNameTag)
 	j = bytes.IndexByte(labels[i:], '"')
-	namespaceName.Name = string(labels[i : i+j])
+	namespaceName.Name = names.Intern(labels[i : i+j])
 	i = bytes.Index(labels, namespaceTag) + len(namespaceTag)
 	j = bytes.IndexByte(labels[i:], '"')
-	namespaceName.Namespace = string(labels[i : i+j])
+	namespaceName.Namespace = names.Intern(labels[i : i+j])
 	return namespaceName, containerName
 }
 
-func checkContainerMetrics(podMetric storage.PodMetricsPoint) map[string]storage.MetricsPoint {
-	podMetrics := make(map[string]storage.MetricsPoint)
-	for containerName, containerMetric := range podMetric.Containers {
-		if containerMetric != (storage.MetricsPoint{}) {
-			// drop metrics when CumulativeCpuUsed or MemoryUsage is zero
-			if containerMetric.CumulativeCpuUsed == 0 || containerMetric.MemoryUsage == 0 {
-				klog.V(1).InfoS("Failed getting complete container metric", "containerName", containerName, "containerMetric", containerMetric)
-				return nil
-			} else {
-				podMetrics[containerName] = containerMetric
+func parsePodLabels(labels []byte) (namespaceName apitypes.NamespacedName, ok bool) {
+	namespaceName.Name, ok = internedLabelValue(labels, podNameTag)
+	if !ok {
+		return namespaceName, false
+	}
+	namespaceName.Namespace, ok = internedLabelValue(labels, namespaceTag)
+	return namespaceName, ok
+}
+
+// internedLabelValue returns the value of the label with tag, interned as it is kept in batches.
+func internedLabelValue(labels, tag []byte) (string, bool) {
+	value, ok := labelBytes(labels, tag)
+	if !ok {
+		return "", false
+	}
+	return names.Intern(value), true
+}
+
+func labelBytes(labels, tag []byte) ([]byte, bool) {
+	i := bytes.Index(labels, tag)
+	if i < 0 {
+		return nil, false
+	}
+	i += len(tag)
+	j := bytes.IndexByte(labels[i:], '"')
+	if j < 0 {
+		return nil, false
+	}
+	return labels[i : i+j], true
+}
+
+// checkContainerMetrics drops empty container points of podMetric in place
+// and returns its containers, nil if a container point is incomplete.
+func checkContainerMetrics(logger klog.Logger, podMetric storage.PodMetricsPoint, windows bool) map[string]storage.MetricsPoint {
+	podMetrics := podMetric.Containers
+	for containerName, containerMetric := range podMetrics {
+		if containerMetric == (storage.MetricsPoint{}) {
+			delete(podMetrics, containerName)
+			continue
+		}
+		// drop metrics when CumulativeCpuUsed or MemoryUsage is zero, Windows Kubelets may not report the working set
+		if containerMetric.CumulativeCpuUsed == 0 || (containerMetric.MemoryUsage == 0 && !windows) {
+			logger.V(1).Info("Failed getting complete container metric", "containerName", containerName, "containerMetric", containerMetric)
+			if windows {
+				delete(podMetrics, containerName)
+				continue
 			}
+			return nil
 		}
 	}
+	if windows && len(podMetrics) == 0 {
+		return nil
+	}
 	return podMetrics
 }
@@ -18,11 +18,14 @@ import (
 	"fmt"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/google/go-cmp/cmp"
 
 	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
 
+	"sigs.k8s.io/metrics-server/pkg/api"
 	"sigs.k8s.io/metrics-server/pkg/storage"
 )
 
@@ -36,6 +39,7 @@ func TestDecode(t *testing.T) {
 		name          string
 		input         string
 		defaultTime   time.Time
+		windows       bool
 		expectMetrics *storage.MetricsBatch
 		wantError     bool
 	}{
@@ -76,6 +80,11 @@ scrape_error 0
 				},
 				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
 					{Name: "coredns-558bd4d5db-4dpjz", Namespace: "kube-system"}: {
+						Pod: storage.MetricsPoint{
+							Timestamp:         time.Date(2021, 10, 3, 9, 36, 43, 935000000, time.UTC),
+							CumulativeCpuUsed: 4678120000,
+							MemoryUsage:       12627968,
+						},
 						Containers: map[string]storage.MetricsPoint{
 							"coredns": {
 								Timestamp:         time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC),
@@ -143,6 +152,28 @@ container_start_time_seconds{container="coredns",namespace="kube-system",pod="co
 				},
 			},
 		},
+		{
+			name: "Incomplete pod level metrics are dropped",
+			input: `
+container_cpu_usage_seconds_total{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 4.710169 1633253812125
+container_memory_working_set_bytes{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 1.253376e+07 1633253812125
+pod_cpu_usage_seconds_total{namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 4.67812 1633253803935
+`,
+			expectMetrics: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Name: "coredns-558bd4d5db-4dpjz", Namespace: "kube-system"}: {
+						Containers: map[string]storage.MetricsPoint{
+							"coredns": {
+								Timestamp:         time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC),
+								CumulativeCpuUsed: 4710169000,
+								MemoryUsage:       12533760,
+							},
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "No container CPU drops container metrics",
 			input: `
@@ -220,6 +251,69 @@ node_memory_working_set_bytes 0 1633253809720
 `,
 			expectMetrics: &emptyMetrics,
 		},
+		{
+			name: "Negative node CPU drops metric",
+			input: `
+node_cpu_usage_seconds_total -357.35491 1633253809720
+node_memory_working_set_bytes 1.616273408e+09 1633253809720
+`,
+			expectMetrics: &emptyMetrics,
+		},
+		{
+			name: "NaN container Memory drops container metrics",
+			input: `
+container_cpu_usage_seconds_total{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} 4.710169 1633253812125
+container_memory_working_set_bytes{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} NaN 1633253812125
+`,
+			expectMetrics: &emptyMetrics,
+		},
+		{
+			name: "Windows container without Memory is kept",
+			input: `
+container_cpu_usage_seconds_total{container="app",namespace="default",pod="win-1"} 4.710169 1633253812125
+container_cpu_usage_seconds_total{container="host",namespace="default",pod="win-1"} 1.5 1633253812125
+container_memory_working_set_bytes{container="app",namespace="default",pod="win-1"} 1.253376e+07 1633253812125
+`,
+			windows: true,
+			expectMetrics: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "default", Name: "win-1"}: {
+						Containers: map[string]storage.MetricsPoint{
+							"app":  {Timestamp: time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC), CumulativeCpuUsed: 4710169000, MemoryUsage: 12533760},
+							"host": {Timestamp: time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC), CumulativeCpuUsed: 1500000000},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Windows container without CPU is dropped alone",
+			input: `
+container_cpu_usage_seconds_total{container="app",namespace="default",pod="win-1"} 4.710169 1633253812125
+container_memory_working_set_bytes{container="app",namespace="default",pod="win-1"} 1.253376e+07 1633253812125
+container_memory_working_set_bytes{container="starting",namespace="default",pod="win-1"} 1e+06 1633253812125
+`,
+			windows: true,
+			expectMetrics: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "default", Name: "win-1"}: {
+						Containers: map[string]storage.MetricsPoint{
+							"app": {Timestamp: time.Date(2021, 10, 3, 9, 36, 52, 125000000, time.UTC), CumulativeCpuUsed: 4710169000, MemoryUsage: 12533760},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Windows pod without complete containers is dropped",
+			input: `
+container_memory_working_set_bytes{container="starting",namespace="default",pod="win-1"} 1e+06 1633253812125
+`,
+			windows:       true,
+			expectMetrics: &emptyMetrics,
+		},
 		{
 			name: "Containing an incorrect timestamp",
 			input: `
@@ -234,7 +328,7 @@ container_start_time_seconds{container="metrics-server",namespace="kubernetes-da
 	}
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			ms, err := decodeBatch([]byte(tc.input), tc.defaultTime, "node1")
+			ms, _, err := decodeBatch(klog.Background(), []byte(tc.input), tc.defaultTime, "node1", tc.windows, 0)
 			if (err != nil) != tc.wantError {
 				t.Fatalf("Unexpected error: %v", err)
 			}
@@ -268,7 +362,7 @@ container_memory_working_set_bytes{container="coredns",namespace="kube-system",p
 # TYPE container_start_time_seconds gauge
 container_start_time_seconds{container="coredns",namespace="kube-system",pod="coredns-558bd4d5db-4dpjz"} %E %d`,
 			cpuValue, timeStamp, memValue, timeStamp, startTimeValue, timeStamp)
-		_, err := decodeBatch([]byte(input), defaultTime, "node1")
+		_, _, err := decodeBatch(klog.Background(), []byte(input), defaultTime, "node1", false, 0)
 		if err != nil && timeStamp >= 0 {
 			t.Errorf("Unexpect error: %v\nmetrics: %s\n", err, input)
 		}
@@ -285,10 +379,139 @@ func Fuzz_decodeBatchRandom(f *testing.F) {
 	}
 	testFunc := func(t *testing.T, defaultTimeValue int64, randomInput string, nodeName string) {
 		defaultTime := time.Unix(0, defaultTimeValue)
-		_, err := decodeBatch([]byte(randomInput), defaultTime, nodeName)
+		_, _, err := decodeBatch(klog.Background(), []byte(randomInput), defaultTime, nodeName, false, 0)
 		if err != nil && randomInput == "" {
 			t.Errorf("Unexpect error: %v\nmetrics: %s\n", err, randomInput)
 		}
 	}
 	f.Fuzz(testFunc)
 }
+
+func TestDecode_ReusesDecodeState(t *testing.T) {
+	input := func(pod string) []byte {
+		return []byte(fmt.Sprintf(`container_cpu_usage_seconds_total{container="app",namespace="ns1",pod=%q} 1 1633253812125
+container_memory_working_set_bytes{container="app",namespace="ns1",pod=%q} 2 1633253812125
+`, pod, pod))
+	}
+	first, _, err := decodeBatch(klog.Background(), input("pod1"), time.Now(), "node1", false, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	second, _, err := decodeBatch(klog.Background(), input("pod2"), time.Now(), "node1", false, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(first.Pods) != 1 || len(second.Pods) != 1 {
+		t.Fatalf("Expected a pod per batch, got %v and %v", first.Pods, second.Pods)
+	}
+	pod1 := first.Pods[apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}]
+	pod2 := second.Pods[apitypes.NamespacedName{Namespace: "ns1", Name: "pod2"}]
+	if len(pod1.Containers) != 1 || len(pod2.Containers) != 1 {
+		t.Errorf("Points of a previous decode leaked, got %v and %v", pod1.Containers, pod2.Containers)
+	}
+	var firstNamespace, secondNamespace string
+	for ref := range first.Pods {
+		firstNamespace = ref.Namespace
+	}
+	for ref := range second.Pods {
+		secondNamespace = ref.Namespace
+	}
+	if unsafe.StringData(firstNamespace) != unsafe.StringData(secondNamespace) {
+		t.Error("Expected namespaces of both batches to share memory")
+	}
+}
+
+func TestDecode_MaxContainers(t *testing.T) {
+	input := []byte(`container_cpu_usage_seconds_total{container="a",namespace="ns1",pod="pod1"} 1 1633253812125
+container_cpu_usage_seconds_total{container="b",namespace="ns1",pod="pod1"} 1 1633253812125
+container_cpu_usage_seconds_total{container="a",namespace="ns1",pod="pod2"} 1 1633253812125
+container_memory_working_set_bytes{container="a",namespace="ns1",pod="pod1"} 2 1633253812125
+container_memory_working_set_bytes{container="b",namespace="ns1",pod="pod1"} 2 1633253812125
+container_memory_working_set_bytes{container="a",namespace="ns1",pod="pod2"} 2 1633253812125
+node_cpu_usage_seconds_total 10 1633253812125
+node_memory_working_set_bytes 20 1633253812125
+pod_cpu_usage_seconds_total{namespace="ns1",pod="pod1"} 2 1633253812125
+pod_memory_working_set_bytes{namespace="ns1",pod="pod1"} 4 1633253812125
+`)
+	timestamp := time.Unix(0, 1633253812125*1e6)
+	pod1 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+	pod2 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod2"}
+
+	ms, complete, err := decodeBatch(klog.Background(), input, time.Now(), "node1", false, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !complete || len(ms.Pods[pod1].Containers) != 2 || len(ms.Pods[pod2].Containers) != 1 {
+		t.Errorf("Expected containers to be decoded up to the limit, got %v", ms.Pods)
+	}
+
+	ms, complete, err = decodeBatch(klog.Background(), input, time.Now(), "node1", false, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[apitypes.NamespacedName]storage.PodMetricsPoint{
+		pod1: {Containers: map[string]storage.MetricsPoint{api.PodAggregateContainerName: {Timestamp: timestamp, CumulativeCpuUsed: 2e9, MemoryUsage: 4}}},
+	}
+	if diff := cmp.Diff(want, ms.Pods); diff != "" {
+		t.Errorf("Unexpected pods above the limit, diff:\n%s", diff)
+	}
+	if !complete || len(ms.Nodes) != 1 {
+		t.Errorf("Expected complete node metrics above the limit, got %v", ms.Nodes)
+	}
+}
+
+func TestAggregatePods(t *testing.T) {
+	now := time.Now()
+	point := func(cpu, mem uint64) storage.MetricsPoint {
+		return storage.MetricsPoint{Timestamp: now, CumulativeCpuUsed: cpu, MemoryUsage: mem}
+	}
+	batch := func() *storage.MetricsBatch {
+		return &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{"node1": point(10, 20)},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				{Namespace: "ns1", Name: "pod1"}: {
+					Pod:        point(5, 6),
+					Containers: map[string]storage.MetricsPoint{"a": point(2, 2), "b": point(2, 3)},
+				},
+				{Namespace: "ns1", Name: "pod2"}: {
+					Containers: map[string]storage.MetricsPoint{"a": point(1, 1)},
+				},
+			},
+		}
+	}
+	tcs := []struct {
+		name          string
+		maxContainers int
+		expectBatch   *storage.MetricsBatch
+	}{
+		{
+			name:          "Below limit",
+			maxContainers: 3,
+			expectBatch:   batch(),
+		},
+		{
+			name:          "Above limit",
+			maxContainers: 2,
+			expectBatch: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{"node1": point(10, 20)},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "ns1", Name: "pod1"}: {
+						Containers: map[string]storage.MetricsPoint{api.PodAggregateContainerName: point(5, 6)},
+					},
+					{Namespace: "ns1", Name: "pod2"}: {
+						Containers: map[string]storage.MetricsPoint{"a": point(1, 1)},
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := batch()
+			aggregatePods(klog.Background(), got, tc.maxContainers, "node1")
+			if diff := cmp.Diff(tc.expectBatch, got); diff != "" {
+				t.Errorf("Unexpected result, diff:\n%s", diff)
+			}
+		})
+	}
+}
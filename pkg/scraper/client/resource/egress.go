@@ -0,0 +1,41 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"fmt"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apiserver/pkg/server/egressselector"
+)
+
+// clusterDialer returns the dialer of the cluster egress selection of the
+// EgressSelectorConfiguration file at path, the one kube-apiserver uses to
+// reach Kubelets, e.g. through a Konnectivity server. A nil dialer means
+// Kubelets are dialed directly.
+func clusterDialer(path string) (utilnet.DialFunc, error) {
+	config, err := egressselector.ReadEgressSelectorConfiguration(path)
+	if err != nil {
+		return nil, err
+	}
+	if errs := egressselector.ValidateEgressSelectorConfiguration(config); len(errs) != 0 {
+		return nil, fmt.Errorf("invalid egress selector configuration %q: %v", path, errs.ToAggregate())
+	}
+	selector, err := egressselector.NewEgressSelector(config)
+	if err != nil || selector == nil {
+		return nil, err
+	}
+	return selector.Lookup(egressselector.Cluster.AsNetworkContext())
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestClusterDialer(t *testing.T) {
+	tcs := []struct {
+		name string
+		// selections is the egressSelections of the configuration, %s is replaced by the proxy socket.
+		selections  string
+		wantErr     bool
+		wantDirect  bool
+		wantTargets int
+	}{
+		{
+			name: "HTTP CONNECT over unix socket",
+			selections: `
+- name: cluster
+  connection:
+    proxyProtocol: HTTPConnect
+    transport:
+      uds:
+        udsName: %s`,
+			wantTargets: 1,
+		},
+		{
+			name: "No cluster selection",
+			selections: `
+- name: controlplane
+  connection:
+    proxyProtocol: HTTPConnect
+    transport:
+      uds:
+        udsName: %s`,
+			wantDirect: true,
+		},
+		{
+			name: "Invalid configuration",
+			selections: `
+- name: cluster
+  connection:
+    proxyProtocol: GRPC`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			kubelet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer kubelet.Close()
+			socket := filepath.Join(t.TempDir(), "konnectivity.sock")
+			proxy := newConnectProxy(t, socket)
+
+			path := filepath.Join(t.TempDir(), "egress.yaml")
+			config := "apiVersion: apiserver.k8s.io/v1beta1\nkind: EgressSelectorConfiguration\negressSelections:" + tc.selections + "\n"
+			if err := os.WriteFile(path, []byte(fmt.Sprintf(config, socket)), 0600); err != nil {
+				t.Fatal(err)
+			}
+			dial, err := clusterDialer(path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if (dial == nil) != tc.wantDirect {
+				t.Fatalf("Got dialer %v, expected direct dialing %v", dial, tc.wantDirect)
+			}
+			if dial == nil {
+				return
+			}
+			c := &http.Client{Transport: &http.Transport{DialContext: dial}}
+			resp, err := c.Get(kubelet.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if targets := proxy.targets(); len(targets) != tc.wantTargets || targets[0] != kubelet.Listener.Addr().String() {
+				t.Errorf("Got proxied targets %v, expected %s", targets, kubelet.Listener.Addr())
+			}
+		})
+	}
+}
+
+// connectProxy is a minimal HTTP CONNECT proxy like Konnectivity, recording the targets of tunnels.
+type connectProxy struct {
+	mu       sync.Mutex
+	tunneled []string
+}
+
+func newConnectProxy(t *testing.T, socket string) *connectProxy {
+	t.Helper()
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	p := &connectProxy{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.tunnel(conn)
+		}
+	}()
+	return p
+}
+
+func (p *connectProxy) tunnel(conn net.Conn) {
+	defer conn.Close()
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.Method != http.MethodConnect {
+		return
+	}
+	p.mu.Lock()
+	p.tunneled = append(p.tunneled, req.Host)
+	p.mu.Unlock()
+	target, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		fmt.Fprint(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer target.Close()
+	fmt.Fprint(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	go func() { _, _ = io.Copy(target, conn) }()
+	_, _ = io.Copy(conn, target)
+}
+
+func (p *connectProxy) targets() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.tunneled...)
+}
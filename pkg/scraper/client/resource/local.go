@@ -0,0 +1,71 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// localSocketHost is the host of requests sent over a local unix socket, which isn't resolved.
+const localSocketHost = "localhost"
+
+// ParseLocalEndpoint parses the URL of a node-local Kubelet endpoint, either
+// a unix socket, e.g. unix:///var/run/kubelet/metrics.sock, or a plain HTTP
+// loopback address, e.g. http://localhost:10255. It returns the host requests
+// are sent to and the socket path, empty for loopback addresses.
+func ParseLocalEndpoint(endpoint string) (host, socket string, err error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", err
+	}
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("unix socket URL %q has no path", endpoint)
+		}
+		return localSocketHost, u.Path, nil
+	case "http":
+		if u.Port() == "" || (u.Path != "" && u.Path != "/") {
+			return "", "", fmt.Errorf("URL %q should be a host and port without path", endpoint)
+		}
+		if !isLoopback(u.Hostname()) {
+			return "", "", fmt.Errorf("host %q of URL %q is not a loopback address", u.Hostname(), endpoint)
+		}
+		return u.Host, "", nil
+	default:
+		return "", "", fmt.Errorf("URL %q should use the unix or http scheme", endpoint)
+	}
+}
+
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// socketDialer returns a dialer connecting to the unix socket regardless of the requested address.
+func socketDialer(socket string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+}
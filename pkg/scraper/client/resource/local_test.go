@@ -0,0 +1,100 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+)
+
+func TestParseLocalEndpoint(t *testing.T) {
+	tcs := []struct {
+		endpoint   string
+		wantHost   string
+		wantSocket string
+		wantErr    bool
+	}{
+		{endpoint: "unix:///var/run/kubelet/metrics.sock", wantHost: "localhost", wantSocket: "/var/run/kubelet/metrics.sock"},
+		{endpoint: "http://localhost:10255", wantHost: "localhost:10255"},
+		{endpoint: "http://127.0.0.1:10255/", wantHost: "127.0.0.1:10255"},
+		{endpoint: "http://[::1]:10255", wantHost: "[::1]:10255"},
+		{endpoint: "unix://", wantErr: true},
+		{endpoint: "http://localhost", wantErr: true},
+		{endpoint: "http://localhost:10255/metrics/resource", wantErr: true},
+		{endpoint: "http://10.0.0.1:10255", wantErr: true},
+		{endpoint: "https://localhost:10250", wantErr: true},
+		{endpoint: "localhost:10255", wantErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.endpoint, func(t *testing.T) {
+			host, socket, err := ParseLocalEndpoint(tc.endpoint)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if host != tc.wantHost || socket != tc.wantSocket {
+				t.Errorf("Unexpected host %q and socket %q, want %q and %q", host, socket, tc.wantHost, tc.wantSocket)
+			}
+		})
+	}
+}
+
+func TestGetMetrics_LocalEndpoint(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "kubelet.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotURL string
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		gotURL = "http://" + request.Host + request.URL.Path
+		_, _ = writer.Write([]byte(resourceResponse))
+	}))
+	s.Listener = listener
+	s.Start()
+	defer s.Close()
+
+	c, err := NewForConfig(klog.Background(), &client.KubeletClientConfig{
+		Scheme:        "http",
+		LocalEndpoint: "unix://" + socket,
+		Client:        rest.Config{Timeout: 10 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The node has no address, the local endpoint is used regardless.
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	ms, err := c.GetMetrics(context.Background(), node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://localhost/metrics/resource"; gotURL != want {
+		t.Errorf("Unexpected request URL %q, want %q", gotURL, want)
+	}
+	if len(ms.Nodes) != 1 {
+		t.Errorf("No node metrics")
+	}
+}
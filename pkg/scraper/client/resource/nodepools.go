@@ -0,0 +1,137 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+// NodePoolsConfig lists node pools whose Kubelets are connected to with their
+// own CA bundle and client certificate, e.g. in clusters mixing on-premise
+// and cloud node pools whose Kubelet certificates are signed by different CAs.
+type NodePoolsConfig struct {
+	NodePools []NodePool `json:"nodePools"`
+}
+
+// NodePool overrides the TLS configuration of connections to Kubelets of nodes matching its selector.
+type NodePool struct {
+	// Name identifies the pool in logs.
+	Name string `json:"name"`
+	// NodeSelector is the label selector of nodes of the pool. Nodes matching
+	// several pools use the first one, other nodes the default configuration.
+	NodeSelector string `json:"nodeSelector"`
+	// CertificateAuthority is the path of the CA bundle validating Kubelet serving certificates, the default one if empty.
+	CertificateAuthority string `json:"certificateAuthority,omitempty"`
+	// ClientCertificate is the path of the client certificate presented to Kubelets, the default one if empty.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	// ClientKey is the path of the key of ClientCertificate.
+	ClientKey string `json:"clientKey,omitempty"`
+}
+
+// LoadNodePoolsFile reads a NodePoolsConfig in YAML or JSON from path and validates it.
+func LoadNodePoolsFile(path string) (*NodePoolsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read node pools config: %w", err)
+	}
+	config := &NodePoolsConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("unable to decode node pools config %q: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid node pools config %q: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c *NodePoolsConfig) validate() error {
+	names := map[string]bool{}
+	for i, pool := range c.NodePools {
+		if pool.Name == "" {
+			return fmt.Errorf("node pool %d has no name", i)
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("node pool %q is listed twice", pool.Name)
+		}
+		names[pool.Name] = true
+		selector, err := labels.Parse(pool.NodeSelector)
+		if err != nil {
+			return fmt.Errorf("node pool %q has an invalid node selector: %w", pool.Name, err)
+		}
+		if selector.Empty() {
+			return fmt.Errorf("node pool %q has an empty node selector, which matches all nodes", pool.Name)
+		}
+		if (pool.ClientCertificate != "") != (pool.ClientKey != "") {
+			return fmt.Errorf("node pool %q needs both clientCertificate and clientKey", pool.Name)
+		}
+		if pool.CertificateAuthority == "" && pool.ClientCertificate == "" {
+			return fmt.Errorf("node pool %q sets neither certificateAuthority nor clientCertificate", pool.Name)
+		}
+	}
+	return nil
+}
+
+// restConfig returns a copy of config with the CA bundle and client certificate of the pool.
+func (p NodePool) restConfig(config *rest.Config) *rest.Config {
+	c := rest.CopyConfig(config)
+	if p.CertificateAuthority != "" {
+		c.TLSClientConfig.Insecure = false
+		c.TLSClientConfig.CAFile = p.CertificateAuthority
+		c.TLSClientConfig.CAData = nil
+	}
+	if p.ClientCertificate != "" {
+		c.TLSClientConfig.CertFile = p.ClientCertificate
+		c.TLSClientConfig.CertData = nil
+		c.TLSClientConfig.KeyFile = p.ClientKey
+		c.TLSClientConfig.KeyData = nil
+	}
+	return c
+}
+
+// nodePoolClient sends requests to Kubelets of nodes matching selector.
+type nodePoolClient struct {
+	name     string
+	selector labels.Selector
+	client   *http.Client
+}
+
+type nodeClientKey struct{}
+
+// withNodeClient returns a context in which requests are sent with the client of the node pool of node.
+func (kc *kubeletClient) withNodeClient(ctx context.Context, node *corev1.Node) context.Context {
+	set := labels.Set(node.Labels)
+	for _, pool := range kc.nodePools {
+		if pool.selector.Matches(set) {
+			return context.WithValue(ctx, nodeClientKey{}, pool.client)
+		}
+	}
+	return ctx
+}
+
+// clientFor returns the client of the node pool requests of ctx are sent to, the default client if none.
+func (kc *kubeletClient) clientFor(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(nodeClientKey{}).(*http.Client); ok {
+		return c
+	}
+	return kc.client
+}
@@ -0,0 +1,187 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+func TestLoadNodePoolsFile(t *testing.T) {
+	tcs := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{
+			name: "CA bundle and client certificate",
+			config: `
+nodePools:
+- name: onprem
+  nodeSelector: pool=onprem
+  certificateAuthority: /etc/kubelet-ca/onprem.crt
+  clientCertificate: /etc/kubelet-client/onprem.crt
+  clientKey: /etc/kubelet-client/onprem.key
+- name: cloud
+  nodeSelector: pool in (aws, gcp)
+  certificateAuthority: /etc/kubelet-ca/cloud.crt`,
+		},
+		{
+			name: "Unknown field",
+			config: `
+nodePools:
+- name: onprem
+  nodeSelector: pool=onprem
+  ca: /etc/kubelet-ca/onprem.crt`,
+			wantErr: true,
+		},
+		{
+			name: "Duplicated name",
+			config: `
+nodePools:
+- name: onprem
+  nodeSelector: pool=onprem
+  certificateAuthority: /etc/kubelet-ca/onprem.crt
+- name: onprem
+  nodeSelector: pool=cloud
+  certificateAuthority: /etc/kubelet-ca/cloud.crt`,
+			wantErr: true,
+		},
+		{
+			name: "Empty selector",
+			config: `
+nodePools:
+- name: onprem
+  certificateAuthority: /etc/kubelet-ca/onprem.crt`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid selector",
+			config: `
+nodePools:
+- name: onprem
+  nodeSelector: pool in (onprem
+  certificateAuthority: /etc/kubelet-ca/onprem.crt`,
+			wantErr: true,
+		},
+		{
+			name: "Client certificate without key",
+			config: `
+nodePools:
+- name: onprem
+  nodeSelector: pool=onprem
+  clientCertificate: /etc/kubelet-client/onprem.crt`,
+			wantErr: true,
+		},
+		{
+			name: "Nothing overridden",
+			config: `
+nodePools:
+- name: onprem
+  nodeSelector: pool=onprem`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "node-pools.yaml")
+			if err := os.WriteFile(path, []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadNodePoolsFile(path)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNodePools(t *testing.T) {
+	kubelet := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer kubelet.Close()
+	u, err := url.Parse(kubelet.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	ca := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: kubelet.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "node-pools.yaml")
+	pools := "nodePools:\n- name: onprem\n  nodeSelector: pool=onprem\n  certificateAuthority: " + ca + "\n"
+	if err := os.WriteFile(config, []byte(pools), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kc, err := NewForConfig(klog.Background(), &client.KubeletClientConfig{
+		Client:              rest.Config{},
+		Scheme:              "https",
+		DefaultPort:         port,
+		AddressTypePriority: utils.DefaultAddressTypePriority,
+		NodePoolsConfigFile: config,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tcs := []struct {
+		name    string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "Node of the pool is validated with the pool CA bundle",
+			labels: map[string]string{"pool": "onprem"},
+		},
+		{
+			name:    "Other nodes are validated with the default CA bundle",
+			labels:  map[string]string{"pool": "cloud"},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			node := &corev1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: tc.labels},
+				Status: corev1.NodeStatus{
+					Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "127.0.0.1"}},
+				},
+			}
+			_, err := kc.GetMetrics(context.Background(), node)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+// nodeStateTTL is how long state of nodes no longer scraped is kept.
+const nodeStateTTL = time.Hour
+
+var clockSkew = metrics.NewGaugeVec(
+	&metrics.GaugeOpts{
+		Namespace: "metrics_server",
+		Subsystem: "kubelet",
+		Name:      "clock_skew_seconds",
+		Help:      "Skew of Kubelet clocks relative to the metrics-server clock, estimated from the Date header of their last response, per node or node hash bucket",
+	},
+	[]string{"node"},
+)
+
+// estimateSkew returns how far the clock of a Kubelet is ahead of ours,
+// comparing the Date header of its response with the middle of the request.
+func estimateSkew(header http.Header, sent, received time.Time) (time.Duration, bool) {
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return 0, false
+	}
+	// Date has a second resolution, it is truncated by half a second on average.
+	return date.Add(time.Second / 2).Sub(sent.Add(received.Sub(sent) / 2)), true
+}
+
+// skewCorrection shifts timestamps of metrics of Kubelets with skewed clocks
+// to the metrics-server clock, so metric windows and CPU rates computed from
+// timestamps of different sources are right. The offset of a node only
+// changes when its estimated skew drifts from it by more than tolerance, so
+// estimation noise doesn't shift consecutive points differently.
+type skewCorrection struct {
+	// tolerance is the skew left uncorrected, 0 disables the correction.
+	tolerance time.Duration
+	// nodeLabels maps nodes to the node label of per-node metrics.
+	nodeLabels utils.NodeLabels
+
+	mu sync.Mutex
+	// offsets holds the offset subtracted from timestamps of each node.
+	offsets map[string]skewOffset
+	pruned  time.Time
+}
+
+type skewOffset struct {
+	offset time.Duration
+	seen   time.Time
+}
+
+// observe records the estimated clock skew of node at now.
+func (c *skewCorrection) observe(logger klog.Logger, node string, skew time.Duration, now time.Time) {
+	clockSkew.WithLabelValues(c.nodeLabels.Label(node)).Set(skew.Seconds())
+	if c.tolerance == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune(now)
+	if c.offsets == nil {
+		c.offsets = map[string]skewOffset{}
+	}
+	o := c.offsets[node]
+	if abs(skew-o.offset) > c.tolerance {
+		if abs(skew) > c.tolerance {
+			logger.Info("Kubelet clock is skewed, correcting timestamps of its metrics", "node", klog.KRef("", node), "skew", skew)
+			o.offset = skew
+		} else {
+			logger.Info("Kubelet clock skew is within tolerance, no longer correcting timestamps of its metrics", "node", klog.KRef("", node), "skew", skew)
+			o.offset = 0
+		}
+	}
+	o.seen = now
+	c.offsets[node] = o
+}
+
+// correct shifts timestamps of metrics of node in ms by its current offset.
+func (c *skewCorrection) correct(node string, ms *storage.MetricsBatch) {
+	if c.tolerance == 0 {
+		return
+	}
+	c.mu.Lock()
+	offset := c.offsets[node].offset
+	c.mu.Unlock()
+	if offset == 0 {
+		return
+	}
+	for name, point := range ms.Nodes {
+		ms.Nodes[name] = shift(point, offset)
+	}
+	for ref, pod := range ms.Pods {
+		if !pod.Pod.Timestamp.IsZero() {
+			pod.Pod = shift(pod.Pod, offset)
+		}
+		for name, point := range pod.Containers {
+			pod.Containers[name] = shift(point, offset)
+		}
+		ms.Pods[ref] = pod
+	}
+}
+
+func shift(point storage.MetricsPoint, offset time.Duration) storage.MetricsPoint {
+	point.Timestamp = point.Timestamp.Add(-offset)
+	if !point.StartTime.IsZero() {
+		point.StartTime = point.StartTime.Add(-offset)
+	}
+	return point
+}
+
+// prune drops offsets of nodes not scraped within nodeStateTTL, at most once per nodeStateTTL.
+func (c *skewCorrection) prune(now time.Time) {
+	if now.Sub(c.pruned) < nodeStateTTL {
+		return
+	}
+	c.pruned = now
+	for name, o := range c.offsets {
+		if now.Sub(o.seen) > nodeStateTTL {
+			delete(c.offsets, name)
+		}
+	}
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+func TestEstimateSkew(t *testing.T) {
+	sent := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	tcs := []struct {
+		name      string
+		date      string
+		wantSkew  time.Duration
+		wantFound bool
+	}{
+		{
+			name:      "Synchronized",
+			date:      "Thu, 01 Jun 2023 12:00:00 GMT",
+			wantSkew:  0,
+			wantFound: true,
+		},
+		{
+			name:      "Ahead",
+			date:      "Thu, 01 Jun 2023 12:01:00 GMT",
+			wantSkew:  time.Minute,
+			wantFound: true,
+		},
+		{
+			name:      "Behind",
+			date:      "Thu, 01 Jun 2023 11:59:00 GMT",
+			wantSkew:  -time.Minute,
+			wantFound: true,
+		},
+		{
+			name: "No Date header",
+		},
+		{
+			name: "Invalid Date header",
+			date: "yesterday",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			if tc.date != "" {
+				header.Set("Date", tc.date)
+			}
+			skew, found := estimateSkew(header, sent, sent.Add(time.Second))
+			if found != tc.wantFound || skew != tc.wantSkew {
+				t.Errorf("Unexpected skew %v, %v, want %v, %v", skew, found, tc.wantSkew, tc.wantFound)
+			}
+		})
+	}
+}
+
+func TestSkewCorrection(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	tcs := []struct {
+		name       string
+		tolerance  time.Duration
+		skews      []time.Duration
+		wantOffset time.Duration
+	}{
+		{
+			name:       "Skew within tolerance is ignored",
+			tolerance:  2 * time.Second,
+			skews:      []time.Duration{time.Second, -time.Second},
+			wantOffset: 0,
+		},
+		{
+			name:       "Skew above tolerance is corrected",
+			tolerance:  2 * time.Second,
+			skews:      []time.Duration{time.Minute},
+			wantOffset: time.Minute,
+		},
+		{
+			name:       "Offset is kept while skew is within tolerance of it",
+			tolerance:  2 * time.Second,
+			skews:      []time.Duration{time.Minute, time.Minute + time.Second, time.Minute - time.Second},
+			wantOffset: time.Minute,
+		},
+		{
+			name:       "Offset follows drifting skew",
+			tolerance:  2 * time.Second,
+			skews:      []time.Duration{time.Minute, 2 * time.Minute},
+			wantOffset: 2 * time.Minute,
+		},
+		{
+			name:       "Correction stops when clock is synchronized",
+			tolerance:  2 * time.Second,
+			skews:      []time.Duration{time.Minute, time.Second},
+			wantOffset: 0,
+		},
+		{
+			name:       "Correction disabled",
+			skews:      []time.Duration{time.Minute},
+			wantOffset: 0,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := skewCorrection{tolerance: tc.tolerance}
+			for _, skew := range tc.skews {
+				c.observe(klog.Background(), "node1", skew, now)
+			}
+			point := storage.MetricsPoint{StartTime: now.Add(-time.Hour), Timestamp: now, CumulativeCpuUsed: 1, MemoryUsage: 1}
+			pod := apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+			ms := &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{"node1": point},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					pod: {Containers: map[string]storage.MetricsPoint{"app": point}},
+				},
+			}
+			c.correct("node1", ms)
+			want := storage.MetricsPoint{StartTime: now.Add(-time.Hour - tc.wantOffset), Timestamp: now.Add(-tc.wantOffset), CumulativeCpuUsed: 1, MemoryUsage: 1}
+			if diff := cmp.Diff(want, ms.Nodes["node1"]); diff != "" {
+				t.Errorf("Unexpected node point, diff:\n%s", diff)
+			}
+			if diff := cmp.Diff(want, ms.Pods[pod].Containers["app"]); diff != "" {
+				t.Errorf("Unexpected container point, diff:\n%s", diff)
+			}
+			if !ms.Pods[pod].Pod.Timestamp.IsZero() {
+				t.Errorf("Unexpected pod level point %+v", ms.Pods[pod].Pod)
+			}
+		})
+	}
+}
+
+func TestGetMetrics_ClockSkew(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		_, _ = writer.Write([]byte(resourceResponse))
+	}))
+	defer s.Close()
+	c := newClient(s.Client(), nil, 0, "http", false)
+	c.skew.tolerance = 2 * time.Second
+
+	ms, _, err := c.getMetrics(context.Background(), s.URL, "node1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reported := ms.Nodes["node1"].Timestamp
+	c.skew.correct("node1", ms)
+	if shift := reported.Sub(ms.Nodes["node1"].Timestamp); shift < time.Hour-2*time.Second || shift > time.Hour+2*time.Second {
+		t.Errorf("Unexpected timestamp shift %v, want about 1h", shift)
+	}
+}
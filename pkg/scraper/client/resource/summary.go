@@ -0,0 +1,186 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// summary is the subset of the Kubelet Summary API (stats/v1alpha1) needed
+// to report persistent volume claim usage, process counts and filesystem usage.
+type summary struct {
+	Node nodeStats  `json:"node"`
+	Pods []podStats `json:"pods"`
+}
+
+type nodeStats struct {
+	Rlimit *struct {
+		NumOfRunningProcesses *uint64 `json:"curproc"`
+	} `json:"rlimit"`
+	Fs      *fsStats `json:"fs"`
+	Runtime *struct {
+		ImageFs     *fsStats `json:"imageFs"`
+		ContainerFs *fsStats `json:"containerFs"`
+	} `json:"runtime"`
+}
+
+type podStats struct {
+	PodRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"podRef"`
+	Volumes      []volumeStats `json:"volume"`
+	ProcessStats *struct {
+		ProcessCount *uint64 `json:"process_count"`
+	} `json:"process_stats"`
+	EphemeralStorage *fsStats `json:"ephemeral-storage"`
+}
+
+type fsStats struct {
+	CapacityBytes  *uint64 `json:"capacityBytes"`
+	AvailableBytes *uint64 `json:"availableBytes"`
+	UsedBytes      *uint64 `json:"usedBytes"`
+}
+
+type volumeStats struct {
+	PVCRef *struct {
+		Name string `json:"name"`
+	} `json:"pvcRef"`
+	CapacityBytes *uint64 `json:"capacityBytes"`
+	UsedBytes     *uint64 `json:"usedBytes"`
+}
+
+func (kc *kubeletClient) getSummary(ctx context.Context, url string) (*summary, error) {
+	response, err := kc.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Close()
+	s := &summary{}
+	body := &countingReader{r: response}
+	err = json.NewDecoder(body).Decode(s)
+	client.AddResponseSize(ctx, body.n)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode summary - %v", err)
+	}
+	return s, nil
+}
+
+// countingReader counts bytes read from a response body.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// applySummary adds stats enabled on the client from the Summary API to
+// points already present in the batch.
+func (kc *kubeletClient) applySummary(ms *storage.MetricsBatch, s *summary, nodeName string) {
+	if kc.processStats {
+		if node, found := ms.Nodes[nodeName]; found && s.Node.Rlimit != nil && s.Node.Rlimit.NumOfRunningProcesses != nil {
+			node.ProcessCount = *s.Node.Rlimit.NumOfRunningProcesses
+			ms.Nodes[nodeName] = node
+		}
+	}
+	if kc.filesystemStats {
+		if filesystems := decodeNodeFilesystems(s.Node); len(filesystems) != 0 {
+			if ms.NodeFilesystems == nil {
+				ms.NodeFilesystems = map[string][]storage.FilesystemMetricsPoint{}
+			}
+			ms.NodeFilesystems[nodeName] = filesystems
+		}
+	}
+	for _, podStats := range s.Pods {
+		podRef := apitypes.NamespacedName{Name: podStats.PodRef.Name, Namespace: podStats.PodRef.Namespace}
+		pod, found := ms.Pods[podRef]
+		if !found {
+			continue
+		}
+		if kc.volumeStats {
+			pod.Volumes = decodeVolumeStats(podStats.Volumes)
+		}
+		if kc.processStats && podStats.ProcessStats != nil && podStats.ProcessStats.ProcessCount != nil {
+			pod.ProcessCount = *podStats.ProcessStats.ProcessCount
+		}
+		if kc.filesystemStats {
+			if fs, ok := decodeFsStats(storage.FilesystemEphemeralStorage, podStats.EphemeralStorage); ok {
+				pod.Filesystems = []storage.FilesystemMetricsPoint{fs}
+			}
+		}
+		ms.Pods[podRef] = pod
+	}
+}
+
+// decodeVolumeStats returns usage of volumes backed by a persistent volume
+// claim. Volumes without reported usage are skipped.
+func decodeVolumeStats(volumes []volumeStats) []storage.VolumeMetricsPoint {
+	var res []storage.VolumeMetricsPoint
+	for _, volume := range volumes {
+		if volume.PVCRef == nil || volume.CapacityBytes == nil || volume.UsedBytes == nil {
+			continue
+		}
+		res = append(res, storage.VolumeMetricsPoint{
+			ClaimName:     volume.PVCRef.Name,
+			CapacityBytes: *volume.CapacityBytes,
+			UsedBytes:     *volume.UsedBytes,
+		})
+	}
+	return res
+}
+
+// decodeNodeFilesystems returns usage of the node filesystems. containerfs is
+// only reported by runtimes storing writable layers apart from images.
+func decodeNodeFilesystems(node nodeStats) []storage.FilesystemMetricsPoint {
+	var res []storage.FilesystemMetricsPoint
+	add := func(name string, stats *fsStats) {
+		if fs, ok := decodeFsStats(name, stats); ok {
+			res = append(res, fs)
+		}
+	}
+	add(storage.FilesystemNode, node.Fs)
+	if node.Runtime != nil {
+		add(storage.FilesystemImage, node.Runtime.ImageFs)
+		add(storage.FilesystemContainer, node.Runtime.ContainerFs)
+	}
+	return res
+}
+
+// decodeFsStats returns usage of a filesystem, false if its usage isn't reported.
+func decodeFsStats(name string, stats *fsStats) (storage.FilesystemMetricsPoint, bool) {
+	if stats == nil || stats.UsedBytes == nil {
+		return storage.FilesystemMetricsPoint{}, false
+	}
+	fs := storage.FilesystemMetricsPoint{Name: name, UsedBytes: *stats.UsedBytes}
+	if stats.CapacityBytes != nil {
+		fs.CapacityBytes = *stats.CapacityBytes
+	}
+	if stats.AvailableBytes != nil {
+		fs.AvailableBytes = *stats.AvailableBytes
+	}
+	return fs, true
+}
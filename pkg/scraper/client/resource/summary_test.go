@@ -0,0 +1,141 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+func TestGetSummary(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(summaryResponse))
+	}))
+	defer s.Close()
+
+	c := newClient(s.Client(), nil, 0, "http", false)
+	c.volumeStats = true
+	c.processStats = true
+
+	summary, err := c.getSummary(context.Background(), s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := apitypes.NamespacedName{Namespace: "default", Name: "db-0"}
+	web := apitypes.NamespacedName{Namespace: "default", Name: "web-1"}
+	got := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{"node1": {MemoryUsage: 1}},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			db:  {},
+			web: {},
+		},
+	}
+	c.applySummary(got, summary, "node1")
+	want := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{"node1": {MemoryUsage: 1, ProcessCount: 412}},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			db: {
+				Volumes: []storage.VolumeMetricsPoint{
+					{ClaimName: "data-db-0", CapacityBytes: 10726932480, UsedBytes: 1528872960},
+				},
+				ProcessCount: 7,
+			},
+			web: {},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected result, diff:\n%s", diff)
+	}
+}
+
+func TestGetSummary_FilesystemStats(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(summaryResponse))
+	}))
+	defer s.Close()
+
+	c := newClient(s.Client(), nil, 0, "http", false)
+	c.filesystemStats = true
+
+	summary, err := c.getSummary(context.Background(), s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := apitypes.NamespacedName{Namespace: "default", Name: "db-0"}
+	web := apitypes.NamespacedName{Namespace: "default", Name: "web-1"}
+	got := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{"node1": {MemoryUsage: 1}},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			db:  {},
+			web: {},
+		},
+	}
+	c.applySummary(got, summary, "node1")
+	want := &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{"node1": {MemoryUsage: 1}},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			db: {
+				Filesystems: []storage.FilesystemMetricsPoint{
+					{Name: storage.FilesystemEphemeralStorage, CapacityBytes: 100000000000, AvailableBytes: 60000000000, UsedBytes: 52000000},
+				},
+			},
+			web: {},
+		},
+		NodeFilesystems: map[string][]storage.FilesystemMetricsPoint{
+			"node1": {
+				{Name: storage.FilesystemNode, CapacityBytes: 100000000000, AvailableBytes: 60000000000, UsedBytes: 40000000000},
+				{Name: storage.FilesystemImage, CapacityBytes: 100000000000, AvailableBytes: 60000000000, UsedBytes: 8000000000},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected result, diff:\n%s", diff)
+	}
+}
+
+const summaryResponse = `{
+  "node": {
+    "nodeName": "node1",
+    "rlimit": {"time": "2023-06-01T10:00:00Z", "maxpid": 4194304, "curproc": 412},
+    "fs": {"availableBytes": 60000000000, "capacityBytes": 100000000000, "usedBytes": 40000000000},
+    "runtime": {"imageFs": {"availableBytes": 60000000000, "capacityBytes": 100000000000, "usedBytes": 8000000000}}
+  },
+  "pods": [
+    {
+      "podRef": {"name": "db-0", "namespace": "default", "uid": "8f3c"},
+      "process_stats": {"process_count": 7},
+      "ephemeral-storage": {"availableBytes": 60000000000, "capacityBytes": 100000000000, "usedBytes": 52000000},
+      "volume": [
+        {"name": "kube-api-access", "capacityBytes": 8282824704, "usedBytes": 12288},
+        {"name": "data", "capacityBytes": 10726932480, "usedBytes": 1528872960, "pvcRef": {"name": "data-db-0", "namespace": "default"}},
+        {"name": "pending", "pvcRef": {"name": "pending", "namespace": "default"}}
+      ]
+    },
+    {
+      "podRef": {"name": "web-1", "namespace": "default", "uid": "17ab"}
+    },
+    {
+      "podRef": {"name": "completed", "namespace": "default", "uid": "42cd"},
+      "process_stats": {"process_count": 0}
+    }
+  ]
+}`
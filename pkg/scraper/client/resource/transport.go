@@ -0,0 +1,319 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/connrotation"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+)
+
+var (
+	tlsHandshakes = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "tls_handshakes_total",
+			Help:      "Number of TLS handshakes with Kubelets, by whether a cached session was resumed",
+		},
+		[]string{"resumed"},
+	)
+	tlsSessionsFlushed = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "tls_sessions_flushed_total",
+			Help:      "Number of cached TLS sessions of Kubelets dropped, by reason: invalid after a failed resumption or expiry, capacity to cache a newer session, rotated after the client certificate changed",
+		},
+		[]string{"reason"},
+	)
+)
+
+const (
+	flushInvalid  = "invalid"
+	flushCapacity = "capacity"
+	flushRotated  = "rotated"
+)
+
+// certRotationCheckInterval is how often the client certificate is checked
+// for changes while connections are idle, as client-go does.
+var certRotationCheckInterval = 5 * time.Minute
+
+// RegisterClientMetrics registers metrics of connections to Kubelets.
+func RegisterClientMetrics(registrationFunc func(metrics.Registerable) error) error {
+	for _, metric := range []metrics.Registerable{tlsHandshakes, tlsSessionsFlushed, receivedBytes, rejectedSamples, clockSkew} {
+		if err := registrationFunc(metric); err != nil {
+			return err
+		}
+	}
+	for _, reason := range []string{flushInvalid, flushCapacity, flushRotated} {
+		tlsSessionsFlushed.WithLabelValues(reason)
+	}
+	return nil
+}
+
+// DefaultMaxIdleConnsPerNode matches the transports built by client-go.
+const DefaultMaxIdleConnsPerNode = 25
+
+// DefaultIdleConnTimeout matches http.DefaultTransport.
+const DefaultIdleConnTimeout = 90 * time.Second
+
+// connPool configures reuse of connections to Kubelets.
+type connPool struct {
+	// sessionCacheSize is the number of Kubelets TLS sessions are cached for, 0 disables resumption.
+	sessionCacheSize int
+	// maxIdleConnsPerNode is the number of idle connections kept per Kubelet, DefaultMaxIdleConnsPerNode if 0.
+	maxIdleConnsPerNode int
+	// idleConnTimeout is how long idle connections are kept, DefaultIdleConnTimeout if 0.
+	idleConnTimeout time.Duration
+}
+
+// newTransport returns a transport with the TLS and authentication options of
+// config. Idle connections are kept according to pool, so scrape cycles reuse
+// them, over HTTP/2 if Kubelets support it. Unlike transports built by
+// client-go, TLS sessions are cached for pool.sessionCacheSize Kubelets, so
+// reconnecting resumes them instead of doing a full handshake. Sessions
+// refused by a Kubelet, e.g. after it restarted, are flushed and replaced by
+// the session of the new handshake. If clientCert isn't nil, the client
+// certificate it returns is presented instead of the one of config. When the
+// client certificate changes, connections are closed and cached sessions
+// flushed, so Kubelets authenticate the new one.
+func newTransport(logger klog.Logger, config *rest.Config, pool connPool, clientCert func() *tls.Certificate) (http.RoundTripper, error) {
+	tlsConfig, err := rest.TLSConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if clientCert != nil {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := clientCert(); cert != nil {
+				return cert, nil
+			}
+			// No certificate was issued yet, the Kubelet refuses the request.
+			return &tls.Certificate{}, nil
+		}
+	}
+	var sessions *sessionCache
+	if pool.sessionCacheSize > 0 {
+		sessions = newSessionCache(pool.sessionCacheSize)
+		tlsConfig.ClientSessionCache = sessions
+	}
+	verify := tlsConfig.VerifyConnection
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		tlsHandshakes.WithLabelValues(strconv.FormatBool(cs.DidResume)).Inc()
+		return nil
+	}
+	dial := config.Dial
+	if dial == nil {
+		dial = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if tlsConfig.GetClientCertificate != nil {
+		rotation := newCertRotation(logger, tlsConfig.GetClientCertificate, dial, sessions)
+		tlsConfig.GetClientCertificate = rotation.GetClientCertificate
+		dial = rotation.DialContext
+		go wait.Forever(rotation.check, certRotationCheckInterval)
+	}
+	maxIdleConnsPerNode := pool.maxIdleConnsPerNode
+	if maxIdleConnsPerNode == 0 {
+		maxIdleConnsPerNode = DefaultMaxIdleConnsPerNode
+	}
+	idleConnTimeout := pool.idleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = DefaultIdleConnTimeout
+	}
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != nil {
+		proxy = config.Proxy
+	}
+	transport := utilnet.SetTransportDefaults(&http.Transport{
+		Proxy:               proxy,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: maxIdleConnsPerNode,
+		IdleConnTimeout:     idleConnTimeout,
+		DialContext:         dial,
+		DisableCompression:  config.DisableCompression,
+	})
+	return rest.HTTPWrappersForConfig(config, transport)
+}
+
+// sessionCache is a LRU cache of TLS sessions counting the sessions it drops.
+// crypto/tls removes a session when resuming it fails or it expired, which
+// is counted only if the session was cached.
+type sessionCache struct {
+	lock     sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type sessionCacheEntry struct {
+	key   string
+	state *tls.ClientSessionState
+}
+
+var _ tls.ClientSessionCache = (*sessionCache)(nil)
+
+func newSessionCache(capacity int) *sessionCache {
+	return &sessionCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *sessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, found := c.entries[sessionKey]
+	if !found {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*sessionCacheEntry).state, true
+}
+
+func (c *sessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, found := c.entries[sessionKey]
+	if cs == nil {
+		if found {
+			c.order.Remove(elem)
+			delete(c.entries, sessionKey)
+			tlsSessionsFlushed.WithLabelValues(flushInvalid).Inc()
+		}
+		return
+	}
+	if found {
+		elem.Value.(*sessionCacheEntry).state = cs
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*sessionCacheEntry).key)
+		tlsSessionsFlushed.WithLabelValues(flushCapacity).Inc()
+	}
+	c.entries[sessionKey] = c.order.PushFront(&sessionCacheEntry{key: sessionKey, state: cs})
+}
+
+// flush drops all cached sessions.
+func (c *sessionCache) flush() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tlsSessionsFlushed.WithLabelValues(flushRotated).Add(float64(c.order.Len()))
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// certRotation closes connections it dialed and flushes cached sessions when
+// the client certificate changes, like client-go does for certificates
+// reloaded from files. Resuming a session skips presenting a certificate, so
+// without flushing Kubelets would keep authenticating the previous one.
+type certRotation struct {
+	logger   klog.Logger
+	get      func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+	dialer   *connrotation.Dialer
+	sessions *sessionCache
+
+	lock    sync.Mutex
+	current *tls.Certificate
+}
+
+func newCertRotation(logger klog.Logger, get func(*tls.CertificateRequestInfo) (*tls.Certificate, error), dial utilnet.DialFunc, sessions *sessionCache) *certRotation {
+	return &certRotation{
+		logger:   logger,
+		get:      get,
+		dialer:   connrotation.NewDialer(connrotation.DialFunc(dial)),
+		sessions: sessions,
+	}
+}
+
+// DialContext checks the client certificate before dialing, so the new
+// connection doesn't resume a session of a replaced certificate.
+func (r *certRotation) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	r.check()
+	return r.dialer.DialContext(ctx, network, address)
+}
+
+func (r *certRotation) GetClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	cert, err := r.get(info)
+	if err != nil {
+		return nil, err
+	}
+	r.update(cert)
+	return cert, nil
+}
+
+func (r *certRotation) check() {
+	cert, err := r.get(nil)
+	if err != nil {
+		return
+	}
+	r.update(cert)
+}
+
+func (r *certRotation) update(cert *tls.Certificate) {
+	r.lock.Lock()
+	previous := r.current
+	r.current = cert
+	r.lock.Unlock()
+	// The first certificate is not a rotation.
+	if previous == nil || sameCertificate(previous, cert) {
+		return
+	}
+	r.logger.V(1).Info("Client certificate of Kubelet connections rotated, closing connections")
+	if r.sessions != nil {
+		r.sessions.flush()
+	}
+	r.dialer.CloseAll()
+}
+
+func sameCertificate(a, b *tls.Certificate) bool {
+	if len(a.Certificate) != len(b.Certificate) {
+		return false
+	}
+	for i := range a.Certificate {
+		if !bytes.Equal(a.Certificate[i], b.Certificate[i]) {
+			return false
+		}
+	}
+	return true
+}
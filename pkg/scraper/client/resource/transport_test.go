@@ -0,0 +1,264 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/cert"
+	"k8s.io/component-base/metrics/testutil"
+	"k8s.io/klog/v2"
+)
+
+func TestNewTransport_SessionResumption(t *testing.T) {
+	tcs := []struct {
+		name             string
+		sessionCacheSize int
+		wantResumed      float64
+		wantFull         float64
+	}{
+		{
+			name:             "Resumption enabled",
+			sessionCacheSize: 10,
+			wantResumed:      2,
+			wantFull:         1,
+		},
+		{
+			name:             "Resumption disabled",
+			sessionCacheSize: 0,
+			wantResumed:      0,
+			wantFull:         3,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tlsHandshakes.Create(nil)
+			tlsHandshakes.Reset()
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// Force a new connection for every request.
+				w.Header().Set("Connection", "close")
+			}))
+			defer server.Close()
+
+			transport, err := newTransport(klog.Background(), &rest.Config{TLSClientConfig: rest.TLSClientConfig{Insecure: true}}, connPool{sessionCacheSize: tc.sessionCacheSize}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &http.Client{Transport: transport}
+			for i := 0; i < 3; i++ {
+				resp, err := c.Get(server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+			}
+
+			resumed, err := testutil.GetCounterMetricValue(tlsHandshakes.WithLabelValues("true"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			full, err := testutil.GetCounterMetricValue(tlsHandshakes.WithLabelValues("false"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resumed != tc.wantResumed || full != tc.wantFull {
+				t.Errorf("Got %v resumed and %v full handshakes, expected %v and %v", resumed, full, tc.wantResumed, tc.wantFull)
+			}
+		})
+	}
+}
+
+func TestNewTransport_IdleConnections(t *testing.T) {
+	tcs := []struct {
+		name            string
+		idleConnTimeout time.Duration
+		wantConns       int32
+	}{
+		{
+			name:            "Connection reused while idle",
+			idleConnTimeout: time.Minute,
+			wantConns:       1,
+		},
+		{
+			name:            "Connection closed after idle timeout",
+			idleConnTimeout: 10 * time.Millisecond,
+			wantConns:       2,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var conns atomic.Int32
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			transport, err := newTransport(klog.Background(), &rest.Config{TLSClientConfig: rest.TLSClientConfig{Insecure: true}}, connPool{idleConnTimeout: tc.idleConnTimeout}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &http.Client{Transport: transport}
+			for i := 0; i < 2; i++ {
+				resp, err := c.Get(server.URL)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				time.Sleep(50 * time.Millisecond)
+			}
+			if got := conns.Load(); got != tc.wantConns {
+				t.Errorf("Got %d connections, expected %d", got, tc.wantConns)
+			}
+		})
+	}
+}
+
+func TestNewTransport_ClientCertificate(t *testing.T) {
+	var commonName atomic.Value
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commonName.Store(r.TLS.PeerCertificates[0].Subject.CommonName)
+		w.Header().Set("Connection", "close")
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	var current atomic.Pointer[tls.Certificate]
+	transport, err := newTransport(klog.Background(), &rest.Config{TLSClientConfig: rest.TLSClientConfig{Insecure: true}}, connPool{}, current.Load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &http.Client{Transport: transport}
+	if resp, err := c.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected request without issued certificate to fail")
+	}
+
+	certPEM, keyPEM, err := cert.GenerateSelfSignedCertKey("metrics-server", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Store(&issued)
+	resp, err := c.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	leaf, err := x509.ParseCertificate(issued.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := commonName.Load(); got != leaf.Subject.CommonName {
+		t.Errorf("Got client certificate of %v, expected %v", got, leaf.Subject.CommonName)
+	}
+}
+
+func TestNewTransport_ClientCertificateRotation(t *testing.T) {
+	tlsSessionsFlushed.Create(nil)
+	tlsSessionsFlushed.Reset()
+	var commonName atomic.Value
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commonName.Store(r.TLS.PeerCertificates[0].Subject.CommonName)
+		// Force a new connection for every request, resuming the session.
+		w.Header().Set("Connection", "close")
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	var current atomic.Pointer[tls.Certificate]
+	transport, err := newTransport(klog.Background(), &rest.Config{TLSClientConfig: rest.TLSClientConfig{Insecure: true}}, connPool{sessionCacheSize: 10}, current.Load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &http.Client{Transport: transport}
+	var issuedName string
+	for _, name := range []string{"first", "first", "rotated"} {
+		if name != issuedName {
+			issuedName = name
+			certPEM, keyPEM, err := cert.GenerateSelfSignedCertKey(name, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			issued, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			current.Store(&issued)
+		}
+		resp, err := c.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if got := commonName.Load().(string); !strings.HasPrefix(got, name+"@") {
+			t.Errorf("Got client certificate of %v, expected %v", got, name)
+		}
+	}
+	rotated, err := testutil.GetCounterMetricValue(tlsSessionsFlushed.WithLabelValues(flushRotated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated != 1 {
+		t.Errorf("Got %v sessions flushed after rotation, expected 1", rotated)
+	}
+}
+
+func TestSessionCache(t *testing.T) {
+	tlsSessionsFlushed.Create(nil)
+	tlsSessionsFlushed.Reset()
+	c := newSessionCache(2)
+	state := &tls.ClientSessionState{}
+
+	c.Put("node1", nil)
+	c.Put("node1", state)
+	c.Put("node2", state)
+	c.Get("node1")
+	c.Put("node3", state)
+	c.Put("node1", nil)
+	c.Put("node1", nil)
+
+	for key, want := range map[string]bool{"node1": false, "node2": false, "node3": true} {
+		if _, found := c.Get(key); found != want {
+			t.Errorf("Got %s cached %v, expected %v", key, found, want)
+		}
+	}
+	for reason, want := range map[string]float64{flushInvalid: 1, flushCapacity: 1, flushRotated: 0} {
+		got, err := testutil.GetCounterMetricValue(tlsSessionsFlushed.WithLabelValues(reason))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Got %v sessions flushed as %s, expected %v", got, reason, want)
+		}
+	}
+}
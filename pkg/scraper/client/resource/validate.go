@@ -0,0 +1,84 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"math"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Reasons samples are rejected for.
+const (
+	rejectInvalidValue    = "invalid_value"
+	rejectFutureTimestamp = "future_timestamp"
+)
+
+// maxFutureSkew is how far sample timestamps may be ahead of the time they were requested at.
+const maxFutureSkew = 5 * time.Minute
+
+var rejectedSamples = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "kubelet",
+		Name:      "rejected_samples_total",
+		Help:      "Number of samples received from Kubelets rejected as invalid, by reason",
+	},
+	[]string{"reason"},
+)
+
+// validValue returns false for negative, infinite and NaN sample values,
+// which are never reported by a healthy Kubelet.
+func validValue(value float64) bool {
+	return value >= 0 && !math.IsInf(value, 1)
+}
+
+// rejectFuturePoints drops points of nodeName timestamped in the future from
+// ms, requested at requestTime, so they don't corrupt CPU rates. Pods are
+// dropped if any of their containers is rejected, pod level points are
+// optional and only zeroed. Counters going backwards are kept, storage
+// detects them as resets.
+func rejectFuturePoints(logger klog.Logger, nodeName string, ms *storage.MetricsBatch, requestTime time.Time) {
+	latest := requestTime.Add(maxFutureSkew)
+	if point, found := ms.Nodes[nodeName]; found && point.Timestamp.After(latest) {
+		logger.V(1).Info("Rejected invalid node metrics point", "node", klog.KRef("", nodeName), "reason", rejectFutureTimestamp)
+		rejectedSamples.WithLabelValues(rejectFutureTimestamp).Inc()
+		delete(ms.Nodes, nodeName)
+	}
+	for podRef, pod := range ms.Pods {
+		rejected := false
+		for name, point := range pod.Containers {
+			if point.Timestamp.After(latest) {
+				logger.V(1).Info("Rejected invalid container metrics point", "node", klog.KRef("", nodeName), "pod", klog.KRef(podRef.Namespace, podRef.Name), "container", name, "reason", rejectFutureTimestamp)
+				rejectedSamples.WithLabelValues(rejectFutureTimestamp).Inc()
+				rejected = true
+			}
+		}
+		if rejected {
+			delete(ms.Pods, podRef)
+			continue
+		}
+		if pod.Pod.Timestamp.After(latest) {
+			logger.V(1).Info("Rejected invalid pod metrics point", "node", klog.KRef("", nodeName), "pod", klog.KRef(podRef.Namespace, podRef.Name), "reason", rejectFutureTimestamp)
+			rejectedSamples.WithLabelValues(rejectFutureTimestamp).Inc()
+			pod.Pod = storage.MetricsPoint{}
+			ms.Pods[podRef] = pod
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+func TestRejectFuturePoints(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	pod1 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+	pod2 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod2"}
+	batch := func(node, container, pod time.Time) *storage.MetricsBatch {
+		return &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{
+				"node1": {Timestamp: node, CumulativeCpuUsed: 100, MemoryUsage: 1},
+			},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				pod1: {
+					Pod: storage.MetricsPoint{Timestamp: pod, CumulativeCpuUsed: 100, MemoryUsage: 1},
+					Containers: map[string]storage.MetricsPoint{
+						"app": {StartTime: started, Timestamp: container, CumulativeCpuUsed: 100, MemoryUsage: 1},
+					},
+				},
+				pod2: {
+					Containers: map[string]storage.MetricsPoint{
+						"app": {StartTime: started, Timestamp: now, CumulativeCpuUsed: 100, MemoryUsage: 1},
+					},
+				},
+			},
+		}
+	}
+	tcs := []struct {
+		name   string
+		batch  *storage.MetricsBatch
+		expect func(*storage.MetricsBatch)
+	}{
+		{
+			name:  "Valid points are kept",
+			batch: batch(now, now, now),
+		},
+		{
+			name:  "Points within the allowed skew are kept",
+			batch: batch(now.Add(maxFutureSkew), now.Add(maxFutureSkew), now.Add(maxFutureSkew)),
+		},
+		{
+			name:  "Node timestamp in the future drops node",
+			batch: batch(future, now, now),
+			expect: func(ms *storage.MetricsBatch) {
+				delete(ms.Nodes, "node1")
+			},
+		},
+		{
+			name:  "Container timestamp in the future drops pod",
+			batch: batch(now, future, now),
+			expect: func(ms *storage.MetricsBatch) {
+				delete(ms.Pods, pod1)
+			},
+		},
+		{
+			name:  "Pod timestamp in the future drops pod level point",
+			batch: batch(now, now, future),
+			expect: func(ms *storage.MetricsBatch) {
+				pod := ms.Pods[pod1]
+				pod.Pod = storage.MetricsPoint{}
+				ms.Pods[pod1] = pod
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			want := cloneBatch(tc.batch)
+			if tc.expect != nil {
+				tc.expect(want)
+			}
+			rejectFuturePoints(klog.Background(), "node1", tc.batch, now)
+			if diff := cmp.Diff(want, tc.batch); diff != "" {
+				t.Errorf("Unexpected batch, diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestGetMetrics_CounterReset checks counters going backwards without a new
+// start time, e.g. after a node reboot, reach storage, which calculates usage
+// since the reset instead of keeping the rate from before it.
+func TestGetMetrics_CounterReset(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	responses := []struct {
+		cpu       float64
+		timestamp time.Time
+	}{
+		{cpu: 100, timestamp: now.Add(-time.Minute)},
+		{cpu: 200, timestamp: now.Add(-45 * time.Second)},
+		{cpu: 15, timestamp: now.Add(-30 * time.Second)},
+	}
+	var scrape int
+	s := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		r := responses[scrape]
+		ts := r.timestamp.UnixMilli()
+		fmt.Fprintf(writer, "node_cpu_usage_seconds_total %v %d\nnode_memory_working_set_bytes 1000 %d\n", r.cpu, ts, ts)
+	}))
+	defer s.Close()
+	c, err := NewForConfig(klog.Background(), &client.KubeletClientConfig{
+		Scheme:        "http",
+		LocalEndpoint: s.URL,
+		Client:        rest.Config{Timeout: 10 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	store := storage.NewStorage(15 * time.Second)
+	for scrape = range responses {
+		ms, err := c.GetMetrics(context.Background(), node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, found := ms.Nodes["node1"]; !found {
+			t.Fatalf("Scrape %d: node point was dropped", scrape)
+		}
+		store.Store(ms)
+	}
+	got, err := store.GetNodeMetrics(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("Expected metrics of one node, got %d", len(got))
+	}
+	// 15 CPU seconds used in the 15 seconds since the reset.
+	if cpu := got[0].Usage.Cpu().MilliValue(); cpu != 1000 {
+		t.Errorf("Unexpected CPU usage %dm, want 1000m", cpu)
+	}
+}
+
+func cloneBatch(ms *storage.MetricsBatch) *storage.MetricsBatch {
+	res := &storage.MetricsBatch{
+		Nodes: make(map[string]storage.MetricsPoint, len(ms.Nodes)),
+		Pods:  make(map[apitypes.NamespacedName]storage.PodMetricsPoint, len(ms.Pods)),
+	}
+	for name, point := range ms.Nodes {
+		res.Nodes[name] = point
+	}
+	for ref, pod := range ms.Pods {
+		containers := make(map[string]storage.MetricsPoint, len(pod.Containers))
+		for name, point := range pod.Containers {
+			containers[name] = point
+		}
+		pod.Containers = containers
+		res.Pods[ref] = pod
+	}
+	return res
+}
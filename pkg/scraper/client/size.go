@@ -0,0 +1,35 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type responseSizeKey struct{}
+
+// WithResponseSizeCounter returns a context in which Kubelet clients add the
+// size of received response bodies to counter.
+func WithResponseSizeCounter(ctx context.Context, counter *int64) context.Context {
+	return context.WithValue(ctx, responseSizeKey{}, counter)
+}
+
+// AddResponseSize adds n bytes to the response size counter of ctx, if any.
+func AddResponseSize(ctx context.Context, n int) {
+	if counter, ok := ctx.Value(responseSizeKey{}).(*int64); ok {
+		atomic.AddInt64(counter, int64(n))
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package supplemental scrapes Prometheus endpoints running on nodes, e.g.
+// node-exporter, to serve selected series as node usage of additional resources.
+package supplemental
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+var requestTotal = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "supplemental",
+		Name:      "request_total",
+		Help:      "Number of requests sent to supplemental node sources",
+	},
+	[]string{"source", "success"},
+)
+
+// RegisterSupplementalMetrics registers metrics of supplemental source requests.
+func RegisterSupplementalMetrics(registrationFunc func(metrics.Registerable) error) error {
+	return registrationFunc(requestTotal)
+}
+
+type supplementalClient struct {
+	sources      []Source
+	clients      []*http.Client
+	addrResolver utils.NodeAddressResolver
+}
+
+var _ client.NodeMetricsSupplier = (*supplementalClient)(nil)
+
+// New returns a client scraping sources of config on node addresses chosen by addrResolver.
+func New(config *Config, addrResolver utils.NodeAddressResolver, timeout time.Duration) *supplementalClient {
+	c := &supplementalClient{
+		sources:      config.Sources,
+		addrResolver: addrResolver,
+	}
+	for _, source := range config.Sources {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: source.InsecureSkipTLSVerify} // #nosec G402 opt in
+		c.clients = append(c.clients, &http.Client{Transport: transport, Timeout: timeout})
+	}
+	return c
+}
+
+// GetNodeMetrics implements client.NodeMetricsSupplier. Sources are best
+// effort, resources of failing sources are left out.
+func (c *supplementalClient) GetNodeMetrics(ctx context.Context, node *corev1.Node) (corev1.ResourceList, error) {
+	addr, err := c.addrResolver.NodeAddress(node)
+	if err != nil {
+		return nil, err
+	}
+	res := corev1.ResourceList{}
+	for i, source := range c.sources {
+		err := c.scrape(ctx, c.clients[i], addr, source, res)
+		requestTotal.WithLabelValues(source.Name, strconv.FormatBool(err == nil)).Inc()
+		if err != nil {
+			klog.FromContext(ctx).Error(err, "Failed to scrape supplemental source", "source", source.Name, "node", klog.KObj(node))
+		}
+	}
+	return res, nil
+}
+
+func (c *supplementalClient) scrape(ctx context.Context, httpClient *http.Client, addr string, source Source, res corev1.ResourceList) error {
+	u := url.URL{
+		Scheme: source.Scheme,
+		Host:   net.JoinHostPort(addr, strconv.Itoa(source.Port)),
+		Path:   source.Path,
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	if u.Path == "" {
+		u.Path = "/metrics"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed, status: %q", response.Status)
+	}
+	b, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body - %v", err)
+	}
+	client.AddResponseSize(ctx, len(b))
+	values, err := decodeSeries(b, response.Header.Get("Content-Type"), source.Series)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		res[name] = quantity(value)
+	}
+	return nil
+}
+
+// quantity keeps 3 decimals of values fitting in an int64 with them.
+func quantity(v float64) resource.Quantity {
+	if math.Abs(v) < math.MaxInt64/1000 {
+		return *resource.NewMilliQuantity(int64(math.Round(v*1000)), resource.DecimalSI)
+	}
+	if v > 0 {
+		return *resource.NewQuantity(math.MaxInt64, resource.DecimalSI)
+	}
+	return *resource.NewQuantity(math.MinInt64, resource.DecimalSI)
+}
+
+// decodeSeries returns the scaled sum of matching series for each selected
+// resource. Resources without any matching series are left out.
+func decodeSeries(b []byte, contentType string, selected []Series) (map[corev1.ResourceName]float64, error) {
+	res := map[corev1.ResourceName]float64{}
+	parser := textparse.New(b, contentType)
+	for {
+		et, err := parser.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed parsing metrics: %w", err)
+		}
+		if et != textparse.EntrySeries {
+			continue
+		}
+		_, _, value := parser.Series()
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		var lset labels.Labels
+		parser.Metric(&lset)
+		for _, series := range selected {
+			if matches(lset, series) {
+				scale := series.Scale
+				if scale == 0 {
+					scale = 1
+				}
+				res[series.Resource] += value * scale
+			}
+		}
+	}
+	return res, nil
+}
+
+func matches(lset labels.Labels, series Series) bool {
+	if lset.Get(labels.MetricName) != series.Metric {
+		return false
+	}
+	for name, value := range series.Labels {
+		if lset.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package supplemental
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+const nodeExporterResponse = `# HELP node_filesystem_avail_bytes Filesystem space available to non-root users in bytes.
+# TYPE node_filesystem_avail_bytes gauge
+node_filesystem_avail_bytes{device="/dev/sda1",fstype="ext4",mountpoint="/"} 1.073741824e+10
+node_filesystem_avail_bytes{device="/dev/sdb1",fstype="ext4",mountpoint="/var/lib/containerd"} 5.36870912e+09
+# HELP node_load1 1m load average.
+# TYPE node_load1 gauge
+node_load1 0.25
+# HELP node_network_receive_bytes_total Network device statistic receive_bytes.
+# TYPE node_network_receive_bytes_total counter
+node_network_receive_bytes_total{device="eth0"} 1000
+node_network_receive_bytes_total{device="eth1"} 500
+node_network_receive_bytes_total{device="lo"} NaN
+`
+
+func TestDecodeSeries(t *testing.T) {
+	tcs := []struct {
+		name     string
+		selected []Series
+		want     map[corev1.ResourceName]float64
+	}{
+		{
+			name:     "Series matching labels",
+			selected: []Series{{Metric: "node_filesystem_avail_bytes", Labels: map[string]string{"mountpoint": "/"}, Resource: "example.com/root-available"}},
+			want:     map[corev1.ResourceName]float64{"example.com/root-available": 10737418240},
+		},
+		{
+			name:     "Sum of series without labels skipping NaN",
+			selected: []Series{{Metric: "node_network_receive_bytes_total", Resource: "example.com/received"}},
+			want:     map[corev1.ResourceName]float64{"example.com/received": 1500},
+		},
+		{
+			name:     "Scaled series",
+			selected: []Series{{Metric: "node_load1", Resource: "example.com/load", Scale: 4}},
+			want:     map[corev1.ResourceName]float64{"example.com/load": 1},
+		},
+		{
+			name: "Missing series",
+			selected: []Series{
+				{Metric: "node_load5", Resource: "example.com/load5"},
+				{Metric: "node_filesystem_avail_bytes", Labels: map[string]string{"mountpoint": "/data"}, Resource: "example.com/data-available"},
+			},
+			want: map[corev1.ResourceName]float64{},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeSeries([]byte(nodeExporterResponse), "text/plain; version=0.0.4", tc.selected)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected values, diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetNodeMetrics(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(nodeExporterResponse))
+	}))
+	defer s.Close()
+	host, portString, err := net.SplitHostPort(s.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{Sources: []Source{
+		{
+			Name:   "node-exporter",
+			Port:   port,
+			Series: []Series{{Metric: "node_load1", Resource: "example.com/load"}},
+		},
+		{
+			Name:   "missing",
+			Port:   port,
+			Path:   "/missing",
+			Series: []Series{{Metric: "node_load1", Resource: "example.com/other-load"}},
+		},
+	}}
+	c := New(config, utils.NewPriorityNodeAddressResolver(utils.DefaultAddressTypePriority), time.Second)
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status:     corev1.NodeStatus{Addresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: host}}},
+	}
+
+	got, err := c.GetNodeMetrics(context.Background(), node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := corev1.ResourceList{"example.com/load": *resource.NewMilliQuantity(250, resource.DecimalSI)}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected usage, diff:\n%s", diff)
+	}
+}
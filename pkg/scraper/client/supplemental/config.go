@@ -0,0 +1,119 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package supplemental
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Config lists Prometheus endpoints scraped on every node in addition to Kubelet.
+type Config struct {
+	Sources []Source `json:"sources"`
+}
+
+// Source is a Prometheus endpoint served on each node, e.g. node-exporter.
+type Source struct {
+	// Name identifies the source in logs and metrics.
+	Name string `json:"name"`
+	// Scheme is http or https, http if empty.
+	Scheme string `json:"scheme,omitempty"`
+	// Port is the port the endpoint listens on at the node address.
+	Port int `json:"port"`
+	// Path of the endpoint, /metrics if empty.
+	Path string `json:"path,omitempty"`
+	// InsecureSkipTLSVerify disables verifying serving certificates with https.
+	InsecureSkipTLSVerify bool `json:"insecureSkipTLSVerify,omitempty"`
+	// Series selects the series merged into node metrics.
+	Series []Series `json:"series"`
+}
+
+// Series selects series of a metric, whose sum is served as node usage of a resource.
+type Series struct {
+	// Metric is the metric name.
+	Metric string `json:"metric"`
+	// Labels series must have, all series of the metric if empty.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Resource is the name of the resource in node usage. It can't be a resource served from Kubelet metrics.
+	Resource corev1.ResourceName `json:"resource"`
+	// Scale multiplies the sum of series, 1 if zero.
+	Scale float64 `json:"scale,omitempty"`
+}
+
+// LoadFile reads a Config in YAML or JSON from path and validates it.
+func LoadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read supplemental sources config: %w", err)
+	}
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("unable to decode supplemental sources config %q: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid supplemental sources config %q: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	names := map[string]bool{}
+	resources := map[corev1.ResourceName]bool{}
+	for i, source := range c.Sources {
+		if source.Name == "" {
+			return fmt.Errorf("sources[%d]: name is required", i)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("sources[%d]: duplicate name %q", i, source.Name)
+		}
+		names[source.Name] = true
+		if source.Scheme != "" && source.Scheme != "http" && source.Scheme != "https" {
+			return fmt.Errorf("source %q: scheme should be http or https, got %q", source.Name, source.Scheme)
+		}
+		if source.Port <= 0 || source.Port > 65535 {
+			return fmt.Errorf("source %q: port should be between 1 and 65535, got %d", source.Name, source.Port)
+		}
+		if source.Path != "" && !strings.HasPrefix(source.Path, "/") {
+			return fmt.Errorf("source %q: path should start with /, got %q", source.Name, source.Path)
+		}
+		if len(source.Series) == 0 {
+			return fmt.Errorf("source %q: at least one series is required", source.Name)
+		}
+		for j, series := range source.Series {
+			if series.Metric == "" {
+				return fmt.Errorf("source %q: series[%d]: metric is required", source.Name, j)
+			}
+			switch series.Resource {
+			case corev1.ResourceCPU, corev1.ResourceMemory, storage.ResourcePID:
+				return fmt.Errorf("source %q: series[%d]: resource %q is served from Kubelet metrics", source.Name, j, series.Resource)
+			}
+			if errs := validation.IsQualifiedName(string(series.Resource)); len(errs) != 0 {
+				return fmt.Errorf("source %q: series[%d]: invalid resource %q: %s", source.Name, j, series.Resource, strings.Join(errs, ", "))
+			}
+			if resources[series.Resource] {
+				return fmt.Errorf("source %q: series[%d]: resource %q already read from another series", source.Name, j, series.Resource)
+			}
+			resources[series.Resource] = true
+		}
+	}
+	return nil
+}
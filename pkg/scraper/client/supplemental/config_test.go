@@ -0,0 +1,97 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package supplemental
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadFile(t *testing.T) {
+	tcs := []struct {
+		name      string
+		config    string
+		wantError bool
+	}{
+		{
+			name: "Valid",
+			config: `
+sources:
+- name: node-exporter
+  port: 9100
+  series:
+  - metric: node_filesystem_avail_bytes
+    labels:
+      mountpoint: /
+    resource: node-exporter.io/root-filesystem-available
+`,
+		},
+		{
+			name:      "Unknown field",
+			config:    "sources:\n- name: node-exporter\n  prot: 9100\n",
+			wantError: true,
+		},
+		{
+			name:      "Missing port",
+			config:    "sources:\n- name: node-exporter\n  series:\n  - metric: node_load1\n    resource: example.com/load\n",
+			wantError: true,
+		},
+		{
+			name:      "Invalid scheme",
+			config:    "sources:\n- name: node-exporter\n  scheme: ftp\n  port: 9100\n  series:\n  - metric: node_load1\n    resource: example.com/load\n",
+			wantError: true,
+		},
+		{
+			name:      "Kubelet resource",
+			config:    "sources:\n- name: node-exporter\n  port: 9100\n  series:\n  - metric: node_load1\n    resource: cpu\n",
+			wantError: true,
+		},
+		{
+			name:      "Invalid resource name",
+			config:    "sources:\n- name: node-exporter\n  port: 9100\n  series:\n  - metric: node_load1\n    resource: load average\n",
+			wantError: true,
+		},
+		{
+			name: "Duplicate resource",
+			config: `
+sources:
+- name: node-exporter
+  port: 9100
+  series:
+  - metric: node_load1
+    resource: example.com/load
+- name: other-exporter
+  port: 9101
+  series:
+  - metric: load1
+    resource: example.com/load
+`,
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "sources.yaml")
+			if err := os.WriteFile(path, []byte(tc.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadFile(path)
+			if (err != nil) != tc.wantError {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+)
+
+// MetricsAvailableCondition is the type of the node condition reporting
+// whether metrics of the node are scraped from its Kubelet.
+const MetricsAvailableCondition corev1.NodeConditionType = "MetricsAvailable"
+
+// conditionReasons maps failure reasons of scrapeFailureReason to reasons of
+// the MetricsAvailable condition.
+var conditionReasons = map[string]string{
+	"timeout":    "ScrapeTimeout",
+	"tls":        "KubeletTLSError",
+	"connection": "KubeletUnreachable",
+	"http_4xx":   "KubeletRejectedRequest",
+	"http_5xx":   "KubeletError",
+	"decode":     "InvalidKubeletResponse",
+	"other":      "ScrapeFailed",
+}
+
+var conditionPatchErrors = metrics.NewCounter(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "kubelet",
+		Name:      "node_condition_patch_errors_total",
+		Help:      "Number of failed updates of the MetricsAvailable condition of nodes",
+	},
+)
+
+// nodeConditions sets the MetricsAvailable condition of scraped nodes, True
+// once scraped and False after threshold consecutive failed scrapes, so the
+// condition doesn't flap on a single timeout. Nodes are only patched when
+// their condition status or reason changes.
+type nodeConditions struct {
+	// patcher patches node status, nil disables conditions.
+	patcher   NodeStatusPatcher
+	threshold int
+
+	mu sync.Mutex
+	// failures counts consecutive failed scrapes of nodes.
+	failures map[string]int
+}
+
+func (n *nodeConditions) enabled() bool {
+	return n.patcher != nil
+}
+
+// forgetRemoved drops failures of nodes no longer listed.
+func (n *nodeConditions) forgetRemoved(nodes []*corev1.Node) {
+	if !n.enabled() {
+		return
+	}
+	present := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		present[node.Name] = struct{}{}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for name := range n.failures {
+		if _, found := present[name]; !found {
+			delete(n.failures, name)
+		}
+	}
+}
+
+// observe records the result of scraping node and updates its condition if it
+// changed. The logger of ctx is expected to carry the node.
+func (n *nodeConditions) observe(ctx context.Context, node *corev1.Node, err error) {
+	if !n.enabled() {
+		return
+	}
+	condition, changed := n.condition(node, err)
+	if !changed {
+		return
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{"conditions": []corev1.NodeCondition{condition}},
+	})
+	if err == nil {
+		_, err = n.patcher.PatchStatus(ctx, node.Name, patch)
+	}
+	if err != nil {
+		conditionPatchErrors.Inc()
+		klog.FromContext(ctx).Error(err, "Failed to update node condition", "condition", MetricsAvailableCondition)
+		return
+	}
+	klog.FromContext(ctx).V(1).Info("Updated node condition", "condition", MetricsAvailableCondition, "status", condition.Status, "reason", condition.Reason)
+}
+
+// condition returns the MetricsAvailable condition of node after a scrape
+// failing with err, and whether it differs from the current one.
+func (n *nodeConditions) condition(node *corev1.Node, err error) (corev1.NodeCondition, bool) {
+	n.mu.Lock()
+	if err == nil {
+		delete(n.failures, node.Name)
+	} else {
+		if n.failures == nil {
+			n.failures = map[string]int{}
+		}
+		n.failures[node.Name]++
+	}
+	failures := n.failures[node.Name]
+	n.mu.Unlock()
+
+	now := metav1.NewTime(myClock.Now())
+	condition := corev1.NodeCondition{
+		Type:               MetricsAvailableCondition,
+		Status:             corev1.ConditionTrue,
+		Reason:             "MetricsScraped",
+		Message:            "Metrics are scraped from the Kubelet",
+		LastHeartbeatTime:  now,
+		LastTransitionTime: now,
+	}
+	if err != nil {
+		if failures < n.threshold {
+			return corev1.NodeCondition{}, false
+		}
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = conditionReasons[scrapeFailureReason(err)]
+		condition.Message = fmt.Sprintf("%d consecutive scrapes of the Kubelet failed, last error: %v", failures, err)
+	}
+	for _, current := range node.Status.Conditions {
+		if current.Type != MetricsAvailableCondition {
+			continue
+		}
+		if current.Status == condition.Status && current.Reason == condition.Reason {
+			return corev1.NodeCondition{}, false
+		}
+		if current.Status == condition.Status {
+			condition.LastTransitionTime = current.LastTransitionTime
+		}
+	}
+	return condition, true
+}
@@ -0,0 +1,41 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import "sync"
+
+// kubeletConnectivity holds results of the Kubelet scrapes of the last cycle.
+type kubeletConnectivity struct {
+	mu sync.Mutex
+	// scraped is the number of Kubelets scrapes were started for.
+	scraped int
+	// failed is the number of those scrapes that failed.
+	failed int
+}
+
+func (k *kubeletConnectivity) record(scraped, failed int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.scraped, k.failed = scraped, failed
+}
+
+// KubeletConnectivity returns the number of Kubelets scraped in the last
+// cycle and the number of those scrapes that failed. Nodes whose scrape was
+// skipped, e.g. backed off, deferred or pushed, aren't counted.
+func (c *scraper) KubeletConnectivity() (scraped, failed int) {
+	c.connectivity.mu.Lock()
+	defer c.connectivity.mu.Unlock()
+	return c.connectivity.scraped, c.connectivity.failed
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// scrapeFilter applies filter rules that can change between cycles, skipping
+// excluded nodes and dropping points of excluded pods from scraped batches.
+type scrapeFilter struct {
+	// filter is nil if filtering is disabled.
+	filter storage.Filter
+}
+
+// nodes returns nodes kept by the filter and reports the number of excluded ones.
+func (f scrapeFilter) nodes(logger klog.Logger, nodes []*corev1.Node) []*corev1.Node {
+	if f.filter == nil {
+		return nodes
+	}
+	res := make([]*corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !f.filter.KeepNode(node) {
+			logger.V(2).Info("Skipping node", "node", klog.KObj(node), "reason", "filter")
+			continue
+		}
+		res = append(res, node)
+	}
+	skippedNodes.WithLabelValues("filter").Set(float64(len(nodes) - len(res)))
+	return res
+}
+
+// pods drops points of pods excluded by the filter from batch.
+func (f scrapeFilter) pods(batch *storage.MetricsBatch) {
+	if f.filter == nil {
+		return
+	}
+	for pod := range batch.Pods {
+		if !f.filter.KeepPod(pod.Namespace, pod.Name) {
+			delete(batch.Pods, pod)
+		}
+	}
+}
@@ -17,9 +17,28 @@ package scraper
 import (
 	"context"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"sigs.k8s.io/metrics-server/pkg/storage"
 )
 
 type Scraper interface {
 	Scrape(ctx context.Context) *storage.MetricsBatch
 }
+
+// NodeGetter fetches the latest version of a node from the API server, bypassing informer caches.
+type NodeGetter interface {
+	Get(ctx context.Context, name string, opts metav1.GetOptions) (*corev1.Node, error)
+}
+
+// NodeStatusPatcher patches the status of nodes with a strategic merge patch.
+type NodeStatusPatcher interface {
+	PatchStatus(ctx context.Context, nodeName string, data []byte) (*corev1.Node, error)
+}
+
+// PushSource provides metrics pushed by node agents for nodes metrics-server can't scrape.
+type PushSource interface {
+	// PushedBatches returns the latest batch pushed for each node, leaving out stale ones.
+	PushedBatches() map[string]*storage.MetricsBatch
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// ScrapeIntervalAnnotation is the node annotation overriding the interval at
+// which the node is scraped, as a duration, e.g. 30s.
+const ScrapeIntervalAnnotation = "metrics.k8s.io/scrape-interval"
+
+// scrapeSchedule skips nodes scraped more recently than their scrape
+// interval. Scrape cycles run every tick, so intervals are rounded to a
+// multiple of tick and can't be shorter than it. Skipped nodes keep serving
+// metrics from their last scrape.
+type scrapeSchedule struct {
+	tick            time.Duration
+	defaultInterval time.Duration
+
+	mu          sync.Mutex
+	lastScraped map[string]time.Time
+	lastBatch   map[string]*storage.MetricsBatch
+}
+
+func (s *scrapeSchedule) enabled() bool {
+	return s.tick > 0
+}
+
+// interval returns the scrape interval of node.
+func (s *scrapeSchedule) interval(logger klog.Logger, node *corev1.Node) time.Duration {
+	value, found := node.Annotations[ScrapeIntervalAnnotation]
+	if !found {
+		return s.defaultInterval
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		logger.V(2).Info("Ignoring invalid scrape interval annotation", "node", klog.KObj(node), "annotation", ScrapeIntervalAnnotation, "value", value)
+		return s.defaultInterval
+	}
+	if interval < s.tick {
+		return s.tick
+	}
+	return interval
+}
+
+// plan splits nodes into the ones due for a scrape at now and the skipped ones.
+func (s *scrapeSchedule) plan(logger klog.Logger, nodes []*corev1.Node, now time.Time) (due, skipped []*corev1.Node) {
+	if !s.enabled() {
+		return nodes, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastScraped == nil {
+		s.lastScraped = map[string]time.Time{}
+		s.lastBatch = map[string]*storage.MetricsBatch{}
+	}
+	present := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		present[node.Name] = struct{}{}
+		last, found := s.lastScraped[node.Name]
+		// Tolerate half a tick of jitter, so intervals are not rounded up to the next tick.
+		if found && now.Sub(last) < s.interval(logger, node)-s.tick/2 {
+			skipped = append(skipped, node)
+			continue
+		}
+		s.lastScraped[node.Name] = now
+		due = append(due, node)
+	}
+	for name := range s.lastScraped {
+		if _, found := present[name]; !found {
+			delete(s.lastScraped, name)
+			delete(s.lastBatch, name)
+		}
+	}
+	if len(skipped) != 0 {
+		logger.V(2).Info("Skipping nodes not due for a scrape", "nodes", klog.KObjSlice(skipped), "nodeCount", len(skipped))
+	}
+	return due, skipped
+}
+
+// force makes nodes due for a scrape in the next cycle.
+func (s *scrapeSchedule) force(nodes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, node := range nodes {
+		delete(s.lastScraped, node)
+	}
+}
+
+// observe records the batch of a successful scrape of node.
+func (s *scrapeSchedule) observe(node string, batch *storage.MetricsBatch) {
+	if !s.enabled() || batch == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastBatch != nil {
+		s.lastBatch[node] = batch
+	}
+}
+
+// skippedBatches returns batches of the last successful scrape of skipped nodes.
+func (s *scrapeSchedule) skippedBatches(skipped []*corev1.Node) []*storage.MetricsBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batches := make([]*storage.MetricsBatch, 0, len(skipped))
+	for _, node := range skipped {
+		if batch, found := s.lastBatch[node.Name]; found {
+			batches = append(batches, batch)
+		}
+	}
+	return batches
+}
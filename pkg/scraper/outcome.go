@@ -0,0 +1,90 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+
+	"k8s.io/component-base/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+)
+
+var (
+	scrapeFailures = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "scrape_failures_total",
+			Help:      "Number of failed scrapes of Kubelets by failure reason, per node or node hash bucket",
+		},
+		[]string{"node", "reason"},
+	)
+	lastSuccessfulScrape = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "last_successful_scrape_timestamp_seconds",
+			Help:      "Time of the last successful scrape of Kubelets since unix epoch in seconds, per node or node hash bucket",
+		},
+		[]string{"node"},
+	)
+)
+
+// scrapeFailureReason classifies err, so network issues can be told apart
+// from Kubelets failing to serve metrics.
+func scrapeFailureReason(err error) string {
+	var netErr net.Error
+	var statusErr *client.StatusError
+	var decodeErr *client.DecodeError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case isTLSError(err):
+		return "tls"
+	case isConnectionError(err):
+		return "connection"
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 500:
+		return "http_5xx"
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 400:
+		return "http_4xx"
+	case errors.As(err, &decodeErr):
+		return "decode"
+	default:
+		return "other"
+	}
+}
+
+// isTLSError returns true if err was caused by a failed TLS handshake, e.g.
+// an untrusted or expired Kubelet serving certificate.
+func isTLSError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var recordHeader tls.RecordHeaderError
+	var verification *tls.CertificateVerificationError
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalid), errors.As(err, &hostname),
+		errors.As(err, &recordHeader), errors.As(err, &verification):
+		return true
+	}
+	// Alerts sent by the Kubelet, e.g. rejecting the client certificate, are unexported.
+	return strings.Contains(err.Error(), "remote error: tls:")
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// skipPolicy excludes nodes whose Kubelet is unlikely to respond, so they
+// don't use up the scrape budget on timeouts. Metrics of skipped nodes expire
+// like those of nodes failing scrapes.
+type skipPolicy struct {
+	// notReady skips nodes whose Ready condition isn't True, including unreachable nodes.
+	notReady bool
+	// taints skips nodes with a matching taint, taints with empty effect match any effect.
+	taints []corev1.Taint
+}
+
+// ParseTaints parses taints in the key[:effect] format, e.g.
+// "node.kubernetes.io/unreachable" or "node.kubernetes.io/unschedulable:NoSchedule".
+func ParseTaints(specs []string) ([]corev1.Taint, error) {
+	taints := make([]corev1.Taint, 0, len(specs))
+	for _, spec := range specs {
+		key, effect, _ := strings.Cut(spec, ":")
+		if key == "" {
+			return nil, fmt.Errorf("taint %q has an empty key", spec)
+		}
+		switch corev1.TaintEffect(effect) {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			return nil, fmt.Errorf("taint %q has unsupported effect %q, expected %q, %q or %q", spec, effect, corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute)
+		}
+		taints = append(taints, corev1.Taint{Key: key, Effect: corev1.TaintEffect(effect)})
+	}
+	return taints, nil
+}
+
+// filter returns nodes to scrape and reports the number of skipped nodes per reason.
+func (p skipPolicy) filter(logger klog.Logger, nodes []*corev1.Node) []*corev1.Node {
+	if !p.notReady && len(p.taints) == 0 {
+		return nodes
+	}
+	res := make([]*corev1.Node, 0, len(nodes))
+	skipped := map[string]int{}
+	for _, node := range nodes {
+		reason := p.skipReason(node)
+		if reason == "" {
+			res = append(res, node)
+			continue
+		}
+		logger.V(2).Info("Skipping node", "node", klog.KObj(node), "reason", reason)
+		skipped[reason]++
+	}
+	if p.notReady {
+		skippedNodes.WithLabelValues("not_ready").Set(float64(skipped["not_ready"]))
+	}
+	if len(p.taints) != 0 {
+		skippedNodes.WithLabelValues("taint").Set(float64(skipped["taint"]))
+	}
+	return res
+}
+
+// skipReason returns why node should be skipped, empty if it should be scraped.
+func (p skipPolicy) skipReason(node *corev1.Node) string {
+	if p.notReady && !nodeReady(node) {
+		return "not_ready"
+	}
+	for i := range node.Spec.Taints {
+		for _, taint := range p.taints {
+			if node.Spec.Taints[i].Key == taint.Key && (taint.Effect == "" || node.Spec.Taints[i].Effect == taint.Effect) {
+				return "taint"
+			}
+		}
+	}
+	return ""
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
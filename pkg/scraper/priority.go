@@ -0,0 +1,83 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+)
+
+var cutOffScrapes = metrics.NewCounter(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "kubelet",
+		Name:      "scrapes_cut_off_total",
+		Help:      "Number of node scrapes not finished before the end of their scrape cycle",
+	},
+)
+
+// overloadPriority prioritizes nodes with the oldest metrics once a scrape
+// cycle couldn't finish all its scrapes before its deadline, e.g. on an
+// overloaded metrics-server. The first slots of the next cycles go to nodes
+// scraped successfully longest ago, so nodes cut off in one cycle are
+// scraped early in the next one and staleness is bounded for all nodes,
+// instead of the same nodes starving in list order.
+type overloadPriority struct {
+	mu         sync.Mutex
+	overloaded bool
+}
+
+// prioritize reassigns delays of scheduled nodes, the shortest to the nodes
+// with the oldest lastSuccess, if the last cycle was overloaded. Nodes never
+// scraped successfully come first.
+func (p *overloadPriority) prioritize(scheduled []scheduledNode, lastSuccess map[string]time.Time) []scheduledNode {
+	p.mu.Lock()
+	overloaded := p.overloaded
+	p.mu.Unlock()
+	if !overloaded {
+		return scheduled
+	}
+	delays := make([]time.Duration, len(scheduled))
+	for i, s := range scheduled {
+		delays[i] = s.delay
+	}
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	res := append([]scheduledNode(nil), scheduled...)
+	sort.SliceStable(res, func(i, j int) bool {
+		return lastSuccess[res[i].node.Name].Before(lastSuccess[res[j].node.Name])
+	})
+	for i := range res {
+		res[i].delay = delays[i]
+	}
+	return res
+}
+
+// finish records the number of scrapes of a cycle cut off by its deadline.
+func (p *overloadPriority) finish(logger klog.Logger, cutOff int) {
+	cutOffScrapes.Add(float64(cutOff))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cutOff != 0 && !p.overloaded {
+		logger.Info("Scrape cycle did not finish in time, scraping nodes with the oldest metrics first", "cutOffScrapes", cutOff)
+	}
+	if cutOff == 0 && p.overloaded {
+		logger.Info("Scrape cycle finished in time, no longer prioritizing nodes with the oldest metrics")
+	}
+	p.overloaded = cutOff != 0
+}
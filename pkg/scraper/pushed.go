@@ -0,0 +1,66 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// pushedNodes replaces scrapes of nodes by the metrics node agents pushed for
+// them, as long as those are fresh. Nodes whose pushed metrics went stale are
+// scraped again, unless only pushed metrics are served.
+type pushedNodes struct {
+	// source is nil if pushing metrics is disabled.
+	source PushSource
+	// only skips scraping nodes without fresh pushed metrics, e.g. for the
+	// aggregator of node agents, which is not expected to reach Kubelets.
+	only bool
+}
+
+// plan returns nodes to scrape, leaving out nodes with fresh pushed metrics,
+// and the batches pushed for the left out nodes.
+func (p pushedNodes) plan(logger klog.Logger, nodes []*corev1.Node) ([]*corev1.Node, []*storage.MetricsBatch) {
+	if p.source == nil {
+		return nodes, nil
+	}
+	pushed := p.source.PushedBatches()
+	if len(pushed) == 0 && !p.only {
+		skippedNodes.WithLabelValues("pushed").Set(0)
+		return nodes, nil
+	}
+	res := make([]*corev1.Node, 0, len(nodes))
+	var batches []*storage.MetricsBatch
+	for _, node := range nodes {
+		batch, found := pushed[node.Name]
+		if !found {
+			res = append(res, node)
+			continue
+		}
+		logger.V(2).Info("Using metrics pushed for node", "node", klog.KObj(node))
+		batches = append(batches, batch)
+	}
+	skippedNodes.WithLabelValues("pushed").Set(float64(len(batches)))
+	if p.only {
+		if len(res) != 0 {
+			logger.V(1).Info("Not scraping nodes without fresh pushed metrics", "nodes", klog.KObjSlice(res), "nodeCount", len(res))
+		}
+		skippedNodes.WithLabelValues("not_pushed").Set(float64(len(res)))
+		return nil, batches
+	}
+	return res, batches
+}
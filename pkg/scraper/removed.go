@@ -0,0 +1,151 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var removedNodesServed = metrics.NewGauge(
+	&metrics.GaugeOpts{
+		Namespace: "metrics_server",
+		Subsystem: "kubelet",
+		Name:      "removed_nodes",
+		Help:      "Number of nodes deleted from the API whose last metrics are still served during the removed node grace period",
+	},
+)
+
+// removedNodeGrace keeps serving the last metrics of nodes deleted from the
+// API for a grace period, e.g. while their pods are still migrated during a
+// scale down, instead of dropping them instantly. Metrics of removed nodes
+// and their pods are flagged with annotations.NodeRemoved.
+type removedNodeGrace struct {
+	// period is how long metrics of removed nodes are served, 0 disables the grace period.
+	period time.Duration
+
+	mu sync.Mutex
+	// listed holds nodes listed in the last cycle.
+	listed map[string]*corev1.Node
+	// lastBatch holds batches of the last successful scrape of listed nodes.
+	lastBatch map[string]*storage.MetricsBatch
+	removed   map[string]removedNode
+}
+
+type removedNode struct {
+	// node is a copy of the deleted node, annotated with annotations.NodeRemoved.
+	node *corev1.Node
+	// batch is the last batch of the node, with pods flagged as removed.
+	batch    *storage.MetricsBatch
+	deadline time.Time
+}
+
+func (g *removedNodeGrace) enabled() bool {
+	return g.period > 0
+}
+
+// plan records the nodes listed at now, starts the grace period of nodes
+// deleted since the last cycle and returns the last batches of nodes still in
+// their grace period.
+func (g *removedNodeGrace) plan(logger klog.Logger, nodes []*corev1.Node, lister v1listers.NodeLister, now time.Time) []*storage.MetricsBatch {
+	if !g.enabled() {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.removed == nil {
+		g.removed = map[string]removedNode{}
+		g.lastBatch = map[string]*storage.MetricsBatch{}
+	}
+	listed := make(map[string]*corev1.Node, len(nodes))
+	for _, node := range nodes {
+		listed[node.Name] = node
+		delete(g.removed, node.Name)
+	}
+	for name, node := range g.listed {
+		if _, found := listed[name]; found {
+			continue
+		}
+		batch, found := g.lastBatch[name]
+		delete(g.lastBatch, name)
+		// Nodes no longer matching the node selector are dropped right away, only deleted nodes get a grace period.
+		if _, err := lister.Get(name); !found || !apierrors.IsNotFound(err) {
+			continue
+		}
+		logger.V(1).Info("Node removed, serving its last metrics during grace period", "node", klog.KObj(node), "gracePeriod", g.period)
+		removed := node.DeepCopy()
+		annotations.Set(&removed.Annotations, annotations.NodeRemoved, "true")
+		g.removed[name] = removedNode{node: removed, batch: markRemoved(batch), deadline: now.Add(g.period)}
+	}
+	g.listed = listed
+
+	batches := make([]*storage.MetricsBatch, 0, len(g.removed))
+	for name, removed := range g.removed {
+		if !now.Before(removed.deadline) {
+			logger.V(1).Info("Grace period of removed node expired", "node", klog.KRef("", name))
+			delete(g.removed, name)
+			continue
+		}
+		batches = append(batches, removed.batch)
+	}
+	removedNodesServed.Set(float64(len(g.removed)))
+	return batches
+}
+
+// observe records the batch of a successful scrape of node.
+func (g *removedNodeGrace) observe(node string, batch *storage.MetricsBatch) {
+	if !g.enabled() || batch == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.lastBatch != nil {
+		g.lastBatch[node] = batch
+	}
+}
+
+// nodes returns the nodes in their grace period.
+func (g *removedNodeGrace) nodes() []*corev1.Node {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	nodes := make([]*corev1.Node, 0, len(g.removed))
+	for _, removed := range g.removed {
+		nodes = append(nodes, removed.node)
+	}
+	return nodes
+}
+
+// markRemoved returns a copy of batch with pods flagged as running on a removed node.
+func markRemoved(batch *storage.MetricsBatch) *storage.MetricsBatch {
+	res := &storage.MetricsBatch{
+		Nodes: batch.Nodes,
+		Pods:  make(map[apitypes.NamespacedName]storage.PodMetricsPoint, len(batch.Pods)),
+	}
+	for pod, point := range batch.Pods {
+		point.NodeRemoved = true
+		res.Pods[pod] = point
+	}
+	return res
+}
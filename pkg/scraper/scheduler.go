@@ -0,0 +1,92 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+// scheduledNode is a node to scrape after delay from the cycle start.
+type scheduledNode struct {
+	node  *corev1.Node
+	delay time.Duration
+}
+
+// adaptiveScheduler spreads scrapes of a cycle over a window growing with
+// the number of nodes, so the Kubelet request rate stays constant as the
+// cluster grows. Each node gets a stable slot in the window derived from a
+// hash of its name, keeping its scrape interval steady between cycles.
+type adaptiveScheduler struct {
+	perNode   time.Duration
+	maxWindow time.Duration
+}
+
+func (s *adaptiveScheduler) enabled() bool {
+	return s.perNode > 0
+}
+
+// plan returns the nodes to scrape in this cycle with their delay. Scrapes
+// are spread over the window remaining before deadline, if any, leaving time
+// for the last scrape to take scrapeTimeout. When disabled, scrapes are
+// staggered randomly over a few seconds.
+func (s *adaptiveScheduler) plan(nodes []*corev1.Node, deadline time.Time, scrapeTimeout time.Duration) []scheduledNode {
+	if !s.enabled() {
+		return staggered(nodes)
+	}
+	due := append([]*corev1.Node(nil), nodes...)
+	window := s.perNode * time.Duration(len(due))
+	if s.maxWindow > 0 && window > s.maxWindow {
+		window = s.maxWindow
+	}
+	if !deadline.IsZero() {
+		if remaining := deadline.Sub(myClock.Now()) - scrapeTimeout; window > remaining {
+			window = remaining
+		}
+	}
+	if window < 0 {
+		window = 0
+	}
+	sort.Slice(due, func(i, j int) bool {
+		hi, hj := utils.NodeHash(due[i].Name), utils.NodeHash(due[j].Name)
+		if hi != hj {
+			return hi < hj
+		}
+		return due[i].Name < due[j].Name
+	})
+	res := make([]scheduledNode, 0, len(due))
+	for i, node := range due {
+		res = append(res, scheduledNode{node: node, delay: window * time.Duration(i) / time.Duration(len(due))})
+	}
+	return res
+}
+
+// staggered delays nodes randomly by up to 8ms per node and at most 4s, preventing network congestion.
+func staggered(nodes []*corev1.Node) []scheduledNode {
+	delayMs := delayPerSourceMs * len(nodes)
+	if delayMs > maxDelayMs {
+		delayMs = maxDelayMs
+	}
+	res := make([]scheduledNode, 0, len(nodes))
+	for _, node := range nodes {
+		res = append(res, scheduledNode{node: node, delay: time.Duration(rand.Intn(delayMs)) * time.Millisecond})
+	}
+	return res
+}
@@ -17,10 +17,18 @@ package scraper
 import (
 	"context"
 	"errors"
-	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	v1listers "k8s.io/client-go/listers/core/v1"
@@ -29,6 +37,7 @@ import (
 
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 const (
@@ -36,6 +45,10 @@ const (
 	delayPerSourceMs = 8
 )
 
+// tracerName is the instrumentation scope of spans of per-node scrapes,
+// children of the span of the scrape cycle in the context, if any.
+const tracerName = "sigs.k8s.io/metrics-server/pkg/scraper"
+
 var (
 	requestDuration = metrics.NewHistogramVec(
 		&metrics.HistogramOpts{
@@ -56,6 +69,15 @@ var (
 		},
 		[]string{"success"},
 	)
+	requestErrors = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "request_errors_total",
+			Help:      "Number of failed requests to Kubelet API, per node or node hash bucket",
+		},
+		[]string{"node"},
+	)
 	lastRequestTime = metrics.NewGaugeVec(
 		&metrics.GaugeOpts{
 			Namespace: "metrics_server",
@@ -65,6 +87,24 @@ var (
 		},
 		[]string{"node"},
 	)
+	skippedNodes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "skipped_nodes",
+			Help:      "Number of nodes not scraped in the last scrape, by reason",
+		},
+		[]string{"reason"},
+	)
+	duplicateEndpoint = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "duplicate_endpoint",
+			Help:      "Number of nodes skipped in the last scrape because their Kubelet endpoint is shared with the node in scraped_as label, per node or node hash bucket",
+		},
+		[]string{"node", "scraped_as"},
+	)
 )
 
 // RegisterScraperMetrics registers rate, errors, and duration metrics on
@@ -73,7 +113,22 @@ func RegisterScraperMetrics(registrationFunc func(metrics.Registerable) error) e
 	for _, metric := range []metrics.Registerable{
 		requestDuration,
 		requestTotal,
+		requestErrors,
 		lastRequestTime,
+		skippedNodes,
+		duplicateEndpoint,
+		deferredNode,
+		backedOffNode,
+		breakerNodes,
+		removedNodesServed,
+		zoneNodes,
+		zoneScrapedNodes,
+		zoneMaxStaleness,
+		requestTimeout,
+		cutOffScrapes,
+		scrapeFailures,
+		lastSuccessfulScrape,
+		conditionPatchErrors,
 	} {
 		err := registrationFunc(metric)
 		if err != nil {
@@ -101,6 +156,142 @@ type scraper struct {
 	kubeletClient client.KubeletMetricsGetter
 	scrapeTimeout time.Duration
 	labelSelector labels.Selector
+	zones         zoneTracker
+	budget        scrapeBudget
+	schedule      scrapeSchedule
+	scheduler     adaptiveScheduler
+	breaker       circuitBreaker
+	policy        skipPolicy
+	removed       removedNodeGrace
+	pushed        pushedNodes
+	filter        scrapeFilter
+	timeouts      adaptiveTimeout
+	priority      overloadPriority
+	connectivity  kubeletConnectivity
+	conditions    nodeConditions
+	// nodeGetter is used to re-resolve node addresses on connection errors, optional.
+	nodeGetter NodeGetter
+	// refreshInterval is the minimum interval between reads of a node with nodeGetter.
+	refreshInterval time.Duration
+	refreshMu       sync.Mutex
+	// refreshed holds the time nodes were last read with nodeGetter, within refreshInterval.
+	refreshed map[string]time.Time
+	// supplier reads additional node metrics merged into node points, optional.
+	supplier client.NodeMetricsSupplier
+	// devices reads devices allocated to pods, set on their points, optional.
+	devices client.PodDevicesSupplier
+	// nodeLabels maps nodes to the node label of per-node metrics.
+	nodeLabels utils.NodeLabels
+}
+
+// SetNodeLabelBuckets labels per-node metrics with one of buckets stable hash
+// buckets of the node name instead of the node name, bounding their
+// cardinality. 0 labels them with node names.
+func (c *scraper) SetNodeLabelBuckets(buckets uint32) {
+	c.nodeLabels = utils.NodeLabels(buckets)
+	c.breaker.nodeLabels = c.nodeLabels
+	c.budget.nodeLabels = c.nodeLabels
+}
+
+// SetNodeGetter enables re-resolving node addresses and retrying once when a
+// Kubelet can't be reached. Each node is read with nodeGetter at most once per
+// interval, so unreachable nodes don't cause API server requests every cycle.
+func (c *scraper) SetNodeGetter(nodeGetter NodeGetter, interval time.Duration) {
+	c.nodeGetter = nodeGetter
+	c.refreshInterval = interval
+}
+
+// SetNodeConditions enables setting the MetricsAvailable condition of scraped
+// nodes with patcher, False after failureThreshold consecutive failed scrapes.
+func (c *scraper) SetNodeConditions(patcher NodeStatusPatcher, failureThreshold int) {
+	c.conditions.patcher = patcher
+	c.conditions.threshold = failureThreshold
+}
+
+// SetNodeMetricsSupplier enables merging node metrics read by supplier into node points scraped from Kubelet.
+func (c *scraper) SetNodeMetricsSupplier(supplier client.NodeMetricsSupplier) {
+	c.supplier = supplier
+}
+
+// SetPodDevicesSupplier enables setting devices read by devices on pod points scraped from Kubelet.
+func (c *scraper) SetPodDevicesSupplier(devices client.PodDevicesSupplier) {
+	c.devices = devices
+}
+
+// SetScrapeIntervals enables per node scrape intervals set by ScrapeIntervalAnnotation, for
+// Scrape called every tick. Nodes without the annotation are scraped every defaultInterval.
+func (c *scraper) SetScrapeIntervals(tick, defaultInterval time.Duration) {
+	c.schedule.tick = tick
+	c.schedule.defaultInterval = defaultInterval
+}
+
+// SetSpread spreads scrapes of a cycle over perNode times the number of
+// nodes, at most maxWindow. Zero perNode staggers scrapes randomly over a few
+// seconds instead.
+func (c *scraper) SetSpread(perNode, maxWindow time.Duration) {
+	c.scheduler.perNode = perNode
+	c.scheduler.maxWindow = maxWindow
+}
+
+// SetSkipPolicy skips nodes that are not Ready, if notReady is set, or that have one of taints.
+func (c *scraper) SetSkipPolicy(notReady bool, taints []corev1.Taint) {
+	c.policy.notReady = notReady
+	c.policy.taints = taints
+}
+
+// SetCircuitBreaker skips nodes after threshold consecutive failed scrapes
+// for exponentially more cycles, up to maxBackoff, probing them with a single
+// scrape in between. Zero threshold disables it.
+func (c *scraper) SetCircuitBreaker(threshold, maxBackoff int) {
+	c.breaker.threshold = threshold
+	c.breaker.maxBackoff = maxBackoff
+}
+
+// SetRemovedNodeGracePeriod keeps serving the last metrics of nodes deleted
+// from the API for period. Zero drops them right away.
+func (c *scraper) SetRemovedNodeGracePeriod(period time.Duration) {
+	c.removed.period = period
+}
+
+// SetAdaptiveTimeout derives the scrape timeout of each node from the 99th
+// percentile of its recent request durations plus margin, bounded by max.
+// Zero margin uses the static scrape timeout for all nodes.
+func (c *scraper) SetAdaptiveTimeout(margin, max time.Duration) {
+	c.timeouts.margin = margin
+	c.timeouts.max = max
+}
+
+// SetPushSource serves metrics pushed by node agents to source instead of
+// scraping their nodes, as long as they are fresh. If only is true, nodes
+// without fresh pushed metrics aren't scraped either.
+func (c *scraper) SetPushSource(source PushSource, only bool) {
+	c.pushed.source = source
+	c.pushed.only = only
+}
+
+// SetFilter skips nodes and drops pods excluded by filter, whose rules are
+// read again every cycle.
+func (c *scraper) SetFilter(filter storage.Filter) {
+	c.filter.filter = filter
+}
+
+// RemovedNodes returns nodes deleted from the API whose last metrics are
+// served during their grace period, annotated with annotations.NodeRemoved.
+func (c *scraper) RemovedNodes() []*corev1.Node {
+	return c.removed.nodes()
+}
+
+// ForceScrape makes nodes due for a scrape in the next cycle regardless of
+// their scrape interval, other nodes are scraped as scheduled.
+func (c *scraper) ForceScrape(nodes ...string) {
+	c.schedule.force(nodes)
+}
+
+// SetBudget limits the estimated total response size and wall-clock time of a
+// scrape cycle, deferring nodes scraped most recently when exceeded. Zero disables a limit.
+func (c *scraper) SetBudget(maxBytes int64, maxDuration time.Duration) {
+	c.budget.maxBytes = maxBytes
+	c.budget.maxDuration = maxDuration
 }
 
 var _ Scraper = (*scraper)(nil)
@@ -113,44 +304,71 @@ type NodeInfo struct {
 }
 
 func (c *scraper) Scrape(baseCtx context.Context) *storage.MetricsBatch {
+	logger := klog.FromContext(baseCtx)
 	nodes, err := c.nodeLister.List(c.labelSelector)
 	if err != nil {
 		// report the error and continue on in case of partial results
-		klog.ErrorS(err, "Failed to list nodes")
+		logger.Error(err, "Failed to list nodes")
 	}
-	klog.V(1).InfoS("Scraping metrics from nodes", "nodes", klog.KObjSlice(nodes), "nodeCount", len(nodes), "nodeSelector", c.labelSelector)
+	c.reportSelectorSkipped(len(nodes))
+	c.timeouts.forgetRemoved(nodes)
+	c.conditions.forgetRemoved(nodes)
+	removed := c.removed.plan(logger, nodes, c.nodeLister, myClock.Now())
+	nodes = c.filter.nodes(logger, nodes)
+	nodes, pushed := c.pushed.plan(logger, nodes)
+	nodes = c.policy.filter(logger, nodes)
+	nodes = c.dedupNodes(logger, nodes)
+	allNodes := nodes
+	nodes = c.breaker.plan(logger, nodes)
+	nodes, skipped := c.schedule.plan(logger, nodes, myClock.Now())
+	nodes, deferred := c.budget.plan(logger, nodes)
+	deadline, _ := baseCtx.Deadline()
+	scheduled := c.scheduler.plan(nodes, deadline, c.scrapeTimeout)
+	scheduled = c.priority.prioritize(scheduled, c.zones.lastSuccesses())
+	logger.V(1).Info("Scraping metrics from nodes", "nodes", klog.KObjSlice(nodes), "nodeCount", len(nodes), "nodeSelector", c.labelSelector)
 
-	responseChannel := make(chan *storage.MetricsBatch, len(nodes))
+	responseChannel := make(chan *storage.MetricsBatch, len(scheduled))
 	defer close(responseChannel)
 
 	startTime := myClock.Now()
 
-	// TODO(serathius): re-evaluate this code -- do we really need to stagger fetches like this?
-	delayMs := delayPerSourceMs * len(nodes)
-	if delayMs > maxDelayMs {
-		delayMs = maxDelayMs
-	}
-
-	for _, node := range nodes {
-		go func(node *corev1.Node) {
-			// Prevents network congestion.
-			sleepDuration := time.Duration(rand.Intn(delayMs)) * time.Millisecond
-			time.Sleep(sleepDuration)
-			// make the timeout a bit shorter to account for staggering, so we still preserve
-			// the overall timeout
-			ctx, cancelTimeout := context.WithTimeout(baseCtx, c.scrapeTimeout)
+	var cutOff, attempted, failed int32
+	for _, s := range scheduled {
+		go func(node *corev1.Node, delay time.Duration) {
+			select {
+			case <-time.After(delay):
+			case <-baseCtx.Done():
+				atomic.AddInt32(&cutOff, 1)
+				responseChannel <- nil
+				return
+			}
+			atomic.AddInt32(&attempted, 1)
+			nodeLogger := klog.LoggerWithValues(logger, "node", klog.KObj(node))
+			nodeCtx := klog.NewContext(baseCtx, nodeLogger)
+			timeout := c.timeouts.timeout(node.Name, c.scrapeTimeout)
+			ctx, cancelTimeout := context.WithTimeout(nodeCtx, timeout)
 			defer cancelTimeout()
-			klog.V(2).InfoS("Scraping node", "node", klog.KObj(node))
+			nodeLogger.V(2).Info("Scraping node")
+			start := myClock.Now()
 			m, err := c.collectNode(ctx, node)
 			if err != nil {
 				if errors.Is(err, context.DeadlineExceeded) {
-					klog.ErrorS(err, "Failed to scrape node, timeout to access kubelet", "node", klog.KObj(node), "timeout", c.scrapeTimeout)
+					nodeLogger.Error(err, "Failed to scrape node, timeout to access kubelet", "timeout", timeout)
 				} else {
-					klog.ErrorS(err, "Failed to scrape node", "node", klog.KObj(node))
+					nodeLogger.Error(err, "Failed to scrape node")
 				}
 			}
+			if err != nil {
+				atomic.AddInt32(&failed, 1)
+			}
+			if err != nil && baseCtx.Err() != nil {
+				atomic.AddInt32(&cutOff, 1)
+			}
+			c.timeouts.observe(node.Name, timeout, myClock.Since(start), err)
+			c.breaker.observe(nodeLogger, node.Name, err)
+			c.conditions.observe(nodeCtx, node, err)
 			responseChannel <- m
-		}(node)
+		}(s.node, s.delay)
 	}
 
 	res := &storage.MetricsBatch{
@@ -158,47 +376,273 @@ func (c *scraper) Scrape(baseCtx context.Context) *storage.MetricsBatch {
 		Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{},
 	}
 
-	for range nodes {
+	for range scheduled {
 		srcBatch := <-responseChannel
 		if srcBatch == nil {
 			continue
 		}
-		for nodeName, nodeMetricsPoint := range srcBatch.Nodes {
-			if _, nodeFind := res.Nodes[nodeName]; nodeFind {
-				klog.ErrorS(nil, "Got duplicate node point", "node", klog.KRef("", nodeName))
-				continue
-			}
-			res.Nodes[nodeName] = nodeMetricsPoint
+		mergeBatch(logger, res, srcBatch)
+	}
+	c.priority.finish(logger, int(atomic.LoadInt32(&cutOff)))
+	c.connectivity.record(int(atomic.LoadInt32(&attempted)), int(atomic.LoadInt32(&failed)))
+	// Deferred nodes resubmit their last points, so storage keeps serving them.
+	for _, srcBatch := range c.budget.deferredBatches(deferred) {
+		mergeBatch(logger, res, srcBatch)
+	}
+	c.budget.finish(myClock.Since(startTime), len(scheduled))
+	// Nodes not due for a scrape resubmit their last points too.
+	for _, srcBatch := range c.schedule.skippedBatches(skipped) {
+		mergeBatch(logger, res, srcBatch)
+	}
+	// Nodes deleted from the API resubmit their last points during their grace period.
+	for _, srcBatch := range removed {
+		mergeBatch(logger, res, srcBatch)
+	}
+	// Nodes with fresh pushed metrics are served those instead of being scraped.
+	for _, srcBatch := range pushed {
+		mergeBatch(logger, res, srcBatch)
+	}
+	c.filter.pods(res)
+
+	c.zones.report(allNodes, startTime)
+	logger.V(1).Info("Scrape finished", "duration", myClock.Since(startTime), "nodeCount", len(res.Nodes), "podCount", len(res.Pods))
+	return res
+}
+
+// reportSelectorSkipped reports the number of nodes not matching the node selector.
+func (c *scraper) reportSelectorSkipped(selected int) {
+	if c.labelSelector.Empty() {
+		return
+	}
+	all, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return
+	}
+	skippedNodes.WithLabelValues("node_selector").Set(float64(len(all) - selected))
+}
+
+func mergeBatch(logger klog.Logger, res, srcBatch *storage.MetricsBatch) {
+	for nodeName, nodeMetricsPoint := range srcBatch.Nodes {
+		if _, nodeFind := res.Nodes[nodeName]; nodeFind {
+			logger.Error(nil, "Got duplicate node point", "node", klog.KRef("", nodeName))
+			continue
 		}
-		for podRef, podMetricsPoint := range srcBatch.Pods {
-			if _, podFind := res.Pods[podRef]; podFind {
-				klog.ErrorS(nil, "Got duplicate pod point", "pod", klog.KRef(podRef.Namespace, podRef.Name))
-				continue
-			}
-			res.Pods[podRef] = podMetricsPoint
+		res.Nodes[nodeName] = nodeMetricsPoint
+	}
+	for podRef, podMetricsPoint := range srcBatch.Pods {
+		if _, podFind := res.Pods[podRef]; podFind {
+			logger.Error(nil, "Got duplicate pod point", "pod", klog.KRef(podRef.Namespace, podRef.Name))
+			continue
 		}
+		res.Pods[podRef] = podMetricsPoint
 	}
+	for nodeName := range srcBatch.PushedNodes {
+		if res.PushedNodes == nil {
+			res.PushedNodes = map[string]bool{}
+		}
+		res.PushedNodes[nodeName] = true
+	}
+	for nodeName := range srcBatch.WindowsNodes {
+		if res.WindowsNodes == nil {
+			res.WindowsNodes = map[string]bool{}
+		}
+		res.WindowsNodes[nodeName] = true
+	}
+	for nodeName, filesystems := range srcBatch.NodeFilesystems {
+		if res.NodeFilesystems == nil {
+			res.NodeFilesystems = map[string][]storage.FilesystemMetricsPoint{}
+		}
+		res.NodeFilesystems[nodeName] = filesystems
+	}
+}
 
-	klog.V(1).InfoS("Scrape finished", "duration", myClock.Since(startTime), "nodeCount", len(res.Nodes), "podCount", len(res.Pods))
+// dedupNodes drops nodes resolving to a Kubelet endpoint already claimed by
+// another node, so a single Kubelet is never scraped twice in one cycle.
+func (c *scraper) dedupNodes(logger klog.Logger, nodes []*corev1.Node) []*corev1.Node {
+	resolver, ok := c.kubeletClient.(client.KubeletEndpointResolver)
+	if !ok {
+		return nodes
+	}
+	duplicateEndpoint.Reset()
+	// Sort to make the choice of scraped node stable between cycles.
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	owners := make(map[string]string, len(nodes))
+	res := make([]*corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		endpoint, err := resolver.Endpoint(node)
+		if err != nil {
+			// Leave reporting the error to the scrape itself.
+			res = append(res, node)
+			continue
+		}
+		if owner, found := owners[endpoint]; found {
+			logger.V(1).Info("Skipping node sharing Kubelet endpoint with another node", "node", klog.KObj(node), "endpoint", endpoint, "scrapedAs", klog.KRef("", owner))
+			duplicateEndpoint.WithLabelValues(c.nodeLabels.Label(node.Name), c.nodeLabels.Label(owner)).Inc()
+			continue
+		}
+		owners[endpoint] = node.Name
+		res = append(res, node)
+	}
 	return res
 }
 
-func (c *scraper) collectNode(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
+func (c *scraper) collectNode(ctx context.Context, node *corev1.Node) (ms *storage.MetricsBatch, err error) {
 	startTime := myClock.Now()
+	var responseSize int64
+	ctx = client.WithResponseSizeCounter(ctx, &responseSize)
+	ctx, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, "Scrape node", trace.WithAttributes(attribute.String("node", node.Name)))
+	defer func() {
+		span.SetAttributes(attribute.Int64("response_bytes", atomic.LoadInt64(&responseSize)))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "scrape failed")
+		} else {
+			span.SetAttributes(attribute.Int("pods", len(ms.Pods)))
+		}
+		span.End()
+	}()
 	defer func() {
-		requestDuration.WithLabelValues(node.Name).Observe(float64(myClock.Since(startTime)) / float64(time.Second))
-		lastRequestTime.WithLabelValues(node.Name).Set(float64(myClock.Now().Unix()))
+		duration := myClock.Since(startTime)
+		label := c.nodeLabels.Label(node.Name)
+		utils.ObserveWithTrace(ctx, requestDuration.WithLabelValues(label), float64(duration)/float64(time.Second))
+		lastRequestTime.WithLabelValues(label).Set(float64(myClock.Now().Unix()))
+		c.budget.observe(node.Name, startTime, atomic.LoadInt64(&responseSize), ms)
+		c.schedule.observe(node.Name, ms)
+		c.removed.observe(node.Name, ms)
 	}()
-	ms, err := c.kubeletClient.GetMetrics(ctx, node)
+	ms, err = c.kubeletClient.GetMetrics(ctx, node)
+	if err != nil && c.nodeGetter != nil && isConnectionError(err) {
+		if fresh := c.refreshNode(ctx, node); fresh != nil {
+			klog.FromContext(ctx).V(1).Info("Node addresses changed after connection error, retrying", "err", err)
+			requestTotal.WithLabelValues("false").Inc()
+			ms, err = c.kubeletClient.GetMetrics(ctx, fresh)
+		}
+	}
 
 	if err != nil {
 		requestTotal.WithLabelValues("false").Inc()
+		requestErrors.WithLabelValues(c.nodeLabels.Label(node.Name)).Inc()
+		scrapeFailures.WithLabelValues(c.nodeLabels.Label(node.Name), scrapeFailureReason(err)).Inc()
 		return nil, err
 	}
 	requestTotal.WithLabelValues("true").Inc()
+	lastSuccessfulScrape.WithLabelValues(c.nodeLabels.Label(node.Name)).Set(float64(myClock.Now().Unix()))
+	c.zones.success(node.Name, myClock.Now())
+	if c.supplier != nil {
+		c.supplement(ctx, node, ms)
+	}
+	if c.devices != nil {
+		c.attachDevices(ctx, node, ms)
+	}
+	setNode(ms, node.Name)
+	if node.Spec.Unschedulable {
+		markDraining(ms)
+	}
 	return ms, nil
 }
 
+// setNode records the node pods of ms were scraped from on their points.
+func setNode(ms *storage.MetricsBatch, node string) {
+	for pod, point := range ms.Pods {
+		point.Node = node
+		ms.Pods[pod] = point
+	}
+}
+
+// markDraining flags pods of a cordoned node, whose metrics should stop being
+// served as soon as they start terminating.
+func markDraining(ms *storage.MetricsBatch) {
+	for pod, point := range ms.Pods {
+		point.NodeDraining = true
+		ms.Pods[pod] = point
+	}
+}
+
+// supplement sets supplemental usage on the node point of ms, if any.
+func (c *scraper) supplement(ctx context.Context, node *corev1.Node, ms *storage.MetricsBatch) {
+	point, found := ms.Nodes[node.Name]
+	if !found {
+		return
+	}
+	usage, err := c.supplier.GetNodeMetrics(ctx, node)
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to get supplemental node metrics")
+		return
+	}
+	if len(usage) == 0 {
+		return
+	}
+	point.Supplemental = &usage
+	ms.Nodes[node.Name] = point
+}
+
+// attachDevices sets devices allocated to pods of ms on their points. Reading
+// devices is best effort, pods are kept without them on errors.
+func (c *scraper) attachDevices(ctx context.Context, node *corev1.Node, ms *storage.MetricsBatch) {
+	devices, err := c.devices.GetPodDevices(ctx, node)
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "Failed to get pod devices")
+		return
+	}
+	for pod, allocations := range devices {
+		point, found := ms.Pods[pod]
+		if !found {
+			continue
+		}
+		point.Devices = allocations
+		ms.Pods[pod] = point
+	}
+}
+
+// refreshNode returns the latest version of node if its Kubelet endpoint
+// changed since node was cached, nil otherwise.
+func (c *scraper) refreshNode(ctx context.Context, node *corev1.Node) *corev1.Node {
+	if !c.refreshDue(node.Name) {
+		return nil
+	}
+	fresh, err := c.nodeGetter.Get(ctx, node.Name, metav1.GetOptions{})
+	if err != nil {
+		klog.FromContext(ctx).V(2).Info("Failed to refresh node", "err", err)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(node.Status.Addresses, fresh.Status.Addresses) &&
+		node.Status.DaemonEndpoints == fresh.Status.DaemonEndpoints {
+		return nil
+	}
+	return fresh
+}
+
+// refreshDue returns true and records a read if node wasn't read with
+// nodeGetter within the refresh interval. Reads older than the interval are
+// forgotten, so removed nodes aren't remembered.
+func (c *scraper) refreshDue(node string) bool {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if last, found := c.refreshed[node]; found && myClock.Since(last) < c.refreshInterval {
+		return false
+	}
+	for name, last := range c.refreshed {
+		if myClock.Since(last) >= c.refreshInterval {
+			delete(c.refreshed, name)
+		}
+	}
+	if c.refreshed == nil {
+		c.refreshed = map[string]time.Time{}
+	}
+	c.refreshed[node] = myClock.Now()
+	return true
+}
+
+// isConnectionError returns true if err was caused by failing to reach the Kubelet.
+func isConnectionError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
 type clock interface {
 	Now() time.Time
 	Since(time.Time) time.Duration
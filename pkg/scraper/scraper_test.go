@@ -16,22 +16,40 @@ package scraper
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/go-logr/logr/funcr"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/testutil"
+	"k8s.io/klog/v2"
 
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
+	"sigs.k8s.io/metrics-server/pkg/filter"
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 const timeDrift = 50 * time.Millisecond
@@ -206,6 +224,142 @@ var _ = Describe("Scraper", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("should label per-node metrics with node hash buckets", func() {
+		requestErrors.Create(nil)
+		requestErrors.Reset()
+		delete(client.metrics, node3)
+		delete(client.metrics, node4)
+
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.SetNodeLabelBuckets(1)
+		scraper.Scrape(context.Background())
+
+		err := testutil.CollectAndCompare(requestErrors, strings.NewReader(`
+		# HELP metrics_server_kubelet_request_errors_total [ALPHA] Number of failed requests to Kubelet API, per node or node hash bucket
+		# TYPE metrics_server_kubelet_request_errors_total counter
+		metrics_server_kubelet_request_errors_total{node="bucket-0"} 2
+		`), "metrics_server_kubelet_request_errors_total")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("mapping nodes to stable buckets")
+		Expect(utils.NodeLabels(16).Label("node1")).To(Equal(utils.NodeLabels(16).Label("node1")))
+		Expect(utils.NodeLabels(16).Label("node1")).To(MatchRegexp(`^bucket-([0-9]|1[0-5])$`))
+		Expect(utils.NodeLabels(0).Label("node1")).To(Equal("node1"))
+	})
+
+	It("should count failed scrapes by reason and record last successful scrapes", func() {
+		scrapeFailures.Create(nil)
+		lastSuccessfulScrape.Create(nil)
+		scrapeFailures.Reset()
+		lastSuccessfulScrape.Reset()
+		defer func(c clock) { myClock = c }(myClock)
+		myClock = mockClock{now: time.Unix(1700000000, 0), later: time.Unix(1700000000, 0)}
+		client.errors = map[*corev1.Node]error{
+			node2: fmt.Errorf("failed getting metrics: %w", context.DeadlineExceeded),
+			node3: statusError(503),
+			node4: decodeError(fmt.Errorf("unexpected EOF")),
+		}
+
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.Scrape(context.Background())
+
+		err := testutil.CollectAndCompare(scrapeFailures, strings.NewReader(`
+		# HELP metrics_server_kubelet_scrape_failures_total [ALPHA] Number of failed scrapes of Kubelets by failure reason, per node or node hash bucket
+		# TYPE metrics_server_kubelet_scrape_failures_total counter
+		metrics_server_kubelet_scrape_failures_total{node="node-no-host",reason="timeout"} 1
+		metrics_server_kubelet_scrape_failures_total{node="node3",reason="http_5xx"} 1
+		metrics_server_kubelet_scrape_failures_total{node="node4",reason="decode"} 1
+		`), "metrics_server_kubelet_scrape_failures_total")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = testutil.CollectAndCompare(lastSuccessfulScrape, strings.NewReader(`
+		# HELP metrics_server_kubelet_last_successful_scrape_timestamp_seconds [ALPHA] Time of the last successful scrape of Kubelets since unix epoch in seconds, per node or node hash bucket
+		# TYPE metrics_server_kubelet_last_successful_scrape_timestamp_seconds gauge
+		metrics_server_kubelet_last_successful_scrape_timestamp_seconds{node="node1"} 1.7e+09
+		`), "metrics_server_kubelet_last_successful_scrape_timestamp_seconds")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("classifying network and Kubelet errors")
+		Expect(scrapeFailureReason(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED})).To(Equal("connection"))
+		Expect(scrapeFailureReason(fmt.Errorf("Get %q: %w", "https://node1:10250/metrics/resource", x509.UnknownAuthorityError{}))).To(Equal("tls"))
+		Expect(scrapeFailureReason(fmt.Errorf("remote error: tls: bad certificate"))).To(Equal("tls"))
+		Expect(scrapeFailureReason(statusError(401))).To(Equal("http_4xx"))
+		Expect(scrapeFailureReason(fmt.Errorf("unreachable"))).To(Equal("other"))
+	})
+
+	It("should set the MetricsAvailable condition of nodes when it changes", func() {
+		healthy := makeNode("healthy", "healthy.somedomain", "10.0.1.6", true)
+		failing := makeNode("failing", "failing.somedomain", "10.0.1.7", true)
+		nodes := fakeNodeLister{nodes: []*corev1.Node{healthy, failing}}
+		client.metrics[healthy] = &storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{healthy.Name: metricPoint(100, 200, scrapeTime)}}
+		client.metrics[failing] = &storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{failing.Name: metricPoint(100, 200, scrapeTime)}}
+		client.errors = map[*corev1.Node]error{failing: statusError(503)}
+		patcher := &fakeStatusPatcher{nodes: nodes.nodes}
+		scraper := NewScraper(&nodes, &client, 5*time.Second, labelRequirement)
+		scraper.SetNodeConditions(patcher, 2)
+
+		By("setting the condition of scraped nodes to True")
+		scraper.Scrape(context.Background())
+		Expect(patcher.patches).To(Equal(map[string]int{"healthy": 1}))
+		Expect(metricsAvailable(healthy)).To(HaveField("Status", corev1.ConditionTrue))
+		Expect(metricsAvailable(healthy)).To(HaveField("Reason", "MetricsScraped"))
+
+		By("setting the condition to False after consecutive failed scrapes")
+		scraper.Scrape(context.Background())
+		Expect(patcher.patches).To(Equal(map[string]int{"healthy": 1, "failing": 1}))
+		Expect(metricsAvailable(failing)).To(HaveField("Status", corev1.ConditionFalse))
+		Expect(metricsAvailable(failing)).To(HaveField("Reason", "KubeletError"))
+
+		By("setting the condition to True once the node recovers")
+		delete(client.errors, failing)
+		scraper.Scrape(context.Background())
+		Expect(patcher.patches).To(Equal(map[string]int{"healthy": 1, "failing": 2}))
+		Expect(metricsAvailable(failing)).To(HaveField("Status", corev1.ConditionTrue))
+	})
+
+	It("should report coverage and freshness per zone", func() {
+		zoneNodes.Create(nil)
+		zoneScrapedNodes.Create(nil)
+		zoneMaxStaleness.Create(nil)
+
+		myClock = mockClock{
+			now:   time.Time{},
+			later: time.Time{}.Add(time.Second),
+		}
+		zoneA := node1.DeepCopy()
+		zoneA.Labels = map[string]string{corev1.LabelTopologyZone: "zone-a"}
+		zoneB := node3.DeepCopy()
+		zoneB.Labels = map[string]string{corev1.LabelTopologyZone: "zone-b"}
+		client.metrics[zoneA] = client.metrics[node1]
+		nodes := fakeNodeLister{nodes: []*corev1.Node{zoneA, zoneB}}
+
+		By("scraping a cycle where only the node of zone-a succeeds")
+		scraper := NewScraper(&nodes, &client, 3*time.Second, labelRequirement)
+		scraper.Scrape(context.Background())
+
+		err := testutil.CollectAndCompare(zoneNodes, strings.NewReader(`
+		# HELP metrics_server_kubelet_zone_nodes [ALPHA] Number of nodes selected for scraping in the last cycle per topology zone
+		# TYPE metrics_server_kubelet_zone_nodes gauge
+		metrics_server_kubelet_zone_nodes{zone="zone-a"} 1
+		metrics_server_kubelet_zone_nodes{zone="zone-b"} 1
+		`), "metrics_server_kubelet_zone_nodes")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = testutil.CollectAndCompare(zoneScrapedNodes, strings.NewReader(`
+		# HELP metrics_server_kubelet_zone_scraped_nodes [ALPHA] Number of nodes successfully scraped in the last cycle per topology zone
+		# TYPE metrics_server_kubelet_zone_scraped_nodes gauge
+		metrics_server_kubelet_zone_scraped_nodes{zone="zone-a"} 1
+		metrics_server_kubelet_zone_scraped_nodes{zone="zone-b"} 0
+		`), "metrics_server_kubelet_zone_scraped_nodes")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = testutil.CollectAndCompare(zoneMaxStaleness, strings.NewReader(`
+		# HELP metrics_server_kubelet_zone_max_staleness_seconds [ALPHA] Time since the oldest last successful scrape among nodes of a topology zone. Nodes never scraped are not included
+		# TYPE metrics_server_kubelet_zone_max_staleness_seconds gauge
+		metrics_server_kubelet_zone_max_staleness_seconds{zone="zone-a"} 1
+		`), "metrics_server_kubelet_zone_max_staleness_seconds")
+		Expect(err).NotTo(HaveOccurred())
+	})
 	It("should continue on error fetching node information for a particular node", func() {
 		By("deleting node")
 		nodeLister.nodes[0].Status.Addresses = nil
@@ -217,6 +371,540 @@ var _ = Describe("Scraper", func() {
 
 		By("ensuring that all other node were scraped")
 		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node4", "node-no-host", "node3"}))
+
+		By("reporting the failed scrape")
+		scraped, failed := scraper.KubeletConnectivity()
+		Expect(scraped).To(Equal(4))
+		Expect(failed).To(Equal(1))
+	})
+	It("should log failed scrapes with the node and the values of the logger in the context", func() {
+		nodeLister.nodes[0].Status.Addresses = nil
+		delete(client.metrics, node1)
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		var (
+			mu   sync.Mutex
+			logs []string
+		)
+		logger := funcr.New(func(_, args string) {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, args)
+		}, funcr.Options{})
+
+		scraper.Scrape(klog.NewContext(context.Background(), klog.LoggerWithValues(logger, "cycle", 7)))
+
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(logs).To(ContainElement(SatisfyAll(
+			ContainSubstring(`"msg"="Failed to scrape node"`),
+			ContainSubstring(`"cycle"=7`),
+			ContainSubstring(`"node"={"name":"node1"}`),
+		)))
+	})
+	It("should trace scrapes of nodes as children of the span in the context", func() {
+		recorder := tracetest.NewSpanRecorder()
+		tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+		delete(client.metrics, node1)
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+
+		By("running the scraper within a span")
+		ctx, cycle := tracer.Start(context.Background(), "Scrape cycle")
+		scraper.Scrape(ctx)
+		cycle.End()
+
+		By("ensuring a span was recorded per node")
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range recorder.Ended() {
+			if span.Name() != "Scrape node" {
+				continue
+			}
+			Expect(span.Parent().SpanID()).To(Equal(cycle.SpanContext().SpanID()))
+			for _, attr := range span.Attributes() {
+				if attr.Key == "node" {
+					spans[attr.Value.AsString()] = span
+				}
+			}
+		}
+		Expect(spans).To(HaveLen(4))
+		Expect(spans[node1.Name].Status().Code).To(Equal(codes.Error))
+		Expect(spans[node3.Name].Status().Code).To(Equal(codes.Unset))
+	})
+	It("should scrape nodes sharing a Kubelet endpoint only once", func() {
+		By("resolving node4 to the same endpoint as node3")
+		client.endpoints = map[*corev1.Node]string{
+			node3: "10.0.1.4:10250",
+			node4: "10.0.1.4:10250",
+		}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that node4 was skipped")
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3"}))
+	})
+	It("should re-resolve node addresses and retry on connection error", func() {
+		By("making node1 unreachable on its cached address")
+		client.errors = map[*corev1.Node]error{
+			node1: &url.Error{Op: "Get", URL: "https://node1.somedomain:10250/metrics/resource", Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}},
+		}
+		fresh := makeNode("node1", "node1.otherdomain", "10.0.2.2", true)
+		client.metrics[fresh] = client.metrics[node1]
+		now := time.Now()
+		myClock = mockClock{now: now, later: now}
+		getter := &fakeNodeGetter{nodes: []*corev1.Node{fresh}}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.SetNodeGetter(getter, time.Minute)
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that node1 was scraped using its new address")
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+		Expect(getter.gets).To(Equal(1))
+
+		By("not reading node1 again within the refresh interval")
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node-no-host", "node3", "node4"}))
+		Expect(getter.gets).To(Equal(1))
+
+		By("reading node1 again once the refresh interval elapsed")
+		myClock = mockClock{now: now, later: now.Add(time.Minute)}
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+		Expect(getter.gets).To(Equal(2))
+	})
+	It("should defer nodes scraped most recently when the scrape budget is exceeded", func() {
+		registry := metrics.NewKubeRegistry()
+		registry.MustRegister(deferredNode)
+		myClock = &realClock{}
+		client.sizes = map[*corev1.Node]int{node1: 100, node2: 100, node3: 100, node4: 100}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.SetBudget(250, 0)
+
+		By("scraping all nodes while their cost is unknown")
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+
+		By("deferring nodes exceeding the budget while still returning their last points")
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+		firstDeferred := gaugeNodeNames(registry, "metrics_server_kubelet_scrape_deferred")
+		Expect(firstDeferred).To(HaveLen(2))
+
+		By("scraping deferred nodes first in the next cycle")
+		scraper.Scrape(context.Background())
+		secondDeferred := gaugeNodeNames(registry, "metrics_server_kubelet_scrape_deferred")
+		Expect(secondDeferred).To(HaveLen(2))
+		Expect(append(firstDeferred, secondDeferred...)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+
+		By("keeping last points of the nodes expected to be deferred only")
+		Expect(scraper.budget.lastBatch).To(HaveLen(2))
+	})
+	It("should budget the wall-clock time of a cycle, not request time summed over nodes scraped in parallel", func() {
+		registry := metrics.NewKubeRegistry()
+		registry.MustRegister(deferredNode)
+		start := time.Now()
+		myClock = mockClock{now: start, later: start.Add(4 * time.Second)}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+
+		By("scraping all nodes in a cycle taking 4s while each request takes 4s")
+		scraper.SetBudget(0, 10*time.Second)
+		scraper.Scrape(context.Background())
+
+		By("scraping all nodes again as the cycle fits the budget")
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+		Expect(gaugeNodeNames(registry, "metrics_server_kubelet_scrape_deferred")).To(BeEmpty())
+
+		By("lowering the budget, scraping all nodes as no last points were kept for them")
+		scraper.SetBudget(0, 2*time.Second)
+		scraper.Scrape(context.Background())
+		Expect(gaugeNodeNames(registry, "metrics_server_kubelet_scrape_deferred")).To(BeEmpty())
+
+		By("deferring nodes once their share of the cycle exceeds the budget")
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+		Expect(gaugeNodeNames(registry, "metrics_server_kubelet_scrape_deferred")).To(HaveLen(2))
+	})
+	It("should skip nodes not due for a scrape according to their scrape interval", func() {
+		slowNode := node1.DeepCopy()
+		slowNode.Annotations = map[string]string{ScrapeIntervalAnnotation: "5m"}
+		fastNode := node3.DeepCopy()
+		fastNode.Annotations = map[string]string{ScrapeIntervalAnnotation: "1s"}
+		client.metrics[slowNode] = client.metrics[node1]
+		client.metrics[fastNode] = client.metrics[node3]
+		nodes := fakeNodeLister{nodes: []*corev1.Node{slowNode, fastNode, node4}}
+		start := time.Now()
+		myClock = mockClock{now: start, later: start}
+		scraper := NewScraper(&nodes, &client, 5*time.Second, labelRequirement)
+		scraper.SetScrapeIntervals(10*time.Second, 30*time.Second)
+
+		By("scraping all nodes in the first cycle")
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node3", "node4"}))
+
+		By("scraping only nodes with intervals shorter than the default after a tick")
+		client.errors = map[*corev1.Node]error{slowNode: fmt.Errorf("unreachable"), fastNode: fmt.Errorf("unreachable"), node4: fmt.Errorf("unreachable")}
+		myClock = mockClock{now: start.Add(10 * time.Second), later: start.Add(10 * time.Second)}
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node4"}))
+
+		By("scraping nodes without annotation after the default interval")
+		myClock = mockClock{now: start.Add(30 * time.Second), later: start.Add(30 * time.Second)}
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1"}))
+	})
+	It("should scrape forced nodes before their scrape interval elapsed", func() {
+		start := time.Now()
+		myClock = mockClock{now: start, later: start}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.SetScrapeIntervals(10*time.Second, 30*time.Second)
+		scraper.Scrape(context.Background())
+
+		By("scraping only forced nodes in the next cycle")
+		client.scraped = map[string]bool{}
+		scraper.ForceScrape("node3")
+		myClock = mockClock{now: start.Add(10 * time.Second), later: start.Add(10 * time.Second)}
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(client.scraped).To(Equal(map[string]bool{"node3": true}))
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+	})
+	It("should spread scrapes over a window proportional to the number of nodes", func() {
+		start := time.Now()
+		myClock = mockClock{now: start, later: start}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		nodes := []*corev1.Node{node1, node2, node3, node4}
+		delays := func(scheduled []scheduledNode) []time.Duration {
+			res := make([]time.Duration, 0, len(scheduled))
+			for _, s := range scheduled {
+				res = append(res, s.delay)
+			}
+			return res
+		}
+
+		By("spreading scrapes of 4 nodes over 4 times the per node spacing")
+		scraper.SetSpread(100*time.Millisecond, 0)
+		Expect(delays(scraper.scheduler.plan(nodes, time.Time{}, 5*time.Second))).To(Equal([]time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}))
+
+		By("limiting the window to the maximum")
+		scraper.SetSpread(time.Second, 200*time.Millisecond)
+		Expect(delays(scraper.scheduler.plan(nodes, time.Time{}, 5*time.Second))).To(Equal([]time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond}))
+
+		By("limiting the window to the time left for the last scrape before the deadline")
+		scraper.SetSpread(time.Second, 0)
+		Expect(delays(scraper.scheduler.plan(nodes, start.Add(7*time.Second), 5*time.Second))).To(Equal([]time.Duration{0, 500 * time.Millisecond, time.Second, 1500 * time.Millisecond}))
+
+		By("scraping every node of the window")
+		scraper.SetSpread(time.Millisecond, 0)
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+	})
+	It("should scrape nodes with the oldest metrics first after a cycle did not finish in time", func() {
+		myClock = &realClock{}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+
+		By("cutting off the scrape of a slow node at the end of the cycle")
+		client.delay[node3] = time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		dataBatch := scraper.Scrape(ctx)
+		cancel()
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node4"}))
+		Expect(scraper.priority.overloaded).To(BeTrue())
+
+		By("giving the shortest delay to the node with the oldest metrics")
+		scheduled := scraper.priority.prioritize([]scheduledNode{
+			{node: node1, delay: 0},
+			{node: node3, delay: time.Second},
+			{node: node4, delay: 2 * time.Second},
+		}, scraper.zones.lastSuccesses())
+		Expect(scheduled[0].node).To(Equal(node3))
+		Expect(scheduled[0].delay).To(BeZero())
+		Expect(scheduled[2].delay).To(Equal(2 * time.Second))
+
+		By("keeping scheduled delays once a cycle finished in time")
+		delete(client.delay, node3)
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+		Expect(scraper.priority.overloaded).To(BeFalse())
+	})
+	It("should back off scraping consistently failing nodes", func() {
+		registry := metrics.NewKubeRegistry()
+		registry.MustRegister(backedOffNode)
+		myClock = &realClock{}
+		client.errors = map[*corev1.Node]error{node3: fmt.Errorf("unreachable")}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.SetCircuitBreaker(2, 8)
+
+		By("scraping the failing node until it failed twice")
+		for i := 0; i < 2; i++ {
+			dataBatch := scraper.Scrape(context.Background())
+			Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node4"}))
+			Expect(gaugeNodeNames(registry, "metrics_server_kubelet_scrape_backoff")).To(BeEmpty())
+		}
+
+		By("skipping the failing node in the next cycle")
+		scraper.Scrape(context.Background())
+		Expect(gaugeNodeNames(registry, "metrics_server_kubelet_scrape_backoff")).To(ConsistOf([]string{"node3"}))
+
+		By("scraping it again once it recovered")
+		client.errors = nil
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+		Expect(gaugeNodeNames(registry, "metrics_server_kubelet_scrape_backoff")).To(BeEmpty())
+	})
+	It("should probe failing nodes at an exponentially decreasing rate", func() {
+		breakerNodes.Create(nil)
+		client.errors = map[*corev1.Node]error{node3: fmt.Errorf("timed out")}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.SetCircuitBreaker(1, 2)
+
+		By("recording the cycles in which the failing node was scraped")
+		var scraped []int
+		for cycle := 1; cycle <= 9; cycle++ {
+			client.scraped = map[string]bool{}
+			scraper.Scrape(context.Background())
+			if client.scraped[node3.Name] {
+				scraped = append(scraped, cycle)
+			}
+		}
+
+		By("ensuring that it was probed after backoffs of 1 and then at most 2 cycles")
+		Expect(scraped).To(Equal([]int{1, 3, 6, 9}))
+		err := testutil.CollectAndCompare(breakerNodes, strings.NewReader(`
+		# HELP metrics_server_kubelet_circuit_breaker_nodes [ALPHA] Number of nodes per circuit breaker state in the last scrape
+		# TYPE metrics_server_kubelet_circuit_breaker_nodes gauge
+		metrics_server_kubelet_circuit_breaker_nodes{state="closed"} 3
+		metrics_server_kubelet_circuit_breaker_nodes{state="half_open"} 1
+		metrics_server_kubelet_circuit_breaker_nodes{state="open"} 0
+		`), "metrics_server_kubelet_circuit_breaker_nodes")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("closing the breaker once the node recovers")
+		client.errors = nil
+		for i := 0; i < 4; i++ {
+			scraper.Scrape(context.Background())
+		}
+		closed, err := testutil.GetGaugeMetricValue(breakerNodes.WithLabelValues(breakerClosed))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(closed).To(BeEquivalentTo(4))
+	})
+	It("should merge supplemental node metrics into node points", func() {
+		supplier := &fakeSupplier{usage: map[string]corev1.ResourceList{
+			node1.Name: {"example.com/disk-available": resource.MustParse("10Gi")},
+		}, errors: map[string]error{node3.Name: fmt.Errorf("unreachable")}}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.SetNodeMetricsSupplier(supplier)
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that only node1 has supplemental metrics and failures don't drop nodes")
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node3", "node4"}))
+		Expect(dataBatch.Nodes[node1.Name].Supplemental).To(Equal(&corev1.ResourceList{"example.com/disk-available": resource.MustParse("10Gi")}))
+		Expect(dataBatch.Nodes[node1.Name].CumulativeCpuUsed).To(BeEquivalentTo(100))
+		Expect(dataBatch.Nodes[node3.Name].Supplemental).To(BeNil())
+		Expect(dataBatch.Nodes[node4.Name].Supplemental).To(BeNil())
+	})
+	It("should set devices on pod points", func() {
+		devices := fakeDevicesSupplier{node1.Name: {
+			{Namespace: "ns1", Name: "pod1"}: {{Container: "container1", Resource: "nvidia.com/gpu", IDs: []string{"GPU-1"}}},
+			{Namespace: "ns9", Name: "gone"}: {{Container: "container1", Resource: "nvidia.com/gpu", IDs: []string{"GPU-2"}}},
+		}}
+		scraper := NewScraper(&nodeLister, &client, 5*time.Second, labelRequirement)
+		scraper.SetPodDevicesSupplier(devices)
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that devices are set on scraped pods only")
+		Expect(podNames(dataBatch)).To(ConsistOf([]string{"ns1/pod1", "ns1/pod2", "ns2/pod1", "ns3/pod1"}))
+		Expect(dataBatch.Pods[apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}].Devices).To(Equal([]storage.DeviceAllocation{{Container: "container1", Resource: "nvidia.com/gpu", IDs: []string{"GPU-1"}}}))
+		Expect(dataBatch.Pods[apitypes.NamespacedName{Namespace: "ns1", Name: "pod2"}].Devices).To(BeEmpty())
+	})
+	It("should mark pods of cordoned nodes as draining", func() {
+		cordoned := node1.DeepCopy()
+		cordoned.Spec.Unschedulable = true
+		client.metrics[cordoned] = client.metrics[node1]
+		nodes := fakeNodeLister{nodes: []*corev1.Node{cordoned, node2}}
+		scraper := NewScraper(&nodes, &client, 5*time.Second, labelRequirement)
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that all pods of the cordoned node are marked")
+		Expect(dataBatch.Pods).To(HaveLen(4))
+		for _, pod := range dataBatch.Pods {
+			Expect(pod.NodeDraining).To(BeTrue())
+		}
+	})
+	It("should skip nodes that are not ready or tainted according to the skip policy", func() {
+		skippedNodes.Create(nil)
+		skippedNodes.Reset()
+		ready := corev1.NodeCondition{Type: corev1.NodeReady, Status: corev1.ConditionTrue}
+		ready1, ready2 := node1.DeepCopy(), node2.DeepCopy()
+		ready1.Status.Conditions = []corev1.NodeCondition{ready}
+		ready2.Status.Conditions = []corev1.NodeCondition{ready}
+		unreachable := node3.DeepCopy()
+		unreachable.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown}}
+		cordoned := node4.DeepCopy()
+		cordoned.Status.Conditions = []corev1.NodeCondition{ready}
+		cordoned.Spec.Taints = []corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}
+		client.metrics[ready1] = client.metrics[node1]
+		client.metrics[ready2] = client.metrics[node2]
+		client.metrics[unreachable] = client.metrics[node3]
+		client.metrics[cordoned] = client.metrics[node4]
+		nodes := fakeNodeLister{nodes: []*corev1.Node{ready1, ready2, unreachable, cordoned}}
+		scraper := NewScraper(&nodes, &client, 5*time.Second, labelRequirement)
+		taints, err := ParseTaints([]string{corev1.TaintNodeUnschedulable})
+		Expect(err).NotTo(HaveOccurred())
+		scraper.SetSkipPolicy(true, taints)
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that only ready nodes without the taint were scraped and skipped nodes are reported")
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host"}))
+		err = testutil.CollectAndCompare(skippedNodes, strings.NewReader(`
+		# HELP metrics_server_kubelet_skipped_nodes [ALPHA] Number of nodes not scraped in the last scrape, by reason
+		# TYPE metrics_server_kubelet_skipped_nodes gauge
+		metrics_server_kubelet_skipped_nodes{reason="node_selector"} 0
+		metrics_server_kubelet_skipped_nodes{reason="not_ready"} 1
+		metrics_server_kubelet_skipped_nodes{reason="taint"} 1
+		`), "metrics_server_kubelet_skipped_nodes")
+		Expect(err).NotTo(HaveOccurred())
+	})
+	It("should serve last metrics of deleted nodes during their grace period", func() {
+		registry := metrics.NewKubeRegistry()
+		registry.MustRegister(removedNodesServed)
+		start := time.Now()
+		myClock = mockClock{now: start, later: start}
+		nodes := fakeNodeLister{nodes: []*corev1.Node{node1, node3}}
+		scraper := NewScraper(&nodes, &client, 5*time.Second, labelRequirement)
+		scraper.SetRemovedNodeGracePeriod(time.Minute)
+		scraper.Scrape(context.Background())
+
+		By("resubmitting the last points of the deleted node with its pods flagged")
+		nodes.nodes = []*corev1.Node{node1}
+		myClock = mockClock{now: start.Add(30 * time.Second), later: start.Add(30 * time.Second)}
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node3"}))
+		for pod := range client.metrics[node3].Pods {
+			Expect(dataBatch.Pods[pod].NodeRemoved).To(BeTrue())
+		}
+		for pod := range client.metrics[node1].Pods {
+			Expect(dataBatch.Pods[pod].NodeRemoved).To(BeFalse())
+		}
+		removed := scraper.RemovedNodes()
+		Expect(removed).To(HaveLen(1))
+		Expect(removed[0].Name).To(Equal("node3"))
+		Expect(removed[0].Annotations).To(HaveKeyWithValue(annotations.NodeRemoved, "true"))
+		Expect(testutil.GetGaugeMetricValue(removedNodesServed)).To(BeEquivalentTo(1))
+
+		By("dropping the deleted node once its grace period expired")
+		myClock = mockClock{now: start.Add(90 * time.Second), later: start.Add(90 * time.Second)}
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1"}))
+		Expect(scraper.RemovedNodes()).To(BeEmpty())
+	})
+	It("should serve metrics pushed for nodes instead of scraping them", func() {
+		client.scraped = map[string]bool{}
+		pushedBatch := &storage.MetricsBatch{
+			Nodes:       map[string]storage.MetricsPoint{"node3": {Timestamp: scrapeTime, CumulativeCpuUsed: 1, MemoryUsage: 2}},
+			Pods:        map[apitypes.NamespacedName]storage.PodMetricsPoint{{Namespace: "ns1", Name: "pushed"}: {Pushed: true}},
+			PushedNodes: map[string]bool{"node3": true},
+		}
+		nodes := fakeNodeLister{nodes: []*corev1.Node{node1, node3}}
+		scraper := NewScraper(&nodes, &client, 5*time.Second, labelRequirement)
+		scraper.SetPushSource(fakePushSource{"node3": pushedBatch, "unknown": pushedBatch}, false)
+
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(client.scraped).To(Equal(map[string]bool{"node1": true}))
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node3"}))
+		Expect(dataBatch.Nodes["node3"]).To(Equal(pushedBatch.Nodes["node3"]))
+		Expect(dataBatch.Pods).To(HaveKey(apitypes.NamespacedName{Namespace: "ns1", Name: "pushed"}))
+		Expect(dataBatch.PushedNodes).To(Equal(map[string]bool{"node3": true}))
+
+		By("not scraping nodes without pushed metrics when only serving pushed metrics")
+		client.scraped = map[string]bool{}
+		scraper.SetPushSource(fakePushSource{"node3": pushedBatch}, true)
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(client.scraped).To(BeEmpty())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node3"}))
+	})
+	It("should apply the latest filter rules every cycle", func() {
+		skippedNodes.Create(nil)
+		skippedNodes.Reset()
+		excluded := node3.DeepCopy()
+		excluded.Labels = map[string]string{"pool": "noisy"}
+		client.metrics[excluded] = client.metrics[node3]
+		nodes := fakeNodeLister{nodes: []*corev1.Node{node1, excluded}}
+		scraper := NewScraper(&nodes, &client, 5*time.Second, labelRequirement)
+		rules := &filter.Dynamic{}
+		scraper.SetFilter(rules)
+
+		By("scraping everything without rules")
+		dataBatch := scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node3"}))
+		Expect(podNames(dataBatch)).To(ConsistOf([]string{"ns1/pod1", "ns1/pod2", "ns2/pod1", "ns3/pod1"}))
+
+		By("skipping excluded nodes and dropping excluded pods once rules are set")
+		excludeRules, err := filter.New(filter.Config{NodeSelector: "pool!=noisy", ExcludeNamespaces: []string{"ns2"}, ExcludePods: []string{"ns1/*2"}})
+		Expect(err).NotTo(HaveOccurred())
+		rules.Set(excludeRules)
+		dataBatch = scraper.Scrape(context.Background())
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1"}))
+		Expect(podNames(dataBatch)).To(ConsistOf([]string{"ns1/pod1", "ns3/pod1"}))
+		Expect(testutil.GetGaugeMetricValue(skippedNodes.WithLabelValues("filter"))).To(BeEquivalentTo(1))
+	})
+	It("should derive node timeouts from recent request durations", func() {
+		timeouts := adaptiveTimeout{margin: time.Second, max: 50 * time.Second}
+		static := 10 * time.Second
+
+		By("using the static timeout for nodes without successful requests")
+		Expect(timeouts.timeout("node1", static)).To(Equal(static))
+		timeouts.observe("node1", static, static, context.DeadlineExceeded)
+		Expect(timeouts.timeout("node1", static)).To(Equal(static))
+
+		By("using the 99th percentile of durations plus margin")
+		for i := 1; i <= timeoutSamples; i++ {
+			timeouts.observe("fast", static, time.Duration(i)*time.Millisecond, nil)
+			timeouts.observe("slow", static, 20*time.Second, nil)
+		}
+		Expect(timeouts.timeout("fast", static)).To(Equal(time.Second + 99*time.Millisecond))
+		Expect(timeouts.timeout("slow", static)).To(Equal(21 * time.Second))
+
+		By("doubling the timeout of nodes timing out, up to the maximum, until a request succeeds")
+		timeouts.observe("slow", 21*time.Second, 21*time.Second, fmt.Errorf("scrape failed: %w", context.DeadlineExceeded))
+		Expect(timeouts.timeout("slow", static)).To(Equal(42 * time.Second))
+		timeouts.observe("slow", 42*time.Second, 42*time.Second, context.DeadlineExceeded)
+		Expect(timeouts.timeout("slow", static)).To(Equal(50 * time.Second))
+		timeouts.observe("slow", 50*time.Second, 19*time.Second, nil)
+		Expect(timeouts.timeout("slow", static)).To(Equal(21 * time.Second))
+
+		By("forgetting removed nodes")
+		timeouts.forgetRemoved([]*corev1.Node{node1})
+		Expect(timeouts.timeout("fast", static)).To(Equal(static))
+	})
+	It("should only scrape nodes matching the node selector", func() {
+		skippedNodes.Create(nil)
+		skippedNodes.Reset()
+		skipped := node3.DeepCopy()
+		skipped.Labels = map[string]string{"metrics-server-skip": "true"}
+		nodes := fakeNodeLister{nodes: []*corev1.Node{node1, node2, skipped, node4}}
+		scraper := NewScraper(&nodes, &client, 5*time.Second, labelRequirement)
+
+		By("running the scraper")
+		dataBatch := scraper.Scrape(context.Background())
+
+		By("ensuring that the skipped node was not scraped and is reported as skipped")
+		Expect(nodeNames(dataBatch)).To(ConsistOf([]string{"node1", "node-no-host", "node4"}))
+		err := testutil.CollectAndCompare(skippedNodes, strings.NewReader(`
+		# HELP metrics_server_kubelet_skipped_nodes [ALPHA] Number of nodes not scraped in the last scrape, by reason
+		# TYPE metrics_server_kubelet_skipped_nodes gauge
+		metrics_server_kubelet_skipped_nodes{reason="node_selector"} 1
+		`), "metrics_server_kubelet_skipped_nodes")
+		Expect(err).NotTo(HaveOccurred())
 	})
 	It("should gracefully handle list errors", func() {
 		By("setting a fake error from the lister")
@@ -228,6 +916,14 @@ var _ = Describe("Scraper", func() {
 	})
 })
 
+func statusError(code int) error {
+	return &client.StatusError{StatusCode: code, Status: fmt.Sprintf("%d %s", code, http.StatusText(code))}
+}
+
+func decodeError(err error) error {
+	return &client.DecodeError{Err: err}
+}
+
 func metricPoint(cpu, memory uint64, time time.Time) storage.MetricsPoint {
 	return storage.MetricsPoint{
 		Timestamp:         time,
@@ -239,12 +935,34 @@ func metricPoint(cpu, memory uint64, time time.Time) storage.MetricsPoint {
 type fakeKubeletClient struct {
 	delay        map[*corev1.Node]time.Duration
 	metrics      map[*corev1.Node]*storage.MetricsBatch
+	endpoints    map[*corev1.Node]string
+	errors       map[*corev1.Node]error
+	sizes        map[*corev1.Node]int
 	defaultDelay time.Duration
+	// scraped records names of nodes GetMetrics was called for, if not nil.
+	mu      sync.Mutex
+	scraped map[string]bool
 }
 
 var _ client.KubeletMetricsGetter = (*fakeKubeletClient)(nil)
+var _ client.KubeletEndpointResolver = (*fakeKubeletClient)(nil)
+
+func (c *fakeKubeletClient) Endpoint(node *corev1.Node) (string, error) {
+	if endpoint, ok := c.endpoints[node]; ok {
+		return endpoint, nil
+	}
+	return node.Name, nil
+}
 
 func (c *fakeKubeletClient) GetMetrics(ctx context.Context, node *corev1.Node) (*storage.MetricsBatch, error) {
+	c.mu.Lock()
+	if c.scraped != nil {
+		c.scraped[node.Name] = true
+	}
+	c.mu.Unlock()
+	if err, ok := c.errors[node]; ok {
+		return nil, err
+	}
 	delay, ok := c.delay[node]
 	if !ok {
 		delay = c.defaultDelay
@@ -259,20 +977,122 @@ func (c *fakeKubeletClient) GetMetrics(ctx context.Context, node *corev1.Node) (
 		return nil, fmt.Errorf("timed out")
 	case <-time.After(delay):
 	}
+	client.AddResponseSize(ctx, c.sizes[node])
 	return metrics, nil
 }
 
+type fakeSupplier struct {
+	usage  map[string]corev1.ResourceList
+	errors map[string]error
+}
+
+var _ client.NodeMetricsSupplier = (*fakeSupplier)(nil)
+
+func (s *fakeSupplier) GetNodeMetrics(_ context.Context, node *corev1.Node) (corev1.ResourceList, error) {
+	if err, ok := s.errors[node.Name]; ok {
+		return nil, err
+	}
+	return s.usage[node.Name], nil
+}
+
+type fakeDevicesSupplier map[string]map[apitypes.NamespacedName][]storage.DeviceAllocation
+
+var _ client.PodDevicesSupplier = fakeDevicesSupplier(nil)
+
+func (s fakeDevicesSupplier) GetPodDevices(_ context.Context, node *corev1.Node) (map[apitypes.NamespacedName][]storage.DeviceAllocation, error) {
+	devices, found := s[node.Name]
+	if !found {
+		return nil, fmt.Errorf("no pod resources endpoint on node %q", node.Name)
+	}
+	return devices, nil
+}
+
+type fakePushSource map[string]*storage.MetricsBatch
+
+var _ PushSource = fakePushSource(nil)
+
+func (s fakePushSource) PushedBatches() map[string]*storage.MetricsBatch {
+	return s
+}
+
+// fakeStatusPatcher applies the conditions of status patches to nodes.
+type fakeStatusPatcher struct {
+	mu      sync.Mutex
+	nodes   []*corev1.Node
+	patches map[string]int
+}
+
+func (p *fakeStatusPatcher) PatchStatus(_ context.Context, name string, data []byte) (*corev1.Node, error) {
+	var patch corev1.Node
+	if err := json.Unmarshal(data, &patch); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.patches == nil {
+		p.patches = map[string]int{}
+	}
+	p.patches[name]++
+	for _, node := range p.nodes {
+		if node.Name != name {
+			continue
+		}
+		// Conditions are merged by type.
+		for _, condition := range patch.Status.Conditions {
+			found := false
+			for i := range node.Status.Conditions {
+				if node.Status.Conditions[i].Type == condition.Type {
+					node.Status.Conditions[i], found = condition, true
+				}
+			}
+			if !found {
+				node.Status.Conditions = append(node.Status.Conditions, condition)
+			}
+		}
+		return node, nil
+	}
+	return nil, apierrors.NewNotFound(corev1.Resource("nodes"), name)
+}
+
+func metricsAvailable(node *corev1.Node) corev1.NodeCondition {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == MetricsAvailableCondition {
+			return condition
+		}
+	}
+	return corev1.NodeCondition{}
+}
+
+type fakeNodeGetter struct {
+	nodes []*corev1.Node
+	gets  int
+}
+
+func (g *fakeNodeGetter) Get(_ context.Context, name string, _ metav1.GetOptions) (*corev1.Node, error) {
+	g.gets++
+	for _, node := range g.nodes {
+		if node.Name == name {
+			return node, nil
+		}
+	}
+	return nil, apierrors.NewNotFound(corev1.Resource("nodes"), name)
+}
+
 type fakeNodeLister struct {
 	nodes   []*corev1.Node
 	listErr error
 }
 
-func (l *fakeNodeLister) List(_ labels.Selector) (ret []*corev1.Node, err error) {
+func (l *fakeNodeLister) List(selector labels.Selector) (ret []*corev1.Node, err error) {
 	if l.listErr != nil {
 		return nil, l.listErr
 	}
-	// NB: this is ignores selector for the moment
-	return l.nodes, nil
+	for _, node := range l.nodes {
+		if selector.Matches(labels.Set(node.Labels)) {
+			ret = append(ret, node)
+		}
+	}
+	return ret, nil
 }
 
 func (l *fakeNodeLister) Get(name string) (*corev1.Node, error) {
@@ -281,7 +1101,7 @@ func (l *fakeNodeLister) Get(name string) (*corev1.Node, error) {
 			return node, nil
 		}
 	}
-	return nil, fmt.Errorf("no such node %q", name)
+	return nil, apierrors.NewNotFound(corev1.Resource("nodes"), name)
 }
 
 func makeNode(name, hostName, addr string, ready bool) *corev1.Node {
@@ -308,6 +1128,25 @@ func makeNode(name, hostName, addr string, ready bool) *corev1.Node {
 	return res
 }
 
+func gaugeNodeNames(registry metrics.KubeRegistry, name string) []string {
+	families, err := registry.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	var names []string
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if label.GetName() == "node" {
+					names = append(names, label.GetValue())
+				}
+			}
+		}
+	}
+	return names
+}
+
 func nodeNames(batch *storage.MetricsBatch) []string {
 	names := make([]string, 0, len(batch.Nodes))
 	for node := range batch.Nodes {
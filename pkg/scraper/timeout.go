@@ -0,0 +1,145 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics"
+)
+
+// timeoutSamples is the number of recent successful request durations per
+// node adaptive timeouts are computed from.
+const timeoutSamples = 100
+
+var requestTimeout = metrics.NewHistogram(
+	&metrics.HistogramOpts{
+		Namespace: "metrics_server",
+		Subsystem: "kubelet",
+		Name:      "request_timeout_seconds",
+		Help:      "Timeouts applied to requests to Kubelet API in seconds",
+		Buckets:   metrics.DefBuckets,
+	},
+)
+
+// adaptiveTimeout derives the scrape timeout of each node from its recent
+// request durations, so slow but working Kubelets aren't cut off while
+// unresponsive ones fail fast. The timeout of a node is the 99th percentile
+// of its last successful request durations plus margin, bounded by max.
+// Nodes without successful requests use the static timeout. After a timeout
+// the timeout of a node is doubled until a request succeeds, so Kubelets
+// getting slower recover.
+type adaptiveTimeout struct {
+	// margin is added to the 99th percentile of durations, 0 disables adaptive timeouts.
+	margin time.Duration
+	max    time.Duration
+
+	mu    sync.Mutex
+	nodes map[string]*requestDurations
+}
+
+type requestDurations struct {
+	// samples holds the last successful request durations, used as a ring buffer once full.
+	samples []time.Duration
+	next    int
+	// backoff is the timeout after consecutive timeouts, 0 if the last request didn't time out.
+	backoff time.Duration
+}
+
+func (t *adaptiveTimeout) enabled() bool {
+	return t.margin > 0
+}
+
+// timeout returns the timeout of the next scrape of node, static if it can't be derived.
+func (t *adaptiveTimeout) timeout(node string, static time.Duration) time.Duration {
+	timeout := static
+	if t.enabled() {
+		t.mu.Lock()
+		if d, found := t.nodes[node]; found {
+			timeout = d.timeout(t.margin, t.max)
+		}
+		t.mu.Unlock()
+	}
+	requestTimeout.Observe(timeout.Seconds())
+	return timeout
+}
+
+func (d *requestDurations) timeout(margin, max time.Duration) time.Duration {
+	if d.backoff > 0 {
+		return d.backoff
+	}
+	sorted := append([]time.Duration(nil), d.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	p99 := sorted[(len(sorted)*99+99)/100-1]
+	if p99+margin > max {
+		return max
+	}
+	return p99 + margin
+}
+
+// observe records the duration of a request to node sent with timeout.
+func (t *adaptiveTimeout) observe(node string, timeout, duration time.Duration, err error) {
+	if !t.enabled() {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.nodes == nil {
+		t.nodes = map[string]*requestDurations{}
+	}
+	d, found := t.nodes[node]
+	switch {
+	case err == nil:
+		if !found {
+			d = &requestDurations{}
+			t.nodes[node] = d
+		}
+		d.backoff = 0
+		if len(d.samples) < timeoutSamples {
+			d.samples = append(d.samples, duration)
+			return
+		}
+		d.samples[d.next] = duration
+		d.next = (d.next + 1) % timeoutSamples
+	case found && errors.Is(err, context.DeadlineExceeded):
+		d.backoff = 2 * timeout
+		if d.backoff > t.max {
+			d.backoff = t.max
+		}
+	}
+}
+
+// forgetRemoved drops durations of nodes no longer listed.
+func (t *adaptiveTimeout) forgetRemoved(nodes []*corev1.Node) {
+	if !t.enabled() {
+		return
+	}
+	present := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		present[node.Name] = struct{}{}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name := range t.nodes {
+		if _, found := present[name]; !found {
+			delete(t.nodes, name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scraper
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics"
+)
+
+var (
+	zoneNodes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "zone_nodes",
+			Help:      "Number of nodes selected for scraping in the last cycle per topology zone",
+		},
+		[]string{"zone"},
+	)
+	zoneScrapedNodes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "zone_scraped_nodes",
+			Help:      "Number of nodes successfully scraped in the last cycle per topology zone",
+		},
+		[]string{"zone"},
+	)
+	zoneMaxStaleness = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "zone_max_staleness_seconds",
+			Help:      "Time since the oldest last successful scrape among nodes of a topology zone. Nodes never scraped are not included",
+		},
+		[]string{"zone"},
+	)
+)
+
+// zoneTracker remembers when each node was last scraped successfully to
+// report scrape coverage and freshness per topology zone.
+type zoneTracker struct {
+	mu          sync.Mutex
+	lastSuccess map[string]time.Time
+}
+
+func (t *zoneTracker) success(nodeName string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lastSuccess == nil {
+		t.lastSuccess = map[string]time.Time{}
+	}
+	t.lastSuccess[nodeName] = at
+}
+
+// lastSuccesses returns when each node was last scraped successfully.
+func (t *zoneTracker) lastSuccesses() map[string]time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := make(map[string]time.Time, len(t.lastSuccess))
+	for name, at := range t.lastSuccess {
+		res[name] = at
+	}
+	return res
+}
+
+// report updates zone metrics for nodes of a scrape cycle started at cycleStart.
+func (t *zoneTracker) report(nodes []*corev1.Node, cycleStart time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	zoneNodes.Reset()
+	zoneScrapedNodes.Reset()
+	zoneMaxStaleness.Reset()
+	oldest := map[string]time.Time{}
+	listed := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		listed[node.Name] = struct{}{}
+		zone := node.Labels[corev1.LabelTopologyZone]
+		zoneNodes.WithLabelValues(zone).Inc()
+		// Make scraped count present even if no node in zone succeeded.
+		scraped := zoneScrapedNodes.WithLabelValues(zone)
+		last, found := t.lastSuccess[node.Name]
+		if !found {
+			continue
+		}
+		if !last.Before(cycleStart) {
+			scraped.Inc()
+		}
+		if o, found := oldest[zone]; !found || last.Before(o) {
+			oldest[zone] = last
+		}
+	}
+	for zone, last := range oldest {
+		zoneMaxStaleness.WithLabelValues(zone).Set(myClock.Since(last).Seconds())
+	}
+	// Forget nodes that are no longer scraped.
+	for nodeName := range t.lastSuccess {
+		if _, found := listed[nodeName]; !found {
+			delete(t.lastSuccess, nodeName)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// canaryContainer is the container name of the canary pod.
+const canaryContainer = "canary"
+
+var (
+	canaryChecks = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "manager",
+			Name:      "canary_checks_total",
+			Help:      "Number of cycles whose canary pod metrics were checked after being stored, by result.",
+		},
+		[]string{"result"},
+	)
+	canaryLastSuccess = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "manager",
+			Name:      "canary_last_success_timestamp_seconds",
+			Help:      "Unix time in seconds of the last cycle whose canary pod metrics were served after being stored.",
+		},
+	)
+)
+
+// canaryPod injects metrics of a synthetic pod into every scraped batch and
+// checks they are served once stored, so black-box monitoring can alert on
+// the scrape, store and serve path independently of workloads. The pod
+// doesn't exist in the API, so the metrics API never lists it, and storage
+// keeps it out of snapshots. It is not injected while a real
+// pod has its name, whose metrics it would replace.
+type canaryPod struct {
+	pod metav1.PartialObjectMetadata
+	// pods lists pods of the API, to detect a real pod named like the canary.
+	pods cache.GenericLister
+	// startTime is the start time of the canary container, fixed so its CPU usage rate can be computed.
+	startTime time.Time
+	// injected counts batches the canary was injected in.
+	injected uint64
+	// timestamp is the timestamp of the last injected point.
+	timestamp time.Time
+	// collides is true if the canary was not injected in the last batch, as a real pod has its name.
+	collides bool
+}
+
+// newCanaryPod returns a canary for the pod with key namespace/name, checked not to collide with pods.
+func newCanaryPod(key string, pods cache.GenericLister, now time.Time) (*canaryPod, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" || name == "" {
+		return nil, fmt.Errorf("canary pod %q should be in the namespace/name format", key)
+	}
+	return &canaryPod{
+		pod:       metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}},
+		pods:      pods,
+		startTime: now,
+	}, nil
+}
+
+// inject adds a point of the canary pod, timestamped at now, to batch.
+func (c *canaryPod) inject(logger klog.Logger, batch *storage.MetricsBatch, now time.Time) {
+	if c == nil || batch == nil {
+		return
+	}
+	ref := apitypes.NamespacedName{Namespace: c.pod.Namespace, Name: c.pod.Name}
+	c.collides = c.exists(batch, ref)
+	if c.collides {
+		logger.Error(nil, "Canary pod is named like a real pod, not injecting it", "pod", klog.KObj(&c.pod))
+		return
+	}
+	c.injected++
+	c.timestamp = now
+	if batch.Pods == nil {
+		batch.Pods = map[apitypes.NamespacedName]storage.PodMetricsPoint{}
+	}
+	// Use a millicore of CPU and a MiB of memory, so the canary is easy to recognize.
+	point := storage.MetricsPoint{
+		StartTime:         c.startTime,
+		Timestamp:         now,
+		CumulativeCpuUsed: uint64(now.Sub(c.startTime).Nanoseconds() / 1000),
+		MemoryUsage:       1 << 20,
+	}
+	batch.Pods[ref] = storage.PodMetricsPoint{
+		Containers: map[string]storage.MetricsPoint{canaryContainer: point},
+		Synthetic:  true,
+	}
+}
+
+// exists returns true if a real pod is named ref, either scraped in batch or listed from the API.
+func (c *canaryPod) exists(batch *storage.MetricsBatch, ref apitypes.NamespacedName) bool {
+	if pod, found := batch.Pods[ref]; found && !pod.Synthetic {
+		return true
+	}
+	if c.pods == nil {
+		return false
+	}
+	_, err := c.pods.ByNamespace(ref.Namespace).Get(ref.Name)
+	return err == nil
+}
+
+// verify checks the point injected last is served by getter. Pods are only
+// served once two points are stored, so the first injection isn't checked.
+func (c *canaryPod) verify(logger klog.Logger, getter api.PodMetricsGetter) {
+	if c == nil {
+		return
+	}
+	if c.collides {
+		canaryChecks.WithLabelValues("failure").Inc()
+		return
+	}
+	if c.injected < 2 {
+		return
+	}
+	err := c.check(getter)
+	if err != nil {
+		logger.Error(err, "Canary pod metrics were not served after being stored", "pod", klog.KObj(&c.pod))
+		canaryChecks.WithLabelValues("failure").Inc()
+		return
+	}
+	canaryChecks.WithLabelValues("success").Inc()
+	canaryLastSuccess.Set(float64(c.timestamp.UnixNano()) / float64(time.Second))
+}
+
+func (c *canaryPod) check(getter api.PodMetricsGetter) error {
+	ms, err := getter.GetPodMetrics(&c.pod)
+	if err != nil {
+		return err
+	}
+	if len(ms) != 1 || len(ms[0].Containers) != 1 {
+		return fmt.Errorf("no metrics served")
+	}
+	if !ms[0].Timestamp.Time.Equal(c.timestamp) {
+		return fmt.Errorf("served metrics of %v instead of %v", ms[0].Timestamp.Time, c.timestamp)
+	}
+	if _, found := ms[0].Containers[0].Usage[corev1.ResourceCPU]; !found {
+		return fmt.Errorf("no CPU usage served")
+	}
+	return nil
+}
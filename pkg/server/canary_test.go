@@ -0,0 +1,109 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var _ = Describe("Canary pod", func() {
+	var start time.Time
+
+	BeforeEach(func() {
+		metrics.NewKubeRegistry().MustRegister(canaryChecks, canaryLastSuccess)
+		canaryChecks.Reset()
+		start = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	})
+
+	It("should reject keys without namespace", func() {
+		_, err := newCanaryPod("canary", nil, start)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should check canary metrics are served once stored", func() {
+		s := NewServer(nil, nil, nil, storage.NewStorage(time.Minute), &scraperMock{result: &storage.MetricsBatch{}}, time.Minute)
+		var err error
+		s.canary, err = newCanaryPod("kube-system/metrics-server-canary", nil, start)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("not checking the first cycle, as pods are served from their second point")
+		s.tick(context.Background(), start.Add(time.Minute))
+		Expect(testutil.GetCounterMetricValue(canaryChecks.WithLabelValues("success"))).To(BeEquivalentTo(0))
+
+		By("reporting success once the canary is served")
+		s.tick(context.Background(), start.Add(2*time.Minute))
+		s.tick(context.Background(), start.Add(3*time.Minute))
+		Expect(testutil.GetCounterMetricValue(canaryChecks.WithLabelValues("success"))).To(BeEquivalentTo(2))
+		Expect(testutil.GetGaugeMetricValue(canaryLastSuccess)).To(BeEquivalentTo(start.Add(3 * time.Minute).Unix()))
+	})
+	It("should report failure when canary metrics are not served", func() {
+		s := NewServer(nil, nil, nil, &storageMock{}, &scraperMock{result: &storage.MetricsBatch{}}, time.Minute)
+		var err error
+		s.canary, err = newCanaryPod("kube-system/metrics-server-canary", nil, start)
+		Expect(err).NotTo(HaveOccurred())
+
+		s.tick(context.Background(), start.Add(time.Minute))
+		s.tick(context.Background(), start.Add(2*time.Minute))
+		Expect(testutil.GetCounterMetricValue(canaryChecks.WithLabelValues("failure"))).To(BeEquivalentTo(1))
+	})
+	It("should keep the canary out of snapshots", func() {
+		store := storage.NewStorage(time.Minute)
+		s := NewServer(nil, nil, nil, store, &scraperMock{result: &storage.MetricsBatch{}}, time.Minute)
+		var err error
+		s.canary, err = newCanaryPod("kube-system/metrics-server-canary", nil, start)
+		Expect(err).NotTo(HaveOccurred())
+
+		s.tick(context.Background(), start.Add(time.Minute))
+		s.tick(context.Background(), start.Add(2*time.Minute))
+		Expect(testutil.GetCounterMetricValue(canaryChecks.WithLabelValues("success"))).To(BeEquivalentTo(1))
+		Expect(store.Snapshot().PodMetrics()).To(BeEmpty())
+		Expect(store.Snapshot().Stats().Pods).To(Equal(0))
+	})
+	It("should not replace metrics of a real pod named like the canary", func() {
+		real := storage.PodMetricsPoint{Containers: map[string]storage.MetricsPoint{"app": {StartTime: start, Timestamp: start, MemoryUsage: 1}}}
+		ref := apitypes.NamespacedName{Namespace: "kube-system", Name: "metrics-server-canary"}
+		batch := &storage.MetricsBatch{Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{ref: real}}
+		canary, err := newCanaryPod(ref.String(), nil, start)
+		Expect(err).NotTo(HaveOccurred())
+
+		canary.inject(klog.Background(), batch, start)
+		Expect(batch.Pods[ref]).To(Equal(real))
+		canary.verify(klog.Background(), &storageMock{})
+		Expect(testutil.GetCounterMetricValue(canaryChecks.WithLabelValues("failure"))).To(BeEquivalentTo(1))
+	})
+	It("should not inject the canary named like a pod of the API", func() {
+		pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		Expect(pods.Add(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "metrics-server-canary"}})).To(Succeed())
+		canary, err := newCanaryPod("kube-system/metrics-server-canary", cache.NewGenericLister(pods, corev1.Resource("pods")), start)
+		Expect(err).NotTo(HaveOccurred())
+
+		batch := &storage.MetricsBatch{}
+		canary.inject(klog.Background(), batch, start)
+		Expect(batch.Pods).To(BeEmpty())
+	})
+})
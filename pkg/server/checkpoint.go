@@ -0,0 +1,110 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var (
+	checkpointWrites = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "checkpoint_writes_total",
+			Help:      "Number of storage checkpoints written, partitioned by result",
+		},
+		[]string{"result"},
+	)
+	checkpointRestored = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "checkpoint_restored",
+			Help:      "Whether storage was restored from a checkpoint on startup",
+		},
+	)
+)
+
+// checkpointer periodically writes the storage state to a local file and
+// restores it on startup, so metrics are served right after a restart
+// instead of after the first two scrapes.
+type checkpointer struct {
+	path     string
+	interval time.Duration
+	// maxAge is the age above which checkpoints are not restored, as their metrics are stale.
+	maxAge  time.Duration
+	storage storage.Storage
+	clock   clock.WithTicker
+}
+
+// restore loads the checkpoint into storage if it exists and isn't older than maxAge.
+func (c *checkpointer) restore(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	snapshot, written, err := storage.ReadCheckpointFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		logger.V(1).Info("No storage checkpoint to restore", "path", c.path)
+		return
+	}
+	if err != nil {
+		logger.Error(err, "Failed reading storage checkpoint", "path", c.path)
+		return
+	}
+	if age := c.clock.Since(written); age > c.maxAge {
+		logger.Info("Ignoring stale storage checkpoint", "path", c.path, "age", age, "maxAge", c.maxAge)
+		return
+	}
+	c.storage.Restore(snapshot)
+	checkpointRestored.Set(1)
+	logger.Info("Restored storage checkpoint", "path", c.path, "written", written)
+}
+
+// run writes checkpoints every interval until ctx is done, and then writes a last one.
+func (c *checkpointer) run(ctx context.Context) {
+	ticker := c.clock.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			c.write(ctx)
+		case <-ctx.Done():
+			c.write(ctx)
+			return
+		}
+	}
+}
+
+func (c *checkpointer) write(ctx context.Context) {
+	if !c.storage.Ready() {
+		// Don't replace a checkpoint with one metrics can't be served from.
+		return
+	}
+	if err := storage.WriteCheckpointFile(c.path, c.storage.Snapshot()); err != nil {
+		checkpointWrites.WithLabelValues("error").Inc()
+		klog.FromContext(ctx).Error(err, "Failed writing storage checkpoint", "path", c.path)
+		return
+	}
+	checkpointWrites.WithLabelValues("success").Inc()
+	klog.FromContext(ctx).V(4).Info("Wrote storage checkpoint", "path", c.path)
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var _ = Describe("Checkpointer", func() {
+	var (
+		dir   string
+		clock *testingclock.FakeClock
+	)
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "checkpoint")
+		Expect(err).NotTo(HaveOccurred())
+		clock = testingclock.NewFakeClock(time.Now())
+	})
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+	newCheckpointer := func(store storage.Storage) *checkpointer {
+		return &checkpointer{path: filepath.Join(dir, "checkpoint"), interval: time.Minute, maxAge: 5 * time.Minute, storage: store, clock: clock}
+	}
+	readyStorage := func() storage.Storage {
+		store := storage.NewStorage(time.Minute)
+		start := clock.Now()
+		for i := 1; i <= 2; i++ {
+			store.Store(&storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{
+				"node1": {StartTime: start, Timestamp: start.Add(time.Duration(i) * 10 * time.Second), CumulativeCpuUsed: uint64(i) * 1e9, MemoryUsage: 1 << 20},
+			}})
+		}
+		return store
+	}
+
+	It("restores metrics written before a restart", func() {
+		newCheckpointer(readyStorage()).write(context.Background())
+
+		restored := storage.NewStorage(time.Minute)
+		newCheckpointer(restored).restore(context.Background())
+		Expect(restored.Ready()).To(BeTrue())
+		ms, err := restored.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+	})
+	It("doesn't restore stale checkpoints", func() {
+		newCheckpointer(readyStorage()).write(context.Background())
+		info, err := os.Stat(filepath.Join(dir, "checkpoint"))
+		Expect(err).NotTo(HaveOccurred())
+		clock.SetTime(info.ModTime().Add(6 * time.Minute))
+
+		restored := storage.NewStorage(time.Minute)
+		newCheckpointer(restored).restore(context.Background())
+		Expect(restored.Ready()).To(BeFalse())
+	})
+	It("doesn't write storage that isn't ready", func() {
+		newCheckpointer(storage.NewStorage(time.Minute)).write(context.Background())
+		_, err := os.Stat(filepath.Join(dir, "checkpoint"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+	It("writes a last checkpoint when stopped", func() {
+		c := newCheckpointer(readyStorage())
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			c.run(ctx)
+			close(done)
+		}()
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(filepath.Join(dir, "checkpoint")).To(BeAnExistingFile())
+	})
+	It("starts without a checkpoint", func() {
+		store := storage.NewStorage(time.Minute)
+		newCheckpointer(store).restore(context.Background())
+		Expect(store.Ready()).To(BeFalse())
+	})
+})
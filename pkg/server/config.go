@@ -15,24 +15,47 @@ package server
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	promclient "github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	apimetrics "k8s.io/apiserver/pkg/endpoints/metrics"
 	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/certificate"
 	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/legacyregistry"
 	_ "k8s.io/component-base/metrics/prometheus/restclient" // for client-go metrics registration
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 
 	"sigs.k8s.io/metrics-server/pkg/api"
+	"sigs.k8s.io/metrics-server/pkg/export"
+	"sigs.k8s.io/metrics-server/pkg/federation"
+	"sigs.k8s.io/metrics-server/pkg/filter"
+	"sigs.k8s.io/metrics-server/pkg/replication"
 	"sigs.k8s.io/metrics-server/pkg/scraper"
 	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/cri"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/podresources"
 	"sigs.k8s.io/metrics-server/pkg/scraper/client/resource"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/supplemental"
+	"sigs.k8s.io/metrics-server/pkg/shard"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/storage/prometheus"
+	"sigs.k8s.io/metrics-server/pkg/transform"
+	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
 type Config struct {
@@ -41,24 +64,211 @@ type Config struct {
 	Kubelet          *client.KubeletClientConfig
 	MetricResolution time.Duration
 	ScrapeTimeout    time.Duration
-	NodeSelector     string
+	// ScrapeTimeoutMargin enables per node scrape timeouts of the 99th percentile of recent request durations plus margin, 0 uses ScrapeTimeout for all nodes.
+	ScrapeTimeoutMargin time.Duration
+	NodeSelector        string
+	// TopologyLabel is the node label holding the topology domain of nodes.
+	TopologyLabel string
+	// TopologyDomain restricts scrapes to nodes whose TopologyLabel has this value, "local" for the one of Kubelet.NodeName. Empty scrapes all domains.
+	TopologyDomain string
+	// SkipNotReadyNodes disables scraping nodes whose Ready condition isn't True.
+	SkipNotReadyNodes bool
+	// SkipNodeTaints lists taints, in the key[:effect] format, of nodes not to scrape.
+	SkipNodeTaints []string
+	// MinNodeScrapeInterval is the shortest scrape interval nodes can set by annotation, 0 means MetricResolution.
+	MinNodeScrapeInterval time.Duration
+	// ScrapeBudgetBytes limits the estimated total Kubelet response size of a scrape cycle, 0 means no limit.
+	ScrapeBudgetBytes int64
+	// ScrapeBudgetDuration limits the estimated wall-clock time of a scrape cycle, 0 means no limit.
+	ScrapeBudgetDuration time.Duration
+	// ScrapeSpreadPerNode is the spacing between scrapes of a cycle, 0 starts all scrapes within a few seconds.
+	ScrapeSpreadPerNode time.Duration
+	// ScrapeFailureThreshold is the number of consecutive failed scrapes after which a node is backed off, 0 disables backoff.
+	ScrapeFailureThreshold int
+	// ScrapeMaxBackoffCycles is the maximum number of cycles a failing node is skipped for.
+	ScrapeMaxBackoffCycles int
+	// NodeAddressRefreshInterval is the minimum interval between API server reads of a node whose Kubelet can't be
+	// reached, to re-resolve its addresses and retry once. 0 disables re-resolution.
+	NodeAddressRefreshInterval time.Duration
+	// EventScrapeDelay is the delay of out-of-band scrape cycles triggered by node registration or pod bursts, 0 disables them.
+	EventScrapeDelay time.Duration
+	// PodBurstThreshold is the number of pods starting on a node between cycles that triggers an out-of-band scrape, 0 disables it.
+	PodBurstThreshold int
+	// RemovedNodeGracePeriod is how long the last metrics of nodes deleted from the API are served, 0 drops them right away.
+	RemovedNodeGracePeriod time.Duration
+	// PushMaxAge is how long metrics pushed by node agents are served instead of scraping their node, 0 disables pushing.
+	PushMaxAge time.Duration
+	// PushOnly skips scraping nodes without fresh pushed metrics, for the aggregator of node agents. Requires PushMaxAge.
+	PushOnly bool
+	// PushAggregatorURL is the URL of the aggregator metrics of Kubelet.NodeName, or of every node of TopologyDomain, are pushed to after every cycle, empty disables pushing.
+	PushAggregatorURL string
+	// PushAggregatorCAFile is the CA bundle verifying the serving certificate of the aggregator, required with PushAggregatorURL.
+	PushAggregatorCAFile string
+	// FederationKubeconfig is the kubeconfig file with a context per member cluster whose metrics are merged with local ones, empty disables federation.
+	FederationKubeconfig string
+	// FederationClusterName is the name merged metrics of the local cluster are labeled with.
+	FederationClusterName string
+	// NodeMetricsLabelBuckets is the number of hash buckets node labels of per-node metrics are mapped to, 0 labels them with node names.
+	NodeMetricsLabelBuckets int
+	// NodeConditionThreshold is the number of consecutive failed scrapes setting the MetricsAvailable condition of a node to False, 0 doesn't set the condition.
+	NodeConditionThreshold int
+	// MetricHistoryLength is the number of recent scrapes kept to serve metrics history.
+	MetricHistoryLength int
+	// MetricRetainedPoints is the number of points kept per node and container, including the last two.
+	MetricRetainedPoints int
+	// CPURateWindow is the trailing window CPU usage is calculated over, 0 calculates it between the last two points.
+	// MetricRetainedPoints is raised to cover it.
+	CPURateWindow time.Duration
+	// UsageSmoothingHalfLife is the half-life of the moving average of served CPU and memory usage, 0 disables it.
+	UsageSmoothingHalfLife time.Duration
+	// CheckpointPath is the file storage is periodically written to and restored from on startup, empty disables checkpoints.
+	CheckpointPath string
+	// CheckpointInterval is the interval between checkpoints.
+	CheckpointInterval time.Duration
+	// CheckpointMaxAge is the age above which checkpoints are not restored.
+	CheckpointMaxAge time.Duration
+	// EvictionTTL is the age of stored points swept from storage, 0 keeps points of any age.
+	EvictionTTL time.Duration
+	// RemoteWriteURL is the Prometheus remote write endpoint usage is sent to after every cycle, empty disables it.
+	RemoteWriteURL string
+	// RemoteWriteTimeout is the timeout of remote write requests.
+	RemoteWriteTimeout time.Duration
+	// RemoteWriteBearerTokenFile is the path of a bearer token sent with remote write requests, empty sends none.
+	RemoteWriteBearerTokenFile string
+	// RemoteWriteExternalLabels are added to all series sent to the remote write endpoint.
+	RemoteWriteExternalLabels map[string]string
+	// OTLPEndpoint is the host:port of an OTLP/gRPC receiver usage is sent to after every cycle, empty disables it.
+	OTLPEndpoint string
+	// OTLPInsecure disables TLS of the OTLP connection.
+	OTLPInsecure bool
+	// OTLPTimeout is the timeout of OTLP export requests.
+	OTLPTimeout time.Duration
+	// OTLPHeaders are sent as gRPC metadata with OTLP export requests.
+	OTLPHeaders map[string]string
+	// OTLPResourceAttributes are added to the resource of metrics sent over OTLP.
+	OTLPResourceAttributes map[string]string
+	// OTLPSelfMetrics enables sending metrics-server's own metrics over OTLP.
+	OTLPSelfMetrics bool
+	// PrometheusURL is the Prometheus HTTP API usage is queried from instead of scraping Kubelets, empty scrapes Kubelets.
+	PrometheusURL string
+	// PrometheusTimeout is the timeout of Prometheus queries.
+	PrometheusTimeout time.Duration
+	// PrometheusBearerTokenFile is the path of a bearer token sent with Prometheus queries, empty sends none.
+	PrometheusBearerTokenFile string
+	// PrometheusCAFile is the CA bundle verifying the serving certificate of an https PrometheusURL, empty uses the system roots.
+	PrometheusCAFile string
+	// PrometheusWindow is the range of CPU rate queries.
+	PrometheusWindow time.Duration
+	// PrometheusQueries override the default Prometheus queries by name.
+	PrometheusQueries map[string]string
+	// ResourceNames maps names of resources read from metrics sources to served names.
+	ResourceNames map[string]string
+	// AnnotateContainerTypes enables watching full pods to annotate init and ephemeral containers.
+	AnnotateContainerTypes bool
+	// AnnotateContainerStatuses enables watching full pods to annotate container start time and restart count.
+	AnnotateContainerStatuses bool
+	// AnnotateMissingContainers enables watching full pods to annotate containers of the pod spec without metrics.
+	AnnotateMissingContainers bool
+	// FilterConfigMap is the namespace/name of a ConfigMap of rules excluding nodes and pods from scrapes and served metrics, empty disables filtering.
+	FilterConfigMap string
+	// IncludeNamespaces lists the only namespaces whose pods are stored and served, all namespaces if empty.
+	IncludeNamespaces []string
+	// ExcludeNamespaces lists namespaces whose pods are neither stored nor served.
+	ExcludeNamespaces []string
+	// CanaryPod is the namespace/name of a synthetic pod whose metrics are injected and checked to be served every cycle, empty disables it.
+	CanaryPod string
+	// TransformConfigFile is the path of CEL expressions transforming metrics before they are stored, empty disables transformation.
+	TransformConfigFile string
+	// SupplementalSourcesConfig is the path of Prometheus endpoints scraped on every node in addition to Kubelet, empty disables them.
+	SupplementalSourcesConfig string
+	// DuplicateDetectionNamespace is the namespace of Leases used to detect other instances scraping the same nodes, empty disables detection.
+	DuplicateDetectionNamespace string
+	// LeaderElectionNamespace is the namespace of the Lease only the holder of which scrapes, empty disables leader election.
+	LeaderElectionNamespace string
+	// LeaderElectionLeaseName is the name of the leader election Lease.
+	LeaderElectionLeaseName string
+	// ReplicationPort is the port the leader serves storage to standbys on, 0 disables replication.
+	ReplicationPort int
+	// ReplicationAdvertiseAddress is the host standbys reach this instance at for replication.
+	ReplicationAdvertiseAddress string
+	// ReplicationTLS are the certificates replicas authenticate each other with.
+	ReplicationTLS replication.TLSFiles
+	// ShardCount is the number of shards nodes are split between, 0 or 1 disables sharding.
+	ShardCount int
+	// ShardOrdinal is the shard of this instance, negative reads it from the StatefulSet pod name.
+	ShardOrdinal int
+	// ShardPeerURL is the URL of other shards, with $ordinal replaced by their ordinal.
+	ShardPeerURL string
+	// ShardPeerCAFile is the CA bundle verifying serving certificates of other shards.
+	ShardPeerCAFile string
+	// ProfilingCaptureMaxDuration is the longest capture served by the profiling capture endpoints, 0 disables them.
+	ProfilingCaptureMaxDuration time.Duration
+	// ReadinessNodeCoverage is the percentage of nodes whose metrics must be fresh for readiness, 0 requires any stored metrics.
+	ReadinessNodeCoverage float64
+	// ReadinessMaxMetricAge is the age above which node metrics don't count towards ReadinessNodeCoverage, 0 means twice MetricResolution.
+	ReadinessMaxMetricAge time.Duration
+	// DebugListenAddress is the loopback host:port pprof, expvar and storage statistics are served on, empty disables them.
+	DebugListenAddress string
+	// MetricsListenAddress is the host:port self-metrics are served on over plain HTTP in addition to the secure port, empty disables it.
+	MetricsListenAddress string
+	// ShutdownGracePeriod is how long stopping waits for the in-flight scrape cycle to complete before aborting it.
+	ShutdownGracePeriod time.Duration
+	// ConfigFile is the path of the config file options were read from, checked for changes of Settings, empty disables reloading.
+	ConfigFile string
+	// LoadSettings returns the Settings of config file content and the options it changes that require a restart.
+	LoadSettings func(config []byte) (Settings, []string, error)
+
+	// Client overrides the Kubernetes client constructed from Rest.
+	Client kubernetes.Interface
+	// MetadataClient overrides the metadata client constructed from Rest.
+	MetadataClient metadata.Interface
+	// KubeletClient overrides the Kubelet client constructed from Kubelet.
+	KubeletClient client.KubeletMetricsGetter
+	// Clock overrides the clock used to schedule and time scrapes.
+	Clock clock.WithTicker
 }
 
 func (c Config) Complete() (*server, error) {
+	// Components not running with a context, e.g. informer event handlers, log with named loggers derived from it.
+	logger := klog.Background()
 	var labelRequirement []labels.Requirement
 
-	podInformerFactory, err := runningPodMetadataInformer(c.Rest)
+	podInformerFactory, err := runningPodMetadataInformer(c.Rest, c.MetadataClient)
 	if err != nil {
 		return nil, err
 	}
 	podInformer := podInformerFactory.ForResource(corev1.SchemeGroupVersion.WithResource("pods"))
-	informer, err := informerFactory(c.Rest)
+	kubeClient, err := kubeClient(c.Rest, c.Client)
 	if err != nil {
 		return nil, err
 	}
-	kubeletClient, err := resource.NewForConfig(c.Kubelet)
+	var informer informers.SharedInformerFactory
+	if c.Kubelet.MetricsSource == client.MetricsSourceCRI || c.Kubelet.LocalEndpoint != "" {
+		// Only the local node can be read from the container runtime or local Kubelet endpoint.
+		informer, err = localNodeInformerFactory(c.Rest, kubeClient, c.Kubelet.NodeName)
+	} else {
+		informer, err = informerFactory(c.Rest, kubeClient)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("unable to construct a client to connect to the kubelets: %v", err)
+		return nil, err
+	}
+	kubeletClient := c.KubeletClient
+	var kubeletCert certificate.Manager
+	if kubeletClient == nil {
+		// Settings of this server are set on a copy, c.Kubelet may be shared.
+		kubeletConfig := *c.Kubelet
+		kubeletConfig.NodeLabelBuckets = uint32(c.NodeMetricsLabelBuckets)
+		if kubeletConfig.ClientCertificateRotation {
+			kubeletCert, err = newKubeletCertManager(klog.LoggerWithName(logger, "kubelet-cert"), kubeClient, kubeletConfig.ClientCertificateDir)
+			if err != nil {
+				return nil, err
+			}
+			kubeletConfig.GetClientCertificate = kubeletCert.Current
+		}
+		kubeletClient, err = newKubeletClient(klog.LoggerWithName(logger, "kubelet"), &kubeletConfig)
+		if err != nil {
+			return nil, err
+		}
 	}
 	nodes := informer.Core().V1().Nodes()
 	ns := strings.TrimSpace(c.NodeSelector)
@@ -68,11 +278,119 @@ func (c Config) Complete() (*server, error) {
 			return nil, err
 		}
 	}
+	if c.TopologyDomain != "" {
+		requirement, err := topologyRequirement(logger, kubeClient, c.TopologyLabel, c.TopologyDomain, c.Kubelet.NodeName)
+		if err != nil {
+			return nil, err
+		}
+		labelRequirement = append(labelRequirement, *requirement)
+	}
+	var transformer *transform.Transformer
+	if c.TransformConfigFile != "" {
+		transformer, err = transform.LoadFile(c.TransformConfigFile)
+		if err != nil {
+			return nil, err
+		}
+	}
 	scrape := scraper.NewScraper(nodes.Lister(), kubeletClient, c.ScrapeTimeout, labelRequirement)
+	if c.NodeAddressRefreshInterval > 0 {
+		scrape.SetNodeGetter(kubeClient.CoreV1().Nodes(), c.NodeAddressRefreshInterval)
+	}
+	tickInterval := c.MetricResolution
+	if c.MinNodeScrapeInterval > 0 && c.MinNodeScrapeInterval < tickInterval {
+		tickInterval = c.MinNodeScrapeInterval
+	}
+	scrape.SetScrapeIntervals(tickInterval, c.MetricResolution)
+	scrape.SetRemovedNodeGracePeriod(c.RemovedNodeGracePeriod)
+	var (
+		podSpecs      cache.SharedIndexInformer
+		podSpecLister v1listers.PodLister
+		podNodes      v1listers.PodLister
+	)
+	podBursts := c.EventScrapeDelay > 0 && c.PodBurstThreshold > 0
+	// Shards read the node of pods to request their metrics from the shard
+	// owning it, the push receiver to only accept pods of the pushed node.
+	if c.AnnotateContainerTypes || c.AnnotateContainerStatuses || c.AnnotateMissingContainers || podBursts || c.ShardCount > 1 || c.PushMaxAge > 0 {
+		podSpecFactory, err := runningPodInformerFactory(c.Rest, kubeClient)
+		if err != nil {
+			return nil, err
+		}
+		pods := podSpecFactory.Core().V1().Pods()
+		podSpecs = pods.Informer()
+		if err := podSpecs.SetTransform(trimPod); err != nil {
+			return nil, err
+		}
+		if c.AnnotateContainerTypes || c.AnnotateContainerStatuses || c.AnnotateMissingContainers {
+			podSpecLister = pods.Lister()
+		}
+		podNodes = pods.Lister()
+	}
+	var push *pushReceiver
+	if c.PushMaxAge > 0 {
+		var pushClock clock.PassiveClock = clock.RealClock{}
+		if c.Clock != nil {
+			pushClock = c.Clock
+		}
+		push = newPushReceiver(klog.LoggerWithName(logger, "push"), nodes.Lister(), podNodes, c.PushMaxAge, pushClock)
+		push.nodeLabels = utils.NodeLabels(c.NodeMetricsLabelBuckets)
+		scrape.SetPushSource(push, c.PushOnly)
+	}
+	// Pods opted out of metrics collection are always dropped.
+	// Namespaces are set with the other settings, as they can be reloaded.
+	namespaces := &filter.DynamicNamespaces{}
+	filters := filter.All{filter.NewOptOut(podInformer.Lister()), namespaces}
+	var filterConfig *filterConfigMap
+	if c.FilterConfigMap != "" {
+		filterConfig, err = newFilterConfigMap(klog.LoggerWithName(logger, "filter"), kubeClient, c.FilterConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, &filterConfig.rules)
+	}
+	var nodeShard *shard.Shard
+	if c.ShardCount > 1 {
+		nodeShard, err = c.shard()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, *nodeShard)
+	}
+	scrape.SetFilter(filters)
+	scrape.SetNodeLabelBuckets(uint32(c.NodeMetricsLabelBuckets))
+	if c.NodeConditionThreshold > 0 {
+		scrape.SetNodeConditions(kubeClient.CoreV1().Nodes(), c.NodeConditionThreshold)
+	}
+	if c.SupplementalSourcesConfig != "" {
+		sources, err := supplemental.LoadFile(c.SupplementalSourcesConfig)
+		if err != nil {
+			return nil, err
+		}
+		resolver, err := utils.NewNodeAddressResolver(c.Kubelet.AddressResolver, c.Kubelet.AddressTypePriority)
+		if err != nil {
+			return nil, err
+		}
+		resolver = utils.WithAddressFamily(resolver, utils.AddressFamily(c.Kubelet.AddressFamily))
+		scrape.SetNodeMetricsSupplier(supplemental.New(sources, resolver, c.ScrapeTimeout))
+	}
+	if c.Kubelet.PodResourcesEndpoint != "" {
+		devices, err := podresources.NewForConfig(c.Kubelet)
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct a client to read pod resources: %v", err)
+		}
+		scrape.SetPodDevicesSupplier(devices)
+	}
 
+	// Pass the resource query parameter to the metrics API, which has no access to the request.
+	buildHandlerChain := c.Apiserver.BuildHandlerChainFunc
+	if buildHandlerChain == nil {
+		buildHandlerChain = genericapiserver.DefaultBuildHandlerChain
+	}
+	c.Apiserver.BuildHandlerChainFunc = func(handler http.Handler, config *genericapiserver.Config) http.Handler {
+		return buildHandlerChain(api.WithResourceFilter(api.WithSortBy(handler)), config)
+	}
 	// Disable default metrics handler and create custom one
 	c.Apiserver.EnableMetrics = false
-	metricsHandler, err := c.metricsHandler()
+	metricsHandler, gatherers, err := c.metricsHandler()
 	if err != nil {
 		return nil, err
 	}
@@ -81,20 +399,208 @@ func (c Config) Complete() (*server, error) {
 		return nil, err
 	}
 	genericServer.Handler.NonGoRestfulMux.HandleFunc("/metrics", metricsHandler)
+	if c.ProfilingCaptureMaxDuration > 0 {
+		newProfileCapture(c.ProfilingCaptureMaxDuration).install(genericServer.Handler.NonGoRestfulMux)
+	}
+	if push != nil {
+		push.install(genericServer.Handler.NonGoRestfulMux)
+	}
 
 	store := storage.NewStorage(c.MetricResolution)
-	if err := api.Install(store, podInformer.Lister(), nodes.Lister(), genericServer, labelRequirement); err != nil {
+	store.SetLogger(klog.LoggerWithName(logger, "storage"))
+	store.SetFilter(filters)
+	applier := &settingsApplier{
+		storage:       store,
+		scraper:       scrape,
+		namespaces:    namespaces,
+		resolution:    c.MetricResolution,
+		tickInterval:  tickInterval,
+		scrapeTimeout: c.ScrapeTimeout,
+	}
+	applyScraper, err := applier.apply(c.settings())
+	if err != nil {
 		return nil, err
 	}
-
+	applyScraper()
+	if _, err := podInformer.Informer().AddEventHandler(podEvictionHandler(klog.LoggerWithName(logger, "eviction"), store)); err != nil {
+		return nil, err
+	}
+	// Nodes removed during a grace period are still served, their points expire with the scraper's cache.
+	if c.RemovedNodeGracePeriod == 0 {
+		if _, err := nodes.Informer().AddEventHandler(nodeEvictionHandler(klog.LoggerWithName(logger, "eviction"), store)); err != nil {
+			return nil, err
+		}
+	}
+	var served storage.Storage = store
+	if c.PrometheusURL != "" {
+		served, err = prometheus.NewStorage(prometheus.Config{
+			URL:             c.PrometheusURL,
+			Timeout:         c.PrometheusTimeout,
+			BearerTokenFile: c.PrometheusBearerTokenFile,
+			CAFile:          c.PrometheusCAFile,
+			Window:          c.PrometheusWindow,
+			CacheTTL:        c.MetricResolution,
+			Queries:         c.PrometheusQueries,
+			Filter:          filters,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var getter shard.Local = served
+	if nodeShard != nil {
+		peerClient, err := peerClient(c.Rest, c.ShardPeerCAFile)
+		if err != nil {
+			return nil, err
+		}
+		getter = shard.NewFanOut(*nodeShard, served, podNodes, c.ShardPeerURL, peerClient)
+		genericServer.Handler.NonGoRestfulMux.Handle(shard.PeerPath, shard.NewPeerHandler(served))
+	}
+	podAnnotations := api.PodAnnotations{
+		ContainerTypes:    c.AnnotateContainerTypes,
+		ContainerStatuses: c.AnnotateContainerStatuses,
+		MissingContainers: c.AnnotateMissingContainers,
+	}
 	s := NewServer(
 		nodes.Informer(),
 		podInformer.Informer(),
 		genericServer,
-		store,
+		served,
 		scrape,
 		c.MetricResolution,
 	)
+	s.tickInterval = tickInterval
+	s.tracer = c.Apiserver.TracerProvider.Tracer(tracerName)
+	s.shutdownGracePeriod = c.ShutdownGracePeriod
+	s.readThrough = c.PrometheusURL != ""
+	if c.Clock != nil {
+		s.clock = c.Clock
+	}
+	maxMetricAge := c.ReadinessMaxMetricAge
+	if maxMetricAge == 0 {
+		maxMetricAge = 2 * c.MetricResolution
+	}
+	s.coverage = &nodeCoverage{nodes: nodes.Lister(), filter: filters, storage: served, clock: s.clock, threshold: c.ReadinessNodeCoverage, maxAge: maxMetricAge}
+	s.connectivity = scrape
+	s.kubeletCert = kubeletCert
+	if c.DebugListenAddress != "" {
+		s.debug = &debugServer{address: c.DebugListenAddress, storage: served}
+	}
+	if c.MetricsListenAddress != "" {
+		s.selfMetrics = &selfMetricsServer{address: c.MetricsListenAddress, metrics: metricsHandler}
+	}
+	if podSpecs != nil {
+		s.podSpecs = podSpecs
+	}
+	if filterConfig != nil {
+		s.filterConfig = filterConfig.informer
+	}
+	if c.CanaryPod != "" {
+		s.canary, err = newCanaryPod(c.CanaryPod, podInformer.Lister(), s.clock.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.EventScrapeDelay > 0 {
+		s.trigger = newScrapeTrigger(klog.LoggerWithName(logger, "trigger"), c.EventScrapeDelay, c.PodBurstThreshold, scrape.ForceScrape)
+		if _, err := nodes.Informer().AddEventHandler(s.trigger.nodeHandler()); err != nil {
+			return nil, err
+		}
+		if podBursts {
+			if _, err := podSpecs.AddEventHandler(s.trigger.podHandler()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var nodeLister v1listers.NodeLister = nodes.Lister()
+	if c.RemovedNodeGracePeriod > 0 {
+		nodeLister = removedNodeLister{NodeLister: nodeLister, removed: scrape.RemovedNodes}
+	}
+	apiMetrics, err := api.Install(getter, podInformer.Lister(), nodeLister, podSpecLister, podAnnotations, s.podsSynced, genericServer, labelRequirement)
+	if err != nil {
+		return nil, err
+	}
+	s.transform = transformer
+	genericServer.Handler.NonGoRestfulMux.HandleFunc(statuszPath, s.statusz)
+	// Usage read through from Prometheus isn't kept, so there is nothing to expose.
+	if !s.readThrough {
+		genericServer.Handler.NonGoRestfulMux.HandleFunc(resourceMetricsPath, s.resourceMetrics)
+	}
+	genericServer.Handler.NonGoRestfulMux.HandleFunc(storageDumpPath, s.storageDump)
+	if c.CheckpointPath != "" {
+		s.checkpoint = &checkpointer{path: c.CheckpointPath, interval: c.CheckpointInterval, maxAge: c.CheckpointMaxAge, storage: served, clock: s.clock}
+	}
+	if c.RemoteWriteURL != "" {
+		s.exporters = append(s.exporters, export.NewRemoteWrite(export.RemoteWriteConfig{
+			URL:             c.RemoteWriteURL,
+			Timeout:         c.RemoteWriteTimeout,
+			BearerTokenFile: c.RemoteWriteBearerTokenFile,
+			ExternalLabels:  c.RemoteWriteExternalLabels,
+		}))
+	}
+	if c.OTLPEndpoint != "" {
+		otlpConfig := export.OTLPConfig{
+			Endpoint:           c.OTLPEndpoint,
+			Insecure:           c.OTLPInsecure,
+			Timeout:            c.OTLPTimeout,
+			Headers:            c.OTLPHeaders,
+			ResourceAttributes: c.OTLPResourceAttributes,
+		}
+		if c.OTLPSelfMetrics {
+			otlpConfig.Gatherers = gatherers
+		}
+		exporter, err := export.NewOTLP(otlpConfig)
+		if err != nil {
+			return nil, err
+		}
+		s.exporters = append(s.exporters, exporter)
+	}
+	if c.PushAggregatorURL != "" {
+		node := c.Kubelet.NodeName
+		if c.Kubelet.MetricsSource != client.MetricsSourceCRI && c.Kubelet.LocalEndpoint == "" {
+			// Zone replicas push every node of their topology domain.
+			node = ""
+		}
+		s.pushAgent, err = newPushAgent(c.PushAggregatorURL, c.PushAggregatorCAFile, node, bearerToken(c.Rest), c.MetricResolution)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.FederationKubeconfig != "" {
+		members, err := federation.LoadMembers(c.FederationKubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		s.federation, err = federation.New(c.FederationClusterName, localMetrics(klog.LoggerWithName(logger, "federation"), apiMetrics), members, c.MetricResolution)
+		if err != nil {
+			return nil, err
+		}
+		genericServer.Handler.NonGoRestfulMux.HandleFunc(federationNodesPath, s.federationNodes)
+		genericServer.Handler.NonGoRestfulMux.HandleFunc(federationPodsPath, s.federationPods)
+	}
+	if c.DuplicateDetectionNamespace != "" {
+		s.duplicates = newDuplicateDetector(kubeClient.CoordinationV1().Leases(c.DuplicateDetectionNamespace), nodes.Lister(), ns, s.clock)
+	}
+	if c.LeaderElectionNamespace != "" {
+		var address string
+		if c.ReplicationPort > 0 {
+			address = net.JoinHostPort(c.ReplicationAdvertiseAddress, strconv.Itoa(c.ReplicationPort))
+		}
+		s.election = newLeaderElection(kubeClient.CoordinationV1(), c.LeaderElectionNamespace, c.LeaderElectionLeaseName, address)
+		if c.ReplicationPort > 0 {
+			s.replication, err = newReplicator(c.ReplicationPort, served, c.ReplicationTLS)
+			if err != nil {
+				return nil, err
+			}
+			s.election.observe = s.replication.follower.Follow
+		}
+	}
+	if c.ConfigFile != "" && c.LoadSettings != nil {
+		s.reloader, err = newConfigReloader(c.ConfigFile, c.LoadSettings, applier, s.clock)
+		if err != nil {
+			return nil, err
+		}
+	}
 	err = s.RegisterProbes(podInformerFactory)
 	if err != nil {
 		return nil, err
@@ -102,19 +608,72 @@ func (c Config) Complete() (*server, error) {
 	return s, nil
 }
 
-func (c Config) metricsHandler() (http.HandlerFunc, error) {
+func newKubeletClient(logger klog.Logger, config *client.KubeletClientConfig) (client.KubeletMetricsGetter, error) {
+	if config.MetricsSource == client.MetricsSourceCRI {
+		kubeletClient, err := cri.NewForConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct a client to connect to the container runtime: %v", err)
+		}
+		return kubeletClient, nil
+	}
+	kubeletClient, err := resource.NewForConfig(logger, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct a client to connect to the kubelets: %v", err)
+	}
+	return kubeletClient, nil
+}
+
+// shard returns the shard of this instance.
+func (c Config) shard() (*shard.Shard, error) {
+	ordinal := c.ShardOrdinal
+	if ordinal < 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		if ordinal, err = shard.ParseOrdinal(hostname); err != nil {
+			return nil, fmt.Errorf("unable to read shard ordinal from hostname: %v", err)
+		}
+	}
+	if ordinal >= c.ShardCount {
+		return nil, fmt.Errorf("shard ordinal %d should be below the shard count %d", ordinal, c.ShardCount)
+	}
+	return &shard.Shard{Ordinal: ordinal, Count: c.ShardCount}, nil
+}
+
+// peerClient returns a client authenticating to other shards with the
+// credentials of config. Serving certificates of shards are verified with
+// caFile, so the token is only sent to other shards.
+func peerClient(config *rest.Config, caFile string) (*http.Client, error) {
+	if caFile == "" {
+		return nil, fmt.Errorf("a CA bundle verifying other shards is required to send them credentials")
+	}
+	transport, err := rest.TransportFor(&rest.Config{
+		BearerToken:     config.BearerToken,
+		BearerTokenFile: config.BearerTokenFile,
+		TLSClientConfig: rest.TLSClientConfig{CAFile: caFile},
+		UserAgent:       "metrics-server",
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// metricsHandler returns the handler serving metrics and the gatherers of the metrics it serves.
+func (c Config) metricsHandler() (http.HandlerFunc, []metrics.Gatherer, error) {
 	// Create registry for Metrics Server metrics
 	registry := metrics.NewKubeRegistry()
 	err := RegisterMetrics(registry, c.MetricResolution)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	// Register apiserver metrics in legacy registry
 	apimetrics.Register()
 
-	// Return handler that serves metrics from both legacy and Metrics Server registry
-	return func(w http.ResponseWriter, req *http.Request) {
-		legacyregistry.Handler().ServeHTTP(w, req)
-		metrics.HandlerFor(registry, metrics.HandlerOpts{}).ServeHTTP(w, req)
-	}, nil
+	// Return handler that serves metrics from both legacy and Metrics Server
+	// registry. OpenMetrics is negotiated to expose exemplars linking
+	// histograms to traces.
+	handler := metrics.HandlerFor(promclient.Gatherers{legacyregistry.DefaultGatherer, registry}, metrics.HandlerOpts{EnableOpenMetrics: true})
+	return handler.ServeHTTP, []metrics.Gatherer{legacyregistry.DefaultGatherer, registry}, nil
 }
@@ -0,0 +1,93 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var nodeCoverageRatio = metrics.NewGauge(
+	&metrics.GaugeOpts{
+		Namespace: "metrics_server",
+		Subsystem: "storage",
+		Name:      "node_coverage_ratio",
+		Help:      "Fraction of nodes whose served metrics were fresh on the last readiness check.",
+	},
+)
+
+// nodeCoverage checks the fraction of nodes with fresh metrics. With a
+// threshold, readiness depends on it instead of on any metrics being stored,
+// so a few dead nodes in large clusters neither block readiness nor make it
+// flap.
+type nodeCoverage struct {
+	nodes   v1listers.NodeLister
+	filter  storage.Filter
+	storage storage.Storage
+	clock   clock.PassiveClock
+	// threshold is the percentage of nodes whose metrics must be fresh, 0 requires any.
+	threshold float64
+	// maxAge is the age above which metrics of a node are not fresh.
+	maxAge time.Duration
+}
+
+// check returns an error if metrics of no node or of less than threshold
+// percent of the nodes kept by filter are fresh. Without nodes, any stored
+// metrics suffice.
+func (c *nodeCoverage) check() error {
+	nodes, err := c.nodes.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("unable to list nodes: %w", err)
+	}
+	kept := nodes[:0:0]
+	for _, node := range nodes {
+		if c.filter == nil || c.filter.KeepNode(node) {
+			kept = append(kept, node)
+		}
+	}
+	if len(kept) == 0 {
+		if !c.storage.Ready() {
+			return fmt.Errorf("no metrics to serve")
+		}
+		return nil
+	}
+	ms, err := c.storage.GetNodeMetrics(kept...)
+	if err != nil {
+		return fmt.Errorf("unable to get node metrics: %w", err)
+	}
+	now := c.clock.Now()
+	fresh := 0
+	for _, m := range ms {
+		if now.Sub(m.Timestamp.Time) <= c.maxAge {
+			fresh++
+		}
+	}
+	ratio := float64(fresh) / float64(len(kept))
+	nodeCoverageRatio.Set(ratio)
+	if fresh == 0 {
+		return fmt.Errorf("metrics of none of %d nodes are fresher than %v", len(kept), c.maxAge)
+	}
+	if ratio*100 < c.threshold {
+		return fmt.Errorf("metrics of %d out of %d nodes are fresher than %v, below the readiness threshold of %v%%", fresh, len(kept), c.maxAge, c.threshold)
+	}
+	return nil
+}
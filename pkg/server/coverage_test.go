@@ -0,0 +1,114 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/metrics/pkg/apis/metrics"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+var _ = Describe("Node coverage", func() {
+	var (
+		clock    *testingclock.FakeClock
+		indexer  cache.Indexer
+		store    *coverageStorageMock
+		coverage *nodeCoverage
+	)
+
+	BeforeEach(func() {
+		clock = testingclock.NewFakeClock(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC))
+		indexer = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, name := range []string{"node1", "node2", "node3", "node4"} {
+			Expect(indexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})).To(Succeed())
+		}
+		store = &coverageStorageMock{timestamps: map[string]time.Time{}}
+		coverage = &nodeCoverage{nodes: v1listers.NewNodeLister(indexer), storage: store, clock: clock, threshold: 75, maxAge: 2 * time.Minute}
+	})
+
+	It("should pass once metrics of threshold percent of nodes are fresh", func() {
+		store.timestamps["node1"] = clock.Now()
+		store.timestamps["node2"] = clock.Now()
+		Expect(coverage.check()).NotTo(Succeed())
+
+		store.timestamps["node3"] = clock.Now().Add(-time.Minute)
+		Expect(coverage.check()).To(Succeed())
+	})
+	It("should require fresh metrics of any node without threshold", func() {
+		coverage.threshold = 0
+		Expect(coverage.check()).NotTo(Succeed())
+
+		store.timestamps["node1"] = clock.Now()
+		Expect(coverage.check()).To(Succeed())
+	})
+	It("should not count stale metrics", func() {
+		for _, name := range []string{"node1", "node2", "node3"} {
+			store.timestamps[name] = clock.Now()
+		}
+		Expect(coverage.check()).To(Succeed())
+
+		clock.Step(3 * time.Minute)
+		Expect(coverage.check()).NotTo(Succeed())
+	})
+	It("should only count nodes kept by the filter", func() {
+		store.timestamps["node1"] = clock.Now()
+		coverage.filter = &nodeFilterMock{nodes: map[string]bool{"node1": true}}
+		Expect(coverage.check()).To(Succeed())
+	})
+	It("should require stored metrics without nodes", func() {
+		Expect(indexer.Replace(nil, "")).To(Succeed())
+		Expect(coverage.check()).NotTo(Succeed())
+
+		store.ready = true
+		Expect(coverage.check()).To(Succeed())
+	})
+})
+
+// coverageStorageMock serves node metrics with the given timestamps.
+type coverageStorageMock struct {
+	storageMock
+	timestamps map[string]time.Time
+}
+
+func (s *coverageStorageMock) GetNodeMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
+	var ms []metrics.NodeMetrics
+	for _, node := range nodes {
+		if timestamp, found := s.timestamps[node.Name]; found {
+			ms = append(ms, metrics.NodeMetrics{ObjectMeta: metav1.ObjectMeta{Name: node.Name}, Timestamp: metav1.NewTime(timestamp)})
+		}
+	}
+	return ms, nil
+}
+
+// nodeFilterMock keeps the given nodes and all pods.
+type nodeFilterMock struct {
+	nodes map[string]bool
+}
+
+func (f *nodeFilterMock) KeepNode(node *corev1.Node) bool {
+	return f.nodes[node.Name]
+}
+
+func (f *nodeFilterMock) KeepPod(namespace, name string) bool {
+	return true
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+const storageStatsPath = "/debug/storage-stats"
+
+// debugServer serves pprof, expvar and storage statistics without
+// authentication on a separate, loopback, address, so memory growth in
+// production can be profiled without rebuilding the image.
+type debugServer struct {
+	address string
+	storage storage.Storage
+}
+
+func (d *debugServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc(storageStatsPath, d.storageStats)
+	return mux
+}
+
+func (d *debugServer) storageStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(d.storage.Snapshot().Stats()); err != nil {
+		klog.FromContext(r.Context()).Error(err, "Failed writing storage statistics")
+	}
+}
+
+// run serves debug endpoints until ctx is cancelled.
+func (d *debugServer) run(ctx context.Context) {
+	serveInsecure(ctx, "debug endpoints", d.address, d.handler())
+}
+
+// serveInsecure serves handler over plain HTTP without authentication on
+// address until ctx is cancelled.
+func serveInsecure(ctx context.Context, name, address string, handler http.Handler) {
+	server := &http.Server{Addr: address, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	logger := klog.FromContext(ctx)
+	logger.Info("Serving over plain HTTP", "server", name, "address", address)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error(err, "Failed to serve over plain HTTP", "server", name, "address", address)
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server wires the scraper, storage and metrics.k8s.io API together.
+//
+// Binaries embedding metrics-server should only depend on Config, New and the
+// MetricsServer interface. Clients and clocks can be injected through Config
+// to replace the ones metrics-server builds from Rest and Kubelet configs.
+package server
+
+import (
+	"context"
+)
+
+// MetricsServer is a running instance of metrics-server.
+type MetricsServer interface {
+	// Start starts informers, the scrape loop and API serving in the background.
+	// Serving stops when ctx is cancelled or Stop is called. A server runs at
+	// most once: Start is a no-op while running and fails once stopped.
+	Start(ctx context.Context) error
+	// Stop stops the server and waits for it to finish, returning the error it
+	// stopped with. It can be called any number of times, also before Start.
+	Stop() error
+	// RunUntil runs the server in the foreground until stopCh is closed or Stop
+	// is called. It fails if the server was already started or stopped.
+	RunUntil(stopCh <-chan struct{}) error
+}
+
+var _ MetricsServer = (*server)(nil)
+
+// New creates a MetricsServer from the given config.
+func New(c Config) (MetricsServer, error) {
+	return c.Complete()
+}
@@ -0,0 +1,250 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"os"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+const (
+	// instanceLeaseLabel marks Leases used as heartbeats of metrics-server instances.
+	instanceLeaseLabel = "metrics.k8s.io/instance-heartbeat"
+	// instanceNodeSelectorAnnotation holds the node selector of the instance holding the Lease.
+	instanceNodeSelectorAnnotation = "metrics.k8s.io/node-selector"
+
+	instanceHeartbeatInterval = 30 * time.Second
+	instanceLeaseDuration     = 3 * instanceHeartbeatInterval
+	// Leases not renewed for this long are deleted by any instance, as their holders didn't clean up.
+	instanceLeaseGarbageCollectionAge = time.Hour
+)
+
+var duplicateInstances = metrics.NewGauge(
+	&metrics.GaugeOpts{
+		Namespace: "metrics_server",
+		Subsystem: "manager",
+		Name:      "duplicate_instances",
+		Help:      "Number of other metrics-server instances found scraping at least one of the nodes scraped by this instance",
+	},
+)
+
+// duplicateDetector heartbeats a Lease per metrics-server instance and finds
+// other instances scraping the same nodes, which doubles load on Kubelets,
+// e.g. when an old deployment is left over after an upgrade. Instances are
+// considered to scrape the same nodes if a node known to this instance
+// matches node selectors of both.
+type duplicateDetector struct {
+	leases       coordinationv1client.LeaseInterface
+	nodes        v1listers.NodeLister
+	nodeSelector string
+	clock        clock.WithTicker
+
+	name     string
+	identity string
+	// reported holds identities of duplicates already logged, to log each one once.
+	reported map[string]struct{}
+}
+
+func newDuplicateDetector(leases coordinationv1client.LeaseInterface, nodes v1listers.NodeLister, nodeSelector string, clock clock.WithTicker) *duplicateDetector {
+	identity, err := os.Hostname()
+	if err != nil || identity == "" {
+		identity = string(uuid.NewUUID())
+	}
+	name := "metrics-server-" + identity
+	if len(validation.IsDNS1123Subdomain(name)) != 0 {
+		name = "metrics-server-" + string(uuid.NewUUID())
+	}
+	return &duplicateDetector{
+		leases:       leases,
+		nodes:        nodes,
+		nodeSelector: nodeSelector,
+		clock:        clock,
+		name:         name,
+		identity:     identity,
+		reported:     map[string]struct{}{},
+	}
+}
+
+// run heartbeats until ctx is done, and then deletes the Lease of this instance.
+func (d *duplicateDetector) run(ctx context.Context) {
+	ticker := d.clock.NewTicker(instanceHeartbeatInterval)
+	defer ticker.Stop()
+	d.heartbeat(ctx)
+	for {
+		select {
+		case <-ticker.C():
+			d.heartbeat(ctx)
+		case <-ctx.Done():
+			d.release(klog.FromContext(ctx))
+			return
+		}
+	}
+}
+
+func (d *duplicateDetector) heartbeat(ctx context.Context) {
+	if err := d.renew(ctx); err != nil {
+		klog.FromContext(ctx).Error(err, "Failed renewing instance heartbeat lease", "lease", d.name)
+		return
+	}
+	duplicates, err := d.findDuplicates(ctx)
+	if err != nil {
+		klog.FromContext(ctx).Error(err, "Failed finding other metrics-server instances")
+		return
+	}
+	duplicateInstances.Set(float64(duplicates))
+}
+
+func (d *duplicateDetector) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(d.clock.Now())
+	lease, err := d.leases.Get(ctx, d.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = d.leases.Create(ctx, d.newLease(now), metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != d.identity {
+		lease.Spec.AcquireTime = &now
+	}
+	desired := d.newLease(now)
+	lease.Labels = labels.Merge(lease.Labels, desired.Labels)
+	lease.Annotations = labels.Merge(lease.Annotations, desired.Annotations)
+	lease.Spec.HolderIdentity = desired.Spec.HolderIdentity
+	lease.Spec.LeaseDurationSeconds = desired.Spec.LeaseDurationSeconds
+	lease.Spec.RenewTime = &now
+	_, err = d.leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+func (d *duplicateDetector) newLease(now metav1.MicroTime) *coordinationv1.Lease {
+	duration := int32(instanceLeaseDuration / time.Second)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        d.name,
+			Labels:      map[string]string{instanceLeaseLabel: "true"},
+			Annotations: map[string]string{instanceNodeSelectorAnnotation: d.nodeSelector},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &d.identity,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+}
+
+// findDuplicates returns the number of other live instances scraping nodes
+// scraped by this instance. Instances started less than a lease duration
+// ago are ignored, so rolling updates are not reported.
+func (d *duplicateDetector) findDuplicates(ctx context.Context) (int, error) {
+	logger := klog.FromContext(ctx)
+	leases, err := d.leases.List(ctx, metav1.ListOptions{LabelSelector: instanceLeaseLabel + "=true"})
+	if err != nil {
+		return 0, err
+	}
+	selector, err := labels.Parse(d.nodeSelector)
+	if err != nil {
+		return 0, err
+	}
+	nodes, err := d.nodes.List(selector)
+	if err != nil {
+		return 0, err
+	}
+	now := d.clock.Now()
+	duplicates := 0
+	found := make(map[string]struct{}, len(leases.Items))
+	for i := range leases.Items {
+		lease := &leases.Items[i]
+		if lease.Name == d.name || lease.Spec.HolderIdentity == nil || lease.Spec.RenewTime == nil {
+			continue
+		}
+		expiry := lease.Spec.RenewTime.Add(instanceLeaseDuration)
+		if lease.Spec.LeaseDurationSeconds != nil {
+			expiry = lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		}
+		if now.After(expiry) {
+			if now.Sub(expiry) > instanceLeaseGarbageCollectionAge {
+				d.deleteExpired(ctx, lease)
+			}
+			continue
+		}
+		if lease.Spec.AcquireTime != nil && now.Sub(lease.Spec.AcquireTime.Time) < instanceLeaseDuration {
+			continue
+		}
+		other, err := labels.Parse(lease.Annotations[instanceNodeSelectorAnnotation])
+		if err != nil {
+			logger.V(2).Info("Ignoring instance heartbeat lease with invalid node selector", "lease", klog.KObj(lease), "err", err)
+			continue
+		}
+		overlapping := 0
+		for _, node := range nodes {
+			if other.Matches(labels.Set(node.Labels)) {
+				overlapping++
+			}
+		}
+		if overlapping == 0 {
+			continue
+		}
+		duplicates++
+		identity := *lease.Spec.HolderIdentity
+		found[identity] = struct{}{}
+		if _, logged := d.reported[identity]; !logged {
+			d.reported[identity] = struct{}{}
+			logger.Info("Found another metrics-server instance scraping the same nodes, Kubelets are scraped more than once per cycle", "instance", identity, "lease", klog.KObj(lease), "nodeSelector", lease.Annotations[instanceNodeSelectorAnnotation], "overlappingNodes", overlapping)
+		}
+	}
+	for identity := range d.reported {
+		if _, still := found[identity]; !still {
+			delete(d.reported, identity)
+			logger.Info("Another metrics-server instance no longer scrapes the same nodes", "instance", identity)
+		}
+	}
+	return duplicates, nil
+}
+
+func (d *duplicateDetector) deleteExpired(ctx context.Context, lease *coordinationv1.Lease) {
+	err := d.leases.Delete(ctx, lease.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+		klog.FromContext(ctx).Error(err, "Failed deleting expired instance heartbeat lease", "lease", klog.KObj(lease))
+	}
+}
+
+// release deletes the Lease of this instance, so it is not mistaken for a
+// live one by instances started during a rolling update.
+func (d *duplicateDetector) release(logger klog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), instanceHeartbeatInterval)
+	defer cancel()
+	err := d.leases.Delete(ctx, d.name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "Failed deleting instance heartbeat lease", "lease", d.name)
+	}
+	duplicateInstances.Set(0)
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+var _ = Describe("Duplicate instance detection", func() {
+	var (
+		ctx      context.Context
+		now      time.Time
+		client   *fake.Clientset
+		detector *duplicateDetector
+	)
+
+	otherLease := func(name, nodeSelector string, acquired, renewed time.Time) *coordinationv1.Lease {
+		identity := name + "-pod"
+		duration := int32(instanceLeaseDuration / time.Second)
+		acquireTime, renewTime := metav1.NewMicroTime(acquired), metav1.NewMicroTime(renewed)
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "kube-system",
+				Labels:      map[string]string{instanceLeaseLabel: "true"},
+				Annotations: map[string]string{instanceNodeSelectorAnnotation: nodeSelector},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &acquireTime,
+				RenewTime:            &renewTime,
+			},
+		}
+	}
+	leaseNames := func() []string {
+		leases, err := client.CoordinationV1().Leases("kube-system").List(ctx, metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		names := []string{}
+		for _, lease := range leases.Items {
+			names = append(names, lease.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		now = time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+		client = fake.NewSimpleClientset()
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for name, zone := range map[string]string{"node1": "a", "node2": "b"} {
+			Expect(indexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"zone": zone}}})).To(Succeed())
+		}
+		detector = newDuplicateDetector(client.CoordinationV1().Leases("kube-system"), v1listers.NewNodeLister(indexer), "zone=a", testingclock.NewFakeClock(now))
+	})
+
+	It("should create and renew own lease", func() {
+		detector.heartbeat(ctx)
+		lease, err := client.CoordinationV1().Leases("kube-system").Get(ctx, detector.name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lease.Annotations[instanceNodeSelectorAnnotation]).To(Equal("zone=a"))
+		Expect(lease.Spec.RenewTime.Time).To(BeTemporally("==", now))
+
+		detector.clock.(*testingclock.FakeClock).Step(instanceHeartbeatInterval)
+		detector.heartbeat(ctx)
+		lease, err = client.CoordinationV1().Leases("kube-system").Get(ctx, detector.name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lease.Spec.AcquireTime.Time).To(BeTemporally("==", now))
+		Expect(lease.Spec.RenewTime.Time).To(BeTemporally("==", now.Add(instanceHeartbeatInterval)))
+	})
+	It("should find live instances scraping the same nodes", func() {
+		for _, lease := range []*coordinationv1.Lease{
+			otherLease("all-nodes", "", now.Add(-time.Hour), now),
+			otherLease("same-zone", "zone=a", now.Add(-time.Hour), now),
+			otherLease("other-zone", "zone=b", now.Add(-time.Hour), now),
+		} {
+			_, err := client.CoordinationV1().Leases("kube-system").Create(ctx, lease, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(detector.renew(ctx)).To(Succeed())
+		Expect(detector.findDuplicates(ctx)).To(Equal(2))
+		Expect(detector.reported).To(HaveLen(2))
+	})
+	It("should ignore instances started recently or expired", func() {
+		for _, lease := range []*coordinationv1.Lease{
+			otherLease("rolling-update", "", now.Add(-time.Second), now),
+			otherLease("expired", "", now.Add(-time.Hour), now.Add(-2*instanceLeaseDuration)),
+		} {
+			_, err := client.CoordinationV1().Leases("kube-system").Create(ctx, lease, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(detector.findDuplicates(ctx)).To(Equal(0))
+		Expect(leaseNames()).To(ConsistOf("rolling-update", "expired"))
+	})
+	It("should delete leases expired long ago", func() {
+		lease := otherLease("abandoned", "", now.Add(-3*time.Hour), now.Add(-2*instanceLeaseGarbageCollectionAge))
+		_, err := client.CoordinationV1().Leases("kube-system").Create(ctx, lease, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(detector.findDuplicates(ctx)).To(Equal(0))
+		Expect(leaseNames()).To(BeEmpty())
+	})
+	It("should delete own lease when stopped", func() {
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			detector.run(ctx)
+			close(done)
+		}()
+		Eventually(leaseNames).Should(ConsistOf(detector.name))
+		cancel()
+		Eventually(done).Should(BeClosed())
+		_, err := client.CoordinationV1().Leases("kube-system").Get(context.Background(), detector.name, metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,77 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// evictor drops stored points of nodes and pods deleted from the API.
+type evictor interface {
+	EvictNode(name string)
+	EvictPod(namespace, name string)
+	ClearNodeEviction(name string)
+	ClearPodEviction(namespace, name string)
+}
+
+// nodeEvictionHandler evicts points of deleted nodes until a node registers again under the same name.
+func nodeEvictionHandler(logger klog.Logger, e evictor) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if _, name, ok := objectRef(logger, obj); ok {
+				e.ClearNodeEviction(name)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if _, name, ok := objectRef(logger, obj); ok {
+				logger.V(4).Info("Evicting metrics of deleted node", "node", klog.KRef("", name))
+				e.EvictNode(name)
+			}
+		},
+	}
+}
+
+// podEvictionHandler evicts points of deleted pods until a pod is added again under the same name.
+func podEvictionHandler(logger klog.Logger, e evictor) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if namespace, name, ok := objectRef(logger, obj); ok {
+				e.ClearPodEviction(namespace, name)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if namespace, name, ok := objectRef(logger, obj); ok {
+				logger.V(4).Info("Evicting metrics of deleted pod", "pod", klog.KRef(namespace, name))
+				e.EvictPod(namespace, name)
+			}
+		},
+	}
+}
+
+// objectRef returns the namespace and name of an informer object, including tombstones of objects whose deletion was missed.
+func objectRef(logger klog.Logger, obj interface{}) (namespace, name string, ok bool) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		logger.Error(err, "Unexpected object in informer event")
+		return "", "", false
+	}
+	namespace, name, err = cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		logger.Error(err, "Unexpected object key in informer event", "key", key)
+		return "", "", false
+	}
+	return namespace, name, true
+}
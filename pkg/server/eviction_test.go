@@ -0,0 +1,62 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+type fakeEvictor struct {
+	evicted map[string]bool
+}
+
+func (f *fakeEvictor) EvictNode(name string)                   { f.evicted[name] = true }
+func (f *fakeEvictor) EvictPod(namespace, name string)         { f.evicted[namespace+"/"+name] = true }
+func (f *fakeEvictor) ClearNodeEviction(name string)           { delete(f.evicted, name) }
+func (f *fakeEvictor) ClearPodEviction(namespace, name string) { delete(f.evicted, namespace+"/"+name) }
+
+var _ = Describe("Eviction handlers", func() {
+	var e *fakeEvictor
+	BeforeEach(func() {
+		e = &fakeEvictor{evicted: map[string]bool{}}
+	})
+
+	It("should evict deleted nodes until they register again", func() {
+		handler := nodeEvictionHandler(klog.Background(), e)
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+		handler.OnDelete(node)
+		handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "node2", Obj: &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}}})
+		Expect(e.evicted).To(Equal(map[string]bool{"node1": true, "node2": true}))
+
+		handler.OnAdd(node, false)
+		Expect(e.evicted).To(Equal(map[string]bool{"node2": true}))
+	})
+	It("should evict deleted pods until they are added again", func() {
+		handler := podEvictionHandler(klog.Background(), e)
+		pod := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}
+		handler.OnDelete(pod)
+		handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "ns1/pod2", Obj: &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod2"}}})
+		Expect(e.evicted).To(Equal(map[string]bool{"ns1/pod1": true, "ns1/pod2": true}))
+
+		handler.OnAdd(pod, false)
+		Expect(e.evicted).To(Equal(map[string]bool{"ns1/pod2": true}))
+	})
+})
@@ -0,0 +1,77 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server_test
+
+import (
+	"context"
+	"net"
+	"time"
+
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	genericoptions "k8s.io/apiserver/pkg/server/options"
+	"k8s.io/client-go/pkg/version"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client"
+	"sigs.k8s.io/metrics-server/pkg/server"
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+func ExampleNew() {
+	restConfig, err := rest.InClusterConfig()
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	secureServing := genericoptions.NewSecureServingOptions().WithLoopback()
+	secureServing.BindPort = 4443
+	if err := secureServing.MaybeDefaultWithSelfSignedCerts("localhost", nil, []net.IP{net.ParseIP("127.0.0.1")}); err != nil {
+		klog.Fatal(err)
+	}
+	apiserverConfig := genericapiserver.NewConfig(api.Codecs)
+	if err := secureServing.ApplyTo(&apiserverConfig.SecureServing, &apiserverConfig.LoopbackClientConfig); err != nil {
+		klog.Fatal(err)
+	}
+	versionGet := version.Get()
+	apiserverConfig.Version = &versionGet
+
+	ms, err := server.New(server.Config{
+		Apiserver: apiserverConfig,
+		Rest:      restConfig,
+		Kubelet: &client.KubeletClientConfig{
+			Client:              *rest.CopyConfig(restConfig),
+			AddressTypePriority: utils.DefaultAddressTypePriority,
+			Scheme:              "https",
+			DefaultPort:         10250,
+		},
+		MetricResolution: 15 * time.Second,
+		ScrapeTimeout:    10 * time.Second,
+		Clock:            clock.RealClock{},
+	})
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := ms.Start(context.Background()); err != nil {
+		klog.Fatal(err)
+	}
+	// The embedding binary does its own work here.
+	if err := ms.Stop(); err != nil {
+		klog.Fatal(err)
+	}
+}
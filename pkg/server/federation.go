@@ -0,0 +1,108 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/klog/v2"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
+	"sigs.k8s.io/metrics-server/pkg/federation"
+)
+
+// Paths serving NodeMetricsList and PodMetricsList merged from the local
+// cluster and federation members. The cluster query parameter restricts
+// items to a cluster, the namespace one restricts pods to a namespace.
+// Requests are authenticated and authorized like other non-resource requests.
+const (
+	federationNodesPath = "/federation/v1beta1/nodes"
+	federationPodsPath  = "/federation/v1beta1/pods"
+)
+
+// localMetrics returns a federation.LocalSource serving metrics as the
+// metrics API lists them, so federation applies the same filters.
+func localMetrics(logger klog.Logger, served *api.Served) federation.LocalSource {
+	return func() ([]v1beta1.NodeMetrics, []v1beta1.PodMetrics) {
+		ctx := klog.NewContext(context.Background(), logger)
+		internalNodes, err := served.Nodes(ctx)
+		if err != nil {
+			logger.Error(err, "Failed listing local node metrics")
+		}
+		internalPods, err := served.Pods(ctx)
+		if err != nil {
+			logger.Error(err, "Failed listing local pod metrics")
+		}
+		nodes := make([]v1beta1.NodeMetrics, len(internalNodes))
+		for i := range internalNodes {
+			if err := v1beta1.Convert_metrics_NodeMetrics_To_v1beta1_NodeMetrics(&internalNodes[i], &nodes[i], nil); err != nil {
+				logger.Error(err, "Failed converting node metrics", "node", klog.KRef("", internalNodes[i].Name))
+			}
+		}
+		pods := make([]v1beta1.PodMetrics, len(internalPods))
+		for i := range internalPods {
+			if err := v1beta1.Convert_metrics_PodMetrics_To_v1beta1_PodMetrics(&internalPods[i], &pods[i], nil); err != nil {
+				logger.Error(err, "Failed converting pod metrics", "pod", klog.KRef(internalPods[i].Namespace, internalPods[i].Name))
+			}
+		}
+		return nodes, pods
+	}
+}
+
+func (s *server) federationNodes(w http.ResponseWriter, req *http.Request) {
+	if !federationGet(w, req) {
+		return
+	}
+	list := &v1beta1.NodeMetricsList{Items: s.federation.Nodes(req.URL.Query().Get("cluster"))}
+	list.APIVersion, list.Kind = v1beta1.SchemeGroupVersion.String(), "NodeMetricsList"
+	writeFederation(w, req, list)
+}
+
+func (s *server) federationPods(w http.ResponseWriter, req *http.Request) {
+	if !federationGet(w, req) {
+		return
+	}
+	query := req.URL.Query()
+	list := &v1beta1.PodMetricsList{Items: s.federation.Pods(query.Get("cluster"), query.Get("namespace"))}
+	list.APIVersion, list.Kind = v1beta1.SchemeGroupVersion.String(), "PodMetricsList"
+	writeFederation(w, req, list)
+}
+
+func federationGet(w http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeFederation(w http.ResponseWriter, req *http.Request, list interface{}) {
+	logger := klog.FromContext(req.Context())
+	body, err := json.Marshal(list)
+	if err != nil {
+		logger.Error(err, "Failed encoding federated metrics")
+		http.Error(w, "failed encoding federated metrics", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(body); err != nil {
+		logger.V(2).Info("Failed writing federated metrics", "err", err)
+	}
+}
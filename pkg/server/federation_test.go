@@ -0,0 +1,117 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
+	"sigs.k8s.io/metrics-server/pkg/federation"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var _ = Describe("Federation", func() {
+	var s *server
+
+	BeforeEach(func() {
+		store := storage.NewStorage(time.Minute)
+		start := time.Now().Add(-time.Hour)
+		for i := 1; i <= 2; i++ {
+			timestamp := start.Add(time.Duration(i) * time.Minute)
+			point := storage.MetricsPoint{StartTime: start, Timestamp: timestamp, CumulativeCpuUsed: uint64(i) * 1e9, MemoryUsage: 1000}
+			store.Store(&storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{"node1": point},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "ns1", Name: "pod1"}: {Containers: map[string]storage.MetricsPoint{"app": point}},
+					{Namespace: "ns2", Name: "pod2"}: {Containers: map[string]storage.MetricsPoint{"app": point}},
+					// Stored but not served, e.g. excluded by a filter.
+					{Namespace: "ns3", Name: "pod3"}: {Containers: map[string]storage.MetricsPoint{"app": point}},
+				},
+			})
+		}
+		nodes := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		Expect(nodes.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})).To(Succeed())
+		pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		for _, pod := range []apitypes.NamespacedName{{Namespace: "ns1", Name: "pod1"}, {Namespace: "ns2", Name: "pod2"}} {
+			Expect(pods.Add(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}})).To(Succeed())
+		}
+		served := api.NewServed(store, cache.NewGenericLister(pods, corev1.Resource("pods")), v1listers.NewNodeLister(nodes), nil, api.PodAnnotations{}, nil, nil)
+		s = NewServer(nil, nil, nil, store, &scraperMock{}, time.Minute)
+		var err error
+		s.federation, err = federation.New("eu-west", localMetrics(klog.Background(), served), nil, time.Minute)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should serve local node metrics labeled with the cluster", func() {
+		rec := httptest.NewRecorder()
+		s.federationNodes(rec, httptest.NewRequest(http.MethodGet, federationNodesPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		got := v1beta1.NodeMetricsList{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+		Expect(got.Kind).To(Equal("NodeMetricsList"))
+		Expect(got.Items).To(HaveLen(1))
+		Expect(got.Items[0].Name).To(Equal("node1"))
+		Expect(got.Items[0].Labels).To(HaveKeyWithValue(federation.ClusterLabel, "eu-west"))
+		Expect(got.Items[0].Usage.Cpu().MilliValue()).To(BeEquivalentTo(17))
+	})
+	It("should serve pod metrics of a namespace", func() {
+		rec := httptest.NewRecorder()
+		s.federationPods(rec, httptest.NewRequest(http.MethodGet, federationPodsPath+"?namespace=ns2", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		got := v1beta1.PodMetricsList{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+		Expect(got.Items).To(HaveLen(1))
+		Expect(got.Items[0].Namespace).To(Equal("ns2"))
+		Expect(got.Items[0].Containers).To(HaveLen(1))
+	})
+	It("should only serve pod metrics served by the metrics API", func() {
+		rec := httptest.NewRecorder()
+		s.federationPods(rec, httptest.NewRequest(http.MethodGet, federationPodsPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		got := v1beta1.PodMetricsList{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+		Expect(got.Items).To(HaveLen(2))
+		for _, item := range got.Items {
+			Expect(item.Namespace).NotTo(Equal("ns3"))
+		}
+	})
+	It("should not serve metrics of unknown clusters", func() {
+		rec := httptest.NewRecorder()
+		s.federationNodes(rec, httptest.NewRequest(http.MethodGet, federationNodesPath+"?cluster=us-east", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		got := v1beta1.NodeMetricsList{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+		Expect(got.Items).To(BeEmpty())
+	})
+	It("should reject other methods", func() {
+		rec := httptest.NewRecorder()
+		s.federationPods(rec, httptest.NewRequest(http.MethodPost, federationPodsPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
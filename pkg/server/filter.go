@@ -0,0 +1,114 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/filter"
+)
+
+// filterConfigKey is the key of the ConfigMap data holding filter rules.
+const filterConfigKey = "filters.yaml"
+
+var filterConfigUpdates = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "manager",
+		Name:      "filter_config_updates_total",
+		Help:      "Number of changes of the filter ConfigMap, by result. Invalid changes are ignored and previous rules kept applied.",
+	},
+	[]string{"result"},
+)
+
+// filterConfigMap applies filter rules read from a ConfigMap to the scraper
+// and the storage as soon as the ConfigMap changes. Without the ConfigMap
+// nothing is filtered.
+type filterConfigMap struct {
+	namespace, name string
+	rules           filter.Dynamic
+	informer        cache.SharedIndexInformer
+	logger          klog.Logger
+}
+
+// newFilterConfigMap watches the ConfigMap with key namespace/name.
+func newFilterConfigMap(logger klog.Logger, client kubernetes.Interface, key string) (*filterConfigMap, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" || name == "" {
+		return nil, fmt.Errorf("filter ConfigMap %q should be in the namespace/name format", key)
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, defaultResync, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+	}))
+	f := &filterConfigMap{
+		namespace: namespace,
+		name:      name,
+		informer:  factory.Core().V1().ConfigMaps().Informer(),
+		logger:    logger,
+	}
+	_, err = f.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    f.update,
+		UpdateFunc: func(_, obj interface{}) { f.update(obj) },
+		DeleteFunc: func(obj interface{}) {
+			if !f.watched(obj) {
+				return
+			}
+			f.logger.Info("Filter ConfigMap deleted, no longer filtering", "configMap", klog.KRef(f.namespace, f.name))
+			f.rules.Set(nil)
+			filterConfigUpdates.WithLabelValues("success").Inc()
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *filterConfigMap) update(obj interface{}) {
+	if !f.watched(obj) {
+		return
+	}
+	cm := obj.(*corev1.ConfigMap)
+	rules, err := filter.Parse([]byte(cm.Data[filterConfigKey]))
+	if err != nil {
+		f.logger.Error(err, "Ignoring invalid filter ConfigMap, previous rules are kept", "configMap", klog.KObj(cm), "key", filterConfigKey)
+		filterConfigUpdates.WithLabelValues("failure").Inc()
+		return
+	}
+	f.logger.Info("Applying filter ConfigMap", "configMap", klog.KObj(cm), "resourceVersion", cm.ResourceVersion)
+	f.rules.Set(rules)
+	filterConfigUpdates.WithLabelValues("success").Inc()
+}
+
+// watched returns true if obj is the filter ConfigMap or its tombstone.
+func (f *filterConfigMap) watched(obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	cm, ok := obj.(*corev1.ConfigMap)
+	return ok && cm.Namespace == f.namespace && cm.Name == f.name
+}
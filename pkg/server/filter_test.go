@@ -0,0 +1,73 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Filter ConfigMap", func() {
+	It("should reject keys without namespace", func() {
+		_, err := newFilterConfigMap(klog.Background(), fake.NewSimpleClientset(), "filters")
+		Expect(err).To(HaveOccurred())
+	})
+	It("should apply changes of the ConfigMap", func() {
+		client := fake.NewSimpleClientset()
+		configMaps := client.CoreV1().ConfigMaps("kube-system")
+		f, err := newFilterConfigMap(klog.Background(), client, "kube-system/metrics-server-filters")
+		Expect(err).NotTo(HaveOccurred())
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go f.informer.Run(stopCh)
+
+		keepBatch := func() bool { return f.rules.KeepPod("batch", "report") }
+		Expect(keepBatch()).To(BeTrue())
+
+		By("excluding namespaces once the ConfigMap is created")
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "metrics-server-filters"},
+			Data:       map[string]string{filterConfigKey: "excludeNamespaces: [batch]"},
+		}
+		_, err = configMaps.Create(context.Background(), cm, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(keepBatch).Should(BeFalse())
+
+		By("ignoring ConfigMaps with other names")
+		other := cm.DeepCopy()
+		other.Name = "other"
+		other.Data[filterConfigKey] = "excludeNamespaces: [web]"
+		_, err = configMaps.Create(context.Background(), other, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Consistently(func() bool { return f.rules.KeepPod("web", "frontend") }).Should(BeTrue())
+
+		By("keeping previous rules on invalid changes")
+		cm.Data[filterConfigKey] = "excludeNamespace: [web]"
+		_, err = configMaps.Update(context.Background(), cm, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Consistently(keepBatch).Should(BeFalse())
+
+		By("filtering nothing once the ConfigMap is deleted")
+		Expect(configMaps.Delete(context.Background(), cm.Name, metav1.DeleteOptions{})).To(Succeed())
+		Eventually(keepBatch).Should(BeTrue())
+	})
+})
@@ -19,6 +19,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/metadata"
@@ -33,20 +34,104 @@ const (
 	defaultResync = 0
 )
 
-func informerFactory(rest *rest.Config) (informers.SharedInformerFactory, error) {
+// kubeClient returns client, or a new client for rest if nil.
+func kubeClient(rest *rest.Config, client kubernetes.Interface) (kubernetes.Interface, error) {
+	if client != nil {
+		return client, nil
+	}
 	client, err := kubernetes.NewForConfig(rest)
 	if err != nil {
 		return nil, fmt.Errorf("unable to construct lister client: %v", err)
 	}
+	return client, nil
+}
+
+func informerFactory(rest *rest.Config, client kubernetes.Interface) (informers.SharedInformerFactory, error) {
+	client, err := kubeClient(rest, client)
+	if err != nil {
+		return nil, err
+	}
 	return informers.NewSharedInformerFactory(client, defaultResync), nil
 }
 
-func runningPodMetadataInformer(rest *rest.Config) (metadatainformer.SharedInformerFactory, error) {
-	client, err := metadata.NewForConfig(rest)
+// localNodeInformerFactory returns a factory of informers watching only the node with the given name.
+func localNodeInformerFactory(rest *rest.Config, client kubernetes.Interface, nodeName string) (informers.SharedInformerFactory, error) {
+	client, err := kubeClient(rest, client)
 	if err != nil {
-		return nil, fmt.Errorf("unable to construct lister client: %v", err)
+		return nil, err
+	}
+	return informers.NewSharedInformerFactoryWithOptions(client, defaultResync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.FieldSelector = fields.OneTermEqualSelector("metadata.name", nodeName).String()
+	})), nil
+}
+
+func runningPodMetadataInformer(rest *rest.Config, client metadata.Interface) (metadatainformer.SharedInformerFactory, error) {
+	if client == nil {
+		var err error
+		client, err = metadata.NewForConfig(rest)
+		if err != nil {
+			return nil, fmt.Errorf("unable to construct lister client: %v", err)
+		}
 	}
 	return metadatainformer.NewFilteredSharedInformerFactory(client, defaultResync, corev1.NamespaceAll, func(options *metav1.ListOptions) {
 		options.FieldSelector = "status.phase=Running"
 	}), nil
 }
+
+func runningPodInformerFactory(rest *rest.Config, client kubernetes.Interface) (informers.SharedInformerFactory, error) {
+	client, err := kubeClient(rest, client)
+	if err != nil {
+		return nil, err
+	}
+	return informers.NewSharedInformerFactoryWithOptions(client, defaultResync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.FieldSelector = "status.phase=Running"
+	})), nil
+}
+
+// trimPod drops fields of a pod not used by metrics-server to keep the
+// memory footprint of the full pod informer close to the metadata one.
+func trimPod(obj interface{}) (interface{}, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return obj, nil
+	}
+	trimmed := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+		Spec: corev1.PodSpec{NodeName: pod.Spec.NodeName},
+	}
+	for _, c := range pod.Spec.Containers {
+		trimmed.Spec.Containers = append(trimmed.Spec.Containers, corev1.Container{Name: c.Name})
+	}
+	for _, c := range pod.Spec.InitContainers {
+		trimmed.Spec.InitContainers = append(trimmed.Spec.InitContainers, corev1.Container{Name: c.Name})
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		trimmed.Spec.EphemeralContainers = append(trimmed.Spec.EphemeralContainers, corev1.EphemeralContainer{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: c.Name},
+		})
+	}
+	trimmed.Status.InitContainerStatuses = trimContainerStatuses(pod.Status.InitContainerStatuses)
+	trimmed.Status.ContainerStatuses = trimContainerStatuses(pod.Status.ContainerStatuses)
+	trimmed.Status.EphemeralContainerStatuses = trimContainerStatuses(pod.Status.EphemeralContainerStatuses)
+	return trimmed, nil
+}
+
+func trimContainerStatuses(statuses []corev1.ContainerStatus) []corev1.ContainerStatus {
+	if len(statuses) == 0 {
+		return nil
+	}
+	trimmed := make([]corev1.ContainerStatus, 0, len(statuses))
+	for _, s := range statuses {
+		status := corev1.ContainerStatus{Name: s.Name, RestartCount: s.RestartCount}
+		if s.State.Running != nil {
+			status.State.Running = &corev1.ContainerStateRunning{StartedAt: s.State.Running.StartedAt}
+		}
+		trimmed = append(trimmed, status)
+	}
+	return trimmed
+}
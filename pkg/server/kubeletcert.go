@@ -0,0 +1,119 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"sync"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/certificate"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+)
+
+// kubeletClientCommonName is the common name of client certificates
+// requested for Kubelets, the user Kubelets authorize requests of.
+const kubeletClientCommonName = "metrics-server"
+
+var (
+	kubeletCertRotations = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "client_certificate_rotation_seconds",
+			Help:      "Duration Kubelet client certificates requested from the certificates API were used for before being rotated.",
+			Buckets:   []float64{600, 3600, 14400, 86400, 604800, 2592000, 7776000, 31536000},
+		},
+	)
+	kubeletCertRenewFailures = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "kubelet",
+			Name:      "client_certificate_renew_failures_total",
+			Help:      "Number of failed requests of a Kubelet client certificate from the certificates API.",
+		},
+	)
+)
+
+// newKubeletCertManager returns a manager requesting the client certificate
+// presented to Kubelets from the certificates API with the
+// kubernetes.io/kube-apiserver-client signer, and rotating it before it
+// expires. CertificateSigningRequests must be approved, e.g. by an approver
+// controller. Certificates are stored in dir, so restarts reuse them, or in
+// memory if dir is empty.
+func newKubeletCertManager(logger klog.Logger, client kubernetes.Interface, dir string) (certificate.Manager, error) {
+	var store certificate.Store = &memoryCertStore{}
+	if dir != "" {
+		var err error
+		store, err = certificate.NewFileStore("kubelet-client", dir, dir, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize Kubelet client certificate store: %v", err)
+		}
+	}
+	return certificate.NewManager(&certificate.Config{
+		ClientsetFn: func(*tls.Certificate) (kubernetes.Interface, error) {
+			return client, nil
+		},
+		Template: &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: kubeletClientCommonName},
+		},
+		SignerName:              certificatesv1.KubeAPIServerClientSignerName,
+		CertificateStore:        store,
+		CertificateRotation:     kubeletCertRotations,
+		CertificateRenewFailure: kubeletCertRenewFailures,
+		Name:                    "kubelet-client",
+		Logf: func(format string, args ...interface{}) {
+			logger.V(2).Info("Kubelet client certificate manager", "message", fmt.Sprintf(format, args...))
+		},
+	})
+}
+
+// memoryCertStore keeps the certificate in memory, a new one is requested after restarts.
+type memoryCertStore struct {
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+var _ certificate.Store = (*memoryCertStore)(nil)
+
+func (s *memoryCertStore) Current() (*tls.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cert == nil {
+		noCert := certificate.NoCertKeyError("no Kubelet client certificate requested yet")
+		return nil, &noCert
+	}
+	return s.cert, nil
+}
+
+func (s *memoryCertStore) Update(certData, keyData []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certData, keyData)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cert = &cert
+	return &cert, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/certificate"
+)
+
+var _ = Describe("Kubelet client certificate memory store", func() {
+	It("should ask for a new certificate until one is stored", func() {
+		store := &memoryCertStore{}
+		_, err := store.Current()
+		var noCert *certificate.NoCertKeyError
+		Expect(err).To(BeAssignableToTypeOf(noCert))
+
+		certPEM, keyPEM, err := cert.GenerateSelfSignedCertKey("metrics-server", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		updated, err := store.Update(certPEM, keyPEM)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Leaf).NotTo(BeNil())
+		current, err := store.Current()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(current).To(Equal(updated))
+	})
+	It("should reject an invalid key pair", func() {
+		store := &memoryCertStore{}
+		_, err := store.Update([]byte("invalid"), []byte("invalid"))
+		Expect(err).To(HaveOccurred())
+		_, err = store.Current()
+		Expect(err).To(HaveOccurred())
+	})
+})
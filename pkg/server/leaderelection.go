@@ -0,0 +1,152 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	leaderLeaseDuration = 15 * time.Second
+	leaderRenewDeadline = 10 * time.Second
+	leaderRetryPeriod   = 2 * time.Second
+)
+
+var electedLeader = metrics.NewGauge(
+	&metrics.GaugeOpts{
+		Namespace: "metrics_server",
+		Subsystem: "leader_election",
+		Name:      "is_leader",
+		Help:      "1 if this instance holds the leader election Lease and scrapes Kubelets, 0 otherwise",
+	},
+)
+
+// leaderElection runs the scrape loop only while this instance holds a Lease,
+// so replicas of a highly available deployment don't all scrape every
+// Kubelet. Standby replicas serve no metrics and report not ready until they
+// are elected, unless they replicate storage of the leader.
+type leaderElection struct {
+	lock    resourcelock.Interface
+	leading atomic.Bool
+	// observe is optionally called with the replication address of new leaders, empty if this instance leads.
+	observe func(address string)
+}
+
+// newLeaderElection returns a leader election advertising the storage
+// replication address of this instance in its identity, if not empty.
+func newLeaderElection(leases coordinationv1client.LeasesGetter, namespace, name, address string) *leaderElection {
+	identity, err := os.Hostname()
+	if err != nil || identity == "" {
+		identity = string(uuid.NewUUID())
+	} else {
+		identity += "_" + string(uuid.NewUUID())
+	}
+	if address != "" {
+		identity += "@" + address
+	}
+	return &leaderElection{lock: &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Client:     leases,
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}}
+}
+
+// run campaigns for the Lease until ctx is done and calls lead with a context
+// canceled when leadership is lost. Lost leadership is campaigned for again.
+func (e *leaderElection) run(ctx context.Context, lead func(context.Context)) {
+	logger := klog.FromContext(ctx)
+	for ctx.Err() == nil {
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            e.lock,
+			LeaseDuration:   leaderLeaseDuration,
+			RenewDeadline:   leaderRenewDeadline,
+			RetryPeriod:     leaderRetryPeriod,
+			ReleaseOnCancel: true,
+			Name:            "metrics-server",
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					logger.Info("Started leading, scraping Kubelets", "identity", e.lock.Identity())
+					e.setLeading(true)
+					lead(ctx)
+				},
+				OnStoppedLeading: func() {
+					logger.Info("Stopped leading, stopped scraping Kubelets", "identity", e.lock.Identity())
+					e.setLeading(false)
+				},
+				OnNewLeader: func(identity string) {
+					if identity == e.lock.Identity() {
+						e.notify("")
+						return
+					}
+					logger.Info("New leader elected", "leader", identity)
+					e.notify(leaderAddress(identity))
+				},
+			},
+		})
+		if err != nil {
+			logger.Error(err, "Failed to create leader elector")
+			return
+		}
+		elector.Run(ctx)
+	}
+}
+
+func (e *leaderElection) notify(address string) {
+	if e.observe != nil {
+		e.observe(address)
+	}
+}
+
+// leaderAddress returns the replication address advertised in a leader identity, empty if none.
+func leaderAddress(identity string) string {
+	if i := strings.LastIndex(identity, "@"); i >= 0 {
+		return identity[i+1:]
+	}
+	return ""
+}
+
+func (e *leaderElection) setLeading(leading bool) {
+	e.leading.Store(leading)
+	if leading {
+		electedLeader.Set(1)
+	} else {
+		electedLeader.Set(0)
+	}
+}
+
+// isLeader returns true if this instance holds the Lease, true if leader election is disabled.
+func (e *leaderElection) isLeader() bool {
+	return e == nil || e.leading.Load()
+}
+
+func (e *leaderElection) check() error {
+	if !e.isLeader() {
+		return fmt.Errorf("not the leader, leader election Lease held by another instance")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Leader election", func() {
+	var client *fake.Clientset
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+	})
+	It("should scrape only while holding the Lease and release it when stopped", func() {
+		election := newLeaderElection(client.CoordinationV1(), "kube-system", "metrics-server", "")
+		Expect(election.isLeader()).To(BeFalse())
+		Expect(election.check()).NotTo(Succeed())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		leading := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			election.run(ctx, func(ctx context.Context) {
+				close(leading)
+				<-ctx.Done()
+			})
+			close(done)
+		}()
+		Eventually(leading, 5*time.Second).Should(BeClosed())
+		Expect(election.isLeader()).To(BeTrue())
+		Expect(election.check()).To(Succeed())
+		lease, err := client.CoordinationV1().Leases("kube-system").Get(context.Background(), "metrics-server", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*lease.Spec.HolderIdentity).To(Equal(election.lock.Identity()))
+
+		cancel()
+		Eventually(done, 5*time.Second).Should(BeClosed())
+		Expect(election.isLeader()).To(BeFalse())
+		lease, err = client.CoordinationV1().Leases("kube-system").Get(context.Background(), "metrics-server", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*lease.Spec.HolderIdentity).To(BeEmpty())
+	})
+	It("should not scrape while another instance holds the Lease", func() {
+		holder := "other"
+		duration := int32(leaderLeaseDuration / time.Second)
+		now := metav1.NewMicroTime(time.Now())
+		_, err := client.CoordinationV1().Leases("kube-system").Create(context.Background(), &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: "metrics-server", Namespace: "kube-system"},
+			Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder, LeaseDurationSeconds: &duration, AcquireTime: &now, RenewTime: &now},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		election := newLeaderElection(client.CoordinationV1(), "kube-system", "metrics-server", "")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		leading := make(chan struct{})
+		go election.run(ctx, func(ctx context.Context) { close(leading) })
+		Consistently(leading, time.Second).ShouldNot(BeClosed())
+		Expect(election.isLeader()).To(BeFalse())
+	})
+	It("should observe the replication address of the leader", func() {
+		holder := "metrics-server-6d4f8c-x2v9k_0d4c1f8e@10.0.0.2:10251"
+		duration := int32(leaderLeaseDuration / time.Second)
+		now := metav1.NewMicroTime(time.Now())
+		_, err := client.CoordinationV1().Leases("kube-system").Create(context.Background(), &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: "metrics-server", Namespace: "kube-system"},
+			Spec:       coordinationv1.LeaseSpec{HolderIdentity: &holder, LeaseDurationSeconds: &duration, AcquireTime: &now, RenewTime: &now},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		election := newLeaderElection(client.CoordinationV1(), "kube-system", "metrics-server", "10.0.0.1:10251")
+		Expect(leaderAddress(election.lock.Identity())).To(Equal("10.0.0.1:10251"))
+		observed := make(chan string, 1)
+		election.observe = func(address string) { observed <- address }
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go election.run(ctx, func(ctx context.Context) {})
+		Eventually(observed, 5*time.Second).Should(Receive(Equal("10.0.0.2:10251")))
+	})
+	It("should consider instances without leader election leaders", func() {
+		var election *leaderElection
+		Expect(election.isLeader()).To(BeTrue())
+		Expect(election.check()).To(Succeed())
+	})
+})
@@ -21,8 +21,17 @@ import (
 	"k8s.io/component-base/metrics"
 
 	"sigs.k8s.io/metrics-server/pkg/api"
+	"sigs.k8s.io/metrics-server/pkg/export"
+	"sigs.k8s.io/metrics-server/pkg/federation"
+	"sigs.k8s.io/metrics-server/pkg/replication"
 	"sigs.k8s.io/metrics-server/pkg/scraper"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/podresources"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/resource"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/supplemental"
+	"sigs.k8s.io/metrics-server/pkg/shard"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/storage/prometheus"
+	"sigs.k8s.io/metrics-server/pkg/transform"
 )
 
 // RegisterMetrics registers
@@ -36,7 +45,7 @@ func RegisterMetrics(r metrics.KubeRegistry, metricResolution time.Duration) err
 	if err != nil {
 		return fmt.Errorf("unable to register scraper metrics: %v", err)
 	}
-	err = api.RegisterAPIMetrics(r.Register)
+	err = api.RegisterAPIMetrics(r.Register, metricResolution)
 	if err != nil {
 		return fmt.Errorf("unable to register API metrics: %v", err)
 	}
@@ -44,6 +53,42 @@ func RegisterMetrics(r metrics.KubeRegistry, metricResolution time.Duration) err
 	if err != nil {
 		return fmt.Errorf("unable to register storage metrics: %v", err)
 	}
+	err = transform.RegisterTransformMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register transform metrics: %v", err)
+	}
+	err = resource.RegisterClientMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register Kubelet client metrics: %v", err)
+	}
+	err = supplemental.RegisterSupplementalMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register supplemental source metrics: %v", err)
+	}
+	err = podresources.RegisterPodResourcesMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register pod resources metrics: %v", err)
+	}
+	err = export.RegisterExportMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register export metrics: %v", err)
+	}
+	err = prometheus.RegisterPrometheusMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register Prometheus backend metrics: %v", err)
+	}
+	err = shard.RegisterShardMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register shard metrics: %v", err)
+	}
+	err = replication.RegisterReplicationMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register replication metrics: %v", err)
+	}
+	err = federation.RegisterFederationMetrics(r.Register)
+	if err != nil {
+		return fmt.Errorf("unable to register federation metrics: %v", err)
+	}
 
 	return nil
 }
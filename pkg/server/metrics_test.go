@@ -0,0 +1,59 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+var _ = Describe("Metrics handler", func() {
+	It("should expose exemplars of traced observations in the OpenMetrics format", func() {
+		handler, _, err := Config{MetricResolution: time.Minute}.metricsHandler()
+		Expect(err).NotTo(HaveOccurred())
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x0a, 0x0b},
+			SpanID:     trace.SpanID{0x0c},
+			TraceFlags: trace.FlagsSampled,
+		}))
+		utils.ObserveWithTrace(ctx, tickDuration.ObserverMetric, 0.5)
+
+		By("negotiating OpenMetrics")
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=0.0.1")
+		handler(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		// Exemplar labels are exposed in random order.
+		Expect(rec.Body.String()).To(MatchRegexp(`metrics_server_manager_tick_duration_seconds_bucket\{le="0.5"\} [0-9]+ # \{(trace_id="0a0b0000000000000000000000000000",span_id="0c00000000000000"|span_id="0c00000000000000",trace_id="0a0b0000000000000000000000000000")\} 0.5 `))
+		Expect(rec.Body.String()).To(HaveSuffix("# EOF\n"))
+
+		By("defaulting to the Prometheus text format")
+		rec = httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(MatchRegexp(`metrics_server_manager_tick_duration_seconds_count [0-9]+\n`))
+		Expect(rec.Body.String()).NotTo(ContainSubstring("trace_id"))
+	})
+})
@@ -0,0 +1,89 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	cpuProfileCapturePath = "/debug/capture/profile"
+	traceCapturePath      = "/debug/capture/trace"
+)
+
+// profileCapture serves CPU profiles and execution traces captured for
+// a bounded number of seconds. Only one capture can run at a time, as the Go
+// runtime doesn't support concurrent CPU profiles nor traces.
+type profileCapture struct {
+	maxDuration time.Duration
+	mu          sync.Mutex
+}
+
+func newProfileCapture(maxDuration time.Duration) *profileCapture {
+	return &profileCapture{maxDuration: maxDuration}
+}
+
+func (p *profileCapture) install(mux interface {
+	HandleFunc(string, func(http.ResponseWriter, *http.Request))
+}) {
+	mux.HandleFunc(cpuProfileCapturePath, p.handler("profile", pprof.StartCPUProfile, pprof.StopCPUProfile))
+	mux.HandleFunc(traceCapturePath, p.handler("trace", trace.Start, trace.Stop))
+}
+
+func (p *profileCapture) handler(kind string, start func(io.Writer) error, stop func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seconds, err := strconv.Atoi(r.URL.Query().Get("seconds"))
+		if err != nil || seconds <= 0 {
+			http.Error(w, "seconds query parameter should be a positive integer", http.StatusBadRequest)
+			return
+		}
+		duration := time.Duration(seconds) * time.Second
+		if duration > p.maxDuration {
+			http.Error(w, fmt.Sprintf("seconds should not exceed %d", int(p.maxDuration.Seconds())), http.StatusBadRequest)
+			return
+		}
+		if !p.mu.TryLock() {
+			http.Error(w, "another capture is in progress", http.StatusConflict)
+			return
+		}
+		defer p.mu.Unlock()
+
+		var buf bytes.Buffer
+		if err := start(&buf); err != nil {
+			http.Error(w, fmt.Sprintf("could not start %s: %v", kind, err), http.StatusInternalServerError)
+			return
+		}
+		klog.FromContext(r.Context()).Info("Capturing", "kind", kind, "duration", duration)
+		select {
+		case <-time.After(duration):
+		case <-r.Context().Done():
+		}
+		stop()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", kind))
+		_, _ = w.Write(buf.Bytes())
+	}
+}
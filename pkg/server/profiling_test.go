@@ -0,0 +1,52 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profile capture", func() {
+	var mux *http.ServeMux
+
+	BeforeEach(func() {
+		mux = http.NewServeMux()
+		newProfileCapture(5 * time.Second).install(mux)
+	})
+
+	It("should capture trace for requested duration", func() {
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", traceCapturePath+"?seconds=1", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.Len()).To(BeNumerically(">", 0))
+		Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+	})
+	It("should reject missing duration", func() {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", cpuProfileCapturePath, nil))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+	It("should reject duration exceeding maximum", func() {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", cpuProfileCapturePath+"?seconds=10", nil))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+})
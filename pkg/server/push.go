@@ -0,0 +1,312 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/metrics-server/pkg/scraper"
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/resource"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/utils"
+)
+
+const (
+	// pushPathPrefix is followed by the name of the node whose metrics are pushed.
+	pushPathPrefix = "/push/v1/nodes/"
+	// pushMaxBytes bounds the size of pushed bodies, far above the resource metrics of a full node.
+	pushMaxBytes = 8 << 20
+	// pushBatchContentType is the content type of batches pushed by metrics-server node agents, in the
+	// storage checkpoint format, which unlike the Kubelet exposition keeps summary and cAdvisor stats.
+	pushBatchContentType = "application/vnd.metrics-server.batch"
+	// pushDeltaParam is the query parameter flagging pushes holding only pods whose metrics changed
+	// since the previous push of the node. Pods left out keep the metrics previously pushed.
+	pushDeltaParam = "delta"
+	// pushMaxClockSkew is how far in the future pushed points can be dated, as clocks of nodes drift.
+	pushMaxClockSkew = 10 * time.Second
+)
+
+var (
+	pushRequests = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "push",
+			Name:      "requests_total",
+			Help:      "Number of requests pushing node metrics, per response code.",
+		},
+		[]string{"code"},
+	)
+	lastPushTimestamp = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "push",
+			Name:      "last_push_timestamp_seconds",
+			Help:      "Unix time in seconds of the last accepted push of node metrics, per node or node hash bucket.",
+		},
+		[]string{"node"},
+	)
+	freshPushedNodes = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "push",
+			Name:      "fresh_nodes",
+			Help:      "Number of nodes served with fresh pushed metrics instead of being scraped in the last cycle.",
+		},
+	)
+)
+
+// pushReceiver accepts Kubelet resource metrics pushed by node agents for
+// nodes metrics-server can't scrape, e.g. in air-gapped network segments.
+// Agents POST the /metrics/resource exposition of their node to
+// pushPathPrefix followed by the node name, in the Prometheus text or
+// length-delimited protobuf format. Requests are authenticated and authorized
+// like other non-resource requests, so only agents granted the post verb on
+// the path by RBAC can push, possibly restricted to their own node.
+// metrics-server node agents push batches in pushBatchContentType instead,
+// and only send pods whose metrics changed once the receiver holds a full
+// batch of their node. Deltas of nodes without one, e.g. after a restart, are
+// rejected with a conflict so agents push a full batch.
+//
+// Only pods running on the pushed node according to the API are accepted,
+// so agents can't overwrite metrics of pods of other nodes.
+//
+// Nodes with pushed metrics younger than maxAge are served those instead of
+// being scraped, nodes whose pushed metrics went stale are scraped again.
+type pushReceiver struct {
+	nodes  v1listers.NodeLister
+	pods   v1listers.PodLister
+	maxAge time.Duration
+	clock  clock.PassiveClock
+	logger klog.Logger
+	// nodeLabels maps nodes to the node label of per-node metrics.
+	nodeLabels utils.NodeLabels
+
+	mu     sync.Mutex
+	pushed map[string]pushedBatch
+}
+
+type pushedBatch struct {
+	batch    *storage.MetricsBatch
+	received time.Time
+}
+
+var _ scraper.PushSource = (*pushReceiver)(nil)
+
+func newPushReceiver(logger klog.Logger, nodes v1listers.NodeLister, pods v1listers.PodLister, maxAge time.Duration, clock clock.PassiveClock) *pushReceiver {
+	return &pushReceiver{
+		nodes:  nodes,
+		pods:   pods,
+		maxAge: maxAge,
+		clock:  clock,
+		logger: logger,
+		pushed: map[string]pushedBatch{},
+	}
+}
+
+func (p *pushReceiver) install(mux interface {
+	HandlePrefix(string, http.Handler)
+}) {
+	mux.HandlePrefix(pushPathPrefix, p)
+}
+
+func (p *pushReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	code, err := p.receive(w, r)
+	pushRequests.WithLabelValues(strconv.Itoa(code)).Inc()
+	if err != nil {
+		klog.FromContext(r.Context()).V(1).Info("Rejected pushed node metrics", "path", r.URL.Path, "code", code, "err", err)
+		http.Error(w, err.Error(), code)
+		return
+	}
+	w.WriteHeader(code)
+}
+
+// receive stores the batch pushed by r and returns the response code.
+func (p *pushReceiver) receive(w http.ResponseWriter, r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		return http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)
+	}
+	logger := klog.FromContext(r.Context())
+	name := strings.TrimPrefix(r.URL.Path, pushPathPrefix)
+	if name == "" || strings.Contains(name, "/") {
+		return http.StatusNotFound, fmt.Errorf("path should be %s followed by a node name", pushPathPrefix)
+	}
+	_, err := p.nodes.Get(name)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return http.StatusNotFound, fmt.Errorf("node %q not found", name)
+		}
+		return http.StatusInternalServerError, err
+	}
+	now := p.clock.Now()
+	body := http.MaxBytesReader(w, r.Body, pushMaxBytes)
+	var batch *storage.MetricsBatch
+	if r.Header.Get("Content-Type") == pushBatchContentType {
+		batch, err = storage.ReadBatch(body)
+	} else {
+		batch, err = resource.DecodePushedBatch(logger, body, r.Header.Get("Content-Type"), now, name)
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return http.StatusRequestEntityTooLarge, err
+		}
+		return http.StatusBadRequest, err
+	}
+	if err := checkPushedNodes(batch, name); err != nil {
+		return http.StatusBadRequest, err
+	}
+	point, found := batch.Nodes[name]
+	if !found {
+		return http.StatusBadRequest, fmt.Errorf("missing usage of node %q", name)
+	}
+	if age := now.Sub(point.Timestamp); age > p.maxAge {
+		return http.StatusBadRequest, fmt.Errorf("node usage is %s old, older than %s", age, p.maxAge)
+	}
+	if err := checkPushedTimestamps(batch, now.Add(pushMaxClockSkew)); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if dropped := p.dropOtherPods(batch, name); dropped != 0 {
+		logger.V(1).Info("Dropped pushed metrics of pods not running on node", "node", klog.KRef("", name), "podCount", dropped)
+	}
+	markPushed(batch, name)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r.URL.Query().Get(pushDeltaParam) == "true" {
+		previous, found := p.pushed[name]
+		if !found {
+			return http.StatusConflict, fmt.Errorf("no full batch of node %q to apply the delta to", name)
+		}
+		batch = mergeDelta(previous.batch, batch)
+	}
+	if _, found := p.pushed[name]; !found {
+		logger.V(1).Info("Serving pushed metrics of node instead of scraping it", "node", klog.KRef("", name))
+	}
+	p.pushed[name] = pushedBatch{batch: batch, received: now}
+	lastPushTimestamp.WithLabelValues(p.nodeLabels.Label(name)).Set(float64(now.Unix()))
+	logger.V(2).Info("Received pushed node metrics", "node", klog.KRef("", name), "podCount", len(batch.Pods))
+	return http.StatusNoContent, nil
+}
+
+// PushedBatches implements scraper.PushSource, forgetting batches older than maxAge.
+func (p *pushReceiver) PushedBatches() map[string]*storage.MetricsBatch {
+	now := p.clock.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make(map[string]*storage.MetricsBatch, len(p.pushed))
+	for name, pushed := range p.pushed {
+		if now.Sub(pushed.received) > p.maxAge {
+			p.logger.Info("Pushed metrics of node went stale, resuming scrapes", "node", klog.KRef("", name), "received", pushed.received)
+			delete(p.pushed, name)
+			continue
+		}
+		res[name] = pushed.batch
+	}
+	freshPushedNodes.Set(float64(len(res)))
+	return res
+}
+
+// checkPushedNodes returns an error if batch holds metrics of other nodes
+// than node, which its agent could use to overwrite metrics of any node.
+func checkPushedNodes(batch *storage.MetricsBatch, node string) error {
+	for name := range batch.Nodes {
+		if name != node {
+			return fmt.Errorf("batch pushed for node %q holds usage of node %q", node, name)
+		}
+	}
+	for name := range batch.NodeFilesystems {
+		if name != node {
+			return fmt.Errorf("batch pushed for node %q holds filesystems of node %q", node, name)
+		}
+	}
+	for name := range batch.WindowsNodes {
+		if name != node {
+			return fmt.Errorf("batch pushed for node %q flags node %q as Windows", node, name)
+		}
+	}
+	return nil
+}
+
+// checkPushedTimestamps returns an error if points of batch are dated after latest.
+func checkPushedTimestamps(batch *storage.MetricsBatch, latest time.Time) error {
+	for name, point := range batch.Nodes {
+		if point.Timestamp.After(latest) {
+			return fmt.Errorf("usage of node %q is dated in the future, at %s", name, point.Timestamp)
+		}
+	}
+	for pod, point := range batch.Pods {
+		if point.Pod.Timestamp.After(latest) {
+			return fmt.Errorf("usage of pod %q is dated in the future, at %s", pod, point.Pod.Timestamp)
+		}
+		for container, cp := range point.Containers {
+			if cp.Timestamp.After(latest) {
+				return fmt.Errorf("usage of container %q of pod %q is dated in the future, at %s", container, pod, cp.Timestamp)
+			}
+		}
+	}
+	return nil
+}
+
+// dropOtherPods drops pods of batch not running on node according to the
+// API, including pods not known yet, and returns how many were dropped.
+func (p *pushReceiver) dropOtherPods(batch *storage.MetricsBatch, node string) int {
+	dropped := 0
+	for ref := range batch.Pods {
+		pod, err := p.pods.Pods(ref.Namespace).Get(ref.Name)
+		if err != nil || pod.Spec.NodeName != node {
+			delete(batch.Pods, ref)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// mergeDelta returns delta with the pods of previous it doesn't hold. Pushed
+// batches are stored as is, so previous isn't modified.
+func mergeDelta(previous, delta *storage.MetricsBatch) *storage.MetricsBatch {
+	merged := *delta
+	merged.Pods = make(map[apitypes.NamespacedName]storage.PodMetricsPoint, len(previous.Pods)+len(delta.Pods))
+	for pod, point := range previous.Pods {
+		merged.Pods[pod] = point
+	}
+	for pod, point := range delta.Pods {
+		merged.Pods[pod] = point
+	}
+	return &merged
+}
+
+// markPushed flags batch and its pods as pushed for node.
+func markPushed(batch *storage.MetricsBatch, node string) {
+	batch.PushedNodes = map[string]bool{node: true}
+	for pod, point := range batch.Pods {
+		point.Pushed = true
+		point.Node = node
+		batch.Pods[pod] = point
+	}
+}
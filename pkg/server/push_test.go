@@ -0,0 +1,186 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var _ = Describe("Push receiver", func() {
+	var (
+		clock    *testingclock.FakeClock
+		receiver *pushReceiver
+	)
+
+	BeforeEach(func() {
+		clock = testingclock.NewFakeClock(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC))
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		Expect(indexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})).To(Succeed())
+		pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, name := range []string{"pod1", "pod2"} {
+			Expect(pods.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: name}, Spec: corev1.PodSpec{NodeName: "node1"}})).To(Succeed())
+		}
+		Expect(pods.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod3"}, Spec: corev1.PodSpec{NodeName: "node2"}})).To(Succeed())
+		receiver = newPushReceiver(klog.Background(), v1listers.NewNodeLister(indexer), v1listers.NewPodLister(pods), time.Minute, clock)
+	})
+
+	textBody := func(timestamp time.Time) string {
+		ms := timestamp.UnixMilli()
+		return fmt.Sprintf(`node_cpu_usage_seconds_total 10 %d
+node_memory_working_set_bytes 1000 %d
+container_cpu_usage_seconds_total{container="app",namespace="ns1",pod="pod1"} 5 %d
+container_memory_working_set_bytes{container="app",namespace="ns1",pod="pod1"} 500 %d
+container_start_time_seconds{container="app",namespace="ns1",pod="pod1"} 1 %d
+`, ms, ms, ms, ms, ms)
+	}
+	push := func(node, contentType string, body []byte) int {
+		req := httptest.NewRequest(http.MethodPost, pushPathPrefix+node, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	It("should serve pushed metrics flagged as pushed until they are stale", func() {
+		Expect(push("node1", "text/plain; version=0.0.4", []byte(textBody(clock.Now())))).To(Equal(http.StatusNoContent))
+
+		batches := receiver.PushedBatches()
+		Expect(batches).To(HaveKey("node1"))
+		batch := batches["node1"]
+		Expect(batch.Nodes["node1"].MemoryUsage).To(BeEquivalentTo(1000))
+		Expect(batch.PushedNodes).To(Equal(map[string]bool{"node1": true}))
+		Expect(batch.Pods[apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}].Pushed).To(BeTrue())
+
+		clock.Step(2 * time.Minute)
+		Expect(receiver.PushedBatches()).To(BeEmpty())
+	})
+	It("should accept metrics in the delimited protobuf format", func() {
+		ms := clock.Now().UnixMilli()
+		families := []*dto.MetricFamily{
+			{
+				Name:   proto.String("node_cpu_usage_seconds_total"),
+				Type:   dto.MetricType_COUNTER.Enum(),
+				Metric: []*dto.Metric{{Counter: &dto.Counter{Value: proto.Float64(10)}, TimestampMs: proto.Int64(ms)}},
+			},
+			{
+				Name:   proto.String("node_memory_working_set_bytes"),
+				Type:   dto.MetricType_GAUGE.Enum(),
+				Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(1000)}, TimestampMs: proto.Int64(ms)}},
+			},
+		}
+		var body bytes.Buffer
+		enc := expfmt.NewEncoder(&body, expfmt.FmtProtoDelim)
+		for _, family := range families {
+			Expect(enc.Encode(family)).To(Succeed())
+		}
+		Expect(push("node1", string(expfmt.FmtProtoDelim), body.Bytes())).To(Equal(http.StatusNoContent))
+		Expect(receiver.PushedBatches()["node1"].Nodes["node1"].CumulativeCpuUsed).To(BeEquivalentTo(10 * time.Second))
+	})
+	It("should apply deltas to the last full batch in the batch format", func() {
+		pod1 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+		pod2 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod2"}
+		point := storage.MetricsPoint{Timestamp: clock.Now(), CumulativeCpuUsed: 10, MemoryUsage: 1000}
+		encode := func(pods ...apitypes.NamespacedName) []byte {
+			batch := &storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{"node1": point}, Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{}}
+			for _, pod := range pods {
+				batch.Pods[pod] = storage.PodMetricsPoint{Containers: map[string]storage.MetricsPoint{"app": point}}
+			}
+			var body bytes.Buffer
+			Expect(storage.WriteBatch(&body, batch)).To(Succeed())
+			return body.Bytes()
+		}
+		pushDelta := func(body []byte) int {
+			req := httptest.NewRequest(http.MethodPost, pushPathPrefix+"node1?"+pushDeltaParam+"=true", bytes.NewReader(body))
+			req.Header.Set("Content-Type", pushBatchContentType)
+			rec := httptest.NewRecorder()
+			receiver.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		By("rejecting a delta without a full batch")
+		Expect(pushDelta(encode(pod1))).To(Equal(http.StatusConflict))
+		By("merging a delta with the full batch")
+		Expect(push("node1", pushBatchContentType, encode(pod1))).To(Equal(http.StatusNoContent))
+		Expect(pushDelta(encode(pod2))).To(Equal(http.StatusNoContent))
+		pods := receiver.PushedBatches()["node1"].Pods
+		Expect(pods).To(HaveKey(pod1))
+		Expect(pods).To(HaveKey(pod2))
+		Expect(pods[pod2].Pushed).To(BeTrue())
+	})
+	It("should reject pushes of unknown nodes", func() {
+		Expect(push("node2", "text/plain", []byte(textBody(clock.Now())))).To(Equal(http.StatusNotFound))
+		Expect(receiver.PushedBatches()).To(BeEmpty())
+	})
+	It("should drop pods not running on the pushed node", func() {
+		pod3 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod3"}
+		pod4 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod4"}
+		point := storage.MetricsPoint{Timestamp: clock.Now(), CumulativeCpuUsed: 10, MemoryUsage: 1000}
+		batch := &storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{"node1": point}, Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{}}
+		for _, pod := range []apitypes.NamespacedName{{Namespace: "ns1", Name: "pod1"}, pod3, pod4} {
+			batch.Pods[pod] = storage.PodMetricsPoint{Containers: map[string]storage.MetricsPoint{"app": point}}
+		}
+		var body bytes.Buffer
+		Expect(storage.WriteBatch(&body, batch)).To(Succeed())
+		Expect(push("node1", pushBatchContentType, body.Bytes())).To(Equal(http.StatusNoContent))
+		pods := receiver.PushedBatches()["node1"].Pods
+		Expect(pods).To(HaveLen(1))
+		Expect(pods).To(HaveKey(apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}))
+	})
+	It("should reject stale, future and incomplete metrics", func() {
+		Expect(push("node1", "text/plain", []byte(textBody(clock.Now().Add(-2*time.Minute))))).To(Equal(http.StatusBadRequest))
+		Expect(push("node1", "text/plain", []byte(textBody(clock.Now().Add(time.Minute))))).To(Equal(http.StatusBadRequest))
+		Expect(push("node1", "text/plain", []byte(strings.SplitN(textBody(clock.Now()), "\n", 2)[1]))).To(Equal(http.StatusBadRequest))
+		Expect(receiver.PushedBatches()).To(BeEmpty())
+	})
+	It("should reject batches holding metrics of other nodes", func() {
+		point := storage.MetricsPoint{Timestamp: clock.Now(), CumulativeCpuUsed: 10, MemoryUsage: 1000}
+		var body bytes.Buffer
+		Expect(storage.WriteBatch(&body, &storage.MetricsBatch{Nodes: map[string]storage.MetricsPoint{"node1": point, "node2": point}})).To(Succeed())
+		Expect(push("node1", pushBatchContentType, body.Bytes())).To(Equal(http.StatusBadRequest))
+		Expect(receiver.PushedBatches()).To(BeEmpty())
+
+		By("checking all per-node fields")
+		nodes := map[string]storage.MetricsPoint{"node1": point}
+		Expect(checkPushedNodes(&storage.MetricsBatch{Nodes: nodes, NodeFilesystems: map[string][]storage.FilesystemMetricsPoint{"node2": {{Name: storage.FilesystemImage}}}}, "node1")).NotTo(Succeed())
+		Expect(checkPushedNodes(&storage.MetricsBatch{Nodes: nodes, WindowsNodes: map[string]bool{"node2": true}}, "node1")).NotTo(Succeed())
+		Expect(checkPushedNodes(&storage.MetricsBatch{Nodes: nodes, WindowsNodes: map[string]bool{"node1": true}}, "node1")).To(Succeed())
+	})
+	It("should only allow POST", func() {
+		rec := httptest.NewRecorder()
+		receiver.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, pushPathPrefix+"node1", nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
@@ -0,0 +1,278 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Types of pushes sent by node agents.
+const (
+	// pushFull batches hold all pods of the node.
+	pushFull = "full"
+	// pushDelta batches only hold pods whose metrics changed since the previous push.
+	pushDelta = "delta"
+)
+
+var agentPushes = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "push_agent",
+		Name:      "pushes_total",
+		Help:      "Number of batches pushed to the aggregator by this node agent, by type and result.",
+	},
+	[]string{"type", "result"},
+)
+
+// pushAgent pushes the metrics of the local node, or of every node of the
+// topology domain scraped by a zone replica, to the push receiver of a
+// central aggregator after every scrape cycle, so agents scrape only their
+// local Kubelet or zone and only the aggregator serves the API. Once the
+// aggregator accepted a full batch of a node, only the node usage and pods
+// whose metrics changed are pushed. Any pod removal or failed push sends a
+// full batch again. Like exporters, pushes run in the background and only
+// the latest batch is kept while a previous one is being sent.
+type pushAgent struct {
+	// base is the URL of the aggregator.
+	base *url.URL
+	// node is the only node pushed, every node of scraped batches if empty.
+	node    string
+	client  *http.Client
+	token   func() (string, error)
+	pending chan *storage.MetricsBatch
+	// last are the last batches accepted by the aggregator by node, the next push of a node without one is full.
+	last map[string]*storage.MetricsBatch
+}
+
+// newPushAgent returns an agent pushing metrics of node, or of every scraped
+// node if empty, to the aggregator at address, authenticating with token.
+// The serving certificate of the aggregator is verified with the CA bundle
+// in caFile, so the token is only sent to the aggregator.
+func newPushAgent(address, caFile, node string, token func() (string, error), timeout time.Duration) (*pushAgent, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid push aggregator URL: %v", err)
+	}
+	if caFile == "" {
+		return nil, fmt.Errorf("a CA bundle verifying the push aggregator is required to send it credentials")
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read push aggregator CA bundle: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in push aggregator CA bundle %q", caFile)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+	return &pushAgent{
+		base:    u,
+		node:    node,
+		client:  &http.Client{Transport: transport, Timeout: timeout},
+		token:   token,
+		pending: make(chan *storage.MetricsBatch, 1),
+		last:    map[string]*storage.MetricsBatch{},
+	}, nil
+}
+
+// enqueue queues batch to be pushed, replacing a batch not pushed yet.
+func (a *pushAgent) enqueue(batch *storage.MetricsBatch) {
+	if a == nil {
+		return
+	}
+	select {
+	case <-a.pending:
+	default:
+	}
+	select {
+	case a.pending <- batch:
+	default:
+	}
+}
+
+// run pushes queued batches until ctx is done.
+func (a *pushAgent) run(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	logger.Info("Pushing node metrics to the aggregator", "url", a.base.String())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch := <-a.pending:
+			if err := a.push(ctx, batch); err != nil {
+				logger.Error(err, "Failed to push node metrics to the aggregator")
+			}
+		}
+	}
+}
+
+// push sends the batch of each pushed node.
+func (a *pushAgent) push(ctx context.Context, batch *storage.MetricsBatch) error {
+	if a.node != "" {
+		return a.pushNode(ctx, a.node, batch)
+	}
+	batches := splitNodes(batch)
+	for node := range a.last {
+		if _, found := batches[node]; !found {
+			delete(a.last, node)
+		}
+	}
+	var errs []error
+	for node, b := range batches {
+		if err := a.pushNode(ctx, node, b); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// splitNodes returns the metrics of each node of batch with usage. The push
+// receiver only accepts a node's own metrics in its batches.
+func splitNodes(batch *storage.MetricsBatch) map[string]*storage.MetricsBatch {
+	res := make(map[string]*storage.MetricsBatch, len(batch.Nodes))
+	for node, point := range batch.Nodes {
+		b := &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{node: point},
+			Pods:  map[apitypes.NamespacedName]storage.PodMetricsPoint{},
+		}
+		if fs, found := batch.NodeFilesystems[node]; found {
+			b.NodeFilesystems = map[string][]storage.FilesystemMetricsPoint{node: fs}
+		}
+		if batch.WindowsNodes[node] {
+			b.WindowsNodes = map[string]bool{node: true}
+		}
+		res[node] = b
+	}
+	for pod, point := range batch.Pods {
+		if b, found := res[point.Node]; found {
+			b.Pods[pod] = point
+		}
+	}
+	return res
+}
+
+// pushNode sends the batch of node, as a delta of the last accepted batch if
+// possible. Deltas rejected because the aggregator lost the full batch, e.g.
+// after a restart, are sent again as full batches.
+func (a *pushAgent) pushNode(ctx context.Context, node string, batch *storage.MetricsBatch) error {
+	logger := klog.FromContext(ctx)
+	if _, found := batch.Nodes[node]; !found {
+		// The receiver requires node usage, the scrape of the local Kubelet failed.
+		delete(a.last, node)
+		return fmt.Errorf("missing usage of node %q", node)
+	}
+	pushed, pushType := a.delta(node, batch)
+	code, err := a.send(ctx, node, pushed, pushType)
+	if err == nil && code == http.StatusConflict && pushType == pushDelta {
+		agentPushes.WithLabelValues(pushType, "conflict").Inc()
+		logger.V(1).Info("Aggregator has no full batch of node, pushing a full batch", "node", klog.KRef("", node))
+		pushType = pushFull
+		code, err = a.send(ctx, node, batch, pushType)
+	}
+	if err == nil && code != http.StatusNoContent {
+		err = fmt.Errorf("aggregator responded with status %d", code)
+	}
+	if err != nil {
+		agentPushes.WithLabelValues(pushType, "error").Inc()
+		delete(a.last, node)
+		return fmt.Errorf("pushing node %q: %w", node, err)
+	}
+	agentPushes.WithLabelValues(pushType, "success").Inc()
+	logger.V(2).Info("Pushed node metrics to the aggregator", "node", klog.KRef("", node), "type", pushType, "podCount", len(pushed.Pods))
+	a.last[node] = batch
+	return nil
+}
+
+// delta returns the batch of node to push and its type. Deltas hold the node
+// usage and pods added or whose points changed since the last accepted batch.
+func (a *pushAgent) delta(node string, batch *storage.MetricsBatch) (*storage.MetricsBatch, string) {
+	last, found := a.last[node]
+	if !found {
+		return batch, pushFull
+	}
+	for pod := range last.Pods {
+		if _, found := batch.Pods[pod]; !found {
+			return batch, pushFull
+		}
+	}
+	delta := *batch
+	delta.Pods = map[apitypes.NamespacedName]storage.PodMetricsPoint{}
+	for pod, point := range batch.Pods {
+		if previous, found := last.Pods[pod]; !found || podChanged(previous, point) {
+			delta.Pods[pod] = point
+		}
+	}
+	return &delta, pushDelta
+}
+
+// podChanged returns true if the containers or timestamps of points of a pod changed.
+func podChanged(previous, current storage.PodMetricsPoint) bool {
+	if !previous.Pod.Timestamp.Equal(current.Pod.Timestamp) || len(previous.Containers) != len(current.Containers) {
+		return true
+	}
+	for name, point := range current.Containers {
+		p, found := previous.Containers[name]
+		if !found || !p.Timestamp.Equal(point.Timestamp) {
+			return true
+		}
+	}
+	return false
+}
+
+// send posts batch of node and returns the response code.
+func (a *pushAgent) send(ctx context.Context, node string, batch *storage.MetricsBatch, pushType string) (int, error) {
+	body := &bytes.Buffer{}
+	if err := storage.WriteBatch(body, batch); err != nil {
+		return 0, err
+	}
+	target := a.base.JoinPath(pushPathPrefix, node).String()
+	if pushType == pushDelta {
+		target += "?" + pushDeltaParam + "=true"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", pushBatchContentType)
+	token, err := a.token()
+	if err != nil {
+		return 0, fmt.Errorf("unable to read bearer token: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var _ = Describe("Push agent", func() {
+	var (
+		clock      *testingclock.FakeClock
+		receiver   *pushReceiver
+		aggregator *httptest.Server
+		agent      *pushAgent
+		mu         sync.Mutex
+		requests   []string
+		tokens     []string
+		dir        string
+	)
+
+	BeforeEach(func() {
+		clock = testingclock.NewFakeClock(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC))
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, name := range []string{"node1", "node2"} {
+			Expect(indexer.Add(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})).To(Succeed())
+		}
+		pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+		for _, name := range []string{"pod1", "pod2"} {
+			Expect(pods.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: name}, Spec: corev1.PodSpec{NodeName: "node1"}})).To(Succeed())
+		}
+		Expect(pods.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod3"}, Spec: corev1.PodSpec{NodeName: "node2"}})).To(Succeed())
+		receiver = newPushReceiver(klog.Background(), v1listers.NewNodeLister(indexer), v1listers.NewPodLister(pods), time.Minute, clock)
+		requests, tokens = nil, nil
+		aggregator = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests = append(requests, r.URL.RawQuery)
+			tokens = append(tokens, r.Header.Get("Authorization"))
+			mu.Unlock()
+			receiver.ServeHTTP(w, r)
+		}))
+		var err error
+		dir, err = os.MkdirTemp("", "push-agent")
+		Expect(err).NotTo(HaveOccurred())
+		caFile := filepath.Join(dir, "ca.crt")
+		Expect(os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: aggregator.Certificate().Raw}), 0600)).To(Succeed())
+		agent, err = newPushAgent(aggregator.URL, caFile, "node1", func() (string, error) { return "agent-token", nil }, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+	})
+	AfterEach(func() {
+		aggregator.Close()
+		os.RemoveAll(dir)
+	})
+
+	point := func(timestamp time.Time) storage.MetricsPoint {
+		return storage.MetricsPoint{StartTime: timestamp.Add(-time.Hour), Timestamp: timestamp, CumulativeCpuUsed: uint64(timestamp.Unix()), MemoryUsage: 1000}
+	}
+	pod1 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+	pod2 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod2"}
+	batch := func(node, pod1Time, pod2Time time.Time) *storage.MetricsBatch {
+		b := &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{"node1": point(node)},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				pod1: {Containers: map[string]storage.MetricsPoint{"app": point(pod1Time)}},
+			},
+		}
+		if !pod2Time.IsZero() {
+			b.Pods[pod2] = storage.PodMetricsPoint{Containers: map[string]storage.MetricsPoint{"app": point(pod2Time)}}
+		}
+		return b
+	}
+	pushedPods := func() map[apitypes.NamespacedName]time.Time {
+		res := map[apitypes.NamespacedName]time.Time{}
+		for pod, point := range receiver.PushedBatches()["node1"].Pods {
+			res[pod] = point.Containers["app"].Timestamp.UTC()
+		}
+		return res
+	}
+
+	It("should push a full batch, then deltas of changed pods", func() {
+		t0 := clock.Now().Add(-10 * time.Second)
+		t1 := clock.Now()
+
+		By("pushing a full batch first")
+		Expect(agent.push(context.Background(), batch(t0, t0, t0))).To(Succeed())
+		Expect(requests).To(Equal([]string{""}))
+		Expect(tokens).To(Equal([]string{"Bearer agent-token"}))
+		Expect(pushedPods()).To(HaveLen(2))
+
+		By("pushing only the node and the pod whose metrics changed")
+		delta, pushType := agent.delta("node1", batch(t1, t1, t0))
+		Expect(pushType).To(Equal(pushDelta))
+		Expect(delta.Pods).To(HaveLen(1))
+		Expect(delta.Pods).To(HaveKey(pod1))
+		Expect(agent.push(context.Background(), batch(t1, t1, t0))).To(Succeed())
+		Expect(requests[1]).To(Equal("delta=true"))
+		Expect(receiver.PushedBatches()["node1"].Nodes["node1"].Timestamp).To(BeTemporally("==", t1))
+		Expect(pushedPods()).To(Equal(map[apitypes.NamespacedName]time.Time{pod1: t1, pod2: t0}))
+		Expect(receiver.PushedBatches()["node1"].Pods[pod2].Pushed).To(BeTrue())
+
+		By("pushing a full batch once a pod was removed")
+		Expect(agent.push(context.Background(), batch(t1, t1, time.Time{}))).To(Succeed())
+		Expect(requests[2]).To(Equal(""))
+		Expect(pushedPods()).To(Equal(map[apitypes.NamespacedName]time.Time{pod1: t1}))
+	})
+	It("should push a full batch when the aggregator lost the previous one", func() {
+		t0 := clock.Now().Add(-10 * time.Second)
+		t1 := clock.Now()
+		Expect(agent.push(context.Background(), batch(t0, t0, t0))).To(Succeed())
+
+		By("restarting the aggregator")
+		receiver.pushed = map[string]pushedBatch{}
+		Expect(agent.push(context.Background(), batch(t1, t1, t0))).To(Succeed())
+		Expect(requests).To(Equal([]string{"", "delta=true", ""}))
+		Expect(pushedPods()).To(Equal(map[apitypes.NamespacedName]time.Time{pod1: t1, pod2: t0}))
+	})
+	It("should refuse to push without a CA bundle verifying the aggregator", func() {
+		_, err := newPushAgent(aggregator.URL, "", "node1", func() (string, error) { return "agent-token", nil }, time.Second)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should push each node of the zone to its own path", func() {
+		var err error
+		agent, err = newPushAgent(aggregator.URL, filepath.Join(dir, "ca.crt"), "", func() (string, error) { return "agent-token", nil }, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		t0 := clock.Now()
+		pod3 := apitypes.NamespacedName{Namespace: "ns1", Name: "pod3"}
+		b := &storage.MetricsBatch{
+			Nodes: map[string]storage.MetricsPoint{"node1": point(t0), "node2": point(t0)},
+			Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+				pod1: {Node: "node1", Containers: map[string]storage.MetricsPoint{"app": point(t0)}},
+				pod3: {Node: "node2", Containers: map[string]storage.MetricsPoint{"app": point(t0)}},
+			},
+		}
+		Expect(agent.push(context.Background(), b)).To(Succeed())
+		pushed := receiver.PushedBatches()
+		Expect(pushed).To(HaveLen(2))
+		Expect(pushed["node1"].Pods).To(HaveKey(pod1))
+		Expect(pushed["node2"].Pods).To(HaveKey(pod3))
+
+		By("forgetting nodes no longer scraped")
+		delete(b.Nodes, "node2")
+		Expect(agent.push(context.Background(), b)).To(Succeed())
+		Expect(agent.last).NotTo(HaveKey("node2"))
+	})
+	It("should push a full batch after a failed push", func() {
+		t0 := clock.Now().Add(-10 * time.Second)
+		Expect(agent.push(context.Background(), batch(t0, t0, t0))).To(Succeed())
+
+		By("failing to push a batch without node usage")
+		Expect(agent.push(context.Background(), &storage.MetricsBatch{})).NotTo(Succeed())
+		_, pushType := agent.delta("node1", batch(clock.Now(), clock.Now(), t0))
+		Expect(pushType).To(Equal(pushFull))
+	})
+})
@@ -0,0 +1,254 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+
+	"sigs.k8s.io/metrics-server/pkg/filter"
+	"sigs.k8s.io/metrics-server/pkg/scraper"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// configReloadInterval is the interval the config file is checked for changes at.
+const configReloadInterval = 10 * time.Second
+
+var (
+	configReloads = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "manager",
+			Name:      "config_reloads_total",
+			Help:      "Number of changes of the config file, by result. Invalid changes are ignored and previous settings kept applied.",
+		},
+		[]string{"result"},
+	)
+	configRestartRequired = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "manager",
+			Name:      "config_restart_required",
+			Help:      "Whether the config file changes settings only applied on restart.",
+		},
+	)
+)
+
+// Settings are the options of Config applied without restart when the config file changes.
+type Settings struct {
+	ScrapeTimeoutMargin    time.Duration
+	SkipNotReadyNodes      bool
+	SkipNodeTaints         []string
+	ScrapeBudgetBytes      int64
+	ScrapeBudgetDuration   time.Duration
+	ScrapeSpreadPerNode    time.Duration
+	ScrapeFailureThreshold int
+	ScrapeMaxBackoffCycles int
+	MetricHistoryLength    int
+	MetricRetainedPoints   int
+	CPURateWindow          time.Duration
+	UsageSmoothingHalfLife time.Duration
+	ResourceNames          map[string]string
+	EvictionTTL            time.Duration
+	IncludeNamespaces      []string
+	ExcludeNamespaces      []string
+}
+
+// settings returns the settings of c applied without restart.
+func (c Config) settings() Settings {
+	return Settings{
+		ScrapeTimeoutMargin:    c.ScrapeTimeoutMargin,
+		SkipNotReadyNodes:      c.SkipNotReadyNodes,
+		SkipNodeTaints:         c.SkipNodeTaints,
+		ScrapeBudgetBytes:      c.ScrapeBudgetBytes,
+		ScrapeBudgetDuration:   c.ScrapeBudgetDuration,
+		ScrapeSpreadPerNode:    c.ScrapeSpreadPerNode,
+		ScrapeFailureThreshold: c.ScrapeFailureThreshold,
+		ScrapeMaxBackoffCycles: c.ScrapeMaxBackoffCycles,
+		MetricHistoryLength:    c.MetricHistoryLength,
+		MetricRetainedPoints:   c.MetricRetainedPoints,
+		CPURateWindow:          c.CPURateWindow,
+		UsageSmoothingHalfLife: c.UsageSmoothingHalfLife,
+		ResourceNames:          c.ResourceNames,
+		EvictionTTL:            c.EvictionTTL,
+		IncludeNamespaces:      c.IncludeNamespaces,
+		ExcludeNamespaces:      c.ExcludeNamespaces,
+	}
+}
+
+// settingsStorage is the storage Settings are applied to.
+type settingsStorage interface {
+	SetHistoryLength(n int)
+	SetRetainedPoints(n int)
+	SetCPURateWindow(window time.Duration)
+	SetSmoothingHalfLife(halfLife time.Duration)
+	SetResourceNames(names storage.ResourceNames)
+	SetEvictionTTL(ttl time.Duration)
+}
+
+// settingsScraper is the scraper Settings are applied to.
+type settingsScraper interface {
+	SetSkipPolicy(notReady bool, taints []corev1.Taint)
+	SetBudget(maxBytes int64, maxDuration time.Duration)
+	SetSpread(perNode, maxWindow time.Duration)
+	SetAdaptiveTimeout(margin, max time.Duration)
+	SetCircuitBreaker(threshold, maxBackoff int)
+}
+
+// settingsApplier applies Settings to the storage, the scraper and namespace filtering.
+type settingsApplier struct {
+	storage    settingsStorage
+	scraper    settingsScraper
+	namespaces *filter.DynamicNamespaces
+	resolution time.Duration
+	// tickInterval is the interval of scrape cycles.
+	tickInterval  time.Duration
+	scrapeTimeout time.Duration
+}
+
+// apply validates settings and applies them to the storage and namespace
+// filtering right away. It returns a func applying them to the scraper, which
+// isn't safe for concurrent use and must be called between scrape cycles.
+func (a *settingsApplier) apply(s Settings) (func(), error) {
+	taints, err := scraper.ParseTaints(s.SkipNodeTaints)
+	if err != nil {
+		return nil, err
+	}
+	resourceNames, err := storage.ParseResourceNames(s.ResourceNames)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := filter.NewNamespaces(s.IncludeNamespaces, s.ExcludeNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	a.storage.SetHistoryLength(s.MetricHistoryLength)
+	retainedPoints := s.MetricRetainedPoints
+	if windowPoints := storage.RetainedPointsForWindow(s.CPURateWindow, a.resolution); windowPoints > retainedPoints {
+		retainedPoints = windowPoints
+	}
+	a.storage.SetRetainedPoints(retainedPoints)
+	a.storage.SetCPURateWindow(s.CPURateWindow)
+	a.storage.SetSmoothingHalfLife(s.UsageSmoothingHalfLife)
+	a.storage.SetResourceNames(resourceNames)
+	a.storage.SetEvictionTTL(s.EvictionTTL)
+	a.namespaces.Set(namespaces)
+	return func() {
+		a.scraper.SetSkipPolicy(s.SkipNotReadyNodes, taints)
+		a.scraper.SetBudget(s.ScrapeBudgetBytes, s.ScrapeBudgetDuration)
+		a.scraper.SetSpread(s.ScrapeSpreadPerNode, a.tickInterval-a.scrapeTimeout)
+		a.scraper.SetAdaptiveTimeout(s.ScrapeTimeoutMargin, a.tickInterval*9/10)
+		a.scraper.SetCircuitBreaker(s.ScrapeFailureThreshold, s.ScrapeMaxBackoffCycles)
+	}, nil
+}
+
+// configReloader checks the config file for changes and applies Settings
+// loaded from it. Changes of other options are only applied on restart.
+type configReloader struct {
+	path string
+	// load returns the settings of the config file content and the options it changes that require a restart.
+	load    func(config []byte) (Settings, []string, error)
+	applier *settingsApplier
+	clock   clock.WithTicker
+	// content is the config file content last loaded.
+	content []byte
+
+	// mu protects pending
+	mu sync.Mutex
+	// pending applies the last loaded settings to the scraper, nil once applied.
+	pending func()
+}
+
+// newConfigReloader returns a reloader of the config file at path, whose
+// current content is already applied.
+func newConfigReloader(path string, load func([]byte) (Settings, []string, error), applier *settingsApplier, clock clock.WithTicker) (*configReloader, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &configReloader{path: path, load: load, applier: applier, clock: clock, content: content}, nil
+}
+
+// run checks the config file for changes every configReloadInterval until ctx is done.
+func (r *configReloader) run(ctx context.Context) {
+	ticker := r.clock.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			r.check(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check loads and applies the config file if its content changed. Invalid
+// content is ignored and previous settings kept applied.
+func (r *configReloader) check(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	content, err := os.ReadFile(r.path)
+	if err != nil {
+		logger.Error(err, "Failed reading config file", "path", r.path)
+		return
+	}
+	if bytes.Equal(content, r.content) {
+		return
+	}
+	r.content = content
+	settings, restart, err := r.load(content)
+	var applyScraper func()
+	if err == nil {
+		applyScraper, err = r.applier.apply(settings)
+	}
+	if err != nil {
+		configReloads.WithLabelValues("error").Inc()
+		logger.Error(err, "Ignoring invalid config file change", "path", r.path)
+		return
+	}
+	r.mu.Lock()
+	r.pending = applyScraper
+	r.mu.Unlock()
+	configReloads.WithLabelValues("success").Inc()
+	if len(restart) != 0 {
+		configRestartRequired.Set(1)
+		logger.Info("Reloaded config file, some changes require a restart", "path", r.path, "flags", restart)
+		return
+	}
+	configRestartRequired.Set(0)
+	logger.Info("Reloaded config file", "path", r.path)
+}
+
+// applyPending applies loaded settings to the scraper, it must be called between scrape cycles.
+func (r *configReloader) applyPending() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+	if pending != nil {
+		pending()
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/metrics-server/pkg/filter"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// fakeSettingsTarget records settings applied to storage and the scraper.
+type fakeSettingsTarget struct {
+	historyLength  int
+	retainedPoints int
+	budgetBytes    int64
+	threshold      int
+}
+
+func (f *fakeSettingsTarget) SetHistoryLength(n int)                          { f.historyLength = n }
+func (f *fakeSettingsTarget) SetRetainedPoints(n int)                         { f.retainedPoints = n }
+func (f *fakeSettingsTarget) SetCPURateWindow(time.Duration)                  {}
+func (f *fakeSettingsTarget) SetSmoothingHalfLife(time.Duration)              {}
+func (f *fakeSettingsTarget) SetResourceNames(storage.ResourceNames)          {}
+func (f *fakeSettingsTarget) SetEvictionTTL(time.Duration)                    {}
+func (f *fakeSettingsTarget) SetSkipPolicy(bool, []corev1.Taint)              {}
+func (f *fakeSettingsTarget) SetBudget(maxBytes int64, _ time.Duration)       { f.budgetBytes = maxBytes }
+func (f *fakeSettingsTarget) SetSpread(time.Duration, time.Duration)          {}
+func (f *fakeSettingsTarget) SetAdaptiveTimeout(time.Duration, time.Duration) {}
+func (f *fakeSettingsTarget) SetCircuitBreaker(threshold, _ int)              { f.threshold = threshold }
+
+var _ = Describe("Config reloader", func() {
+	var (
+		path       string
+		target     *fakeSettingsTarget
+		namespaces *filter.DynamicNamespaces
+		reloader   *configReloader
+	)
+	// load reads settings from content like "<history length> <excluded namespace> <restart flag>".
+	load := func(content []byte) (Settings, []string, error) {
+		var (
+			settings Settings
+			excluded string
+			restart  string
+		)
+		if _, err := fmt.Sscan(string(content), &settings.MetricHistoryLength, &excluded, &restart); err != nil {
+			return Settings{}, nil, err
+		}
+		settings.ExcludeNamespaces = []string{excluded}
+		settings.ScrapeBudgetBytes = int64(settings.MetricHistoryLength) * 1000
+		settings.ScrapeFailureThreshold = settings.MetricHistoryLength
+		if restart == "-" {
+			return settings, nil, nil
+		}
+		return settings, []string{restart}, nil
+	}
+	write := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+	BeforeEach(func() {
+		dir, err := os.MkdirTemp("", "config")
+		Expect(err).NotTo(HaveOccurred())
+		path = filepath.Join(dir, "config.yaml")
+		write("1 kube-system -")
+		target = &fakeSettingsTarget{}
+		namespaces = &filter.DynamicNamespaces{}
+		applier := &settingsApplier{storage: target, scraper: target, namespaces: namespaces, resolution: time.Minute, tickInterval: time.Minute, scrapeTimeout: 10 * time.Second}
+		reloader, err = newConfigReloader(path, load, applier, testingclock.NewFakeClock(time.Now()))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(filepath.Dir(path))
+	})
+
+	It("doesn't reload unchanged content", func() {
+		reloader.check(context.Background())
+		reloader.applyPending()
+		Expect(target.historyLength).To(Equal(0))
+		Expect(target.budgetBytes).To(Equal(int64(0)))
+	})
+	It("applies storage settings right away and scraper settings between cycles", func() {
+		write("3 monitoring metric-resolution")
+		reloader.check(context.Background())
+		Expect(target.historyLength).To(Equal(3))
+		Expect(target.retainedPoints).To(Equal(storage.DefaultRetainedPoints))
+		Expect(namespaces.KeepPod("monitoring", "pod")).To(BeFalse())
+		Expect(namespaces.KeepPod("kube-system", "pod")).To(BeTrue())
+		Expect(target.budgetBytes).To(Equal(int64(0)))
+
+		reloader.applyPending()
+		Expect(target.budgetBytes).To(Equal(int64(3000)))
+		Expect(target.threshold).To(Equal(3))
+	})
+	It("keeps previous settings on invalid changes", func() {
+		write("3 monitoring -")
+		reloader.check(context.Background())
+		write("invalid")
+		reloader.check(context.Background())
+		write("4 Not_A_Namespace -")
+		reloader.check(context.Background())
+		Expect(target.historyLength).To(Equal(3))
+		Expect(namespaces.KeepPod("monitoring", "pod")).To(BeFalse())
+
+		reloader.applyPending()
+		Expect(target.budgetBytes).To(Equal(int64(3000)))
+	})
+	It("does nothing without reloader", func() {
+		var r *configReloader
+		r.applyPending()
+	})
+})
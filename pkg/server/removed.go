@@ -0,0 +1,62 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	v1listers "k8s.io/client-go/listers/core/v1"
+)
+
+// removedNodeLister lists nodes deleted from the API in addition to cached
+// nodes while their last metrics are served during a grace period, so the
+// metrics API keeps serving them.
+type removedNodeLister struct {
+	v1listers.NodeLister
+	removed func() []*corev1.Node
+}
+
+func (l removedNodeLister) List(selector labels.Selector) ([]*corev1.Node, error) {
+	nodes, err := l.NodeLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		listed[node.Name] = struct{}{}
+	}
+	for _, node := range l.removed() {
+		// A node re-registered under the same name is listed until the next scrape cycle ends its grace period.
+		if _, found := listed[node.Name]; found || !selector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (l removedNodeLister) Get(name string) (*corev1.Node, error) {
+	node, err := l.NodeLister.Get(name)
+	if !apierrors.IsNotFound(err) {
+		return node, err
+	}
+	for _, removed := range l.removed() {
+		if removed.Name == name {
+			return removed, nil
+		}
+	}
+	return nil, err
+}
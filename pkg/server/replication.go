@@ -0,0 +1,92 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/replication"
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// replicator serves storage of the leader to standbys on a dedicated port and
+// replicates storage of the leader while on standby.
+type replicator struct {
+	port      int
+	tlsConfig *tls.Config
+	publisher *replication.Publisher
+	follower  *replication.Follower
+}
+
+// newReplicator returns a replicator authenticating the leader and standbys
+// to each other with the certificates of files.
+func newReplicator(port int, store storage.Storage, files replication.TLSFiles) (*replicator, error) {
+	if err := files.Validate(); err != nil {
+		return nil, err
+	}
+	return &replicator{
+		port:      port,
+		tlsConfig: files.ServerConfig(),
+		publisher: replication.NewPublisher(store),
+		follower:  replication.NewFollower(store, files),
+	}, nil
+}
+
+// bearerToken returns a function reading the bearer token of rest, from its
+// token file if set, so rotated service account tokens are picked up.
+func bearerToken(rest *rest.Config) func() (string, error) {
+	return func() (string, error) {
+		if rest.BearerTokenFile == "" {
+			return rest.BearerToken, nil
+		}
+		token, err := os.ReadFile(rest.BearerTokenFile)
+		return strings.TrimSpace(string(token)), err
+	}
+}
+
+// run serves standbys and follows the leader until ctx is done.
+func (r *replicator) run(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	go r.follower.Run(ctx)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", r.port))
+	if err != nil {
+		logger.Error(err, "Failed to listen for storage replication", "port", r.port)
+		return
+	}
+	if err := r.publisher.Serve(ctx, listener, r.tlsConfig); err != nil {
+		logger.Error(err, "Failed to serve storage replication", "port", r.port)
+	}
+}
+
+// publish sends a stored batch to standbys, if replication is enabled.
+func (r *replicator) publish(batch *storage.MetricsBatch) {
+	if r == nil {
+		return
+	}
+	r.publisher.Publish(batch)
+}
+
+// synced returns true if storage is replicated from the leader.
+func (r *replicator) synced() bool {
+	return r != nil && r.follower.Synced()
+}
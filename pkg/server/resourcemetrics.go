@@ -0,0 +1,48 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/metrics-server/pkg/export"
+)
+
+// resourceMetricsPath serves the latest usage in the OpenMetrics text format,
+// so Prometheus can scrape metrics-server once instead of every Kubelet.
+// Access requires RBAC permission to get the non-resource URL.
+const resourceMetricsPath = "/resource-metrics"
+
+func (s *server) resourceMetrics(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var buf bytes.Buffer
+	if err := export.WriteOpenMetrics(&buf, s.storage.Snapshot()); err != nil {
+		klog.FromContext(req.Context()).Error(err, "Failed encoding resource metrics")
+		http.Error(w, "failed encoding resource metrics", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", export.OpenMetricsContentType)
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		klog.FromContext(req.Context()).V(2).Info("Failed writing resource metrics", "err", err)
+	}
+}
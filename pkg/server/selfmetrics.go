@@ -0,0 +1,39 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+// selfMetricsServer serves the self-metrics of metrics-server over plain HTTP
+// on a separate address, so cluster monitoring can scrape them without being
+// authenticated and authorized by the secure port nor TLS client certificates.
+type selfMetricsServer struct {
+	address string
+	metrics http.Handler
+}
+
+func (m *selfMetricsServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.metrics)
+	return mux
+}
+
+// run serves self-metrics until ctx is cancelled.
+func (m *selfMetricsServer) run(ctx context.Context) {
+	serveInsecure(ctx, "self-metrics", m.address, m.handler())
+}
@@ -19,24 +19,63 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 	"k8s.io/apiserver/pkg/server/healthz"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/certificate"
 	"k8s.io/component-base/metrics"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
 
+	"sigs.k8s.io/metrics-server/pkg/export"
+	"sigs.k8s.io/metrics-server/pkg/federation"
 	"sigs.k8s.io/metrics-server/pkg/scraper"
 	"sigs.k8s.io/metrics-server/pkg/storage"
+	"sigs.k8s.io/metrics-server/pkg/transform"
 	"sigs.k8s.io/metrics-server/pkg/utils"
 )
 
+// tracerName is the instrumentation scope of spans of scrape cycles.
+const tracerName = "sigs.k8s.io/metrics-server/pkg/server"
+
+const (
+	// nodesReadyzPath serves readiness of NodeMetrics.
+	nodesReadyzPath = "/readyz/nodes"
+	// podsReadyzPath serves readiness of PodMetrics.
+	podsReadyzPath = "/readyz/pods"
+	// stagesLivezPath serves liveness of pipeline stages, each also on stagesLivezPath/<check>.
+	stagesLivezPath = "/livez/stages"
+	// stagesReadyzPath serves readiness of pipeline stages, each also on stagesReadyzPath/<check>.
+	stagesReadyzPath = "/readyz/stages"
+)
+
 var (
 	// initialized below to an actual value by a call to RegisterTickDuration
 	// (acts as a no-op by default), but we can't just register it in the constructor,
 	// since it could be called multiple times during setup.
 	tickDuration = metrics.NewHistogram(&metrics.HistogramOpts{})
+
+	cyclesTotal = metrics.NewCounter(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "manager",
+			Name:      "cycles_total",
+			Help:      "Number of completed cycles of scraping and storing metrics.",
+		},
+	)
+	lastCycleTimestamp = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "manager",
+			Name:      "last_cycle_timestamp_seconds",
+			Help:      "Unix time in seconds at which the last cycle of scraping and storing metrics completed.",
+		},
+	)
 )
 
 // RegisterServerMetrics creates and registers a histogram metric for
@@ -51,7 +90,12 @@ func RegisterServerMetrics(registrationFunc func(metrics.Registerable) error, re
 			Buckets:   utils.BucketsForScrapeDuration(resolution),
 		},
 	)
-	return registrationFunc(tickDuration)
+	for _, m := range []metrics.Registerable{tickDuration, cyclesTotal, lastCycleTimestamp, triggeredCycles, pushRequests, lastPushTimestamp, freshPushedNodes, filterConfigUpdates, canaryChecks, canaryLastSuccess, checkpointWrites, checkpointRestored, nodeCoverageRatio, configReloads, configRestartRequired, kubeletCertRotations, kubeletCertRenewFailures, agentPushes, duplicateInstances, electedLeader} {
+		if err := registrationFunc(m); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func NewServer(
@@ -66,84 +110,388 @@ func NewServer(
 		storage:          storage,
 		scraper:          scraper,
 		resolution:       resolution,
+		tickInterval:     resolution,
+		clock:            clock.RealClock{},
+		tracer:           oteltrace.NewNoopTracerProvider().Tracer(tracerName),
 	}
 }
 
+// connectivityReporter reports results of the Kubelet scrapes of the last cycle.
+type connectivityReporter interface {
+	// KubeletConnectivity returns the number of Kubelets scraped and the number of those scrapes that failed.
+	KubeletConnectivity() (scraped, failed int)
+}
+
 // server scrapes metrics and serves then using k8s api.
 type server struct {
 	*genericapiserver.GenericAPIServer
 
 	pods  cache.Controller
 	nodes cache.Controller
+	// podSpecs is an optional informer of full pods
+	podSpecs cache.Controller
+	// duplicates optionally detects other instances scraping the same nodes
+	duplicates *duplicateDetector
+	// trigger optionally requests out-of-band scrape cycles on cluster events
+	trigger *scrapeTrigger
+	// filterConfig optionally watches the ConfigMap of filter rules
+	filterConfig cache.Controller
+	// canary optionally injects a synthetic pod checked to be served every cycle
+	canary *canaryPod
+	// transform optionally transforms scraped metrics before they are stored
+	transform *transform.Transformer
+	// checkpoint optionally persists storage across restarts
+	checkpoint *checkpointer
+	// exporters optionally push stored usage to external systems after every cycle
+	exporters []*export.Exporter
+	// readThrough serves usage queried from Prometheus by storage, Kubelets aren't scraped
+	readThrough bool
+	// election optionally restricts scraping to the instance holding a Lease
+	election *leaderElection
+	// replication optionally replicates storage of the elected leader to standbys
+	replication *replicator
+	// reloader optionally applies settings changed in the config file
+	reloader *configReloader
+	// coverage optionally checks the freshness of node metrics, required for readiness with a threshold
+	coverage *nodeCoverage
+	// debug optionally serves unauthenticated debug endpoints on a loopback address
+	debug *debugServer
+	// selfMetrics optionally serves self-metrics over plain HTTP on a separate address
+	selfMetrics *selfMetricsServer
+	// pushAgent optionally pushes metrics of the local node to a central aggregator
+	pushAgent *pushAgent
+	// federation optionally merges metrics of member clusters with local ones
+	federation *federation.Federator
+	// kubeletCert optionally rotates the client certificate presented to Kubelets
+	kubeletCert certificate.Manager
+	// connectivity optionally reports results of the last Kubelet scrapes
+	connectivity connectivityReporter
+	// tracer starts root spans of scrape cycles, spans of per-node scrapes are their children
+	tracer oteltrace.Tracer
+	// shutdownGracePeriod is how long stopping waits for the in-flight cycle to complete before aborting it
+	shutdownGracePeriod time.Duration
 
 	storage    storage.Storage
 	scraper    scraper.Scraper
 	resolution time.Duration
+	// tickInterval is the interval of scrape cycles, shorter than resolution if nodes set shorter scrape intervals
+	tickInterval time.Duration
+	clock        clock.WithTicker
+
+	// runMux protects stop, done and stopped, a server runs at most once
+	runMux sync.Mutex
+	// stop cancels the context the server runs with, nil until started
+	stop context.CancelFunc
+	// done is closed once the server stopped running, runErr holds the error run returned
+	done   chan struct{}
+	runErr error
+	// stopped is set by Stop, a stopped server can't be started again
+	stopped bool
+
+	// cycleMux is held while a cycle runs, so stopping can wait for it to complete
+	cycleMux sync.Mutex
+	// stopping is set once stopping, no cycle starts afterwards
+	stopping atomic.Bool
+	// background tracks goroutines run waits for before returning
+	background sync.WaitGroup
 
 	// tickStatusMux protects tick fields
 	tickStatusMux sync.RWMutex
 	// tickLastStart is equal to start time of last unfinished tick
 	tickLastStart time.Time
+	// cycle is the ID of the last completed tick, counted from 1
+	cycle uint64
+	// cycleLastEnd is the completion time of the last completed tick
+	cycleLastEnd time.Time
 }
 
-// RunUntil starts background scraping goroutine and runs apiserver serving metrics.
+// RunUntil implements MetricsServer. It fails if the server was already
+// started, as it would return without waiting for the server to stop.
 func (s *server) RunUntil(stopCh <-chan struct{}) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	done, err := s.start(ctx)
+	if err != nil {
+		return err
+	}
+	<-done
+	return s.runErr
+}
+
+// run starts background scraping goroutine and runs apiserver serving metrics.
+// Once stopCh is closed, it stops serving new requests and returns after the
+// in-flight scrape cycle completed and the last checkpoint was written.
+func (s *server) run(stopCh <-chan struct{}) error {
+	// ctx is only cancelled once the in-flight cycle completed, or the grace period expired.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if s.checkpoint != nil {
+		s.checkpoint.restore(ctx)
+	}
+
+	if s.kubeletCert != nil {
+		s.kubeletCert.Start()
+		defer s.kubeletCert.Stop()
+	}
 
 	// Start informers
 	go s.nodes.Run(stopCh)
 	go s.pods.Run(stopCh)
+	if s.podSpecs != nil {
+		go s.podSpecs.Run(stopCh)
+	}
+	if s.filterConfig != nil {
+		go s.filterConfig.Run(stopCh)
+	}
 
-	// Ensure cache is up to date
+	// Ensure node cache is up to date. Pod caches are not waited for, so
+	// failing to list pods doesn't prevent serving node metrics. PodMetrics
+	// are unavailable until they sync.
 	ok := cache.WaitForCacheSync(stopCh, s.nodes.HasSynced)
 	if !ok {
 		return nil
 	}
-	ok = cache.WaitForCacheSync(stopCh, s.pods.HasSynced)
-	if !ok {
+
+	if s.replication != nil {
+		go s.replication.run(ctx)
+	}
+	if s.federation != nil {
+		go s.federation.Run(ctx)
+	}
+	// Start serving API and scrape loop
+	switch {
+	case s.readThrough:
+	case s.election != nil:
+		go s.election.run(ctx, s.runLeader)
+	default:
+		go s.runScrape(ctx)
+		if s.duplicates != nil {
+			go s.duplicates.run(ctx)
+		}
+	}
+	if s.checkpoint != nil {
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			s.checkpoint.run(ctx)
+		}()
+	}
+	if s.reloader != nil {
+		go s.reloader.run(ctx)
+	}
+	if s.pushAgent != nil {
+		go s.pushAgent.run(ctx)
+	}
+	if s.debug != nil {
+		go s.debug.run(ctx)
+	}
+	if s.selfMetrics != nil {
+		go s.selfMetrics.run(ctx)
+	}
+	for _, e := range s.exporters {
+		go e.Run(ctx)
+	}
+	drained := make(chan struct{})
+	go func() {
+		select {
+		case <-stopCh:
+		case <-ctx.Done():
+		}
+		s.drain(ctx, cancel)
+		close(drained)
+	}()
+	err := s.GenericAPIServer.PrepareRun().Run(stopCh)
+	if err != nil {
+		cancel()
+	}
+	<-drained
+	s.background.Wait()
+	return err
+}
+
+// drain stops starting scrape cycles and waits up to shutdownGracePeriod for
+// the in-flight cycle to complete, so storage and the last checkpoint don't
+// miss part of it, before cancelling background loops with stop.
+func (s *server) drain(ctx context.Context, stop context.CancelFunc) {
+	logger := klog.FromContext(ctx)
+	s.stopping.Store(true)
+	completed := make(chan struct{})
+	go func() {
+		s.cycleMux.Lock()
+		defer s.cycleMux.Unlock()
+		close(completed)
+	}()
+	select {
+	case <-completed:
+	default:
+		logger.Info("Waiting for the in-flight scrape cycle to complete", "gracePeriod", s.shutdownGracePeriod)
+		select {
+		case <-completed:
+		case <-s.clock.After(s.shutdownGracePeriod):
+			logger.Info("Aborting the in-flight scrape cycle, grace period expired", "gracePeriod", s.shutdownGracePeriod)
+		}
+	}
+	stop()
+	<-completed
+}
+
+var errAlreadyStarted = fmt.Errorf("metrics-server already started")
+
+// Start implements MetricsServer. Starting a running server is a no-op.
+func (s *server) Start(ctx context.Context) error {
+	_, err := s.start(ctx)
+	if err == errAlreadyStarted {
 		return nil
 	}
+	return err
+}
 
-	// Start serving API and scrape loop
-	go s.runScrape(ctx)
-	return s.GenericAPIServer.PrepareRun().Run(stopCh)
+// start runs the server in the background until ctx is cancelled or Stop is
+// called, and returns a channel closed once it stopped running.
+func (s *server) start(ctx context.Context) (<-chan struct{}, error) {
+	s.runMux.Lock()
+	defer s.runMux.Unlock()
+	if s.stopped {
+		return nil, fmt.Errorf("metrics-server was stopped and can't be started again")
+	}
+	if s.done != nil {
+		return nil, errAlreadyStarted
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.runErr = s.run(ctx.Done())
+	}()
+	s.stop = cancel
+	s.done = done
+	return done, nil
+}
+
+// Stop implements MetricsServer. Stopping a stopped server returns the same
+// error again, stopping a server that was never started prevents starting it.
+func (s *server) Stop() error {
+	s.runMux.Lock()
+	defer s.runMux.Unlock()
+	s.stopped = true
+	if s.done == nil {
+		return nil
+	}
+	s.stop()
+	<-s.done
+	return s.runErr
+}
+
+// runLeader scrapes until leadership is lost. Duplicate detection runs only
+// while leading, as standby instances don't scrape.
+func (s *server) runLeader(ctx context.Context) {
+	if s.duplicates != nil {
+		go s.duplicates.run(ctx)
+	}
+	s.runScrape(ctx)
 }
 
 func (s *server) runScrape(ctx context.Context) {
-	ticker := time.NewTicker(s.resolution)
+	ticker := s.clock.NewTicker(s.tickInterval)
 	defer ticker.Stop()
-	s.tick(ctx, time.Now())
+	s.runCycle(ctx, s.clock.Now())
 
+	// delayed fires when an out-of-band cycle requested by the trigger is due, nil if none is requested.
+	var delayed <-chan time.Time
 	for {
 		select {
-		case startTime := <-ticker.C:
-			s.tick(ctx, startTime)
+		case startTime := <-ticker.C():
+			s.runCycle(ctx, startTime)
+		case <-s.trigger.requested():
+			if delayed == nil {
+				delayed = s.clock.After(s.trigger.delay)
+			}
+		case startTime := <-delayed:
+			delayed = nil
+			if reason := s.trigger.pending(); reason != "" {
+				triggeredCycles.WithLabelValues(reason).Inc()
+				s.runCycle(ctx, startTime)
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// runCycle runs a scrape cycle unless stopping.
+func (s *server) runCycle(ctx context.Context, startTime time.Time) {
+	s.cycleMux.Lock()
+	defer s.cycleMux.Unlock()
+	if s.stopping.Load() {
+		return
+	}
+	s.tick(ctx, startTime)
+}
+
 func (s *server) tick(ctx context.Context, startTime time.Time) {
 	s.tickStatusMux.Lock()
 	s.tickLastStart = startTime
+	// Cycles run one at a time, so the ID of this one is known up front.
+	cycle := s.cycle + 1
 	s.tickStatusMux.Unlock()
+	logger := klog.LoggerWithValues(klog.FromContext(ctx), "cycle", cycle)
+	ctx = klog.NewContext(ctx, logger)
 
-	ctx, cancelTimeout := context.WithTimeout(ctx, s.resolution)
+	ctx, cancelTimeout := context.WithTimeout(ctx, s.tickInterval)
 	defer cancelTimeout()
+	ctx, span := s.tracer.Start(ctx, "Scrape cycle", oteltrace.WithTimestamp(startTime))
+	defer span.End()
 
-	klog.V(6).InfoS("Scraping metrics")
+	s.reloader.applyPending()
+	s.trigger.cycleStarted()
+	logger.V(6).Info("Scraping metrics")
 	data := s.scraper.Scrape(ctx)
+	s.canary.inject(logger, data, startTime)
+	if s.transform != nil {
+		data = s.transform.Apply(data)
+	}
+	span.AddEvent("Scraped metrics", oteltrace.WithAttributes(attribute.Int("nodes", len(data.Nodes)), attribute.Int("pods", len(data.Pods))))
 
-	klog.V(6).InfoS("Storing metrics")
+	logger.V(6).Info("Storing metrics")
 	s.storage.Store(data)
+	span.AddEvent("Stored metrics")
+	s.replication.publish(data)
+	s.pushAgent.enqueue(data)
+	s.canary.verify(logger, s.storage)
+	if len(s.exporters) != 0 {
+		snapshot := s.storage.Snapshot()
+		for _, e := range s.exporters {
+			e.Export(snapshot)
+		}
+	}
 
-	collectTime := time.Since(startTime)
-	tickDuration.Observe(float64(collectTime) / float64(time.Second))
-	klog.V(6).InfoS("Scraping cycle complete")
+	endTime := s.clock.Now()
+	collectTime := endTime.Sub(startTime)
+	utils.ObserveWithTrace(ctx, tickDuration.ObserverMetric, float64(collectTime)/float64(time.Second))
+
+	s.tickStatusMux.Lock()
+	s.cycle = cycle
+	s.cycleLastEnd = endTime
+	s.tickStatusMux.Unlock()
+	cyclesTotal.Inc()
+	lastCycleTimestamp.Set(float64(endTime.UnixNano()) / float64(time.Second))
+	span.SetAttributes(attribute.Int64("cycle", int64(cycle)))
+	logger.V(6).Info("Scraping cycle complete")
 }
 
+// RegisterProbes registers health checks. Readiness only depends on serving
+// node metrics, pod checks are served separately on podsReadyzPath so an
+// issue listing pods doesn't take down node metrics. Checks of each stage of
+// the metrics pipeline are served separately on stagesLivezPath and
+// stagesReadyzPath, so probes can be wired to and debug individual stages.
 func (s *server) RegisterProbes(waiter cacheSyncWaiter) error {
 	err := s.AddReadyzChecks(s.probeMetricStorageReady("metric-storage-ready"))
 	if err != nil {
@@ -157,26 +505,55 @@ func (s *server) RegisterProbes(waiter cacheSyncWaiter) error {
 	if err != nil {
 		return err
 	}
-	err = s.AddHealthChecks(MetadataInformerSyncHealthz("metadata-informer-sync", waiter))
-	if err != nil {
-		return err
+	if s.election != nil {
+		err = s.AddReadyzChecks(healthz.NamedCheck("leader-election", func(_ *http.Request) error {
+			// Standbys replicating storage of the leader serve the same metrics.
+			if s.replication.synced() {
+				return nil
+			}
+			return s.election.check()
+		}))
+		if err != nil {
+			return err
+		}
 	}
+	healthz.InstallPathHandler(s.Handler.NonGoRestfulMux, nodesReadyzPath,
+		s.probeMetricCacheHasSynced("node-informer-sync"),
+		s.probeStorageReady("node-metric-storage-ready", s.storage.NodesReady),
+	)
+	healthz.InstallPathHandler(s.Handler.NonGoRestfulMux, podsReadyzPath,
+		s.probePodCacheHasSynced("pod-informer-sync"),
+		MetadataInformerSyncHealthz("metadata-informer-sync", waiter),
+		s.probeStorageReady("pod-metric-storage-ready", s.storage.PodsReady),
+	)
+	healthz.InstallPathHandler(s.Handler.NonGoRestfulMux, stagesLivezPath,
+		s.probeMetricCollectionTimely("scrape-loop-alive"),
+	)
+	healthz.InstallPathHandler(s.Handler.NonGoRestfulMux, stagesReadyzPath,
+		s.probeInformersSynced("informer-synced"),
+		s.probeStorageFresh("storage-fresh"),
+		s.probeKubeletConnectivity("kubelet-connectivity"),
+	)
 	return nil
 }
 
 // Check if MS is alive by looking at last tick time.
 // If its deadlock or panic, tick wouldn't be happening on the tick interval
 func (s *server) probeMetricCollectionTimely(name string) healthz.HealthChecker {
-	return healthz.NamedCheck(name, func(_ *http.Request) error {
+	return healthz.NamedCheck(name, func(r *http.Request) error {
+		// Standby instances don't scrape.
+		if !s.election.isLeader() {
+			return nil
+		}
 		s.tickStatusMux.RLock()
 		tickLastStart := s.tickLastStart
 		s.tickStatusMux.RUnlock()
 
-		maxTickWait := time.Duration(1.5 * float64(s.resolution))
-		tickWait := time.Since(tickLastStart)
+		maxTickWait := time.Duration(1.5 * float64(s.tickInterval))
+		tickWait := s.clock.Since(tickLastStart)
 		if !tickLastStart.IsZero() && tickWait > maxTickWait {
 			err := fmt.Errorf("metric collection didn't finish on time")
-			klog.InfoS("Failed probe", "probe", name, "err", err, "duration", tickWait, "maxDuration", maxTickWait)
+			klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err, "duration", tickWait, "maxDuration", maxTickWait)
 			return err
 		}
 		return nil
@@ -186,28 +563,106 @@ func (s *server) probeMetricCollectionTimely(name string) healthz.HealthChecker
 // Check if MS is ready by checking if last tick was ok
 func (s *server) probeMetricStorageReady(name string) healthz.HealthChecker {
 	return healthz.NamedCheck(name, func(r *http.Request) error {
+		if s.coverage != nil && s.coverage.threshold > 0 {
+			err := s.coverage.check()
+			if err != nil {
+				klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err)
+			}
+			return err
+		}
 		if !s.storage.Ready() {
 			err := fmt.Errorf("no metrics to serve")
-			klog.InfoS("Failed probe", "probe", name, "err", err)
+			klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// Check if MS is ready by checking if a resource has metrics to serve
+func (s *server) probeStorageReady(name string, ready func() bool) healthz.HealthChecker {
+	return healthz.NamedCheck(name, func(r *http.Request) error {
+		if !ready() {
+			err := fmt.Errorf("no metrics to serve")
+			klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err)
 			return err
 		}
 		return nil
 	})
 }
 
-// Check if MS is ready by checking if cache has synced
+// Check if MS is ready by checking if node cache has synced
 func (s *server) probeMetricCacheHasSynced(name string) healthz.HealthChecker {
 	return healthz.NamedCheck(name, func(r *http.Request) error {
 		if !s.nodes.HasSynced() {
 			err := fmt.Errorf("cache for node informer has not synced")
-			klog.InfoS("Failed probe", "probe", name, "err", err)
+			klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err)
 			return err
 		}
+		return nil
+	})
+}
+
+// Check if MS can serve pod metrics by checking if pod caches have synced
+func (s *server) probePodCacheHasSynced(name string) healthz.HealthChecker {
+	return healthz.NamedCheck(name, func(r *http.Request) error {
 		if !s.pods.HasSynced() {
 			err := fmt.Errorf("cache for pod informer has not synced")
-			klog.InfoS("Failed probe", "probe", name, "err", err)
+			klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err)
+			return err
+		}
+		if s.podSpecs != nil && !s.podSpecs.HasSynced() {
+			err := fmt.Errorf("cache for pod spec informer has not synced")
+			klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err)
 			return err
 		}
 		return nil
 	})
 }
+
+// Check if MS has listed nodes and pods by checking if all informer caches have synced
+func (s *server) probeInformersSynced(name string) healthz.HealthChecker {
+	nodes, pods := s.probeMetricCacheHasSynced(name), s.probePodCacheHasSynced(name)
+	return healthz.NamedCheck(name, func(r *http.Request) error {
+		if err := nodes.Check(r); err != nil {
+			return err
+		}
+		return pods.Check(r)
+	})
+}
+
+// Check if MS serves fresh metrics by checking the age of stored node metrics
+func (s *server) probeStorageFresh(name string) healthz.HealthChecker {
+	return healthz.NamedCheck(name, func(r *http.Request) error {
+		if s.coverage == nil {
+			return s.probeMetricStorageReady(name).Check(r)
+		}
+		err := s.coverage.check()
+		if err != nil {
+			klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err)
+		}
+		return err
+	})
+}
+
+// Check if MS can reach Kubelets by checking if any scrape of the last cycle succeeded
+func (s *server) probeKubeletConnectivity(name string) healthz.HealthChecker {
+	return healthz.NamedCheck(name, func(r *http.Request) error {
+		// Standby instances don't scrape.
+		if s.connectivity == nil || !s.election.isLeader() {
+			return nil
+		}
+		scraped, failed := s.connectivity.KubeletConnectivity()
+		if scraped != 0 && failed == scraped {
+			err := fmt.Errorf("all %d Kubelet scrapes of the last cycle failed", scraped)
+			klog.FromContext(r.Context()).Info("Failed probe", "probe", name, "err", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// podsSynced returns true if caches of pods have synced.
+func (s *server) podsSynced() bool {
+	return s.pods.HasSynced() && (s.podSpecs == nil || s.podSpecs.HasSynced())
+}
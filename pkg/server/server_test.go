@@ -16,7 +16,10 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -25,7 +28,9 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/metrics/pkg/apis/metrics"
+	testingclock "k8s.io/utils/clock/testing"
 
 	"sigs.k8s.io/metrics-server/pkg/scraper"
 	"sigs.k8s.io/metrics-server/pkg/storage"
@@ -36,6 +41,11 @@ func TestServer(t *testing.T) {
 	RunSpecs(t, "Server Suite")
 }
 
+// probeRequest returns a request to call health checks with, which log with its context.
+func probeRequest() *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/readyz", nil)
+}
+
 var _ = Describe("Server", func() {
 	var (
 		resolution time.Duration
@@ -63,32 +73,163 @@ var _ = Describe("Server", func() {
 
 	It("metric-collection-timely probe should pass before first scrape tick finishes", func() {
 		check := server.probeMetricCollectionTimely("")
-		Expect(check.Check(nil)).To(Succeed())
+		Expect(check.Check(probeRequest())).To(Succeed())
 	})
 	It("metric-collection-timely probe should pass if scrape fails", func() {
 		scraper.err = fmt.Errorf("failed to scrape")
 		server.tick(context.Background(), time.Now())
 		check := server.probeMetricCollectionTimely("")
-		Expect(check.Check(nil)).To(Succeed())
+		Expect(check.Check(probeRequest())).To(Succeed())
 	})
 	It("metric-collection-timely probe should pass if scrape succeeds", func() {
 		server.tick(context.Background(), time.Now().Add(-resolution))
 		check := server.probeMetricCollectionTimely("")
-		Expect(check.Check(nil)).To(Succeed())
+		Expect(check.Check(probeRequest())).To(Succeed())
 	})
 	It("metric-collection-timely probe should fail if last scrape took longer than expected", func() {
 		server.tick(context.Background(), time.Now().Add(-2*resolution))
 		check := server.probeMetricCollectionTimely("")
-		Expect(check.Check(nil)).NotTo(Succeed())
+		Expect(check.Check(probeRequest())).NotTo(Succeed())
+	})
+	It("metric-collection-timely probe should use injected clock", func() {
+		now := time.Now()
+		fakeClock := testingclock.NewFakeClock(now)
+		server.clock = fakeClock
+		server.tick(context.Background(), now)
+		check := server.probeMetricCollectionTimely("")
+		Expect(check.Check(probeRequest())).To(Succeed())
+		fakeClock.Step(2 * resolution)
+		Expect(check.Check(probeRequest())).NotTo(Succeed())
+	})
+	It("should count completed cycles and serve them on statusz", func() {
+		now := time.Now()
+		fakeClock := testingclock.NewFakeClock(now)
+		server.clock = fakeClock
+		Expect(server.status()).To(Equal(status{Resolution: "1m0s"}))
+
+		server.tick(context.Background(), now)
+		fakeClock.Step(resolution)
+		server.tick(context.Background(), fakeClock.Now())
+
+		rec := httptest.NewRecorder()
+		server.statusz(rec, httptest.NewRequest(http.MethodGet, statuszPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		got := status{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+		Expect(got.Cycle).To(BeEquivalentTo(2))
+		Expect(got.LastCycleCompletionTime.Equal(fakeClock.Now())).To(BeTrue())
+		Expect(got.LastCycleStartTime.Equal(fakeClock.Now())).To(BeTrue())
+	})
+	It("should serve resource metrics in the OpenMetrics format", func() {
+		rec := httptest.NewRecorder()
+		server.resourceMetrics(rec, httptest.NewRequest(http.MethodGet, resourceMetricsPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(HavePrefix("application/openmetrics-text"))
+		Expect(rec.Body.String()).To(HaveSuffix("# EOF\n"))
+
+		rec = httptest.NewRecorder()
+		server.resourceMetrics(rec, httptest.NewRequest(http.MethodPost, resourceMetricsPath, nil))
+		Expect(rec.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+	It("stop should be a no-op if server was not started", func() {
+		Expect(server.Stop()).To(Succeed())
+		Expect(server.Stop()).To(Succeed())
+	})
+	It("start should fail once server was stopped", func() {
+		Expect(server.Stop()).To(Succeed())
+		Expect(server.Start(context.Background())).NotTo(Succeed())
+		Expect(server.RunUntil(make(chan struct{}))).NotTo(Succeed())
 	})
 	It("metric-storage-ready probe should fail if store is not ready", func() {
 		check := server.probeMetricStorageReady("")
-		Expect(check.Check(nil)).NotTo(Succeed())
+		Expect(check.Check(probeRequest())).NotTo(Succeed())
 	})
 	It("metric-storage-ready probe should pass if store is ready", func() {
 		store.ready = true
 		check := server.probeMetricStorageReady("")
-		Expect(check.Check(nil)).To(Succeed())
+		Expect(check.Check(probeRequest())).To(Succeed())
+	})
+	It("informer sync probes should check node and pod informers independently", func() {
+		nodes := &controllerMock{synced: true}
+		pods := &controllerMock{}
+		server = NewServer(nodes, pods, nil, store, scraper, resolution)
+		Expect(server.probeMetricCacheHasSynced("").Check(probeRequest())).To(Succeed())
+		Expect(server.probePodCacheHasSynced("").Check(probeRequest())).NotTo(Succeed())
+		Expect(server.podsSynced()).To(BeFalse())
+
+		pods.synced = true
+		Expect(server.probePodCacheHasSynced("").Check(probeRequest())).To(Succeed())
+		Expect(server.podsSynced()).To(BeTrue())
+	})
+	It("kubelet-connectivity probe should fail only if all scrapes of the last cycle failed", func() {
+		connectivity := &connectivityMock{}
+		server.connectivity = connectivity
+		check := server.probeKubeletConnectivity("")
+		Expect(check.Check(probeRequest())).To(Succeed())
+
+		connectivity.scraped, connectivity.failed = 3, 2
+		Expect(check.Check(probeRequest())).To(Succeed())
+
+		connectivity.failed = 3
+		Expect(check.Check(probeRequest())).NotTo(Succeed())
+	})
+	It("informer-synced probe should check node and pod informers", func() {
+		nodes := &controllerMock{synced: true}
+		pods := &controllerMock{}
+		server = NewServer(nodes, pods, nil, store, scraper, resolution)
+		Expect(server.probeInformersSynced("").Check(probeRequest())).NotTo(Succeed())
+
+		pods.synced = true
+		Expect(server.probeInformersSynced("").Check(probeRequest())).To(Succeed())
+	})
+	It("stopping should wait for the in-flight cycle to complete and start no new cycle", func() {
+		blocking := newBlockingScraperMock(scraper)
+		server.scraper = blocking
+		server.shutdownGracePeriod = time.Minute
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go server.runCycle(ctx, time.Now())
+		Eventually(blocking.started).Should(Receive())
+		drained := make(chan struct{})
+		go func() {
+			server.drain(context.Background(), cancel)
+			close(drained)
+		}()
+		Consistently(drained, 100*time.Millisecond).ShouldNot(BeClosed())
+		Expect(ctx.Err()).NotTo(HaveOccurred())
+
+		close(blocking.release)
+		Eventually(drained).Should(BeClosed())
+		Expect(ctx.Err()).To(HaveOccurred())
+		Expect(server.status().Cycle).To(BeEquivalentTo(1))
+
+		server.runCycle(ctx, time.Now())
+		Expect(blocking.started).NotTo(Receive())
+		Expect(server.status().Cycle).To(BeEquivalentTo(1))
+	})
+	It("stopping should abort the in-flight cycle once the grace period expired", func() {
+		fakeClock := testingclock.NewFakeClock(time.Now())
+		server.clock = fakeClock
+		blocking := newBlockingScraperMock(scraper)
+		server.scraper = blocking
+		server.shutdownGracePeriod = 10 * time.Second
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go server.runCycle(ctx, fakeClock.Now())
+		Eventually(blocking.started).Should(Receive())
+		drained := make(chan struct{})
+		go func() {
+			server.drain(context.Background(), cancel)
+			close(drained)
+		}()
+		Eventually(fakeClock.HasWaiters).Should(BeTrue())
+		Expect(ctx.Err()).NotTo(HaveOccurred())
+
+		fakeClock.Step(10 * time.Second)
+		Eventually(drained).Should(BeClosed())
+		Expect(ctx.Err()).To(HaveOccurred())
 	})
 })
 
@@ -103,6 +244,34 @@ func (s *scraperMock) Scrape(ctx context.Context) *storage.MetricsBatch {
 	return s.result
 }
 
+// blockingScraperMock blocks scrapes until release is closed or their context is cancelled.
+type blockingScraperMock struct {
+	*scraperMock
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingScraperMock(s *scraperMock) *blockingScraperMock {
+	return &blockingScraperMock{scraperMock: s, started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (s *blockingScraperMock) Scrape(ctx context.Context) *storage.MetricsBatch {
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+	}
+	return s.result
+}
+
+type connectivityMock struct {
+	scraped, failed int
+}
+
+func (c *connectivityMock) KubeletConnectivity() (scraped, failed int) {
+	return c.scraped, c.failed
+}
+
 type storageMock struct {
 	ready bool
 }
@@ -119,6 +288,44 @@ func (s *storageMock) GetNodeMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetri
 	return nil, nil
 }
 
+func (s *storageMock) GetPodMetricsHistory(pod *metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+	return nil, nil
+}
+
+func (s *storageMock) GetNodeMetricsHistory(node *corev1.Node) ([]metrics.NodeMetrics, error) {
+	return nil, nil
+}
+
 func (s *storageMock) Ready() bool {
 	return s.ready
 }
+
+func (s *storageMock) NodesReady() bool {
+	return s.ready
+}
+
+func (s *storageMock) PodsReady() bool {
+	return s.ready
+}
+
+func (s *storageMock) Snapshot() storage.Snapshot {
+	return storage.Snapshot{}
+}
+
+func (s *storageMock) Restore(snapshot storage.Snapshot) {}
+
+type controllerMock struct {
+	synced bool
+}
+
+var _ cache.Controller = (*controllerMock)(nil)
+
+func (c *controllerMock) Run(stopCh <-chan struct{}) {}
+
+func (c *controllerMock) HasSynced() bool {
+	return c.synced
+}
+
+func (c *controllerMock) LastSyncResourceVersion() string {
+	return ""
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const statuszPath = "/statusz"
+
+// status is served on statuszPath. Cycle not increasing between requests
+// spaced more than a resolution apart means the metrics pipeline is stuck.
+type status struct {
+	// Cycle is the ID of the last completed scrape cycle, 0 before the first one completes.
+	Cycle uint64 `json:"cycle"`
+	// LastCycleCompletionTime is when the last scrape cycle completed.
+	LastCycleCompletionTime *time.Time `json:"lastCycleCompletionTime,omitempty"`
+	// LastCycleStartTime is when the last, possibly unfinished, scrape cycle started.
+	LastCycleStartTime *time.Time `json:"lastCycleStartTime,omitempty"`
+	// Resolution is the interval between scrape cycles.
+	Resolution string `json:"resolution"`
+}
+
+func (s *server) status() status {
+	s.tickStatusMux.RLock()
+	defer s.tickStatusMux.RUnlock()
+	res := status{
+		Cycle:      s.cycle,
+		Resolution: s.resolution.String(),
+	}
+	if !s.cycleLastEnd.IsZero() {
+		end := s.cycleLastEnd
+		res.LastCycleCompletionTime = &end
+	}
+	if !s.tickLastStart.IsZero() {
+		start := s.tickLastStart
+		res.LastCycleStartTime = &start
+	}
+	return res
+}
+
+func (s *server) statusz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(s.status()); err != nil {
+		klog.FromContext(r.Context()).Error(err, "Failed writing status")
+	}
+}
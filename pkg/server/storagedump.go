@@ -0,0 +1,60 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+// storageDumpPath serves the raw points stored for a node or a pod, e.g. to
+// find out why usage served for them is zero or missing. Requests are
+// authenticated and authorized like other non-resource requests.
+const storageDumpPath = "/debug/storage"
+
+func (s *server) storageDump(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	node, namespace, pod := query.Get("node"), query.Get("namespace"), query.Get("pod")
+	snapshot := s.storage.Snapshot()
+	var (
+		dump  interface{}
+		found bool
+	)
+	switch {
+	case node != "" && pod == "":
+		dump, found = snapshot.DumpNode(node)
+	case node == "" && namespace != "" && pod != "":
+		dump, found = snapshot.DumpPod(namespace, pod)
+	default:
+		http.Error(w, "either the node, or the namespace and pod query parameters should be set", http.StatusBadRequest)
+		return
+	}
+	if !found {
+		http.Error(w, "no points stored", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(dump); err != nil {
+		klog.FromContext(req.Context()).Error(err, "Failed writing storage dump")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var _ = Describe("Storage dump", func() {
+	var s *server
+
+	BeforeEach(func() {
+		store := storage.NewStorage(time.Minute)
+		start := time.Now().Add(-time.Hour)
+		for i := 1; i <= 2; i++ {
+			timestamp := start.Add(time.Duration(i) * time.Minute)
+			point := storage.MetricsPoint{StartTime: start, Timestamp: timestamp, CumulativeCpuUsed: uint64(i) * 1e9, MemoryUsage: 1000}
+			store.Store(&storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{"node1": point},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "ns1", Name: "pod1"}: {Containers: map[string]storage.MetricsPoint{"app": point}},
+				},
+			})
+		}
+		s = NewServer(nil, nil, nil, store, &scraperMock{}, time.Minute)
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.storageDump(rec, httptest.NewRequest(http.MethodGet, storageDumpPath+query, nil))
+		return rec
+	}
+
+	It("should dump points of a node", func() {
+		rec := get("?node=node1")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		got := storage.NodeDump{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+		Expect(got.Name).To(Equal("node1"))
+		Expect(got.Last.CumulativeCpuUsed).To(BeEquivalentTo(2e9))
+		Expect(got.Prev.CumulativeCpuUsed).To(BeEquivalentTo(1e9))
+		Expect(got.Window).To(Equal("1m0s"))
+	})
+	It("should dump points of a pod", func() {
+		rec := get("?namespace=ns1&pod=pod1")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		got := storage.PodDump{}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &got)).To(Succeed())
+		Expect(got.Containers).To(HaveKey("app"))
+		Expect(got.Reason).To(BeEmpty())
+	})
+	It("should reject requests without a node or pod", func() {
+		Expect(get("").Code).To(Equal(http.StatusBadRequest))
+		Expect(get("?pod=pod1").Code).To(Equal(http.StatusBadRequest))
+	})
+	It("should return not found for nodes without points", func() {
+		Expect(get("?node=node2").Code).To(Equal(http.StatusNotFound))
+	})
+})
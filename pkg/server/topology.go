@@ -0,0 +1,50 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// localTopologyDomain is the topology domain of the node metrics-server runs on.
+const localTopologyDomain = "local"
+
+// topologyRequirement returns the node label requirement selecting nodes of
+// domain, resolving localTopologyDomain from the labels of nodeName.
+func topologyRequirement(logger klog.Logger, client kubernetes.Interface, label, domain, nodeName string) (*labels.Requirement, error) {
+	if domain == localTopologyDomain {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		node, err := client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get topology domain of local node %q: %w", nodeName, err)
+		}
+		value, found := node.Labels[label]
+		if !found {
+			return nil, fmt.Errorf("local node %q has no %s label", nodeName, label)
+		}
+		domain = value
+	}
+	logger.Info("Scraping nodes of a single topology domain", "label", label, "domain", domain)
+	return labels.NewRequirement(label, selection.Equals, []string{domain})
+}
@@ -0,0 +1,54 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2"
+)
+
+var _ = Describe("Topology domain", func() {
+	zoneA := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{corev1.LabelTopologyZone: "zone-a"}}}
+	zoneB := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{corev1.LabelTopologyZone: "zone-b"}}}
+	unlabeled := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-c"}}
+	matches := func(requirement *labels.Requirement, node *corev1.Node) bool {
+		return labels.NewSelector().Add(*requirement).Matches(labels.Set(node.Labels))
+	}
+
+	It("should select nodes of the given domain", func() {
+		requirement, err := topologyRequirement(klog.Background(), fake.NewSimpleClientset(), corev1.LabelTopologyZone, "zone-b", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matches(requirement, zoneA)).To(BeFalse())
+		Expect(matches(requirement, zoneB)).To(BeTrue())
+	})
+	It("should select nodes of the domain of the local node", func() {
+		requirement, err := topologyRequirement(klog.Background(), fake.NewSimpleClientset(zoneA, zoneB), corev1.LabelTopologyZone, localTopologyDomain, "node-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(matches(requirement, zoneA)).To(BeTrue())
+		Expect(matches(requirement, zoneB)).To(BeFalse())
+	})
+	It("should fail if the local node has no domain", func() {
+		_, err := topologyRequirement(klog.Background(), fake.NewSimpleClientset(unlabeled), corev1.LabelTopologyZone, localTopologyDomain, "node-c")
+		Expect(err).To(HaveOccurred())
+		_, err = topologyRequirement(klog.Background(), fake.NewSimpleClientset(), corev1.LabelTopologyZone, localTopologyDomain, "node-c")
+		Expect(err).To(HaveOccurred())
+	})
+})
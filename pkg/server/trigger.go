@@ -0,0 +1,161 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	triggerNodeAdded = "node_added"
+	triggerPodBurst  = "pod_burst"
+)
+
+var triggeredCycles = metrics.NewCounterVec(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "manager",
+		Name:      "triggered_cycles_total",
+		Help:      "Number of out-of-band scrape cycles triggered by cluster events, per reason of the first event.",
+	},
+	[]string{"reason"},
+)
+
+// scrapeTrigger requests out-of-band scrape cycles when a node registers or
+// a burst of pods starts on a node, so autoscalers get metrics of fresh
+// workloads within seconds instead of up to a metric resolution. Events are
+// batched for delay, so at most one cycle is triggered per delay.
+type scrapeTrigger struct {
+	delay time.Duration
+	// burstThreshold is the number of pods starting on a node between cycles that triggers a scrape, 0 disables it.
+	burstThreshold int
+	// force makes nodes due in the next cycle regardless of their scrape interval.
+	force func(nodes ...string)
+	// requests receives a value when the first event of a batch is observed.
+	requests chan struct{}
+	logger   klog.Logger
+
+	mu sync.Mutex
+	// reason is the reason of the first event of the pending batch, empty if none is pending.
+	reason string
+	// nodes to scrape in the next triggered cycle.
+	nodes map[string]struct{}
+	// started counts pods started per node since the last cycle.
+	started map[string]int
+}
+
+func newScrapeTrigger(logger klog.Logger, delay time.Duration, burstThreshold int, force func(nodes ...string)) *scrapeTrigger {
+	return &scrapeTrigger{
+		logger:         logger,
+		delay:          delay,
+		burstThreshold: burstThreshold,
+		force:          force,
+		requests:       make(chan struct{}, 1),
+		nodes:          map[string]struct{}{},
+		started:        map[string]int{},
+	}
+}
+
+// requested returns a channel receiving a value when a triggered cycle should be scheduled.
+func (t *scrapeTrigger) requested() <-chan struct{} {
+	if t == nil {
+		return nil
+	}
+	return t.requests
+}
+
+// nodeHandler triggers a scrape of nodes registered after the initial list.
+func (t *scrapeTrigger) nodeHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			node, ok := obj.(*corev1.Node)
+			if !ok || isInInitialList {
+				return
+			}
+			t.request(node.Name, triggerNodeAdded)
+		},
+	}
+}
+
+// podHandler triggers a scrape of nodes on which burstThreshold pods started since the last cycle.
+func (t *scrapeTrigger) podHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			pod, ok := obj.(*corev1.Pod)
+			if !ok || isInInitialList || pod.Spec.NodeName == "" {
+				return
+			}
+			t.mu.Lock()
+			t.started[pod.Spec.NodeName]++
+			burst := t.started[pod.Spec.NodeName] == t.burstThreshold
+			t.mu.Unlock()
+			if burst {
+				t.request(pod.Spec.NodeName, triggerPodBurst)
+			}
+		},
+	}
+}
+
+func (t *scrapeTrigger) request(node, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logger.V(2).Info("Requesting out-of-band scrape", "node", klog.KRef("", node), "reason", reason)
+	t.nodes[node] = struct{}{}
+	if t.reason != "" {
+		return
+	}
+	t.reason = reason
+	select {
+	case t.requests <- struct{}{}:
+	default:
+	}
+}
+
+// cycleStarted forces a scrape of nodes requested since the last cycle and
+// resets burst detection. It returns the reason of the first request, empty
+// if none is pending.
+func (t *scrapeTrigger) cycleStarted() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	reason := t.reason
+	nodes := make([]string, 0, len(t.nodes))
+	for node := range t.nodes {
+		nodes = append(nodes, node)
+	}
+	t.reason = ""
+	t.nodes = map[string]struct{}{}
+	t.started = map[string]int{}
+	t.mu.Unlock()
+	if len(nodes) != 0 {
+		t.force(nodes...)
+	}
+	return reason
+}
+
+// pending returns the reason of the first event requesting a cycle, empty if
+// no cycle is requested, e.g. because a regular cycle already ran.
+func (t *scrapeTrigger) pending() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.reason
+}
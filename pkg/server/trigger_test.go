@@ -0,0 +1,109 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+var _ = Describe("Scrape trigger", func() {
+	var (
+		trigger *scrapeTrigger
+		forced  []string
+	)
+
+	BeforeEach(func() {
+		forced = nil
+		trigger = newScrapeTrigger(klog.Background(), 5*time.Second, 3, func(nodes ...string) {
+			forced = append(forced, nodes...)
+		})
+	})
+
+	addNode := func(name string, isInInitialList bool) {
+		handler := trigger.nodeHandler().(cache.ResourceEventHandlerDetailedFuncs)
+		handler.AddFunc(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}, isInInitialList)
+	}
+	addPods := func(node string, count int) {
+		handler := trigger.podHandler().(cache.ResourceEventHandlerDetailedFuncs)
+		for i := 0; i < count; i++ {
+			handler.AddFunc(&corev1.Pod{Spec: corev1.PodSpec{NodeName: node}}, false)
+		}
+	}
+
+	It("should request a scrape of registered nodes", func() {
+		addNode("node1", true)
+		Expect(trigger.requested()).NotTo(Receive())
+		Expect(trigger.cycleStarted()).To(BeEmpty())
+
+		addNode("node2", false)
+		addNode("node3", false)
+		Expect(trigger.requested()).To(Receive())
+		Expect(trigger.requested()).NotTo(Receive())
+		Expect(trigger.pending()).To(Equal(triggerNodeAdded))
+		Expect(trigger.cycleStarted()).To(Equal(triggerNodeAdded))
+		Expect(forced).To(ConsistOf("node2", "node3"))
+		Expect(trigger.pending()).To(BeEmpty())
+	})
+	It("should request a scrape of nodes starting a burst of pods between cycles", func() {
+		addPods("node1", 2)
+		addPods("node2", 2)
+		trigger.cycleStarted()
+		addPods("node1", 2)
+		Expect(trigger.pending()).To(BeEmpty())
+
+		addPods("node1", 2)
+		Expect(trigger.pending()).To(Equal(triggerPodBurst))
+		Expect(trigger.cycleStarted()).To(Equal(triggerPodBurst))
+		Expect(forced).To(ConsistOf("node1"))
+	})
+	It("should run a single out-of-band cycle per delay", func() {
+		now := time.Now()
+		fakeClock := testingclock.NewFakeClock(now)
+		server := NewServer(nil, nil, nil, &storageMock{}, &scraperMock{result: &storage.MetricsBatch{}}, time.Minute)
+		server.clock = fakeClock
+		server.tickInterval = time.Hour
+		server.trigger = trigger
+		cycle := func() uint64 {
+			server.tickStatusMux.RLock()
+			defer server.tickStatusMux.RUnlock()
+			return server.cycle
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go server.runScrape(ctx)
+		Eventually(cycle).Should(BeEquivalentTo(1))
+
+		addNode("node1", false)
+		addNode("node2", false)
+		Eventually(func() uint64 {
+			fakeClock.Step(time.Second)
+			return cycle()
+		}).Should(BeEquivalentTo(2))
+		Expect(forced).To(ConsistOf("node1", "node2"))
+		Consistently(cycle).Should(BeEquivalentTo(2))
+	})
+})
@@ -0,0 +1,236 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+// peerTimeout bounds requests to peers, so an unavailable shard only delays
+// responses instead of failing them.
+const peerTimeout = 5 * time.Second
+
+var (
+	peerRequests = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "shard",
+			Name:      "peer_requests_total",
+			Help:      "Number of requests for metrics sent to other shards, partitioned by result",
+		},
+		[]string{"result"},
+	)
+	peerRequestDuration = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Namespace: "metrics_server",
+			Subsystem: "shard",
+			Name:      "peer_request_duration_seconds",
+			Help:      "Duration of requests for metrics sent to other shards",
+			Buckets:   metrics.ExponentialBuckets(0.005, 2, 12),
+		},
+	)
+)
+
+// RegisterShardMetrics registers metrics of sharding.
+func RegisterShardMetrics(registrationFunc func(metrics.Registerable) error) error {
+	for _, metric := range []metrics.Registerable{peerRequests, peerRequestDuration} {
+		if err := registrationFunc(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FanOut serves metrics of all shards. Node metrics are read from the shard
+// owning the node, pod metrics from the shard owning the node the pod runs
+// on. Metrics of shards failing to respond are omitted.
+type FanOut struct {
+	shard Shard
+	local Local
+	pods  v1listers.PodLister
+	peers []*peer
+}
+
+var _ Local = (*FanOut)(nil)
+
+// NewFanOut returns a FanOut reading metrics of shard from local and of other
+// shards from peer URLs, urlTemplate with $ordinal replaced by their ordinal.
+// Nodes of pods are read from pods.
+func NewFanOut(shard Shard, local Local, pods v1listers.PodLister, urlTemplate string, client *http.Client) *FanOut {
+	f := &FanOut{shard: shard, local: local, pods: pods}
+	for ordinal := 0; ordinal < shard.Count; ordinal++ {
+		if ordinal != shard.Ordinal {
+			f.peers = append(f.peers, newPeer(urlTemplate, ordinal, client))
+		}
+	}
+	return f
+}
+
+// GetNodeMetrics implements api.NodeMetricsGetter.
+func (f *FanOut) GetNodeMetrics(nodes ...*corev1.Node) ([]metricsapi.NodeMetrics, error) {
+	local, remote := f.splitNodes(nodes)
+	res, err := f.local.GetNodeMetrics(local...)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range f.fanOut(remote, nil, false) {
+		res = append(res, resp.Nodes...)
+	}
+	setNodeLabels(res, nodes)
+	return res, nil
+}
+
+// GetPodMetrics implements api.PodMetricsGetter.
+func (f *FanOut) GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metricsapi.PodMetrics, error) {
+	local, remote := f.splitPods(pods)
+	res, err := f.local.GetPodMetrics(local...)
+	if err != nil {
+		return nil, err
+	}
+	for _, resp := range f.fanOut(nil, remote, false) {
+		res = append(res, resp.Pods...)
+	}
+	setPodLabels(res, pods)
+	return res, nil
+}
+
+// GetNodeMetricsHistory implements api.HistoryGetter.
+func (f *FanOut) GetNodeMetricsHistory(node *corev1.Node) ([]metricsapi.NodeMetrics, error) {
+	local, remote := f.splitNodes([]*corev1.Node{node})
+	if len(local) != 0 {
+		return f.local.GetNodeMetricsHistory(node)
+	}
+	var res []metricsapi.NodeMetrics
+	for _, resp := range f.fanOut(remote, nil, true) {
+		res = append(res, resp.Nodes...)
+	}
+	setNodeLabels(res, []*corev1.Node{node})
+	return res, nil
+}
+
+// GetPodMetricsHistory implements api.HistoryGetter.
+func (f *FanOut) GetPodMetricsHistory(pod *metav1.PartialObjectMetadata) ([]metricsapi.PodMetrics, error) {
+	local, remote := f.splitPods([]*metav1.PartialObjectMetadata{pod})
+	if len(local) != 0 {
+		return f.local.GetPodMetricsHistory(pod)
+	}
+	var res []metricsapi.PodMetrics
+	for _, resp := range f.fanOut(nil, remote, true) {
+		res = append(res, resp.Pods...)
+	}
+	setPodLabels(res, []*metav1.PartialObjectMetadata{pod})
+	return res, nil
+}
+
+// splitNodes returns nodes owned by this shard and names of other nodes by owner.
+func (f *FanOut) splitNodes(nodes []*corev1.Node) (local []*corev1.Node, remote map[int][]string) {
+	remote = map[int][]string{}
+	for _, node := range nodes {
+		owner := f.shard.Owner(node.Name)
+		if owner == f.shard.Ordinal {
+			local = append(local, node)
+			continue
+		}
+		remote[owner] = append(remote[owner], node.Name)
+	}
+	return local, remote
+}
+
+// splitPods returns pods running on nodes owned by this shard and references
+// to other pods by owner. Pods whose node isn't known yet are omitted, they
+// have no metrics.
+func (f *FanOut) splitPods(pods []*metav1.PartialObjectMetadata) (local []*metav1.PartialObjectMetadata, remote map[int][]peerPodRef) {
+	remote = map[int][]peerPodRef{}
+	for _, pod := range pods {
+		spec, err := f.pods.Pods(pod.Namespace).Get(pod.Name)
+		if err != nil || spec.Spec.NodeName == "" {
+			continue
+		}
+		owner := f.shard.Owner(spec.Spec.NodeName)
+		if owner == f.shard.Ordinal {
+			local = append(local, pod)
+			continue
+		}
+		remote[owner] = append(remote[owner], peerPodRef{Namespace: pod.Namespace, Name: pod.Name})
+	}
+	return local, remote
+}
+
+// fanOut requests nodes and pods from their owners in parallel, returning
+// responses of peers that succeeded.
+func (f *FanOut) fanOut(nodes map[int][]string, pods map[int][]peerPodRef, history bool) []peerResponse {
+	ctx, cancel := context.WithTimeout(context.Background(), peerTimeout)
+	defer cancel()
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		responses []peerResponse
+	)
+	for _, p := range f.peers {
+		pr := peerRequest{Nodes: nodes[p.ordinal], Pods: pods[p.ordinal], History: history}
+		if len(pr.Nodes) == 0 && len(pr.Pods) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(p *peer) {
+			defer wg.Done()
+			resp, err := p.get(ctx, pr)
+			if err != nil {
+				peerRequests.WithLabelValues("error").Inc()
+				klog.ErrorS(err, "Failed to read metrics from shard", "shard", p.ordinal)
+				return
+			}
+			peerRequests.WithLabelValues("success").Inc()
+			mu.Lock()
+			responses = append(responses, resp)
+			mu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+	return responses
+}
+
+// setNodeLabels sets labels of requested nodes on metrics read from peers, which only know node names.
+func setNodeLabels(ms []metricsapi.NodeMetrics, nodes []*corev1.Node) {
+	labels := make(map[string]map[string]string, len(nodes))
+	for _, node := range nodes {
+		labels[node.Name] = node.Labels
+	}
+	for i := range ms {
+		ms[i].Labels = labels[ms[i].Name]
+	}
+}
+
+// setPodLabels sets labels of requested pods on metrics read from peers, which only know pod names.
+func setPodLabels(ms []metricsapi.PodMetrics, pods []*metav1.PartialObjectMetadata) {
+	type ref struct{ namespace, name string }
+	labels := make(map[ref]map[string]string, len(pods))
+	for _, pod := range pods {
+		labels[ref{pod.Namespace, pod.Name}] = pod.Labels
+	}
+	for i := range ms {
+		ms[i].Labels = labels[ref{ms[i].Namespace, ms[i].Name}]
+	}
+}
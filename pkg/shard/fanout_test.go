@@ -0,0 +1,209 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+// fakeLocal serves metrics of a fixed set of nodes and pods.
+type fakeLocal struct {
+	nodes map[string]bool
+	pods  map[string]bool
+}
+
+func (f fakeLocal) GetNodeMetrics(nodes ...*corev1.Node) ([]metricsapi.NodeMetrics, error) {
+	var res []metricsapi.NodeMetrics
+	for _, node := range nodes {
+		if f.nodes[node.Name] {
+			res = append(res, metricsapi.NodeMetrics{
+				ObjectMeta: metav1.ObjectMeta{Name: node.Name, Labels: node.Labels},
+				Timestamp:  metav1.NewTime(time.Unix(1600000000, 0)),
+				Usage:      corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+			})
+		}
+	}
+	return res, nil
+}
+
+func (f fakeLocal) GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metricsapi.PodMetrics, error) {
+	var res []metricsapi.PodMetrics
+	for _, pod := range pods {
+		if f.pods[pod.Namespace+"/"+pod.Name] {
+			res = append(res, metricsapi.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name, Labels: pod.Labels},
+				Timestamp:  metav1.NewTime(time.Unix(1600000000, 0)),
+				Containers: []metricsapi.ContainerMetrics{{Name: "app", Usage: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Mi")}}},
+			})
+		}
+	}
+	return res, nil
+}
+
+func (f fakeLocal) GetNodeMetricsHistory(node *corev1.Node) ([]metricsapi.NodeMetrics, error) {
+	return f.GetNodeMetrics(node)
+}
+
+func (f fakeLocal) GetPodMetricsHistory(pod *metav1.PartialObjectMetadata) ([]metricsapi.PodMetrics, error) {
+	return f.GetPodMetrics(pod)
+}
+
+// nodesOf returns names of nodes owned by ordinal among the first 20 nodes.
+func nodesOf(shard Shard, ordinal int) []string {
+	var res []string
+	for i := 0; i < 20; i++ {
+		name := "node" + string(rune('a'+i))
+		if shard.Owner(name) == ordinal {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// podLister lists pods running on nodes, keyed by namespace/name.
+func podLister(nodes map[string]string) v1listers.PodLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for key, node := range nodes {
+		namespace, name, _ := cache.SplitMetaNamespaceKey(key)
+		_ = indexer.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: corev1.PodSpec{NodeName: node}})
+	}
+	return v1listers.NewPodLister(indexer)
+}
+
+func set(names ...string) map[string]bool {
+	res := map[string]bool{}
+	for _, name := range names {
+		res[name] = true
+	}
+	return res
+}
+
+func TestFanOut(t *testing.T) {
+	shards := Shard{Count: 3}
+	locals := make([]fakeLocal, 3)
+	for ordinal := range locals {
+		locals[ordinal] = fakeLocal{nodes: set(nodesOf(shards, ordinal)...), pods: map[string]bool{}}
+	}
+	locals[0].pods = set("ns1/pod1")
+	// Shard 1 still stores pod3, whose node moved to shard 2.
+	locals[1].pods = set("ns1/pod2", "ns2/pod3")
+	locals[2].pods = set("ns2/pod3")
+	pods := podLister(map[string]string{
+		"ns1/pod1": nodesOf(shards, 0)[0],
+		"ns1/pod2": nodesOf(shards, 1)[0],
+		"ns2/pod3": nodesOf(shards, 2)[0],
+	})
+
+	mux := http.NewServeMux()
+	for ordinal := 1; ordinal < 3; ordinal++ {
+		mux.Handle("/"+string(rune('0'+ordinal))+PeerPath, NewPeerHandler(locals[ordinal]))
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	f := NewFanOut(Shard{Ordinal: 0, Count: 3}, locals[0], pods, srv.URL+"/$ordinal", srv.Client())
+
+	var nodes []*corev1.Node
+	var want []string
+	for i := 0; i < 20; i++ {
+		name := "node" + string(rune('a'+i))
+		nodes = append(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"name": name}}})
+		want = append(want, name)
+	}
+	nms, err := f.GetNodeMetrics(nodes...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []string
+	for _, nm := range nms {
+		got = append(got, nm.Name)
+		if nm.Labels["name"] != nm.Name {
+			t.Errorf("Unexpected labels %v of node %s", nm.Labels, nm.Name)
+		}
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected nodes, diff:\n%s", diff)
+	}
+
+	podMetadata := []*metav1.PartialObjectMetadata{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1", Labels: map[string]string{"app": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod2", Labels: map[string]string{"app": "b"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "pod3", Labels: map[string]string{"app": "c"}}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "pod4"}},
+	}
+	pms, err := f.GetPodMetrics(podMetadata...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got = nil
+	for _, pm := range pms {
+		got = append(got, pm.Namespace+"/"+pm.Name+":"+pm.Labels["app"])
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff([]string{"ns1/pod1:a", "ns1/pod2:b", "ns2/pod3:c"}, got); diff != "" {
+		t.Errorf("Unexpected pods, diff:\n%s", diff)
+	}
+
+	history, err := f.GetPodMetricsHistory(podMetadata[2])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(history) != 1 || history[0].Name != "pod3" {
+		t.Errorf("Unexpected history %v", history)
+	}
+}
+
+func TestFanOut_UnavailablePeer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	shards := Shard{Count: 2}
+	local := fakeLocal{nodes: set(nodesOf(shards, 0)...), pods: set("ns1/pod1")}
+	pods := podLister(map[string]string{"ns1/pod1": nodesOf(shards, 0)[0], "ns1/pod2": nodesOf(shards, 1)[0]})
+	f := NewFanOut(Shard{Ordinal: 0, Count: 2}, local, pods, srv.URL+"/$ordinal", srv.Client())
+
+	var nodes []*corev1.Node
+	for _, name := range append(nodesOf(shards, 0), nodesOf(shards, 1)...) {
+		nodes = append(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	nms, err := f.GetNodeMetrics(nodes...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(nms) != len(nodesOf(shards, 0)) {
+		t.Errorf("Unexpected node metrics count %d, want %d served locally", len(nms), len(nodesOf(shards, 0)))
+	}
+	pms, err := f.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod2"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(pms) != 1 || !strings.HasSuffix(pms[0].Name, "pod1") {
+		t.Errorf("Unexpected pod metrics %v", pms)
+	}
+}
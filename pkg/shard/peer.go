@@ -0,0 +1,165 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api"
+)
+
+// PeerPath serves metrics stored by a shard to other shards. Access requires
+// RBAC permission to post to the non-resource URL.
+const PeerPath = "/shard/v1/metrics"
+
+// ordinalPlaceholder is replaced with the ordinal of a shard in peer URLs.
+const ordinalPlaceholder = "$ordinal"
+
+// peerRequest lists the objects whose metrics are requested from a peer.
+type peerRequest struct {
+	Nodes []string     `json:"nodes,omitempty"`
+	Pods  []peerPodRef `json:"pods,omitempty"`
+	// History requests metrics of all kept scrapes instead of the latest.
+	History bool `json:"history,omitempty"`
+}
+
+type peerPodRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type peerResponse struct {
+	Nodes []metrics.NodeMetrics `json:"nodes,omitempty"`
+	Pods  []metrics.PodMetrics  `json:"pods,omitempty"`
+}
+
+// Local is the storage of a shard.
+type Local interface {
+	api.MetricsGetter
+	api.HistoryGetter
+}
+
+// NewPeerHandler returns the handler of PeerPath serving metrics of local.
+func NewPeerHandler(local Local) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var pr peerRequest
+		if err := json.NewDecoder(io.LimitReader(req.Body, 16<<20)).Decode(&pr); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		resp, err := serveLocal(local, pr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			klog.V(2).InfoS("Failed writing shard peer response", "err", err)
+		}
+	})
+}
+
+func serveLocal(local Local, pr peerRequest) (peerResponse, error) {
+	nodes := make([]*corev1.Node, 0, len(pr.Nodes))
+	for _, name := range pr.Nodes {
+		nodes = append(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	pods := make([]*metav1.PartialObjectMetadata, 0, len(pr.Pods))
+	for _, ref := range pr.Pods {
+		pods = append(pods, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: ref.Namespace, Name: ref.Name}})
+	}
+	var (
+		resp peerResponse
+		err  error
+	)
+	if !pr.History {
+		if resp.Nodes, err = local.GetNodeMetrics(nodes...); err != nil {
+			return resp, err
+		}
+		resp.Pods, err = local.GetPodMetrics(pods...)
+		return resp, err
+	}
+	for _, node := range nodes {
+		ms, err := local.GetNodeMetricsHistory(node)
+		if err != nil {
+			return resp, err
+		}
+		resp.Nodes = append(resp.Nodes, ms...)
+	}
+	for _, pod := range pods {
+		ms, err := local.GetPodMetricsHistory(pod)
+		if err != nil {
+			return resp, err
+		}
+		resp.Pods = append(resp.Pods, ms...)
+	}
+	return resp, nil
+}
+
+// peer requests metrics from another shard.
+type peer struct {
+	ordinal int
+	url     string
+	client  *http.Client
+}
+
+func newPeer(urlTemplate string, ordinal int, client *http.Client) *peer {
+	url := strings.TrimSuffix(strings.ReplaceAll(urlTemplate, ordinalPlaceholder, strconv.Itoa(ordinal)), "/") + PeerPath
+	return &peer{ordinal: ordinal, url: url, client: client}
+}
+
+func (p *peer) get(ctx context.Context, pr peerRequest) (peerResponse, error) {
+	var resp peerResponse
+	body, err := json.Marshal(pr)
+	if err != nil {
+		return resp, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return resp, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	start := time.Now()
+	httpResp, err := p.client.Do(req)
+	peerRequestDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return resp, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(httpResp.Body, 512))
+		return resp, fmt.Errorf("request failed, status: %q, body: %q", httpResp.Status, msg)
+	}
+	err = json.NewDecoder(httpResp.Body).Decode(&resp)
+	return resp, err
+}
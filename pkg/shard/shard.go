@@ -0,0 +1,88 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shard splits nodes between replicas of a StatefulSet, each
+// scraping only the nodes it owns, and serves the Metrics API from every
+// replica by fanning requests out to the replicas owning requested objects.
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Shard is one of Count shards nodes are split between with rendezvous
+// hashing, so changing the number of shards only moves the nodes of added or
+// removed shards.
+type Shard struct {
+	// Ordinal identifies the shard, from 0 to Count-1.
+	Ordinal int
+	Count   int
+}
+
+var _ storage.Filter = Shard{}
+
+// ParseOrdinal returns the ordinal of a StatefulSet pod from its name, e.g. 2 for metrics-server-2.
+func ParseOrdinal(podName string) (int, error) {
+	i := strings.LastIndex(podName, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("pod name %q has no ordinal suffix", podName)
+	}
+	ordinal, err := strconv.Atoi(podName[i+1:])
+	if err != nil || ordinal < 0 {
+		return 0, fmt.Errorf("pod name %q has no ordinal suffix", podName)
+	}
+	return ordinal, nil
+}
+
+// Owner returns the ordinal of the shard owning node.
+func (s Shard) Owner(node string) int {
+	owner, highest := 0, uint64(0)
+	for ordinal := 0; ordinal < s.Count; ordinal++ {
+		h := fnv.New64a()
+		h.Write([]byte(node))
+		h.Write([]byte{0})
+		h.Write([]byte(strconv.Itoa(ordinal)))
+		if weight := mix(h.Sum64()); ordinal == 0 || weight > highest {
+			owner, highest = ordinal, weight
+		}
+	}
+	return owner
+}
+
+// KeepNode returns true if node is owned by this shard.
+func (s Shard) KeepNode(node *corev1.Node) bool {
+	return s.Owner(node.Name) == s.Ordinal
+}
+
+// KeepPod always returns true, pods are sharded with the node they run on.
+func (s Shard) KeepPod(namespace, name string) bool {
+	return true
+}
+
+// mix is the splitmix64 finalizer, spreading FNV hashes differing in their last bytes over all bits.
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShard_Owner(t *testing.T) {
+	const nodes = 3000
+	counts := make([]int, 3)
+	moved := 0
+	for i := 0; i < nodes; i++ {
+		name := fmt.Sprintf("node-%d", i)
+		owner := Shard{Count: 3}.Owner(name)
+		counts[owner]++
+		if (Shard{Count: 3}).Owner(name) != owner {
+			t.Fatalf("Owner of %s isn't stable", name)
+		}
+		if newOwner := (Shard{Count: 4}).Owner(name); newOwner != owner {
+			moved++
+			if newOwner != 3 {
+				t.Errorf("Node %s moved from shard %d to existing shard %d when adding a shard", name, owner, newOwner)
+			}
+		}
+	}
+	for ordinal, count := range counts {
+		if count < nodes/3*9/10 || count > nodes/3*11/10 {
+			t.Errorf("Unbalanced shards, shard %d owns %d of %d nodes", ordinal, count, nodes)
+		}
+	}
+	if moved < nodes/4*9/10 || moved > nodes/4*11/10 {
+		t.Errorf("Unexpected number of nodes moved to the added shard %d, want about %d", moved, nodes/4)
+	}
+}
+
+func TestParseOrdinal(t *testing.T) {
+	tcs := []struct {
+		name    string
+		want    int
+		wantErr bool
+	}{
+		{name: "metrics-server-0", want: 0},
+		{name: "metrics-server-12", want: 12},
+		{name: "metrics-server", wantErr: true},
+		{name: "metrics-server-6d4f8c-x2v9k", wantErr: true},
+		{name: "metrics", wantErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseOrdinal(tc.name)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error %v, want error %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("Unexpected ordinal %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,631 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// Checkpoint format
+//
+// A checkpoint starts with the magic bytes "MSCP" followed by the major and
+// minor format version as uvarints. The rest of the checkpoint is a sequence
+// of records, each encoded as a uvarint tag, a uvarint payload length and the
+// payload. A record payload is itself a sequence of fields encoded the same
+// way, with integers stored as varints inside the field payload.
+//
+// Compatibility rules:
+//   - Readers reject checkpoints with a different major version.
+//   - Readers accept checkpoints with a newer minor version, skipping record
+//     and field tags they don't know. Adding records or fields only bumps
+//     the minor version.
+//   - The meaning of an existing tag never changes and tags are never reused.
+//   - Missing fields decode as zero values.
+const (
+	checkpointMagic        = "MSCP"
+	checkpointMajorVersion = 1
+	checkpointMinorVersion = 3
+
+	// maxCheckpointRecordSize bounds memory allocated for a single record when reading untrusted input.
+	maxCheckpointRecordSize = 16 << 20
+)
+
+// Record tags.
+const (
+	recordNodeLast = 1
+	recordNodePrev = 2
+	recordPodLast  = 3
+	recordPodPrev  = 4
+)
+
+// Node record fields. Flags and filesystems are only written in last records.
+const (
+	fieldNodeName       = 1
+	fieldNodePoint      = 2
+	fieldNodePushed     = 3
+	fieldNodeWindows    = 4
+	fieldNodeFilesystem = 5
+)
+
+// Pod record fields.
+const (
+	fieldPodNamespace    = 1
+	fieldPodName         = 2
+	fieldPodPoint        = 3
+	fieldPodContainer    = 4
+	fieldPodVolume       = 5
+	fieldPodProcessCount = 6
+	// Field 7 held containers missing from the last scrape, it is skipped when restoring older checkpoints.
+	fieldPodNode       = 8
+	fieldPodFilesystem = 9
+)
+
+// Container fields.
+const (
+	fieldContainerName  = 1
+	fieldContainerPoint = 2
+)
+
+// Volume fields.
+const (
+	fieldVolumeClaimName     = 1
+	fieldVolumeCapacityBytes = 2
+	fieldVolumeUsedBytes     = 3
+)
+
+// Filesystem fields.
+const (
+	fieldFilesystemName           = 1
+	fieldFilesystemCapacityBytes  = 2
+	fieldFilesystemAvailableBytes = 3
+	fieldFilesystemUsedBytes      = 4
+)
+
+// MetricsPoint fields.
+const (
+	fieldPointStartTime                     = 1
+	fieldPointTimestamp                     = 2
+	fieldPointCumulativeCpuUsed             = 3
+	fieldPointMemoryUsage                   = 4
+	fieldPointProcessCount                  = 5
+	fieldPointCumulativeCfsPeriods          = 6
+	fieldPointCumulativeCfsThrottledPeriods = 7
+	fieldPointCumulativeCfsThrottledTime    = 8
+)
+
+// Restore replaces stored metrics with the ones from snapshot, for example read from a checkpoint.
+func (s *storage) Restore(snapshot Snapshot) {
+	s.update(func(next *state) {
+		next.nodes.last, next.nodes.prev = snapshot.nodes.last, snapshot.nodes.prev
+		next.nodes.pushed, next.nodes.windows, next.nodes.filesystems = snapshot.nodes.pushed, snapshot.nodes.windows, snapshot.nodes.filesystems
+		next.pods.last, next.pods.prev = snapshot.pods.last, snapshot.pods.prev
+		// Older points and averages aren't checkpointed, drop them so they don't mix with restored points.
+		next.nodes.older, next.pods.older = nil, nil
+		next.nodes.smoothed, next.pods.smoothed = nil, nil
+		next.recordFootprint()
+	})
+}
+
+// WriteCheckpointFile writes snapshot to a checkpoint file at path. The file
+// is replaced atomically, so a crash while writing keeps the previous one.
+func WriteCheckpointFile(path string, snapshot Snapshot) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := WriteCheckpoint(f, snapshot); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// ReadCheckpointFile reads the checkpoint file at path, returning the time it was written.
+func ReadCheckpointFile(path string) (Snapshot, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Snapshot{}, time.Time{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Snapshot{}, time.Time{}, err
+	}
+	snapshot, err := ReadCheckpoint(f)
+	if err != nil {
+		return Snapshot{}, time.Time{}, err
+	}
+	return snapshot, info.ModTime(), nil
+}
+
+// WriteCheckpoint writes snapshot to w in the versioned checkpoint format.
+func WriteCheckpoint(w io.Writer, snapshot Snapshot) error {
+	bw := bufio.NewWriter(w)
+	var e encoder
+	e.buf = append(e.buf, checkpointMagic...)
+	e.uvarint(checkpointMajorVersion)
+	e.uvarint(checkpointMinorVersion)
+	// writeRecord flushes encoded records to bw, keeping memory bounded by the largest record.
+	writeRecord := func(tag uint64, fn func(e *encoder)) error {
+		e.message(tag, fn)
+		_, err := bw.Write(e.buf)
+		e.buf = e.buf[:0]
+		return err
+	}
+	for _, nodes := range []struct {
+		tag    uint64
+		points map[string]MetricsPoint
+	}{{recordNodeLast, snapshot.nodes.last}, {recordNodePrev, snapshot.nodes.prev}} {
+		names := make([]string, 0, len(nodes.points))
+		for name := range nodes.points {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			err := writeRecord(nodes.tag, func(e *encoder) {
+				e.string(fieldNodeName, name)
+				e.message(fieldNodePoint, func(e *encoder) { e.point(nodes.points[name]) })
+				if nodes.tag == recordNodeLast {
+					e.node(name, snapshot.nodes)
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, pods := range []struct {
+		tag    uint64
+		points map[apitypes.NamespacedName]PodMetricsPoint
+	}{{recordPodLast, snapshot.pods.last}, {recordPodPrev, snapshot.pods.prev}} {
+		refs := make([]apitypes.NamespacedName, 0, len(pods.points))
+		for ref, pod := range pods.points {
+			if !pod.Synthetic {
+				refs = append(refs, ref)
+			}
+		}
+		sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+		for _, ref := range refs {
+			if err := writeRecord(pods.tag, func(e *encoder) { e.pod(ref, pods.points[ref]) }); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := bw.Write(e.buf); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ReadCheckpoint reads a snapshot written by WriteCheckpoint.
+func ReadCheckpoint(r io.Reader) (Snapshot, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(checkpointMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read checkpoint header: %w", err)
+	}
+	if string(magic) != checkpointMagic {
+		return Snapshot{}, errors.New("not a metrics checkpoint")
+	}
+	major, err := binary.ReadUvarint(br)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read checkpoint version: %w", err)
+	}
+	if _, err := binary.ReadUvarint(br); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read checkpoint version: %w", err)
+	}
+	if major != checkpointMajorVersion {
+		return Snapshot{}, fmt.Errorf("unsupported checkpoint major version %d, expected %d", major, checkpointMajorVersion)
+	}
+	snapshot := Snapshot{
+		nodes: nodeStorage{last: map[string]MetricsPoint{}, prev: map[string]MetricsPoint{}},
+		pods:  podStorage{last: map[apitypes.NamespacedName]PodMetricsPoint{}, prev: map[apitypes.NamespacedName]PodMetricsPoint{}},
+	}
+	for {
+		tag, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return snapshot, nil
+		}
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("failed to read checkpoint record: %w", err)
+		}
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("failed to read checkpoint record: %w", err)
+		}
+		if size > maxCheckpointRecordSize {
+			return Snapshot{}, fmt.Errorf("checkpoint record of %d bytes exceeds limit of %d bytes", size, maxCheckpointRecordSize)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return Snapshot{}, fmt.Errorf("failed to read checkpoint record: %w", err)
+		}
+		switch tag {
+		case recordNodeLast, recordNodePrev:
+			name, point, err := decodeNode(payload)
+			if err != nil {
+				return Snapshot{}, err
+			}
+			if tag == recordNodeLast {
+				snapshot.nodes.last[name] = point
+				if err := decodeNodeStatus(payload, name, &snapshot.nodes); err != nil {
+					return Snapshot{}, err
+				}
+			} else {
+				snapshot.nodes.prev[name] = point
+			}
+		case recordPodLast, recordPodPrev:
+			ref, point, err := decodePod(payload)
+			if err != nil {
+				return Snapshot{}, err
+			}
+			if tag == recordPodLast {
+				snapshot.pods.last[ref] = point
+			} else {
+				snapshot.pods.prev[ref] = point
+			}
+		}
+	}
+}
+
+// WriteBatch writes batch to w in the checkpoint format, as a checkpoint
+// without previous points. Unlike a snapshot, a batch can be stored on top
+// of existing metrics, e.g. to replicate scrapes.
+func WriteBatch(w io.Writer, batch *MetricsBatch) error {
+	return WriteCheckpoint(w, Snapshot{
+		nodes: nodeStorage{last: batch.Nodes, pushed: batch.PushedNodes, windows: batch.WindowsNodes, filesystems: batch.NodeFilesystems},
+		pods:  podStorage{last: batch.Pods},
+	})
+}
+
+// ReadBatch reads a batch written by WriteBatch. Previous points are ignored.
+func ReadBatch(r io.Reader) (*MetricsBatch, error) {
+	snapshot, err := ReadCheckpoint(r)
+	if err != nil {
+		return nil, err
+	}
+	return &MetricsBatch{
+		Nodes:           snapshot.nodes.last,
+		Pods:            snapshot.pods.last,
+		PushedNodes:     snapshot.nodes.pushed,
+		WindowsNodes:    snapshot.nodes.windows,
+		NodeFilesystems: snapshot.nodes.filesystems,
+	}, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) bytes(tag uint64, b []byte) {
+	e.uvarint(tag)
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(tag uint64, s string) {
+	e.bytes(tag, []byte(s))
+}
+
+// uint writes an unsigned field, omitting zero values.
+func (e *encoder) uint(tag uint64, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.bytes(tag, binary.AppendUvarint(nil, v))
+}
+
+// time writes a time field as nanoseconds since epoch, omitting zero times.
+func (e *encoder) time(tag uint64, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	e.bytes(tag, binary.AppendVarint(nil, t.UnixNano()))
+}
+
+// message writes a length-prefixed nested message built by fn.
+func (e *encoder) message(tag uint64, fn func(e *encoder)) {
+	var nested encoder
+	fn(&nested)
+	e.bytes(tag, nested.buf)
+}
+
+func (e *encoder) point(p MetricsPoint) {
+	e.time(fieldPointStartTime, p.StartTime)
+	e.time(fieldPointTimestamp, p.Timestamp)
+	e.uint(fieldPointCumulativeCpuUsed, p.CumulativeCpuUsed)
+	e.uint(fieldPointMemoryUsage, p.MemoryUsage)
+	e.uint(fieldPointProcessCount, p.ProcessCount)
+	e.uint(fieldPointCumulativeCfsPeriods, p.CumulativeCfsPeriods)
+	e.uint(fieldPointCumulativeCfsThrottledPeriods, p.CumulativeCfsThrottledPeriods)
+	e.uint(fieldPointCumulativeCfsThrottledTime, p.CumulativeCfsThrottledTime)
+}
+
+func (e *encoder) filesystem(fs FilesystemMetricsPoint) {
+	e.string(fieldFilesystemName, fs.Name)
+	e.uint(fieldFilesystemCapacityBytes, fs.CapacityBytes)
+	e.uint(fieldFilesystemAvailableBytes, fs.AvailableBytes)
+	e.uint(fieldFilesystemUsedBytes, fs.UsedBytes)
+}
+
+// node writes the flags and filesystems of a node of last.
+func (e *encoder) node(name string, nodes nodeStorage) {
+	if nodes.pushed[name] {
+		e.uint(fieldNodePushed, 1)
+	}
+	if nodes.windows[name] {
+		e.uint(fieldNodeWindows, 1)
+	}
+	for _, fs := range nodes.filesystems[name] {
+		e.message(fieldNodeFilesystem, func(e *encoder) { e.filesystem(fs) })
+	}
+}
+
+func (e *encoder) pod(ref apitypes.NamespacedName, p PodMetricsPoint) {
+	e.string(fieldPodNamespace, ref.Namespace)
+	e.string(fieldPodName, ref.Name)
+	e.message(fieldPodPoint, func(e *encoder) { e.point(p.Pod) })
+	names := make([]string, 0, len(p.Containers))
+	for name := range p.Containers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.message(fieldPodContainer, func(e *encoder) {
+			e.string(fieldContainerName, name)
+			e.message(fieldContainerPoint, func(e *encoder) { e.point(p.Containers[name]) })
+		})
+	}
+	for _, v := range p.Volumes {
+		e.message(fieldPodVolume, func(e *encoder) {
+			e.string(fieldVolumeClaimName, v.ClaimName)
+			e.uint(fieldVolumeCapacityBytes, v.CapacityBytes)
+			e.uint(fieldVolumeUsedBytes, v.UsedBytes)
+		})
+	}
+	e.uint(fieldPodProcessCount, p.ProcessCount)
+	if p.Node != "" {
+		e.string(fieldPodNode, p.Node)
+	}
+	for _, fs := range p.Filesystems {
+		e.message(fieldPodFilesystem, func(e *encoder) { e.filesystem(fs) })
+	}
+}
+
+// decodeFields calls fn for every field of a record payload.
+func decodeFields(payload []byte, fn func(tag uint64, value []byte) error) error {
+	for len(payload) > 0 {
+		tag, n := binary.Uvarint(payload)
+		if n <= 0 {
+			return errors.New("malformed checkpoint field tag")
+		}
+		payload = payload[n:]
+		size, n := binary.Uvarint(payload)
+		if n <= 0 || size > uint64(len(payload)-n) {
+			return errors.New("malformed checkpoint field length")
+		}
+		payload = payload[n:]
+		if err := fn(tag, payload[:size]); err != nil {
+			return err
+		}
+		payload = payload[size:]
+	}
+	return nil
+}
+
+func decodeUint(value []byte) (uint64, error) {
+	v, n := binary.Uvarint(value)
+	if n <= 0 {
+		return 0, errors.New("malformed checkpoint integer")
+	}
+	return v, nil
+}
+
+func decodeTime(value []byte) (time.Time, error) {
+	v, n := binary.Varint(value)
+	if n <= 0 {
+		return time.Time{}, errors.New("malformed checkpoint time")
+	}
+	return time.Unix(0, v), nil
+}
+
+func decodePoint(payload []byte) (MetricsPoint, error) {
+	var p MetricsPoint
+	err := decodeFields(payload, func(tag uint64, value []byte) error {
+		var err error
+		switch tag {
+		case fieldPointStartTime:
+			p.StartTime, err = decodeTime(value)
+		case fieldPointTimestamp:
+			p.Timestamp, err = decodeTime(value)
+		case fieldPointCumulativeCpuUsed:
+			p.CumulativeCpuUsed, err = decodeUint(value)
+		case fieldPointMemoryUsage:
+			p.MemoryUsage, err = decodeUint(value)
+		case fieldPointProcessCount:
+			p.ProcessCount, err = decodeUint(value)
+		case fieldPointCumulativeCfsPeriods:
+			p.CumulativeCfsPeriods, err = decodeUint(value)
+		case fieldPointCumulativeCfsThrottledPeriods:
+			p.CumulativeCfsThrottledPeriods, err = decodeUint(value)
+		case fieldPointCumulativeCfsThrottledTime:
+			p.CumulativeCfsThrottledTime, err = decodeUint(value)
+		}
+		return err
+	})
+	return p, err
+}
+
+func decodeFilesystem(payload []byte) (FilesystemMetricsPoint, error) {
+	var fs FilesystemMetricsPoint
+	err := decodeFields(payload, func(tag uint64, value []byte) error {
+		var err error
+		switch tag {
+		case fieldFilesystemName:
+			fs.Name = string(value)
+		case fieldFilesystemCapacityBytes:
+			fs.CapacityBytes, err = decodeUint(value)
+		case fieldFilesystemAvailableBytes:
+			fs.AvailableBytes, err = decodeUint(value)
+		case fieldFilesystemUsedBytes:
+			fs.UsedBytes, err = decodeUint(value)
+		}
+		return err
+	})
+	return fs, err
+}
+
+func decodeNode(payload []byte) (string, MetricsPoint, error) {
+	var (
+		name  string
+		point MetricsPoint
+	)
+	err := decodeFields(payload, func(tag uint64, value []byte) error {
+		var err error
+		switch tag {
+		case fieldNodeName:
+			name = string(value)
+		case fieldNodePoint:
+			point, err = decodePoint(value)
+		}
+		return err
+	})
+	if err != nil {
+		return "", MetricsPoint{}, fmt.Errorf("failed to decode node record: %w", err)
+	}
+	return name, point, nil
+}
+
+// decodeNodeStatus decodes flags and filesystems of a node record into nodes.
+func decodeNodeStatus(payload []byte, name string, nodes *nodeStorage) error {
+	err := decodeFields(payload, func(tag uint64, value []byte) error {
+		switch tag {
+		case fieldNodePushed, fieldNodeWindows:
+			set, err := decodeUint(value)
+			if err != nil || set == 0 {
+				return err
+			}
+			flags := &nodes.pushed
+			if tag == fieldNodeWindows {
+				flags = &nodes.windows
+			}
+			if *flags == nil {
+				*flags = map[string]bool{}
+			}
+			(*flags)[name] = true
+		case fieldNodeFilesystem:
+			fs, err := decodeFilesystem(value)
+			if err != nil {
+				return err
+			}
+			if nodes.filesystems == nil {
+				nodes.filesystems = map[string][]FilesystemMetricsPoint{}
+			}
+			nodes.filesystems[name] = append(nodes.filesystems[name], fs)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to decode node record: %w", err)
+	}
+	return nil
+}
+
+func decodePod(payload []byte) (apitypes.NamespacedName, PodMetricsPoint, error) {
+	var (
+		ref   apitypes.NamespacedName
+		point PodMetricsPoint
+	)
+	err := decodeFields(payload, func(tag uint64, value []byte) error {
+		var err error
+		switch tag {
+		case fieldPodNamespace:
+			ref.Namespace = string(value)
+		case fieldPodName:
+			ref.Name = string(value)
+		case fieldPodPoint:
+			point.Pod, err = decodePoint(value)
+		case fieldPodContainer:
+			var (
+				name      string
+				container MetricsPoint
+			)
+			err = decodeFields(value, func(tag uint64, value []byte) error {
+				var err error
+				switch tag {
+				case fieldContainerName:
+					name = string(value)
+				case fieldContainerPoint:
+					container, err = decodePoint(value)
+				}
+				return err
+			})
+			if point.Containers == nil {
+				point.Containers = map[string]MetricsPoint{}
+			}
+			point.Containers[name] = container
+		case fieldPodVolume:
+			var volume VolumeMetricsPoint
+			err = decodeFields(value, func(tag uint64, value []byte) error {
+				var err error
+				switch tag {
+				case fieldVolumeClaimName:
+					volume.ClaimName = string(value)
+				case fieldVolumeCapacityBytes:
+					volume.CapacityBytes, err = decodeUint(value)
+				case fieldVolumeUsedBytes:
+					volume.UsedBytes, err = decodeUint(value)
+				}
+				return err
+			})
+			point.Volumes = append(point.Volumes, volume)
+		case fieldPodProcessCount:
+			point.ProcessCount, err = decodeUint(value)
+		case fieldPodNode:
+			point.Node = string(value)
+		case fieldPodFilesystem:
+			var fs FilesystemMetricsPoint
+			fs, err = decodeFilesystem(value)
+			point.Filesystems = append(point.Filesystems, fs)
+		}
+		return err
+	})
+	if err != nil {
+		return apitypes.NamespacedName{}, PodMetricsPoint{}, fmt.Errorf("failed to decode pod record: %w", err)
+	}
+	return ref, point, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+func checkpointSnapshot() Snapshot {
+	start := time.Unix(1600000000, 0)
+	point := MetricsPoint{
+		StartTime:                     start,
+		Timestamp:                     start.Add(10 * time.Second),
+		CumulativeCpuUsed:             10 * CoreSecond,
+		MemoryUsage:                   2 * MiByte,
+		ProcessCount:                  3,
+		CumulativeCfsPeriods:          100,
+		CumulativeCfsThrottledPeriods: 20,
+		CumulativeCfsThrottledTime:    uint64(time.Second),
+	}
+	podRef := apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+	return Snapshot{
+		nodes: nodeStorage{
+			last:        map[string]MetricsPoint{"node1": point, "node2": {StartTime: start, Timestamp: start}},
+			prev:        map[string]MetricsPoint{"node1": {StartTime: start, Timestamp: start}},
+			pushed:      map[string]bool{"node2": true},
+			windows:     map[string]bool{"node1": true},
+			filesystems: map[string][]FilesystemMetricsPoint{"node1": {{Name: FilesystemEphemeralStorage, CapacityBytes: 100 * MiByte, AvailableBytes: 80 * MiByte, UsedBytes: 20 * MiByte}}},
+		},
+		pods: podStorage{
+			last: map[apitypes.NamespacedName]PodMetricsPoint{podRef: {
+				Pod:          point,
+				Containers:   map[string]MetricsPoint{"container1": point, "container2": {StartTime: start, Timestamp: start}},
+				Volumes:      []VolumeMetricsPoint{{ClaimName: "data", CapacityBytes: 10 * MiByte, UsedBytes: MiByte}},
+				ProcessCount: 3,
+				Node:         "node1",
+				Filesystems:  []FilesystemMetricsPoint{{Name: FilesystemEphemeralStorage, CapacityBytes: 10 * MiByte, AvailableBytes: 8 * MiByte, UsedBytes: MiByte}},
+			}},
+			prev: map[apitypes.NamespacedName]PodMetricsPoint{podRef: {
+				Containers: map[string]MetricsPoint{"container1": {StartTime: start, Timestamp: start}, "container2": {StartTime: start, Timestamp: start}},
+			}},
+		},
+	}
+}
+
+var _ = Describe("Checkpoint", func() {
+	It("round trips a snapshot", func() {
+		want := checkpointSnapshot()
+		var buf bytes.Buffer
+		Expect(WriteCheckpoint(&buf, want)).To(Succeed())
+
+		got, err := ReadCheckpoint(&buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(Equal(want))
+	})
+	It("restores storage from a checkpoint", func() {
+		var buf bytes.Buffer
+		Expect(WriteCheckpoint(&buf, checkpointSnapshot())).To(Succeed())
+		snapshot, err := ReadCheckpoint(&buf)
+		Expect(err).NotTo(HaveOccurred())
+
+		s := NewStorage(60 * time.Second)
+		s.Restore(snapshot)
+		Expect(s.Ready()).To(BeTrue())
+		Expect(s.Snapshot().NodeMetrics()).To(HaveLen(1))
+		Expect(s.Snapshot().PodMetrics()).To(HaveLen(1))
+	})
+	It("round trips a batch", func() {
+		snapshot := checkpointSnapshot()
+		want := &MetricsBatch{
+			Nodes:           snapshot.nodes.last,
+			Pods:            snapshot.pods.last,
+			PushedNodes:     snapshot.nodes.pushed,
+			WindowsNodes:    snapshot.nodes.windows,
+			NodeFilesystems: snapshot.nodes.filesystems,
+		}
+		var buf bytes.Buffer
+		Expect(WriteBatch(&buf, want)).To(Succeed())
+
+		got, err := ReadBatch(&buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(Equal(want))
+	})
+	It("replaces checkpoint files", func() {
+		dir, err := os.MkdirTemp("", "checkpoint")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "checkpoint")
+
+		Expect(WriteCheckpointFile(path, Snapshot{})).To(Succeed())
+		Expect(WriteCheckpointFile(path, checkpointSnapshot())).To(Succeed())
+		got, written, err := ReadCheckpointFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(Equal(checkpointSnapshot()))
+		Expect(written).NotTo(BeZero())
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1), "temporary files should be removed")
+	})
+	It("skips records and fields unknown to this version", func() {
+		var e encoder
+		e.buf = append(e.buf, checkpointMagic...)
+		e.uvarint(checkpointMajorVersion)
+		e.uvarint(checkpointMinorVersion + 1)
+		e.message(100, func(e *encoder) { e.string(1, "future record") })
+		e.message(recordNodeLast, func(e *encoder) {
+			e.string(fieldNodeName, "node1")
+			e.string(100, "future field")
+			e.message(fieldNodePoint, func(e *encoder) {
+				e.uint(fieldPointMemoryUsage, MiByte)
+				e.uint(100, 1)
+			})
+		})
+
+		got, err := ReadCheckpoint(bytes.NewReader(e.buf))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.nodes.last).To(Equal(map[string]MetricsPoint{"node1": {MemoryUsage: MiByte}}))
+	})
+	It("rejects a different major version", func() {
+		var e encoder
+		e.buf = append(e.buf, checkpointMagic...)
+		e.uvarint(checkpointMajorVersion + 1)
+		e.uvarint(0)
+
+		_, err := ReadCheckpoint(bytes.NewReader(e.buf))
+		Expect(err).To(MatchError(ContainSubstring("unsupported checkpoint major version")))
+	})
+	It("rejects input that is not a checkpoint", func() {
+		_, err := ReadCheckpoint(bytes.NewReader([]byte(`{"nodes":[]}`)))
+		Expect(err).To(HaveOccurred())
+	})
+	It("rejects records exceeding the size limit", func() {
+		var e encoder
+		e.buf = append(e.buf, checkpointMagic...)
+		e.uvarint(checkpointMajorVersion)
+		e.uvarint(checkpointMinorVersion)
+		e.uvarint(recordNodeLast)
+		e.uvarint(maxCheckpointRecordSize + 1)
+
+		_, err := ReadCheckpoint(bytes.NewReader(e.buf))
+		Expect(err).To(MatchError(ContainSubstring("exceeds limit")))
+	})
+})
+
+func FuzzReadCheckpoint(f *testing.F) {
+	var buf bytes.Buffer
+	if err := WriteCheckpoint(&buf, checkpointSnapshot()); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Add([]byte(checkpointMagic))
+	f.Add(binary.AppendUvarint([]byte(checkpointMagic), checkpointMajorVersion))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		snapshot, err := ReadCheckpoint(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		var out bytes.Buffer
+		if err := WriteCheckpoint(&out, snapshot); err != nil {
+			t.Fatalf("Failed to write decoded checkpoint: %v", err)
+		}
+		got, err := ReadCheckpoint(&out)
+		if err != nil {
+			t.Fatalf("Failed to read re-encoded checkpoint: %v", err)
+		}
+		if !reflect.DeepEqual(got, snapshot) {
+			t.Errorf("Re-encoded checkpoint differs, got %+v, want %+v", got, snapshot)
+		}
+	})
+}
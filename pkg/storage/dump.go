@@ -0,0 +1,136 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// PointDump is a raw point as stored.
+type PointDump struct {
+	StartTime         time.Time `json:"startTime"`
+	Timestamp         time.Time `json:"timestamp"`
+	CumulativeCpuUsed uint64    `json:"cumulativeCpuUsed"`
+	MemoryUsage       uint64    `json:"memoryUsage"`
+}
+
+// SeriesDump holds the raw points stored for a node or a container and the
+// usage calculated from them, before smoothing.
+type SeriesDump struct {
+	// Last is the point of the last scrape.
+	Last PointDump `json:"last"`
+	// Prev is the point of the scrape preceding the last one, nil if none is stored.
+	Prev *PointDump `json:"prev,omitempty"`
+	// Older are points retained before Prev, oldest first.
+	Older []PointDump `json:"older,omitempty"`
+	// Timestamp is the time usage is served for, nil if no usage is served.
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	// Window is the duration usage is calculated over.
+	Window string `json:"window,omitempty"`
+	// Usage is the served usage.
+	Usage corev1.ResourceList `json:"usage,omitempty"`
+	// Reason explains why no usage is served, empty if it is.
+	Reason string `json:"reason,omitempty"`
+}
+
+// NodeDump holds the points stored for a node.
+type NodeDump struct {
+	Name string `json:"name"`
+	SeriesDump
+}
+
+// PodDump holds the points stored for the containers of a pod.
+type PodDump struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Node is the node the pod's metrics were read from.
+	Node       string                `json:"node,omitempty"`
+	Containers map[string]SeriesDump `json:"containers"`
+	// Reason explains why the pod isn't served, empty if it is.
+	Reason string `json:"reason,omitempty"`
+}
+
+// noPrevReason explains why usage of a series with a single point isn't served.
+const noPrevReason = "no point from the previous scrape is stored, usage is served once two consecutive points are"
+
+// DumpNode returns the points stored for node, false if none are.
+func (s Snapshot) DumpNode(name string) (NodeDump, bool) {
+	last, found := s.nodes.last[name]
+	if !found {
+		return NodeDump{}, false
+	}
+	prev, hasPrev := s.nodes.prev[name]
+	return NodeDump{
+		Name:       name,
+		SeriesDump: s.dumpSeries(last, prev, hasPrev, s.nodes.older[name], s.nodes.cpuRateWindow),
+	}, true
+}
+
+// DumpPod returns the points stored for the pod, false if none are.
+func (s Snapshot) DumpPod(namespace, name string) (PodDump, bool) {
+	ref := apitypes.NamespacedName{Namespace: namespace, Name: name}
+	lastPod, found := s.pods.last[ref]
+	if !found {
+		return PodDump{}, false
+	}
+	prevPod, hasPrevPod := s.pods.prev[ref]
+	dump := PodDump{
+		Namespace:  namespace,
+		Name:       name,
+		Node:       lastPod.Node,
+		Containers: make(map[string]SeriesDump, len(lastPod.Containers)),
+	}
+	if !hasPrevPod {
+		dump.Reason = noPrevReason
+	}
+	for container, last := range lastPod.Containers {
+		prev, hasPrev := prevPod.Containers[container]
+		dump.Containers[container] = s.dumpSeries(last, prev, hasPrev, s.pods.older[ref][container], s.pods.cpuRateWindow)
+		if !hasPrev && dump.Reason == "" {
+			dump.Reason = fmt.Sprintf("container %q has no point from the previous scrape, so the pod isn't served", container)
+		}
+	}
+	return dump, true
+}
+
+func (s Snapshot) dumpSeries(last, prev MetricsPoint, hasPrev bool, older []MetricsPoint, cpuRateWindow time.Duration) SeriesDump {
+	dump := SeriesDump{Last: dumpPoint(last)}
+	for _, point := range older {
+		dump.Older = append(dump.Older, dumpPoint(point))
+	}
+	if !hasPrev {
+		dump.Reason = noPrevReason
+		return dump
+	}
+	prevDump := dumpPoint(prev)
+	dump.Prev = &prevDump
+	usage, ti, err := resourceUsage(last, rateBase(older, prev, last, cpuRateWindow), nil)
+	if err != nil {
+		dump.Reason = err.Error()
+		return dump
+	}
+	dump.Timestamp = &ti.Timestamp
+	dump.Window = ti.Window.String()
+	dump.Usage = s.resourceNames.apply(usage)
+	return dump
+}
+
+func dumpPoint(p MetricsPoint) PointDump {
+	return PointDump{StartTime: p.StartTime, Timestamp: p.Timestamp, CumulativeCpuUsed: p.CumulativeCpuUsed, MemoryUsage: p.MemoryUsage}
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Dump", func() {
+	var (
+		s      *storage
+		start  time.Time
+		podRef = apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+	)
+
+	BeforeEach(func() {
+		s = NewStorage(60 * time.Second)
+		start = time.Now()
+	})
+	batch := func(ts time.Duration, cpu uint64, containers ...string) *MetricsBatch {
+		b := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(ts), cpu, 2*MiByte)})
+		points := make([]containerMetricsPoint, 0, len(containers))
+		for _, container := range containers {
+			points = append(points, containerMetricsPoint{container, newMetricsPoint(start, start.Add(ts), cpu, MiByte)})
+		}
+		b.Pods = podMetricsBatch(podMetrics(podRef, points...)).Pods
+		return b
+	}
+
+	It("returns nothing for unknown nodes and pods", func() {
+		_, found := s.Snapshot().DumpNode("node1")
+		Expect(found).To(BeFalse())
+		_, found = s.Snapshot().DumpPod("ns1", "pod1")
+		Expect(found).To(BeFalse())
+	})
+	It("explains why a node with a single point isn't served", func() {
+		s.Store(batch(10*time.Second, 10*CoreSecond))
+		dump, found := s.Snapshot().DumpNode("node1")
+		Expect(found).To(BeTrue())
+		Expect(dump.Last.CumulativeCpuUsed).To(BeEquivalentTo(10 * CoreSecond))
+		Expect(dump.Prev).To(BeNil())
+		Expect(dump.Usage).To(BeEmpty())
+		Expect(dump.Reason).NotTo(BeEmpty())
+	})
+	It("returns points and served usage of a node", func() {
+		s.Store(batch(10*time.Second, 10*CoreSecond))
+		s.Store(batch(20*time.Second, 20*CoreSecond))
+		dump, found := s.Snapshot().DumpNode("node1")
+		Expect(found).To(BeTrue())
+		Expect(dump.Prev.CumulativeCpuUsed).To(BeEquivalentTo(10 * CoreSecond))
+		Expect(dump.Timestamp.Equal(start.Add(20 * time.Second))).To(BeTrue())
+		Expect(dump.Window).To(Equal("10s"))
+		Expect(dump.Usage.Cpu().MilliValue()).To(BeEquivalentTo(1000))
+		Expect(dump.Reason).To(BeEmpty())
+	})
+	It("explains why a pod with a single point isn't served", func() {
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start.Add(-time.Hour), start, 10*CoreSecond, MiByte)})))
+		dump, found := s.Snapshot().DumpPod("ns1", "pod1")
+		Expect(found).To(BeTrue())
+		Expect(dump.Containers).To(HaveKey("container1"))
+		Expect(dump.Containers["container1"].Reason).NotTo(BeEmpty())
+		Expect(dump.Reason).NotTo(BeEmpty())
+	})
+	It("returns points and served usage of pod containers", func() {
+		s.Store(batch(10*time.Second, 10*CoreSecond, "container1", "container2"))
+		s.Store(batch(20*time.Second, 20*CoreSecond, "container1", "container2"))
+		dump, found := s.Snapshot().DumpPod("ns1", "pod1")
+		Expect(found).To(BeTrue())
+		Expect(dump.Containers).To(HaveLen(2))
+		Expect(dump.Containers["container1"].Usage).To(HaveKey(corev1.ResourceCPU))
+		Expect(dump.Reason).To(BeEmpty())
+	})
+})
@@ -0,0 +1,235 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sync"
+	"time"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// tombstoneLifetime is how long points of deleted nodes and pods are dropped,
+// long enough for Kubelets and node agents to stop reporting them.
+const tombstoneLifetime = 10 * time.Minute
+
+// evictions tracks nodes and pods deleted from the API, so their points are
+// dropped from the next stored batch instead of lingering while Kubelets
+// still report them. It has its own lock, so informer handlers marking
+// deletions never wait for Store.
+type evictions struct {
+	mu sync.Mutex
+	// nodes and pods map tombstones to the time they were deleted.
+	nodes map[string]time.Time
+	pods  map[apitypes.NamespacedName]time.Time
+	// now returns the current time, replaced in tests.
+	now func() time.Time
+}
+
+// SetEvictionTTL drops stored points older than ttl, e.g. points of nodes
+// and pods whose deletion was missed that a cache keeps reporting. Storage is
+// swept right away and on every Store. 0 disables it.
+func (s *storage) SetEvictionTTL(ttl time.Duration) {
+	now := s.evictions.time()
+	s.update(func(next *state) {
+		next.evictionTTL = ttl
+		next.sweep(now)
+	})
+}
+
+// EvictNode drops points of a node deleted from the API from the next
+// stored batch, and from following ones until it is added again.
+func (s *storage) EvictNode(name string) {
+	s.evictions.mu.Lock()
+	defer s.evictions.mu.Unlock()
+	if s.evictions.nodes == nil {
+		s.evictions.nodes = map[string]time.Time{}
+	}
+	s.evictions.nodes[name] = s.evictions.time()
+}
+
+// EvictPod drops points of a pod deleted from the API from the next stored
+// batch, and from following ones until it is added again.
+func (s *storage) EvictPod(namespace, name string) {
+	s.evictions.mu.Lock()
+	defer s.evictions.mu.Unlock()
+	if s.evictions.pods == nil {
+		s.evictions.pods = map[apitypes.NamespacedName]time.Time{}
+	}
+	s.evictions.pods[apitypes.NamespacedName{Namespace: namespace, Name: name}] = s.evictions.time()
+}
+
+// ClearNodeEviction stores points of a node again, e.g. after it registered
+// again under the same name.
+func (s *storage) ClearNodeEviction(name string) {
+	s.evictions.mu.Lock()
+	defer s.evictions.mu.Unlock()
+	delete(s.evictions.nodes, name)
+}
+
+// ClearPodEviction stores points of a pod again, e.g. after a StatefulSet
+// recreated it under the same name.
+func (s *storage) ClearPodEviction(namespace, name string) {
+	s.evictions.mu.Lock()
+	defer s.evictions.mu.Unlock()
+	delete(s.evictions.pods, apitypes.NamespacedName{Namespace: namespace, Name: name})
+}
+
+func (e *evictions) time() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+	return time.Now()
+}
+
+// apply returns batch without points of deleted nodes and pods. The batch is
+// copied only if points are dropped, as it may be shared with other consumers.
+// Expired tombstones are removed.
+func (e *evictions) apply(batch *MetricsBatch) *MetricsBatch {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.time()
+	for name, deleted := range e.nodes {
+		if now.Sub(deleted) > tombstoneLifetime {
+			delete(e.nodes, name)
+		}
+	}
+	for ref, deleted := range e.pods {
+		if now.Sub(deleted) > tombstoneLifetime {
+			delete(e.pods, ref)
+		}
+	}
+	if len(e.nodes) == 0 && len(e.pods) == 0 {
+		return batch
+	}
+
+	res := *batch
+	copied := false
+	for name := range batch.Nodes {
+		if _, found := e.nodes[name]; !found {
+			continue
+		}
+		if !copied {
+			res.Nodes = make(map[string]MetricsPoint, len(batch.Nodes))
+			for name, point := range batch.Nodes {
+				res.Nodes[name] = point
+			}
+			copied = true
+		}
+		delete(res.Nodes, name)
+		evictedPoints.WithLabelValues("node", "deleted").Inc()
+	}
+	copied = false
+	for ref := range batch.Pods {
+		if _, found := e.pods[ref]; !found {
+			continue
+		}
+		if !copied {
+			res.Pods = make(map[apitypes.NamespacedName]PodMetricsPoint, len(batch.Pods))
+			for ref, pod := range batch.Pods {
+				res.Pods[ref] = pod
+			}
+			copied = true
+		}
+		delete(res.Pods, ref)
+		evictedPoints.WithLabelValues("pod", "deleted").Inc()
+	}
+	return &res
+}
+
+// sweep drops stored nodes and pods whose last point is older than the
+// eviction TTL, if set.
+func (st *state) sweep(now time.Time) {
+	if st.evictionTTL <= 0 {
+		return
+	}
+	cutoff := now.Add(-st.evictionTTL)
+	nodes := map[string]bool{}
+	for name, point := range st.nodes.last {
+		if point.Timestamp.Before(cutoff) {
+			nodes[name] = true
+		}
+	}
+	pods := map[apitypes.NamespacedName]bool{}
+	for _, last := range []map[apitypes.NamespacedName]PodMetricsPoint{st.pods.last, st.synthetic.last} {
+		for ref, pod := range last {
+			if pod.timestamp().Before(cutoff) {
+				pods[ref] = true
+			}
+		}
+	}
+	if len(nodes) != 0 {
+		st.nodes.evict(nodes)
+		evictedPoints.WithLabelValues("node", "ttl").Add(float64(len(nodes)))
+	}
+	if len(pods) != 0 {
+		st.pods.evict(pods)
+		st.synthetic.evict(pods)
+		evictedPoints.WithLabelValues("pod", "ttl").Add(float64(len(pods)))
+	}
+}
+
+// evict replaces stored maps with copies without nodes, as the current maps
+// may be referenced by published states.
+func (s *nodeStorage) evict(nodes map[string]bool) {
+	s.last = without(s.last, nodes)
+	s.prev = without(s.prev, nodes)
+	s.older = without(s.older, nodes)
+	s.pushed = without(s.pushed, nodes)
+	s.windows = without(s.windows, nodes)
+	s.filesystems = without(s.filesystems, nodes)
+	s.smoothed = without(s.smoothed, nodes)
+}
+
+// evict replaces stored maps with copies without pods, as the current maps
+// may be referenced by published states.
+func (s *podStorage) evict(pods map[apitypes.NamespacedName]bool) {
+	s.last = without(s.last, pods)
+	s.prev = without(s.prev, pods)
+	s.older = without(s.older, pods)
+	s.smoothed = without(s.smoothed, pods)
+}
+
+// without returns a copy of m without keys, or m itself if it has none of them.
+func without[K comparable, V any](m map[K]V, keys map[K]bool) map[K]V {
+	found := false
+	for k := range m {
+		if keys[k] {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return m
+	}
+	res := make(map[K]V, len(m))
+	for k, v := range m {
+		if !keys[k] {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// timestamp returns the timestamp of the most recent point of the pod.
+func (p PodMetricsPoint) timestamp() time.Time {
+	latest := p.Pod.Timestamp
+	for _, c := range p.Containers {
+		if c.Timestamp.After(latest) {
+			latest = c.Timestamp
+		}
+	}
+	return latest
+}
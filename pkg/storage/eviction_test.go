@@ -0,0 +1,111 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Eviction", func() {
+	var (
+		s     *storage
+		now   time.Time
+		start time.Time
+		pod   = apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+	)
+	BeforeEach(func() {
+		s = NewStorage(60 * time.Second)
+		now = time.Now()
+		start = now.Add(-time.Hour)
+		s.evictions.now = func() time.Time { return now }
+	})
+	batch := func(ts time.Time) *MetricsBatch {
+		b := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, ts, 10*CoreSecond, MiByte)})
+		b.Pods = podMetricsBatch(podMetrics(pod, containerMetricsPoint{"container1", newMetricsPoint(start, ts, CoreSecond, MiByte)})).Pods
+		return b
+	}
+
+	It("drops points of deleted nodes and pods until they are added again", func() {
+		s.Store(batch(now.Add(-20 * time.Second)))
+		s.EvictNode("node1")
+		s.EvictPod(pod.Namespace, pod.Name)
+
+		By("dropping points still reported after the deletion")
+		s.Store(batch(now))
+		Expect(s.load().nodes.last).To(BeEmpty())
+		Expect(s.load().pods.last).To(BeEmpty())
+
+		By("storing points again once added again")
+		s.ClearNodeEviction("node1")
+		s.ClearPodEviction(pod.Namespace, pod.Name)
+		s.Store(batch(now.Add(10 * time.Second)))
+		Expect(s.load().nodes.last).To(HaveKey("node1"))
+		Expect(s.load().pods.last).To(HaveKey(pod))
+	})
+	It("only records tombstones on deletion, leaving dropping points to the next Store", func() {
+		s.Store(batch(now.Add(-20 * time.Second)))
+		stored := s.load()
+
+		s.EvictNode("node1")
+		s.EvictPod(pod.Namespace, pod.Name)
+		Expect(s.load()).To(BeIdenticalTo(stored))
+
+		s.Store(batch(now))
+		Expect(s.load().nodes.last).To(BeEmpty())
+		Expect(s.load().pods.last).To(BeEmpty())
+	})
+	It("forgets tombstones after their lifetime", func() {
+		s.EvictNode("node1")
+		s.EvictPod(pod.Namespace, pod.Name)
+		now = now.Add(tombstoneLifetime + time.Second)
+		s.Store(batch(now))
+		Expect(s.load().nodes.last).To(HaveKey("node1"))
+		Expect(s.load().pods.last).To(HaveKey(pod))
+		Expect(s.evictions.nodes).To(BeEmpty())
+		Expect(s.evictions.pods).To(BeEmpty())
+	})
+	It("drops points older than the TTL", func() {
+		s.SetEvictionTTL(5 * time.Minute)
+		s.Store(batch(now.Add(-time.Minute)))
+		Expect(s.load().nodes.last).To(HaveKey("node1"))
+		Expect(s.load().pods.last).To(HaveKey(pod))
+
+		s.Store(batch(now.Add(-6 * time.Minute)))
+		Expect(s.load().nodes.last).To(BeEmpty())
+		Expect(s.load().pods.last).To(BeEmpty())
+	})
+	It("sweeps stored points once the TTL is set", func() {
+		s.Store(batch(now.Add(-6 * time.Minute)))
+		Expect(s.load().nodes.last).To(HaveKey("node1"))
+		Expect(s.load().pods.last).To(HaveKey(pod))
+
+		s.SetEvictionTTL(5 * time.Minute)
+		Expect(s.load().nodes.last).To(BeEmpty())
+		Expect(s.load().pods.last).To(BeEmpty())
+	})
+	It("doesn't modify the stored batch", func() {
+		s.SetEvictionTTL(5 * time.Minute)
+		s.EvictPod(pod.Namespace, pod.Name)
+		b := batch(now.Add(-6 * time.Minute))
+		s.Store(b)
+		Expect(b.Nodes).To(HaveKey("node1"))
+		Expect(b.Pods).To(HaveKey(pod))
+	})
+})
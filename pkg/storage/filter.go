@@ -0,0 +1,65 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Filter excludes nodes and pods from scraped and served metrics. Its rules
+// can change at any time, e.g. when its configuration is reloaded.
+type Filter interface {
+	// KeepNode returns true if node should be scraped and its metrics served.
+	KeepNode(node *corev1.Node) bool
+	// KeepPod returns true if metrics of the pod should be stored and served.
+	KeepPod(namespace, name string) bool
+}
+
+// SetFilter stops serving metrics of nodes and pods excluded by filter, as
+// soon as its rules change. Points already stored are kept until replaced.
+func (s *storage) SetFilter(filter Filter) {
+	s.update(func(next *state) {
+		next.filter = filter
+	})
+}
+
+// filterNodes returns nodes kept by the filter.
+func (st *state) filterNodes(nodes []*corev1.Node) []*corev1.Node {
+	if st.filter == nil {
+		return nodes
+	}
+	kept := make([]*corev1.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if st.filter.KeepNode(node) {
+			kept = append(kept, node)
+		}
+	}
+	return kept
+}
+
+// filterPods returns pods kept by the filter.
+func (st *state) filterPods(pods []*metav1.PartialObjectMetadata) []*metav1.PartialObjectMetadata {
+	if st.filter == nil {
+		return pods
+	}
+	kept := make([]*metav1.PartialObjectMetadata, 0, len(pods))
+	for _, pod := range pods {
+		if st.filter.KeepPod(pod.Namespace, pod.Name) {
+			kept = append(kept, pod)
+		}
+	}
+	return kept
+}
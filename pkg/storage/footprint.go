@@ -0,0 +1,114 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"unsafe"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	pointSize    = int(unsafe.Sizeof(MetricsPoint{}))
+	podPointSize = int(unsafe.Sizeof(PodMetricsPoint{}))
+)
+
+// recordFootprint updates gauges of the number of stored entries and the
+// memory they hold.
+func (st *state) recordFootprint() {
+	containers := 0
+	for _, pod := range st.pods.last {
+		containers += len(pod.Containers)
+	}
+	storedEntries.WithLabelValues("node").Set(float64(len(st.nodes.last)))
+	storedEntries.WithLabelValues("pod").Set(float64(len(st.pods.last)))
+	storedEntries.WithLabelValues("container").Set(float64(containers))
+	storedBytes.WithLabelValues("node").Set(float64(st.nodes.approximateBytes()))
+	storedBytes.WithLabelValues("pod").Set(float64(st.pods.approximateBytes()))
+}
+
+// recordChurn counts entries of next absent from prev as inserted and entries
+// of prev absent from next as removed.
+func recordChurn(prev, next *state) {
+	nodesInserted, nodesRemoved := 0, 0
+	for name := range next.nodes.last {
+		if _, found := prev.nodes.last[name]; !found {
+			nodesInserted++
+		}
+	}
+	for name := range prev.nodes.last {
+		if _, found := next.nodes.last[name]; !found {
+			nodesRemoved++
+		}
+	}
+	podsInserted, containersInserted := countAbsent(next.pods.last, prev.pods.last)
+	podsRemoved, containersRemoved := countAbsent(prev.pods.last, next.pods.last)
+	insertedEntries.WithLabelValues("node").Add(float64(nodesInserted))
+	insertedEntries.WithLabelValues("pod").Add(float64(podsInserted))
+	insertedEntries.WithLabelValues("container").Add(float64(containersInserted))
+	removedEntries.WithLabelValues("node").Add(float64(nodesRemoved))
+	removedEntries.WithLabelValues("pod").Add(float64(podsRemoved))
+	removedEntries.WithLabelValues("container").Add(float64(containersRemoved))
+}
+
+// countAbsent returns the number of pods and containers of pods absent from other.
+func countAbsent(pods, other map[apitypes.NamespacedName]PodMetricsPoint) (podCount, containerCount int) {
+	for ref, pod := range pods {
+		otherPod, found := other[ref]
+		if !found {
+			podCount++
+		}
+		for name := range pod.Containers {
+			if _, found := otherPod.Containers[name]; !found {
+				containerCount++
+			}
+		}
+	}
+	return podCount, containerCount
+}
+
+// approximateBytes returns the memory held by stored points and node names.
+func (s *nodeStorage) approximateBytes() int {
+	bytes := 0
+	for _, points := range []map[string]MetricsPoint{s.last, s.prev} {
+		for name := range points {
+			bytes += len(name) + pointSize
+		}
+	}
+	for name, older := range s.older {
+		bytes += len(name) + len(older)*pointSize
+	}
+	return bytes
+}
+
+// approximateBytes returns the memory held by stored points, pod and container names.
+func (s *podStorage) approximateBytes() int {
+	bytes := 0
+	for _, pods := range []map[apitypes.NamespacedName]PodMetricsPoint{s.last, s.prev} {
+		for ref, pod := range pods {
+			bytes += len(ref.Namespace) + len(ref.Name) + podPointSize
+			for name := range pod.Containers {
+				bytes += len(name) + pointSize
+			}
+		}
+	}
+	for ref, containers := range s.older {
+		bytes += len(ref.Namespace) + len(ref.Name)
+		for name, older := range containers {
+			bytes += len(name) + len(older)*pointSize
+		}
+	}
+	return bytes
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+var _ = Describe("Footprint", func() {
+	It("reports stored entries, their memory and churn", func() {
+		storedEntries.Create(nil)
+		storedBytes.Create(nil)
+		insertedEntries.Create(nil)
+		removedEntries.Create(nil)
+		storedEntries.Reset()
+		storedBytes.Reset()
+		insertedEntries.Reset()
+		removedEntries.Reset()
+		s := NewStorage(60 * time.Second)
+		start := time.Now()
+		pod := apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+
+		By("storing node1 and a pod with two containers")
+		b := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(10*time.Second), 10*CoreSecond, MiByte)})
+		b.Pods = podMetricsBatch(podMetrics(pod,
+			containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(10*time.Second), CoreSecond, MiByte)},
+			containerMetricsPoint{"container2", newMetricsPoint(start, start.Add(10*time.Second), CoreSecond, MiByte)},
+		)).Pods
+		s.Store(b)
+
+		By("replacing node1 by node2 and dropping a container")
+		b = nodeMetricBatch(nodeMetricsPoint{"node2", newMetricsPoint(start, start.Add(20*time.Second), 20*CoreSecond, MiByte)})
+		b.Pods = podMetricsBatch(podMetrics(pod,
+			containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(20*time.Second), 2*CoreSecond, MiByte)},
+		)).Pods
+		s.Store(b)
+
+		err := testutil.CollectAndCompare(storedEntries, strings.NewReader(`
+		# HELP metrics_server_storage_entries [ALPHA] Number of nodes, pods and containers with metrics held in memory, including ones without enough points to be served.
+		# TYPE metrics_server_storage_entries gauge
+		metrics_server_storage_entries{type="container"} 1
+		metrics_server_storage_entries{type="node"} 1
+		metrics_server_storage_entries{type="pod"} 1
+		`), "metrics_server_storage_entries")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = testutil.CollectAndCompare(insertedEntries, strings.NewReader(`
+		# HELP metrics_server_storage_inserts_total [ALPHA] Number of nodes, pods and containers added to storage because they were absent from the previous scrape.
+		# TYPE metrics_server_storage_inserts_total counter
+		metrics_server_storage_inserts_total{type="container"} 2
+		metrics_server_storage_inserts_total{type="node"} 2
+		metrics_server_storage_inserts_total{type="pod"} 1
+		`), "metrics_server_storage_inserts_total")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = testutil.CollectAndCompare(removedEntries, strings.NewReader(`
+		# HELP metrics_server_storage_removals_total [ALPHA] Number of nodes, pods and containers dropped from storage because they were absent from the last scrape.
+		# TYPE metrics_server_storage_removals_total counter
+		metrics_server_storage_removals_total{type="container"} 1
+		metrics_server_storage_removals_total{type="node"} 1
+		metrics_server_storage_removals_total{type="pod"} 0
+		`), "metrics_server_storage_removals_total")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("accounting points of the last and previous scrapes")
+		nodeBytes, err := testutil.GetGaugeMetricValue(storedBytes.WithLabelValues("node"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodeBytes).To(BeEquivalentTo(len("node2") + pointSize))
+		podBytes, err := testutil.GetGaugeMetricValue(storedBytes.WithLabelValues("pod"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(podBytes).To(BeEquivalentTo(2 * (len("ns1") + len("pod1") + podPointSize + len("container1") + pointSize)))
+	})
+})
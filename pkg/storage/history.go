@@ -0,0 +1,105 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// SetHistoryLength sets the number of recent stores kept to serve metrics history.
+// As stored maps are never modified, keeping a store only keeps references to its points.
+func (s *storage) SetHistoryLength(n int) {
+	s.update(func(next *state) {
+		next.historyLength = n
+		next.trimHistory()
+	})
+}
+
+// recordHistory appends the points of st to its history, st must not be published yet.
+func (st *state) recordHistory() {
+	if st.historyLength <= 0 {
+		return
+	}
+	// Copy, as the history of published states must not be modified.
+	history := make([]Snapshot, 0, len(st.history)+1)
+	history = append(history, st.history...)
+	st.history = append(history, Snapshot{nodes: st.nodes, pods: st.pods})
+	st.trimHistory()
+}
+
+func (st *state) trimHistory() {
+	if excess := len(st.history) - st.historyLength; excess > 0 {
+		// Copy to allow garbage collection of dropped snapshots.
+		st.history = append([]Snapshot(nil), st.history[excess:]...)
+	}
+}
+
+// states returns stored states from oldest to the current one.
+func (st *state) states() []Snapshot {
+	if len(st.history) == 0 {
+		return []Snapshot{{nodes: st.nodes, pods: st.pods}}
+	}
+	return st.history
+}
+
+// GetNodeMetricsHistory returns node metrics for each kept store, oldest first.
+// Stores in which the node was not scraped again are skipped.
+func (s *storage) GetNodeMetricsHistory(node *corev1.Node) ([]metrics.NodeMetrics, error) {
+	st := s.load()
+	var results []metrics.NodeMetrics
+	if len(st.filterNodes([]*corev1.Node{node})) == 0 {
+		return results, nil
+	}
+	for _, state := range st.states() {
+		ms, err := state.nodes.GetMetrics(st.logger, nil, node)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range ms {
+			if len(results) != 0 && !m.Timestamp.After(results[len(results)-1].Timestamp.Time) {
+				continue
+			}
+			results = append(results, m)
+		}
+	}
+	st.resourceNames.applyNodes(results)
+	return results, nil
+}
+
+// GetPodMetricsHistory returns pod metrics for each kept store, oldest first.
+// Stores in which the pod was not scraped again are skipped.
+func (s *storage) GetPodMetricsHistory(pod *metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+	st := s.load()
+	var results []metrics.PodMetrics
+	if len(st.filterPods([]*metav1.PartialObjectMetadata{pod})) == 0 {
+		return results, nil
+	}
+	for _, state := range st.states() {
+		ms, err := state.pods.GetMetrics(st.logger, nil, pod)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range ms {
+			if len(results) != 0 && !m.Timestamp.After(results[len(results)-1].Timestamp.Time) {
+				continue
+			}
+			results = append(results, m)
+		}
+	}
+	st.resourceNames.applyPods(results)
+	return results, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("History", func() {
+	start := time.Now()
+	podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	pod := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}}
+	batch := func(ts time.Duration, cpu uint64) *MetricsBatch {
+		b := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(ts), cpu, 2*MiByte)})
+		b.Pods = podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(ts), cpu, 1*MiByte)})).Pods
+		return b
+	}
+
+	It("returns only the latest metrics when disabled", func() {
+		s := NewStorage(60 * time.Second)
+		s.Store(batch(110*time.Second, 10*CoreSecond))
+		s.Store(batch(120*time.Second, 20*CoreSecond))
+		s.Store(batch(130*time.Second, 50*CoreSecond))
+
+		nodes, err := s.GetNodeMetricsHistory(node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodes).To(HaveLen(1))
+		Expect(nodes[0].Usage[corev1.ResourceCPU]).To(Equal(*resource.NewScaledQuantity(3*CoreSecond, -9)))
+	})
+	It("returns metrics of kept stores oldest first", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetHistoryLength(2)
+		s.Store(batch(110*time.Second, 10*CoreSecond))
+		s.Store(batch(120*time.Second, 20*CoreSecond))
+		s.Store(batch(130*time.Second, 50*CoreSecond))
+		s.Store(batch(140*time.Second, 60*CoreSecond))
+
+		nodes, err := s.GetNodeMetricsHistory(node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodes).To(HaveLen(2))
+		Expect(nodes[0].Usage[corev1.ResourceCPU]).To(Equal(*resource.NewScaledQuantity(3*CoreSecond, -9)))
+		Expect(nodes[1].Usage[corev1.ResourceCPU]).To(Equal(*resource.NewScaledQuantity(CoreSecond, -9)))
+		pods, err := s.GetPodMetricsHistory(pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pods).To(HaveLen(2))
+		Expect(pods[0].Containers[0].Usage[corev1.ResourceCPU]).To(Equal(*resource.NewScaledQuantity(3*CoreSecond, -9)))
+		Expect(pods[1].Containers[0].Usage[corev1.ResourceCPU]).To(Equal(*resource.NewScaledQuantity(CoreSecond, -9)))
+	})
+	It("skips stores without a new point", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetHistoryLength(3)
+		s.Store(batch(110*time.Second, 10*CoreSecond))
+		s.Store(batch(120*time.Second, 20*CoreSecond))
+		s.Store(batch(120*time.Second, 20*CoreSecond))
+
+		nodes, err := s.GetNodeMetricsHistory(node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nodes).To(HaveLen(1))
+	})
+})
@@ -18,6 +18,16 @@ import "sigs.k8s.io/metrics-server/pkg/api"
 
 type Storage interface {
 	api.MetricsGetter
+	api.HistoryGetter
 	Store(batch *MetricsBatch)
 	Ready() bool
+	NodesReady() bool
+	PodsReady() bool
+	// Snapshot returns a view of stored metrics that can be read without blocking Store.
+	Snapshot() Snapshot
+	// Restore replaces stored metrics with the ones of snapshot.
+	Restore(snapshot Snapshot)
 }
+
+var _ api.NodeResourceMetricsGetter = (*storage)(nil)
+var _ api.PodResourceMetricsGetter = (*storage)(nil)
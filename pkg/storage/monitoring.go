@@ -28,10 +28,80 @@ var (
 		},
 		[]string{"type"},
 	)
+	counterResets = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "counter_resets_total",
+			Help:      "Number of resets of cumulative counters detected between consecutive points, e.g. on container or Kubelet restarts.",
+		},
+		[]string{"type"},
+	)
+	evictedPoints = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "evictions_total",
+			Help:      "Number of nodes and pods whose points were dropped, because they were deleted from the API or their points are older than the eviction TTL.",
+		},
+		[]string{"type", "reason"},
+	)
+	storedEntries = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "entries",
+			Help:      "Number of nodes, pods and containers with metrics held in memory, including ones without enough points to be served.",
+		},
+		[]string{"type"},
+	)
+	storedBytes = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "approximate_memory_bytes",
+			Help:      "Approximate memory held by stored node and pod metrics points in bytes, not accounting for map overhead.",
+		},
+		[]string{"type"},
+	)
+	insertedEntries = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "inserts_total",
+			Help:      "Number of nodes, pods and containers added to storage because they were absent from the previous scrape.",
+		},
+		[]string{"type"},
+	)
+	removedEntries = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "removals_total",
+			Help:      "Number of nodes, pods and containers dropped from storage because they were absent from the last scrape.",
+		},
+		[]string{"type"},
+	)
+	writeLockDuration = metrics.NewHistogram(
+		&metrics.HistogramOpts{
+			Namespace: "metrics_server",
+			Subsystem: "storage",
+			Name:      "write_lock_duration_seconds",
+			Help:      "Time the storage write lock is held by writers, e.g. to store the metrics of a scrape cycle. Reads are not blocked meanwhile.",
+			Buckets:   metrics.ExponentialBuckets(1e-5, 4, 10),
+		},
+	)
 )
 
-// RegisterStorageMetrics registers a gauge metric for the number of metrics
-// points stored.
+// RegisterStorageMetrics registers gauge metrics for the number of metrics
+// points and entries stored and their memory footprint, counters of detected
+// counter resets, evicted points and inserted and removed entries, and a
+// histogram of the time publishing stored metrics takes.
 func RegisterStorageMetrics(registrationFunc func(metrics.Registerable) error) error {
-	return registrationFunc(pointsStored)
+	for _, metric := range []metrics.Registerable{pointsStored, counterResets, evictedPoints, storedEntries, storedBytes, insertedEntries, removedEntries, writeLockDuration} {
+		if err := registrationFunc(metric); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -22,9 +22,11 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
 )
 
-// nodeStorage stores last two node metric batches and calculates cpu & memory usage
+// nodeStorage stores the last node metric batches, two by default, and calculates cpu & memory usage
 //
 // This implementation only stores metric points if they are newer than the
 // points already stored and the cpuUsageOverTime function used to handle
@@ -35,9 +37,25 @@ type nodeStorage struct {
 	// prev stores node metric points from scrape preceding the last one.
 	// Points timestamp should proceed the corresponding points from last.
 	prev map[string]MetricsPoint
+	// pushed stores nodes of last whose metrics were pushed by a node agent.
+	pushed map[string]bool
+	// windows stores nodes of last whose metrics were read from a Windows Kubelet.
+	windows map[string]bool
+	// filesystems stores usage of filesystems of nodes of last, if collected.
+	filesystems map[string][]FilesystemMetricsPoint
+	// older stores node metric points preceding prev, oldest first, up to retained-2 per node.
+	older map[string][]MetricsPoint
+	// retained is the number of points kept per node, including last and prev. Values below 2 keep 2.
+	retained int
+	// cpuRateWindow is the trailing window CPU usage is calculated over, 0 for the last two points.
+	cpuRateWindow time.Duration
+	// halfLife is the half-life of the moving average of served usage, 0 disables it.
+	halfLife time.Duration
+	// smoothed stores the moving average of usage per node when halfLife is set.
+	smoothed map[string]smoothedUsage
 }
 
-func (s *nodeStorage) GetMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
+func (s *nodeStorage) GetMetrics(logger klog.Logger, resources resourceSet, nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
 	results := make([]metrics.NodeMetrics, 0, len(nodes))
 	for _, node := range nodes {
 		last, found := s.last[node.Name]
@@ -49,12 +67,15 @@ func (s *nodeStorage) GetMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics,
 		if !found {
 			continue
 		}
-		rl, ti, err := resourceUsage(last, prev)
+		rl, ti, err := resourceUsage(last, rateBase(s.older[node.Name], prev, last, s.cpuRateWindow), resources)
 		if err != nil {
-			klog.ErrorS(err, "Skipping node usage metric", "node", node)
+			logger.Error(err, "Skipping node usage metric", "node", klog.KObj(node))
 			continue
 		}
-		results = append(results, metrics.NodeMetrics{
+		if u, found := s.smoothed[node.Name]; found {
+			u.apply(rl)
+		}
+		nm := metrics.NodeMetrics{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:              node.Name,
 				Labels:            node.Labels,
@@ -63,41 +84,90 @@ func (s *nodeStorage) GetMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics,
 			Timestamp: metav1.NewTime(ti.Timestamp),
 			Window:    metav1.Duration{Duration: ti.Window},
 			Usage:     rl,
-		})
+		}
+		annotateFilesystems(logger, &nm.ObjectMeta, s.filesystems[node.Name])
+		if s.pushed[node.Name] {
+			annotations.Set(&nm.Annotations, annotations.Pushed, "true")
+		}
+		if s.windows[node.Name] {
+			annotations.Set(&nm.Annotations, annotations.Windows, "true")
+		}
+		results = append(results, nm)
 	}
 	return results, nil
 }
 
-func (s *nodeStorage) Store(batch *MetricsBatch) {
+func (s *nodeStorage) Store(logger klog.Logger, batch *MetricsBatch) {
 	lastNodes := make(map[string]MetricsPoint, len(batch.Nodes))
 	prevNodes := make(map[string]MetricsPoint, len(batch.Nodes))
+	var olderNodes map[string][]MetricsPoint
+	var pushed, windows map[string]bool
+	var filesystems map[string][]FilesystemMetricsPoint
 	for nodeName, newPoint := range batch.Nodes {
 		if _, exists := lastNodes[nodeName]; exists {
-			klog.ErrorS(nil, "Got duplicate node point", "node", klog.KRef("", nodeName))
+			logger.Error(nil, "Got duplicate node point", "node", klog.KRef("", nodeName))
 			continue
 		}
 		lastNodes[nodeName] = newPoint
+		if batch.PushedNodes[nodeName] {
+			if pushed == nil {
+				pushed = map[string]bool{}
+			}
+			pushed[nodeName] = true
+		}
+		if batch.WindowsNodes[nodeName] {
+			if windows == nil {
+				windows = map[string]bool{}
+			}
+			windows[nodeName] = true
+		}
+		if fs := batch.NodeFilesystems[nodeName]; len(fs) != 0 {
+			if filesystems == nil {
+				filesystems = map[string][]FilesystemMetricsPoint{}
+			}
+			filesystems[nodeName] = fs
+		}
 
+		var older []MetricsPoint
 		if lastNode, found := s.last[nodeName]; found {
-			// If new point is different then one already stored
-			if newPoint.Timestamp.After(lastNode.Timestamp) {
-				// Move stored point to previous
+			if counterReset(lastNode, newPoint) {
+				counterResets.WithLabelValues("node").Inc()
+				if reset, ok := resetPoint(lastNode, newPoint); ok {
+					prevNodes[nodeName] = reset
+				}
+			} else if newPoint.Timestamp.After(lastNode.Timestamp) {
+				// If new point is different then one already stored, move stored point to previous
 				prevNodes[nodeName] = lastNode
+				if prevPoint, found := s.prev[nodeName]; found {
+					older = retainOlder(s.older[nodeName], prevPoint, s.retained)
+				}
 			} else if prevPoint, found := s.prev[nodeName]; found {
 				if prevPoint.Timestamp.Before(newPoint.Timestamp) {
 					// Keep previous point
 					prevNodes[nodeName] = prevPoint
+					older = s.older[nodeName]
 				} else {
-					klog.V(2).InfoS("Found new node metrics point is older than stored previous, drop previous",
+					logger.V(2).Info("Found new node metrics point is older than stored previous, drop previous",
 						"node", nodeName,
 						"previousTimestamp", prevPoint.Timestamp,
 						"timestamp", newPoint.Timestamp)
 				}
 			}
 		}
+		if len(older) != 0 {
+			if olderNodes == nil {
+				olderNodes = map[string][]MetricsPoint{}
+			}
+			olderNodes[nodeName] = older
+		}
 	}
 	s.last = lastNodes
 	s.prev = prevNodes
+	s.older = olderNodes
+	s.pushed = pushed
+	s.windows = windows
+	s.filesystems = filesystems
+	s.updateSmoothed()
 
 	// Only count last for which metrics can be returned.
 	pointsStored.WithLabelValues("node").Set(float64(len(prevNodes)))
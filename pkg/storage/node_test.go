@@ -24,7 +24,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics"
 	"k8s.io/component-base/metrics/testutil"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
 )
 
 var _ = Describe("Node storage", func() {
@@ -44,6 +47,8 @@ var _ = Describe("Node storage", func() {
 
 		By("becoming ready and returning metric for node1")
 		Expect(s.Ready()).To(BeTrue())
+		Expect(s.NodesReady()).To(BeTrue())
+		Expect(s.PodsReady()).NotTo(BeTrue())
 		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
 		Expect(err).NotTo(HaveOccurred())
 		Expect(ms).To(HaveLen(1))
@@ -64,6 +69,191 @@ var _ = Describe("Node storage", func() {
 		By("return empty result for node1")
 		checkNodeResponseEmpty(s, "node1")
 	})
+	It("serves resources under configured names", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetResourceNames(ResourceNames{ResourcePID: "example.com/processes"})
+		nodeStart := time.Now()
+
+		By("storing two batches with process count")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(10*time.Second), 10*CoreSecond, 2*MiByte)}))
+		last := newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 20*CoreSecond, 3*MiByte)
+		last.ProcessCount = 412
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", last}))
+
+		By("returning pid usage under its configured name, in metrics and snapshots")
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Usage).To(HaveKey(corev1.ResourceName("example.com/processes")))
+		Expect(ms[0].Usage).NotTo(HaveKey(ResourcePID))
+		Expect(s.Snapshot().NodeMetrics()[0].Usage).To(Equal(ms[0].Usage))
+	})
+	It("computes usage of requested resources only", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetResourceNames(ResourceNames{ResourcePID: "example.com/processes"})
+		nodeStart := time.Now()
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(10*time.Second), 10*CoreSecond, 2*MiByte)}))
+		last := newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 20*CoreSecond, 3*MiByte)
+		last.ProcessCount = 412
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", last}))
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+
+		ms, err := s.GetNodeResourceMetrics([]corev1.ResourceName{corev1.ResourceMemory}, node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Usage).To(Equal(corev1.ResourceList{corev1.ResourceMemory: *resource.NewQuantity(3*MiByte, resource.BinarySI)}))
+
+		By("selecting renamed resources by their served name")
+		ms, err = s.GetNodeResourceMetrics([]corev1.ResourceName{"example.com/processes"}, node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Usage).To(Equal(corev1.ResourceList{"example.com/processes": *resource.NewQuantity(412, resource.DecimalSI)}))
+	})
+	It("stops serving nodes excluded by the filter right away", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetHistoryLength(2)
+		filter := &fakeFilter{}
+		s.SetFilter(filter)
+		nodeStart := time.Now()
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(10*time.Second), 10*CoreSecond, 2*MiByte)}))
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 20*CoreSecond, 3*MiByte)}))
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+
+		ms, err := s.GetNodeMetrics(node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+
+		By("excluding the node without storing a new batch")
+		filter.excludedNodes = map[string]bool{"node1": true}
+		ms, err = s.GetNodeMetrics(node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(BeEmpty())
+		history, err := s.GetNodeMetricsHistory(node)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(BeEmpty())
+	})
+	It("reports process count as pid usage when collected", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+
+		By("storing two batches, last one with process count")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(10*time.Second), 10*CoreSecond, 2*MiByte)}))
+		last := newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 20*CoreSecond, 3*MiByte)
+		last.ProcessCount = 412
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", last}))
+
+		By("returning pid usage along cpu and memory")
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Usage).Should(BeEquivalentTo(
+			corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(3*MiByte, resource.BinarySI),
+				ResourcePID:           *resource.NewQuantity(412, resource.DecimalSI),
+			},
+		))
+	})
+	It("annotates metrics of nodes pushed by node agents", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+
+		By("storing a scraped batch followed by a pushed one")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(10*time.Second), 10*CoreSecond, 2*MiByte)}))
+		batch := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 20*CoreSecond, 3*MiByte)})
+		batch.PushedNodes = map[string]bool{"node1": true}
+		s.Store(batch)
+
+		By("annotating the node as pushed")
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{annotations.Pushed: "true"}))
+
+		By("dropping the annotation once the node is scraped again")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(30*time.Second), 30*CoreSecond, 3*MiByte)}))
+		ms, err = s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(BeEmpty())
+	})
+	It("annotates metrics of Windows nodes", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+
+		By("storing two batches of a Windows node")
+		for i := 1; i <= 2; i++ {
+			batch := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(time.Duration(i)*10*time.Second), uint64(i)*10*CoreSecond, 2*MiByte)})
+			batch.WindowsNodes = map[string]bool{"node1": true}
+			s.Store(batch)
+		}
+
+		By("annotating the node as Windows")
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{annotations.Windows: "true"}))
+	})
+	It("annotates filesystem usage of nodes", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+
+		By("storing two batches, last one with filesystem usage")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(10*time.Second), 10*CoreSecond, 2*MiByte)}))
+		batch := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 20*CoreSecond, 2*MiByte)})
+		batch.NodeFilesystems = map[string][]FilesystemMetricsPoint{"node1": {
+			{Name: FilesystemNode, CapacityBytes: 10 * MiByte, AvailableBytes: 6 * MiByte, UsedBytes: 4 * MiByte},
+			{Name: FilesystemImage, CapacityBytes: 8 * MiByte, AvailableBytes: 7 * MiByte, UsedBytes: MiByte},
+		}}
+		s.Store(batch)
+
+		By("returning filesystem usage sorted by name")
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{
+			annotations.Filesystems: `[{"name":"imagefs","capacityBytes":8388608,"availableBytes":7340032,"usedBytes":1048576},{"name":"nodefs","capacityBytes":10485760,"availableBytes":6291456,"usedBytes":4194304}]`,
+		}))
+	})
+	It("serves stored metrics while storing the next batches", func() {
+		s := NewStorage(60 * time.Second)
+		registry := metrics.NewKubeRegistry()
+		Expect(RegisterStorageMetrics(registry.Register)).To(Succeed())
+		nodeStart := time.Now()
+		batch := func(i int) *MetricsBatch {
+			ts := nodeStart.Add(time.Duration(i) * 10 * time.Second)
+			return nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, ts, uint64(i)*CoreSecond, 2*MiByte)})
+		}
+		s.Store(batch(1))
+		s.Store(batch(2))
+
+		By("reading metrics concurrently with stores")
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			for i := 3; i < 100; i++ {
+				s.Store(batch(i))
+			}
+		}()
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+		for stored := false; !stored; {
+			select {
+			case <-done:
+				stored = true
+			default:
+			}
+			ms, err := s.GetNodeMetrics(node)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ms).To(HaveLen(1))
+			Expect(ms[0].Window.Duration).To(Equal(10 * time.Second))
+		}
+
+		By("observing the write lock once per store")
+		histogram, err := testutil.GetHistogramVecFromGatherer(registry, "metrics_server_storage_write_lock_duration_seconds", nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(histogram.GetAggregatedSampleCount()).To(BeEquivalentTo(99))
+	})
 	It("handle repeated node metric point", func() {
 		s := NewStorage(60 * time.Second)
 		nodeStart := time.Now()
@@ -123,7 +313,7 @@ var _ = Describe("Node storage", func() {
 		By("return empty result for restarted node1")
 		checkNodeResponseEmpty(s, "node1")
 	})
-	It("should return empty node metrics if decreased data point reported", func() {
+	It("should calculate node metrics from the reset if decreased data point reported", func() {
 		s := NewStorage(60 * time.Second)
 		nodeStart := time.Now()
 
@@ -133,7 +323,29 @@ var _ = Describe("Node storage", func() {
 		By("storing CPU usage decreased last metrics")
 		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(25*time.Second), 10*CoreSecond, 5*MiByte)}))
 
-		By("should get empty metrics when cpu metrics decrease")
+		By("calculating usage since the previous point")
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).Should(HaveLen(1))
+		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(10 * time.Second))
+		Expect(ms[0].Usage).Should(BeEquivalentTo(
+			corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(5*MiByte, resource.BinarySI),
+			},
+		))
+	})
+	It("should return empty node metrics if decreased data point reported right after previous", func() {
+		s := NewStorage(60 * time.Second)
+		nodeStart := time.Now()
+
+		By("storing previous metrics")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(15*time.Second), 50*CoreSecond, 3*MiByte)}))
+
+		By("storing CPU usage decreased last metrics")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(nodeStart, nodeStart.Add(20*time.Second), 10*CoreSecond, 5*MiByte)}))
+
+		By("should get empty metrics when the reset is too recent")
 		checkNodeResponseEmpty(s, "node1")
 	})
 	It("should handle metrics older than prev", func() {
@@ -235,3 +447,16 @@ type nodeMetricsPoint struct {
 	Name string
 	MetricsPoint
 }
+
+type fakeFilter struct {
+	excludedNodes      map[string]bool
+	excludedNamespaces map[string]bool
+}
+
+func (f *fakeFilter) KeepNode(node *corev1.Node) bool {
+	return !f.excludedNodes[node.Name]
+}
+
+func (f *fakeFilter) KeepPod(namespace, _ string) bool {
+	return !f.excludedNamespaces[namespace]
+}
@@ -16,21 +16,26 @@
 package storage
 
 import (
+	"encoding/json"
+	"sort"
+	"strconv"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 	"k8s.io/metrics/pkg/apis/metrics"
 
-	"sigs.k8s.io/metrics-server/pkg/api"
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
 )
 
 // fresh new container's minimum allowable time duration between start time and timestamp.
 // if time duration less than 10s, can produce inaccurate data
 const freshContainerMinMetricsResolution = 10 * time.Second
 
-// nodeStorage stores last two pod metric batches and calculates cpu & memory usage
+// podStorage stores the last pod metric batches, two by default, and calculates cpu & memory usage
 //
 // This implementation only stores metric points if they are newer than the
 // points already stored and the cpuUsageOverTime function used to handle
@@ -41,26 +46,38 @@ type podStorage struct {
 	// prev stores pod metric points from scrape preceding the last one.
 	// Points timestamp should proceed the corresponding points from last and have same start time (no restart between them).
 	prev map[apitypes.NamespacedName]PodMetricsPoint
+	// older stores container metric points preceding the ones in prev, oldest first, up to retained-2 per container.
+	older map[apitypes.NamespacedName]map[string][]MetricsPoint
+	// retained is the number of points kept per container, including last and prev. Values below 2 keep 2.
+	retained int
+	// cpuRateWindow is the trailing window CPU usage is calculated over, 0 for the last two points.
+	cpuRateWindow time.Duration
+	// halfLife is the half-life of the moving average of served usage, 0 disables it.
+	halfLife time.Duration
+	// smoothed stores the moving average of usage per container when halfLife is set.
+	smoothed map[apitypes.NamespacedName]map[string]smoothedUsage
 	// scrape period of metrics server
 	metricResolution time.Duration
 }
 
-func (s *podStorage) GetMetrics(pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+func (s *podStorage) GetMetrics(logger klog.Logger, resources resourceSet, pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
 	results := make([]metrics.PodMetrics, 0, len(pods))
 	for _, pod := range pods {
-		lastPod, found := s.last[apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}]
+		podRef := apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}
+		lastPod, found := s.last[podRef]
 		if !found {
 			continue
 		}
 
-		prevPod, found := s.prev[apitypes.NamespacedName{Name: pod.Name, Namespace: pod.Namespace}]
+		prevPod, found := s.prev[podRef]
 		if !found {
 			continue
 		}
 
 		var (
 			cms              = make([]metrics.ContainerMetrics, 0, len(lastPod.Containers))
-			earliestTimeInfo api.TimeInfo
+			throttled        []annotations.ContainerThrottling
+			earliestTimeInfo TimeInfo
 		)
 		allContainersPresent := true
 		for container, lastContainer := range lastPod.Containers {
@@ -69,21 +86,28 @@ func (s *podStorage) GetMetrics(pods ...*metav1.PartialObjectMetadata) ([]metric
 				allContainersPresent = false
 				break
 			}
-			usage, ti, err := resourceUsage(lastContainer, prevContainer)
+			prevContainer = rateBase(s.older[podRef][container], prevContainer, lastContainer, s.cpuRateWindow)
+			usage, ti, err := resourceUsage(lastContainer, prevContainer, resources)
 			if err != nil {
-				klog.ErrorS(err, "Skipping container usage metric", "container", container, "pod", klog.KRef(pod.Namespace, pod.Name))
+				logger.Error(err, "Skipping container usage metric", "container", container, "pod", klog.KRef(pod.Namespace, pod.Name))
 				continue
 			}
+			if u, found := s.smoothed[podRef][container]; found {
+				u.apply(usage)
+			}
 			cms = append(cms, metrics.ContainerMetrics{
 				Name:  container,
 				Usage: usage,
 			})
+			if t, ok := throttlingRate(container, lastContainer, prevContainer, ti.Window); ok {
+				throttled = append(throttled, t)
+			}
 			if earliestTimeInfo.Timestamp.IsZero() || earliestTimeInfo.Timestamp.After(ti.Timestamp) {
 				earliestTimeInfo = ti
 			}
 		}
 		if allContainersPresent {
-			results = append(results, metrics.PodMetrics{
+			pm := metrics.PodMetrics{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:              pod.Name,
 					Namespace:         pod.Namespace,
@@ -93,28 +117,58 @@ func (s *podStorage) GetMetrics(pods ...*metav1.PartialObjectMetadata) ([]metric
 				Timestamp:  metav1.NewTime(earliestTimeInfo.Timestamp),
 				Window:     metav1.Duration{Duration: earliestTimeInfo.Window},
 				Containers: cms,
-			})
+			}
+			annotateOverhead(logger, &pm, lastPod.Pod, prevPod.Pod, resources)
+			annotateVolumes(logger, &pm, lastPod.Volumes)
+			annotateFilesystems(logger, &pm.ObjectMeta, lastPod.Filesystems)
+			annotateThrottling(logger, &pm, throttled)
+			annotateDevices(logger, &pm, lastPod.Devices)
+			if lastPod.ProcessCount != 0 {
+				annotations.Set(&pm.Annotations, annotations.ProcessCount, strconv.FormatUint(lastPod.ProcessCount, 10))
+			}
+			if lastPod.NodeDraining {
+				annotations.Set(&pm.Annotations, annotations.NodeDraining, "true")
+			}
+			if lastPod.NodeRemoved {
+				annotations.Set(&pm.Annotations, annotations.NodeRemoved, "true")
+			}
+			if lastPod.Pushed {
+				annotations.Set(&pm.Annotations, annotations.Pushed, "true")
+			}
+			if lastPod.Windows {
+				annotations.Set(&pm.Annotations, annotations.Windows, "true")
+			}
+			results = append(results, pm)
 		}
 	}
 	return results, nil
 }
 
-func (s *podStorage) Store(newPods *MetricsBatch) {
+func (s *podStorage) Store(logger klog.Logger, newPods *MetricsBatch) {
 	lastPods := make(map[apitypes.NamespacedName]PodMetricsPoint, len(newPods.Pods))
 	prevPods := make(map[apitypes.NamespacedName]PodMetricsPoint, len(newPods.Pods))
+	var olderPods map[apitypes.NamespacedName]map[string][]MetricsPoint
 	var containerCount int
 	for podRef, newPod := range newPods.Pods {
 		podRef := apitypes.NamespacedName{Name: podRef.Name, Namespace: podRef.Namespace}
 		if _, found := lastPods[podRef]; found {
-			klog.ErrorS(nil, "Got duplicate pod point", "pod", klog.KRef(podRef.Namespace, podRef.Name))
+			logger.Error(nil, "Got duplicate pod point", "pod", klog.KRef(podRef.Namespace, podRef.Name))
 			continue
 		}
 
-		newLastPod := PodMetricsPoint{Containers: make(map[string]MetricsPoint, len(newPod.Containers))}
+		newLastPod := PodMetricsPoint{Pod: newPod.Pod, Volumes: newPod.Volumes, Filesystems: newPod.Filesystems, ProcessCount: newPod.ProcessCount, NodeDraining: newPod.NodeDraining, Node: newPod.Node, NodeRemoved: newPod.NodeRemoved, Pushed: newPod.Pushed, Windows: newPod.Windows, Devices: newPod.Devices, Synthetic: newPod.Synthetic, Containers: make(map[string]MetricsPoint, len(newPod.Containers))}
 		newPrevPod := PodMetricsPoint{Containers: make(map[string]MetricsPoint, len(newPod.Containers))}
+		var newOlder map[string][]MetricsPoint
+		if !newPod.Pod.Timestamp.IsZero() {
+			if lastPod, found := s.last[podRef]; found && newPod.Pod.Timestamp.After(lastPod.Pod.Timestamp) {
+				newPrevPod.Pod = lastPod.Pod
+			} else if prevPod, found := s.prev[podRef]; found && prevPod.Pod.Timestamp.Before(newPod.Pod.Timestamp) {
+				newPrevPod.Pod = prevPod.Pod
+			}
+		}
 		for containerName, newPoint := range newPod.Containers {
 			if _, exists := newLastPod.Containers[containerName]; exists {
-				klog.ErrorS(nil, "Got duplicate Container point", "container", containerName, "pod", klog.KRef(podRef.Namespace, podRef.Name))
+				logger.Error(nil, "Got duplicate Container point", "container", containerName, "pod", klog.KRef(podRef.Namespace, podRef.Name))
 				continue
 			}
 			newLastPod.Containers[containerName] = newPoint
@@ -122,26 +176,46 @@ func (s *podStorage) Store(newPods *MetricsBatch) {
 				copied := newPoint
 				copied.Timestamp = newPoint.StartTime
 				copied.CumulativeCpuUsed = 0
+				copied.CumulativeCfsPeriods = 0
+				copied.CumulativeCfsThrottledPeriods = 0
+				copied.CumulativeCfsThrottledTime = 0
 				newPrevPod.Containers[containerName] = copied
 			} else if lastPod, found := s.last[podRef]; found {
-				// Keep previous metric point if newPoint has not restarted (new metric start time < stored timestamp)
-				if lastContainer, found := lastPod.Containers[containerName]; found && newPoint.StartTime.Before(lastContainer.Timestamp) {
+				lastContainer, found := lastPod.Containers[containerName]
+				if found && counterReset(lastContainer, newPoint) {
+					counterResets.WithLabelValues("container").Inc()
+					if reset, ok := resetPoint(lastContainer, newPoint); ok {
+						newPrevPod.Containers[containerName] = reset
+					}
+				} else if found && newPoint.StartTime.Before(lastContainer.Timestamp) {
+					// Keep previous metric point if newPoint has not restarted (new metric start time < stored timestamp)
 					// If new point is different then one already stored
+					var older []MetricsPoint
 					if newPoint.Timestamp.After(lastContainer.Timestamp) {
 						// Move stored point to previous
 						newPrevPod.Containers[containerName] = lastContainer
+						if prevContainer, found := s.prev[podRef].Containers[containerName]; found {
+							older = retainOlder(s.older[podRef][containerName], prevContainer, s.retained)
+						}
 					} else if prevPod, found := s.prev[podRef]; found {
 						if prevPod.Containers[containerName].Timestamp.Before(newPoint.Timestamp) {
 							// Keep previous point
 							newPrevPod.Containers[containerName] = prevPod.Containers[containerName]
+							older = s.older[podRef][containerName]
 						} else {
-							klog.V(2).InfoS("Found new containerName metrics point is older than stored previous , drop previous",
+							logger.V(2).Info("Found new containerName metrics point is older than stored previous , drop previous",
 								"containerName", containerName,
 								"pod", klog.KRef(podRef.Namespace, podRef.Name),
 								"previousTimestamp", prevPod.Containers[containerName].Timestamp,
 								"timestamp", newPoint.Timestamp)
 						}
 					}
+					if len(older) != 0 {
+						if newOlder == nil {
+							newOlder = map[string][]MetricsPoint{}
+						}
+						newOlder[containerName] = older
+					}
 				}
 			}
 		}
@@ -149,6 +223,12 @@ func (s *podStorage) Store(newPods *MetricsBatch) {
 		if containerPoints > 0 {
 			prevPods[podRef] = newPrevPod
 		}
+		if newOlder != nil {
+			if olderPods == nil {
+				olderPods = map[apitypes.NamespacedName]map[string][]MetricsPoint{}
+			}
+			olderPods[podRef] = newOlder
+		}
 		lastPods[podRef] = newLastPod
 
 		// Only count containers for which metrics can be returned.
@@ -156,6 +236,150 @@ func (s *podStorage) Store(newPods *MetricsBatch) {
 	}
 	s.last = lastPods
 	s.prev = prevPods
+	s.older = olderPods
+	s.updateSmoothed()
 
 	pointsStored.WithLabelValues("container").Set(float64(containerCount))
 }
+
+// annotateOverhead annotates pod metrics with usage of the pod cgroup not
+// attributed to any container, like the sandbox or RuntimeClass overhead.
+func annotateOverhead(logger klog.Logger, pm *metrics.PodMetrics, last, prev MetricsPoint, resources resourceSet) {
+	if last.Timestamp.IsZero() || prev.Timestamp.IsZero() {
+		return
+	}
+	podUsage, _, err := resourceUsage(last, prev, resources)
+	if err != nil {
+		logger.V(2).Info("Skipping pod overhead metric", "pod", klog.KRef(pm.Namespace, pm.Name), "err", err)
+		return
+	}
+	for _, c := range pm.Containers {
+		for _, resourceName := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			usage, found := podUsage[resourceName]
+			if !found {
+				continue
+			}
+			usage.Sub(c.Usage[resourceName])
+			podUsage[resourceName] = usage
+		}
+	}
+	for resourceName, annotation := range map[corev1.ResourceName]string{
+		corev1.ResourceCPU:    annotations.OverheadCPU,
+		corev1.ResourceMemory: annotations.OverheadMemory,
+	} {
+		overhead, found := podUsage[resourceName]
+		if !found {
+			continue
+		}
+		// Pod and container points are not taken at the same time, don't report noise.
+		if overhead.Sign() < 0 {
+			overhead = resource.Quantity{Format: overhead.Format}
+		}
+		annotations.Set(&pm.Annotations, annotation, overhead.String())
+	}
+}
+
+// annotateVolumes annotates pod metrics with usage of persistent volume claims.
+func annotateVolumes(logger klog.Logger, pm *metrics.PodMetrics, volumes []VolumeMetricsPoint) {
+	if len(volumes) == 0 {
+		return
+	}
+	usages := make([]annotations.VolumeUsage, 0, len(volumes))
+	for _, v := range volumes {
+		usages = append(usages, annotations.VolumeUsage{
+			ClaimName:     v.ClaimName,
+			CapacityBytes: v.CapacityBytes,
+			UsedBytes:     v.UsedBytes,
+		})
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].ClaimName < usages[j].ClaimName })
+	value, err := json.Marshal(usages)
+	if err != nil {
+		logger.Error(err, "Skipping volume usage metric", "pod", klog.KRef(pm.Namespace, pm.Name))
+		return
+	}
+	annotations.Set(&pm.Annotations, annotations.Volumes, string(value))
+}
+
+// annotateFilesystems annotates node or pod metrics with usage of filesystems.
+func annotateFilesystems(logger klog.Logger, meta *metav1.ObjectMeta, filesystems []FilesystemMetricsPoint) {
+	if len(filesystems) == 0 {
+		return
+	}
+	usages := make([]annotations.FilesystemUsage, 0, len(filesystems))
+	for _, fs := range filesystems {
+		usages = append(usages, annotations.FilesystemUsage{
+			Name:           fs.Name,
+			CapacityBytes:  fs.CapacityBytes,
+			AvailableBytes: fs.AvailableBytes,
+			UsedBytes:      fs.UsedBytes,
+		})
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i].Name < usages[j].Name })
+	value, err := json.Marshal(usages)
+	if err != nil {
+		logger.Error(err, "Skipping filesystem usage", "object", klog.KRef(meta.Namespace, meta.Name))
+		return
+	}
+	annotations.Set(&meta.Annotations, annotations.Filesystems, string(value))
+}
+
+// annotateDevices annotates pod metrics with devices allocated to its containers.
+func annotateDevices(logger klog.Logger, pm *metrics.PodMetrics, allocations []DeviceAllocation) {
+	if len(allocations) == 0 {
+		return
+	}
+	devices := make([]annotations.ContainerDevices, 0, len(allocations))
+	for _, a := range allocations {
+		devices = append(devices, annotations.ContainerDevices{
+			Name:     a.Container,
+			Resource: a.Resource,
+			Claim:    a.Claim,
+			IDs:      a.IDs,
+		})
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Name != devices[j].Name {
+			return devices[i].Name < devices[j].Name
+		}
+		if devices[i].Resource != devices[j].Resource {
+			return devices[i].Resource < devices[j].Resource
+		}
+		return devices[i].Claim < devices[j].Claim
+	})
+	value, err := json.Marshal(devices)
+	if err != nil {
+		logger.Error(err, "Skipping device allocations", "pod", klog.KRef(pm.Namespace, pm.Name))
+		return
+	}
+	annotations.Set(&pm.Annotations, annotations.Devices, string(value))
+}
+
+// throttlingRate calculates CPU throttling of a container with CPU limit over the window between points.
+func throttlingRate(name string, last, prev MetricsPoint, window time.Duration) (annotations.ContainerThrottling, bool) {
+	if last.CumulativeCfsPeriods == 0 || last.CumulativeCfsPeriods < prev.CumulativeCfsPeriods ||
+		last.CumulativeCfsThrottledPeriods < prev.CumulativeCfsThrottledPeriods || last.CumulativeCfsThrottledTime < prev.CumulativeCfsThrottledTime {
+		return annotations.ContainerThrottling{}, false
+	}
+	t := annotations.ContainerThrottling{Name: name}
+	if periods := last.CumulativeCfsPeriods - prev.CumulativeCfsPeriods; periods != 0 {
+		t.ThrottledPeriodsRatio = float64(last.CumulativeCfsThrottledPeriods-prev.CumulativeCfsThrottledPeriods) / float64(periods)
+	}
+	throttledTime := float64(last.CumulativeCfsThrottledTime-prev.CumulativeCfsThrottledTime) / window.Seconds()
+	t.ThrottledTime = uint64Quantity(uint64(throttledTime), resource.DecimalSI, -9)
+	return t, true
+}
+
+// annotateThrottling annotates pod metrics with CPU throttling of its containers.
+func annotateThrottling(logger klog.Logger, pm *metrics.PodMetrics, throttled []annotations.ContainerThrottling) {
+	if len(throttled) == 0 {
+		return
+	}
+	sort.Slice(throttled, func(i, j int) bool { return throttled[i].Name < throttled[j].Name })
+	value, err := json.Marshal(throttled)
+	if err != nil {
+		logger.Error(err, "Skipping CPU throttling metric", "pod", klog.KRef(pm.Namespace, pm.Name))
+		return
+	}
+	annotations.Set(&pm.Annotations, annotations.CPUThrottling, string(value))
+}
@@ -27,6 +27,8 @@ import (
 	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/component-base/metrics/testutil"
 	"k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/api/annotations"
 )
 
 var _ = Describe("Pod storage", func() {
@@ -47,6 +49,8 @@ var _ = Describe("Pod storage", func() {
 
 		By("returning metric for pod1")
 		Expect(s.Ready()).To(BeTrue())
+		Expect(s.PodsReady()).To(BeTrue())
+		Expect(s.NodesReady()).NotTo(BeTrue())
 		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
 		Expect(err).NotTo(HaveOccurred())
 		Expect(ms).To(HaveLen(1))
@@ -69,6 +73,26 @@ var _ = Describe("Pod storage", func() {
 		checkPodResponseEmpty(s, podRef)
 
 	})
+	It("stops serving pods excluded by the filter right away", func() {
+		s := NewStorage(60 * time.Second)
+		filter := &fakeFilter{}
+		s.SetFilter(filter)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 1*CoreSecond, 4*MiByte)})))
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(125*time.Second), 6*CoreSecond, 5*MiByte)})))
+		pod := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}}
+		ms, err := s.GetPodMetrics(pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+
+		By("excluding the namespace without storing a new batch")
+		filter.excludedNamespaces = map[string]bool{"ns1": true}
+		checkPodResponseEmpty(s, podRef)
+		history, err := s.GetPodMetricsHistory(pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(BeEmpty())
+	})
 	It("returns timestamp of earliest container of pod", func() {
 		s := NewStorage(60 * time.Second)
 		containerStart := time.Now()
@@ -94,6 +118,153 @@ var _ = Describe("Pod storage", func() {
 		Expect(ms[0].Timestamp.Time).Should(BeEquivalentTo(containerStart.Add(120 * time.Second)))
 		Expect(ms[0].Window.Duration).Should(BeEquivalentTo(10 * time.Second))
 	})
+	It("annotates pod overhead from pod level metrics", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing first batch with pod level metrics")
+		first := podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 1*CoreSecond, 4*MiByte)})
+		first.Pod = newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 2*CoreSecond, 5*MiByte)
+		s.Store(podMetricsBatch(first))
+
+		By("storing second batch with pod level metrics")
+		second := podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(125*time.Second), 6*CoreSecond, 5*MiByte)})
+		second.Pod = newMetricsPoint(containerStart, containerStart.Add(125*time.Second), 12*CoreSecond, 7*MiByte)
+		s.Store(podMetricsBatch(second))
+
+		By("returning overhead as difference between pod and containers usage")
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{
+			annotations.OverheadCPU:    "1",
+			annotations.OverheadMemory: "2Mi",
+		}))
+
+		By("computing usage and overhead of requested resources only")
+		ms, err = s.GetPodResourceMetrics([]corev1.ResourceName{corev1.ResourceMemory}, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Containers[0].Usage).To(Equal(corev1.ResourceList{corev1.ResourceMemory: *resource.NewQuantity(5*MiByte, resource.BinarySI)}))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{
+			annotations.OverheadMemory: "2Mi",
+		}))
+	})
+	It("annotates persistent volume claim usage", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing two batches, last one with volume usage")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 1*CoreSecond, 4*MiByte)})))
+		second := podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(125*time.Second), 6*CoreSecond, 5*MiByte)})
+		second.Volumes = []VolumeMetricsPoint{
+			{ClaimName: "logs", CapacityBytes: 2 * MiByte, UsedBytes: 1 * MiByte},
+			{ClaimName: "data", CapacityBytes: 8 * MiByte, UsedBytes: 3 * MiByte},
+		}
+		s.Store(podMetricsBatch(second))
+
+		By("returning volume usage sorted by claim name")
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{
+			annotations.Volumes: `[{"claimName":"data","capacityBytes":8388608,"usedBytes":3145728},{"claimName":"logs","capacityBytes":2097152,"usedBytes":1048576}]`,
+		}))
+	})
+	It("annotates ephemeral storage usage", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing two batches, last one with ephemeral storage usage")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 1*CoreSecond, 4*MiByte)})))
+		second := podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(125*time.Second), 6*CoreSecond, 5*MiByte)})
+		second.Filesystems = []FilesystemMetricsPoint{{Name: FilesystemEphemeralStorage, CapacityBytes: 8 * MiByte, AvailableBytes: 5 * MiByte, UsedBytes: MiByte}}
+		s.Store(podMetricsBatch(second))
+
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{
+			annotations.Filesystems: `[{"name":"ephemeral-storage","capacityBytes":8388608,"availableBytes":5242880,"usedBytes":1048576}]`,
+		}))
+	})
+	It("annotates devices allocated to containers", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing two batches, last one with devices")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 1*CoreSecond, 4*MiByte)})))
+		second := podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(125*time.Second), 6*CoreSecond, 5*MiByte)})
+		second.Devices = []DeviceAllocation{
+			{Container: "container1", Claim: "ns1/gpu", IDs: []string{"example.com/gpu=gpu0"}},
+			{Container: "container1", Resource: "nvidia.com/gpu", IDs: []string{"GPU-1"}},
+		}
+		s.Store(podMetricsBatch(second))
+
+		By("returning devices sorted by container and resource")
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{
+			annotations.Devices: `[{"name":"container1","claim":"ns1/gpu","ids":["example.com/gpu=gpu0"]},{"name":"container1","resource":"nvidia.com/gpu","ids":["GPU-1"]}]`,
+		}))
+	})
+	It("annotates CPU throttling of containers with CFS counters", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing two batches with CFS counters for container1")
+		first := newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 1*CoreSecond, 4*MiByte)
+		first.CumulativeCfsPeriods, first.CumulativeCfsThrottledPeriods, first.CumulativeCfsThrottledTime = 1000, 100, 2*CoreSecond
+		s.Store(podMetricsBatch(podMetrics(podRef,
+			containerMetricsPoint{"container1", first},
+			containerMetricsPoint{"container2", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 1*CoreSecond, 4*MiByte)},
+		)))
+		second := newMetricsPoint(containerStart, containerStart.Add(130*time.Second), 6*CoreSecond, 4*MiByte)
+		second.CumulativeCfsPeriods, second.CumulativeCfsThrottledPeriods, second.CumulativeCfsThrottledTime = 1100, 125, 7*CoreSecond
+		s.Store(podMetricsBatch(podMetrics(podRef,
+			containerMetricsPoint{"container1", second},
+			containerMetricsPoint{"container2", newMetricsPoint(containerStart, containerStart.Add(130*time.Second), 2*CoreSecond, 4*MiByte)},
+		)))
+
+		By("returning throttling rates of container1 only")
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{
+			annotations.CPUThrottling: `[{"name":"container1","throttledPeriodsRatio":0.25,"throttledTime":"500m"}]`,
+		}))
+	})
+	It("annotates pods of draining nodes", func() {
+		s := NewStorage(60 * time.Second)
+		containerStart := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing two batches, the latest from a cordoned node")
+		s.Store(podMetricsBatch(podMetrics(podRef,
+			containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(110*time.Second), 1*CoreSecond, 4*MiByte)},
+		)))
+		batch := podMetricsBatch(podMetrics(podRef,
+			containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 2*CoreSecond, 4*MiByte)},
+		))
+		point := batch.Pods[podRef]
+		point.NodeDraining = true
+		batch.Pods[podRef] = point
+		s.Store(batch)
+
+		By("annotating the pod as running on a draining node")
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Annotations).To(Equal(map[string]string{
+			annotations.NodeDraining: "true",
+		}))
+	})
 	It("handle repeated pod metric point", func() {
 		s := NewStorage(60 * time.Second)
 		containerStart := time.Now()
@@ -173,7 +344,7 @@ var _ = Describe("Pod storage", func() {
 			},
 		}}))
 	})
-	It("should return pod empty metrics if decreased data point reported", func() {
+	It("should calculate pod metrics from the reset if decreased data point reported", func() {
 		s := NewStorage(60 * time.Second)
 		containerStart := time.Now()
 		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
@@ -184,11 +355,43 @@ var _ = Describe("Pod storage", func() {
 		By("storing CPU usage decreased last metrics")
 		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(120*time.Second), 10*CoreSecond, 4*MiByte)})))
 
-		By("should get empty metrics when cpu metrics decrease")
+		By("calculating usage since the previous point")
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).To(Equal(10 * time.Second))
+		Expect(ms[0].Containers).To(Equal([]metrics.ContainerMetrics{{
+			Name: "container1",
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(CoreSecond, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(4*MiByte, resource.BinarySI),
+			},
+		}}))
+	})
+	It("should calculate pod metrics of a restarted container from its start", func() {
+		s := NewStorage(10 * time.Second)
+		containerStart := time.Now()
+		restart := containerStart.Add(65 * time.Second)
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+
+		By("storing metrics before the restart")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(containerStart, containerStart.Add(60*time.Second), 20*CoreSecond, 4*MiByte)})))
+
+		By("storing the first metrics after the restart")
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(restart, restart.Add(15*time.Second), 3*CoreSecond, 2*MiByte)})))
+
+		By("calculating usage since the restart")
 		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
 		Expect(err).NotTo(HaveOccurred())
 		Expect(ms).To(HaveLen(1))
-		Expect(ms[0].Containers).To(HaveLen(0))
+		Expect(ms[0].Window.Duration).To(Equal(15 * time.Second))
+		Expect(ms[0].Containers).To(Equal([]metrics.ContainerMetrics{{
+			Name: "container1",
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(200000000, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(2*MiByte, resource.BinarySI),
+			},
+		}}))
 	})
 	It("should handle pod metrics older than prev", func() {
 		s := NewStorage(60 * time.Second)
@@ -0,0 +1,454 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prometheus serves the Metrics API from usage queried from a
+// Prometheus compatible HTTP API, e.g. Prometheus or Thanos Query, instead
+// of scraping Kubelets. Usage is read through on requests and cached for a
+// short time, so clusters already collecting Kubelet resource metrics with
+// Prometheus don't collect them twice.
+package prometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// Names of queries, as accepted by Config.Queries.
+const (
+	NodeCPUQuery         = "node-cpu"
+	NodeMemoryQuery      = "node-memory"
+	ContainerCPUQuery    = "container-cpu"
+	ContainerMemoryQuery = "container-memory"
+)
+
+// windowPlaceholder is replaced with the rate window in queries.
+const windowPlaceholder = "$window"
+
+// DefaultQueries read the Kubelet resource metrics endpoint as scraped by
+// Prometheus. Node queries return one sample per node labeled node, container
+// queries one sample per container labeled namespace, pod and container.
+var DefaultQueries = map[string]string{
+	NodeCPUQuery:         `sum by (node) (rate(node_cpu_usage_seconds_total[$window]))`,
+	NodeMemoryQuery:      `sum by (node) (node_memory_working_set_bytes)`,
+	ContainerCPUQuery:    `sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{container!=""}[$window]))`,
+	ContainerMemoryQuery: `sum by (namespace, pod, container) (container_memory_working_set_bytes{container!=""})`,
+}
+
+var (
+	queryTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace: "metrics_server",
+			Subsystem: "prometheus",
+			Name:      "queries_total",
+			Help:      "Number of queries sent to Prometheus, partitioned by query and result",
+		},
+		[]string{"query", "result"},
+	)
+	queryDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace: "metrics_server",
+			Subsystem: "prometheus",
+			Name:      "query_duration_seconds",
+			Help:      "Duration of queries sent to Prometheus, partitioned by query",
+			Buckets:   metrics.ExponentialBuckets(0.005, 2, 12),
+		},
+		[]string{"query"},
+	)
+)
+
+// RegisterPrometheusMetrics registers metrics of the Prometheus backend.
+func RegisterPrometheusMetrics(registrationFunc func(metrics.Registerable) error) error {
+	for _, metric := range []metrics.Registerable{queryTotal, queryDuration} {
+		if err := registrationFunc(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Config configures reading usage from Prometheus.
+type Config struct {
+	// URL of the Prometheus HTTP API, without the /api/v1 suffix.
+	URL string
+	// Timeout of queries.
+	Timeout time.Duration
+	// BearerTokenFile is the path of a file holding a token sent in the Authorization header, read on every query. Empty sends none.
+	BearerTokenFile string
+	// CAFile is the path of a CA bundle verifying the serving certificate of an https URL. Empty uses the system roots.
+	CAFile string
+	// Window is the range of CPU rate queries and the window of served metrics.
+	Window time.Duration
+	// CacheTTL is the duration query results are reused for.
+	CacheTTL time.Duration
+	// Queries override DefaultQueries by name.
+	Queries map[string]string
+	// Filter drops nodes and pods from served metrics, nil keeps all.
+	Filter storage.Filter
+}
+
+// Validate returns an error if the URL, durations or queries are invalid.
+func (c Config) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL %q should be an absolute http or https URL", c.URL)
+	}
+	if c.CAFile != "" && u.Scheme != "https" {
+		return fmt.Errorf("CA file is only used with an https URL, but URL %q provided", c.URL)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("timeout should be positive, but value %v provided", c.Timeout)
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("window should be positive, but value %v provided", c.Window)
+	}
+	for name, query := range c.Queries {
+		if _, found := DefaultQueries[name]; !found {
+			return fmt.Errorf("unknown query %q, expected %q, %q, %q or %q", name, NodeCPUQuery, NodeMemoryQuery, ContainerCPUQuery, ContainerMemoryQuery)
+		}
+		if strings.TrimSpace(query) == "" {
+			return fmt.Errorf("query %q is empty", name)
+		}
+	}
+	return nil
+}
+
+// promStorage implements storage.Storage by querying Prometheus. Store,
+// Snapshot and Restore are no-ops, as usage isn't kept by metrics-server.
+type promStorage struct {
+	config  Config
+	client  *http.Client
+	queries map[string]string
+	now     func() time.Time
+
+	mu      sync.Mutex
+	results map[string]result
+}
+
+type result struct {
+	vector model.Vector
+	time   time.Time
+}
+
+var _ storage.Storage = (*promStorage)(nil)
+
+// NewStorage returns a storage serving usage queried from Prometheus.
+func NewStorage(config Config) (storage.Storage, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CAFile != "" {
+		ca, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read Prometheus CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in Prometheus CA bundle %q", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+	}
+	queries := make(map[string]string, len(DefaultQueries))
+	for name, query := range DefaultQueries {
+		if override, found := config.Queries[name]; found {
+			query = override
+		}
+		queries[name] = strings.ReplaceAll(query, windowPlaceholder, model.Duration(config.Window).String())
+	}
+	return &promStorage{
+		config:  config,
+		client:  &http.Client{Transport: transport, Timeout: config.Timeout},
+		queries: queries,
+		now:     time.Now,
+		results: map[string]result{},
+	}, nil
+}
+
+// GetNodeMetrics returns usage of nodes having both CPU and memory samples.
+func (s *promStorage) GetNodeMetrics(nodes ...*corev1.Node) ([]metricsapi.NodeMetrics, error) {
+	cpu, err := s.query(NodeCPUQuery)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := s.query(NodeMemoryQuery)
+	if err != nil {
+		return nil, err
+	}
+	cpuByNode, memoryByNode := indexSamples(cpu, "node"), indexSamples(memory, "node")
+	results := make([]metricsapi.NodeMetrics, 0, len(nodes))
+	for _, node := range nodes {
+		if s.config.Filter != nil && !s.config.Filter.KeepNode(node) {
+			continue
+		}
+		usage, timestamp, ok := resourceUsage(cpuByNode[node.Name], memoryByNode[node.Name])
+		if !ok {
+			continue
+		}
+		results = append(results, metricsapi.NodeMetrics{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              node.Name,
+				Labels:            node.Labels,
+				CreationTimestamp: metav1.NewTime(s.now()),
+			},
+			Timestamp: metav1.NewTime(timestamp),
+			Window:    metav1.Duration{Duration: s.config.Window},
+			Usage:     usage,
+		})
+	}
+	return results, nil
+}
+
+// GetPodMetrics returns usage of pods whose containers all have CPU and memory samples.
+func (s *promStorage) GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metricsapi.PodMetrics, error) {
+	cpu, err := s.query(ContainerCPUQuery)
+	if err != nil {
+		return nil, err
+	}
+	memory, err := s.query(ContainerMemoryQuery)
+	if err != nil {
+		return nil, err
+	}
+	cpuByPod, memoryByPod := indexContainers(cpu), indexContainers(memory)
+	results := make([]metricsapi.PodMetrics, 0, len(pods))
+	for _, pod := range pods {
+		if s.config.Filter != nil && !s.config.Filter.KeepPod(pod.Namespace, pod.Name) {
+			continue
+		}
+		ref := podRef{namespace: pod.Namespace, name: pod.Name}
+		containers := cpuByPod[ref]
+		if len(containers) == 0 {
+			continue
+		}
+		var (
+			cms      = make([]metricsapi.ContainerMetrics, 0, len(containers))
+			earliest time.Time
+			complete = true
+		)
+		for name, cpuSample := range containers {
+			usage, timestamp, ok := resourceUsage(cpuSample, memoryByPod[ref][name])
+			if !ok {
+				complete = false
+				break
+			}
+			cms = append(cms, metricsapi.ContainerMetrics{Name: name, Usage: usage})
+			if earliest.IsZero() || timestamp.Before(earliest) {
+				earliest = timestamp
+			}
+		}
+		if !complete {
+			continue
+		}
+		results = append(results, metricsapi.PodMetrics{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              pod.Name,
+				Namespace:         pod.Namespace,
+				Labels:            pod.Labels,
+				CreationTimestamp: metav1.NewTime(s.now()),
+			},
+			Timestamp:  metav1.NewTime(earliest),
+			Window:     metav1.Duration{Duration: s.config.Window},
+			Containers: cms,
+		})
+	}
+	return results, nil
+}
+
+// GetNodeMetricsHistory returns the latest metrics of the node, Prometheus
+// history isn't read.
+func (s *promStorage) GetNodeMetricsHistory(node *corev1.Node) ([]metricsapi.NodeMetrics, error) {
+	return s.GetNodeMetrics(node)
+}
+
+// GetPodMetricsHistory returns the latest metrics of the pod, Prometheus
+// history isn't read.
+func (s *promStorage) GetPodMetricsHistory(pod *metav1.PartialObjectMetadata) ([]metricsapi.PodMetrics, error) {
+	return s.GetPodMetrics(pod)
+}
+
+// Store is a no-op, usage is read from Prometheus.
+func (s *promStorage) Store(*storage.MetricsBatch) {}
+
+// Ready returns true if Prometheus returns node usage.
+func (s *promStorage) Ready() bool {
+	return s.NodesReady()
+}
+
+// NodesReady returns true if Prometheus returns node usage.
+func (s *promStorage) NodesReady() bool {
+	vector, err := s.query(NodeCPUQuery)
+	return err == nil && len(vector) != 0
+}
+
+// PodsReady returns true if Prometheus returns container usage.
+func (s *promStorage) PodsReady() bool {
+	vector, err := s.query(ContainerCPUQuery)
+	return err == nil && len(vector) != 0
+}
+
+// Snapshot returns an empty snapshot, usage is read from Prometheus.
+func (s *promStorage) Snapshot() storage.Snapshot {
+	return storage.Snapshot{}
+}
+
+// Restore is a no-op, usage is read from Prometheus.
+func (s *promStorage) Restore(storage.Snapshot) {}
+
+// query returns the result of the named query, reusing results younger than the cache TTL.
+func (s *promStorage) query(name string) (model.Vector, error) {
+	now := s.now()
+	s.mu.Lock()
+	cached, found := s.results[name]
+	s.mu.Unlock()
+	if found && now.Sub(cached.time) < s.config.CacheTTL {
+		return cached.vector, nil
+	}
+	start := time.Now()
+	vector, err := s.instantQuery(s.queries[name])
+	queryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		queryTotal.WithLabelValues(name, "error").Inc()
+		klog.ErrorS(err, "Failed to query Prometheus", "query", name)
+		return nil, fmt.Errorf("unable to query usage from Prometheus")
+	}
+	queryTotal.WithLabelValues(name, "success").Inc()
+	s.mu.Lock()
+	s.results[name] = result{vector: vector, time: now}
+	s.mu.Unlock()
+	return vector, nil
+}
+
+// queryResponse is the response of the Prometheus HTTP API.
+type queryResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+}
+
+func (s *promStorage) instantQuery(query string) (model.Vector, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.config.URL, "/")+"/api/v1/query", strings.NewReader(url.Values{"query": {query}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "metrics-server")
+	if s.config.BearerTokenFile != "" {
+		token, err := os.ReadFile(s.config.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	var qr queryResponse
+	if err := json.Unmarshal(body, &qr); err != nil {
+		return nil, fmt.Errorf("failed to decode response with status %q: %w", resp.Status, err)
+	}
+	if qr.Status != "success" {
+		return nil, fmt.Errorf("query failed, status: %q, error: %s: %s", resp.Status, qr.ErrorType, qr.Error)
+	}
+	if qr.Data.ResultType != model.ValVector.String() {
+		return nil, fmt.Errorf("query returned a %s, expected a vector", qr.Data.ResultType)
+	}
+	var vector model.Vector
+	if err := json.Unmarshal(qr.Data.Result, &vector); err != nil {
+		return nil, fmt.Errorf("failed to decode vector: %w", err)
+	}
+	return vector, nil
+}
+
+type podRef struct {
+	namespace, name string
+}
+
+func indexSamples(vector model.Vector, label model.LabelName) map[string]*model.Sample {
+	res := make(map[string]*model.Sample, len(vector))
+	for _, sample := range vector {
+		if name := string(sample.Metric[label]); name != "" {
+			res[name] = sample
+		}
+	}
+	return res
+}
+
+func indexContainers(vector model.Vector) map[podRef]map[string]*model.Sample {
+	res := map[podRef]map[string]*model.Sample{}
+	for _, sample := range vector {
+		ref := podRef{namespace: string(sample.Metric["namespace"]), name: string(sample.Metric["pod"])}
+		container := string(sample.Metric["container"])
+		if ref.namespace == "" || ref.name == "" || container == "" {
+			continue
+		}
+		if res[ref] == nil {
+			res[ref] = map[string]*model.Sample{}
+		}
+		res[ref][container] = sample
+	}
+	return res
+}
+
+// resourceUsage returns usage of CPU and memory samples and the earliest of
+// their timestamps, ok is false if a sample is missing or invalid.
+func resourceUsage(cpu, memory *model.Sample) (usage corev1.ResourceList, timestamp time.Time, ok bool) {
+	if cpu == nil || memory == nil || !validValue(cpu.Value) || !validValue(memory.Value) {
+		return nil, time.Time{}, false
+	}
+	timestamp = cpu.Timestamp.Time()
+	if t := memory.Timestamp.Time(); t.Before(timestamp) {
+		timestamp = t
+	}
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewScaledQuantity(int64(math.Round(float64(cpu.Value)*1e9)), -9),
+		corev1.ResourceMemory: *resource.NewQuantity(int64(memory.Value), resource.BinarySI),
+	}, timestamp, true
+}
+
+func validValue(v model.SampleValue) bool {
+	f := float64(v)
+	return !math.IsNaN(f) && !math.IsInf(f, 0) && f >= 0
+}
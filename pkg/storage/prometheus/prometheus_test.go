@@ -0,0 +1,267 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsapi "k8s.io/metrics/pkg/apis/metrics"
+)
+
+const timestamp = 1600000000
+
+type fakePrometheus struct {
+	results map[string]string
+	queries []string
+	status  int
+}
+
+func (f *fakePrometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.FormValue("query")
+	f.queries = append(f.queries, query)
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+		fmt.Fprint(w, `{"status":"error","errorType":"unavailable","error":"storage unavailable"}`)
+		return
+	}
+	fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[%s]}}`, f.results[query])
+}
+
+func sample(value string, labels ...string) string {
+	metric := ""
+	for i := 0; i < len(labels); i += 2 {
+		if metric != "" {
+			metric += ","
+		}
+		metric += fmt.Sprintf("%q:%q", labels[i], labels[i+1])
+	}
+	return fmt.Sprintf(`{"metric":{%s},"value":[%d,%q]}`, metric, timestamp, value)
+}
+
+func newTestStorage(t *testing.T, prom *fakePrometheus, config Config) *promStorage {
+	srv := httptest.NewServer(prom)
+	t.Cleanup(srv.Close)
+	config.URL = srv.URL
+	config.Timeout = time.Second
+	config.Window = 5 * time.Minute
+	st, err := NewStorage(config)
+	if err != nil {
+		t.Fatalf("NewStorage() error = %v", err)
+	}
+	s := st.(*promStorage)
+	s.now = func() time.Time { return time.Unix(timestamp, 0) }
+	return s
+}
+
+func TestGetNodeMetrics(t *testing.T) {
+	prom := &fakePrometheus{results: map[string]string{
+		`sum by (node) (rate(node_cpu_usage_seconds_total[5m]))`: sample("0.25", "node", "node1") + "," + sample("1", "node", "node2"),
+		`sum by (node) (node_memory_working_set_bytes)`:          sample("1048576", "node", "node1"),
+	}}
+	s := newTestStorage(t, prom, Config{})
+
+	got, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []metricsapi.NodeMetrics{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", CreationTimestamp: metav1.NewTime(time.Unix(timestamp, 0))},
+		Timestamp:  metav1.NewTime(time.Unix(timestamp, 0)),
+		Window:     metav1.Duration{Duration: 5 * time.Minute},
+		Usage: corev1.ResourceList{
+			corev1.ResourceCPU:    *resource.NewScaledQuantity(250000000, -9),
+			corev1.ResourceMemory: *resource.NewQuantity(1048576, resource.BinarySI),
+		},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected metrics, diff:\n%s", diff)
+	}
+}
+
+func TestGetPodMetrics(t *testing.T) {
+	prom := &fakePrometheus{results: map[string]string{
+		`sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{container!=""}[5m]))`: sample("0.1", "namespace", "ns1", "pod", "pod1", "container", "app") + "," +
+			sample("0.2", "namespace", "ns1", "pod", "pod2", "container", "app") + "," +
+			sample("0.3", "namespace", "ns1", "pod", "pod2", "container", "sidecar"),
+		`sum by (namespace, pod, container) (container_memory_working_set_bytes{container!=""})`: sample("1024", "namespace", "ns1", "pod", "pod1", "container", "app") + "," +
+			sample("1024", "namespace", "ns1", "pod", "pod2", "container", "app"),
+	}}
+	s := newTestStorage(t, prom, Config{})
+
+	got, err := s.GetPodMetrics(
+		&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}},
+		&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod2"}},
+		&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod3"}},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []metricsapi.PodMetrics{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1", CreationTimestamp: metav1.NewTime(time.Unix(timestamp, 0))},
+		Timestamp:  metav1.NewTime(time.Unix(timestamp, 0)),
+		Window:     metav1.Duration{Duration: 5 * time.Minute},
+		Containers: []metricsapi.ContainerMetrics{{
+			Name: "app",
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    *resource.NewScaledQuantity(100000000, -9),
+				corev1.ResourceMemory: *resource.NewQuantity(1024, resource.BinarySI),
+			},
+		}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected metrics, diff:\n%s", diff)
+	}
+}
+
+func TestQuery_Cache(t *testing.T) {
+	prom := &fakePrometheus{results: map[string]string{
+		`cpu[5m]`: sample("1", "node", "node1"),
+	}}
+	s := newTestStorage(t, prom, Config{CacheTTL: time.Minute, Queries: map[string]string{NodeCPUQuery: "cpu[$window]"}})
+
+	for i := 0; i < 2; i++ {
+		if !s.NodesReady() {
+			t.Error("Expected nodes to be ready")
+		}
+	}
+	if len(prom.queries) != 1 {
+		t.Errorf("Unexpected queries %q, want result to be cached", prom.queries)
+	}
+	now := time.Unix(timestamp, 0).Add(time.Minute)
+	s.now = func() time.Time { return now }
+	prom.status = http.StatusServiceUnavailable
+	if s.NodesReady() {
+		t.Error("Expected nodes not to be ready after failed query")
+	}
+	if len(prom.queries) != 2 {
+		t.Errorf("Unexpected queries %q, want expired result to be queried again", prom.queries)
+	}
+}
+
+func TestNewStorage_Queries(t *testing.T) {
+	st, err := NewStorage(Config{Window: 2 * time.Minute, Queries: map[string]string{NodeMemoryQuery: `sum by (node) (label_replace(node_memory_working_set_bytes, "node", "$1", "instance", "(.*)"))`}})
+	if err != nil {
+		t.Fatalf("NewStorage() error = %v", err)
+	}
+	s := st.(*promStorage)
+	if got, want := s.queries[NodeCPUQuery], `sum by (node) (rate(node_cpu_usage_seconds_total[2m]))`; got != want {
+		t.Errorf("Unexpected node CPU query %q, want %q", got, want)
+	}
+	if got, want := s.queries[NodeMemoryQuery], `sum by (node) (label_replace(node_memory_working_set_bytes, "node", "$1", "instance", "(.*)"))`; got != want {
+		t.Errorf("Unexpected node memory query %q, want %q", got, want)
+	}
+}
+
+func TestNewStorage_CAFile(t *testing.T) {
+	prom := &fakePrometheus{results: map[string]string{
+		`sum by (node) (rate(node_cpu_usage_seconds_total[5m]))`: sample("0.25", "node", "node1"),
+		`sum by (node) (node_memory_working_set_bytes)`:          sample("1048576", "node", "node1"),
+	}}
+	srv := httptest.NewTLSServer(prom)
+	t.Cleanup(srv.Close)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+
+	untrusted, err := NewStorage(Config{URL: srv.URL, Timeout: time.Second, Window: 5 * time.Minute})
+	if err != nil {
+		t.Fatalf("NewStorage() error = %v", err)
+	}
+	if _, err := untrusted.GetNodeMetrics(node); err == nil {
+		t.Errorf("Expected an error querying Prometheus without its CA")
+	}
+	trusted, err := NewStorage(Config{URL: srv.URL, Timeout: time.Second, Window: 5 * time.Minute, CAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewStorage() error = %v", err)
+	}
+	got, err := trusted.GetNodeMetrics(node)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) != 1 {
+		t.Errorf("Unexpected metrics %v, want node1", got)
+	}
+	if _, err := NewStorage(Config{URL: srv.URL, CAFile: filepath.Join(t.TempDir(), "missing.crt")}); err == nil {
+		t.Errorf("Expected an error for a missing CA file")
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := Config{URL: "http://prometheus.monitoring:9090", Timeout: time.Second, Window: time.Minute}
+	tcs := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr bool
+	}{
+		{
+			name:   "Valid",
+			modify: func(*Config) {},
+		},
+		{
+			name:    "Relative URL",
+			modify:  func(c *Config) { c.URL = "prometheus:9090" },
+			wantErr: true,
+		},
+		{
+			name:    "No window",
+			modify:  func(c *Config) { c.Window = 0 },
+			wantErr: true,
+		},
+		{
+			name:    "Unknown query",
+			modify:  func(c *Config) { c.Queries = map[string]string{"pod-cpu": "up"} },
+			wantErr: true,
+		},
+		{
+			name:    "Empty query",
+			modify:  func(c *Config) { c.Queries = map[string]string{NodeCPUQuery: " "} },
+			wantErr: true,
+		},
+		{
+			name:    "CA file with http URL",
+			modify:  func(c *Config) { c.CAFile = "/etc/prometheus/ca.crt" },
+			wantErr: true,
+		},
+		{
+			name: "CA file with https URL",
+			modify: func(c *Config) {
+				c.URL = "https://prometheus.monitoring:9090"
+				c.CAFile = "/etc/prometheus/ca.crt"
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			config := valid
+			tc.modify(&config)
+			if err := config.Validate(); (err != nil) != tc.wantErr {
+				t.Errorf("Unexpected error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+)
+
+// SetCPURateWindow sets the trailing window CPU usage is calculated over. The
+// rate is calculated from the oldest retained point in the window, or the one
+// preceding the last if none is, so the window is only covered when enough
+// points are retained. 0 calculates it between the last two points.
+func (s *storage) SetCPURateWindow(window time.Duration) {
+	s.update(func(next *state) {
+		next.nodes.cpuRateWindow = window
+		next.pods.cpuRateWindow = window
+	})
+}
+
+// rateBase returns the point CPU usage at last is calculated from: the oldest
+// of older, oldest first, and prev within window of last, prev if none is.
+func rateBase(older []MetricsPoint, prev, last MetricsPoint, window time.Duration) MetricsPoint {
+	base := prev
+	if window <= 0 {
+		return base
+	}
+	for i := len(older) - 1; i >= 0; i-- {
+		if last.Timestamp.Sub(older[i].Timestamp) > window {
+			break
+		}
+		base = older[i]
+	}
+	return base
+}
+
+// RetainedPointsForWindow returns the number of points to retain per node and
+// container to cover window with points stored every resolution.
+func RetainedPointsForWindow(window, resolution time.Duration) int {
+	if window <= 0 || resolution <= 0 {
+		return DefaultRetainedPoints
+	}
+	intervals := int((window + resolution - 1) / resolution)
+	if intervals+1 < DefaultRetainedPoints {
+		return DefaultRetainedPoints
+	}
+	return intervals + 1
+}
@@ -0,0 +1,79 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("CPU rate window", func() {
+	It("calculates node usage over the trailing window", func() {
+		s := NewStorage(90 * time.Second)
+		s.SetRetainedPoints(RetainedPointsForWindow(30*time.Second, 10*time.Second))
+		s.SetCPURateWindow(30 * time.Second)
+		start := time.Now()
+		for i, used := range []uint64{0, 1, 2, 9, 10} {
+			s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(time.Duration(i+1)*10*time.Second), used*CoreSecond, MiByte)}))
+		}
+
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).To(Equal(30 * time.Second))
+		cpu := ms[0].Usage[corev1.ResourceCPU]
+		Expect(cpu.MilliValue()).To(Equal(int64(300)))
+	})
+	It("calculates usage over the points available until the window is covered", func() {
+		s := NewStorage(90 * time.Second)
+		s.SetRetainedPoints(4)
+		s.SetCPURateWindow(30 * time.Second)
+		start := time.Now()
+		for i := 1; i <= 3; i++ {
+			s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(time.Duration(i)*10*time.Second), uint64(i)*CoreSecond, MiByte)}))
+		}
+		checkNodeUsage(s, "node1", 20*time.Second)
+	})
+	It("calculates container usage over the trailing window", func() {
+		s := NewStorage(30 * time.Second)
+		s.SetRetainedPoints(4)
+		s.SetCPURateWindow(2 * time.Minute)
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		start := time.Now()
+		for i := 1; i <= 4; i++ {
+			s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(time.Duration(i)*time.Minute), uint64(i*i)*60*CoreSecond, MiByte)})))
+		}
+
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(ms[0].Window.Duration).To(Equal(2 * time.Minute))
+		Expect(ms[0].Containers).To(HaveLen(1))
+		cpu := ms[0].Containers[0].Usage[corev1.ResourceCPU]
+		Expect(cpu.MilliValue()).To(Equal(int64(6000)))
+	})
+	It("retains enough points to cover the window", func() {
+		Expect(RetainedPointsForWindow(0, 15*time.Second)).To(Equal(DefaultRetainedPoints))
+		Expect(RetainedPointsForWindow(5*time.Second, 15*time.Second)).To(Equal(DefaultRetainedPoints))
+		Expect(RetainedPointsForWindow(60*time.Second, 15*time.Second)).To(Equal(5))
+		Expect(RetainedPointsForWindow(70*time.Second, 15*time.Second)).To(Equal(6))
+	})
+})
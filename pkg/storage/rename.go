@@ -0,0 +1,119 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// ResourceNames maps names of resources read from metrics sources to the
+// names they are served with, e.g. to normalize vendor specific names.
+type ResourceNames map[corev1.ResourceName]corev1.ResourceName
+
+// ParseResourceNames builds ResourceNames from source=served pairs and validates them.
+// cpu and memory are neither renamed nor replaced, autoscalers depend on them.
+func ParseResourceNames(pairs map[string]string) (ResourceNames, error) {
+	names := make(ResourceNames, len(pairs))
+	served := make(map[corev1.ResourceName]corev1.ResourceName, len(pairs))
+	for from, to := range pairs {
+		source, target := corev1.ResourceName(from), corev1.ResourceName(to)
+		for _, name := range []string{from, to} {
+			if errs := validation.IsQualifiedName(name); len(errs) != 0 {
+				return nil, fmt.Errorf("invalid resource name %q: %s", name, strings.Join(errs, ", "))
+			}
+		}
+		for _, name := range []corev1.ResourceName{source, target} {
+			if name == corev1.ResourceCPU || name == corev1.ResourceMemory {
+				return nil, fmt.Errorf("resource %q can't be renamed, autoscalers depend on it", name)
+			}
+		}
+		if other, found := served[target]; found {
+			return nil, fmt.Errorf("resources %q and %q are both renamed to %q", other, source, target)
+		}
+		served[target] = source
+		names[source] = target
+	}
+	for source, target := range names {
+		if _, found := names[target]; found {
+			return nil, fmt.Errorf("resource %q is renamed to %q, which is renamed itself", source, target)
+		}
+	}
+	return names, nil
+}
+
+// apply returns usage with resources renamed. Renamed resources replace
+// resources served under the same name.
+func (n ResourceNames) apply(usage corev1.ResourceList) corev1.ResourceList {
+	if len(n) == 0 {
+		return usage
+	}
+	renamed := make(corev1.ResourceList, len(usage))
+	for name, quantity := range usage {
+		if _, found := n[name]; !found {
+			renamed[name] = quantity
+		}
+	}
+	for name, quantity := range usage {
+		if target, found := n[name]; found {
+			renamed[target] = quantity
+		}
+	}
+	return renamed
+}
+
+// sources returns resources read from metrics sources that are served as one
+// of served, nil selecting all of them if served is empty.
+func (n ResourceNames) sources(served []corev1.ResourceName) resourceSet {
+	if len(served) == 0 {
+		return nil
+	}
+	set := make(resourceSet, len(served))
+	for _, name := range served {
+		if _, renamed := n[name]; !renamed {
+			set[name] = struct{}{}
+		}
+		for source, target := range n {
+			if target == name {
+				set[source] = struct{}{}
+			}
+		}
+	}
+	return set
+}
+
+func (n ResourceNames) applyNodes(ms []metrics.NodeMetrics) {
+	if len(n) == 0 {
+		return
+	}
+	for i := range ms {
+		ms[i].Usage = n.apply(ms[i].Usage)
+	}
+}
+
+func (n ResourceNames) applyPods(ms []metrics.PodMetrics) {
+	if len(n) == 0 {
+		return
+	}
+	for i := range ms {
+		for j := range ms[i].Containers {
+			ms[i].Containers[j].Usage = n.apply(ms[i].Containers[j].Usage)
+		}
+	}
+}
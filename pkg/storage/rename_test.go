@@ -0,0 +1,130 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseResourceNames(t *testing.T) {
+	tcs := []struct {
+		name      string
+		pairs     map[string]string
+		want      ResourceNames
+		wantError bool
+	}{
+		{
+			name:  "Empty",
+			pairs: nil,
+			want:  ResourceNames{},
+		},
+		{
+			name:  "Vendor names",
+			pairs: map[string]string{"example.com/gpu-utilization": "gpu", "pid": "example.com/pid"},
+			want:  ResourceNames{"example.com/gpu-utilization": "gpu", "pid": "example.com/pid"},
+		},
+		{
+			name:      "Invalid name",
+			pairs:     map[string]string{"example.com/gpu": "GPU usage"},
+			wantError: true,
+		},
+		{
+			name:      "Renamed cpu",
+			pairs:     map[string]string{"cpu": "example.com/cpu"},
+			wantError: true,
+		},
+		{
+			name:      "Renamed to memory",
+			pairs:     map[string]string{"example.com/memory-working-set": "memory"},
+			wantError: true,
+		},
+		{
+			name:      "Same served name",
+			pairs:     map[string]string{"a.example.com/gpu": "gpu", "b.example.com/gpu": "gpu"},
+			wantError: true,
+		},
+		{
+			name:      "Chained renames",
+			pairs:     map[string]string{"a.example.com/gpu": "b.example.com/gpu", "b.example.com/gpu": "gpu"},
+			wantError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseResourceNames(tc.pairs)
+			if (err != nil) != tc.wantError {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected names, diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResourceNames_sources(t *testing.T) {
+	names := ResourceNames{"example.com/gpu-utilization": "gpu"}
+	tcs := []struct {
+		name   string
+		served []corev1.ResourceName
+		want   resourceSet
+	}{
+		{
+			name: "All resources",
+		},
+		{
+			name:   "Resource served as is",
+			served: []corev1.ResourceName{corev1.ResourceCPU},
+			want:   resourceSet{corev1.ResourceCPU: {}},
+		},
+		{
+			name:   "Renamed resource",
+			served: []corev1.ResourceName{"gpu"},
+			want:   resourceSet{"gpu": {}, "example.com/gpu-utilization": {}},
+		},
+		{
+			name:   "Source name of renamed resource",
+			served: []corev1.ResourceName{"example.com/gpu-utilization"},
+			want:   resourceSet{},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, names.sources(tc.served)); diff != "" {
+				t.Errorf("Unexpected sources, diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResourceNames_apply(t *testing.T) {
+	usage := corev1.ResourceList{
+		corev1.ResourceCPU:            resource.MustParse("100m"),
+		"example.com/gpu-utilization": resource.MustParse("50"),
+		"gpu":                         resource.MustParse("10"),
+	}
+	names := ResourceNames{"example.com/gpu-utilization": "gpu"}
+	want := corev1.ResourceList{
+		corev1.ResourceCPU: resource.MustParse("100m"),
+		"gpu":              resource.MustParse("50"),
+	}
+	if diff := cmp.Diff(want, names.apply(usage)); diff != "" {
+		t.Errorf("Unexpected usage, diff:\n%s", diff)
+	}
+}
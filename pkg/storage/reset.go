@@ -0,0 +1,46 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+// counterReset reports whether cumulative counters of newPoint restarted
+// since last, because the container restarted or its counters went backwards,
+// e.g. after a Kubelet restart.
+func counterReset(last, newPoint MetricsPoint) bool {
+	if !newPoint.Timestamp.After(last.Timestamp) {
+		return false
+	}
+	return !newPoint.StartTime.Before(last.Timestamp) || newPoint.CumulativeCpuUsed < last.CumulativeCpuUsed
+}
+
+// resetPoint returns a point with zero counters at the reset detected
+// between last and newPoint, usage after the reset is calculated from. The
+// reset happened at the start time of newPoint if it follows last, or else
+// at some unknown time after last, so the usage calculated from last is a
+// lower bound. ok is false if the reset is too recent to calculate usage.
+func resetPoint(last, newPoint MetricsPoint) (reset MetricsPoint, ok bool) {
+	reset = newPoint
+	reset.Timestamp = last.Timestamp
+	if newPoint.StartTime.After(last.Timestamp) {
+		reset.Timestamp = newPoint.StartTime
+	}
+	if newPoint.Timestamp.Sub(reset.Timestamp) < freshContainerMinMetricsResolution {
+		return MetricsPoint{}, false
+	}
+	reset.CumulativeCpuUsed = 0
+	reset.CumulativeCfsPeriods = 0
+	reset.CumulativeCfsThrottledPeriods = 0
+	reset.CumulativeCfsThrottledTime = 0
+	return reset, true
+}
@@ -0,0 +1,81 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultRetainedPoints is the number of points kept per node and container by default, the
+// minimum to calculate CPU usage.
+const DefaultRetainedPoints = 2
+
+// SetRetainedPoints sets the number of points kept per node and container,
+// including the last two used to calculate usage. Older points are dropped
+// as new ones are stored, values below DefaultRetainedPoints keep the default.
+func (s *storage) SetRetainedPoints(n int) {
+	s.update(func(next *state) {
+		next.nodes.retained = n
+		next.pods.retained = n
+	})
+}
+
+// retainOlder returns points to keep preceding prev after prev is replaced:
+// older followed by prev, oldest first, without exceeding retained-2 points.
+// It returns a new slice, as older may be referenced by published states.
+func retainOlder(older []MetricsPoint, prev MetricsPoint, retained int) []MetricsPoint {
+	limit := retained - DefaultRetainedPoints
+	if limit <= 0 {
+		return nil
+	}
+	if excess := len(older) + 1 - limit; excess > 0 {
+		older = older[excess:]
+	}
+	res := make([]MetricsPoint, 0, len(older)+1)
+	res = append(res, older...)
+	return append(res, prev)
+}
+
+// points returns the points kept for node, oldest first, nil if it has no last point.
+func (s *nodeStorage) points(node string) []MetricsPoint {
+	last, found := s.last[node]
+	if !found {
+		return nil
+	}
+	prev, found := s.prev[node]
+	if !found {
+		return []MetricsPoint{last}
+	}
+	return appendPoints(s.older[node], prev, last)
+}
+
+// points returns the points kept for a container of pod, oldest first, nil if it has no last point.
+func (s *podStorage) points(pod apitypes.NamespacedName, container string) []MetricsPoint {
+	last, found := s.last[pod].Containers[container]
+	if !found {
+		return nil
+	}
+	prev, found := s.prev[pod].Containers[container]
+	if !found {
+		return []MetricsPoint{last}
+	}
+	return appendPoints(s.older[pod][container], prev, last)
+}
+
+func appendPoints(older []MetricsPoint, prev, last MetricsPoint) []MetricsPoint {
+	res := make([]MetricsPoint, 0, len(older)+2)
+	res = append(res, older...)
+	return append(res, prev, last)
+}
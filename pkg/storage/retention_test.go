@@ -0,0 +1,113 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Retained points", func() {
+	It("keeps the last two points by default", func() {
+		s := NewStorage(60 * time.Second)
+		start := time.Now()
+		for i := 1; i <= 4; i++ {
+			s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(time.Duration(i)*10*time.Second), uint64(i)*CoreSecond, MiByte)}))
+		}
+		Expect(s.load().nodes.points("node1")).To(Equal([]MetricsPoint{
+			newMetricsPoint(start, start.Add(30*time.Second), 3*CoreSecond, MiByte),
+			newMetricsPoint(start, start.Add(40*time.Second), 4*CoreSecond, MiByte),
+		}))
+		Expect(s.load().nodes.older).To(BeEmpty())
+	})
+	It("keeps the configured number of node points", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetRetainedPoints(3)
+		start := time.Now()
+		point := func(i int) MetricsPoint {
+			return newMetricsPoint(start, start.Add(time.Duration(i)*10*time.Second), uint64(i)*CoreSecond, MiByte)
+		}
+
+		By("storing points up to the limit")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", point(1)}))
+		Expect(s.load().nodes.points("node1")).To(Equal([]MetricsPoint{point(1)}))
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", point(2)}))
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", point(3)}))
+		Expect(s.load().nodes.points("node1")).To(Equal([]MetricsPoint{point(1), point(2), point(3)}))
+
+		By("dropping the oldest point when storing more")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", point(4)}))
+		Expect(s.load().nodes.points("node1")).To(Equal([]MetricsPoint{point(2), point(3), point(4)}))
+
+		By("keeping points when the node is scraped again without a new point")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", point(4)}))
+		Expect(s.load().nodes.points("node1")).To(Equal([]MetricsPoint{point(2), point(3), point(4)}))
+
+		By("still calculating usage from the last two points")
+		checkNodeUsage(s, "node1", 10*time.Second)
+
+		By("dropping all points of nodes missing from a batch")
+		s.Store(nodeMetricBatch())
+		Expect(s.load().nodes.points("node1")).To(BeNil())
+		Expect(s.load().nodes.older).To(BeEmpty())
+	})
+	It("keeps the configured number of container points until the container restarts", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetRetainedPoints(4)
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		start := time.Now()
+		point := func(start time.Time, i int) MetricsPoint {
+			return newMetricsPoint(start, start.Add(time.Duration(i)*time.Minute), uint64(i)*CoreSecond, MiByte)
+		}
+
+		By("storing more points than kept")
+		for i := 1; i <= 5; i++ {
+			s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", point(start, i)})))
+		}
+		Expect(s.load().pods.points(podRef, "container1")).To(Equal([]MetricsPoint{point(start, 2), point(start, 3), point(start, 4), point(start, 5)}))
+
+		By("dropping older points of a restarted container")
+		restart := start.Add(6 * time.Minute)
+		s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", point(restart, 2)})))
+		Expect(s.load().pods.points(podRef, "container1")).To(Equal([]MetricsPoint{newMetricsPoint(restart, restart, 0, MiByte), point(restart, 2)}))
+		Expect(s.load().pods.older).To(BeEmpty())
+	})
+	It("doesn't modify points of published states", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetRetainedPoints(3)
+		start := time.Now()
+		for i := 1; i <= 3; i++ {
+			s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(time.Duration(i)*10*time.Second), uint64(i)*CoreSecond, MiByte)}))
+		}
+		snapshot := s.Snapshot()
+		published := append([]MetricsPoint(nil), snapshot.nodes.older["node1"]...)
+
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(40*time.Second), 4*CoreSecond, MiByte)}))
+		Expect(snapshot.nodes.older["node1"]).To(Equal(published))
+	})
+})
+
+func checkNodeUsage(s *storage, name string, window time.Duration) {
+	ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ms).To(HaveLen(1))
+	Expect(ms[0].Window.Duration).To(Equal(window))
+}
@@ -0,0 +1,132 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"math"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// smoothedUsage is an exponentially weighted moving average of the CPU and
+// memory usage of a node or container.
+type smoothedUsage struct {
+	// timestamp is the timestamp of the last point averaged.
+	timestamp time.Time
+	// cpu is the averaged CPU usage in nanocores.
+	cpu float64
+	// memory is the averaged memory usage in bytes.
+	memory float64
+}
+
+// SetSmoothingHalfLife enables smoothing of served CPU and memory usage with
+// an exponentially weighted moving average, in which the weight of a point
+// halves every halfLife. 0 serves usage of the last points.
+func (s *storage) SetSmoothingHalfLife(halfLife time.Duration) {
+	s.update(func(next *state) {
+		next.nodes.halfLife = halfLife
+		next.pods.halfLife = halfLife
+	})
+}
+
+// smooth returns the average after adding the usage calculated at last from
+// base to average u, ok is false if usage can't be calculated. The average
+// restarts if it wasn't found, or is newer than last or precedes a restart.
+func smooth(u smoothedUsage, found bool, last, base MetricsPoint, halfLife time.Duration) (res smoothedUsage, ok bool) {
+	cpu, memory, ok := usageRate(last, base)
+	if !ok {
+		return smoothedUsage{}, false
+	}
+	if found && u.timestamp.Equal(last.Timestamp) {
+		// No new point was stored
+		return u, true
+	}
+	if !found || u.timestamp.After(last.Timestamp) || u.timestamp.Before(last.StartTime) {
+		return smoothedUsage{timestamp: last.Timestamp, cpu: cpu, memory: memory}, true
+	}
+	alpha := 1 - math.Exp2(-float64(last.Timestamp.Sub(u.timestamp))/float64(halfLife))
+	return smoothedUsage{
+		timestamp: last.Timestamp,
+		cpu:       u.cpu + alpha*(cpu-u.cpu),
+		memory:    u.memory + alpha*(memory-u.memory),
+	}, true
+}
+
+// usageRate returns CPU usage in nanocores and memory usage in bytes at last,
+// calculated from base, ok is false if they can't be calculated.
+func usageRate(last, base MetricsPoint) (cpu, memory float64, ok bool) {
+	window := last.Timestamp.Sub(base.Timestamp)
+	if window <= 0 || last.CumulativeCpuUsed < base.CumulativeCpuUsed || last.StartTime.Before(base.StartTime) {
+		return 0, 0, false
+	}
+	return float64(last.CumulativeCpuUsed-base.CumulativeCpuUsed) / window.Seconds(), float64(last.MemoryUsage), true
+}
+
+// apply replaces CPU and memory usage in usage with the average.
+func (u smoothedUsage) apply(usage corev1.ResourceList) {
+	if _, found := usage[corev1.ResourceCPU]; found {
+		usage[corev1.ResourceCPU] = uint64Quantity(uint64(math.Round(u.cpu)), resource.DecimalSI, -9)
+	}
+	if _, found := usage[corev1.ResourceMemory]; found {
+		usage[corev1.ResourceMemory] = uint64Quantity(uint64(math.Round(u.memory)), resource.BinarySI, 0)
+	}
+}
+
+// updateSmoothed averages usage of the last stored points into a new map, as
+// the current one may be referenced by published states.
+func (s *nodeStorage) updateSmoothed() {
+	if s.halfLife <= 0 {
+		s.smoothed = nil
+		return
+	}
+	smoothed := make(map[string]smoothedUsage, len(s.prev))
+	for name, prev := range s.prev {
+		last := s.last[name]
+		u, found := s.smoothed[name]
+		if u, ok := smooth(u, found, last, rateBase(s.older[name], prev, last, s.cpuRateWindow), s.halfLife); ok {
+			smoothed[name] = u
+		}
+	}
+	s.smoothed = smoothed
+}
+
+// updateSmoothed averages usage of the last stored container points into a
+// new map, as the current one may be referenced by published states.
+func (s *podStorage) updateSmoothed() {
+	if s.halfLife <= 0 {
+		s.smoothed = nil
+		return
+	}
+	smoothed := make(map[apitypes.NamespacedName]map[string]smoothedUsage, len(s.prev))
+	for podRef, prevPod := range s.prev {
+		lastPod := s.last[podRef]
+		containers := make(map[string]smoothedUsage, len(prevPod.Containers))
+		for name, prev := range prevPod.Containers {
+			last, found := lastPod.Containers[name]
+			if !found {
+				continue
+			}
+			u, found := s.smoothed[podRef][name]
+			if u, ok := smooth(u, found, last, rateBase(s.older[podRef][name], prev, last, s.cpuRateWindow), s.halfLife); ok {
+				containers[name] = u
+			}
+		}
+		smoothed[podRef] = containers
+	}
+	s.smoothed = smoothed
+}
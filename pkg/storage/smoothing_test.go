@@ -0,0 +1,100 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Usage smoothing", func() {
+	It("averages node usage weighted by the half-life", func() {
+		s := NewStorage(10 * time.Second)
+		s.SetSmoothingHalfLife(10 * time.Second)
+		start := time.Now()
+
+		By("serving the first usage unchanged")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(10*time.Second), 0, MiByte)}))
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(20*time.Second), 10*CoreSecond, MiByte)}))
+		checkSmoothedNodeUsage(s, "node1", 1000, MiByte)
+
+		By("moving halfway to usage after one half-life")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(30*time.Second), 40*CoreSecond, 3*MiByte)}))
+		checkSmoothedNodeUsage(s, "node1", 2000, 2*MiByte)
+
+		By("keeping the average when no new point is stored")
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(30*time.Second), 40*CoreSecond, 3*MiByte)}))
+		checkSmoothedNodeUsage(s, "node1", 2000, 2*MiByte)
+
+		By("dropping the average of nodes missing from a batch")
+		s.Store(nodeMetricBatch())
+		Expect(s.load().nodes.smoothed).To(BeEmpty())
+	})
+	It("restarts the average of restarted containers", func() {
+		s := NewStorage(10 * time.Second)
+		s.SetSmoothingHalfLife(10 * time.Second)
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		start := time.Now()
+		store := func(start time.Time, ts time.Duration, cpu, memory uint64) {
+			s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(ts), cpu, memory)})))
+		}
+
+		store(start, time.Minute, 0, MiByte)
+		store(start, time.Minute+10*time.Second, 10*CoreSecond, MiByte)
+		store(start, time.Minute+20*time.Second, 40*CoreSecond, 3*MiByte)
+		checkSmoothedContainerUsage(s, podRef, 2000, 2*MiByte)
+
+		restart := start.Add(2 * time.Minute)
+		store(restart, time.Minute, 30*CoreSecond, 4*MiByte)
+		checkSmoothedContainerUsage(s, podRef, 500, 4*MiByte)
+		store(restart, time.Minute+10*time.Second, 50*CoreSecond, 4*MiByte)
+		checkSmoothedContainerUsage(s, podRef, 1250, 4*MiByte)
+	})
+	It("doesn't smooth usage by default", func() {
+		s := NewStorage(10 * time.Second)
+		start := time.Now()
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(10*time.Second), 0, MiByte)}))
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(20*time.Second), 10*CoreSecond, MiByte)}))
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(30*time.Second), 40*CoreSecond, 3*MiByte)}))
+		Expect(s.load().nodes.smoothed).To(BeNil())
+		checkSmoothedNodeUsage(s, "node1", 3000, 3*MiByte)
+	})
+})
+
+func checkSmoothedNodeUsage(s *storage, name string, milliCores, memory int64) {
+	ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ms).To(HaveLen(1))
+	checkUsage(ms[0].Usage, milliCores, memory)
+}
+
+func checkSmoothedContainerUsage(s *storage, podRef apitypes.NamespacedName, milliCores, memory int64) {
+	ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ms).To(HaveLen(1))
+	Expect(ms[0].Containers).To(HaveLen(1))
+	checkUsage(ms[0].Containers[0].Usage, milliCores, memory)
+}
+
+func checkUsage(usage corev1.ResourceList, milliCores, memory int64) {
+	Expect(usage.Cpu().MilliValue()).To(Equal(milliCores))
+	Expect(usage.Memory().Value()).To(Equal(memory))
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/metrics/pkg/apis/metrics"
+)
+
+// Snapshot is a consistent, read only view of storage at some point in time.
+//
+// Store never modifies maps of points after they are published, it replaces
+// them, so taking a snapshot only copies references and a snapshot can be
+// used for as long as needed without blocking writes.
+type Snapshot struct {
+	nodes nodeStorage
+	pods  podStorage
+	// resourceNames renames resources of returned metrics.
+	resourceNames ResourceNames
+}
+
+// Snapshot returns the current state of storage.
+func (s *storage) Snapshot() Snapshot {
+	st := s.load()
+	return Snapshot{nodes: st.nodes, pods: st.pods, resourceNames: st.resourceNames}
+}
+
+// NodeMetrics returns metrics of all nodes in the snapshot, sorted by name.
+// Returned objects only have the node name set in their metadata.
+func (s Snapshot) NodeMetrics() []metrics.NodeMetrics {
+	nodes := make([]*corev1.Node, 0, len(s.nodes.last))
+	for name := range s.nodes.last {
+		nodes = append(nodes, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	ms, _ := s.nodes.GetMetrics(klog.Background(), nil, nodes...)
+	s.resourceNames.applyNodes(ms)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Name < ms[j].Name })
+	return ms
+}
+
+// PodMetrics returns metrics of all pods in the snapshot, sorted by namespace and name.
+// Returned objects only have the pod namespace and name set in their metadata.
+func (s Snapshot) PodMetrics() []metrics.PodMetrics {
+	pods := make([]*metav1.PartialObjectMetadata, 0, len(s.pods.last))
+	for ref := range s.pods.last {
+		pods = append(pods, &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: ref.Namespace}})
+	}
+	ms, _ := s.pods.GetMetrics(klog.Background(), nil, pods...)
+	s.resourceNames.applyPods(ms)
+	sort.Slice(ms, func(i, j int) bool {
+		if ms[i].Namespace != ms[j].Namespace {
+			return ms[i].Namespace < ms[j].Namespace
+		}
+		return ms[i].Name < ms[j].Name
+	})
+	return ms
+}
+
+// Stats summarizes the points held by a snapshot.
+type Stats struct {
+	// Nodes is the number of nodes with a point from the last scrape.
+	Nodes int `json:"nodes"`
+	// ServedNodes is the number of nodes with two consecutive points, whose usage is served.
+	ServedNodes int `json:"servedNodes"`
+	// Pods is the number of pods with a point from the last scrape.
+	Pods int `json:"pods"`
+	// ServedPods is the number of pods with two consecutive points, whose usage is served.
+	ServedPods int `json:"servedPods"`
+	// Containers is the number of containers of pods with a point from the last scrape.
+	Containers int `json:"containers"`
+	// OlderPoints is the number of node and container points retained before the last two.
+	OlderPoints int `json:"olderPoints"`
+	// OldestPoint is the timestamp of the oldest point from the last scrape.
+	OldestPoint *time.Time `json:"oldestPoint,omitempty"`
+	// NewestPoint is the timestamp of the newest point from the last scrape.
+	NewestPoint *time.Time `json:"newestPoint,omitempty"`
+}
+
+// Stats returns statistics of the points held by the snapshot.
+func (s Snapshot) Stats() Stats {
+	stats := Stats{
+		Nodes:       len(s.nodes.last),
+		ServedNodes: len(s.nodes.prev),
+		Pods:        len(s.pods.last),
+		ServedPods:  len(s.pods.prev),
+	}
+	observe := func(timestamp time.Time) {
+		if stats.OldestPoint == nil || timestamp.Before(*stats.OldestPoint) {
+			stats.OldestPoint = &timestamp
+		}
+		if stats.NewestPoint == nil || timestamp.After(*stats.NewestPoint) {
+			stats.NewestPoint = &timestamp
+		}
+	}
+	for _, point := range s.nodes.last {
+		observe(point.Timestamp)
+	}
+	for _, pod := range s.pods.last {
+		stats.Containers += len(pod.Containers)
+		for _, point := range pod.Containers {
+			observe(point.Timestamp)
+		}
+	}
+	for _, points := range s.nodes.older {
+		stats.OlderPoints += len(points)
+	}
+	for _, containers := range s.pods.older {
+		for _, points := range containers {
+			stats.OlderPoints += len(points)
+		}
+	}
+	return stats
+}
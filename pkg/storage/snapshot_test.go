@@ -0,0 +1,133 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Snapshot", func() {
+	It("is not affected by later stores", func() {
+		s := NewStorage(60 * time.Second)
+		start := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		batch := func(ts time.Duration, cpu uint64) *MetricsBatch {
+			b := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(ts), cpu, 2*MiByte)})
+			b.Pods = podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(ts), cpu, 1*MiByte)})).Pods
+			return b
+		}
+
+		By("storing two batches and taking a snapshot")
+		s.Store(batch(110*time.Second, 10*CoreSecond))
+		s.Store(batch(120*time.Second, 20*CoreSecond))
+		snapshot := s.Snapshot()
+
+		By("storing a batch after the snapshot was taken")
+		s.Store(batch(130*time.Second, 50*CoreSecond))
+
+		By("returning usage from before the last store")
+		nodes := snapshot.NodeMetrics()
+		Expect(nodes).To(HaveLen(1))
+		Expect(nodes[0].Name).To(Equal("node1"))
+		Expect(nodes[0].Usage[corev1.ResourceCPU]).To(Equal(*resource.NewScaledQuantity(CoreSecond, -9)))
+		pods := snapshot.PodMetrics()
+		Expect(pods).To(HaveLen(1))
+		Expect(pods[0].Name).To(Equal("pod1"))
+		Expect(pods[0].Containers[0].Usage[corev1.ResourceCPU]).To(Equal(*resource.NewScaledQuantity(CoreSecond, -9)))
+	})
+	It("summarizes stored points", func() {
+		s := NewStorage(60 * time.Second)
+		s.SetRetainedPoints(3)
+		start := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		batch := func(ts time.Duration, cpu uint64) *MetricsBatch {
+			b := nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(ts), cpu, 2*MiByte)})
+			b.Pods = podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(ts-time.Second), cpu, 1*MiByte)})).Pods
+			return b
+		}
+		Expect(s.Snapshot().Stats()).To(Equal(Stats{}))
+
+		s.Store(batch(110*time.Second, 10*CoreSecond))
+		stats := s.Snapshot().Stats()
+		Expect(stats.Nodes).To(Equal(1))
+		Expect(stats.ServedNodes).To(Equal(0))
+
+		s.Store(batch(120*time.Second, 20*CoreSecond))
+		s.Store(batch(130*time.Second, 30*CoreSecond))
+		stats = s.Snapshot().Stats()
+		Expect(stats.Nodes).To(Equal(1))
+		Expect(stats.ServedNodes).To(Equal(1))
+		Expect(stats.Pods).To(Equal(1))
+		Expect(stats.ServedPods).To(Equal(1))
+		Expect(stats.Containers).To(Equal(1))
+		Expect(stats.OlderPoints).To(Equal(2))
+		Expect(stats.OldestPoint.Equal(start.Add(129 * time.Second))).To(BeTrue())
+		Expect(stats.NewestPoint.Equal(start.Add(130 * time.Second))).To(BeTrue())
+	})
+	It("doesn't block reads while storing", func() {
+		s := NewStorage(60 * time.Second)
+		start := time.Now()
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(10*time.Second), 0, MiByte)}))
+		s.Store(nodeMetricBatch(nodeMetricsPoint{"node1", newMetricsPoint(start, start.Add(20*time.Second), 10*CoreSecond, MiByte)}))
+
+		By("holding the writer lock like a store in progress")
+		s.storeMu.Lock()
+		defer s.storeMu.Unlock()
+
+		By("serving the last published state")
+		Expect(s.Ready()).To(BeTrue())
+		ms, err := s.GetNodeMetrics(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(1))
+		Expect(s.Snapshot().NodeMetrics()).To(HaveLen(1))
+	})
+	It("serves reads concurrent with stores", func() {
+		s := NewStorage(60 * time.Second)
+		start := time.Now()
+		podRef := apitypes.NamespacedName{Name: "pod1", Namespace: "ns1"}
+		pod := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: podRef.Name, Namespace: podRef.Namespace}}
+		s.SetHistoryLength(3)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 1; i <= 100; i++ {
+				s.Store(podMetricsBatch(podMetrics(podRef, containerMetricsPoint{"container1", newMetricsPoint(start, start.Add(time.Duration(i)*time.Second), uint64(i)*CoreSecond, MiByte)})))
+			}
+		}()
+		for stored := false; !stored; {
+			select {
+			case <-done:
+				stored = true
+			default:
+			}
+			_, err := s.GetPodMetrics(pod)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = s.GetPodMetricsHistory(pod)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		history, err := s.GetPodMetricsHistory(pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(history).To(HaveLen(3))
+	})
+})
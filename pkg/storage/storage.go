@@ -17,49 +17,160 @@ package storage
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
 	"k8s.io/metrics/pkg/apis/metrics"
 )
 
-// nodeStorage is a thread save nodeStorage for node and pod metrics.
+// storage is a thread safe storage for node and pod metrics.
+//
+// Reads never block: the stored metrics and settings form an immutable state
+// that writers replace with an updated copy, and readers use the state
+// current when they start, however long they take, e.g. listing the metrics
+// of all pods of a large cluster.
 type storage struct {
-	mu    sync.RWMutex
+	// storeMu serializes writers, which build the next state from the current one.
+	storeMu sync.Mutex
+	current atomic.Pointer[state]
+	// evictions tracks deleted nodes and pods whose points are not stored.
+	evictions evictions
+}
+
+// state is a version of storage. It is never modified once published.
+type state struct {
 	pods  podStorage
 	nodes nodeStorage
+	// synthetic stores points of synthetic pods, which are only served to requests naming them.
+	synthetic podStorage
+	// history keeps the most recent states, oldest first, up to historyLength.
+	history       []Snapshot
+	historyLength int
+	// resourceNames renames resources of served metrics.
+	resourceNames ResourceNames
+	// filter optionally excludes nodes and pods from served metrics.
+	filter Filter
+	// evictionTTL is the age of stored points swept from storage, 0 keeps them.
+	evictionTTL time.Duration
+	// logger logs on behalf of storage.
+	logger klog.Logger
 }
 
 var _ Storage = (*storage)(nil)
 
 func NewStorage(metricResolution time.Duration) *storage {
-	return &storage{pods: podStorage{metricResolution: metricResolution}}
+	s := &storage{}
+	s.current.Store(&state{pods: podStorage{metricResolution: metricResolution}, logger: klog.Background()})
+	return s
+}
+
+// load returns the current state, which must not be modified.
+func (s *storage) load() *state {
+	return s.current.Load()
+}
+
+// update publishes a copy of the current state modified by fn.
+func (s *storage) update(fn func(next *state)) {
+	defer s.lockWrites()()
+	next := *s.load()
+	fn(&next)
+	s.current.Store(&next)
+}
+
+// SetLogger sets the logger storage logs with, instead of the global one.
+func (s *storage) SetLogger(logger klog.Logger) {
+	s.update(func(next *state) {
+		next.logger = logger
+	})
+}
+
+// SetResourceNames renames resources of served metrics according to names.
+func (s *storage) SetResourceNames(names ResourceNames) {
+	s.update(func(next *state) {
+		next.resourceNames = names
+	})
 }
 
 // Ready returns true if metrics-server's storage has accumulated enough metric
 // points to serve NodeMetrics.
 func (s *storage) Ready() bool {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.nodes.prev) != 0 || len(s.pods.prev) != 0
+	st := s.load()
+	return len(st.nodes.prev) != 0 || len(st.pods.prev) != 0
+}
+
+// NodesReady returns true if storage has accumulated enough metric points to serve NodeMetrics.
+func (s *storage) NodesReady() bool {
+	return len(s.load().nodes.prev) != 0
+}
+
+// PodsReady returns true if storage has accumulated enough metric points to serve PodMetrics.
+func (s *storage) PodsReady() bool {
+	return len(s.load().pods.prev) != 0
 }
 
 func (s *storage) GetNodeMetrics(nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.nodes.GetMetrics(nodes...)
+	return s.GetNodeResourceMetrics(nil, nodes...)
+}
+
+// GetNodeResourceMetrics implements api.NodeResourceMetricsGetter, usage of
+// other resources isn't computed.
+func (s *storage) GetNodeResourceMetrics(resources []corev1.ResourceName, nodes ...*corev1.Node) ([]metrics.NodeMetrics, error) {
+	st := s.load()
+	ms, err := st.nodes.GetMetrics(st.logger, st.resourceNames.sources(resources), st.filterNodes(nodes)...)
+	st.resourceNames.applyNodes(ms)
+	return ms, err
 }
 
 func (s *storage) GetPodMetrics(pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.pods.GetMetrics(pods...)
+	return s.GetPodResourceMetrics(nil, pods...)
+}
+
+// GetPodResourceMetrics implements api.PodResourceMetricsGetter, usage of
+// other resources isn't computed.
+func (s *storage) GetPodResourceMetrics(resources []corev1.ResourceName, pods ...*metav1.PartialObjectMetadata) ([]metrics.PodMetrics, error) {
+	st := s.load()
+	pods = st.filterPods(pods)
+	sources := st.resourceNames.sources(resources)
+	ms, err := st.pods.GetMetrics(st.logger, sources, pods...)
+	if err == nil && len(st.synthetic.last) != 0 {
+		var synthetic []metrics.PodMetrics
+		synthetic, err = st.synthetic.GetMetrics(st.logger, sources, pods...)
+		ms = append(ms, synthetic...)
+	}
+	st.resourceNames.applyPods(ms)
+	return ms, err
 }
 
 func (s *storage) Store(batch *MetricsBatch) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.nodes.Store(batch)
-	s.pods.Store(batch)
+	defer s.lockWrites()()
+	// Stored maps are replaced, never modified, so the next state is built
+	// from copies of the current one while readers keep serving it. Dropping
+	// points of removed pods doesn't block readers either, the old maps are
+	// left to the garbage collector.
+	prev := s.load()
+	next := *prev
+	batch = s.evictions.apply(batch)
+	batch, synthetic := splitSynthetic(batch)
+	next.nodes.Store(next.logger, batch)
+	next.pods.Store(next.logger, batch)
+	next.storeSynthetic(synthetic)
+	next.sweep(s.evictions.time())
+	recordChurn(prev, &next)
+	next.recordFootprint()
+	next.recordHistory()
+	s.current.Store(&next)
+}
+
+// lockWrites takes the write lock and returns a function releasing it, which
+// records how long it was held.
+func (s *storage) lockWrites() (unlock func()) {
+	s.storeMu.Lock()
+	start := time.Now()
+	return func() {
+		writeLockDuration.Observe(time.Since(start).Seconds())
+		s.storeMu.Unlock()
+	}
 }
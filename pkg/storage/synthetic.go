@@ -0,0 +1,59 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+// splitSynthetic returns batch without its synthetic pods, and a batch of
+// only them. batch is copied only if it has synthetic pods.
+func splitSynthetic(batch *MetricsBatch) (real, synthetic *MetricsBatch) {
+	synthetic = &MetricsBatch{}
+	for ref, pod := range batch.Pods {
+		if !pod.Synthetic {
+			continue
+		}
+		if synthetic.Pods == nil {
+			synthetic.Pods = map[apitypes.NamespacedName]PodMetricsPoint{}
+		}
+		synthetic.Pods[ref] = pod
+	}
+	if len(synthetic.Pods) == 0 {
+		return batch, synthetic
+	}
+	copied := *batch
+	copied.Pods = make(map[apitypes.NamespacedName]PodMetricsPoint, len(batch.Pods)-len(synthetic.Pods))
+	for ref, pod := range batch.Pods {
+		if !pod.Synthetic {
+			copied.Pods[ref] = pod
+		}
+	}
+	return &copied, synthetic
+}
+
+// storeSynthetic stores points of synthetic pods apart from other pods, with
+// the same settings, so they are served but never part of snapshots or
+// history.
+func (st *state) storeSynthetic(batch *MetricsBatch) {
+	if len(batch.Pods) == 0 && len(st.synthetic.last) == 0 {
+		return
+	}
+	synthetic := st.pods
+	synthetic.last, synthetic.prev = st.synthetic.last, st.synthetic.prev
+	synthetic.older, synthetic.smoothed = st.synthetic.older, st.synthetic.smoothed
+	synthetic.Store(st.logger, batch)
+	st.synthetic = synthetic
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Synthetic pods", func() {
+	var (
+		s         *storage
+		start     time.Time
+		pod1      = apitypes.NamespacedName{Namespace: "ns1", Name: "pod1"}
+		synthetic = apitypes.NamespacedName{Namespace: "ns1", Name: "canary"}
+	)
+	BeforeEach(func() {
+		s = NewStorage(10 * time.Second)
+		start = time.Now()
+	})
+	batch := func(offset time.Duration) *MetricsBatch {
+		ts := start.Add(offset)
+		cpu := uint64(offset/time.Second) * CoreSecond
+		b := podMetricsBatch(
+			podMetrics(pod1, containerMetricsPoint{"c1", newMetricsPoint(start, ts, cpu, MiByte)}),
+			podMetrics(synthetic, containerMetricsPoint{"c1", newMetricsPoint(start, ts, cpu, MiByte)}),
+		)
+		point := b.Pods[synthetic]
+		point.Synthetic = true
+		b.Pods[synthetic] = point
+		return b
+	}
+
+	It("serves synthetic pods only to requests naming them", func() {
+		s.Store(batch(10 * time.Second))
+		s.Store(batch(20 * time.Second))
+		ms, err := s.GetPodMetrics(
+			&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: pod1.Namespace, Name: pod1.Name}},
+			&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: synthetic.Namespace, Name: synthetic.Name}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(HaveLen(2))
+		Expect(ms[1].Name).To(Equal(synthetic.Name))
+
+		By("keeping them out of snapshots")
+		pods := s.Snapshot().PodMetrics()
+		Expect(pods).To(HaveLen(1))
+		Expect(pods[0].Name).To(Equal(pod1.Name))
+	})
+	It("drops synthetic pods missing from the next batch", func() {
+		s.Store(batch(10 * time.Second))
+		s.Store(batch(20 * time.Second))
+		b := batch(30 * time.Second)
+		delete(b.Pods, synthetic)
+		s.Store(b)
+		ms, err := s.GetPodMetrics(&metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: synthetic.Namespace, Name: synthetic.Name}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms).To(BeEmpty())
+	})
+	It("doesn't write synthetic pods in batches", func() {
+		var buf bytes.Buffer
+		Expect(WriteBatch(&buf, batch(10*time.Second))).To(Succeed())
+		b, err := ReadBatch(&buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(b.Pods).To(HaveKey(pod1))
+		Expect(b.Pods).NotTo(HaveKey(synthetic))
+	})
+})
@@ -23,19 +23,112 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	apitypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
-
-	"sigs.k8s.io/metrics-server/pkg/api"
 )
 
+// ResourcePID is the resource name of the number of processes, as used by Kubelet for pid reservations.
+const ResourcePID corev1.ResourceName = "pid"
+
+// TimeInfo represents the timing information for a metric, which was
+// potentially calculated over some window of time (e.g. for CPU usage rate).
+type TimeInfo struct {
+	// NB: we consider the earliest timestamp amongst multiple containers
+	// for the purposes of determining if a metric is tained by a time
+	// period, like pod startup (used by things like the HPA).
+
+	// Timestamp is the time at which the metrics were initially collected.
+	// In the case of a rate metric, it should be the timestamp of the last
+	// data point used in the calculation.  If it represents multiple metric
+	// points, it should be the earliest such timestamp from all of the points.
+	Timestamp time.Time
+
+	// Window represents the window used to calculate rate metrics associated
+	// with this timestamp.
+	Window time.Duration
+}
+
 // MetricsBatch is a single batch of pod, container, and node metrics from some source.
 type MetricsBatch struct {
 	Nodes map[string]MetricsPoint
 	Pods  map[apitypes.NamespacedName]PodMetricsPoint
+	// PushedNodes are nodes whose metrics were pushed by a node agent instead of scraped from Kubelet.
+	PushedNodes map[string]bool
+	// WindowsNodes are nodes whose metrics were read from a Windows Kubelet.
+	WindowsNodes map[string]bool
+	// NodeFilesystems is the usage of filesystems of nodes. Empty if not collected.
+	NodeFilesystems map[string][]FilesystemMetricsPoint
 }
 
 // PodMetricsPoint contains the metrics for some pod's containers.
 type PodMetricsPoint struct {
+	// Pod is the pod cgroup level metrics point, including sandbox and runtime overhead. Zero if not reported.
+	Pod        MetricsPoint
 	Containers map[string]MetricsPoint
+	// Node is the name of the node the pod's metrics were read from. Empty if unknown.
+	Node string
+	// Volumes is the usage of volumes backed by persistent volume claims. Empty if not collected.
+	Volumes []VolumeMetricsPoint
+	// Filesystems is the usage of the pod's ephemeral storage. Empty if not collected.
+	Filesystems []FilesystemMetricsPoint
+	// ProcessCount is the number of processes running in the pod. Zero if not collected.
+	ProcessCount uint64
+	// NodeDraining is true if the pod's node was cordoned when it was scraped, so the pod is likely to be evicted.
+	NodeDraining bool
+	// NodeRemoved is true if the pod's node was deleted from the API and its last metrics are served during a grace period.
+	NodeRemoved bool
+	// Pushed is true if the pod's metrics were pushed by a node agent instead of scraped from Kubelet.
+	Pushed bool
+	// Windows is true if the pod's metrics were read from a Windows Kubelet.
+	Windows bool
+	// Devices are the devices allocated to containers of the pod. Empty if not collected.
+	Devices []DeviceAllocation
+	// Synthetic is true for pods that don't exist, e.g. a canary checking the metrics pipeline.
+	// Their metrics are only served to requests naming them, and are kept out of snapshots and written batches.
+	Synthetic bool
+}
+
+// DeviceAllocation represents devices allocated to a container by a device plugin or a dynamic resource claim.
+type DeviceAllocation struct {
+	Container string
+	// Resource is the extended resource name of device plugin devices, empty for claims.
+	Resource string
+	// Claim is the namespace/name of the resource claim of dynamically allocated devices, empty for device plugin devices.
+	Claim string
+	// IDs are the device IDs, or the CDI device names of claims.
+	IDs []string
+}
+
+// VolumeMetricsPoint represents usage of a volume backed by a persistent volume claim.
+type VolumeMetricsPoint struct {
+	// ClaimName is the name of the persistent volume claim in the pod namespace.
+	ClaimName string
+	// CapacityBytes is the total capacity of the volume filesystem. Unit: bytes.
+	CapacityBytes uint64
+	// UsedBytes is the space used on the volume filesystem. Unit: bytes.
+	UsedBytes uint64
+}
+
+// Names of filesystems reported in FilesystemMetricsPoint.
+const (
+	// FilesystemNode is the filesystem of the Kubelet root directory, holding logs and emptyDir volumes.
+	FilesystemNode = "nodefs"
+	// FilesystemImage is the filesystem the container runtime stores images on.
+	FilesystemImage = "imagefs"
+	// FilesystemContainer is the filesystem the container runtime stores writable layers of containers on, if split from imagefs.
+	FilesystemContainer = "containerfs"
+	// FilesystemEphemeralStorage is the ephemeral storage of a pod: writable layers, logs and emptyDir volumes of its containers.
+	FilesystemEphemeralStorage = "ephemeral-storage"
+)
+
+// FilesystemMetricsPoint represents usage of a filesystem of a node, or of a pod on its node's filesystems.
+type FilesystemMetricsPoint struct {
+	// Name is one of the Filesystem* names.
+	Name string
+	// CapacityBytes is the total capacity of the filesystem. Unit: bytes.
+	CapacityBytes uint64
+	// AvailableBytes is the space available on the filesystem. Unit: bytes.
+	AvailableBytes uint64
+	// UsedBytes is the space used on the filesystem by the node or pod. Unit: bytes.
+	UsedBytes uint64
 }
 
 // MetricsPoint represents the a set of specific metrics at some point in time.
@@ -48,24 +141,61 @@ type MetricsPoint struct {
 	CumulativeCpuUsed uint64
 	// MemoryUsage is the working set size. Unit: bytes.
 	MemoryUsage uint64
+	// ProcessCount is the number of processes running at Timestamp. Zero if not collected.
+	ProcessCount uint64
+	// CumulativeCfsPeriods is the number of elapsed CFS enforcement periods of a container with CPU limit. Zero if not collected.
+	CumulativeCfsPeriods uint64
+	// CumulativeCfsThrottledPeriods is the number of CFS periods in which the container was throttled.
+	CumulativeCfsThrottledPeriods uint64
+	// CumulativeCfsThrottledTime is the total time the container was throttled. Unit: nanoseconds.
+	CumulativeCfsThrottledTime uint64
+	// Supplemental is the usage of additional node resources read from supplemental sources, nil if not collected.
+	// It's a pointer to keep points comparable and is never modified once set.
+	Supplemental *corev1.ResourceList
 }
 
-func resourceUsage(last, prev MetricsPoint) (corev1.ResourceList, api.TimeInfo, error) {
+// resourceSet selects resources usage is computed for, nil selects all of them.
+type resourceSet map[corev1.ResourceName]struct{}
+
+func (s resourceSet) has(name corev1.ResourceName) bool {
+	if s == nil {
+		return true
+	}
+	_, found := s[name]
+	return found
+}
+
+// resourceUsage computes usage of resources selected by resources between prev and last.
+func resourceUsage(last, prev MetricsPoint, resources resourceSet) (corev1.ResourceList, TimeInfo, error) {
 	if last.StartTime.Before(prev.StartTime) {
-		return corev1.ResourceList{}, api.TimeInfo{}, fmt.Errorf("unexpected decrease in startTime of node/container")
+		return corev1.ResourceList{}, TimeInfo{}, fmt.Errorf("unexpected decrease in startTime of node/container")
 	}
 	if last.CumulativeCpuUsed < prev.CumulativeCpuUsed {
-		return corev1.ResourceList{}, api.TimeInfo{}, fmt.Errorf("unexpected decrease in cumulative CPU usage value")
+		return corev1.ResourceList{}, TimeInfo{}, fmt.Errorf("unexpected decrease in cumulative CPU usage value")
 	}
 	window := last.Timestamp.Sub(prev.Timestamp)
-	cpuUsage := float64(last.CumulativeCpuUsed-prev.CumulativeCpuUsed) / window.Seconds()
-	return corev1.ResourceList{
-			corev1.ResourceCPU:    uint64Quantity(uint64(cpuUsage), resource.DecimalSI, -9),
-			corev1.ResourceMemory: uint64Quantity(last.MemoryUsage, resource.BinarySI, 0),
-		}, api.TimeInfo{
-			Timestamp: last.Timestamp,
-			Window:    window,
-		}, nil
+	usage := make(corev1.ResourceList, 2)
+	if resources.has(corev1.ResourceCPU) {
+		cpuUsage := float64(last.CumulativeCpuUsed-prev.CumulativeCpuUsed) / window.Seconds()
+		usage[corev1.ResourceCPU] = uint64Quantity(uint64(cpuUsage), resource.DecimalSI, -9)
+	}
+	if resources.has(corev1.ResourceMemory) {
+		usage[corev1.ResourceMemory] = uint64Quantity(last.MemoryUsage, resource.BinarySI, 0)
+	}
+	if last.ProcessCount != 0 && resources.has(ResourcePID) {
+		usage[ResourcePID] = uint64Quantity(last.ProcessCount, resource.DecimalSI, 0)
+	}
+	if last.Supplemental != nil {
+		for name, quantity := range *last.Supplemental {
+			if _, found := usage[name]; !found && resources.has(name) {
+				usage[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	return usage, TimeInfo{
+		Timestamp: last.Timestamp,
+		Window:    window,
+	}, nil
 }
 
 // uint64Quantity converts a uint64 into a Quantity, which only has constructors
@@ -76,7 +206,7 @@ func uint64Quantity(val uint64, format resource.Format, scale resource.Scale) re
 	if val > math.MaxInt64 {
 		// lose an decimal order-of-magnitude precision,
 		// so we can fit into a scaled quantity
-		klog.V(2).InfoS("Found unexpectedly large resource value, losing precision to fit in scaled resource.Quantity", "value", val)
+		klog.TODO().V(2).Info("Found unexpectedly large resource value, losing precision to fit in scaled resource.Quantity", "value", val)
 		q = *resource.NewScaledQuantity(int64(val/10), resource.Scale(1)+scale)
 	}
 	q.Format = format
@@ -20,8 +20,6 @@ import (
 	"testing"
 	"time"
 
-	"sigs.k8s.io/metrics-server/pkg/api"
-
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
@@ -54,7 +52,7 @@ func Test_resourceUsage(t *testing.T) {
 		last             MetricsPoint
 		prev             MetricsPoint
 		wantResourceList v1.ResourceList
-		wantTimeInfo     api.TimeInfo
+		wantTimeInfo     TimeInfo
 		wantErr          bool
 	}{
 		{
@@ -63,14 +61,30 @@ func Test_resourceUsage(t *testing.T) {
 			prev: newMetricsPoint(start, start.Add(10*time.Millisecond), 300, 400),
 			wantResourceList: v1.ResourceList{v1.ResourceCPU: uint64Quantity(uint64(20000), resource.DecimalSI, -9),
 				v1.ResourceMemory: uint64Quantity(600, resource.BinarySI, 0)},
-			wantTimeInfo: api.TimeInfo{Timestamp: start.Add(20 * time.Millisecond), Window: 10 * time.Millisecond},
+			wantTimeInfo: TimeInfo{Timestamp: start.Add(20 * time.Millisecond), Window: 10 * time.Millisecond},
+		},
+		{
+			name: "get resource usage with supplemental usage not overriding Kubelet resources",
+			last: func() MetricsPoint {
+				p := newMetricsPoint(start, start.Add(20*time.Millisecond), 500, 600)
+				p.Supplemental = &v1.ResourceList{
+					"example.com/disk-available": *resource.NewMilliQuantity(2500, resource.DecimalSI),
+					v1.ResourceMemory:            *resource.NewQuantity(1, resource.BinarySI),
+				}
+				return p
+			}(),
+			prev: newMetricsPoint(start, start.Add(10*time.Millisecond), 300, 400),
+			wantResourceList: v1.ResourceList{v1.ResourceCPU: uint64Quantity(uint64(20000), resource.DecimalSI, -9),
+				v1.ResourceMemory:            uint64Quantity(600, resource.BinarySI, 0),
+				"example.com/disk-available": *resource.NewMilliQuantity(2500, resource.DecimalSI)},
+			wantTimeInfo: TimeInfo{Timestamp: start.Add(20 * time.Millisecond), Window: 10 * time.Millisecond},
 		},
 		{
 			name:             "get resource usage failed because of unexpected decrease in startTime",
 			last:             newMetricsPoint(start, start.Add(20*time.Millisecond), 500, 600),
 			prev:             newMetricsPoint(start.Add(20*time.Millisecond), start.Add(10*time.Millisecond), 300, 400),
 			wantResourceList: v1.ResourceList{},
-			wantTimeInfo:     api.TimeInfo{},
+			wantTimeInfo:     TimeInfo{},
 			wantErr:          true,
 		},
 		{
@@ -78,13 +92,13 @@ func Test_resourceUsage(t *testing.T) {
 			last:             newMetricsPoint(start, start.Add(20*time.Millisecond), 100, 600),
 			prev:             newMetricsPoint(start, start.Add(10*time.Millisecond), 300, 400),
 			wantResourceList: v1.ResourceList{},
-			wantTimeInfo:     api.TimeInfo{},
+			wantTimeInfo:     TimeInfo{},
 			wantErr:          true,
 		},
 	}
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			resourceList, timeInfo, err := resourceUsage(tc.last, tc.prev)
+			resourceList, timeInfo, err := resourceUsage(tc.last, tc.prev, nil)
 			if (err != nil) != tc.wantErr {
 				t.Errorf("resourceUsage() error = %v, wantErr %v", err, tc.wantErr)
 				return
@@ -0,0 +1,269 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package transform applies site specific CEL expressions to scraped
+// metrics before they are stored, e.g. to clamp values, drop containers or
+// rescale units.
+package transform
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+// costLimit bounds the cost of evaluating an expression for a single point,
+// so expressions can't stall scraping.
+const costLimit = 10000
+
+var transformErrors = metrics.NewCounter(
+	&metrics.CounterOpts{
+		Namespace: "metrics_server",
+		Subsystem: "transform",
+		Name:      "errors_total",
+		Help:      "Number of metric points stored untransformed because evaluating a transformation expression failed",
+	},
+)
+
+// RegisterTransformMetrics registers metrics of metric transformations.
+func RegisterTransformMetrics(registrationFunc func(metrics.Registerable) error) error {
+	return registrationFunc(transformErrors)
+}
+
+// Config holds CEL expressions evaluated for each node, pod and container
+// metrics point. Expressions can use the string variables node, podNamespace,
+// pod and container, empty if not applicable to the point, and the int
+// variables cpu, the cumulative CPU time in nanoseconds, and memory, the
+// working set in bytes.
+type Config struct {
+	// Drop is a bool expression, points for which it is true are not stored.
+	Drop string `json:"drop,omitempty"`
+	// Resources maps cpu or memory to a number expression returning the stored value.
+	// As cpu is cumulative, its expression should preserve increases, e.g. rescale it.
+	Resources map[corev1.ResourceName]string `json:"resources,omitempty"`
+}
+
+// Transformer applies compiled expressions of a Config.
+type Transformer struct {
+	drop   cel.Program
+	cpu    cel.Program
+	memory cel.Program
+}
+
+// LoadFile reads a Config in YAML or JSON from path and compiles it.
+func LoadFile(path string) (*Transformer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read transform config: %w", err)
+	}
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("unable to decode transform config %q: %w", path, err)
+	}
+	return New(config)
+}
+
+// New compiles expressions of config.
+func New(config Config) (*Transformer, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("node", cel.StringType),
+		cel.Variable("podNamespace", cel.StringType),
+		cel.Variable("pod", cel.StringType),
+		cel.Variable("container", cel.StringType),
+		cel.Variable("cpu", cel.IntType),
+		cel.Variable("memory", cel.IntType),
+	)
+	if err != nil {
+		return nil, err
+	}
+	t := &Transformer{}
+	if config.Drop != "" {
+		t.drop, err = compile(env, "drop", config.Drop, cel.BoolType)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for resource, expression := range config.Resources {
+		switch resource {
+		case corev1.ResourceCPU:
+			t.cpu, err = compile(env, string(resource), expression, cel.IntType, cel.UintType, cel.DoubleType)
+		case corev1.ResourceMemory:
+			t.memory, err = compile(env, string(resource), expression, cel.IntType, cel.UintType, cel.DoubleType)
+		default:
+			err = fmt.Errorf("unsupported resource %q, expected %q or %q", resource, corev1.ResourceCPU, corev1.ResourceMemory)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func compile(env *cel.Env, name, expression string, outputTypes ...*cel.Type) (cel.Program, error) {
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid %s expression %q: %w", name, expression, issues.Err())
+	}
+	valid := false
+	for _, t := range outputTypes {
+		if t.IsAssignableType(ast.OutputType()) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid %s expression %q: unexpected result type %s", name, expression, ast.OutputType())
+	}
+	program, err := env.Program(ast, cel.CostLimit(costLimit))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s expression %q: %w", name, expression, err)
+	}
+	return program, nil
+}
+
+// Apply returns a batch with transformed points. The given batch is not
+// modified, as it can still be referenced by the scraper.
+func (t *Transformer) Apply(batch *storage.MetricsBatch) *storage.MetricsBatch {
+	res := &storage.MetricsBatch{
+		Nodes:        make(map[string]storage.MetricsPoint, len(batch.Nodes)),
+		Pods:         make(map[apitypes.NamespacedName]storage.PodMetricsPoint, len(batch.Pods)),
+		PushedNodes:  batch.PushedNodes,
+		WindowsNodes: batch.WindowsNodes,
+	}
+	failed := 0
+	for node, point := range batch.Nodes {
+		if point, keep := t.transform(map[string]interface{}{"node": node}, point, &failed); keep {
+			res.Nodes[node] = point
+		}
+	}
+	for pod, podPoint := range batch.Pods {
+		transformed := podPoint
+		vars := map[string]interface{}{"podNamespace": pod.Namespace, "pod": pod.Name}
+		if podPoint.Pod != (storage.MetricsPoint{}) {
+			point, keep := t.transform(vars, podPoint.Pod, &failed)
+			if !keep {
+				point = storage.MetricsPoint{}
+			}
+			transformed.Pod = point
+		}
+		transformed.Containers = make(map[string]storage.MetricsPoint, len(podPoint.Containers))
+		for container, point := range podPoint.Containers {
+			vars := map[string]interface{}{"podNamespace": pod.Namespace, "pod": pod.Name, "container": container}
+			if point, keep := t.transform(vars, point, &failed); keep {
+				transformed.Containers[container] = point
+			}
+		}
+		if len(transformed.Containers) != 0 {
+			res.Pods[pod] = transformed
+		}
+	}
+	if failed != 0 {
+		transformErrors.Add(float64(failed))
+	}
+	return res
+}
+
+// transform returns the transformed point and whether to keep it. Points are
+// kept untransformed if evaluating an expression fails, counting failures.
+func (t *Transformer) transform(vars map[string]interface{}, point storage.MetricsPoint, failed *int) (storage.MetricsPoint, bool) {
+	for _, name := range []string{"node", "podNamespace", "pod", "container"} {
+		if _, found := vars[name]; !found {
+			vars[name] = ""
+		}
+	}
+	vars["cpu"] = clampInt(point.CumulativeCpuUsed)
+	vars["memory"] = clampInt(point.MemoryUsage)
+	if t.drop != nil {
+		out, _, err := t.drop.Eval(vars)
+		if err != nil {
+			t.logError(err, "drop", vars)
+			*failed++
+			return point, true
+		}
+		if out == types.True {
+			return point, false
+		}
+	}
+	res := point
+	if t.cpu != nil {
+		v, err := evalUint(t.cpu, vars)
+		if err != nil {
+			t.logError(err, "cpu", vars)
+			*failed++
+			return point, true
+		}
+		res.CumulativeCpuUsed = v
+	}
+	if t.memory != nil {
+		v, err := evalUint(t.memory, vars)
+		if err != nil {
+			t.logError(err, "memory", vars)
+			*failed++
+			return point, true
+		}
+		res.MemoryUsage = v
+	}
+	return res, true
+}
+
+func (t *Transformer) logError(err error, expression string, vars map[string]interface{}) {
+	klog.V(2).InfoS("Failed evaluating transformation expression", "expression", expression, "node", vars["node"], "pod", klog.KRef(vars["podNamespace"].(string), vars["pod"].(string)), "container", vars["container"], "err", err)
+}
+
+// evalUint evaluates a number expression, truncating negative results to 0.
+func evalUint(program cel.Program, vars map[string]interface{}) (uint64, error) {
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	return toUint(out)
+}
+
+func toUint(v ref.Val) (uint64, error) {
+	switch v := v.(type) {
+	case types.Int:
+		if v < 0 {
+			return 0, nil
+		}
+		return uint64(v), nil
+	case types.Uint:
+		return uint64(v), nil
+	case types.Double:
+		if v < 0 || math.IsNaN(float64(v)) {
+			return 0, nil
+		}
+		if float64(v) >= math.MaxUint64 {
+			return math.MaxUint64, nil
+		}
+		return uint64(v), nil
+	}
+	return 0, fmt.Errorf("unexpected result type %s", v.Type())
+}
+
+func clampInt(v uint64) int64 {
+	if v > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
@@ -0,0 +1,233 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	apitypes "k8s.io/apimachinery/pkg/types"
+
+	"sigs.k8s.io/metrics-server/pkg/storage"
+)
+
+func testBatch() *storage.MetricsBatch {
+	return &storage.MetricsBatch{
+		Nodes: map[string]storage.MetricsPoint{
+			"node1": {CumulativeCpuUsed: 1000, MemoryUsage: 2000},
+		},
+		Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+			{Namespace: "ns1", Name: "pod1"}: {
+				Pod: storage.MetricsPoint{CumulativeCpuUsed: 300, MemoryUsage: 400},
+				Containers: map[string]storage.MetricsPoint{
+					"app":         {CumulativeCpuUsed: 100, MemoryUsage: 200},
+					"istio-proxy": {CumulativeCpuUsed: 200, MemoryUsage: 200},
+				},
+			},
+			{Namespace: "ns2", Name: "pod2"}: {
+				Containers: map[string]storage.MetricsPoint{
+					"istio-proxy": {CumulativeCpuUsed: 200, MemoryUsage: 200},
+				},
+			},
+		},
+	}
+}
+
+func TestApply(t *testing.T) {
+	tcs := []struct {
+		name   string
+		config Config
+		want   *storage.MetricsBatch
+	}{
+		{
+			name:   "No expressions",
+			config: Config{},
+			want:   testBatch(),
+		},
+		{
+			name:   "Drop containers and pods left without containers",
+			config: Config{Drop: `container == "istio-proxy"`},
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {CumulativeCpuUsed: 1000, MemoryUsage: 2000},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "ns1", Name: "pod1"}: {
+						Pod: storage.MetricsPoint{CumulativeCpuUsed: 300, MemoryUsage: 400},
+						Containers: map[string]storage.MetricsPoint{
+							"app": {CumulativeCpuUsed: 100, MemoryUsage: 200},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Clamp and rescale",
+			config: Config{Resources: map[corev1.ResourceName]string{
+				corev1.ResourceMemory: `memory > 300 ? 300 : memory`,
+				corev1.ResourceCPU:    `node != "" ? cpu * 2 : cpu`,
+			}},
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {CumulativeCpuUsed: 2000, MemoryUsage: 300},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "ns1", Name: "pod1"}: {
+						Pod: storage.MetricsPoint{CumulativeCpuUsed: 300, MemoryUsage: 300},
+						Containers: map[string]storage.MetricsPoint{
+							"app":         {CumulativeCpuUsed: 100, MemoryUsage: 200},
+							"istio-proxy": {CumulativeCpuUsed: 200, MemoryUsage: 200},
+						},
+					},
+					{Namespace: "ns2", Name: "pod2"}: {
+						Containers: map[string]storage.MetricsPoint{
+							"istio-proxy": {CumulativeCpuUsed: 200, MemoryUsage: 200},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Negative and fractional results",
+			config: Config{Resources: map[corev1.ResourceName]string{
+				corev1.ResourceMemory: `double(memory) / 3.0`,
+				corev1.ResourceCPU:    `podNamespace == "ns2" ? -1 : cpu`,
+			}},
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {CumulativeCpuUsed: 1000, MemoryUsage: 666},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "ns1", Name: "pod1"}: {
+						Pod: storage.MetricsPoint{CumulativeCpuUsed: 300, MemoryUsage: 133},
+						Containers: map[string]storage.MetricsPoint{
+							"app":         {CumulativeCpuUsed: 100, MemoryUsage: 66},
+							"istio-proxy": {CumulativeCpuUsed: 200, MemoryUsage: 66},
+						},
+					},
+					{Namespace: "ns2", Name: "pod2"}: {
+						Containers: map[string]storage.MetricsPoint{
+							"istio-proxy": {CumulativeCpuUsed: 0, MemoryUsage: 66},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:   "Failed evaluation keeps points",
+			config: Config{Resources: map[corev1.ResourceName]string{corev1.ResourceMemory: `memory / (cpu - 200)`}},
+			want: &storage.MetricsBatch{
+				Nodes: map[string]storage.MetricsPoint{
+					"node1": {CumulativeCpuUsed: 1000, MemoryUsage: 2},
+				},
+				Pods: map[apitypes.NamespacedName]storage.PodMetricsPoint{
+					{Namespace: "ns1", Name: "pod1"}: {
+						Pod: storage.MetricsPoint{CumulativeCpuUsed: 300, MemoryUsage: 4},
+						Containers: map[string]storage.MetricsPoint{
+							"app":         {CumulativeCpuUsed: 100, MemoryUsage: 0},
+							"istio-proxy": {CumulativeCpuUsed: 200, MemoryUsage: 200},
+						},
+					},
+					{Namespace: "ns2", Name: "pod2"}: {
+						Containers: map[string]storage.MetricsPoint{
+							"istio-proxy": {CumulativeCpuUsed: 200, MemoryUsage: 200},
+						},
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			transformer, err := New(tc.config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			batch := testBatch()
+			got := transformer.Apply(batch)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unexpected batch, diff:\n%s", diff)
+			}
+			if diff := cmp.Diff(testBatch(), batch); diff != "" {
+				t.Errorf("Input batch was modified, diff:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tcs := []struct {
+		name   string
+		config Config
+	}{
+		{
+			name:   "Syntax error",
+			config: Config{Drop: `container ==`},
+		},
+		{
+			name:   "Unknown variable",
+			config: Config{Drop: `image == "pause"`},
+		},
+		{
+			name:   "Drop not bool",
+			config: Config{Drop: `container`},
+		},
+		{
+			name:   "Resource not number",
+			config: Config{Resources: map[corev1.ResourceName]string{corev1.ResourceCPU: `container`}},
+		},
+		{
+			name:   "Unsupported resource",
+			config: Config{Resources: map[corev1.ResourceName]string{"pid": `1`}},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(tc.config); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.yaml")
+	config := `
+drop: 'podNamespace == "ns2"'
+resources:
+  memory: 'memory * 2'
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	transformer, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := transformer.Apply(testBatch())
+	if len(got.Pods) != 1 || got.Nodes["node1"].MemoryUsage != 4000 {
+		t.Errorf("Unexpected batch %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("dropp: 'true'\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFile(path); err == nil {
+		t.Error("Expected error for unknown field")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AddressFamily selects the IP family of node addresses used to connect to Kubelets on dual-stack clusters.
+type AddressFamily string
+
+const (
+	// AddressFamilyAny picks addresses regardless of their family.
+	AddressFamilyAny AddressFamily = "any"
+	// AddressFamilyPreferIPv4 picks IPv4 addresses, falling back to any address on nodes without one.
+	AddressFamilyPreferIPv4 AddressFamily = "prefer-ipv4"
+	// AddressFamilyPreferIPv6 picks IPv6 addresses, falling back to any address on nodes without one.
+	AddressFamilyPreferIPv6 AddressFamily = "prefer-ipv6"
+	// AddressFamilyIPv4 only picks IPv4 addresses.
+	AddressFamilyIPv4 AddressFamily = "ipv4"
+	// AddressFamilyIPv6 only picks IPv6 addresses.
+	AddressFamilyIPv6 AddressFamily = "ipv6"
+)
+
+// AddressFamilies lists supported address families.
+var AddressFamilies = []AddressFamily{AddressFamilyAny, AddressFamilyPreferIPv4, AddressFamilyPreferIPv6, AddressFamilyIPv4, AddressFamilyIPv6}
+
+// ParseAddressFamily validates family, empty meaning AddressFamilyAny.
+func ParseAddressFamily(family string) (AddressFamily, error) {
+	if family == "" {
+		return AddressFamilyAny, nil
+	}
+	for _, f := range AddressFamilies {
+		if AddressFamily(family) == f {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown address family %q, expected one of %v", family, AddressFamilies)
+}
+
+// WithAddressFamily returns a resolver restricting the node status addresses
+// seen by resolver to IP addresses of family. With a preferred family, all
+// addresses are considered again if none of the family resolves. Addresses
+// not read from the node status, e.g. annotations, are used as is.
+func WithAddressFamily(resolver NodeAddressResolver, family AddressFamily) NodeAddressResolver {
+	switch family {
+	case AddressFamilyPreferIPv4, AddressFamilyIPv4:
+		return &familyNodeAddrResolver{resolver: resolver, ipv6: false, required: family == AddressFamilyIPv4}
+	case AddressFamilyPreferIPv6, AddressFamilyIPv6:
+		return &familyNodeAddrResolver{resolver: resolver, ipv6: true, required: family == AddressFamilyIPv6}
+	default:
+		return resolver
+	}
+}
+
+type familyNodeAddrResolver struct {
+	resolver NodeAddressResolver
+	// ipv6 selects IPv6 addresses, IPv4 otherwise.
+	ipv6 bool
+	// required disables falling back to addresses of other families.
+	required bool
+}
+
+func (r *familyNodeAddrResolver) NodeAddress(node *corev1.Node) (string, error) {
+	addresses := make([]corev1.NodeAddress, 0, len(node.Status.Addresses))
+	for _, addr := range node.Status.Addresses {
+		if ip := net.ParseIP(addr.Address); ip != nil && (ip.To4() == nil) == r.ipv6 {
+			addresses = append(addresses, addr)
+		}
+	}
+	if len(addresses) != 0 || r.required {
+		// Copy the node, so the cached one isn't modified.
+		filtered := *node
+		filtered.Status.Addresses = addresses
+		address, err := r.resolver.NodeAddress(&filtered)
+		if err == nil {
+			return address, nil
+		}
+		if r.required {
+			return "", fmt.Errorf("no %s address resolved: %w", r.family(), err)
+		}
+	}
+	return r.resolver.NodeAddress(node)
+}
+
+func (r *familyNodeAddrResolver) family() string {
+	if r.ipv6 {
+		return "IPv6"
+	}
+	return "IPv4"
+}
@@ -16,10 +16,26 @@ package utils
 
 import (
 	"fmt"
+	"sort"
+	"sync"
 
 	corev1 "k8s.io/api/core/v1"
 )
 
+const (
+	// PriorityNodeAddressResolver is the name of the resolver picking the
+	// node status address by address type priority.
+	PriorityNodeAddressResolver = "priority"
+	// AnnotationNodeAddressResolver is the name of the resolver dialing the
+	// address set in KubeletAddressAnnotation, e.g. a jump host mapping,
+	// falling back to the address type priority on nodes without it.
+	AnnotationNodeAddressResolver = "annotation"
+
+	// KubeletAddressAnnotation is the node annotation holding the address
+	// used to connect to its Kubelet by AnnotationNodeAddressResolver.
+	KubeletAddressAnnotation = "metrics.k8s.io/kubelet-address"
+)
+
 var (
 	// DefaultAddressTypePriority is the default node address type
 	// priority list, as taken from the Kubernetes API metrics-server options.
@@ -74,3 +90,76 @@ func NewPriorityNodeAddressResolver(typePriority []corev1.NodeAddressType) NodeA
 		addrTypePriority: typePriority,
 	}
 }
+
+// NodeAddressResolverFactory creates a NodeAddressResolver given the
+// configured priority of node address types, e.g. to fall back to
+// NewPriorityNodeAddressResolver for nodes it doesn't know about.
+type NodeAddressResolverFactory func(typePriority []corev1.NodeAddressType) (NodeAddressResolver, error)
+
+var (
+	resolversLock sync.RWMutex
+	resolvers     = map[string]NodeAddressResolverFactory{
+		PriorityNodeAddressResolver: func(typePriority []corev1.NodeAddressType) (NodeAddressResolver, error) {
+			return NewPriorityNodeAddressResolver(typePriority), nil
+		},
+		AnnotationNodeAddressResolver: func(typePriority []corev1.NodeAddressType) (NodeAddressResolver, error) {
+			return &annotationNodeAddrResolver{fallback: NewPriorityNodeAddressResolver(typePriority)}, nil
+		},
+	}
+)
+
+// RegisterNodeAddressResolver makes a resolver available under name, to be
+// selected with the --kubelet-address-resolver flag. Custom builds of
+// metrics-server register resolvers, e.g. resolving addresses through a cloud
+// API, before running the command.
+func RegisterNodeAddressResolver(name string, factory NodeAddressResolverFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("node address resolver needs a name and a factory")
+	}
+	resolversLock.Lock()
+	defer resolversLock.Unlock()
+	if _, found := resolvers[name]; found {
+		return fmt.Errorf("node address resolver %q is already registered", name)
+	}
+	resolvers[name] = factory
+	return nil
+}
+
+// NodeAddressResolvers returns the sorted names of registered resolvers.
+func NodeAddressResolvers() []string {
+	resolversLock.RLock()
+	defer resolversLock.RUnlock()
+	names := make([]string, 0, len(resolvers))
+	for name := range resolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewNodeAddressResolver creates the resolver registered under name,
+// PriorityNodeAddressResolver if name is empty.
+func NewNodeAddressResolver(name string, typePriority []corev1.NodeAddressType) (NodeAddressResolver, error) {
+	if name == "" {
+		name = PriorityNodeAddressResolver
+	}
+	resolversLock.RLock()
+	factory, found := resolvers[name]
+	resolversLock.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("unknown node address resolver %q, expected one of %v", name, NodeAddressResolvers())
+	}
+	return factory(typePriority)
+}
+
+// annotationNodeAddrResolver finds node addresses in KubeletAddressAnnotation.
+type annotationNodeAddrResolver struct {
+	fallback NodeAddressResolver
+}
+
+func (r *annotationNodeAddrResolver) NodeAddress(node *corev1.Node) (string, error) {
+	if address := node.Annotations[KubeletAddressAnnotation]; address != "" {
+		return address, nil
+	}
+	return r.fallback.NodeAddress(node)
+}
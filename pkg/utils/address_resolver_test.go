@@ -0,0 +1,95 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type staticResolver string
+
+func (r staticResolver) NodeAddress(*corev1.Node) (string, error) {
+	return string(r), nil
+}
+
+var _ = Describe("Node address resolvers", func() {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeExternalIP, Address: "203.0.113.1"},
+			{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+		}},
+	}
+
+	It("should resolve addresses by type priority by default", func() {
+		resolver, err := NewNodeAddressResolver("", DefaultAddressTypePriority)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolver.NodeAddress(node)).To(Equal("10.0.0.1"))
+	})
+	It("should prefer the address set in the node annotation", func() {
+		resolver, err := NewNodeAddressResolver(AnnotationNodeAddressResolver, DefaultAddressTypePriority)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolver.NodeAddress(node)).To(Equal("10.0.0.1"))
+
+		annotated := node.DeepCopy()
+		annotated.Annotations = map[string]string{KubeletAddressAnnotation: "jump-host.example.com"}
+		Expect(resolver.NodeAddress(annotated)).To(Equal("jump-host.example.com"))
+	})
+	It("should pick addresses of the configured family", func() {
+		dualStack := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+			Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: "node1"},
+				{Type: corev1.NodeInternalIP, Address: "10.0.0.1"},
+				{Type: corev1.NodeInternalIP, Address: "fd00::1"},
+				{Type: corev1.NodeExternalIP, Address: "2001:db8::1"},
+			}},
+		}
+		resolver, err := NewNodeAddressResolver("", DefaultAddressTypePriority)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(WithAddressFamily(resolver, AddressFamilyAny).NodeAddress(dualStack)).To(Equal("node1"))
+		Expect(WithAddressFamily(resolver, AddressFamilyPreferIPv6).NodeAddress(dualStack)).To(Equal("fd00::1"))
+		Expect(WithAddressFamily(resolver, AddressFamilyIPv4).NodeAddress(dualStack)).To(Equal("10.0.0.1"))
+		Expect(dualStack.Status.Addresses).To(HaveLen(4), "cached node should not be modified")
+
+		By("falling back to other addresses only with a preferred family")
+		ipv4Only := node.DeepCopy()
+		Expect(WithAddressFamily(resolver, AddressFamilyPreferIPv6).NodeAddress(ipv4Only)).To(Equal("10.0.0.1"))
+		_, err = WithAddressFamily(resolver, AddressFamilyIPv6).NodeAddress(ipv4Only)
+		Expect(err).To(HaveOccurred())
+	})
+	It("should create registered custom resolvers", func() {
+		Expect(RegisterNodeAddressResolver("static", func(typePriority []corev1.NodeAddressType) (NodeAddressResolver, error) {
+			return staticResolver("192.0.2.1"), nil
+		})).To(Succeed())
+		Expect(NodeAddressResolvers()).To(Equal([]string{AnnotationNodeAddressResolver, PriorityNodeAddressResolver, "static"}))
+		resolver, err := NewNodeAddressResolver("static", DefaultAddressTypePriority)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolver.NodeAddress(node)).To(Equal("192.0.2.1"))
+
+		By("rejecting resolvers registered twice")
+		Expect(RegisterNodeAddressResolver(PriorityNodeAddressResolver, func([]corev1.NodeAddressType) (NodeAddressResolver, error) {
+			return staticResolver(""), nil
+		})).NotTo(Succeed())
+	})
+	It("should reject unknown resolvers", func() {
+		_, err := NewNodeAddressResolver("cloud", DefaultAddressTypePriority)
+		Expect(err).To(HaveOccurred())
+	})
+})
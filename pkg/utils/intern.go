@@ -0,0 +1,71 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// internGeneration is how long interned strings are kept without being used.
+const internGeneration = 10 * time.Minute
+
+// Interner deduplicates strings decoded over and over, like namespaces, pod
+// and container names read from every scrape, so they share memory instead
+// of being allocated again on every decode. Strings unused for two
+// generations are forgotten, so memory is bounded by strings in use even as
+// pods churn. It is safe for concurrent use.
+type Interner struct {
+	mu sync.RWMutex
+	// current holds strings interned in the current generation.
+	current map[string]string
+	// previous holds strings of the previous generation not interned again yet.
+	previous map[string]string
+	// started is the start time of the current generation.
+	started time.Time
+	now     func() time.Time
+}
+
+func NewInterner() *Interner {
+	return &Interner{current: map[string]string{}, started: time.Now(), now: time.Now}
+}
+
+// Intern returns a string equal to b, sharing memory with previous results
+// for equal inputs.
+func (i *Interner) Intern(b []byte) string {
+	i.mu.RLock()
+	// Indexing with a converted byte slice doesn't allocate.
+	s, found := i.current[string(b)]
+	i.mu.RUnlock()
+	if found {
+		return s
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if s, found := i.current[string(b)]; found {
+		return s
+	}
+	if now := i.now(); now.Sub(i.started) > internGeneration {
+		i.previous, i.current, i.started = i.current, make(map[string]string, len(i.current)), now
+	}
+	s, found = i.previous[string(b)]
+	if found {
+		delete(i.previous, s)
+	} else {
+		s = string(b)
+	}
+	i.current[s] = s
+	return s
+}
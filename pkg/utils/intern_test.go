@@ -0,0 +1,74 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"time"
+	"unsafe"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Interner", func() {
+	var (
+		interner *Interner
+		now      time.Time
+	)
+	BeforeEach(func() {
+		now = time.Now()
+		interner = NewInterner()
+		interner.now = func() time.Time { return now }
+		interner.started = now
+	})
+	sameMemory := func(a, b string) bool {
+		return unsafe.StringData(a) == unsafe.StringData(b)
+	}
+
+	It("should return equal strings sharing memory", func() {
+		first := interner.Intern([]byte("kube-system"))
+		second := interner.Intern([]byte("kube-system"))
+		Expect(second).To(Equal("kube-system"))
+		Expect(sameMemory(first, second)).To(BeTrue())
+		Expect(interner.Intern([]byte("default"))).To(Equal("default"))
+	})
+	It("should not be affected by changes of the input", func() {
+		b := []byte("pod-1")
+		s := interner.Intern(b)
+		b[4] = '2'
+		Expect(s).To(Equal("pod-1"))
+		Expect(interner.Intern(b)).To(Equal("pod-2"))
+	})
+	It("should keep strings used in the last generation", func() {
+		first := interner.Intern([]byte("container"))
+		now = now.Add(internGeneration + time.Second)
+		// A new string starts the next generation.
+		interner.Intern([]byte("other"))
+		Expect(sameMemory(interner.Intern([]byte("container")), first)).To(BeTrue())
+
+		now = now.Add(internGeneration + time.Second)
+		interner.Intern([]byte("another"))
+		Expect(sameMemory(interner.Intern([]byte("container")), first)).To(BeTrue())
+	})
+	It("should forget strings unused for two generations", func() {
+		first := interner.Intern([]byte("deleted-pod"))
+		for i := 0; i < 2; i++ {
+			now = now.Add(internGeneration + time.Second)
+			interner.Intern([]byte{byte('a' + i)})
+		}
+		Expect(len(interner.current) + len(interner.previous)).To(Equal(2))
+		Expect(sameMemory(interner.Intern([]byte("deleted-pod")), first)).To(BeFalse())
+	})
+})
@@ -15,11 +15,29 @@
 package utils
 
 import (
+	"context"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/component-base/metrics"
 )
 
+// ObserveWithTrace observes value on observer, with the trace and span IDs
+// of the sampled span in ctx as exemplar, linking histogram buckets to
+// traces. Exemplars are only exposed in the OpenMetrics format.
+func ObserveWithTrace(ctx context.Context, observer metrics.ObserverMetric, value float64) {
+	span := trace.SpanContextFromContext(ctx)
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && span.IsSampled() {
+		exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{
+			"trace_id": span.TraceID().String(),
+			"span_id":  span.SpanID().String(),
+		})
+		return
+	}
+	observer.Observe(value)
+}
+
 // BucketsForScrapeDuration calculates a variant of the prometheus default histogram
 // buckets that includes relevant buckets around our scrape timeout.
 func BucketsForScrapeDuration(scrapeTimeout time.Duration) []float64 {
@@ -56,3 +74,16 @@ func BucketsForScrapeDuration(scrapeTimeout time.Duration) []float64 {
 
 	return buckets
 }
+
+// BucketsForLatency calculates histogram buckets for the age of served
+// metrics as fractions and multiples of the metric resolution, as metrics are
+// expected to be up to one resolution plus a scrape old.
+func BucketsForLatency(resolution time.Duration) []float64 {
+	seconds := float64(resolution) / float64(time.Second)
+	factors := []float64{0.1, 0.25, 0.5, 0.75, 1, 1.25, 1.5, 2, 3, 5, 10}
+	buckets := make([]float64, len(factors))
+	for i, factor := range factors {
+		buckets[i] = seconds * factor
+	}
+	return buckets
+}
@@ -15,12 +15,16 @@
 package utils
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/component-base/metrics"
 )
 
@@ -76,4 +80,42 @@ var _ = Describe("Prometheus Bucket Estimator", func() {
 			Expect(BucketsForScrapeDuration(maxBucketDuration)).To(ContainElement(maxBucket))
 		})
 	})
+	Context("for latency of served metrics", func() {
+		It("should generate buckets around the metric resolution in strictly increasing order", func() {
+			buckets := BucketsForLatency(time.Minute)
+			lastBucket := 0.0
+			for _, bucket := range buckets {
+				Expect(bucket).To(BeNumerically(">", lastBucket))
+				lastBucket = bucket
+			}
+			Expect(buckets).To(ContainElements(30.0, 60.0, 120.0))
+		})
+	})
+})
+
+var _ = Describe("Trace exemplars", func() {
+	exemplar := func(ctx context.Context) *dto.Exemplar {
+		histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Buckets: []float64{1}})
+		ObserveWithTrace(ctx, histogram, 0.5)
+		m := &dto.Metric{}
+		Expect(histogram.Write(m)).To(Succeed())
+		Expect(m.GetHistogram().GetSampleCount()).To(BeEquivalentTo(1))
+		return m.GetHistogram().GetBucket()[0].GetExemplar()
+	}
+	It("should attach the trace of sampled spans", func() {
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x0a},
+			SpanID:     trace.SpanID{0x0b},
+			TraceFlags: trace.FlagsSampled,
+		}))
+		Expect(exemplar(ctx).GetLabel()).To(HaveLen(2))
+	})
+	It("should only observe without a sampled span", func() {
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{0x0a},
+			SpanID:  trace.SpanID{0x0b},
+		}))
+		Expect(exemplar(ctx)).To(BeNil())
+		Expect(exemplar(context.Background())).To(BeNil())
+	})
 })
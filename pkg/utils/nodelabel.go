@@ -0,0 +1,42 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// NodeLabels is the number of stable hash buckets of node names per-node
+// metrics are labeled with instead of node names, bounding their
+// cardinality. 0 labels them with node names.
+type NodeLabels uint32
+
+// Label returns the node label value of per-node metrics for node,
+// "bucket-" followed by the FNV-1a hash of the name modulo the number of
+// buckets if hashing is enabled.
+func (b NodeLabels) Label(node string) string {
+	if b == 0 {
+		return node
+	}
+	return "bucket-" + strconv.FormatUint(uint64(NodeHash(node)%uint32(b)), 10)
+}
+
+// NodeHash returns the FNV-1a hash of a node name.
+func NodeHash(name string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return h.Sum32()
+}
@@ -0,0 +1,143 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build logcheck
+// +build logcheck
+
+package logcheck
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// keyPattern matches structured logging keys, alphanumeric lowerCamelCase.
+var keyPattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
+// helper is a project-local wrapper of klog or logr, whose calls are
+// validated like calls of the logging functions it wraps.
+type helper struct {
+	// keysAndValues is the index of the first key/value argument, -1 if none.
+	keysAndValues int
+	// verbosity is the index of the verbosity argument, -1 if none.
+	verbosity int
+}
+
+// parseHelpers reads helpers from a config file with one helper per line, as
+// the full name of the function followed by the indexes of its arguments:
+//
+//	sigs.k8s.io/metrics-server/pkg/scraper.logNode keysAndValues=3 verbosity=0
+//	(*sigs.k8s.io/metrics-server/pkg/api.podMetrics).log keysAndValues=1
+//
+// Empty lines and lines starting with # are ignored.
+func parseHelpers(path string) (map[string]helper, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	helpers := map[string]helper{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		h := helper{keysAndValues: -1, verbosity: -1}
+		for _, field := range fields[1:] {
+			name, value, _ := strings.Cut(field, "=")
+			index, err := strconv.Atoi(value)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid argument index %q", path, line, field)
+			}
+			switch name {
+			case "keysAndValues":
+				h.keysAndValues = index
+			case "verbosity":
+				h.verbosity = index
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown argument %q, expected keysAndValues or verbosity", path, line, name)
+			}
+		}
+		if h.keysAndValues < 0 && h.verbosity < 0 {
+			return nil, fmt.Errorf("%s:%d: helper %s has no argument to check", path, line, fields[0])
+		}
+		helpers[fields[0]] = h
+	}
+	return helpers, scanner.Err()
+}
+
+// newHelperAnalyzer returns an analyzer checking that calls of helpers pass
+// constant lowerCamelCase keys, key/value pairs and a positive constant
+// verbosity, which logcheck only enforces for klog and logr calls.
+func newHelperAnalyzer(helpers map[string]helper) *analysis.Analyzer {
+	return &analysis.Analyzer{
+		Name:     "loghelpers",
+		Doc:      "checks calls of project-local logging helpers like logcheck checks klog and logr calls",
+		Requires: []*analysis.Analyzer{inspect.Analyzer},
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+			inspect.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+				call := n.(*ast.CallExpr)
+				fn := typeutil.StaticCallee(pass.TypesInfo, call)
+				if fn == nil {
+					return
+				}
+				if h, found := helpers[fn.FullName()]; found {
+					checkHelperCall(pass, call, fn.Name(), h)
+				}
+			})
+			return nil, nil
+		},
+	}
+}
+
+func checkHelperCall(pass *analysis.Pass, call *ast.CallExpr, name string, h helper) {
+	if h.verbosity >= 0 && h.verbosity < len(call.Args) {
+		v := pass.TypesInfo.Types[call.Args[h.verbosity]].Value
+		if level, ok := constant.Int64Val(constant.ToInt(v)); v == nil || !ok || level <= 0 {
+			pass.Reportf(call.Args[h.verbosity].Pos(), "Verbosity of %s should be a positive constant", name)
+		}
+	}
+	// Key/value slices passed on with ... are checked where they are built.
+	if h.keysAndValues < 0 || h.keysAndValues > len(call.Args) || call.Ellipsis.IsValid() {
+		return
+	}
+	kvs := call.Args[h.keysAndValues:]
+	if len(kvs)%2 != 0 {
+		pass.Reportf(call.Pos(), "Additional arguments to %s should always be Key Value pairs. Please check if there is any key or value missing.", name)
+		return
+	}
+	for i := 0; i < len(kvs); i += 2 {
+		v := pass.TypesInfo.Types[kvs[i]].Value
+		if v == nil || v.Kind() != constant.String {
+			pass.Reportf(kvs[i].Pos(), "Key positional arguments of %s are expected to be inlined constant strings.", name)
+			continue
+		}
+		if key := constant.StringVal(v); !keyPattern.MatchString(key) {
+			pass.Reportf(kvs[i].Pos(), "Key %q passed to %s should be alphanumeric and start with a lowercase letter", key, name)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build logcheck
+// +build logcheck
+
+// Package logcheck runs the logcheck analyzer over metrics-server to guard
+// the migration to contextual logging, and validates calls of project-local
+// logging helpers listed in helpers.conf the same way. Run it with
+// "make verify-logcheck"; helpers are also checked by
+// "make verify-structured-logging".
+package logcheck
+
+import (
+	"path"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/analysistest"
+	"golang.org/x/tools/go/packages"
+	logcheck "sigs.k8s.io/logtools/logcheck/pkg"
+)
+
+// checks are enforced in every package.
+var checks = []string{"structured", "parameters", "key", "with-helpers"}
+
+// contextualPackages lists packages already migrated to contextual logging,
+// in which using the global klog logger is a regression. Add packages here
+// once they are converted, a trailing "/..." also covers subpackages.
+var contextualPackages = map[string]bool{
+	"sigs.k8s.io/metrics-server/pkg/scraper":            true,
+	"sigs.k8s.io/metrics-server/pkg/scraper/client/...": true,
+	"sigs.k8s.io/metrics-server/pkg/server":             true,
+	"sigs.k8s.io/metrics-server/pkg/storage":            true,
+}
+
+// isContextual returns true if the package with path pkgPath is listed in
+// contextualPackages, by itself or by one of its parents.
+func isContextual(pkgPath string) bool {
+	if contextualPackages[pkgPath] {
+		return true
+	}
+	for p := pkgPath; p != "."; p = path.Dir(p) {
+		if contextualPackages[p+"/..."] {
+			return true
+		}
+	}
+	return false
+}
+
+func newAnalyzer(t *testing.T, contextual bool) *analysis.Analyzer {
+	t.Helper()
+	a := logcheck.Analyser()
+	for _, check := range checks {
+		if err := a.Flags.Set("check-"+check, "true"); err != nil {
+			t.Fatalf("Failed enabling check %q: %v", check, err)
+		}
+	}
+	if err := a.Flags.Set("check-contextual", strconv.FormatBool(contextual)); err != nil {
+		t.Fatalf("Failed configuring contextual check: %v", err)
+	}
+	return a
+}
+
+// TestFixtures verifies the analyzer reports the violations annotated with
+// "want" comments in testdata, modeled on code of the scraper, storage and
+// api packages.
+func TestFixtures(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), newAnalyzer(t, true), "scraper", "storage", "api")
+
+	helpers, err := parseHelpers(filepath.Join(analysistest.TestData(), "helpers.conf"))
+	if err != nil {
+		t.Fatalf("Failed reading helpers: %v", err)
+	}
+	analysistest.Run(t, analysistest.TestData(), newHelperAnalyzer(helpers), "helpers")
+}
+
+// TestRepository fails on any logcheck diagnostic in metrics-server packages.
+func TestRepository(t *testing.T) {
+	legacy, contextual := newAnalyzer(t, false), newAnalyzer(t, true)
+	analyzeRepository(t, func(pkg *packages.Package) *analysis.Analyzer {
+		if isContextual(pkg.PkgPath) {
+			return contextual
+		}
+		return legacy
+	})
+}
+
+// TestHelpers fails on calls of helpers listed in helpers.conf violating the
+// checks logcheck applies to the calls they wrap.
+func TestHelpers(t *testing.T) {
+	helpers, err := parseHelpers("helpers.conf")
+	if err != nil {
+		t.Fatalf("Failed reading helpers: %v", err)
+	}
+	a := newHelperAnalyzer(helpers)
+	analyzeRepository(t, func(*packages.Package) *analysis.Analyzer { return a })
+}
+
+// analyzeRepository applies the analyzer returned by analyzer to each
+// metrics-server package, failing t on any diagnostic.
+func analyzeRepository(t *testing.T, analyzer func(*packages.Package) *analysis.Analyzer) {
+	t.Helper()
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := packages.Load(&packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedTypesSizes,
+		Dir:  root,
+	}, "./cmd/...", "./pkg/...")
+	if err != nil {
+		t.Fatalf("Failed loading packages: %v", err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		t.Fatal("Failed loading packages")
+	}
+	for _, pkg := range pkgs {
+		report := func(d analysis.Diagnostic) {
+			position := pkg.Fset.Position(d.Pos)
+			if rel, err := filepath.Rel(root, position.Filename); err == nil {
+				position.Filename = rel
+			}
+			t.Errorf("%s: %s", position, d.Message)
+		}
+		if _, err := run(analyzer(pkg), pkg, report); err != nil {
+			t.Errorf("Failed analyzing %s: %v", pkg.PkgPath, err)
+		}
+	}
+}
+
+// run applies a and the analyzers it requires to pkg, like the analysis
+// drivers do for a single package. logcheck doesn't use facts.
+func run(a *analysis.Analyzer, pkg *packages.Package, report func(analysis.Diagnostic)) (interface{}, error) {
+	resultOf := make(map[*analysis.Analyzer]interface{}, len(a.Requires))
+	for _, required := range a.Requires {
+		res, err := run(required, pkg, func(analysis.Diagnostic) {})
+		if err != nil {
+			return nil, err
+		}
+		resultOf[required] = res
+	}
+	pass := &analysis.Pass{
+		Analyzer:   a,
+		Fset:       pkg.Fset,
+		Files:      pkg.Syntax,
+		OtherFiles: pkg.OtherFiles,
+		Pkg:        pkg.Types,
+		TypesInfo:  pkg.TypesInfo,
+		TypesSizes: pkg.TypesSizes,
+		ResultOf:   resultOf,
+		Report:     report,
+	}
+	return a.Run(pass)
+}
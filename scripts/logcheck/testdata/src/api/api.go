@@ -0,0 +1,33 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api mirrors logging of pkg/api.
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog/v2"
+)
+
+func getMetrics(ctx context.Context, namespace, pod string) error {
+	logger := klog.FromContext(ctx)
+	err := fmt.Errorf("not found")
+	logger.Error(err, "Failed reading pod metrics", "pod", klog.KRef(namespace, pod))
+
+	klog.ErrorS(err, "Failed reading pod metrics", "pod", klog.KRef(namespace, pod)) // want `"ErrorS" should not be used, convert to contextual logging`
+	klog.Background().Info("Failed reading pod metrics", "pod")                      // want `Key Value pairs`
+	return err
+}
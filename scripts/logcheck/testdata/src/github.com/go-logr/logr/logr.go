@@ -0,0 +1,25 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logr is a minimal stand-in for github.com/go-logr/logr, providing
+// what the fixtures use.
+package logr
+
+type Logger struct{}
+
+func (l Logger) Info(msg string, keysAndValues ...interface{})             {}
+func (l Logger) Error(err error, msg string, keysAndValues ...interface{}) {}
+func (l Logger) V(level int) Logger                                        { return l }
+func (l Logger) WithValues(keysAndValues ...interface{}) Logger            { return l }
+func (l Logger) WithName(name string) Logger                               { return l }
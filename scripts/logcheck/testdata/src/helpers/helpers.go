@@ -0,0 +1,49 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package helpers defines project-local logging helpers configured in helpers.conf.
+package helpers
+
+import (
+	"k8s.io/klog/v2"
+)
+
+func logNode(v klog.Level, node string, msg string, keysAndValues ...interface{}) {
+	klog.V(v).InfoS(msg, append([]interface{}{"node", node}, keysAndValues...)...)
+}
+
+type scraper struct{}
+
+func (s *scraper) log(msg string, keysAndValues ...interface{}) {
+	klog.InfoS(msg, keysAndValues...)
+}
+
+func scrape(s *scraper, node string, level klog.Level, key string) {
+	logNode(2, node, "Scraping node", "timeout", 10)
+	logNode(0, node, "Scraping node")                // want `Verbosity of logNode should be a positive constant`
+	logNode(level, node, "Scraping node")            // want `Verbosity of logNode should be a positive constant`
+	logNode(2, node, "Scraping node", "timeout")     // want `Key Value pairs`
+	logNode(2, node, "Scraping node", key, 10)       // want `expected to be inlined constant strings`
+	logNode(2, node, "Scraping node", "Timeout", 10) // want `should be alphanumeric and start with a lowercase letter`
+
+	s.log("Scrape finished", "nodeCount", 1)
+	s.log("Scrape finished", "node-count", 1) // want `should be alphanumeric and start with a lowercase letter`
+	kvs := []interface{}{"nodeCount", 1}
+	s.log("Scrape finished", kvs...)
+
+	logger := klog.Background()
+	klog.LoggerWithValues(logger, "node", klog.KRef("", node))
+	klog.LoggerWithValues(logger, "Node", klog.KRef("", node)) // want `should be alphanumeric and start with a lowercase letter`
+	klog.LoggerWithValues(logger, "cycle")                     // want `Key Value pairs`
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package klog is a minimal stand-in for k8s.io/klog/v2, providing what the
+// fixtures use.
+package klog
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+)
+
+type Logger = logr.Logger
+
+type ObjectRef struct {
+	Name      string
+	Namespace string
+}
+
+type KMetadata interface {
+	GetName() string
+	GetNamespace() string
+}
+
+func KObj(obj KMetadata) ObjectRef                                  { return ObjectRef{} }
+func KRef(namespace, name string) ObjectRef                         { return ObjectRef{} }
+func FromContext(ctx context.Context) Logger                        { return Logger{} }
+func NewContext(ctx context.Context, logger Logger) context.Context { return ctx }
+func Background() Logger                                            { return Logger{} }
+
+func LoggerWithValues(logger Logger, keysAndValues ...interface{}) Logger { return logger }
+
+func InfoS(msg string, keysAndValues ...interface{})             {}
+func ErrorS(err error, msg string, keysAndValues ...interface{}) {}
+
+type Level int32
+
+type Verbose struct{}
+
+func V(level Level) Verbose                                      { return Verbose{} }
+func (v Verbose) InfoS(msg string, keysAndValues ...interface{}) {}
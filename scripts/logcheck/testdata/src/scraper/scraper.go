@@ -0,0 +1,43 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scraper mirrors logging of pkg/scraper.
+package scraper
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog/v2"
+)
+
+func collectNode(ctx context.Context, node string) error {
+	logger := klog.FromContext(ctx).WithValues("node", node)
+	err := fmt.Errorf("connection refused")
+	logger.V(1).Info("Node addresses changed after connection error, retrying", "err", err)
+	logger.Error(err, "Failed to scrape node")
+
+	klog.ErrorS(err, "Failed to scrape node", "node", node) // want `"ErrorS" should not be used, convert to contextual logging`
+	logger.Info("Scrape finished", "node")                  // want `Key Value pairs`
+	return err
+}
+
+func scrape(ctx context.Context, nodes []string) {
+	logger := klog.FromContext(ctx).WithName("scraper")
+	ctx = klog.NewContext(ctx, logger)
+	for _, node := range nodes {
+		_ = collectNode(ctx, node)
+	}
+	logger.V(6).Info("Scraping metrics from nodes", "nodeCount", len(nodes))
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package storage mirrors logging of pkg/storage.
+package storage
+
+import (
+	"context"
+
+	"k8s.io/klog/v2"
+)
+
+func store(ctx context.Context, namespace, pod string, timestamp int64) {
+	logger := klog.FromContext(ctx)
+	logger.Info("Dropping metrics with negative CPU usage", "pod", klog.KRef(namespace, pod))
+
+	klog.InfoS("Dropping metrics with negative CPU usage", "pod", klog.KRef(namespace, pod)) // want `"InfoS" should not be used, convert to contextual logging`
+	key := "timestamp"
+	logger.Info("Dropping stale metrics", key, timestamp) // want `Key positional arguments`
+}
@@ -44,6 +44,8 @@ import (
 	"k8s.io/client-go/transport/spdy"
 	"k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+
+	"sigs.k8s.io/metrics-server/pkg/conformance"
 )
 
 const (
@@ -191,6 +193,13 @@ var _ = Describe("MetricsServer", func() {
 		Expect(usage.Cpu().MilliValue()).NotTo(Equal(0), "CPU of Container %q should not be equal zero", ms.Containers[1].Name)
 		Expect(usage.Memory().Value()/1024/1024).NotTo(Equal(0), "Memory of Container %q should not be equal zero", ms.Containers[1].Name)
 	})
+	It("passes metrics API conformance", func() {
+		results, err := conformance.Run(context.TODO(), conformance.Config{Rest: restConfig})
+		Expect(err).NotTo(HaveOccurred(), "Failed to run conformance checks")
+		for _, r := range results {
+			Expect(r.Err).NotTo(HaveOccurred(), "Conformance check %q failed", r.Check)
+		}
+	})
 	It("passes readyz probe", func() {
 		msPods := mustGetMetricsServerPods(client)
 		for _, pod := range msPods {
@@ -202,7 +211,6 @@ var _ = Describe("MetricsServer", func() {
 [+]poststarthook/storage-object-count-tracker-hook ok
 [+]metric-storage-ready ok
 [+]metric-informer-sync ok
-[+]metadata-informer-sync ok
 [+]shutdown ok
 readyz check passed
 `)
@@ -219,7 +227,6 @@ readyz check passed
 [+]poststarthook/max-in-flight-filter ok
 [+]poststarthook/storage-object-count-tracker-hook ok
 [+]metric-collection-timely ok
-[+]metadata-informer-sync ok
 livez check passed
 `)
 			Expect(diff == "").To(BeTrue(), "Unexpected response %s", diff)
@@ -336,12 +343,45 @@ livez check passed
 				"go_sync_mutex_wait_total_seconds_total",
 				"go_threads",
 				"hidden_metric_total",
+				"metrics_server_api_end_to_end_latency_seconds",
 				"metrics_server_api_metric_freshness_seconds",
+				"metrics_server_kubelet_client_certificate_renew_failures_total",
+				"metrics_server_kubelet_client_certificate_rotation_seconds",
+				"metrics_server_kubelet_clock_skew_seconds",
 				"metrics_server_kubelet_last_request_time_seconds",
+				"metrics_server_kubelet_last_successful_scrape_timestamp_seconds",
+				"metrics_server_kubelet_node_condition_patch_errors_total",
+				"metrics_server_kubelet_received_bytes_total",
+				"metrics_server_kubelet_removed_nodes",
 				"metrics_server_kubelet_request_duration_seconds",
+				"metrics_server_kubelet_request_timeout_seconds",
 				"metrics_server_kubelet_request_total",
+				"metrics_server_kubelet_scrapes_cut_off_total",
+				"metrics_server_kubelet_skipped_nodes",
+				"metrics_server_kubelet_tls_handshakes_total",
+				"metrics_server_kubelet_tls_sessions_flushed_total",
+				"metrics_server_kubelet_zone_max_staleness_seconds",
+				"metrics_server_kubelet_zone_nodes",
+				"metrics_server_kubelet_zone_scraped_nodes",
+				"metrics_server_leader_election_is_leader",
+				"metrics_server_manager_canary_last_success_timestamp_seconds",
+				"metrics_server_manager_config_restart_required",
+				"metrics_server_manager_cycles_total",
+				"metrics_server_manager_duplicate_instances",
+				"metrics_server_manager_last_cycle_timestamp_seconds",
 				"metrics_server_manager_tick_duration_seconds",
+				"metrics_server_push_fresh_nodes",
+				"metrics_server_replication_followers",
+				"metrics_server_shard_peer_request_duration_seconds",
+				"metrics_server_storage_approximate_memory_bytes",
+				"metrics_server_storage_checkpoint_restored",
+				"metrics_server_storage_entries",
+				"metrics_server_storage_inserts_total",
+				"metrics_server_storage_node_coverage_ratio",
 				"metrics_server_storage_points",
+				"metrics_server_storage_removals_total",
+				"metrics_server_storage_write_lock_duration_seconds",
+				"metrics_server_transform_errors_total",
 				"process_cpu_seconds_total",
 				"process_max_fds",
 				"process_open_fds",